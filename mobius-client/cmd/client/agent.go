@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"time"
+
+	"github.com/notawar/mobius/mobius-client/pkg/agent"
+)
+
+// runAgent runs the device agent until it is stopped
+func runAgent(args []string) {
+	fs := flag.NewFlagSet("agent", flag.ExitOnError)
+	serverURL := fs.String("server-url", os.Getenv("MOBIUS_SERVER_URL"), "URL of the Mobius server")
+	enrollToken := fs.String("enroll-token", os.Getenv("MOBIUS_ENROLL_TOKEN"), "User access token with devices:write to enroll through POST /api/v1/devices")
+	enrollSecret := fs.String("enroll-secret", os.Getenv("MOBIUS_ENROLL_SECRET"), "Enrollment secret, to enroll without a user token or join the group of the secret")
+	stateDir := fs.String("state-dir", envOrDefault("MOBIUS_AGENT_STATE_DIR", defaultStateDir()), "Directory of the agent state and device token")
+	caFile := fs.String("ca-file", os.Getenv("MOBIUS_CA_FILE"), "PEM file of the CAs trusted for the server certificate, instead of the system ones")
+	checkinInterval := fs.Duration("checkin-interval", envDurationOrDefault("MOBIUS_AGENT_CHECKIN_INTERVAL", agent.DefaultCheckinInterval), "Interval between check-ins")
+	commandInterval := fs.Duration("command-interval", envDurationOrDefault("MOBIUS_AGENT_COMMAND_INTERVAL", agent.DefaultCommandInterval), "Interval between fetches of queued commands")
+	syncInterval := fs.Duration("sync-interval", envDurationOrDefault("MOBIUS_AGENT_SYNC_INTERVAL", agent.DefaultSyncInterval), "Interval between syncs of policies and applications")
+	tokenRotation := fs.Duration("token-rotation", envDurationOrDefault("MOBIUS_AGENT_TOKEN_ROTATION", agent.DefaultTokenRotation), "Age at which the device token is rotated, 0 to never rotate it")
+	enforcePolicies := fs.Bool("enforce-policies", os.Getenv("MOBIUS_AGENT_ENFORCE_POLICIES") != "false", "Change device settings to comply with policies, instead of only checking them")
+	installApplications := fs.Bool("install-applications", os.Getenv("MOBIUS_AGENT_INSTALL_APPLICATIONS") != "false", "Install the applications listed for the device")
+	osqueryPath := fs.String("osquery-path", envOrDefault("MOBIUS_OSQUERY_PATH", "osqueryi"), "osqueryi binary running live queries")
+	once := fs.Bool("once", false, "Enroll, sync, check in and run queued commands once, then exit")
+	debug := fs.Bool("debug", os.Getenv("MOBIUS_AGENT_DEBUG") == "true", "Log debug messages")
+	fs.Parse(args) //nolint:errcheck
+
+	level := slog.LevelInfo
+	if *debug {
+		level = slog.LevelDebug
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+
+	if *serverURL == "" {
+		logger.Error("-server-url or MOBIUS_SERVER_URL is required")
+		os.Exit(2)
+	}
+	httpClient, err := newHTTPClient(*caFile)
+	if err != nil {
+		logger.Error("Failed to load CA file", "error", err)
+		os.Exit(1)
+	}
+
+	a, err := agent.New(agent.Config{
+		ServerURL:           *serverURL,
+		EnrollToken:         *enrollToken,
+		EnrollSecret:        *enrollSecret,
+		StateDir:            *stateDir,
+		CheckinInterval:     *checkinInterval,
+		CommandInterval:     *commandInterval,
+		SyncInterval:        *syncInterval,
+		TokenRotation:       *tokenRotation,
+		EnforcePolicies:     *enforcePolicies,
+		InstallApplications: *installApplications,
+		OsqueryPath:         *osqueryPath,
+		HTTPClient:          httpClient,
+		Logger:              logger,
+	}, agent.NewFileStore(*stateDir))
+	if err != nil {
+		logger.Error("Failed to create agent", "error", err)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	logger.Info("Starting Mobius agent", "version", agent.Version, "server_url", *serverURL, "platform", agent.Platform())
+	if *once {
+		err = a.RunOnce(ctx)
+	} else {
+		err = a.Run(ctx)
+	}
+	if err != nil && !errors.Is(err, context.Canceled) {
+		logger.Error("Agent stopped", "error", err)
+		os.Exit(1)
+	}
+}
+
+// newHTTPClient creates the HTTP client of the agent, trusting the CAs of
+// caFile if set
+func newHTTPClient(caFile string) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in %s", caFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+	return &http.Client{Transport: transport, Timeout: 60 * time.Second}, nil
+}
+
+func defaultStateDir() string {
+	switch runtime.GOOS {
+	case "windows":
+		return filepath.Join(envOrDefault("ProgramData", `C:\ProgramData`), "Mobius", "Agent")
+	case "darwin":
+		return "/Library/Application Support/Mobius/Agent"
+	default:
+		return "/var/lib/mobius-agent"
+	}
+}
+
+// envOrDefault returns the value of the environment variable key, or def if
+// unset
+func envOrDefault(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// envDurationOrDefault returns the duration in the environment variable
+// key, or def if unset or not a duration
+func envDurationOrDefault(key string, def time.Duration) time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(key)); err == nil {
+		return d
+	}
+	return def
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/notawar/mobius/mobius-client/pkg/simulator"
+)
+
+// runSimulate runs a fleet simulation scenario and prints its report. An
+// interrupt ends the run early, and still reports the requests made.
+func runSimulate(args []string) {
+	fs := flag.NewFlagSet("simulate", flag.ExitOnError)
+	scenarioPath := fs.String("scenario", "", "YAML scenario file to run")
+	serverURL := fs.String("server-url", "", "URL of the Mobius server, instead of the scenario's server_url")
+	devices := fs.Int("devices", 0, "Number of devices, instead of the scenario's")
+	duration := fs.Duration("duration", 0, "Duration of the run, instead of the scenario's")
+	reportPath := fs.String("report", "", "Also write the report as JSON to this file")
+	debug := fs.Bool("debug", false, "Log debug messages")
+	fs.Parse(args) //nolint:errcheck
+
+	level := slog.LevelInfo
+	if *debug {
+		level = slog.LevelDebug
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+
+	if *scenarioPath == "" {
+		logger.Error("-scenario is required")
+		os.Exit(2)
+	}
+	scenario, err := simulator.LoadScenario(*scenarioPath)
+	if err != nil {
+		logger.Error("Failed to load scenario", "error", err)
+		os.Exit(1)
+	}
+	if *serverURL != "" {
+		scenario.ServerURL = *serverURL
+	}
+	if *devices > 0 {
+		scenario.Devices = *devices
+	}
+	if *duration > 0 {
+		scenario.Duration = simulator.Duration(*duration)
+	}
+
+	sim, err := simulator.New(scenario, logger)
+	if err != nil {
+		logger.Error("Invalid scenario", "error", err)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	report := sim.Run(ctx)
+	if err := report.WriteText(os.Stdout); err != nil {
+		logger.Error("Failed to write report", "error", err)
+	}
+	if *reportPath != "" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err == nil {
+			err = os.WriteFile(*reportPath, data, 0o644)
+		}
+		if err != nil {
+			logger.Error("Failed to write report", "path", *reportPath, "error", err)
+			os.Exit(1)
+		}
+	}
+	logger.Info("Simulation finished", "duration", time.Duration(report.Duration).Round(time.Second))
+}
@@ -2,6 +2,12 @@ module github.com/notawar/mobius/mobius-client
 
 go 1.24.4
 
-require github.com/google/uuid v1.6.0
+require (
+	github.com/ghodss/yaml v1.0.0
+	github.com/google/uuid v1.6.0
+	github.com/notawar/mobius/shared v0.0.0
+)
+
+require gopkg.in/yaml.v2 v2.4.0 // indirect
 
 replace github.com/notawar/mobius/shared => ../shared
@@ -0,0 +1,258 @@
+// Package agent is the Mobius device agent. It enrolls the device, checks
+// in with its inventory and policy compliance, applies the policies and
+// applications assigned to it, and runs the commands and live queries
+// queued for it, all over the device API at /api/v1/device.
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"github.com/notawar/mobius/shared/pkg/apiclient"
+)
+
+// Version is the version of the agent, reported at check-in; set at build
+// time with -ldflags "-X github.com/notawar/mobius/mobius-client/pkg/agent.Version=..."
+var Version = "dev"
+
+// Default intervals of the agent
+const (
+	DefaultCheckinInterval = 5 * time.Minute
+	DefaultCommandInterval = 30 * time.Second
+	DefaultSyncInterval    = 15 * time.Minute
+	DefaultTokenRotation   = 30 * 24 * time.Hour
+)
+
+// maxRetryDelay bounds the delay between attempts to reach the server
+const maxRetryDelay = 5 * time.Minute
+
+// Config configures an Agent
+type Config struct {
+	ServerURL string
+	// EnrollToken is a user access token with the devices:write permission.
+	// When set, the device enrolls through POST /api/v1/devices, optionally
+	// with EnrollSecret to join the group the secret is scoped to.
+	EnrollToken string
+	// EnrollSecret enrolls the device through POST /api/v1/device/enroll
+	// when no EnrollToken is set
+	EnrollSecret string
+	// StateDir holds the state file with the device token
+	StateDir string
+
+	CheckinInterval time.Duration
+	CommandInterval time.Duration
+	// SyncInterval is how often policies and applications are fetched and
+	// applied
+	SyncInterval time.Duration
+	// TokenRotation is the age at which the device token is rotated; zero
+	// never rotates it
+	TokenRotation time.Duration
+
+	// EnforcePolicies changes the settings of the device to comply with its
+	// policies; otherwise they are only checked
+	EnforcePolicies bool
+	// InstallApplications installs the applications listed for the device
+	InstallApplications bool
+	// OsqueryPath is the osqueryi binary that runs live queries and
+	// run_osquery commands
+	OsqueryPath string
+
+	HTTPClient *http.Client
+	Logger     *slog.Logger
+}
+
+// Agent is a device agent
+type Agent struct {
+	cfg    Config
+	log    *slog.Logger
+	store  StateStore
+	client *apiclient.Client
+	state  *State
+	run    runner
+
+	// policyResults are the results of the last policy evaluation, reported
+	// at the next check-in
+	policyResults []apiclient.DeviceCheckinRequestQueryResultsPolicy
+}
+
+// New creates an agent keeping its state in store
+func New(cfg Config, store StateStore) (*Agent, error) {
+	if cfg.ServerURL == "" {
+		return nil, errors.New("server URL is required")
+	}
+	if cfg.CheckinInterval <= 0 {
+		cfg.CheckinInterval = DefaultCheckinInterval
+	}
+	if cfg.CommandInterval <= 0 {
+		cfg.CommandInterval = DefaultCommandInterval
+	}
+	if cfg.SyncInterval <= 0 {
+		cfg.SyncInterval = DefaultSyncInterval
+	}
+	if cfg.OsqueryPath == "" {
+		cfg.OsqueryPath = "osqueryi"
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: 60 * time.Second}
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = slog.Default()
+	}
+
+	client, err := apiclient.New(cfg.ServerURL,
+		apiclient.WithHTTPClient(cfg.HTTPClient),
+		apiclient.WithUserAgent("mobius-agent/"+Version))
+	if err != nil {
+		return nil, err
+	}
+	return &Agent{
+		cfg:    cfg,
+		log:    cfg.Logger,
+		store:  store,
+		client: client,
+		run:    execRunner,
+	}, nil
+}
+
+// Run enrolls the device unless it is enrolled, then checks in, syncs and
+// runs commands at their intervals until ctx is done
+func (a *Agent) Run(ctx context.Context) error {
+	if err := a.enrollWithRetry(ctx); err != nil {
+		return err
+	}
+	a.cycle(ctx)
+
+	checkin := time.NewTimer(jitter(a.cfg.CheckinInterval))
+	commands := time.NewTimer(jitter(a.cfg.CommandInterval))
+	sync := time.NewTimer(jitter(a.cfg.SyncInterval))
+	defer checkin.Stop()
+	defer commands.Stop()
+	defer sync.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-sync.C:
+			a.logError("Failed to sync", a.sync(ctx))
+			sync.Reset(jitter(a.cfg.SyncInterval))
+		case <-checkin.C:
+			a.logError("Failed to check in", a.checkin(ctx))
+			checkin.Reset(jitter(a.cfg.CheckinInterval))
+		case <-commands.C:
+			a.logError("Failed to process commands", a.processCommands(ctx))
+			commands.Reset(jitter(a.cfg.CommandInterval))
+		}
+	}
+}
+
+// RunOnce enrolls the device unless it is enrolled, then syncs, checks in
+// and runs the queued commands once
+func (a *Agent) RunOnce(ctx context.Context) error {
+	if err := a.enroll(ctx); err != nil {
+		return err
+	}
+	return errors.Join(a.sync(ctx), a.checkin(ctx), a.processCommands(ctx))
+}
+
+// cycle syncs, checks in and runs commands, in the order a new device
+// needs them
+func (a *Agent) cycle(ctx context.Context) {
+	a.logError("Failed to sync", a.sync(ctx))
+	a.logError("Failed to check in", a.checkin(ctx))
+	a.logError("Failed to process commands", a.processCommands(ctx))
+}
+
+// sync applies the policies and applications of the device
+func (a *Agent) sync(ctx context.Context) error {
+	err := a.authorized(ctx, a.syncPolicies)
+	if a.cfg.InstallApplications {
+		err = errors.Join(err, a.authorized(ctx, a.syncApplications))
+	}
+	return err
+}
+
+// checkin reports the inventory and policy results of the device, answers
+// the live queries handed out in return and rotates an old device token
+func (a *Agent) checkin(ctx context.Context) error {
+	var resp *apiclient.DeviceCheckinResponse
+	err := a.authorized(ctx, func(ctx context.Context) error {
+		inv := CollectInventory()
+		req := apiclient.DeviceCheckinRequest{
+			OSVersion:  apiclient.Ptr(inv.OSVersion),
+			SystemInfo: inv.SystemInfo,
+		}
+		if len(a.policyResults) > 0 {
+			req.QueryResults = &apiclient.DeviceCheckinRequestQueryResults{Policies: a.policyResults}
+		}
+		var err error
+		resp, err = a.client.DeviceCheckin(ctx, req)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	a.log.Debug("Checked in", "queries", len(resp.Queries))
+
+	for _, query := range resp.Queries {
+		a.logError("Failed to answer live query", a.answerLiveQuery(ctx, query))
+	}
+	return a.rotateToken(ctx)
+}
+
+// authorized calls fn, enrolling the device again when the server no
+// longer accepts its token, such as after it was revoked or lost during a
+// rotation
+func (a *Agent) authorized(ctx context.Context, fn func(context.Context) error) error {
+	err := fn(ctx)
+	if apiclient.StatusCode(err) != http.StatusUnauthorized {
+		return err
+	}
+	if !a.canEnroll() {
+		return fmt.Errorf("device token was rejected and no enrollment credential is configured: %w", err)
+	}
+
+	a.log.Warn("Device token was rejected; enrolling again")
+	if err := a.reenroll(ctx); err != nil {
+		return err
+	}
+	return fn(ctx)
+}
+
+func (a *Agent) logError(msg string, err error) {
+	if err != nil && !errors.Is(err, context.Canceled) {
+		a.log.Error(msg, "error", err)
+	}
+}
+
+// jitter spreads the requests of a fleet by adding up to a tenth to d
+func jitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return d
+	}
+	return d + rand.N(d/10+1)
+}
+
+// sleep waits for d or until ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// retryable reports whether a failed request may succeed later: network
+// errors, rate limits and server errors
+func retryable(err error) bool {
+	status := apiclient.StatusCode(err)
+	return status == 0 || status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+}
@@ -0,0 +1,296 @@
+package agent
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/notawar/mobius/shared/pkg/apiclient"
+)
+
+// downloadTimeout bounds the download of a package
+const downloadTimeout = 30 * time.Minute
+
+// packageManagerPrograms are the programs the commands of imported
+// applications may run, by package manager
+var packageManagerPrograms = map[string]string{
+	"apt":     "apt-get",
+	"flatpak": "flatpak",
+	"brew":    "brew",
+	"winget":  "winget",
+}
+
+// syncApplications installs the applications listed for the device that
+// the agent has not installed yet, or whose package changed since; for
+// imported applications, whose version changed since. Applications of the
+// self-service catalog are only installed by an install_app command, and
+// then kept up to date.
+func (a *Agent) syncApplications(ctx context.Context) error {
+	resp, err := a.client.DeviceListApplications(ctx)
+	if err != nil {
+		return fmt.Errorf("list applications: %w", err)
+	}
+
+	var errs []error
+	for _, app := range resp.Applications {
+		installed, ok := a.state.Applications[app.ID]
+		if ok && installed.Checksum == app.Checksum && (app.Source == nil || installed.Version == app.Version) {
+			continue
+		}
+		if !ok && app.SelfService {
+			continue
+		}
+		if !packageSupported(app.PackageType) {
+			a.log.Debug("Skipping application with an unsupported package", "app_id", app.ID, "package_type", app.PackageType)
+			continue
+		}
+		if err := a.installApplication(ctx, app); err != nil {
+			errs = append(errs, fmt.Errorf("install %s: %w", app.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// findApplication returns an application listed for the device
+func (a *Agent) findApplication(ctx context.Context, appID string) (*apiclient.DeviceApplication, error) {
+	resp, err := a.client.DeviceListApplications(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list applications: %w", err)
+	}
+	for _, app := range resp.Applications {
+		if app.ID == appID {
+			return &app, nil
+		}
+	}
+	return nil, fmt.Errorf("application %s is not available to this device", appID)
+}
+
+// installApplication downloads a package, verifies its checksum and
+// installs it. Imported applications are installed by their package
+// manager instead.
+func (a *Agent) installApplication(ctx context.Context, app apiclient.DeviceApplication) error {
+	if !packageSupported(app.PackageType) {
+		return fmt.Errorf("%q packages are %w", app.PackageType, errUnsupported)
+	}
+
+	if app.Source != nil {
+		if err := runPackageManager(ctx, a.run, app.Source.Manager, app.InstallCommand); err != nil {
+			return err
+		}
+	} else {
+		path, err := a.download(ctx, app)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(path) //nolint:errcheck
+
+		if err := installPackage(ctx, a.run, app.Application, path); err != nil {
+			return err
+		}
+	}
+
+	if a.state.Applications == nil {
+		a.state.Applications = make(map[string]InstalledApplication)
+	}
+	a.state.Applications[app.ID] = InstalledApplication{
+		Name:        app.Name,
+		Version:     app.Version,
+		Checksum:    app.Checksum,
+		PackageType: app.PackageType,
+		BundleID:    app.BundleID,
+		InstalledAt: time.Now().UTC(),
+
+		UninstallCommand: app.UninstallCommand,
+	}
+	if err := a.store.Save(a.state); err != nil {
+		return fmt.Errorf("save state: %w", err)
+	}
+
+	a.log.Info("Installed application", "app_id", app.ID, "name", app.Name, "version", app.Version)
+	return nil
+}
+
+// uninstallApplication removes an application installed by the agent, or
+// listed for the device
+func (a *Agent) uninstallApplication(ctx context.Context, appID string) error {
+	installed, ok := a.state.Applications[appID]
+	if !ok {
+		app, err := a.findApplication(ctx, appID)
+		if err != nil {
+			return err
+		}
+		installed = InstalledApplication{Name: app.Name, PackageType: app.PackageType, BundleID: app.BundleID,
+			UninstallCommand: app.UninstallCommand}
+	}
+
+	var err error
+	if installed.UninstallCommand != "" {
+		err = runPackageManager(ctx, a.run, installed.PackageType, installed.UninstallCommand)
+	} else {
+		err = uninstallPackage(ctx, a.run, appID, installed)
+	}
+	if err != nil {
+		return err
+	}
+	delete(a.state.Applications, appID)
+	if err := a.store.Save(a.state); err != nil {
+		return fmt.Errorf("save state: %w", err)
+	}
+
+	a.log.Info("Uninstalled application", "app_id", appID, "name", installed.Name)
+	return nil
+}
+
+// runPackageManager runs a command of an imported application. The command
+// is split into arguments rather than run by a shell, and may only run the
+// program of the package manager of the application.
+func runPackageManager(ctx context.Context, run runner, manager, command string) error {
+	args := strings.Fields(command)
+	program, ok := packageManagerPrograms[manager]
+	if !ok || len(args) == 0 || args[0] != program {
+		return fmt.Errorf("command %q does not run the %s package manager", command, manager)
+	}
+	if !hasProgram(program) {
+		return fmt.Errorf("%s is %w", program, errUnsupported)
+	}
+	if manager == "apt" {
+		args = append([]string{"env", "DEBIAN_FRONTEND=noninteractive"}, args...)
+	}
+	_, err := run(ctx, args[0], args[1:]...)
+	return err
+}
+
+// download fetches a package through its signed URL into the state
+// directory, and checks it against the checksum of the application
+func (a *Agent) download(ctx context.Context, app apiclient.DeviceApplication) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, downloadTimeout)
+	defer cancel()
+
+	dir := filepath.Join(a.cfg.StateDir, "downloads")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", fmt.Errorf("create download directory: %w", err)
+	}
+	f, err := os.CreateTemp(dir, "package-*")
+	if err != nil {
+		return "", err
+	}
+	path := f.Name()
+
+	err = a.fetch(ctx, app, f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path) //nolint:errcheck
+		return "", err
+	}
+	return path, nil
+}
+
+func (a *Agent) fetch(ctx context.Context, app apiclient.DeviceApplication, w io.Writer) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, app.DownloadURL, nil)
+	if err != nil {
+		return fmt.Errorf("download package: %w", err)
+	}
+	// The client timeout would cut large packages short; ctx bounds the
+	// download instead
+	client := *a.cfg.HTTPClient
+	client.Timeout = 0
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("download package: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("download package: %s", resp.Status)
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(w, h), resp.Body); err != nil {
+		return fmt.Errorf("download package: %w", err)
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(sum, app.Checksum) {
+		return fmt.Errorf("package checksum %s does not match %s", sum, app.Checksum)
+	}
+	return nil
+}
+
+// extractTarGz extracts a gzipped tarball into dir, replacing it, and
+// rejects entries that would land outside of it
+func extractTarGz(path, dir string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	staging := dir + ".new"
+	if err := os.RemoveAll(staging); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(staging, 0o755); err != nil {
+		return err
+	}
+	defer os.RemoveAll(staging) //nolint:errcheck
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		name := filepath.Clean(hdr.Name)
+		if !filepath.IsLocal(name) {
+			return fmt.Errorf("archive entry %q leaves the install directory", hdr.Name)
+		}
+		target := filepath.Join(staging, name)
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+				return err
+			}
+			out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, hdr.FileInfo().Mode().Perm()&0o755)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(out, tr)
+			if closeErr := out.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				return err
+			}
+		default:
+			// Links could point outside of the install directory
+			return fmt.Errorf("archive entry %q is not a file or directory", hdr.Name)
+		}
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	return os.Rename(staging, dir)
+}
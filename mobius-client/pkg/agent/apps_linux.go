@@ -0,0 +1,89 @@
+//go:build linux
+
+package agent
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/notawar/mobius/shared/pkg/apiclient"
+)
+
+// appsDir holds the applications installed from tarballs, one directory
+// per application
+var appsDir = "/opt/mobius/apps"
+
+// packageSupported reports whether packages of a type, or applications
+// imported for a package manager, can be installed
+func packageSupported(packageType string) bool {
+	switch packageType {
+	case "deb", "rpm", "tar.gz":
+		return true
+	case "apt":
+		return hasProgram("apt-get")
+	case "flatpak":
+		return hasProgram("flatpak")
+	}
+	return false
+}
+
+// installPackage installs a package with the package manager of the
+// distribution, which also installs its dependencies
+func installPackage(ctx context.Context, run runner, app apiclient.Application, path string) error {
+	var err error
+	switch app.PackageType {
+	case "deb":
+		if hasProgram("apt-get") {
+			_, err = run(ctx, "env", "DEBIAN_FRONTEND=noninteractive", "apt-get", "install", "-y", "--allow-downgrades", path)
+		} else {
+			_, err = run(ctx, "dpkg", "-i", path)
+		}
+	case "rpm":
+		switch {
+		case hasProgram("dnf"):
+			_, err = run(ctx, "dnf", "install", "-y", path)
+		case hasProgram("yum"):
+			_, err = run(ctx, "yum", "install", "-y", path)
+		default:
+			_, err = run(ctx, "rpm", "-U", "--replacepkgs", path)
+		}
+	case "tar.gz":
+		err = extractTarGz(path, filepath.Join(appsDir, app.ID))
+	default:
+		return fmt.Errorf("%q packages are %w", app.PackageType, errUnsupported)
+	}
+	return err
+}
+
+func uninstallPackage(ctx context.Context, run runner, appID string, app InstalledApplication) error {
+	if app.PackageType == "tar.gz" {
+		return os.RemoveAll(filepath.Join(appsDir, appID))
+	}
+	if app.BundleID == "" {
+		return fmt.Errorf("the package name of %s is unknown", app.Name)
+	}
+
+	var err error
+	switch app.PackageType {
+	case "deb":
+		if hasProgram("apt-get") {
+			_, err = run(ctx, "env", "DEBIAN_FRONTEND=noninteractive", "apt-get", "remove", "-y", app.BundleID)
+		} else {
+			_, err = run(ctx, "dpkg", "-r", app.BundleID)
+		}
+	case "rpm":
+		switch {
+		case hasProgram("dnf"):
+			_, err = run(ctx, "dnf", "remove", "-y", app.BundleID)
+		case hasProgram("yum"):
+			_, err = run(ctx, "yum", "remove", "-y", app.BundleID)
+		default:
+			_, err = run(ctx, "rpm", "-e", app.BundleID)
+		}
+	default:
+		return fmt.Errorf("%q packages are %w", app.PackageType, errUnsupported)
+	}
+	return err
+}
@@ -0,0 +1,21 @@
+//go:build !linux
+
+package agent
+
+import (
+	"context"
+
+	"github.com/notawar/mobius/shared/pkg/apiclient"
+)
+
+func packageSupported(packageType string) bool {
+	return false
+}
+
+func installPackage(ctx context.Context, run runner, app apiclient.Application, path string) error {
+	return errUnsupported
+}
+
+func uninstallPackage(ctx context.Context, run runner, appID string, app InstalledApplication) error {
+	return errUnsupported
+}
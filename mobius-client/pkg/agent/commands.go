@@ -0,0 +1,125 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/notawar/mobius/shared/pkg/apiclient"
+)
+
+// reportAttempts is how often a result is sent before it is given up
+const reportAttempts = 3
+
+// processCommands runs the commands queued for the device and reports
+// their results. A command is acknowledged before it runs, so that the
+// server does not hand it out again while it runs.
+func (a *Agent) processCommands(ctx context.Context) error {
+	var resp *apiclient.DeviceFetchCommandsResponse
+	err := a.authorized(ctx, func(ctx context.Context) error {
+		var err error
+		resp, err = a.client.DeviceFetchCommands(ctx)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("fetch commands: %w", err)
+	}
+
+	var errs []error
+	for _, cmd := range resp.Commands {
+		if _, err := a.client.DeviceAcknowledgeCommand(ctx, cmd.ID); err != nil {
+			// The command expired, or another request acknowledged it
+			a.log.Warn("Failed to acknowledge command", "command_id", cmd.ID, "error", err)
+			continue
+		}
+
+		a.log.Info("Running command", "command_id", cmd.ID, "command", cmd.Command)
+		result, err := a.executeCommand(ctx, cmd)
+		report := apiclient.DeviceReportCommandResultRequest{Status: "completed", Result: result}
+		if err != nil {
+			a.log.Warn("Command failed", "command_id", cmd.ID, "command", cmd.Command, "error", err)
+			report.Status = "failed"
+			report.Error = apiclient.Ptr(err.Error())
+		}
+		if err := a.reportCommandResult(ctx, cmd.ID, report); err != nil {
+			errs = append(errs, fmt.Errorf("report result of command %s: %w", cmd.ID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// executeCommand runs a command. Commands that depend on the platform are
+// run by platformCommand.
+func (a *Agent) executeCommand(ctx context.Context, cmd apiclient.DeviceCommand) (map[string]interface{}, error) {
+	switch cmd.Command {
+	case "run_osquery":
+		query, _ := cmd.Parameters["query"].(string)
+		if query == "" {
+			return nil, errors.New("parameter query is required")
+		}
+		rows, duration, err := a.osquery(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"rows": rows, "duration_ms": duration.Milliseconds()}, nil
+
+	case "install_app":
+		appID, err := applicationParameter(cmd.Parameters)
+		if err != nil {
+			return nil, err
+		}
+		app, err := a.findApplication(ctx, appID)
+		if err != nil {
+			return nil, err
+		}
+		if err := a.installApplication(ctx, *app); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"message": "Installed " + app.Name + " " + app.Version}, nil
+
+	case "uninstall_app":
+		appID, err := applicationParameter(cmd.Parameters)
+		if err != nil {
+			return nil, err
+		}
+		if err := a.uninstallApplication(ctx, appID); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"message": "Uninstalled application " + appID}, nil
+
+	case "wipe":
+		// Erasing a disk from the running system cannot be done safely
+		return nil, fmt.Errorf("wipe is %w", errUnsupported)
+	}
+	return platformCommand(ctx, a.run, cmd.Command, cmd.Parameters)
+}
+
+func applicationParameter(params map[string]interface{}) (string, error) {
+	appID, _ := params["application_id"].(string)
+	if appID == "" {
+		return "", errors.New("parameter application_id is required")
+	}
+	return appID, nil
+}
+
+// reportCommandResult sends the result of a command, retrying while the
+// server cannot be reached. Retries carry the same Idempotency-Key, so a
+// result the server recorded before its response was lost is not
+// recorded twice.
+func (a *Agent) reportCommandResult(ctx context.Context, commandID string, report apiclient.DeviceReportCommandResultRequest) error {
+	ctx = apiclient.WithIdempotencyKey(ctx, "command-result-"+commandID)
+
+	var err error
+	for attempt := 1; attempt <= reportAttempts; attempt++ {
+		if _, err = a.client.DeviceReportCommandResult(ctx, commandID, report); err == nil || !retryable(err) {
+			return err
+		}
+		if attempt < reportAttempts {
+			if err := sleep(ctx, jitter(time.Duration(attempt)*time.Second)); err != nil {
+				return err
+			}
+		}
+	}
+	return err
+}
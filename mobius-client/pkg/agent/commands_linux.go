@@ -0,0 +1,72 @@
+//go:build linux
+
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// Bounds of the lines collect_logs returns from the journal
+const (
+	defaultLogLines = 1000
+	maxLogLines     = 10000
+)
+
+// powerMessage is broadcast to logged in users before a restart or
+// shutdown
+const powerMessage = "Requested by your administrator through Mobius"
+
+// platformCommand runs the commands that depend on the platform. Restarts
+// and shutdowns are scheduled a minute ahead, so that the result is
+// reported first.
+func platformCommand(ctx context.Context, run runner, command string, params map[string]interface{}) (map[string]interface{}, error) {
+	switch command {
+	case "restart":
+		if _, err := run(ctx, "shutdown", "-r", "+1", powerMessage); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"message": "Restart scheduled in 1 minute"}, nil
+
+	case "shutdown":
+		if _, err := run(ctx, "shutdown", "-h", "+1", powerMessage); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"message": "Shutdown scheduled in 1 minute"}, nil
+
+	case "lock":
+		if _, err := run(ctx, "loginctl", "lock-sessions"); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"message": "Sessions locked"}, nil
+
+	case "collect_logs":
+		return collectLogs(ctx, run, params)
+	}
+	return nil, fmt.Errorf("unknown command %q", command)
+}
+
+// collectLogs returns the last lines of the journal, of one unit if the
+// unit parameter is set
+func collectLogs(ctx context.Context, run runner, params map[string]interface{}) (map[string]interface{}, error) {
+	lines := defaultLogLines
+	if value, ok := params["lines"]; ok {
+		n, err := intValue(value)
+		if err != nil || n <= 0 {
+			return nil, errors.New("parameter lines must be a positive integer")
+		}
+		lines = min(n, maxLogLines)
+	}
+
+	args := []string{"--no-pager", "--output", "short-iso", "--lines", strconv.Itoa(lines)}
+	if unit, _ := params["unit"].(string); unit != "" {
+		args = append(args, "--unit", unit)
+	}
+	out, err := run(ctx, "journalctl", args...)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"logs": string(out), "lines": lines}, nil
+}
@@ -0,0 +1,59 @@
+//go:build linux
+
+package agent
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/notawar/mobius/shared/pkg/apiclient"
+)
+
+func TestPlatformCommands(t *testing.T) {
+	runner := &fakeRunner{output: []byte("journal lines")}
+	a := newTestAgent(t, http.NotFoundHandler(), runner)
+
+	for _, tc := range []struct {
+		command string
+		params  map[string]interface{}
+		run     []string
+		err     string
+	}{
+		{command: "restart", run: []string{"shutdown", "-r", "+1", powerMessage}},
+		{command: "shutdown", run: []string{"shutdown", "-h", "+1", powerMessage}},
+		{command: "lock", run: []string{"loginctl", "lock-sessions"}},
+		{
+			command: "collect_logs",
+			run:     []string{"journalctl", "--no-pager", "--output", "short-iso", "--lines", "1000"},
+		},
+		{
+			command: "collect_logs",
+			params:  map[string]interface{}{"lines": float64(50000), "unit": "sshd"},
+			run:     []string{"journalctl", "--no-pager", "--output", "short-iso", "--lines", "10000", "--unit", "sshd"},
+		},
+		{command: "collect_logs", params: map[string]interface{}{"lines": float64(-1)}, err: "positive integer"},
+		{command: "reboot_now", err: "unknown command"},
+	} {
+		runner.calls = nil
+		_, err := a.executeCommand(context.Background(), apiclient.DeviceCommand{ID: "command-1", Command: tc.command, Parameters: tc.params})
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%s: expected an error containing %q, got %v", tc.command, tc.err, err)
+			}
+			if len(runner.calls) > 0 {
+				t.Errorf("%s: expected nothing to run, got %v", tc.command, runner.calls)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.command, err)
+			continue
+		}
+		if want := [][]string{tc.run}; !reflect.DeepEqual(runner.calls, want) {
+			t.Errorf("%s: expected %v run, got %v", tc.command, want, runner.calls)
+		}
+	}
+}
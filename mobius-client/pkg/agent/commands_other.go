@@ -0,0 +1,12 @@
+//go:build !linux
+
+package agent
+
+import (
+	"context"
+	"fmt"
+)
+
+func platformCommand(ctx context.Context, run runner, command string, params map[string]interface{}) (map[string]interface{}, error) {
+	return nil, fmt.Errorf("%s is %w", command, errUnsupported)
+}
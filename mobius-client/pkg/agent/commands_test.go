@@ -0,0 +1,251 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/notawar/mobius/shared/pkg/apiclient"
+)
+
+// memoryStore is a StateStore holding the state in memory
+type memoryStore struct {
+	state *State
+}
+
+func (s *memoryStore) Load() (*State, error) {
+	if s.state == nil {
+		return nil, ErrNotEnrolled
+	}
+	state := *s.state
+	return &state, nil
+}
+
+func (s *memoryStore) Save(state *State) error {
+	saved := *state
+	s.state = &saved
+	return nil
+}
+
+// fakeRunner records the programs an agent runs and answers with output
+type fakeRunner struct {
+	mu     sync.Mutex
+	calls  [][]string
+	output []byte
+	err    error
+}
+
+func (r *fakeRunner) run(ctx context.Context, name string, args ...string) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, append([]string{name}, args...))
+	return r.output, r.err
+}
+
+// newTestAgent creates an agent enrolled with the server of handler, running
+// programs with runner
+func newTestAgent(t *testing.T, handler http.Handler, runner *fakeRunner) *Agent {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	store := &memoryStore{state: &State{ServerURL: server.URL, DeviceID: "device-1", DeviceToken: "device-token"}}
+	a, err := New(Config{
+		ServerURL: server.URL,
+		Logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}, store)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	a.run = runner.run
+	if err := a.enroll(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return a
+}
+
+func TestExecuteCommand(t *testing.T) {
+	// Any program on the PATH stands in for osqueryi
+	executable, err := os.Executable()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	runner := &fakeRunner{output: []byte(`[{"name": "sshd", "pid": 42}]`)}
+	a := newTestAgent(t, http.NotFoundHandler(), runner)
+	a.cfg.OsqueryPath = executable
+
+	result, err := a.executeCommand(context.Background(), apiclient.DeviceCommand{
+		ID:         "command-1",
+		Command:    "run_osquery",
+		Parameters: map[string]interface{}{"query": "SELECT name, pid FROM processes"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []map[string]string{{"name": "sshd", "pid": "42"}}; !reflect.DeepEqual(result["rows"], want) {
+		t.Errorf("expected rows %v, got %v", want, result["rows"])
+	}
+	if want := [][]string{{executable, "--json", "SELECT name, pid FROM processes"}}; !reflect.DeepEqual(runner.calls, want) {
+		t.Errorf("expected %v run, got %v", want, runner.calls)
+	}
+
+	for _, tc := range []struct {
+		command string
+		params  map[string]interface{}
+		err     string
+	}{
+		{"run_osquery", nil, "parameter query is required"},
+		{"install_app", nil, "parameter application_id is required"},
+		{"uninstall_app", map[string]interface{}{"application_id": ""}, "parameter application_id is required"},
+		{"wipe", nil, "wipe is"},
+	} {
+		runner.calls = nil
+		_, err := a.executeCommand(context.Background(), apiclient.DeviceCommand{ID: "command-1", Command: tc.command, Parameters: tc.params})
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%s: expected an error containing %q, got %v", tc.command, tc.err, err)
+		}
+		if len(runner.calls) > 0 {
+			t.Errorf("%s: expected nothing to run, got %v", tc.command, runner.calls)
+		}
+	}
+	if _, err := a.executeCommand(context.Background(), apiclient.DeviceCommand{Command: "wipe"}); !errors.Is(err, errUnsupported) {
+		t.Errorf("expected wipe to be unsupported, got %v", err)
+	}
+}
+
+// commandServer serves the command queue of the device API, failing the
+// first reports of each result with failures
+type commandServer struct {
+	mu       sync.Mutex
+	commands []apiclient.DeviceCommand
+	failures int
+	acked    []string
+	// reports are the results received, with their idempotency keys
+	reports []commandReport
+}
+
+type commandReport struct {
+	commandID string
+	key       string
+	request   apiclient.DeviceReportCommandResultRequest
+}
+
+func (s *commandServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.Header.Get("Authorization") != "Bearer device-token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/api/v1/device/commands")
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case r.Method == "GET" && path == "":
+		json.NewEncoder(w).Encode(apiclient.DeviceFetchCommandsResponse{Commands: s.commands}) //nolint:errcheck
+	case r.Method == "POST" && strings.HasSuffix(path, "/ack"):
+		s.acked = append(s.acked, strings.TrimSuffix(strings.TrimPrefix(path, "/"), "/ack"))
+		w.Write([]byte(`{}`)) //nolint:errcheck
+	case r.Method == "POST" && strings.HasSuffix(path, "/result"):
+		report := commandReport{
+			commandID: strings.TrimSuffix(strings.TrimPrefix(path, "/"), "/result"),
+			key:       r.Header.Get("Idempotency-Key"),
+		}
+		if err := json.NewDecoder(r.Body).Decode(&report.request); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.reports = append(s.reports, report)
+		if s.failures > 0 {
+			s.failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{}`)) //nolint:errcheck
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestProcessCommands(t *testing.T) {
+	server := &commandServer{commands: []apiclient.DeviceCommand{
+		{ID: "command-1", Command: "install_app"},
+		{ID: "command-2", Command: "wipe"},
+	}}
+	a := newTestAgent(t, server, &fakeRunner{})
+
+	if err := a.processCommands(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"command-1", "command-2"}; !reflect.DeepEqual(server.acked, want) {
+		t.Errorf("expected %v acknowledged, got %v", want, server.acked)
+	}
+	if len(server.reports) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(server.reports))
+	}
+	for _, report := range server.reports {
+		if report.request.Status != "failed" || report.request.Error == nil {
+			t.Errorf("%s: expected a failure, got %+v", report.commandID, report.request)
+		}
+	}
+}
+
+func TestReportCommandResult(t *testing.T) {
+	report := apiclient.DeviceReportCommandResultRequest{
+		Status: "completed",
+		Result: map[string]interface{}{"message": "Sessions locked"},
+	}
+
+	t.Run("retries with the same key", func(t *testing.T) {
+		server := &commandServer{failures: 1}
+		a := newTestAgent(t, server, &fakeRunner{})
+
+		if err := a.reportCommandResult(context.Background(), "command-1", report); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(server.reports) != 2 {
+			t.Fatalf("expected 2 attempts, got %d", len(server.reports))
+		}
+		for _, got := range server.reports {
+			if got.key != "command-result-command-1" {
+				t.Errorf("expected the key of command-1, got %q", got.key)
+			}
+			if !reflect.DeepEqual(got.request, report) {
+				t.Errorf("expected %+v, got %+v", report, got.request)
+			}
+		}
+	})
+
+	t.Run("gives up once cancelled", func(t *testing.T) {
+		server := &commandServer{failures: reportAttempts}
+		a := newTestAgent(t, server, &fakeRunner{})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if err := a.reportCommandResult(ctx, "command-1", report); err == nil {
+			t.Error("expected an error")
+		}
+	})
+
+	t.Run("does not retry refused results", func(t *testing.T) {
+		a := newTestAgent(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusConflict)
+		}), &fakeRunner{})
+
+		err := a.reportCommandResult(context.Background(), "command-1", report)
+		if apiclient.StatusCode(err) != http.StatusConflict {
+			t.Errorf("expected status 409, got %v", err)
+		}
+	})
+}
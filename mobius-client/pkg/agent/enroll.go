@@ -0,0 +1,154 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/notawar/mobius/shared/pkg/apiclient"
+)
+
+func (a *Agent) canEnroll() bool {
+	return a.cfg.EnrollToken != "" || a.cfg.EnrollSecret != ""
+}
+
+// enrollWithRetry enrolls the device, retrying while the server cannot be
+// reached, such as when the agent starts before the network at boot
+func (a *Agent) enrollWithRetry(ctx context.Context) error {
+	delay := time.Second
+	for {
+		err := a.enroll(ctx)
+		if err == nil || !retryable(err) || ctx.Err() != nil {
+			return err
+		}
+		a.log.Warn("Failed to enroll; retrying", "error", err, "delay", delay)
+		if err := sleep(ctx, delay); err != nil {
+			return err
+		}
+		delay = min(delay*2, maxRetryDelay)
+	}
+}
+
+// enroll loads the stored enrollment, or enrolls the device when there is
+// none or it belongs to another server
+func (a *Agent) enroll(ctx context.Context) error {
+	if a.state != nil {
+		return nil
+	}
+
+	state, err := a.store.Load()
+	switch {
+	case errors.Is(err, ErrNotEnrolled):
+	case err != nil:
+		return fmt.Errorf("load state: %w", err)
+	case state.ServerURL != a.cfg.ServerURL:
+		a.log.Warn("Enrolled with another server; enrolling again", "enrolled_server", state.ServerURL)
+		state.DeviceToken = ""
+	default:
+		a.state = state
+		a.client.SetToken(state.DeviceToken)
+		a.log.Info("Loaded enrollment", "device_id", state.DeviceID)
+		return nil
+	}
+
+	if state == nil {
+		state = &State{}
+	}
+	return a.enrollDevice(ctx, state)
+}
+
+// reenroll enrolls the device again under the same UUID, keeping the
+// record of the applications it installed
+func (a *Agent) reenroll(ctx context.Context) error {
+	state := a.state
+	if state == nil {
+		state = &State{}
+	}
+	return a.enrollDevice(ctx, state)
+}
+
+// enrollDevice enrolls the device and stores its token. Enrolling through
+// POST /api/v1/devices takes a user token with devices:write, which is how
+// an administrator or a provisioning system enrolls a device it set up.
+// Fleets installed without an operator enroll with an enrollment secret
+// instead, which can only enroll devices and expires.
+func (a *Agent) enrollDevice(ctx context.Context, state *State) error {
+	if !a.canEnroll() {
+		return errors.New("device is not enrolled: set an enrollment token or secret")
+	}
+
+	inv := CollectInventory()
+	if state.UUID == "" {
+		state.UUID = deviceUUID(inv)
+	}
+	enrollment := apiclient.DeviceEnrollment{
+		UUID:      state.UUID,
+		Hostname:  inv.Hostname,
+		Platform:  inv.Platform,
+		OSVersion: apiclient.Ptr(inv.OSVersion),
+	}
+	if a.cfg.EnrollSecret != "" {
+		enrollment.EnrollmentSecret = apiclient.Ptr(a.cfg.EnrollSecret)
+	}
+
+	var device apiclient.Device
+	var token string
+	if a.cfg.EnrollToken != "" {
+		a.client.SetToken(a.cfg.EnrollToken)
+		resp, err := a.client.EnrollDevice(ctx, enrollment)
+		a.client.SetToken("")
+		if err != nil {
+			return fmt.Errorf("enroll device: %w", err)
+		}
+		device, token = resp.Device, resp.DeviceToken
+	} else {
+		a.client.SetToken("")
+		resp, err := a.client.DeviceEnroll(ctx, enrollment)
+		if err != nil {
+			return fmt.Errorf("enroll device: %w", err)
+		}
+		device, token = resp.Device, resp.DeviceToken
+	}
+	if token == "" {
+		return errors.New("enroll device: server returned no device token")
+	}
+
+	now := time.Now().UTC()
+	state.ServerURL = a.cfg.ServerURL
+	state.DeviceID = device.ID
+	state.DeviceToken = token
+	state.EnrolledAt = now
+	state.TokenIssuedAt = now
+	if err := a.store.Save(state); err != nil {
+		return fmt.Errorf("save device token: %w", err)
+	}
+	a.state = state
+	a.client.SetToken(token)
+
+	a.log.Info("Enrolled device", "device_id", device.ID, "uuid", state.UUID)
+	return nil
+}
+
+// rotateToken replaces a device token older than the rotation age. The
+// old token stops working as soon as the server issues the new one; if the
+// response is lost, the next request enrolls the device again.
+func (a *Agent) rotateToken(ctx context.Context) error {
+	if a.cfg.TokenRotation <= 0 || time.Since(a.state.TokenIssuedAt) < a.cfg.TokenRotation {
+		return nil
+	}
+
+	resp, err := a.client.DeviceRotateToken(ctx)
+	if err != nil {
+		return fmt.Errorf("rotate device token: %w", err)
+	}
+	a.state.DeviceToken = resp.DeviceToken
+	a.state.TokenIssuedAt = time.Now().UTC()
+	a.client.SetToken(resp.DeviceToken)
+	if err := a.store.Save(a.state); err != nil {
+		return fmt.Errorf("save device token: %w", err)
+	}
+
+	a.log.Info("Rotated device token")
+	return nil
+}
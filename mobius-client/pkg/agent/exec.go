@@ -0,0 +1,71 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// commandTimeout bounds how long a program run by the agent may take
+const commandTimeout = 10 * time.Minute
+
+// maxOutput is the most of the output of a program the agent keeps
+const maxOutput = 256 << 10
+
+// errUnsupported is returned for what the agent cannot do on this platform
+var errUnsupported = errors.New("not supported on " + Platform())
+
+// runner runs a program and returns its output. The error of a failed
+// program carries the last line it wrote to stderr.
+type runner func(ctx context.Context, name string, args ...string) ([]byte, error)
+
+// execRunner runs programs to completion even when ctx is cancelled, so
+// that stopping the agent does not interrupt a package manager halfway
+func execRunner(ctx context.Context, name string, args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), commandTimeout)
+	defer cancel()
+
+	var stdout, stderr limitedBuffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			err = fmt.Errorf("%s: %w: %s", name, err, lastLine(msg))
+		} else {
+			err = fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return stdout.Bytes(), err
+}
+
+// hasProgram reports whether a program is on the PATH
+func hasProgram(name string) bool {
+	_, err := exec.LookPath(name)
+	return err == nil
+}
+
+// limitedBuffer keeps the first maxOutput bytes written to it
+type limitedBuffer struct {
+	bytes.Buffer
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := maxOutput - b.Len(); len(p) > room {
+		b.Buffer.Write(p[:max(room, 0)])
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
+
+func lastLine(s string) string {
+	if i := strings.LastIndexByte(s, '\n'); i >= 0 {
+		return s[i+1:]
+	}
+	return s
+}
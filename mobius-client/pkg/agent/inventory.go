@@ -0,0 +1,84 @@
+package agent
+
+import (
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Inventory describes the device at a check-in
+type Inventory struct {
+	Hostname  string
+	Platform  string
+	OSVersion string
+	// HardwareUUID identifies the machine across reinstalls of the agent,
+	// empty if the platform does not expose one
+	HardwareUUID string
+	// SystemInfo is reported as the system_info of the device, where device
+	// group filters can match it
+	SystemInfo map[string]string
+}
+
+// Platform returns the platform of the device as the API names it
+func Platform() string {
+	switch runtime.GOOS {
+	case "darwin":
+		return "macos"
+	default:
+		return runtime.GOOS
+	}
+}
+
+// CollectInventory gathers the OS and hardware inventory of the device.
+// Facts that cannot be read, such as those only root may read, are left
+// out.
+func CollectInventory() Inventory {
+	inv := Inventory{
+		Platform: Platform(),
+		SystemInfo: map[string]string{
+			"arch":          runtime.GOARCH,
+			"cpu_logical":   strconv.Itoa(runtime.NumCPU()),
+			"agent_version": Version,
+		},
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		inv.Hostname = hostname
+	}
+	collectPlatformInventory(&inv)
+
+	if inv.OSVersion != "" {
+		inv.SystemInfo["os_version"] = inv.OSVersion
+	}
+	if inv.HardwareUUID != "" {
+		inv.SystemInfo["hardware_uuid"] = inv.HardwareUUID
+	}
+	return inv
+}
+
+// deviceUUID returns the UUID the device enrolls with: the hardware UUID,
+// or a random one when the platform does not expose any
+func deviceUUID(inv Inventory) string {
+	if inv.HardwareUUID != "" {
+		return inv.HardwareUUID
+	}
+	return uuid.New().String()
+}
+
+func setIfPresent(info map[string]string, key, value string) {
+	if value != "" {
+		info[key] = value
+	}
+}
+
+// readTrimmed returns the content of a small file without surrounding
+// whitespace, or "" when it cannot be read
+func readTrimmed(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
@@ -0,0 +1,121 @@
+//go:build linux
+
+package agent
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func collectPlatformInventory(inv *Inventory) {
+	info := inv.SystemInfo
+
+	release := readKeyValueFile("/etc/os-release")
+	inv.OSVersion = release["PRETTY_NAME"]
+	if inv.OSVersion == "" {
+		inv.OSVersion = strings.TrimSpace(release["NAME"] + " " + release["VERSION_ID"])
+	}
+	setIfPresent(info, "os_name", release["NAME"])
+	setIfPresent(info, "os_id", release["ID"])
+	setIfPresent(info, "os_version_id", release["VERSION_ID"])
+	setIfPresent(info, "kernel_version", readTrimmed("/proc/sys/kernel/osrelease"))
+
+	setIfPresent(info, "cpu_model", cpuModel())
+	if kb, ok := meminfoKB("MemTotal"); ok {
+		info["memory_total_bytes"] = strconv.FormatUint(kb*1024, 10)
+	}
+	var fs syscall.Statfs_t
+	if syscall.Statfs("/", &fs) == nil {
+		info["disk_total_bytes"] = strconv.FormatUint(fs.Blocks*uint64(fs.Bsize), 10)
+		info["disk_free_bytes"] = strconv.FormatUint(fs.Bavail*uint64(fs.Bsize), 10)
+	}
+	if uptime := readTrimmed("/proc/uptime"); uptime != "" {
+		if secs, err := strconv.ParseFloat(strings.Fields(uptime)[0], 64); err == nil {
+			boot := time.Now().Add(-time.Duration(secs * float64(time.Second)))
+			info["boot_time"] = boot.UTC().Truncate(time.Second).Format(time.RFC3339)
+		}
+	}
+
+	// The DMI serial and UUID are only readable by root
+	setIfPresent(info, "hardware_vendor", readTrimmed("/sys/class/dmi/id/sys_vendor"))
+	setIfPresent(info, "hardware_model", readTrimmed("/sys/class/dmi/id/product_name"))
+	setIfPresent(info, "serial_number", readTrimmed("/sys/class/dmi/id/product_serial"))
+	machineID := readTrimmed("/etc/machine-id")
+	setIfPresent(info, "machine_id", machineID)
+
+	for _, candidate := range []string{readTrimmed("/sys/class/dmi/id/product_uuid"), machineID} {
+		if id, err := uuid.Parse(candidate); err == nil && id != uuid.Nil {
+			inv.HardwareUUID = id.String()
+			break
+		}
+	}
+}
+
+// readKeyValueFile reads a file of KEY=value lines, such as os-release,
+// unquoting the values
+func readKeyValueFile(path string) map[string]string {
+	values := make(map[string]string)
+	f, err := os.Open(path)
+	if err != nil {
+		return values
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !ok || strings.HasPrefix(key, "#") {
+			continue
+		}
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		} else {
+			value = strings.Trim(value, `'"`)
+		}
+		values[key] = value
+	}
+	return values
+}
+
+func cpuModel() string {
+	f, err := os.Open("/proc/cpuinfo")
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if ok && strings.TrimSpace(key) == "model name" {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+// meminfoKB returns a field of /proc/meminfo, in kB
+func meminfoKB(field string) (uint64, bool) {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok || key != field {
+			continue
+		}
+		kb, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimSpace(value), " kB"), 10, 64)
+		return kb, err == nil
+	}
+	return 0, false
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package agent
+
+import "runtime"
+
+// Only Linux is supported so far; other platforms report what Go knows
+// about them
+func collectPlatformInventory(inv *Inventory) {
+	inv.OSVersion = runtime.GOOS
+	inv.SystemInfo["os_name"] = runtime.GOOS
+}
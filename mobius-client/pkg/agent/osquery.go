@@ -0,0 +1,62 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/notawar/mobius/shared/pkg/apiclient"
+)
+
+// osquery runs a query with osqueryi and returns its rows with every
+// column as a string, as the API reports them
+func (a *Agent) osquery(ctx context.Context, query string) ([]map[string]string, time.Duration, error) {
+	if !hasProgram(a.cfg.OsqueryPath) {
+		return nil, 0, fmt.Errorf("osquery is not installed (%s)", a.cfg.OsqueryPath)
+	}
+
+	start := time.Now()
+	out, err := a.run(ctx, a.cfg.OsqueryPath, "--json", query)
+	duration := time.Since(start)
+	if err != nil {
+		return nil, duration, err
+	}
+
+	var raw []map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(out))
+	dec.UseNumber()
+	if err := dec.Decode(&raw); err != nil {
+		return nil, duration, fmt.Errorf("decode osquery output: %w", err)
+	}
+	rows := make([]map[string]string, 0, len(raw))
+	for _, r := range raw {
+		row := make(map[string]string, len(r))
+		for column, value := range r {
+			row[column] = fmt.Sprint(value)
+		}
+		rows = append(rows, row)
+	}
+	return rows, duration, nil
+}
+
+// answerLiveQuery runs a live query and reports its rows, or why it
+// failed
+func (a *Agent) answerLiveQuery(ctx context.Context, query apiclient.DeviceLiveQuery) error {
+	rows, duration, err := a.osquery(ctx, query.Query)
+	result := apiclient.DeviceReportLiveQueryResultRequest{
+		Rows:       rows,
+		DurationMS: apiclient.Ptr(int(duration.Milliseconds())),
+	}
+	if err != nil {
+		result.Error = apiclient.Ptr(err.Error())
+	}
+
+	ctx = apiclient.WithIdempotencyKey(ctx, "live-query-result-"+query.CampaignID)
+	if _, err := a.client.DeviceReportLiveQueryResult(ctx, query.CampaignID, result); err != nil {
+		return fmt.Errorf("report live query result: %w", err)
+	}
+	a.log.Debug("Answered live query", "campaign_id", query.CampaignID, "rows", len(rows))
+	return nil
+}
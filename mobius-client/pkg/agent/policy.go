@@ -0,0 +1,144 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/notawar/mobius/shared/pkg/apiclient"
+)
+
+// maxPolicyMessage bounds the message reported with a policy result
+const maxPolicyMessage = 1024
+
+// setting checks one key of a policy configuration, such as
+// require_encryption, and enforces it where the platform allows. The
+// settings of a platform are listed in its policy_<os>.go.
+type setting struct {
+	// check reports whether the device complies with value, and why not.
+	// It returns errUnsupported when the device lacks what the setting
+	// needs, such as a desktop for a screen lock.
+	check func(ctx context.Context, run runner, value interface{}) (ok bool, detail string, err error)
+	// enforce changes the device to comply with value; nil for settings
+	// that can only be checked
+	enforce func(ctx context.Context, run runner, value interface{}) error
+}
+
+// syncPolicies fetches the policies of the device, applies them and keeps
+// their results for the next check-in
+func (a *Agent) syncPolicies(ctx context.Context) error {
+	resp, err := a.client.DeviceListPolicies(ctx)
+	if err != nil {
+		return fmt.Errorf("list policies: %w", err)
+	}
+
+	results := make([]apiclient.DeviceCheckinRequestQueryResultsPolicy, 0, len(resp.Policies))
+	for _, policy := range resp.Policies {
+		if !policy.Enabled || (policy.Platform != "all" && policy.Platform != Platform()) {
+			continue
+		}
+		result := a.applyPolicy(ctx, policy)
+		results = append(results, result)
+		if result.Status != "pass" {
+			a.log.Info("Policy is not met", "policy_id", policy.ID, "policy", policy.Name,
+				"status", result.Status, "message", *result.Message)
+		}
+	}
+	a.policyResults = results
+	a.log.Debug("Applied policies", "policies", len(results))
+	return nil
+}
+
+// applyPolicy enforces and checks every setting of a policy. The policy
+// fails when a setting is not met, and errors when a setting cannot be
+// checked or none is supported; unsupported settings are listed in the
+// message.
+func (a *Agent) applyPolicy(ctx context.Context, policy apiclient.Policy) apiclient.DeviceCheckinRequestQueryResultsPolicy {
+	keys := make([]string, 0, len(policy.Configuration))
+	for key := range policy.Configuration {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var failures, errs, unsupported []string
+	for _, key := range keys {
+		s, ok := settings[key]
+		if !ok {
+			unsupported = append(unsupported, key)
+			continue
+		}
+		value := policy.Configuration[key]
+
+		var err error
+		if a.cfg.EnforcePolicies && s.enforce != nil {
+			err = s.enforce(ctx, a.run, value)
+		}
+		met, detail := false, ""
+		if err == nil {
+			met, detail, err = s.check(ctx, a.run, value)
+		}
+		switch {
+		case errors.Is(err, errUnsupported):
+			unsupported = append(unsupported, key)
+		case err != nil:
+			errs = append(errs, key+": "+err.Error())
+		case !met:
+			failures = append(failures, key+": "+detail)
+		}
+	}
+
+	status := "pass"
+	switch {
+	case len(errs) > 0:
+		status = "error"
+	case len(failures) > 0:
+		status = "fail"
+	case len(unsupported) == len(keys):
+		status = "error"
+		errs = append(errs, "no setting of the policy is supported")
+	}
+
+	messages := append(failures, errs...)
+	if len(unsupported) > 0 {
+		messages = append(messages, "not supported on "+Platform()+": "+strings.Join(unsupported, ", "))
+	}
+	message := strings.Join(messages, "; ")
+	if len(message) > maxPolicyMessage {
+		message = message[:maxPolicyMessage]
+	}
+	if message == "" {
+		message = "All settings are met"
+	}
+	return apiclient.DeviceCheckinRequestQueryResultsPolicy{
+		PolicyID: policy.ID,
+		Status:   status,
+		Message:  apiclient.Ptr(message),
+	}
+}
+
+// boolValue reads a boolean setting, sent as a JSON boolean or string
+func boolValue(value interface{}) (bool, error) {
+	switch v := value.(type) {
+	case bool:
+		return v, nil
+	case string:
+		return strconv.ParseBool(v)
+	}
+	return false, fmt.Errorf("expected a boolean, got %v", value)
+}
+
+// intValue reads an integer setting, sent as a JSON number or string
+func intValue(value interface{}) (int, error) {
+	switch v := value.(type) {
+	case float64:
+		if v == float64(int(v)) {
+			return int(v), nil
+		}
+	case string:
+		return strconv.Atoi(v)
+	}
+	return 0, fmt.Errorf("expected an integer, got %v", value)
+}
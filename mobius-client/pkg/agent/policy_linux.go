@@ -0,0 +1,300 @@
+//go:build linux
+
+package agent
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Files the agent writes to enforce policies. They are drop-ins, so that
+// removing them restores the configuration of the distribution.
+var (
+	pwqualityDropIn  = "/etc/security/pwquality.conf.d/50-mobius.conf"
+	dconfProfile     = "/etc/dconf/profile/user"
+	dconfDropIn      = "/etc/dconf/db/local.d/50-mobius"
+	dconfLocksDropIn = "/etc/dconf/db/local.d/locks/50-mobius"
+)
+
+// passwordClasses maps password_complexity to the character classes
+// pwquality requires
+var passwordClasses = map[string]int{"low": 1, "medium": 3, "high": 4}
+
+var settings = map[string]setting{
+	"require_encryption": {check: checkEncryption},
+	"firewall_enabled":   {check: checkFirewall},
+	"automatic_updates":  {check: checkAutomaticUpdates},
+	"password_length": {
+		check:   checkPwquality("minlen", intValue),
+		enforce: enforcePwquality("minlen", intValue),
+	},
+	"password_complexity": {
+		check:   checkPwquality("minclass", complexityValue),
+		enforce: enforcePwquality("minclass", complexityValue),
+	},
+	"auto_lock_timeout": {check: checkAutoLock, enforce: enforceAutoLock},
+}
+
+// checkEncryption passes when the root filesystem sits on a dm-crypt
+// (LUKS) device
+func checkEncryption(ctx context.Context, run runner, value interface{}) (bool, string, error) {
+	if required, err := boolValue(value); err != nil || !required {
+		return true, "", err
+	}
+	source, err := run(ctx, "findmnt", "-n", "-o", "SOURCE", "/")
+	if err != nil {
+		return false, "", err
+	}
+	// -s lists the device and the devices it is built on
+	out, err := run(ctx, "lsblk", "-n", "-s", "-o", "TYPE", strings.TrimSpace(string(source)))
+	if err != nil {
+		return false, "", err
+	}
+	for _, typ := range strings.Fields(string(out)) {
+		if typ == "crypt" {
+			return true, "", nil
+		}
+	}
+	return false, "the root filesystem is not encrypted", nil
+}
+
+// checkFirewall passes when ufw or firewalld is active, or nftables holds
+// a ruleset
+func checkFirewall(ctx context.Context, run runner, value interface{}) (bool, string, error) {
+	if required, err := boolValue(value); err != nil || !required {
+		return true, "", err
+	}
+	if hasProgram("ufw") {
+		if out, err := run(ctx, "ufw", "status"); err == nil && strings.Contains(string(out), "Status: active") {
+			return true, "", nil
+		}
+	}
+	if hasProgram("firewall-cmd") {
+		if out, err := run(ctx, "firewall-cmd", "--state"); err == nil && strings.TrimSpace(string(out)) == "running" {
+			return true, "", nil
+		}
+	}
+	if hasProgram("nft") {
+		if out, err := run(ctx, "nft", "list", "ruleset"); err == nil && strings.Contains(string(out), "chain ") {
+			return true, "", nil
+		}
+	}
+	return false, "no firewall is active", nil
+}
+
+// checkAutomaticUpdates passes when unattended-upgrades or dnf-automatic
+// is enabled
+func checkAutomaticUpdates(ctx context.Context, run runner, value interface{}) (bool, string, error) {
+	if required, err := boolValue(value); err != nil || !required {
+		return true, "", err
+	}
+	if hasProgram("apt-get") {
+		files, _ := filepath.Glob("/etc/apt/apt.conf.d/*")
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			if err == nil && strings.Contains(string(data), `APT::Periodic::Unattended-Upgrade "1"`) {
+				return true, "", nil
+			}
+		}
+	}
+	if hasProgram("systemctl") {
+		for _, timer := range []string{"dnf-automatic.timer", "dnf-automatic-install.timer", "dnf5-automatic.timer"} {
+			if out, err := run(ctx, "systemctl", "is-enabled", timer); err == nil && strings.TrimSpace(string(out)) == "enabled" {
+				return true, "", nil
+			}
+		}
+	}
+	return false, "automatic updates are not enabled", nil
+}
+
+func complexityValue(value interface{}) (int, error) {
+	level, _ := value.(string)
+	classes, ok := passwordClasses[strings.ToLower(level)]
+	if !ok {
+		return 0, fmt.Errorf("expected low, medium or high, got %v", value)
+	}
+	return classes, nil
+}
+
+// checkPwquality passes when key is set, and every pwquality configuration
+// file that sets it sets at least the policy value
+func checkPwquality(key string, parse func(interface{}) (int, error)) func(context.Context, runner, interface{}) (bool, string, error) {
+	return func(_ context.Context, _ runner, value interface{}) (bool, string, error) {
+		want, err := parse(value)
+		if err != nil {
+			return false, "", err
+		}
+		files, _ := filepath.Glob("/etc/security/pwquality.conf.d/*.conf")
+		files = append([]string{"/etc/security/pwquality.conf"}, files...)
+
+		found := false
+		for _, file := range files {
+			got, ok := readConfInt(file, key)
+			if !ok {
+				continue
+			}
+			if got < want {
+				return false, fmt.Sprintf("%s sets %s = %d, below %d", file, key, got, want), nil
+			}
+			found = true
+		}
+		if !found {
+			return false, fmt.Sprintf("pwquality %s is not set", key), nil
+		}
+		return true, "", nil
+	}
+}
+
+// enforcePwquality sets key in the pwquality drop-in of the agent
+func enforcePwquality(key string, parse func(interface{}) (int, error)) func(context.Context, runner, interface{}) error {
+	return func(_ context.Context, _ runner, value interface{}) error {
+		want, err := parse(value)
+		if err != nil {
+			return err
+		}
+		values := readConfFile(pwqualityDropIn)
+		values[key] = strconv.Itoa(want)
+		return writeConfFile(pwqualityDropIn, values)
+	}
+}
+
+// checkAutoLock passes when the dconf defaults of the agent lock the
+// screen after at most the policy timeout, in seconds, of inactivity
+func checkAutoLock(_ context.Context, _ runner, value interface{}) (bool, string, error) {
+	want, err := intValue(value)
+	if err != nil {
+		return false, "", err
+	}
+	if !hasProgram("dconf") {
+		return false, "", errUnsupported
+	}
+	data, err := os.ReadFile(dconfDropIn)
+	if os.IsNotExist(err) {
+		return false, "the screen lock is not configured", nil
+	}
+	if err != nil {
+		return false, "", err
+	}
+	got := 0
+	locks := false
+	for _, line := range strings.Split(string(data), "\n") {
+		key, val, _ := strings.Cut(strings.TrimSpace(line), "=")
+		switch key {
+		case "idle-delay":
+			got, _ = strconv.Atoi(strings.TrimPrefix(val, "uint32 "))
+		case "lock-enabled":
+			locks = val == "true"
+		}
+	}
+	if !locks || got == 0 {
+		return false, "the screen lock is disabled", nil
+	}
+	if got > want {
+		return false, fmt.Sprintf("the screen locks after %d seconds, above %d", got, want), nil
+	}
+	return true, "", nil
+}
+
+// enforceAutoLock sets and locks the GNOME idle delay and screen lock in
+// the local dconf database, and adds that database to the user profile
+func enforceAutoLock(ctx context.Context, run runner, value interface{}) error {
+	timeout, err := intValue(value)
+	if err != nil {
+		return err
+	}
+	if !hasProgram("dconf") {
+		return errUnsupported
+	}
+
+	profile, err := os.ReadFile(dconfProfile)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if !strings.Contains(string(profile), "system-db:local") {
+		if len(profile) == 0 {
+			profile = []byte("user-db:user\n")
+		}
+		profile = append(profile, "system-db:local\n"...)
+		if err := writeFile(dconfProfile, profile); err != nil {
+			return err
+		}
+	}
+
+	keyfile := fmt.Sprintf("[org/gnome/desktop/session]\nidle-delay=uint32 %d\n\n"+
+		"[org/gnome/desktop/screensaver]\nlock-enabled=true\nlock-delay=uint32 0\n", timeout)
+	locks := "/org/gnome/desktop/session/idle-delay\n/org/gnome/desktop/screensaver/lock-enabled\n" +
+		"/org/gnome/desktop/screensaver/lock-delay\n"
+	if err := writeFile(dconfDropIn, []byte(keyfile)); err != nil {
+		return err
+	}
+	if err := writeFile(dconfLocksDropIn, []byte(locks)); err != nil {
+		return err
+	}
+	_, err = run(ctx, "dconf", "update")
+	return err
+}
+
+// readConfInt reads an integer "key = value" setting of a file
+func readConfInt(path, key string) (int, bool) {
+	value, ok := readConfFile(path)[key]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.Atoi(value)
+	return n, err == nil
+}
+
+// readConfFile reads the "key = value" settings of a file, without its
+// comments
+func readConfFile(path string) map[string]string {
+	values := make(map[string]string)
+	f, err := os.Open(path)
+	if err != nil {
+		return values
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, _ := strings.Cut(line, "=")
+		values[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return values
+}
+
+func writeConfFile(path string, values map[string]string) error {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString("# Managed by the Mobius agent; changes are overwritten\n")
+	for _, key := range keys {
+		fmt.Fprintf(&b, "%s = %s\n", key, values[key])
+	}
+	return writeFile(path, []byte(b.String()))
+}
+
+// writeFile replaces a world-readable configuration file
+func writeFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,7 @@
+//go:build !linux
+
+package agent
+
+// No policy settings are supported outside Linux yet; their policies are
+// reported as errors naming the unsupported settings
+var settings = map[string]setting{}
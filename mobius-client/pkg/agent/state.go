@@ -0,0 +1,129 @@
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+// ErrNotEnrolled is returned by a StateStore that holds no enrollment yet
+var ErrNotEnrolled = errors.New("device is not enrolled")
+
+// State is what the agent keeps between runs: its enrollment, the device
+// token and the applications it installed
+type State struct {
+	ServerURL     string    `json:"server_url"`
+	DeviceID      string    `json:"device_id"`
+	UUID          string    `json:"uuid"`
+	DeviceToken   string    `json:"device_token"`
+	EnrolledAt    time.Time `json:"enrolled_at"`
+	TokenIssuedAt time.Time `json:"token_issued_at"`
+	// Applications are the applications the agent installed, by ID
+	Applications map[string]InstalledApplication `json:"applications,omitempty"`
+}
+
+// InstalledApplication records an application installed by the agent, so
+// that it is not installed again and can be uninstalled
+type InstalledApplication struct {
+	Name        string    `json:"name"`
+	Version     string    `json:"version"`
+	Checksum    string    `json:"checksum"`
+	PackageType string    `json:"package_type"`
+	BundleID    string    `json:"bundle_id,omitempty"`
+	InstalledAt time.Time `json:"installed_at"`
+	// UninstallCommand removes applications installed by a package
+	// manager
+	UninstallCommand string `json:"uninstall_command,omitempty"`
+}
+
+// StateStore keeps the state of the agent
+type StateStore interface {
+	// Load returns the stored state, or ErrNotEnrolled
+	Load() (*State, error)
+	// Save replaces the stored state
+	Save(state *State) error
+}
+
+// FileStore keeps the state in a JSON file only its owner can read. The
+// device token is a bearer credential: anyone holding it can act as the
+// device, so the file is written with mode 0600 in a 0700 directory, and
+// the agent refuses to load it once other users can read it, as ssh does
+// with private keys.
+type FileStore struct {
+	Path string
+}
+
+// NewFileStore creates a store of the state file in dir
+func NewFileStore(dir string) *FileStore {
+	return &FileStore{Path: filepath.Join(dir, "state.json")}
+}
+
+func (s *FileStore) Load() (*State, error) {
+	info, err := os.Stat(s.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotEnrolled
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Windows has no permission bits; the directory ACL protects the file
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0o077 != 0 {
+		return nil, fmt.Errorf("state file %s is accessible by other users (mode %v); run chmod 600 on it", s.Path, info.Mode().Perm())
+	}
+
+	data, err := os.ReadFile(s.Path)
+	if err != nil {
+		return nil, err
+	}
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("decode state file %s: %w", s.Path, err)
+	}
+	if state.DeviceToken == "" {
+		return nil, ErrNotEnrolled
+	}
+	return &state, nil
+}
+
+// Save writes the state to a temporary file and renames it over the state
+// file, so that a crash never leaves a partial token behind
+func (s *FileStore) Save(state *State) error {
+	dir := filepath.Dir(s.Path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("create state directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, ".state-*.json")
+	if err != nil {
+		return fmt.Errorf("create state file: %w", err)
+	}
+	defer os.Remove(tmp.Name()) //nolint:errcheck
+
+	if err := tmp.Chmod(0o600); err != nil && runtime.GOOS != "windows" {
+		tmp.Close()
+		return fmt.Errorf("protect state file: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write state file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write state file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write state file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.Path); err != nil {
+		return fmt.Errorf("replace state file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package agent
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileStore(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "state")
+	store := NewFileStore(dir)
+
+	if _, err := store.Load(); !errors.Is(err, ErrNotEnrolled) {
+		t.Fatalf("expected ErrNotEnrolled without a state file, got %v", err)
+	}
+
+	state := &State{
+		ServerURL:     "https://mobius.example.com",
+		DeviceID:      "device-1",
+		UUID:          "uuid-1",
+		DeviceToken:   "token-1",
+		EnrolledAt:    time.Now().UTC().Truncate(time.Second),
+		TokenIssuedAt: time.Now().UTC().Truncate(time.Second),
+		Applications:  map[string]InstalledApplication{"app-1": {Name: "App", Version: "1.0"}},
+	}
+	if err := store.Save(state); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	loaded, err := store.Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if loaded.DeviceToken != state.DeviceToken || !loaded.EnrolledAt.Equal(state.EnrolledAt) || loaded.Applications["app-1"].Version != "1.0" {
+		t.Errorf("expected %+v, got %+v", state, loaded)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("expected only the state file, got %d files", len(entries))
+	}
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+	for path, want := range map[string]os.FileMode{dir: 0o700, store.Path: 0o600} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if info.Mode().Perm() != want {
+			t.Errorf("expected %s to have mode %v, got %v", path, want, info.Mode().Perm())
+		}
+	}
+
+	// A token other users could read is refused
+	for _, mode := range []os.FileMode{0o640, 0o604} {
+		if err := os.Chmod(store.Path, mode); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := store.Load(); err == nil || !strings.Contains(err.Error(), "accessible by other users") {
+			t.Errorf("expected mode %v to be refused, got %v", mode, err)
+		}
+	}
+
+	// Saving again protects the file
+	if err := store.Save(state); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := store.Load(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestFileStoreWithoutToken(t *testing.T) {
+	store := NewFileStore(t.TempDir())
+	if err := store.Save(&State{ServerURL: "https://mobius.example.com", UUID: "uuid-1"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := store.Load(); !errors.Is(err, ErrNotEnrolled) {
+		t.Errorf("expected ErrNotEnrolled without a token, got %v", err)
+	}
+}
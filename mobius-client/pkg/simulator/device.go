@@ -0,0 +1,421 @@
+package simulator
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/notawar/mobius/shared/pkg/apiclient"
+)
+
+// Endpoints of the device API, as they are reported
+const (
+	epEnrollDevice  = "POST /api/v1/devices"
+	epDeviceEnroll  = "POST /api/v1/device/enroll"
+	epCheckin       = "POST /api/v1/device/checkin"
+	epPolicies      = "GET /api/v1/device/policies"
+	epApplications  = "GET /api/v1/device/applications"
+	epCommands      = "GET /api/v1/device/commands"
+	epAckCommand    = "POST /api/v1/device/commands/{id}/ack"
+	epCommandResult = "POST /api/v1/device/commands/{id}/result"
+	epQueryResult   = "POST /api/v1/device/queries/{id}/results"
+)
+
+// maxEnrollDelay bounds the delay between the enrollment attempts of a
+// device
+const maxEnrollDelay = time.Minute
+
+// osVersions are the OS versions devices of a platform start with
+var osVersions = map[string][]string{
+	"linux":   {"Ubuntu 24.04.1 LTS", "Ubuntu 22.04.5 LTS", "Debian GNU/Linux 12 (bookworm)", "Fedora Linux 40 (Workstation Edition)"},
+	"windows": {"Windows 11 Pro 23H2", "Windows 11 Enterprise 24H2", "Windows 10 Enterprise 22H2"},
+	"macos":   {"macOS 14.6.1", "macOS 15.0"},
+	"ios":     {"iOS 17.6", "iOS 18.0"},
+	"android": {"Android 14", "Android 15"},
+}
+
+// event is something a device does at an interval
+type event int
+
+const (
+	evSync event = iota
+	evCheckin
+	evCommands
+	evOsqueryConfig
+	evOsqueryDistributed
+	evOsqueryLog
+	numEvents
+)
+
+// device is a simulated device. Its loop runs in one goroutine; command
+// results and live query answers are sent from their own after their
+// latency.
+type device struct {
+	sim    *Simulator
+	rng    *rand.Rand
+	client *apiclient.Client
+	// enrollClient enrolls with the user token of the scenario, if any
+	enrollClient *apiclient.Client
+
+	platform   string
+	uuid       string
+	hostname   string
+	osVersion  string
+	systemInfo map[string]string
+	policies   []apiclient.Policy
+
+	offlineUntil time.Time
+	osquery      bool
+	nodeKey      string
+
+	// answering holds the live queries being answered, which check-ins
+	// hand out again until they are
+	mu        sync.Mutex
+	answering map[string]bool
+}
+
+func (s *Simulator) newDevice(i int) *device {
+	rng := rand.New(rand.NewPCG(s.seed, uint64(i)))
+	platform := s.platforms.pick(rng.Float64())
+	versions := osVersions[platform]
+
+	var id uuid.UUID
+	binary.LittleEndian.PutUint64(id[:8], rng.Uint64())
+	binary.LittleEndian.PutUint64(id[8:], rng.Uint64())
+	id[6] = id[6]&0x0f | 0x40 // version 4
+	id[8] = id[8]&0x3f | 0x80 // RFC 4122 variant
+
+	memory := uint64(8<<30) << rng.IntN(3)
+	disk := uint64(256<<30) << rng.IntN(3)
+	opts := []apiclient.ClientOpt{
+		apiclient.WithHTTPClient(s.httpClient),
+		apiclient.WithUserAgent("mobius-simulator/" + apiclient.APIVersion),
+	}
+	client, _ := apiclient.New(s.scenario.ServerURL, opts...)
+	enrollClient := client
+	if token := s.scenario.Enrollment.Token; token != "" {
+		enrollClient, _ = apiclient.New(s.scenario.ServerURL, append(opts, apiclient.WithToken(token))...)
+	}
+
+	return &device{
+		sim:          s,
+		rng:          rng,
+		client:       client,
+		enrollClient: enrollClient,
+		platform:     platform,
+		uuid:         id.String(),
+		hostname:     fmt.Sprintf("sim-%s-%05d", platform, i),
+		osVersion:    versions[rng.IntN(len(versions))],
+		systemInfo: map[string]string{
+			"agent_version":      "simulator",
+			"arch":               "amd64",
+			"cpu_logical":        strconv.Itoa(4 << rng.IntN(3)),
+			"memory_total_bytes": strconv.FormatUint(memory, 10),
+			"disk_total_bytes":   strconv.FormatUint(disk, 10),
+			"disk_free_bytes":    strconv.FormatUint(disk/2, 10),
+			"serial_number":      fmt.Sprintf("SIM%09d", rng.IntN(1_000_000_000)),
+			"os_build":           strconv.Itoa(1000 + rng.IntN(9000)),
+		},
+		osquery:   rng.Float64() < s.scenario.Osquery.Fraction,
+		answering: make(map[string]bool),
+	}
+}
+
+// run enrolls the device, then does what is due at every interval until
+// ctx is done
+func (d *device) run(ctx context.Context) {
+	if !d.enroll(ctx) {
+		return
+	}
+
+	var next [numEvents]time.Time
+	now := time.Now()
+	next[evSync], next[evCheckin], next[evCommands] = now, now, now
+	if d.osquery {
+		next[evOsqueryConfig], next[evOsqueryDistributed], next[evOsqueryLog] = now, now, now
+	}
+
+	for {
+		ev := evSync
+		for e := evSync; e < numEvents; e++ {
+			if !next[e].IsZero() && next[e].Before(next[ev]) {
+				ev = e
+			}
+		}
+		if sleep(ctx, time.Until(next[ev])) != nil {
+			return
+		}
+
+		// Whatever falls due while offline happens when back online
+		if time.Now().Before(d.offlineUntil) {
+			next[ev] = d.offlineUntil.Add(d.jitter(time.Second))
+			continue
+		}
+		d.handle(ctx, ev)
+		next[ev] = time.Now().Add(d.jitter(d.interval(ev)))
+	}
+}
+
+func (d *device) handle(ctx context.Context, ev event) {
+	switch ev {
+	case evSync:
+		d.sync(ctx)
+	case evCheckin:
+		d.checkin(ctx)
+	case evCommands:
+		d.processCommands(ctx)
+	case evOsqueryConfig:
+		d.osqueryConfig(ctx)
+	case evOsqueryDistributed:
+		d.osqueryDistributed(ctx)
+	case evOsqueryLog:
+		d.osqueryLog(ctx)
+	}
+}
+
+func (d *device) interval(ev event) time.Duration {
+	s := d.sim.scenario
+	switch ev {
+	case evSync:
+		return time.Duration(s.SyncInterval)
+	case evCheckin:
+		return time.Duration(s.Checkin.Interval)
+	case evCommands:
+		return time.Duration(s.Commands.PollInterval)
+	case evOsqueryConfig:
+		return time.Duration(s.Osquery.ConfigInterval)
+	case evOsqueryDistributed:
+		return time.Duration(s.Osquery.DistributedInterval)
+	default:
+		return time.Duration(s.Osquery.LogInterval)
+	}
+}
+
+// jitter varies d by up to the check-in jitter of the scenario either way
+func (d *device) jitter(interval time.Duration) time.Duration {
+	j := d.sim.scenario.Checkin.Jitter
+	return time.Duration(float64(interval) * (1 + j*(2*d.rng.Float64()-1)))
+}
+
+// between picks a duration of a range
+func (d *device) between(r DurationRange) time.Duration {
+	if r.Max <= r.Min {
+		return time.Duration(r.Min)
+	}
+	return time.Duration(r.Min) + time.Duration(d.rng.Int64N(int64(r.Max-r.Min)))
+}
+
+// enroll enrolls the device in the device API, and as an osquery host if
+// it runs osquery, retrying until ctx is done
+func (d *device) enroll(ctx context.Context) bool {
+	delay := time.Second
+	for {
+		err := d.enrollDevice(ctx)
+		if err == nil {
+			break
+		}
+		d.sim.count("enroll_failures")
+		d.sim.log.Debug("Device failed to enroll", "hostname", d.hostname, "error", err)
+		if sleep(ctx, d.jitter(delay)) != nil {
+			return false
+		}
+		delay = min(delay*2, maxEnrollDelay)
+	}
+	d.sim.enrolled.Add(1)
+
+	if d.osquery {
+		if err := d.osqueryEnroll(ctx); err != nil {
+			d.sim.log.Debug("Osquery host failed to enroll", "hostname", d.hostname, "error", err)
+		}
+	}
+	return true
+}
+
+func (d *device) enrollDevice(ctx context.Context) error {
+	enrollment := apiclient.DeviceEnrollment{
+		UUID:      d.uuid,
+		Hostname:  d.hostname,
+		Platform:  d.platform,
+		OSVersion: apiclient.Ptr(d.osVersion),
+	}
+	scenario := d.sim.scenario.Enrollment
+	if scenario.Secret != "" {
+		enrollment.EnrollmentSecret = apiclient.Ptr(scenario.Secret)
+	}
+
+	if scenario.Token != "" {
+		resp, err := d.enrollClient.EnrollDevice(withEndpoint(ctx, epEnrollDevice), enrollment)
+		if err != nil {
+			return err
+		}
+		d.client.SetToken(resp.DeviceToken)
+		return nil
+	}
+	resp, err := d.enrollClient.DeviceEnroll(withEndpoint(ctx, epDeviceEnroll), enrollment)
+	if err != nil {
+		return err
+	}
+	d.client.SetToken(resp.DeviceToken)
+	return nil
+}
+
+// sync fetches the policies and applications of the device, as the agent
+// does
+func (d *device) sync(ctx context.Context) {
+	policies, err := d.client.DeviceListPolicies(withEndpoint(ctx, epPolicies))
+	if err == nil {
+		d.policies = policies.Policies
+	}
+	d.client.DeviceListApplications(withEndpoint(ctx, epApplications)) //nolint:errcheck
+}
+
+// checkin goes offline for a while at the offline rate of the scenario,
+// or checks in with the inventory, changed at the churn rate, and the
+// policy results of the device
+func (d *device) checkin(ctx context.Context) {
+	s := d.sim.scenario
+	if d.rng.Float64() < s.Offline.Rate {
+		d.offlineUntil = time.Now().Add(d.between(s.Offline.Duration))
+		d.sim.count("offline_periods")
+		return
+	}
+	if d.rng.Float64() < s.Inventory.Churn {
+		d.churnInventory()
+		d.sim.count("inventory_changes")
+	}
+
+	req := apiclient.DeviceCheckinRequest{
+		OSVersion:  apiclient.Ptr(d.osVersion),
+		SystemInfo: d.systemInfo,
+	}
+	if len(d.policies) > 0 {
+		results := make([]apiclient.DeviceCheckinRequestQueryResultsPolicy, 0, len(d.policies))
+		for _, policy := range d.policies {
+			result := apiclient.DeviceCheckinRequestQueryResultsPolicy{PolicyID: policy.ID, Status: "pass"}
+			if d.rng.Float64() < s.Failures.Policy {
+				result.Status = "fail"
+				result.Message = apiclient.Ptr("Simulated failure")
+				d.sim.count("policy_failures")
+			}
+			results = append(results, result)
+		}
+		req.QueryResults = &apiclient.DeviceCheckinRequestQueryResults{Policies: results}
+	}
+
+	resp, err := d.client.DeviceCheckin(withEndpoint(ctx, epCheckin), req)
+	if err != nil {
+		if apiclient.StatusCode(err) == http.StatusUnauthorized {
+			d.enrollDevice(ctx) //nolint:errcheck
+		}
+		return
+	}
+	d.sim.count("checkins")
+	for _, query := range resp.Queries {
+		d.answerLiveQuery(ctx, query)
+	}
+}
+
+// churnInventory changes the inventory the way devices change: disks fill
+// up, and now and then the OS is updated
+func (d *device) churnInventory() {
+	total, _ := strconv.ParseUint(d.systemInfo["disk_total_bytes"], 10, 64)
+	d.systemInfo["disk_free_bytes"] = strconv.FormatUint(uint64(d.rng.Float64()*float64(total)), 10)
+	if d.rng.IntN(10) == 0 {
+		build, _ := strconv.Atoi(d.systemInfo["os_build"])
+		d.systemInfo["os_build"] = strconv.Itoa(build + 1)
+	}
+}
+
+// answerLiveQuery reports rows for a live query after the command latency,
+// unless it is being answered already
+func (d *device) answerLiveQuery(ctx context.Context, query apiclient.DeviceLiveQuery) {
+	d.mu.Lock()
+	if d.answering[query.CampaignID] {
+		d.mu.Unlock()
+		return
+	}
+	d.answering[query.CampaignID] = true
+	d.mu.Unlock()
+
+	latency := d.between(d.sim.scenario.Commands.Latency)
+	result := apiclient.DeviceReportLiveQueryResultRequest{DurationMS: apiclient.Ptr(int(latency.Milliseconds()))}
+	if d.rng.Float64() < d.sim.scenario.Failures.LiveQuery {
+		result.Error = apiclient.Ptr("Simulated failure")
+	} else {
+		result.Rows = d.rows()
+	}
+
+	go func() {
+		if sleep(ctx, latency) != nil {
+			return
+		}
+		_, err := d.client.DeviceReportLiveQueryResult(withEndpoint(ctx, epQueryResult), query.CampaignID, result)
+		if err != nil {
+			// Answered again when the next check-in hands it out
+			d.mu.Lock()
+			delete(d.answering, query.CampaignID)
+			d.mu.Unlock()
+			return
+		}
+		d.sim.count("live_queries_answered")
+	}()
+}
+
+// processCommands acknowledges the queued commands and reports their
+// results after the command latency, failing them at the failure rate
+func (d *device) processCommands(ctx context.Context) {
+	resp, err := d.client.DeviceFetchCommands(withEndpoint(ctx, epCommands))
+	if err != nil {
+		return
+	}
+	for _, cmd := range resp.Commands {
+		if _, err := d.client.DeviceAcknowledgeCommand(withEndpoint(ctx, epAckCommand), cmd.ID); err != nil {
+			continue
+		}
+
+		report := apiclient.DeviceReportCommandResultRequest{
+			Status: "completed",
+			Result: map[string]interface{}{"message": "Simulated " + cmd.Command},
+		}
+		if d.rng.Float64() < d.sim.scenario.Failures.Command {
+			report.Status = "failed"
+			report.Error = apiclient.Ptr("Simulated failure")
+		}
+		latency := d.between(d.sim.scenario.Commands.Latency)
+
+		go func(id string) {
+			if sleep(ctx, latency) != nil {
+				return
+			}
+			ctx := apiclient.WithIdempotencyKey(withEndpoint(ctx, epCommandResult), "command-result-"+id)
+			if _, err := d.client.DeviceReportCommandResult(ctx, id, report); err == nil {
+				d.sim.count("commands_" + report.Status)
+			}
+		}(cmd.ID)
+	}
+}
+
+// rows returns the rows of a query result, as many as the scenario's
+// result_rows and each about row_bytes long
+func (d *device) rows() []map[string]string {
+	r := d.sim.scenario.Osquery.ResultRows
+	n := r.Min
+	if r.Max > r.Min {
+		n += d.rng.IntN(r.Max - r.Min + 1)
+	}
+	rows := make([]map[string]string, n)
+	for i := range rows {
+		rows[i] = map[string]string{
+			"pid":  strconv.Itoa(1000 + i),
+			"name": "process-" + strconv.Itoa(i),
+			"data": d.sim.padding,
+		}
+	}
+	return rows
+}
@@ -0,0 +1,200 @@
+package simulator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Endpoints of the legacy osquery API, as they are reported
+const (
+	epOsqueryEnroll           = "POST /api/osquery/enroll"
+	epOsqueryConfig           = "POST /api/osquery/config"
+	epOsqueryDistributedRead  = "POST /api/osquery/distributed/read"
+	epOsqueryDistributedWrite = "POST /api/osquery/distributed/write"
+	epOsqueryLog              = "POST /api/osquery/log"
+)
+
+// osqueryVersion is the osquery version simulated hosts report
+const osqueryVersion = "5.13.1"
+
+// errNodeInvalid is returned for requests with a node key the server does
+// not know, such as after the host was deleted
+var errNodeInvalid = errors.New("node key invalid")
+
+// osqueryEnroll enrolls the device as an osquery host, as osquery's TLS
+// enroll plugin does
+func (d *device) osqueryEnroll(ctx context.Context) error {
+	osquery := d.sim.scenario.Osquery
+	req := map[string]interface{}{
+		"enroll_secret":   osquery.EnrollSecret,
+		"host_identifier": d.uuid,
+		"host_details": map[string]map[string]string{
+			"system_info": {
+				"hostname":          d.hostname,
+				"uuid":              d.uuid,
+				"hardware_serial":   d.systemInfo["serial_number"],
+				"cpu_logical_cores": d.systemInfo["cpu_logical"],
+				"physical_memory":   d.systemInfo["memory_total_bytes"],
+			},
+			"os_version": {
+				"name":     d.osVersion,
+				"platform": d.platform,
+			},
+			"osquery_info": {
+				"version": osqueryVersion,
+			},
+		},
+	}
+	var resp struct {
+		NodeKey string `json:"node_key"`
+	}
+	if err := d.osqueryPost(ctx, epOsqueryEnroll, "/api/osquery/enroll", req, &resp); err != nil {
+		return err
+	}
+	if resp.NodeKey == "" {
+		return errors.New("enroll returned no node key")
+	}
+	wasEnrolled := d.nodeKey != ""
+	d.nodeKey = resp.NodeKey
+	if !wasEnrolled {
+		d.sim.osqueryEnrolled.Add(1)
+	}
+	return nil
+}
+
+func (d *device) osqueryConfig(ctx context.Context) {
+	d.osqueryRequest(ctx, epOsqueryConfig, "/api/osquery/config", func() interface{} {
+		return map[string]string{"node_key": d.nodeKey}
+	}, nil)
+}
+
+// osqueryDistributed reads the distributed queries for the host and
+// writes their results, failing them at the live query failure rate
+func (d *device) osqueryDistributed(ctx context.Context) {
+	var read struct {
+		Queries map[string]string `json:"queries"`
+	}
+	ok := d.osqueryRequest(ctx, epOsqueryDistributedRead, "/api/osquery/distributed/read", func() interface{} {
+		return map[string]string{"node_key": d.nodeKey}
+	}, &read)
+	if !ok || len(read.Queries) == 0 {
+		return
+	}
+
+	results := make(map[string][]map[string]string, len(read.Queries))
+	statuses := make(map[string]int, len(read.Queries))
+	messages := make(map[string]string)
+	for name := range read.Queries {
+		if d.rng.Float64() < d.sim.scenario.Failures.LiveQuery {
+			results[name] = []map[string]string{}
+			statuses[name] = 1
+			messages[name] = "Simulated failure"
+			continue
+		}
+		results[name] = d.rows()
+		statuses[name] = 0
+	}
+	ok = d.osqueryRequest(ctx, epOsqueryDistributedWrite, "/api/osquery/distributed/write", func() interface{} {
+		return map[string]interface{}{
+			"node_key": d.nodeKey,
+			"queries":  results,
+			"statuses": statuses,
+			"messages": messages,
+		}
+	}, nil)
+	if ok {
+		d.sim.count("distributed_queries_answered")
+	}
+}
+
+// osqueryLog sends a snapshot result log, as scheduled queries do
+func (d *device) osqueryLog(ctx context.Context) {
+	now := time.Now().UTC()
+	entry := map[string]interface{}{
+		"name":           "pack/Global/simulated",
+		"hostIdentifier": d.uuid,
+		"calendarTime":   now.Format("Mon Jan 2 15:04:05 2006 UTC"),
+		"unixTime":       now.Unix(),
+		"epoch":          0,
+		"counter":        0,
+		"action":         "snapshot",
+		"snapshot":       d.rows(),
+	}
+	d.osqueryRequest(ctx, epOsqueryLog, "/api/osquery/log", func() interface{} {
+		return map[string]interface{}{
+			"node_key": d.nodeKey,
+			"log_type": "result",
+			"data":     []interface{}{entry},
+		}
+	}, nil)
+}
+
+// osqueryRequest sends a request authenticated with the node key, which
+// body builds, enrolling the host first if it is not. An invalid node key
+// enrolls the host again and retries, as osquery does.
+func (d *device) osqueryRequest(ctx context.Context, endpoint, path string, body func() interface{}, out interface{}) bool {
+	for attempt := 0; attempt < 2; attempt++ {
+		if d.nodeKey == "" {
+			if err := d.osqueryEnroll(ctx); err != nil {
+				d.sim.count("osquery_enroll_failures")
+				return false
+			}
+		}
+		err := d.osqueryPost(ctx, endpoint, path, body(), out)
+		if err == nil {
+			return true
+		}
+		if err != errNodeInvalid {
+			return false
+		}
+		d.nodeKey = ""
+	}
+	return false
+}
+
+// osqueryPost posts a JSON body to an osquery endpoint and decodes the
+// response into out, unless out is nil
+func (d *device) osqueryPost(ctx context.Context, endpoint, path string, body, out interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	serverURL := d.sim.scenario.Osquery.ServerURL
+	if serverURL == "" {
+		serverURL = d.sim.scenario.ServerURL
+	}
+	req, err := http.NewRequestWithContext(withEndpoint(ctx, endpoint), http.MethodPost,
+		strings.TrimRight(serverURL, "/")+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "osquery/"+osqueryVersion)
+
+	resp, err := d.sim.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		io.Copy(io.Discard, resp.Body) //nolint:errcheck
+		return errNodeInvalid
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s: %s", endpoint, resp.Status, bytes.TrimSpace(msg))
+	}
+	if out == nil {
+		_, err = io.Copy(io.Discard, resp.Body)
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
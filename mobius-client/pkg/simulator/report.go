@@ -0,0 +1,201 @@
+package simulator
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// maxSamples bounds the latencies kept per endpoint. Longer runs keep a
+// uniform sample of their requests, which keeps the percentiles accurate
+// within a fraction of a percent.
+const maxSamples = 100_000
+
+// Recorder collects the latency and outcome of every request, by endpoint
+type Recorder struct {
+	mu        sync.Mutex
+	endpoints map[string]*endpointStats
+	rng       *rand.Rand
+}
+
+type endpointStats struct {
+	requests int
+	errors   int
+	statuses map[int]int
+	samples  []time.Duration
+	max      time.Duration
+}
+
+// NewRecorder creates an empty recorder
+func NewRecorder() *Recorder {
+	return &Recorder{
+		endpoints: make(map[string]*endpointStats),
+		rng:       rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64())),
+	}
+}
+
+// Record adds a request. Status 0 is a request that got no response, such
+// as after a timeout; it counts as an error, as do statuses of 400 and up.
+func (r *Recorder) Record(endpoint string, latency time.Duration, status int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stats, ok := r.endpoints[endpoint]
+	if !ok {
+		stats = &endpointStats{statuses: make(map[int]int)}
+		r.endpoints[endpoint] = stats
+	}
+	stats.requests++
+	stats.statuses[status]++
+	if status == 0 || status >= http.StatusBadRequest {
+		stats.errors++
+	}
+	stats.max = max(stats.max, latency)
+
+	// Reservoir sampling: every request has the same chance to be kept
+	if len(stats.samples) < maxSamples {
+		stats.samples = append(stats.samples, latency)
+	} else if i := r.rng.IntN(stats.requests); i < maxSamples {
+		stats.samples[i] = latency
+	}
+}
+
+// EndpointReport is the latency and errors of the requests to an endpoint
+type EndpointReport struct {
+	Endpoint  string  `json:"endpoint"`
+	Requests  int     `json:"requests"`
+	Errors    int     `json:"errors"`
+	ErrorRate float64 `json:"error_rate"`
+	P50MS     float64 `json:"p50_ms"`
+	P95MS     float64 `json:"p95_ms"`
+	P99MS     float64 `json:"p99_ms"`
+	MaxMS     float64 `json:"max_ms"`
+	// Statuses counts the responses by status code, "0" for requests
+	// without a response
+	Statuses map[string]int `json:"statuses"`
+}
+
+// Endpoints reports every endpoint, sorted by name
+func (r *Recorder) Endpoints() []EndpointReport {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	reports := make([]EndpointReport, 0, len(r.endpoints))
+	for endpoint, stats := range r.endpoints {
+		samples := append([]time.Duration(nil), stats.samples...)
+		sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+
+		report := EndpointReport{
+			Endpoint:  endpoint,
+			Requests:  stats.requests,
+			Errors:    stats.errors,
+			ErrorRate: float64(stats.errors) / float64(stats.requests),
+			P50MS:     millis(percentile(samples, 50)),
+			P95MS:     millis(percentile(samples, 95)),
+			P99MS:     millis(percentile(samples, 99)),
+			MaxMS:     millis(stats.max),
+			Statuses:  make(map[string]int, len(stats.statuses)),
+		}
+		for status, n := range stats.statuses {
+			report.Statuses[strconv.Itoa(status)] = n
+		}
+		reports = append(reports, report)
+	}
+	sort.Slice(reports, func(i, j int) bool { return reports[i].Endpoint < reports[j].Endpoint })
+	return reports
+}
+
+// percentile returns the nearest-rank percentile p of sorted samples
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (p*len(sorted) + 99) / 100
+	return sorted[max(rank, 1)-1]
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// Report is the outcome of a run
+type Report struct {
+	Scenario  string    `json:"scenario"`
+	StartedAt time.Time `json:"started_at"`
+	Duration  Duration  `json:"duration"`
+	Devices   int       `json:"devices"`
+	// Enrolled counts the devices that enrolled in the device API, and
+	// OsqueryEnrolled those that enrolled as osquery hosts
+	Enrolled        int64            `json:"enrolled"`
+	OsqueryEnrolled int64            `json:"osquery_enrolled"`
+	Counters        map[string]int64 `json:"counters"`
+	Endpoints       []EndpointReport `json:"endpoints"`
+}
+
+// WriteText writes the report as a table
+func (r *Report) WriteText(w io.Writer) error {
+	fmt.Fprintf(w, "Scenario %s: %d devices for %s, %d enrolled, %d osquery hosts\n",
+		r.Scenario, r.Devices, time.Duration(r.Duration).Round(time.Second), r.Enrolled, r.OsqueryEnrolled)
+	names := make([]string, 0, len(r.Counters))
+	for name := range r.Counters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %s: %d\n", name, r.Counters[name])
+	}
+	fmt.Fprintln(w)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "ENDPOINT\tREQUESTS\tERRORS\tERROR %\tP50 MS\tP95 MS\tP99 MS\tMAX MS\t")
+	for _, e := range r.Endpoints {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.2f\t%.1f\t%.1f\t%.1f\t%.1f\t\n",
+			e.Endpoint, e.Requests, e.Errors, e.ErrorRate*100, e.P50MS, e.P95MS, e.P99MS, e.MaxMS)
+	}
+	return tw.Flush()
+}
+
+type endpointKey struct{}
+
+// withEndpoint names the endpoint requests made with ctx are recorded
+// under, such as "POST /api/v1/device/commands/{id}/ack", so that requests
+// to the same route with other IDs are counted together
+func withEndpoint(ctx context.Context, endpoint string) context.Context {
+	return context.WithValue(ctx, endpointKey{}, endpoint)
+}
+
+// recordingTransport records the latency of every request, up to its
+// response headers, and its status
+type recordingTransport struct {
+	next     http.RoundTripper
+	recorder *Recorder
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	endpoint, _ := req.Context().Value(endpointKey{}).(string)
+	if endpoint == "" {
+		endpoint = req.Method + " " + req.URL.Path
+	}
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	latency := time.Since(start)
+	// A run ending cancels the requests in flight; those say nothing about
+	// the server
+	if err != nil && req.Context().Err() != nil {
+		return resp, err
+	}
+	status := 0
+	if err == nil {
+		status = resp.StatusCode
+	}
+	t.recorder.Record(endpoint, latency, status)
+	return resp, err
+}
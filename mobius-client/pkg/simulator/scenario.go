@@ -0,0 +1,289 @@
+package simulator
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/ghodss/yaml"
+)
+
+// validPlatforms are the platforms devices enroll with
+var validPlatforms = map[string]bool{
+	"windows": true, "macos": true, "linux": true, "ios": true, "android": true,
+}
+
+// Scenario describes a simulated fleet: how many devices, which platforms,
+// and how they behave. Scenarios are written in YAML; ${VAR} references
+// are replaced with environment variables, so that secrets stay out of the
+// file.
+type Scenario struct {
+	Name      string `json:"name"`
+	ServerURL string `json:"server_url"`
+	// Devices is the size of the fleet
+	Devices int `json:"devices"`
+	// Duration is how long the run lasts, after the ramp up
+	Duration Duration `json:"duration"`
+	// RampUp spreads the start of the devices over this time
+	RampUp Duration `json:"ramp_up"`
+	// Seed makes the run repeatable; zero picks a random one
+	Seed uint64 `json:"seed"`
+	// Platforms weighs the platforms of the devices, such as
+	// {linux: 3, windows: 1}
+	Platforms map[string]float64 `json:"platforms"`
+
+	Enrollment   EnrollmentScenario `json:"enrollment"`
+	Checkin      CheckinScenario    `json:"checkin"`
+	Inventory    InventoryScenario  `json:"inventory"`
+	Commands     CommandScenario    `json:"commands"`
+	SyncInterval Duration           `json:"sync_interval"`
+	Failures     FailureScenario    `json:"failures"`
+	Offline      OfflineScenario    `json:"offline"`
+	Osquery      OsqueryScenario    `json:"osquery"`
+}
+
+// EnrollmentScenario is how devices enroll in the device API: through
+// POST /api/v1/devices with a user token, or POST /api/v1/device/enroll
+// with a secret
+type EnrollmentScenario struct {
+	Token  string `json:"token"`
+	Secret string `json:"secret"`
+}
+
+// CheckinScenario is how often devices check in
+type CheckinScenario struct {
+	Interval Duration `json:"interval"`
+	// Jitter varies every interval by up to this fraction either way,
+	// for all the intervals of a device
+	Jitter float64 `json:"jitter"`
+}
+
+// InventoryScenario is how the inventory of devices changes
+type InventoryScenario struct {
+	// Churn is the probability that a check-in reports changed inventory,
+	// such as an OS update or less free disk space
+	Churn float64 `json:"churn"`
+}
+
+// CommandScenario is how devices answer commands
+type CommandScenario struct {
+	PollInterval Duration `json:"poll_interval"`
+	// Latency is the time between acknowledging a command and reporting its
+	// result; live queries are answered after the same latency
+	Latency DurationRange `json:"latency"`
+}
+
+// FailureScenario are the probabilities with which devices report failures
+type FailureScenario struct {
+	Command   float64 `json:"command"`
+	Policy    float64 `json:"policy"`
+	LiveQuery float64 `json:"live_query"`
+}
+
+// OfflineScenario is how often devices go offline
+type OfflineScenario struct {
+	// Rate is the probability that a device goes offline at a check-in
+	Rate     float64       `json:"rate"`
+	Duration DurationRange `json:"duration"`
+}
+
+// OsqueryScenario is the share of devices that also run osquery against
+// the legacy /api/osquery endpoints, and how they do
+type OsqueryScenario struct {
+	// Fraction of the devices running osquery, from 0 to 1
+	Fraction float64 `json:"fraction"`
+	// ServerURL of the osquery endpoints, if another server than the
+	// scenario's serves them
+	ServerURL    string `json:"server_url"`
+	EnrollSecret string `json:"enroll_secret"`
+
+	ConfigInterval      Duration `json:"config_interval"`
+	DistributedInterval Duration `json:"distributed_interval"`
+	LogInterval         Duration `json:"log_interval"`
+	// ResultRows is the number of rows of query results and result logs
+	ResultRows IntRange `json:"result_rows"`
+	// RowBytes is the size of every row
+	RowBytes int `json:"row_bytes"`
+}
+
+// DurationRange is a range of durations, picked from uniformly
+type DurationRange struct {
+	Min Duration `json:"min"`
+	Max Duration `json:"max"`
+}
+
+// IntRange is a range of integers, picked from uniformly
+type IntRange struct {
+	Min int `json:"min"`
+	Max int `json:"max"`
+}
+
+// Duration is a time.Duration written as a string, such as "30s"
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"30s\": %s", data)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// LoadScenario reads a scenario file and applies the defaults of the
+// settings it leaves out
+func LoadScenario(path string) (*Scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	jsonData, err := yaml.YAMLToJSON([]byte(os.ExpandEnv(string(data))))
+	if err != nil {
+		return nil, fmt.Errorf("parse scenario %s: %w", path, err)
+	}
+
+	var s Scenario
+	dec := json.NewDecoder(bytes.NewReader(jsonData))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&s); err != nil {
+		return nil, fmt.Errorf("parse scenario %s: %w", path, err)
+	}
+	s.setDefaults()
+	return &s, nil
+}
+
+func (s *Scenario) setDefaults() {
+	if s.Name == "" {
+		s.Name = "unnamed"
+	}
+	if s.Devices == 0 {
+		s.Devices = 10
+	}
+	if s.Duration == 0 {
+		s.Duration = Duration(10 * time.Minute)
+	}
+	if len(s.Platforms) == 0 {
+		s.Platforms = map[string]float64{"linux": 1}
+	}
+	if s.Checkin.Interval == 0 {
+		s.Checkin.Interval = Duration(5 * time.Minute)
+	}
+	if s.Commands.PollInterval == 0 {
+		s.Commands.PollInterval = Duration(30 * time.Second)
+	}
+	if s.SyncInterval == 0 {
+		s.SyncInterval = Duration(15 * time.Minute)
+	}
+	if s.Osquery.ConfigInterval == 0 {
+		s.Osquery.ConfigInterval = Duration(time.Minute)
+	}
+	if s.Osquery.DistributedInterval == 0 {
+		s.Osquery.DistributedInterval = Duration(10 * time.Second)
+	}
+	if s.Osquery.LogInterval == 0 {
+		s.Osquery.LogInterval = Duration(time.Minute)
+	}
+	if s.Osquery.ResultRows == (IntRange{}) {
+		s.Osquery.ResultRows = IntRange{Min: 1, Max: 10}
+	}
+	if s.Osquery.RowBytes == 0 {
+		s.Osquery.RowBytes = 256
+	}
+}
+
+// Validate checks that a scenario can run
+func (s *Scenario) Validate() error {
+	var errs []error
+	if s.ServerURL == "" {
+		errs = append(errs, errors.New("server_url is required"))
+	}
+	if s.Devices < 1 {
+		errs = append(errs, errors.New("devices must be at least 1"))
+	}
+	if s.Enrollment.Token == "" && s.Enrollment.Secret == "" {
+		errs = append(errs, errors.New("enrollment needs a token or a secret"))
+	}
+	total := 0.0
+	for platform, weight := range s.Platforms {
+		total += weight
+		if !validPlatforms[platform] {
+			errs = append(errs, fmt.Errorf("platforms: unknown platform %q", platform))
+		}
+		if weight < 0 {
+			errs = append(errs, fmt.Errorf("platforms: weight of %s is negative", platform))
+		}
+	}
+	if total <= 0 {
+		errs = append(errs, errors.New("platforms: weights must add up to more than 0"))
+	}
+	for name, p := range map[string]float64{
+		"checkin.jitter":      s.Checkin.Jitter,
+		"inventory.churn":     s.Inventory.Churn,
+		"failures.command":    s.Failures.Command,
+		"failures.policy":     s.Failures.Policy,
+		"failures.live_query": s.Failures.LiveQuery,
+		"offline.rate":        s.Offline.Rate,
+		"osquery.fraction":    s.Osquery.Fraction,
+	} {
+		if p < 0 || p > 1 {
+			errs = append(errs, fmt.Errorf("%s must be between 0 and 1", name))
+		}
+	}
+	if s.Commands.Latency.Max < s.Commands.Latency.Min {
+		errs = append(errs, errors.New("commands.latency: max is below min"))
+	}
+	if s.Offline.Duration.Max < s.Offline.Duration.Min {
+		errs = append(errs, errors.New("offline.duration: max is below min"))
+	}
+	if s.Osquery.ResultRows.Min < 0 || s.Osquery.ResultRows.Max < s.Osquery.ResultRows.Min {
+		errs = append(errs, errors.New("osquery.result_rows: expected 0 <= min <= max"))
+	}
+	if s.Osquery.Fraction > 0 && s.Osquery.EnrollSecret == "" {
+		errs = append(errs, errors.New("osquery.enroll_secret is required when osquery.fraction is set"))
+	}
+	return errors.Join(errs...)
+}
+
+// platformPicker picks platforms by their weight
+type platformPicker struct {
+	names   []string
+	weights []float64
+	total   float64
+}
+
+func newPlatformPicker(platforms map[string]float64) *platformPicker {
+	p := &platformPicker{}
+	for name := range platforms {
+		p.names = append(p.names, name)
+	}
+	// Sorted, so that a seed picks the same platforms every run
+	sort.Strings(p.names)
+	for _, name := range p.names {
+		p.weights = append(p.weights, platforms[name])
+		p.total += platforms[name]
+	}
+	return p
+}
+
+func (p *platformPicker) pick(u float64) string {
+	target := u * p.total
+	for i, weight := range p.weights {
+		if target < weight {
+			return p.names[i]
+		}
+		target -= weight
+	}
+	return p.names[len(p.names)-1]
+}
@@ -0,0 +1,162 @@
+package simulator
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeScenario writes a scenario file and returns its path
+func writeScenario(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "scenario.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return path
+}
+
+func TestLoadScenario(t *testing.T) {
+	t.Setenv("SIMULATOR_TEST_SECRET", "secret-1")
+	s, err := LoadScenario(writeScenario(t, `
+name: test
+server_url: https://mobius.example.com
+devices: 50
+duration: 90s
+platforms: {linux: 3, windows: 1}
+enrollment:
+  secret: ${SIMULATOR_TEST_SECRET}
+checkin:
+  interval: 15s
+  jitter: 0.2
+commands:
+  latency: {min: 100ms, max: 2s}
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := s.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if s.Devices != 50 || time.Duration(s.Duration) != 90*time.Second || s.Enrollment.Secret != "secret-1" {
+		t.Errorf("expected the settings of the file, got %+v", s)
+	}
+	if want := map[string]float64{"linux": 3, "windows": 1}; !reflect.DeepEqual(s.Platforms, want) {
+		t.Errorf("expected platforms %v, got %v", want, s.Platforms)
+	}
+	if time.Duration(s.Checkin.Interval) != 15*time.Second || s.Checkin.Jitter != 0.2 {
+		t.Errorf("expected a check-in every 15s, got %+v", s.Checkin)
+	}
+	if want := (DurationRange{Min: Duration(100 * time.Millisecond), Max: Duration(2 * time.Second)}); s.Commands.Latency != want {
+		t.Errorf("expected latency %+v, got %+v", want, s.Commands.Latency)
+	}
+	// Settings left out get their defaults
+	if time.Duration(s.Commands.PollInterval) != 30*time.Second || time.Duration(s.SyncInterval) != 15*time.Minute {
+		t.Errorf("expected the default intervals, got %v and %v", s.Commands.PollInterval, s.SyncInterval)
+	}
+	if s.Osquery.ResultRows != (IntRange{Min: 1, Max: 10}) || s.Osquery.RowBytes != 256 {
+		t.Errorf("expected the default osquery rows, got %+v", s.Osquery)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		content string
+		err     string
+	}{
+		{"unknown setting", "devices: 1\ncheckin_interval: 10s\n", "unknown field \"checkin_interval\""},
+		{"duration without unit", "duration: 90\n", "duration must be a string"},
+		{"invalid duration", "duration: soon\n", "invalid duration"},
+		{"invalid YAML", "devices: [1\n", "parse scenario"},
+	} {
+		if _, err := LoadScenario(writeScenario(t, tc.content)); err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%s: expected an error containing %q, got %v", tc.name, tc.err, err)
+		}
+	}
+}
+
+func TestValidateScenario(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		modify func(s *Scenario)
+		errs   []string
+	}{
+		{name: "valid", modify: func(s *Scenario) {}},
+		{
+			name:   "missing server and enrollment",
+			modify: func(s *Scenario) { s.ServerURL, s.Enrollment.Secret = "", "" },
+			errs:   []string{"server_url is required", "enrollment needs a token or a secret"},
+		},
+		{
+			name:   "unknown platform",
+			modify: func(s *Scenario) { s.Platforms = map[string]float64{"beos": 1} },
+			errs:   []string{`unknown platform "beos"`},
+		},
+		{
+			name:   "weights of zero",
+			modify: func(s *Scenario) { s.Platforms = map[string]float64{"linux": 0} },
+			errs:   []string{"weights must add up to more than 0"},
+		},
+		{
+			name:   "probability above 1",
+			modify: func(s *Scenario) { s.Offline.Rate = 1.5 },
+			errs:   []string{"offline.rate must be between 0 and 1"},
+		},
+		{
+			name: "inverted ranges",
+			modify: func(s *Scenario) {
+				s.Commands.Latency = DurationRange{Min: Duration(time.Second)}
+				s.Osquery.ResultRows = IntRange{Min: 5, Max: 1}
+			},
+			errs: []string{"commands.latency: max is below min", "osquery.result_rows"},
+		},
+		{
+			name:   "osquery without a secret",
+			modify: func(s *Scenario) { s.Osquery.Fraction = 0.5 },
+			errs:   []string{"osquery.enroll_secret is required"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &Scenario{ServerURL: "https://mobius.example.com", Enrollment: EnrollmentScenario{Secret: "secret-1"}}
+			s.setDefaults()
+			tc.modify(s)
+
+			err := s.Validate()
+			if len(tc.errs) == 0 {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected errors %q", tc.errs)
+			}
+			for _, want := range tc.errs {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("expected an error containing %q, got %v", want, err)
+				}
+			}
+		})
+	}
+}
+
+func TestPlatformPicker(t *testing.T) {
+	picker := newPlatformPicker(map[string]float64{"windows": 1, "linux": 3})
+	for _, tc := range []struct {
+		u    float64
+		want string
+	}{
+		{0, "linux"},
+		{0.74, "linux"},
+		{0.75, "windows"},
+		{0.99, "windows"},
+	} {
+		if got := picker.pick(tc.u); got != tc.want {
+			t.Errorf("expected %v to pick %s, got %s", tc.u, tc.want, got)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+// Package simulator simulates a fleet of devices against a Mobius server to
+// measure its latency and errors under a realistic load. Devices are
+// described by a Scenario; each enrolls, checks in, syncs its policies and
+// applications and answers commands and live queries over the device API,
+// and a share of them also run osquery against the legacy /api/osquery
+// endpoints.
+package simulator
+
+import (
+	"context"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Simulator runs a scenario
+type Simulator struct {
+	scenario   *Scenario
+	recorder   *Recorder
+	httpClient *http.Client
+	log        *slog.Logger
+	platforms  *platformPicker
+	seed       uint64
+	// padding fills the rows of osquery results up to their size
+	padding string
+
+	enrolled        atomic.Int64
+	osqueryEnrolled atomic.Int64
+	countersMu      sync.Mutex
+	counters        map[string]int64
+}
+
+// New creates a simulator of a valid scenario
+func New(scenario *Scenario, logger *slog.Logger) (*Simulator, error) {
+	if err := scenario.Validate(); err != nil {
+		return nil, err
+	}
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	recorder := NewRecorder()
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// Every device keeps a connection, as real ones would
+	transport.MaxIdleConns = 0
+	transport.MaxIdleConnsPerHost = scenario.Devices * 2
+
+	seed := scenario.Seed
+	if seed == 0 {
+		seed = rand.Uint64()
+	}
+	return &Simulator{
+		scenario: scenario,
+		recorder: recorder,
+		httpClient: &http.Client{
+			Transport: &recordingTransport{next: transport, recorder: recorder},
+			Timeout:   30 * time.Second,
+		},
+		log:       logger,
+		platforms: newPlatformPicker(scenario.Platforms),
+		seed:      seed,
+		padding:   strings.Repeat("x", scenario.Osquery.RowBytes),
+		counters:  make(map[string]int64),
+	}, nil
+}
+
+// Run starts the devices over the ramp up, runs them for the duration of
+// the scenario or until ctx is done, and reports the requests they made
+func (s *Simulator) Run(ctx context.Context) *Report {
+	started := time.Now()
+	rampUp := time.Duration(s.scenario.RampUp)
+	ctx, cancel := context.WithTimeout(ctx, rampUp+time.Duration(s.scenario.Duration))
+	defer cancel()
+
+	s.log.Info("Starting simulation", "scenario", s.scenario.Name, "devices", s.scenario.Devices,
+		"server_url", s.scenario.ServerURL, "seed", s.seed)
+
+	var wg sync.WaitGroup
+	for i := 0; i < s.scenario.Devices; i++ {
+		d := s.newDevice(i)
+		delay := rampUp * time.Duration(i) / time.Duration(s.scenario.Devices)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if sleep(ctx, delay) == nil {
+				d.run(ctx)
+			}
+		}()
+	}
+	wg.Wait()
+
+	s.countersMu.Lock()
+	defer s.countersMu.Unlock()
+	counters := make(map[string]int64, len(s.counters))
+	for name, n := range s.counters {
+		counters[name] = n
+	}
+	return &Report{
+		Scenario:        s.scenario.Name,
+		StartedAt:       started.UTC(),
+		Duration:        Duration(time.Since(started)),
+		Devices:         s.scenario.Devices,
+		Enrolled:        s.enrolled.Load(),
+		OsqueryEnrolled: s.osqueryEnrolled.Load(),
+		Counters:        counters,
+		Endpoints:       s.recorder.Endpoints(),
+	}
+}
+
+// count adds to a counter of the report, such as "commands_completed"
+func (s *Simulator) count(name string) {
+	s.countersMu.Lock()
+	defer s.countersMu.Unlock()
+	s.counters[name]++
+}
+
+// sleep waits for d or until ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
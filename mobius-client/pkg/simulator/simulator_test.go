@@ -0,0 +1,200 @@
+package simulator
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/notawar/mobius/shared/pkg/apiclient"
+)
+
+// deviceServer serves the device API to simulated devices: every device
+// gets one command and one live query
+type deviceServer struct {
+	mu sync.Mutex
+	// devices are the enrolled devices, by token
+	devices   map[string]string
+	hostnames map[string]bool
+	acked     map[string]bool
+	// resultKeys are the idempotency keys of the command results
+	resultKeys map[string]string
+	answered   map[string]bool
+	checkins   int
+}
+
+func newDeviceServer() *deviceServer {
+	return &deviceServer{
+		devices:    make(map[string]string),
+		hostnames:  make(map[string]bool),
+		acked:      make(map[string]bool),
+		resultKeys: make(map[string]string),
+		answered:   make(map[string]bool),
+	}
+}
+
+func (s *deviceServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := strings.TrimPrefix(r.URL.Path, apiclient.BasePath)
+	if path == "/device/enroll" {
+		var enrollment apiclient.DeviceEnrollment
+		if err := json.NewDecoder(r.Body).Decode(&enrollment); err != nil ||
+			enrollment.EnrollmentSecret == nil || *enrollment.EnrollmentSecret != "secret-1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		s.devices["token-"+enrollment.UUID] = enrollment.UUID
+		s.hostnames[enrollment.Hostname] = true
+		writeJSON(w, apiclient.DeviceEnrollResponse{DeviceToken: "token-" + enrollment.UUID})
+		return
+	}
+
+	deviceID, ok := s.devices[strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")]
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	commandID, campaignID := "command-"+deviceID, "campaign-"+deviceID
+
+	switch r.Method + " " + path {
+	case "GET /device/policies":
+		writeJSON(w, apiclient.DeviceListPoliciesResponse{Policies: []apiclient.Policy{{ID: "policy-1"}}})
+	case "GET /device/applications":
+		writeJSON(w, apiclient.DeviceListApplicationsResponse{})
+	case "POST /device/checkin":
+		s.checkins++
+		var resp apiclient.DeviceCheckinResponse
+		if !s.answered[campaignID] {
+			resp.Queries = []apiclient.DeviceLiveQuery{{CampaignID: campaignID, Query: "SELECT * FROM processes"}}
+		}
+		writeJSON(w, resp)
+	case "GET /device/commands":
+		var resp apiclient.DeviceFetchCommandsResponse
+		if !s.acked[commandID] {
+			resp.Commands = []apiclient.DeviceCommand{{ID: commandID, Command: "lock"}}
+		}
+		writeJSON(w, resp)
+	case "POST /device/commands/" + commandID + "/ack":
+		s.acked[commandID] = true
+		writeJSON(w, apiclient.DeviceCommand{ID: commandID})
+	case "POST /device/commands/" + commandID + "/result":
+		s.resultKeys[commandID] = r.Header.Get("Idempotency-Key")
+		writeJSON(w, apiclient.DeviceCommand{ID: commandID})
+	case "POST /device/queries/" + campaignID + "/results":
+		s.answered[campaignID] = true
+		writeJSON(w, map[string]string{})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v) //nolint:errcheck
+}
+
+func TestSimulation(t *testing.T) {
+	server := newDeviceServer()
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	scenario := &Scenario{
+		Name:       "test",
+		ServerURL:  ts.URL,
+		Devices:    4,
+		Duration:   Duration(time.Second),
+		Seed:       1,
+		Platforms:  map[string]float64{"linux": 1, "windows": 1},
+		Enrollment: EnrollmentScenario{Secret: "secret-1"},
+		Checkin:    CheckinScenario{Interval: Duration(100 * time.Millisecond), Jitter: 0.1},
+		Commands: CommandScenario{
+			PollInterval: Duration(100 * time.Millisecond),
+			Latency:      DurationRange{Min: Duration(10 * time.Millisecond), Max: Duration(50 * time.Millisecond)},
+		},
+		SyncInterval: Duration(200 * time.Millisecond),
+	}
+	scenario.setDefaults()
+	sim, err := New(scenario, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	report := sim.Run(context.Background())
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if report.Enrolled != 4 || len(server.devices) != 4 || len(server.hostnames) != 4 {
+		t.Fatalf("expected 4 devices enrolled, got %d, %d on the server", report.Enrolled, len(server.devices))
+	}
+	if got := report.Counters["checkins"]; got == 0 || got != int64(server.checkins) {
+		t.Errorf("expected %d check-ins counted, got %d", server.checkins, got)
+	}
+	if got := report.Counters["commands_completed"]; got != 4 {
+		t.Errorf("expected 4 commands completed, got %d", got)
+	}
+	if got := report.Counters["live_queries_answered"]; got != 4 {
+		t.Errorf("expected 4 live queries answered, got %d", got)
+	}
+	for commandID, key := range server.resultKeys {
+		if key != "command-result-"+commandID {
+			t.Errorf("expected the result of %s reported with its key, got %q", commandID, key)
+		}
+	}
+
+	// Requests are reported by route, whatever their IDs
+	endpoints := make(map[string]EndpointReport)
+	for _, e := range report.Endpoints {
+		endpoints[e.Endpoint] = e
+	}
+	for _, endpoint := range []string{epDeviceEnroll, epCheckin, epPolicies, epApplications, epCommands, epAckCommand, epCommandResult, epQueryResult} {
+		e, ok := endpoints[endpoint]
+		if !ok {
+			t.Errorf("expected requests to %s", endpoint)
+			continue
+		}
+		if e.Errors != 0 {
+			t.Errorf("expected no errors from %s, got %d", endpoint, e.Errors)
+		}
+	}
+	if len(endpoints) != 8 {
+		t.Errorf("expected 8 endpoints, got %d", len(endpoints))
+	}
+	if e := endpoints[epAckCommand]; e.Requests != 4 || e.Statuses["200"] != 4 {
+		t.Errorf("expected 4 acknowledgements, got %+v", e)
+	}
+}
+
+func TestSimulationSeed(t *testing.T) {
+	scenario := &Scenario{ServerURL: "https://mobius.example.com", Seed: 42, Enrollment: EnrollmentScenario{Secret: "secret-1"}}
+	scenario.setDefaults()
+	scenario.Platforms = map[string]float64{"linux": 1, "macos": 1, "windows": 1}
+
+	devices := func() []*device {
+		sim, err := New(scenario, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var devices []*device
+		for i := 0; i < 5; i++ {
+			devices = append(devices, sim.newDevice(i))
+		}
+		return devices
+	}
+	first, second := devices(), devices()
+	for i := range first {
+		if first[i].uuid != second[i].uuid || first[i].hostname != second[i].hostname || first[i].osVersion != second[i].osVersion {
+			t.Errorf("expected device %d to be the same with the same seed, got %s and %s", i, first[i].hostname, second[i].hostname)
+		}
+		if i > 0 && first[i].uuid == first[i-1].uuid {
+			t.Errorf("expected devices %d and %d to have their own UUIDs", i-1, i)
+		}
+	}
+}
@@ -1,47 +1,116 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/notawar/mobius/mobius-cocoon/pkg/storefront"
 )
 
 func main() {
-	fmt.Println("🥥 Mobius Cocoon - Storefront (Development)")
-	fmt.Println("This is a placeholder for the future storefront functionality")
-
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8082"
-	}
-
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "text/html")
-		fmt.Fprintf(w, `
-<!DOCTYPE html>
-<html>
-<head>
-    <title>Mobius Cocoon - Storefront</title>
-    <style>
-        body { font-family: Arial, sans-serif; margin: 50px; }
-        .container { max-width: 800px; margin: 0 auto; text-align: center; }
-        .logo { font-size: 48px; margin-bottom: 20px; }
-        .message { font-size: 18px; color: #666; }
-    </style>
-</head>
-<body>
-    <div class="container">
-        <div class="logo">🥥 Mobius Cocoon</div>
-        <h1>Mobius Storefront</h1>
-        <p class="message">Future home of the Mobius application marketplace</p>
-        <p class="message">Coming soon...</p>
-    </div>
-</body>
-</html>
-		`)
+	addr := flag.String("addr", ":"+envOrDefault("PORT", "8082"), "Address to listen on")
+	serverURL := flag.String("server-url", os.Getenv("MOBIUS_SERVER_URL"), "URL of the Mobius server")
+	caFile := flag.String("ca-file", os.Getenv("MOBIUS_CA_FILE"), "PEM file of the CAs trusted for the server certificate, instead of the system ones")
+	sessionTTL := flag.Duration("session-ttl", envDurationOrDefault("COCOON_SESSION_TTL", storefront.DefaultSessionTTL), "How long a sign-in lasts")
+	secureCookies := flag.Bool("secure-cookies", os.Getenv("COCOON_SECURE_COOKIES") == "true", "Mark the session cookie Secure, when the storefront is served over HTTPS")
+	debug := flag.Bool("debug", os.Getenv("COCOON_DEBUG") == "true", "Log debug messages")
+	flag.Parse()
+
+	level := slog.LevelInfo
+	if *debug {
+		level = slog.LevelDebug
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+
+	if *serverURL == "" {
+		logger.Error("-server-url or MOBIUS_SERVER_URL is required")
+		os.Exit(2)
+	}
+	httpClient, err := newHTTPClient(*caFile)
+	if err != nil {
+		logger.Error("Failed to load CA file", "error", err)
+		os.Exit(1)
+	}
+
+	store, err := storefront.New(storefront.Config{
+		ServerURL:     *serverURL,
+		HTTPClient:    httpClient,
+		SessionTTL:    *sessionTTL,
+		SecureCookies: *secureCookies,
+		Logger:        logger,
 	})
+	if err != nil {
+		logger.Error("Failed to create storefront", "error", err)
+		os.Exit(1)
+	}
+
+	srv := &http.Server{
+		Addr:              *addr,
+		Handler:           store.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		WriteTimeout:      60 * time.Second,
+		IdleTimeout:       120 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx) //nolint:errcheck
+	}()
 
-	fmt.Printf("🚀 Mobius Cocoon starting on port %s\n", port)
-	log.Fatal(http.ListenAndServe(":"+port, nil))
+	logger.Info("Starting Mobius Cocoon", "addr", *addr, "server_url", *serverURL)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.Error("Cocoon stopped", "error", err)
+		os.Exit(1)
+	}
+}
+
+// newHTTPClient creates the HTTP client of the requests to the server,
+// trusting the CAs of caFile if set
+func newHTTPClient(caFile string) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in %s", caFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+	return &http.Client{Transport: transport, Timeout: 30 * time.Second}, nil
+}
+
+// envOrDefault returns the value of the environment variable key, or def if
+// unset
+func envOrDefault(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// envDurationOrDefault returns the duration in the environment variable
+// key, or def if unset or not a duration
+func envDurationOrDefault(key string, def time.Duration) time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(key)); err == nil {
+		return d
+	}
+	return def
 }
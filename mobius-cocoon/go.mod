@@ -2,4 +2,6 @@ module github.com/notawar/mobius/mobius-cocoon
 
 go 1.24.4
 
+require github.com/notawar/mobius/shared v0.0.0
+
 replace github.com/notawar/mobius/shared => ../shared
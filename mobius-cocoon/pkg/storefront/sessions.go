@@ -0,0 +1,123 @@
+package storefront
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"sync"
+	"time"
+)
+
+// session is a device user signed in to the storefront. The device token
+// never leaves the server: the browser only holds the session ID.
+type session struct {
+	id          string
+	deviceToken string
+	deviceID    string
+	// csrfToken must be sent with every form posted in the session
+	csrfToken string
+	// flash is shown once, on the next page rendered
+	flash     *flash
+	expiresAt time.Time
+}
+
+// flash is a message shown after an action redirects
+type flash struct {
+	Message string
+	Error   bool
+}
+
+// validCSRF reports whether token is the CSRF token of the session
+func (s *session) validCSRF(token string) bool {
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.csrfToken)) == 1
+}
+
+// sessionStore keeps the sessions in memory, so they end when the storefront
+// restarts
+type sessionStore struct {
+	ttl      time.Duration
+	sessions map[string]*session
+	mu       sync.Mutex
+}
+
+func newSessionStore(ttl time.Duration) *sessionStore {
+	return &sessionStore{ttl: ttl, sessions: make(map[string]*session)}
+}
+
+// create starts a session for a device token
+func (s *sessionStore) create(deviceToken, deviceID string) (*session, error) {
+	id, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	csrf, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for sid, sess := range s.sessions {
+		if !now.Before(sess.expiresAt) {
+			delete(s.sessions, sid)
+		}
+	}
+	sess := &session{
+		id:          id,
+		deviceToken: deviceToken,
+		deviceID:    deviceID,
+		csrfToken:   csrf,
+		expiresAt:   now.Add(s.ttl),
+	}
+	s.sessions[id] = sess
+	return sess, nil
+}
+
+// get returns an unexpired session
+func (s *sessionStore) get(id string) *session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.sessions[id]
+	if !ok {
+		return nil
+	}
+	if !time.Now().Before(sess.expiresAt) {
+		delete(s.sessions, id)
+		return nil
+	}
+	return sess
+}
+
+// setFlash records the message of the next page of a session
+func (s *sessionStore) setFlash(sess *session, f *flash) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess.flash = f
+}
+
+// takeFlash returns and clears the message of a session
+func (s *sessionStore) takeFlash(sess *session) *flash {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f := sess.flash
+	sess.flash = nil
+	return f
+}
+
+func (s *sessionStore) delete(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, id)
+}
+
+// randomToken returns 256 random bits, URL-safe encoded
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,460 @@
+// Package storefront serves the self-service catalog of a device to its
+// user. The user signs in with the device token of the Mobius agent and
+// sees the applications admins published to the groups of the device, and
+// can install or uninstall them, or ask for approval of restricted ones,
+// through the /api/v1/device/catalog API of the server.
+package storefront
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"html/template"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/notawar/mobius/shared/pkg/apiclient"
+)
+
+// DefaultSessionTTL is how long a sign-in lasts
+const DefaultSessionTTL = 8 * time.Hour
+
+// sessionCookie holds the session ID
+const sessionCookie = "cocoon_session"
+
+// maxFormBytes bounds the forms the storefront accepts
+const maxFormBytes = 64 << 10
+
+// maxReason bounds the reason of a request, as the server does
+const maxReason = 1000
+
+// refreshInterval is how often a catalog page with installs in progress
+// reloads
+const refreshInterval = 10
+
+//go:embed templates static
+var assets embed.FS
+
+// Config configures a storefront
+type Config struct {
+	// ServerURL is the URL of the Mobius server
+	ServerURL string
+	// HTTPClient sends the requests to the server
+	HTTPClient *http.Client
+	// SessionTTL is how long a sign-in lasts; DefaultSessionTTL if zero
+	SessionTTL time.Duration
+	// SecureCookies marks the session cookie Secure, for storefronts
+	// served over HTTPS
+	SecureCookies bool
+	Logger        *slog.Logger
+}
+
+// Storefront serves the catalog
+type Storefront struct {
+	cfg       Config
+	log       *slog.Logger
+	sessions  *sessionStore
+	templates map[string]*template.Template
+}
+
+// New creates a storefront of a server
+func New(cfg Config) (*Storefront, error) {
+	if _, err := apiclient.New(cfg.ServerURL); err != nil {
+		return nil, err
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: 30 * time.Second}
+	}
+	if cfg.SessionTTL <= 0 {
+		cfg.SessionTTL = DefaultSessionTTL
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = slog.Default()
+	}
+
+	templates := make(map[string]*template.Template)
+	for _, page := range []string{"login.html", "catalog.html", "requests.html"} {
+		t, err := template.New(page).Funcs(templateFuncs).ParseFS(assets, "templates/layout.html", "templates/"+page)
+		if err != nil {
+			return nil, err
+		}
+		templates[page] = t
+	}
+
+	return &Storefront{
+		cfg:       cfg,
+		log:       cfg.Logger,
+		sessions:  newSessionStore(cfg.SessionTTL),
+		templates: templates,
+	}, nil
+}
+
+// Handler returns the HTTP handler of the storefront
+func (s *Storefront) Handler() http.Handler {
+	static, _ := fs.Sub(assets, "static")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", s.handleHealth)
+	mux.Handle("GET /static/", http.StripPrefix("/static/", http.FileServerFS(static)))
+	mux.HandleFunc("GET /login", s.handleLoginPage)
+	mux.HandleFunc("POST /login", s.handleLogin)
+	mux.HandleFunc("POST /logout", s.withSession(s.handleLogout))
+	mux.HandleFunc("GET /{$}", s.withSession(s.handleCatalog))
+	mux.HandleFunc("GET /requests", s.withSession(s.handleRequests))
+	mux.HandleFunc("POST /apps/{appId}/install", s.withSession(s.handleInstall))
+	mux.HandleFunc("POST /apps/{appId}/uninstall", s.withSession(s.handleUninstall))
+	mux.HandleFunc("POST /apps/{appId}/request", s.withSession(s.handleRequest))
+	return securityHeaders(mux)
+}
+
+// securityHeaders keeps pages from being framed or loading anything but the
+// storefront's own assets
+func securityHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Set("Content-Security-Policy", "default-src 'self'; frame-ancestors 'none'; form-action 'self'")
+		h.Set("X-Frame-Options", "DENY")
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("Referrer-Policy", "no-referrer")
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Storefront) handleHealth(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("ok\n")) //nolint:errcheck
+}
+
+// withSession runs h for signed-in users, checking the CSRF token of
+// posted forms, and sends the others to the sign-in page
+func (s *Storefront) withSession(h func(http.ResponseWriter, *http.Request, *session)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var sess *session
+		if cookie, err := r.Cookie(sessionCookie); err == nil {
+			sess = s.sessions.get(cookie.Value)
+		}
+		if sess == nil {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+
+		if r.Method == http.MethodPost {
+			r.Body = http.MaxBytesReader(w, r.Body, maxFormBytes)
+			if err := r.ParseForm(); err != nil {
+				http.Error(w, "Invalid form", http.StatusBadRequest)
+				return
+			}
+			if !sess.validCSRF(r.PostFormValue("csrf_token")) {
+				http.Error(w, "Invalid or missing CSRF token", http.StatusForbidden)
+				return
+			}
+		}
+		h(w, r, sess)
+	}
+}
+
+// client returns a client of the device API authenticated as the device of
+// a session
+func (s *Storefront) client(sess *session) *apiclient.Client {
+	client, _ := apiclient.New(s.cfg.ServerURL,
+		apiclient.WithHTTPClient(s.cfg.HTTPClient),
+		apiclient.WithToken(sess.deviceToken),
+		apiclient.WithUserAgent("mobius-cocoon"))
+	return client
+}
+
+func (s *Storefront) handleLoginPage(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(sessionCookie); err == nil && s.sessions.get(cookie.Value) != nil {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	s.render(w, http.StatusOK, "login.html", pageData{})
+}
+
+// handleLogin signs a device user in with the device token, which must be
+// accepted by the catalog API of the server
+func (s *Storefront) handleLogin(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxFormBytes)
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form", http.StatusBadRequest)
+		return
+	}
+	token := strings.TrimSpace(r.PostFormValue("device_token"))
+	if token == "" {
+		s.render(w, http.StatusBadRequest, "login.html", pageData{Flash: &flash{Message: "Enter the device token of this device.", Error: true}})
+		return
+	}
+
+	client, _ := apiclient.New(s.cfg.ServerURL,
+		apiclient.WithHTTPClient(s.cfg.HTTPClient),
+		apiclient.WithToken(token),
+		apiclient.WithUserAgent("mobius-cocoon"))
+	catalog, err := client.DeviceGetCatalog(r.Context())
+	if err != nil {
+		status, message := http.StatusBadGateway, "The Mobius server could not be reached. Try again later."
+		switch apiclient.StatusCode(err) {
+		case http.StatusUnauthorized:
+			status, message = http.StatusUnauthorized, "This device token was not accepted."
+		case http.StatusForbidden:
+			status, message = http.StatusForbidden, "The self-service catalog is not available on this server."
+		case http.StatusTooManyRequests:
+			status, message = http.StatusTooManyRequests, "Too many attempts. Try again in a minute."
+		}
+		s.log.Info("Sign-in rejected", "error", err)
+		s.render(w, status, "login.html", pageData{Flash: &flash{Message: message, Error: true}})
+		return
+	}
+
+	sess, err := s.sessions.create(token, catalog.DeviceID)
+	if err != nil {
+		s.log.Error("Failed to create session", "error", err)
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+	s.log.Info("Device user signed in", "device_id", catalog.DeviceID)
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    sess.id,
+		Path:     "/",
+		Expires:  sess.expiresAt,
+		HttpOnly: true,
+		Secure:   s.cfg.SecureCookies,
+		SameSite: http.SameSiteStrictMode,
+	})
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+func (s *Storefront) handleLogout(w http.ResponseWriter, r *http.Request, sess *session) {
+	s.signOut(w, sess)
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
+
+// signOut ends a session and clears its cookie
+func (s *Storefront) signOut(w http.ResponseWriter, sess *session) {
+	s.sessions.delete(sess.id)
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   s.cfg.SecureCookies,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// pageData is what the templates render
+type pageData struct {
+	CSRFToken    string
+	DeviceID     string
+	Flash        *flash
+	Applications []apiclient.CatalogApplication
+	Requests     []requestRow
+	// Refresh reloads the page while installs are in progress
+	Refresh int
+}
+
+// requestRow is a request with the name of its application
+type requestRow struct {
+	apiclient.ApplicationRequest
+	ApplicationName string
+}
+
+func (s *Storefront) handleCatalog(w http.ResponseWriter, r *http.Request, sess *session) {
+	catalog, err := s.client(sess).DeviceGetCatalog(r.Context())
+	if err != nil {
+		s.apiFailed(w, r, sess, err)
+		return
+	}
+
+	applications := catalog.Applications
+	sort.SliceStable(applications, func(i, j int) bool {
+		return strings.ToLower(applications[i].Name) < strings.ToLower(applications[j].Name)
+	})
+	data := s.pageData(sess)
+	data.Applications = applications
+	for _, app := range applications {
+		if app.Status == "installing" || app.Status == "uninstalling" {
+			data.Refresh = refreshInterval
+		}
+	}
+	s.render(w, http.StatusOK, "catalog.html", data)
+}
+
+func (s *Storefront) handleRequests(w http.ResponseWriter, r *http.Request, sess *session) {
+	client := s.client(sess)
+	requests, err := client.DeviceListApplicationRequests(r.Context())
+	if err != nil {
+		s.apiFailed(w, r, sess, err)
+		return
+	}
+	catalog, err := client.DeviceGetCatalog(r.Context())
+	if err != nil {
+		s.apiFailed(w, r, sess, err)
+		return
+	}
+
+	names := make(map[string]string, len(catalog.Applications))
+	for _, app := range catalog.Applications {
+		names[app.ID] = app.Name
+	}
+	data := s.pageData(sess)
+	for _, req := range requests.Requests {
+		name := names[req.ApplicationID]
+		if name == "" {
+			name = "Application no longer in the catalog"
+		}
+		data.Requests = append(data.Requests, requestRow{ApplicationRequest: req, ApplicationName: name})
+	}
+	s.render(w, http.StatusOK, "requests.html", data)
+}
+
+func (s *Storefront) handleInstall(w http.ResponseWriter, r *http.Request, sess *session) {
+	s.act(w, r, sess, "Install queued. It starts the next time the agent checks for commands.",
+		func(ctx context.Context, client *apiclient.Client, appID string) error {
+			_, err := client.DeviceInstallCatalogApplication(ctx, appID)
+			return err
+		})
+}
+
+func (s *Storefront) handleUninstall(w http.ResponseWriter, r *http.Request, sess *session) {
+	s.act(w, r, sess, "Uninstall queued. It starts the next time the agent checks for commands.",
+		func(ctx context.Context, client *apiclient.Client, appID string) error {
+			_, err := client.DeviceUninstallCatalogApplication(ctx, appID)
+			return err
+		})
+}
+
+// handleRequest asks admins to approve a restricted application
+func (s *Storefront) handleRequest(w http.ResponseWriter, r *http.Request, sess *session) {
+	reason := strings.TrimSpace(r.PostFormValue("reason"))
+	if len(reason) > maxReason {
+		s.sessions.setFlash(sess, &flash{Message: "The reason is too long.", Error: true})
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	s.act(w, r, sess, "Request sent. The application can be installed once an administrator approves it.",
+		func(ctx context.Context, client *apiclient.Client, appID string) error {
+			body := apiclient.DeviceRequestApplicationRequest{}
+			if reason != "" {
+				body.Reason = &reason
+			}
+			_, err := client.DeviceRequestApplication(ctx, appID, body)
+			return err
+		})
+}
+
+// act runs an action on the application of the request and returns to
+// the catalog, showing done or the error of the server
+func (s *Storefront) act(w http.ResponseWriter, r *http.Request, sess *session, done string,
+	action func(context.Context, *apiclient.Client, string) error) {
+	appID := r.PathValue("appId")
+	err := action(r.Context(), s.client(sess), appID)
+	if apiclient.StatusCode(err) == http.StatusUnauthorized {
+		s.apiFailed(w, r, sess, err)
+		return
+	}
+
+	f := &flash{Message: done}
+	if err != nil {
+		s.log.Info("Catalog action failed", "device_id", sess.deviceID, "app_id", appID, "path", r.URL.Path, "error", err)
+		f = &flash{Message: actionError(err), Error: true}
+	}
+	s.sessions.setFlash(sess, f)
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// actionError is the message shown for an action the server refused
+func actionError(err error) string {
+	var apiErr *apiclient.Error
+	if errors.As(err, &apiErr) && apiErr.Message != "" && apiErr.StatusCode < http.StatusInternalServerError {
+		return apiErr.Message + "."
+	}
+	return "The Mobius server could not complete the request. Try again later."
+}
+
+// apiFailed handles a failed call of a page: a rejected device token, such
+// as after the agent rotated it, ends the session
+func (s *Storefront) apiFailed(w http.ResponseWriter, r *http.Request, sess *session, err error) {
+	if apiclient.StatusCode(err) == http.StatusUnauthorized {
+		s.signOut(w, sess)
+		s.render(w, http.StatusUnauthorized, "login.html", pageData{
+			Flash: &flash{Message: "The device token is no longer valid. Sign in again.", Error: true},
+		})
+		return
+	}
+	s.log.Error("Mobius server request failed", "device_id", sess.deviceID, "path", r.URL.Path, "error", err)
+	data := s.pageData(sess)
+	data.Flash = &flash{Message: actionError(err), Error: true}
+	s.render(w, http.StatusBadGateway, "catalog.html", data)
+}
+
+// pageData returns the data of a page of a session, with its pending
+// message
+func (s *Storefront) pageData(sess *session) pageData {
+	return pageData{
+		CSRFToken: sess.csrfToken,
+		DeviceID:  sess.deviceID,
+		Flash:     s.sessions.takeFlash(sess),
+	}
+}
+
+func (s *Storefront) render(w http.ResponseWriter, status int, page string, data pageData) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := s.templates[page].ExecuteTemplate(w, "layout", data); err != nil {
+		s.log.Error("Failed to render page", "page", page, "error", err)
+	}
+}
+
+// templateFuncs are the helpers of the templates
+var templateFuncs = template.FuncMap{
+	"statusLabel": statusLabel,
+	"canInstall": func(status string) bool {
+		return status == "available" || status == "install_failed"
+	},
+	"canUninstall": func(status string) bool {
+		return status == "installed" || status == "uninstall_failed"
+	},
+	"canRequest": func(status string) bool {
+		return status == "approval_required" || status == "denied"
+	},
+	"formatTime": func(t time.Time) string {
+		return t.Local().Format("2 Jan 2006 15:04")
+	},
+}
+
+// statusLabel is the text shown for a catalog status
+func statusLabel(status string) string {
+	switch status {
+	case "available":
+		return "Available"
+	case "approval_required":
+		return "Requires approval"
+	case "pending_approval":
+		return "Awaiting approval"
+	case "denied":
+		return "Request denied"
+	case "installing":
+		return "Installing"
+	case "installed":
+		return "Installed"
+	case "install_failed":
+		return "Install failed"
+	case "uninstalling":
+		return "Uninstalling"
+	case "uninstall_failed":
+		return "Uninstall failed"
+	case "pending":
+		return "Pending"
+	case "approved":
+		return "Approved"
+	}
+	return status
+}
@@ -0,0 +1,373 @@
+package storefront
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/notawar/mobius/shared/pkg/apiclient"
+)
+
+// catalogServer serves the catalog API of one device, with the token
+// "device-token", as the Mobius server does
+type catalogServer struct {
+	mu           sync.Mutex
+	applications []apiclient.CatalogApplication
+	revoked      bool
+	// failing makes every call fail with this status
+	failing int
+	// calls are the install, uninstall and request calls received, such as
+	// "install app-1"
+	calls   []string
+	reasons []string
+}
+
+func newCatalogServer() *catalogServer {
+	return &catalogServer{applications: []apiclient.CatalogApplication{
+		{Application: apiclient.Application{ID: "app-2", Name: "slack", Version: "4.41"}, Restricted: true, Status: "approval_required"},
+		{Application: apiclient.Application{ID: "app-1", Name: "Firefox", Version: "131.0"}, Status: "available"},
+		{Application: apiclient.Application{ID: "app-3", Name: "VLC", Version: "3.0.21"}, Status: "installed"},
+	}}
+}
+
+func (s *catalogServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.revoked || r.Header.Get("Authorization") != "Bearer device-token" {
+		writeError(w, http.StatusUnauthorized, "Invalid device token")
+		return
+	}
+	if s.failing != 0 {
+		writeError(w, s.failing, "Failed to load catalog")
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, apiclient.BasePath+"/device/catalog")
+	switch {
+	case r.Method == "GET" && path == "":
+		writeJSON(w, http.StatusOK, apiclient.DeviceGetCatalogResponse{DeviceID: "device-1", Applications: s.applications})
+		return
+	case r.Method == "GET" && path == "/requests":
+		writeJSON(w, http.StatusOK, apiclient.DeviceListApplicationRequestsResponse{DeviceID: "device-1"})
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	if r.Method != "POST" || len(parts) != 2 {
+		writeError(w, http.StatusNotFound, "Not found")
+		return
+	}
+	var app *apiclient.CatalogApplication
+	for i := range s.applications {
+		if s.applications[i].ID == parts[0] {
+			app = &s.applications[i]
+		}
+	}
+	if app == nil {
+		writeError(w, http.StatusNotFound, "Application is not in the catalog of this device")
+		return
+	}
+
+	switch parts[1] {
+	case "install", "uninstall":
+		if parts[1] == "install" && app.Restricted {
+			writeError(w, http.StatusForbidden, "Application requires an approved request")
+			return
+		}
+		s.calls = append(s.calls, parts[1]+" "+app.ID)
+		writeJSON(w, http.StatusAccepted, apiclient.DeviceCommand{ID: "command-1"})
+	case "requests":
+		var body apiclient.DeviceRequestApplicationRequest
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+		s.calls = append(s.calls, "request "+app.ID)
+		if body.Reason != nil {
+			s.reasons = append(s.reasons, *body.Reason)
+		}
+		writeJSON(w, http.StatusCreated, apiclient.ApplicationRequest{ID: "request-1", ApplicationID: app.ID, Status: "pending"})
+	default:
+		writeError(w, http.StatusNotFound, "Not found")
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v) //nolint:errcheck
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, apiclient.Error{StatusCode: status, Status: http.StatusText(status), Message: message})
+}
+
+// testStorefront is a storefront of a catalog server
+type testStorefront struct {
+	catalog *catalogServer
+	handler http.Handler
+}
+
+func newTestStorefront(t *testing.T) *testStorefront {
+	t.Helper()
+
+	catalog := newCatalogServer()
+	server := httptest.NewServer(catalog)
+	t.Cleanup(server.Close)
+
+	s, err := New(Config{ServerURL: server.URL, Logger: slog.New(slog.NewTextHandler(io.Discard, nil))})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return &testStorefront{catalog: catalog, handler: s.Handler()}
+}
+
+// do sends a request to the storefront, with a form if there is one
+func (s *testStorefront) do(method, path string, cookie *http.Cookie, form url.Values) *httptest.ResponseRecorder {
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+	req := httptest.NewRequest(method, path, body)
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	rec := httptest.NewRecorder()
+	s.handler.ServeHTTP(rec, req)
+	return rec
+}
+
+var csrfPattern = regexp.MustCompile(`name="csrf_token" value="([^"]+)"`)
+
+// signIn signs in with the device token and returns the session cookie and
+// the CSRF token of the catalog page
+func (s *testStorefront) signIn(t *testing.T) (*http.Cookie, string) {
+	t.Helper()
+
+	rec := s.do("POST", "/login", nil, url.Values{"device_token": {"device-token"}})
+	expectRedirect(t, rec, "/")
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != sessionCookie {
+		t.Fatalf("expected the session cookie, got %v", cookies)
+	}
+
+	rec = s.do("GET", "/", cookies[0], nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+	match := csrfPattern.FindStringSubmatch(rec.Body.String())
+	if match == nil {
+		t.Fatal("expected a CSRF token in the catalog")
+	}
+	return cookies[0], match[1]
+}
+
+// expectRedirect checks that a response redirects to location
+func expectRedirect(t *testing.T, rec *httptest.ResponseRecorder, location string) {
+	t.Helper()
+
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != location {
+		t.Fatalf("expected a redirect to %s, got %d to %q", location, rec.Code, rec.Header().Get("Location"))
+	}
+}
+
+func TestLogin(t *testing.T) {
+	s := newTestStorefront(t)
+
+	for _, tc := range []struct {
+		name    string
+		token   string
+		failing int
+		status  int
+		message string
+	}{
+		{"no token", "  ", 0, http.StatusBadRequest, "Enter the device token of this device."},
+		{"unknown token", "other-token", 0, http.StatusUnauthorized, "This device token was not accepted."},
+		{"catalog not licensed", "device-token", http.StatusForbidden, http.StatusForbidden, "The self-service catalog is not available"},
+		{"server down", "device-token", http.StatusServiceUnavailable, http.StatusBadGateway, "The Mobius server could not be reached."},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s.catalog.failing = tc.failing
+			defer func() { s.catalog.failing = 0 }()
+
+			rec := s.do("POST", "/login", nil, url.Values{"device_token": {tc.token}})
+			if rec.Code != tc.status {
+				t.Errorf("expected status %d, got %d", tc.status, rec.Code)
+			}
+			if !strings.Contains(rec.Body.String(), tc.message) {
+				t.Errorf("expected the page to say %q", tc.message)
+			}
+			if cookies := rec.Result().Cookies(); len(cookies) != 0 {
+				t.Errorf("expected no session, got %v", cookies)
+			}
+		})
+	}
+
+	rec := s.do("POST", "/login", nil, url.Values{"device_token": {" device-token "}})
+	expectRedirect(t, rec, "/")
+	cookie := rec.Result().Cookies()[0]
+	if !cookie.HttpOnly || cookie.SameSite != http.SameSiteStrictMode || cookie.Value == "device-token" {
+		t.Errorf("expected an HttpOnly, SameSite session cookie, got %+v", cookie)
+	}
+
+	// Signed-in users skip the sign-in page, and signing out ends the session
+	expectRedirect(t, s.do("GET", "/login", cookie, nil), "/")
+	csrf := csrfPattern.FindStringSubmatch(s.do("GET", "/", cookie, nil).Body.String())[1]
+	expectRedirect(t, s.do("POST", "/logout", cookie, url.Values{"csrf_token": {csrf}}), "/login")
+	expectRedirect(t, s.do("GET", "/", cookie, nil), "/login")
+}
+
+func TestCatalog(t *testing.T) {
+	s := newTestStorefront(t)
+
+	expectRedirect(t, s.do("GET", "/", nil, nil), "/login")
+	expectRedirect(t, s.do("GET", "/", &http.Cookie{Name: sessionCookie, Value: "forged"}, nil), "/login")
+
+	cookie, _ := s.signIn(t)
+	rec := s.do("GET", "/", cookie, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+	if csp := rec.Header().Get("Content-Security-Policy"); !strings.Contains(csp, "frame-ancestors 'none'") {
+		t.Errorf("expected a content security policy, got %q", csp)
+	}
+
+	// Applications are sorted by name, whatever their case, with the
+	// actions their status allows
+	body := rec.Body.String()
+	firefox, slack, vlc := strings.Index(body, "Firefox"), strings.Index(body, "slack"), strings.Index(body, "VLC")
+	if firefox < 0 || !(firefox < slack && slack < vlc) {
+		t.Errorf("expected Firefox, slack and VLC in order, got them at %d, %d and %d", firefox, slack, vlc)
+	}
+	for _, action := range []string{"/apps/app-1/install", "/apps/app-2/request", "/apps/app-3/uninstall"} {
+		if !strings.Contains(body, `action="`+action+`"`) {
+			t.Errorf("expected a form for %s", action)
+		}
+	}
+	if strings.Contains(body, "/apps/app-2/install") {
+		t.Error("expected no install form for a restricted application")
+	}
+}
+
+func TestCatalogActions(t *testing.T) {
+	s := newTestStorefront(t)
+	cookie, csrf := s.signIn(t)
+
+	for _, tc := range []struct {
+		name   string
+		path   string
+		form   url.Values
+		flash  string
+		calls  []string
+		status int
+	}{
+		{
+			name:  "install",
+			path:  "/apps/app-1/install",
+			flash: "Install queued.",
+			calls: []string{"install app-1"},
+		},
+		{
+			name:  "uninstall",
+			path:  "/apps/app-3/uninstall",
+			flash: "Uninstall queued.",
+			calls: []string{"uninstall app-3"},
+		},
+		{
+			name:  "application not in the catalog",
+			path:  "/apps/app-9/install",
+			flash: "Application is not in the catalog of this device.",
+		},
+		{
+			name:  "restricted application",
+			path:  "/apps/app-2/install",
+			flash: "Application requires an approved request.",
+		},
+		{
+			name:  "request",
+			path:  "/apps/app-2/request",
+			form:  url.Values{"reason": {" For the team channel "}},
+			flash: "Request sent.",
+			calls: []string{"request app-2"},
+		},
+		{
+			name:  "reason too long",
+			path:  "/apps/app-2/request",
+			form:  url.Values{"reason": {strings.Repeat("x", maxReason+1)}},
+			flash: "The reason is too long.",
+		},
+		{
+			name:   "missing CSRF token",
+			path:   "/apps/app-1/install",
+			form:   url.Values{"csrf_token": {""}},
+			status: http.StatusForbidden,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s.catalog.calls = nil
+			form := url.Values{"csrf_token": {csrf}}
+			for name, values := range tc.form {
+				form[name] = values
+			}
+
+			rec := s.do("POST", tc.path, cookie, form)
+			if tc.status != 0 {
+				if rec.Code != tc.status {
+					t.Errorf("expected status %d, got %d", tc.status, rec.Code)
+				}
+			} else {
+				expectRedirect(t, rec, "/")
+				if body := s.do("GET", "/", cookie, nil).Body.String(); !strings.Contains(body, tc.flash) {
+					t.Errorf("expected the catalog to say %q", tc.flash)
+				}
+			}
+
+			if strings.Join(s.catalog.calls, ", ") != strings.Join(tc.calls, ", ") {
+				t.Errorf("expected calls %q, got %q", tc.calls, s.catalog.calls)
+			}
+		})
+	}
+
+	if len(s.catalog.reasons) != 1 || s.catalog.reasons[0] != "For the team channel" {
+		t.Errorf("expected the trimmed reason, got %q", s.catalog.reasons)
+	}
+
+	// The message is shown once
+	if body := s.do("GET", "/", cookie, nil).Body.String(); strings.Contains(body, `class="flash`) {
+		t.Error("expected no message after it was shown")
+	}
+}
+
+func TestRevokedToken(t *testing.T) {
+	s := newTestStorefront(t)
+	cookie, csrf := s.signIn(t)
+
+	// A server error keeps the session
+	s.catalog.failing = http.StatusInternalServerError
+	if rec := s.do("GET", "/", cookie, nil); rec.Code != http.StatusBadGateway {
+		t.Errorf("expected status 502, got %d", rec.Code)
+	}
+	s.catalog.failing = 0
+
+	// A rejected token ends it
+	s.catalog.revoked = true
+	rec := s.do("POST", "/apps/app-1/install", cookie, url.Values{"csrf_token": {csrf}})
+	if rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), "Sign in again.") {
+		t.Errorf("expected to be asked to sign in again, got %d", rec.Code)
+	}
+	if cookies := rec.Result().Cookies(); len(cookies) != 1 || cookies[0].MaxAge >= 0 {
+		t.Errorf("expected the session cookie to be cleared, got %v", cookies)
+	}
+	expectRedirect(t, s.do("GET", "/", cookie, nil), "/login")
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"packageSearch/internal/catalog"
+)
+
+// legacySources maps the sources of the /search/{source} endpoints, which
+// predate the catalog, to catalog sources
+var legacySources = map[string]string{
+	"apt":      catalog.SourceApt,
+	"flatpak":  catalog.SourceFlatpak,
+	"homebrew": catalog.SourceHomebrew,
+	"windows":  catalog.SourceWinget,
+}
+
+// searchRequest is the body of the /search/{source} endpoints
+type searchRequest struct {
+	Search  string `json:"search"`
+	Exclude string `json:"exclude"`
+}
+
+// searchResult is the response of the /search/{source} endpoints
+type searchResult struct {
+	Output []catalog.Package `json:"output"`
+	Error  string            `json:"error,omitempty"`
+}
+
+// updateRequest is the optional body of POST /update
+type updateRequest struct {
+	// Sources to ingest; every source if empty
+	Sources []string `json:"sources"`
+}
+
+type handler struct {
+	catalog *catalog.Catalog
+}
+
+// newHandler returns the routes of the service
+func newHandler(cat *catalog.Catalog) http.Handler {
+	h := &handler{catalog: cat}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /packages", h.searchPackages)
+	mux.HandleFunc("GET /packages/{id...}", h.getPackage)
+	mux.HandleFunc("GET /sources", h.listSources)
+	mux.HandleFunc("POST /update", h.update)
+	mux.HandleFunc("POST /search/{source}", h.legacySearch)
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	})
+	return mux
+}
+
+// searchPackages serves GET /packages?q=&source=&platform=&exclude=&limit=
+func (h *handler) searchPackages(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	q := catalog.Query{
+		Text:     query.Get("q"),
+		Source:   query.Get("source"),
+		Platform: query.Get("platform"),
+		Exclude:  query.Get("exclude"),
+	}
+	if q.Source != "" && !h.hasSource(q.Source) {
+		writeError(w, http.StatusBadRequest, "unknown source "+q.Source)
+		return
+	}
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			writeError(w, http.StatusBadRequest, "limit must be a positive number")
+			return
+		}
+		q.Limit = limit
+	}
+
+	packages, total := h.catalog.Search(q)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"packages": packages,
+		"total":    total,
+		"sources":  h.catalog.Status(),
+	})
+}
+
+// getPackage serves GET /packages/{id}
+func (h *handler) getPackage(w http.ResponseWriter, r *http.Request) {
+	pkg, ok := h.catalog.Get(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "package not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, pkg)
+}
+
+// listSources serves GET /sources, the freshness of every source
+func (h *handler) listSources(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{"sources": h.catalog.Status()})
+}
+
+// update serves POST /update, which ingests sources in the background
+func (h *handler) update(w http.ResponseWriter, r *http.Request) {
+	var req updateRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+	}
+	if err := h.catalog.Refresh(req.Sources...); err != nil {
+		if errors.Is(err, catalog.ErrUnknownSource) {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]interface{}{"sources": h.catalog.Status()})
+}
+
+// legacySearch serves POST /search/{source} from the catalog
+func (h *handler) legacySearch(w http.ResponseWriter, r *http.Request) {
+	source, ok := legacySources[r.PathValue("source")]
+	if !ok || !h.hasSource(source) {
+		writeJSON(w, http.StatusNotFound, searchResult{Output: []catalog.Package{}, Error: "unknown source"})
+		return
+	}
+	var req searchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, searchResult{Output: []catalog.Package{}, Error: "invalid request body"})
+		return
+	}
+
+	packages, _ := h.catalog.Search(catalog.Query{
+		Text:    req.Search,
+		Source:  source,
+		Exclude: req.Exclude,
+		Limit:   catalog.MaxLimit,
+	})
+	writeJSON(w, http.StatusOK, searchResult{Output: packages})
+}
+
+// hasSource reports whether the catalog ingests a source
+func (h *handler) hasSource(name string) bool {
+	for _, st := range h.catalog.Status() {
+		if st.Source == name {
+			return true
+		}
+	}
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
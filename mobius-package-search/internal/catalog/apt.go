@@ -0,0 +1,119 @@
+package catalog
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// AptSource ingests the Packages indexes of a Debian or Ubuntu mirror
+type AptSource struct {
+	// Mirror is the base URL of the repository, such as
+	// http://archive.ubuntu.com/ubuntu
+	Mirror     string
+	Suites     []string
+	Components []string
+	Arch       string
+	Client     *http.Client
+}
+
+// aptSkippedSections hold libraries and debug symbols, which are installed
+// as dependencies rather than on their own
+var aptSkippedSections = map[string]bool{
+	"libs": true, "oldlibs": true, "libdevel": true, "debug": true,
+}
+
+// Name returns SourceApt
+func (s *AptSource) Name() string { return SourceApt }
+
+// Fetch reads the Packages index of every suite and component, keeping the
+// highest version of packages found in several
+func (s *AptSource) Fetch(ctx context.Context) ([]Package, error) {
+	packages := make(map[string]Package)
+	for _, suite := range s.Suites {
+		for _, component := range s.Components {
+			if err := s.fetchIndex(ctx, suite, component, packages); err != nil {
+				return nil, fmt.Errorf("%s/%s: %w", suite, component, err)
+			}
+		}
+	}
+	return packageList(packages), nil
+}
+
+// fetchIndex reads the index of a suite and component, compressed or not
+func (s *AptSource) fetchIndex(ctx context.Context, suite, component string, packages map[string]Package) error {
+	base := fmt.Sprintf("%s/dists/%s/%s/binary-%s/Packages", strings.TrimRight(s.Mirror, "/"), suite, component, s.Arch)
+	body, err := open(ctx, s.Client, base+".gz")
+	if errors.Is(err, errNotFound) {
+		body, err = open(ctx, s.Client, base)
+	}
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	return parseAptIndex(body, packages)
+}
+
+// parseAptIndex reads the stanzas of a Packages index
+func parseAptIndex(r io.Reader, packages map[string]Package) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64<<10), 1<<20)
+
+	fields := make(map[string]string)
+	flush := func() {
+		if pkg, ok := aptPackage(fields); ok {
+			latest(packages, pkg)
+		}
+		clear(fields)
+	}
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			flush()
+			continue
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			continue // continuation of a multi-line field
+		}
+		if key, value, ok := strings.Cut(line, ":"); ok {
+			fields[key] = strings.TrimSpace(value)
+		}
+	}
+	flush()
+	return scanner.Err()
+}
+
+// aptPackage builds a package of the fields of a stanza
+func aptPackage(fields map[string]string) (Package, bool) {
+	name := fields["Package"]
+	if name == "" || fields["Version"] == "" || strings.HasSuffix(name, "-dbgsym") {
+		return Package{}, false
+	}
+	section := fields["Section"]
+	if i := strings.LastIndexByte(section, '/'); i >= 0 {
+		section = section[i+1:]
+	}
+	if aptSkippedSections[section] {
+		return Package{}, false
+	}
+
+	publisher := fields["Maintainer"]
+	if i := strings.IndexByte(publisher, '<'); i > 0 {
+		publisher = strings.TrimSpace(publisher[:i])
+	}
+	return Package{
+		ID:          SourceApt + ":" + name,
+		Source:      SourceApt,
+		Name:        name,
+		Version:     fields["Version"],
+		Publisher:   publisher,
+		Description: fields["Description"],
+		Homepage:    fields["Homepage"],
+		Platforms:   []string{PlatformLinux},
+		Install:     Install{Manager: ManagerApt, Identifier: name},
+	}, true
+}
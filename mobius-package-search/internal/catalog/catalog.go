@@ -0,0 +1,266 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultInterval is how often sources are ingested by default
+const DefaultInterval = 6 * time.Hour
+
+// maxRetryInterval bounds how long a failed source waits before its next
+// attempt
+const maxRetryInterval = 15 * time.Minute
+
+// ErrUnknownSource is returned for sources the catalog does not ingest
+var ErrUnknownSource = errors.New("unknown source")
+
+// ErrIngesting is returned when a source is already being ingested
+var ErrIngesting = errors.New("source is already being ingested")
+
+// Config configures a catalog
+type Config struct {
+	Sources []Source
+	// DataDir keeps the ingested packages across restarts; if empty they
+	// are only kept in memory
+	DataDir string
+	// Interval is how often sources are ingested
+	Interval time.Duration
+	Logger   *slog.Logger
+}
+
+// Catalog is the index of the packages of every source. Every source has
+// its own snapshot, replaced whole when an ingestion succeeds; a failed
+// ingestion keeps serving the previous one.
+type Catalog struct {
+	sources  []Source
+	dataDir  string
+	interval time.Duration
+	logger   *slog.Logger
+	refresh  chan string
+
+	mu        sync.RWMutex
+	snapshots map[string]*snapshot
+}
+
+// snapshot is the packages of a source and its freshness
+type snapshot struct {
+	packages []Package
+	byID     map[string]int
+	// terms are the lowercased searched fields of every package
+	terms  []searchTerms
+	status SourceStatus
+}
+
+// New creates a catalog, loading the packages kept in the data directory
+func New(cfg Config) (*Catalog, error) {
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultInterval
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = slog.Default()
+	}
+
+	c := &Catalog{
+		sources:   cfg.Sources,
+		dataDir:   cfg.DataDir,
+		interval:  cfg.Interval,
+		logger:    cfg.Logger,
+		refresh:   make(chan string, len(cfg.Sources)),
+		snapshots: make(map[string]*snapshot),
+	}
+	for _, src := range cfg.Sources {
+		name := src.Name()
+		if _, dup := c.snapshots[name]; dup {
+			return nil, fmt.Errorf("source %s configured twice", name)
+		}
+		snap, err := c.load(name)
+		if err != nil {
+			return nil, fmt.Errorf("load %s: %w", name, err)
+		}
+		c.snapshots[name] = snap
+	}
+	return c, nil
+}
+
+// Run ingests every source when it is due, and on Refresh, until ctx is
+// done
+func (c *Catalog) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	start := func(name string) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := c.Ingest(ctx, name); err != nil && !errors.Is(err, ErrIngesting) {
+				c.logger.Warn("Ingestion failed", "source", name, "error", err)
+			}
+		}()
+	}
+
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		for _, src := range c.sources {
+			if c.due(src.Name(), time.Now()) {
+				start(src.Name())
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case name := <-c.refresh:
+			start(name)
+		case <-ticker.C:
+		}
+	}
+}
+
+// due reports whether a source should be ingested: its packages are older
+// than the interval, and a failed attempt is not too recent
+func (c *Catalog) due(name string, now time.Time) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	st := c.snapshots[name].status
+	if st.Ingesting {
+		return false
+	}
+	if st.LastAttempt != nil && st.LastError != "" &&
+		now.Sub(*st.LastAttempt) < min(c.interval, maxRetryInterval) {
+		return false
+	}
+	return st.LastSuccess == nil || now.Sub(*st.LastSuccess) >= c.interval
+}
+
+// Refresh asks Run to ingest sources now, or every source if none is given
+func (c *Catalog) Refresh(names ...string) error {
+	if len(names) == 0 {
+		for _, src := range c.sources {
+			names = append(names, src.Name())
+		}
+	}
+	for _, name := range names {
+		if c.source(name) == nil {
+			return fmt.Errorf("%w: %s", ErrUnknownSource, name)
+		}
+	}
+	for _, name := range names {
+		select {
+		case c.refresh <- name:
+		default:
+			// A refresh of every source is already pending
+		}
+	}
+	return nil
+}
+
+// Ingest fetches the packages of a source and replaces its snapshot
+func (c *Catalog) Ingest(ctx context.Context, name string) error {
+	src := c.source(name)
+	if src == nil {
+		return fmt.Errorf("%w: %s", ErrUnknownSource, name)
+	}
+
+	started := time.Now()
+	c.mu.Lock()
+	snap := c.snapshots[name]
+	if snap.status.Ingesting {
+		c.mu.Unlock()
+		return ErrIngesting
+	}
+	snap.status.Ingesting = true
+	snap.status.LastAttempt = &started
+	c.mu.Unlock()
+
+	c.logger.Info("Ingesting source", "source", name)
+	packages, err := src.Fetch(ctx)
+	if err == nil && len(packages) == 0 {
+		// An empty repository is more likely a broken mirror than a
+		// repository that removed everything
+		err = errors.New("no packages found")
+	}
+	if err != nil {
+		c.mu.Lock()
+		snap.status.Ingesting = false
+		snap.status.LastError = err.Error()
+		c.mu.Unlock()
+		return err
+	}
+
+	finished := time.Now()
+	next := newSnapshot(packages, SourceStatus{
+		Source:      name,
+		LastSuccess: &finished,
+		LastAttempt: &started,
+		Duration:    finished.Sub(started).Round(time.Millisecond).String(),
+	})
+	if err := c.save(next); err != nil {
+		// The packages are still served; they are ingested again after a
+		// restart
+		c.logger.Warn("Failed to save source", "source", name, "error", err)
+	}
+
+	c.mu.Lock()
+	c.snapshots[name] = next
+	c.mu.Unlock()
+	c.logger.Info("Ingested source", "source", name, "packages", len(packages), "duration", next.status.Duration)
+	return nil
+}
+
+// Status returns the freshness of every source
+func (c *Catalog) Status() []SourceStatus {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	now := time.Now()
+	statuses := make([]SourceStatus, 0, len(c.sources))
+	for _, src := range c.sources {
+		st := c.snapshots[src.Name()].status
+		st.Stale = st.LastSuccess == nil || now.Sub(*st.LastSuccess) > 2*c.interval
+		statuses = append(statuses, st)
+	}
+	return statuses
+}
+
+// Get returns a package by ID
+func (c *Catalog) Get(id string) (Package, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for _, snap := range c.snapshots {
+		if i, ok := snap.byID[id]; ok {
+			return snap.packages[i], true
+		}
+	}
+	return Package{}, false
+}
+
+// source returns the source of a name, or nil
+func (c *Catalog) source(name string) Source {
+	for _, src := range c.sources {
+		if src.Name() == name {
+			return src
+		}
+	}
+	return nil
+}
+
+// newSnapshot indexes packages, sorted by ID
+func newSnapshot(packages []Package, status SourceStatus) *snapshot {
+	sort.Slice(packages, func(i, j int) bool { return packages[i].ID < packages[j].ID })
+	byID := make(map[string]int, len(packages))
+	terms := make([]searchTerms, len(packages))
+	for i, pkg := range packages {
+		byID[pkg.ID] = i
+		terms[i] = newSearchTerms(pkg)
+	}
+	status.Packages = len(packages)
+	return &snapshot{packages: packages, byID: byID, terms: terms, status: status}
+}
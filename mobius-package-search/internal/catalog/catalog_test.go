@@ -0,0 +1,266 @@
+package catalog
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// wingetArchive builds a tar.gz of the winget-pkgs fixture, laid out like
+// GitHub's archive of the repository
+func wingetArchive(t *testing.T) string {
+	t.Helper()
+	root := filepath.Join("testdata", "mirror")
+	path := filepath.Join(t.TempDir(), "winget-pkgs.tar.gz")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	err = filepath.WalkDir(filepath.Join(root, "winget-pkgs-master"), func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		name, _ := filepath.Rel(root, p)
+		hdr := &tar.Header{Name: filepath.ToSlash(name), Mode: 0o644, Size: int64(len(data)), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err = tw.Write(data)
+		return err
+	})
+	if err == nil {
+		err = tw.Close()
+	}
+	if err == nil {
+		err = gz.Close()
+	}
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return path
+}
+
+// fixtureSources returns sources reading the fixture mirrors: apt from
+// disk through file://, the others over HTTP
+func fixtureSources(t *testing.T) (*AptSource, *FlatpakSource, *HomebrewSource, *WingetSource) {
+	t.Helper()
+	mirror, err := filepath.Abs(filepath.Join("testdata", "mirror"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	archive := wingetArchive(t)
+	mux := http.NewServeMux()
+	mux.Handle("/", http.FileServer(http.Dir(mirror)))
+	mux.HandleFunc("/winget-pkgs.tar.gz", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, archive)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	client := NewHTTPClient(0)
+	return &AptSource{
+			Mirror:     "file://" + filepath.ToSlash(filepath.Join(mirror, "ubuntu")),
+			Suites:     []string{"noble", "noble-updates"},
+			Components: []string{"main"},
+			Arch:       "amd64",
+			Client:     client,
+		},
+		&FlatpakSource{AppStreamURL: srv.URL + "/flathub/appstream.xml", Remote: "flathub", Client: client},
+		&HomebrewSource{API: srv.URL + "/homebrew", Client: client},
+		&WingetSource{ArchiveURL: srv.URL + "/winget-pkgs.tar.gz", Client: client}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.10", "1.9", 1},
+		{"1.2", "1.2", 0},
+		{"1.2", "1.2.1", -1},
+		{"2.0-1ubuntu2", "2.0-1ubuntu1", 1},
+		{"1:1.0", "2.0", 1},
+		{"3.0.20-3ubuntu0.1", "3.0.20-3build6", 1},
+		{"131.0.2", "131.0", 1},
+		{"", "1.0", -1},
+	}
+	for _, tt := range tests {
+		if got := CompareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("CompareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestCatalogIngestion(t *testing.T) {
+	ctx := context.Background()
+	apt, flatpak, homebrew, winget := fixtureSources(t)
+	dataDir := t.TempDir()
+	c, err := New(Config{Sources: []Source{apt, flatpak, homebrew, winget}, DataDir: dataDir})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, st := range c.Status() {
+		if !st.Stale || st.LastSuccess != nil || st.Packages != 0 {
+			t.Errorf("expected %s to be stale and empty before ingestion, got %+v", st.Source, st)
+		}
+	}
+	for _, name := range []string{SourceApt, SourceFlatpak, SourceHomebrew, SourceWinget} {
+		if err := c.Ingest(ctx, name); err != nil {
+			t.Fatalf("ingest %s: %v", name, err)
+		}
+	}
+	if err := c.Ingest(ctx, "pacman"); !errors.Is(err, ErrUnknownSource) {
+		t.Errorf("expected ErrUnknownSource, got %v", err)
+	}
+
+	wantCounts := map[string]int{SourceApt: 2, SourceFlatpak: 2, SourceHomebrew: 4, SourceWinget: 2}
+	for _, st := range c.Status() {
+		if st.Packages != wantCounts[st.Source] || st.Stale || st.LastSuccess == nil || st.LastError != "" {
+			t.Errorf("unexpected status %+v, want %d packages", st, wantCounts[st.Source])
+		}
+	}
+
+	// Every source in the one schema, at its highest version
+	want := map[string]Package{
+		"apt:vlc": {
+			ID: "apt:vlc", Source: SourceApt, Name: "vlc", Version: "3.0.20-3ubuntu0.1",
+			Publisher: "Ubuntu Developers", Description: "multimedia player and streamer",
+			Homepage: "https://www.videolan.org/vlc/", Platforms: []string{PlatformLinux},
+			Install: Install{Manager: ManagerApt, Identifier: "vlc"},
+		},
+		"flatpak:org.videolan.VLC": {
+			ID: "flatpak:org.videolan.VLC", Source: SourceFlatpak, Name: "VLC", Version: "3.0.21",
+			Publisher: "VideoLAN and the VLC team", Description: "VLC media player, the open-source multimedia framework",
+			Homepage: "https://www.videolan.org/vlc/", Platforms: []string{PlatformLinux},
+			Install: Install{Manager: ManagerFlatpak, Identifier: "org.videolan.VLC", Remote: "flathub"},
+		},
+		"flatpak:org.mozilla.firefox": {
+			ID: "flatpak:org.mozilla.firefox", Source: SourceFlatpak, Name: "Firefox", Version: "131.0.2",
+			Publisher: "Mozilla", Description: "Fast, Private & Safe Web Browser",
+			Homepage: "https://www.mozilla.org/firefox/", Platforms: []string{PlatformLinux},
+			Install: Install{Manager: ManagerFlatpak, Identifier: "org.mozilla.firefox", Remote: "flathub"},
+		},
+		"homebrew:wget": {
+			ID: "homebrew:wget", Source: SourceHomebrew, Name: "wget", Version: "1.24.5",
+			Description: "Internet file retriever", Homepage: "https://www.gnu.org/software/wget/",
+			Platforms: []string{PlatformLinux, PlatformMacOS},
+			Install:   Install{Manager: ManagerBrew, Identifier: "wget"},
+		},
+		"homebrew:cask/docker": {
+			ID: "homebrew:cask/docker", Source: SourceHomebrew, Name: "Docker Desktop", Version: "4.34.3,170107",
+			Description: "App to build and share containerised applications and microservices",
+			Homepage:    "https://www.docker.com/products/docker-desktop", Platforms: []string{PlatformMacOS},
+			Install: Install{Manager: ManagerBrew, Identifier: "docker", Cask: true},
+		},
+		"winget:Mozilla.Firefox": {
+			ID: "winget:Mozilla.Firefox", Source: SourceWinget, Name: "Mozilla Firefox", Version: "131.0.2",
+			Publisher:   "Mozilla",
+			Description: "Mozilla Firefox is free and open source software, built by a community of thousands from all over the world.",
+			Homepage:    "https://www.mozilla.org/firefox/", Platforms: []string{PlatformWindows},
+			Install: Install{Manager: ManagerWinget, Identifier: "Mozilla.Firefox"},
+		},
+		"winget:VideoLAN.VLC": {
+			ID: "winget:VideoLAN.VLC", Source: SourceWinget, Name: "VLC media player", Version: "3.0.21",
+			Publisher: "VideoLAN", Description: "VLC is a free and open source cross-platform multimedia player.",
+			Homepage: "https://www.videolan.org/", Platforms: []string{PlatformWindows},
+			Install: Install{Manager: ManagerWinget, Identifier: "VideoLAN.VLC"},
+		},
+	}
+	for id, wantPkg := range want {
+		pkg, ok := c.Get(id)
+		if !ok {
+			t.Errorf("expected package %s", id)
+			continue
+		}
+		if !reflect.DeepEqual(pkg, wantPkg) {
+			t.Errorf("package %s:\n got %+v\nwant %+v", id, pkg, wantPkg)
+		}
+	}
+	// Libraries, debug symbols, runtimes and disabled formulae are skipped
+	for _, id := range []string{"apt:libvlc5", "apt:vlc-dbgsym", "flatpak:org.freedesktop.Platform", "homebrew:youtube-dl"} {
+		if _, ok := c.Get(id); ok {
+			t.Errorf("expected %s to be skipped", id)
+		}
+	}
+
+	// Searches rank exact matches first, then prefixes, names and
+	// descriptions
+	ids := func(packages []Package) []string {
+		list := make([]string, 0, len(packages))
+		for _, pkg := range packages {
+			list = append(list, pkg.ID)
+		}
+		return list
+	}
+	packages, total := c.Search(Query{Text: "VLC"})
+	wantIDs := []string{"apt:vlc", "flatpak:org.videolan.VLC", "winget:VideoLAN.VLC"}
+	if total != 3 || !reflect.DeepEqual(ids(packages), wantIDs) {
+		t.Errorf("search vlc: got %v (%d), want %v", ids(packages), total, wantIDs)
+	}
+	packages, _ = c.Search(Query{Text: "firefox", Platform: PlatformMacOS})
+	if !reflect.DeepEqual(ids(packages), []string{"homebrew:cask/firefox"}) {
+		t.Errorf("search firefox on macos: got %v", ids(packages))
+	}
+	packages, _ = c.Search(Query{Text: "docker", Source: SourceHomebrew})
+	if !reflect.DeepEqual(ids(packages), []string{"homebrew:docker", "homebrew:cask/docker"}) {
+		t.Errorf("search docker in homebrew: got %v", ids(packages))
+	}
+	packages, _ = c.Search(Query{Text: "firefox", Exclude: "transitional"})
+	for _, pkg := range packages {
+		if pkg.ID == "apt:firefox" {
+			t.Errorf("expected apt:firefox to be excluded")
+		}
+	}
+	packages, total = c.Search(Query{Limit: 3})
+	if len(packages) != 3 || total != 10 {
+		t.Errorf("expected 3 of 10 packages, got %d of %d", len(packages), total)
+	}
+
+	// A failed ingestion keeps serving the previous packages
+	homebrew.API = "file:///nonexistent"
+	if err := c.Ingest(ctx, SourceHomebrew); err == nil {
+		t.Fatal("expected ingestion of a missing mirror to fail")
+	}
+	for _, st := range c.Status() {
+		if st.Source == SourceHomebrew && (st.LastError == "" || st.Packages != 4 || st.Stale) {
+			t.Errorf("expected the failure to be recorded and the packages kept, got %+v", st)
+		}
+	}
+	if _, ok := c.Get("homebrew:wget"); !ok {
+		t.Error("expected homebrew:wget to still be served")
+	}
+
+	// The packages are loaded again after a restart
+	reloaded, err := New(Config{Sources: []Source{apt, flatpak, homebrew, winget}, DataDir: dataDir})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, st := range reloaded.Status() {
+		if st.Packages != wantCounts[st.Source] || st.LastSuccess == nil || st.Stale {
+			t.Errorf("unexpected status after reload %+v", st)
+		}
+	}
+	if pkg, ok := reloaded.Get("winget:Mozilla.Firefox"); !ok || !reflect.DeepEqual(pkg, want["winget:Mozilla.Firefox"]) {
+		t.Errorf("unexpected package after reload: %+v", pkg)
+	}
+	if reloaded.due(SourceApt, *reloaded.Status()[0].LastSuccess) {
+		t.Error("expected a freshly loaded source not to be due")
+	}
+}
@@ -0,0 +1,153 @@
+package catalog
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// FlatpakSource ingests the AppStream metadata of a flatpak remote, such as
+// Flathub's appstream.xml.gz
+type FlatpakSource struct {
+	// AppStreamURL is the AppStream XML of the remote, gzipped or not
+	AppStreamURL string
+	// Remote is the name of the remote applications are installed from
+	Remote string
+	Client *http.Client
+}
+
+// flatpakApplicationTypes are the AppStream components that are
+// applications; runtimes and extensions are installed with them
+var flatpakApplicationTypes = map[string]bool{
+	"desktop-application": true, "desktop": true, "console-application": true,
+}
+
+// appstreamComponent is the part of an AppStream component the catalog
+// uses
+type appstreamComponent struct {
+	Type          string          `xml:"type,attr"`
+	ID            string          `xml:"id"`
+	Names         []appstreamText `xml:"name"`
+	Summaries     []appstreamText `xml:"summary"`
+	DeveloperName []appstreamText `xml:"developer_name"`
+	Developer     struct {
+		Names []appstreamText `xml:"name"`
+	} `xml:"developer"`
+	URLs []struct {
+		Type  string `xml:"type,attr"`
+		Value string `xml:",chardata"`
+	} `xml:"url"`
+	Releases []struct {
+		Version string `xml:"version,attr"`
+	} `xml:"releases>release"`
+	Bundles []struct {
+		Type  string `xml:"type,attr"`
+		Value string `xml:",chardata"`
+	} `xml:"bundle"`
+}
+
+// appstreamText is a translatable text; the untranslated one has no lang
+type appstreamText struct {
+	Lang  string `xml:"lang,attr"`
+	Value string `xml:",chardata"`
+}
+
+// Name returns SourceFlatpak
+func (s *FlatpakSource) Name() string { return SourceFlatpak }
+
+// Fetch reads the applications of the AppStream metadata
+func (s *FlatpakSource) Fetch(ctx context.Context) ([]Package, error) {
+	body, err := open(ctx, s.Client, s.AppStreamURL)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	packages := make(map[string]Package)
+	dec := xml.NewDecoder(body)
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parse appstream: %w", err)
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "component" {
+			continue
+		}
+		var c appstreamComponent
+		if err := dec.DecodeElement(&c, &start); err != nil {
+			return nil, fmt.Errorf("parse appstream: %w", err)
+		}
+		if pkg, ok := s.flatpakPackage(&c); ok {
+			latest(packages, pkg)
+		}
+	}
+	return packageList(packages), nil
+}
+
+// flatpakPackage builds a package of an application component
+func (s *FlatpakSource) flatpakPackage(c *appstreamComponent) (Package, bool) {
+	if !flatpakApplicationTypes[c.Type] {
+		return Package{}, false
+	}
+	appID := strings.TrimSuffix(strings.TrimSpace(c.ID), ".desktop")
+	for _, b := range c.Bundles {
+		// app/<application ID>/<arch>/<branch>
+		if parts := strings.Split(strings.TrimSpace(b.Value), "/"); b.Type == "flatpak" && len(parts) >= 2 && parts[0] == "app" {
+			appID = parts[1]
+		}
+	}
+	if appID == "" {
+		return Package{}, false
+	}
+
+	version := ""
+	for _, r := range c.Releases {
+		if version == "" || CompareVersions(r.Version, version) > 0 {
+			version = r.Version
+		}
+	}
+	homepage := ""
+	for _, u := range c.URLs {
+		if u.Type == "homepage" {
+			homepage = strings.TrimSpace(u.Value)
+		}
+	}
+	publisher := untranslated(c.Developer.Names)
+	if publisher == "" {
+		publisher = untranslated(c.DeveloperName)
+	}
+	name := untranslated(c.Names)
+	if name == "" {
+		name = appID
+	}
+
+	return Package{
+		ID:          SourceFlatpak + ":" + appID,
+		Source:      SourceFlatpak,
+		Name:        name,
+		Version:     version,
+		Publisher:   publisher,
+		Description: untranslated(c.Summaries),
+		Homepage:    homepage,
+		Platforms:   []string{PlatformLinux},
+		Install:     Install{Manager: ManagerFlatpak, Identifier: appID, Remote: s.Remote},
+	}, true
+}
+
+// untranslated returns the text without a language
+func untranslated(texts []appstreamText) string {
+	for _, t := range texts {
+		if t.Lang == "" {
+			return strings.TrimSpace(t.Value)
+		}
+	}
+	return ""
+}
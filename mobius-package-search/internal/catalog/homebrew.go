@@ -0,0 +1,148 @@
+package catalog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// HomebrewSource ingests the formulae and casks of the Homebrew JSON API
+type HomebrewSource struct {
+	// API is the base URL serving formula.json and cask.json, such as
+	// https://formulae.brew.sh/api
+	API    string
+	Client *http.Client
+}
+
+// homebrewFormula is the part of a formula of formula.json the catalog uses
+type homebrewFormula struct {
+	Name     string `json:"name"`
+	Desc     string `json:"desc"`
+	Homepage string `json:"homepage"`
+	Versions struct {
+		Stable string `json:"stable"`
+	} `json:"versions"`
+	Bottle struct {
+		Stable struct {
+			Files map[string]json.RawMessage `json:"files"`
+		} `json:"stable"`
+	} `json:"bottle"`
+	Disabled bool `json:"disabled"`
+}
+
+// homebrewCask is the part of a cask of cask.json the catalog uses
+type homebrewCask struct {
+	Token    string   `json:"token"`
+	Name     []string `json:"name"`
+	Desc     string   `json:"desc"`
+	Homepage string   `json:"homepage"`
+	Version  string   `json:"version"`
+	Disabled bool     `json:"disabled"`
+}
+
+// Name returns SourceHomebrew
+func (s *HomebrewSource) Name() string { return SourceHomebrew }
+
+// Fetch reads the formulae and casks. Disabled ones can no longer be
+// installed and are skipped.
+func (s *HomebrewSource) Fetch(ctx context.Context) ([]Package, error) {
+	var packages []Package
+
+	err := decodeArray(ctx, s.Client, strings.TrimSuffix(s.API, "/")+"/formula.json", func(f *homebrewFormula) {
+		if f.Disabled || f.Name == "" {
+			return
+		}
+		packages = append(packages, Package{
+			ID:          SourceHomebrew + ":" + f.Name,
+			Source:      SourceHomebrew,
+			Name:        f.Name,
+			Version:     f.Versions.Stable,
+			Description: f.Desc,
+			Homepage:    f.Homepage,
+			Platforms:   bottlePlatforms(f.Bottle.Stable.Files),
+			Install:     Install{Manager: ManagerBrew, Identifier: f.Name},
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("formulae: %w", err)
+	}
+
+	err = decodeArray(ctx, s.Client, strings.TrimSuffix(s.API, "/")+"/cask.json", func(c *homebrewCask) {
+		if c.Disabled || c.Token == "" {
+			return
+		}
+		name := c.Token
+		if len(c.Name) > 0 && c.Name[0] != "" {
+			name = c.Name[0]
+		}
+		packages = append(packages, Package{
+			// Casks and formulae share names, such as docker
+			ID:          SourceHomebrew + ":cask/" + c.Token,
+			Source:      SourceHomebrew,
+			Name:        name,
+			Version:     c.Version,
+			Description: c.Desc,
+			Homepage:    c.Homepage,
+			Platforms:   []string{PlatformMacOS},
+			Install:     Install{Manager: ManagerBrew, Identifier: c.Token, Cask: true},
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("casks: %w", err)
+	}
+	return packages, nil
+}
+
+// bottlePlatforms returns the platforms a formula has bottles for, named
+// after the macOS release or <arch>_linux. Formulae without bottles build
+// from source on both.
+func bottlePlatforms(files map[string]json.RawMessage) []string {
+	seen := make(map[string]bool)
+	for tag := range files {
+		if strings.HasSuffix(tag, "_linux") {
+			seen[PlatformLinux] = true
+		} else if tag != "all" {
+			seen[PlatformMacOS] = true
+		} else {
+			seen[PlatformLinux], seen[PlatformMacOS] = true, true
+		}
+	}
+	if len(seen) == 0 {
+		return []string{PlatformLinux, PlatformMacOS}
+	}
+	platforms := make([]string, 0, len(seen))
+	for p := range seen {
+		platforms = append(platforms, p)
+	}
+	sort.Strings(platforms)
+	return platforms
+}
+
+// decodeArray streams the elements of a JSON array, so the multi-megabyte
+// Homebrew indexes are never held whole in memory
+func decodeArray[T any](ctx context.Context, client *http.Client, url string, fn func(*T)) error {
+	body, err := open(ctx, client, url)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	dec := json.NewDecoder(body)
+	if tok, err := dec.Token(); err != nil {
+		return err
+	} else if tok != json.Delim('[') {
+		return fmt.Errorf("%s: not a JSON array", url)
+	}
+	for dec.More() {
+		var v T
+		if err := dec.Decode(&v); err != nil {
+			return err
+		}
+		fn(&v)
+	}
+	_, err = dec.Token()
+	return err
+}
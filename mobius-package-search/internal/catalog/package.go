@@ -0,0 +1,76 @@
+// Package catalog keeps a local index of the packages of apt, flatpak,
+// Homebrew and winget repositories. Sources are ingested periodically from
+// their mirrors, and searches are served from the index, so a search never
+// waits on an upstream repository.
+package catalog
+
+import "time"
+
+// Sources of the catalog
+const (
+	SourceApt      = "apt"
+	SourceFlatpak  = "flatpak"
+	SourceHomebrew = "homebrew"
+	SourceWinget   = "winget"
+)
+
+// Platforms packages install on
+const (
+	PlatformLinux   = "linux"
+	PlatformMacOS   = "macos"
+	PlatformWindows = "windows"
+)
+
+// Package managers of install identifiers
+const (
+	ManagerApt     = "apt"
+	ManagerFlatpak = "flatpak"
+	ManagerBrew    = "brew"
+	ManagerWinget  = "winget"
+)
+
+// Package is a package of any source, in one schema
+type Package struct {
+	// ID is unique across sources, as "<source>:<identifier>"
+	ID          string   `json:"id"`
+	Source      string   `json:"source"`
+	Name        string   `json:"name"`
+	Version     string   `json:"version"`
+	Publisher   string   `json:"publisher,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Homepage    string   `json:"homepage,omitempty"`
+	Platforms   []string `json:"platforms"`
+	Install     Install  `json:"install"`
+}
+
+// Install identifies a package to its package manager
+type Install struct {
+	Manager string `json:"manager"`
+	// Identifier is what the package manager installs: the apt package,
+	// the flatpak application ID, the Homebrew formula or cask token, or
+	// the winget package identifier
+	Identifier string `json:"identifier"`
+	// Remote is the flatpak remote of the application
+	Remote string `json:"remote,omitempty"`
+	// Cask is set for Homebrew casks
+	Cask bool `json:"cask,omitempty"`
+}
+
+// SourceStatus tells how fresh the packages of a source are
+type SourceStatus struct {
+	Source   string `json:"source"`
+	Packages int    `json:"packages"`
+	// LastSuccess is when the packages served were ingested
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+	LastAttempt *time.Time `json:"last_attempt,omitempty"`
+	// LastError is the error of the last attempt, if it failed; the packages
+	// of the last success are still served
+	LastError string `json:"last_error,omitempty"`
+	// Duration is how long the last successful ingestion took
+	Duration string `json:"duration,omitempty"`
+	// Stale is set when the last success is older than twice the ingestion
+	// interval, or the source was never ingested
+	Stale bool `json:"stale"`
+	// Ingesting is set while the source is being ingested
+	Ingesting bool `json:"ingesting"`
+}
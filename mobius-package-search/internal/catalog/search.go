@@ -0,0 +1,125 @@
+package catalog
+
+import (
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Search limits
+const (
+	DefaultLimit = 50
+	MaxLimit     = 500
+)
+
+// Query selects packages of the catalog
+type Query struct {
+	// Text is matched, case-insensitively, against the name, install
+	// identifier and description; empty matches every package
+	Text string
+	// Source and Platform restrict the packages, if set
+	Source   string
+	Platform string
+	// Exclude drops packages whose name or description contains it
+	Exclude string
+	Limit   int
+}
+
+// searchTerms are the lowercased fields of a package searches match
+type searchTerms struct {
+	name        string
+	identifier  string
+	description string
+}
+
+func newSearchTerms(pkg Package) searchTerms {
+	return searchTerms{
+		name:        strings.ToLower(pkg.Name),
+		identifier:  strings.ToLower(pkg.Install.Identifier),
+		description: strings.ToLower(pkg.Description),
+	}
+}
+
+// Ranks of a match, best first
+const (
+	rankExact = iota
+	rankPrefix
+	rankName
+	rankDescription
+	noMatch
+)
+
+// rank returns how well the terms of a package match text
+func (t searchTerms) rank(text string) int {
+	switch {
+	case text == "":
+		return rankDescription
+	case t.name == text || t.identifier == text:
+		return rankExact
+	case strings.HasPrefix(t.name, text) || strings.HasPrefix(t.identifier, text):
+		return rankPrefix
+	case strings.Contains(t.name, text) || strings.Contains(t.identifier, text):
+		return rankName
+	case strings.Contains(t.description, text):
+		return rankDescription
+	}
+	return noMatch
+}
+
+// Search returns the packages matching q, best matches first, and how many
+// matched before the limit
+func (c *Catalog) Search(q Query) ([]Package, int) {
+	text := strings.ToLower(strings.TrimSpace(q.Text))
+	exclude := strings.ToLower(strings.TrimSpace(q.Exclude))
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	limit = min(limit, MaxLimit)
+
+	type match struct {
+		pkg  Package
+		rank int
+	}
+	var matches []match
+
+	c.mu.RLock()
+	for _, src := range c.sources {
+		if q.Source != "" && src.Name() != q.Source {
+			continue
+		}
+		snap := c.snapshots[src.Name()]
+		for i, terms := range snap.terms {
+			r := terms.rank(text)
+			if r == noMatch {
+				continue
+			}
+			if exclude != "" && (strings.Contains(terms.name, exclude) || strings.Contains(terms.description, exclude)) {
+				continue
+			}
+			pkg := snap.packages[i]
+			if q.Platform != "" && !slices.Contains(pkg.Platforms, q.Platform) {
+				continue
+			}
+			matches = append(matches, match{pkg: pkg, rank: r})
+		}
+	}
+	c.mu.RUnlock()
+
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if a.rank != b.rank {
+			return a.rank < b.rank
+		}
+		if len(a.pkg.Name) != len(b.pkg.Name) {
+			return len(a.pkg.Name) < len(b.pkg.Name)
+		}
+		return a.pkg.ID < b.pkg.ID
+	})
+
+	packages := make([]Package, 0, min(len(matches), limit))
+	for _, m := range matches[:min(len(matches), limit)] {
+		packages = append(packages, m.pkg)
+	}
+	return packages, len(matches)
+}
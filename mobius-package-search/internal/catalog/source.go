@@ -0,0 +1,97 @@
+package catalog
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Source ingests the packages of a repository from its mirror
+type Source interface {
+	// Name is the source of the packages, such as SourceApt
+	Name() string
+	// Fetch returns every package of the repository
+	Fetch(ctx context.Context) ([]Package, error)
+}
+
+// errNotFound is returned for files missing from a mirror
+var errNotFound = errors.New("not found")
+
+// NewHTTPClient returns the client sources fetch their mirrors with. It
+// also reads file:// URLs, so that a source can ingest a mirror on disk.
+func NewHTTPClient(timeout time.Duration) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.RegisterProtocol("file", http.NewFileTransport(http.Dir("/")))
+	return &http.Client{Transport: transport, Timeout: timeout}
+}
+
+// open fetches a file of a mirror, decompressing it if it is gzipped
+func open(ctx context.Context, client *http.Client, url string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "mobius-package-search")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: %w", url, errNotFound)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: %s", url, resp.Status)
+	}
+
+	br := bufio.NewReader(resp.Body)
+	magic, _ := br.Peek(2)
+	if len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			resp.Body.Close()
+			return nil, fmt.Errorf("%s: %w", url, err)
+		}
+		return readCloser{Reader: gz, closers: []io.Closer{gz, resp.Body}}, nil
+	}
+	return readCloser{Reader: br, closers: []io.Closer{resp.Body}}, nil
+}
+
+// readCloser closes every layer of a decompressed body
+type readCloser struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (r readCloser) Close() error {
+	var errs []error
+	for _, c := range r.closers {
+		errs = append(errs, c.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// latest keeps, of packages with the same ID, the one with the highest
+// version
+func latest(packages map[string]Package, pkg Package) {
+	if existing, ok := packages[pkg.ID]; ok && CompareVersions(existing.Version, pkg.Version) >= 0 {
+		return
+	}
+	packages[pkg.ID] = pkg
+}
+
+// packageList returns the packages of a map
+func packageList(packages map[string]Package) []Package {
+	list := make([]Package, 0, len(packages))
+	for _, pkg := range packages {
+		list = append(list, pkg)
+	}
+	return list
+}
@@ -0,0 +1,72 @@
+package catalog
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// storedSource is the file a source is kept in, in the data directory
+type storedSource struct {
+	Status   SourceStatus `json:"status"`
+	Packages []Package    `json:"packages"`
+}
+
+// path returns the file of a source
+func (c *Catalog) path(name string) string {
+	return filepath.Join(c.dataDir, name+".json")
+}
+
+// load returns the snapshot kept for a source, or an empty one
+func (c *Catalog) load(name string) (*snapshot, error) {
+	empty := newSnapshot(nil, SourceStatus{Source: name})
+	if c.dataDir == "" {
+		return empty, nil
+	}
+
+	data, err := os.ReadFile(c.path(name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return empty, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var stored storedSource
+	if err := json.Unmarshal(data, &stored); err != nil {
+		// A corrupt file is ingested again rather than stopping the
+		// service
+		c.logger.Warn("Ignoring unreadable source file", "source", name, "error", err)
+		return empty, nil
+	}
+	stored.Status.Source = name
+	stored.Status.Ingesting = false
+	return newSnapshot(stored.Packages, stored.Status), nil
+}
+
+// save writes the snapshot of a source, replacing the previous file
+// atomically
+func (c *Catalog) save(snap *snapshot) error {
+	if c.dataDir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(c.dataDir, 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(c.dataDir, snap.status.Source+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	err = json.NewEncoder(tmp).Encode(storedSource{Status: snap.status, Packages: snap.packages})
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path(snap.status.Source))
+}
@@ -0,0 +1,92 @@
+package catalog
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// CompareVersions compares two version strings of any of the sources,
+// returning -1, 0 or 1. Versions are compared segment by segment, numbers
+// numerically and other segments as text, with a Debian epoch ("1:2.0")
+// taking precedence. It orders the versions packages actually use, such
+// as "1.10" after "1.9" and "2.0-1ubuntu2" after "2.0-1ubuntu1", without
+// implementing the rules of every package manager.
+func CompareVersions(a, b string) int {
+	epochA, restA := splitEpoch(a)
+	epochB, restB := splitEpoch(b)
+	if epochA != epochB {
+		if epochA < epochB {
+			return -1
+		}
+		return 1
+	}
+
+	segsA, segsB := versionSegments(restA), versionSegments(restB)
+	for i := 0; i < len(segsA) || i < len(segsB); i++ {
+		switch {
+		case i >= len(segsA):
+			return -1
+		case i >= len(segsB):
+			return 1
+		}
+		if c := compareSegments(segsA[i], segsB[i]); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// splitEpoch splits the epoch off a Debian version
+func splitEpoch(v string) (int, string) {
+	if i := strings.IndexByte(v, ':'); i > 0 {
+		if epoch, err := strconv.Atoi(v[:i]); err == nil {
+			return epoch, v[i+1:]
+		}
+	}
+	return 0, v
+}
+
+// versionSegments splits a version into runs of digits and of letters,
+// dropping separators
+func versionSegments(v string) []string {
+	var segs []string
+	start := -1
+	digits := false
+	for i, r := range v {
+		isDigit, isLetter := unicode.IsDigit(r), unicode.IsLetter(r)
+		if start >= 0 && (!(isDigit || isLetter) || isDigit != digits) {
+			segs = append(segs, v[start:i])
+			start = -1
+		}
+		if start < 0 && (isDigit || isLetter) {
+			start, digits = i, isDigit
+		}
+	}
+	if start >= 0 {
+		segs = append(segs, v[start:])
+	}
+	return segs
+}
+
+// compareSegments compares numbers numerically and sorts them after text,
+// so that "1.0.1" is newer than "1.0.beta"
+func compareSegments(a, b string) int {
+	na, errA := strconv.ParseUint(a, 10, 64)
+	nb, errB := strconv.ParseUint(b, 10, 64)
+	switch {
+	case errA == nil && errB == nil:
+		if na != nb {
+			if na < nb {
+				return -1
+			}
+			return 1
+		}
+		return 0
+	case errA == nil:
+		return 1
+	case errB == nil:
+		return -1
+	}
+	return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+}
@@ -0,0 +1,125 @@
+package catalog
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// wingetMaxManifestSize bounds the manifests read from the archive; real
+// ones are a few kilobytes
+const wingetMaxManifestSize = 1 << 20
+
+// WingetSource ingests the manifests of an archive of the winget-pkgs
+// repository, such as GitHub's tarball of its default branch
+type WingetSource struct {
+	// ArchiveURL is the tar archive of the repository, gzipped or not
+	ArchiveURL string
+	Client     *http.Client
+}
+
+// wingetManifest is the part of a defaultLocale or singleton manifest the
+// catalog uses
+type wingetManifest struct {
+	ManifestType      string `yaml:"ManifestType"`
+	PackageIdentifier string `yaml:"PackageIdentifier"`
+	PackageVersion    string `yaml:"PackageVersion"`
+	PackageName       string `yaml:"PackageName"`
+	Publisher         string `yaml:"Publisher"`
+	PackageURL        string `yaml:"PackageUrl"`
+	PublisherURL      string `yaml:"PublisherUrl"`
+	ShortDescription  string `yaml:"ShortDescription"`
+}
+
+// Name returns SourceWinget
+func (s *WingetSource) Name() string { return SourceWinget }
+
+// Fetch reads the manifests under manifests/, keeping the highest version
+// of every package identifier
+func (s *WingetSource) Fetch(ctx context.Context) ([]Package, error) {
+	body, err := open(ctx, s.Client, s.ArchiveURL)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	packages := make(map[string]Package)
+	tr := tar.NewReader(body)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read archive: %w", err)
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if !isWingetManifest(hdr) {
+			continue
+		}
+
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", hdr.Name, err)
+		}
+		var m wingetManifest
+		if err := yaml.Unmarshal(data, &m); err != nil {
+			// A malformed manifest is skipped rather than failing the
+			// whole repository
+			continue
+		}
+		if pkg, ok := wingetPackage(&m); ok {
+			latest(packages, pkg)
+		}
+	}
+	return packageList(packages), nil
+}
+
+// isWingetManifest reports whether an archive entry may be a defaultLocale
+// or singleton manifest. Installer manifests never are.
+func isWingetManifest(hdr *tar.Header) bool {
+	if hdr.Typeflag != tar.TypeReg || hdr.Size > wingetMaxManifestSize {
+		return false
+	}
+	name := hdr.Name
+	return strings.Contains(name, "manifests/") && path.Ext(name) == ".yaml" &&
+		!strings.HasSuffix(name, ".installer.yaml")
+}
+
+// wingetPackage builds a package of a defaultLocale or singleton manifest
+func wingetPackage(m *wingetManifest) (Package, bool) {
+	if m.ManifestType != "defaultLocale" && m.ManifestType != "singleton" {
+		return Package{}, false
+	}
+	if m.PackageIdentifier == "" {
+		return Package{}, false
+	}
+	name := m.PackageName
+	if name == "" {
+		name = m.PackageIdentifier
+	}
+	homepage := m.PackageURL
+	if homepage == "" {
+		homepage = m.PublisherURL
+	}
+	return Package{
+		ID:          SourceWinget + ":" + m.PackageIdentifier,
+		Source:      SourceWinget,
+		Name:        name,
+		Version:     m.PackageVersion,
+		Publisher:   m.Publisher,
+		Description: m.ShortDescription,
+		Homepage:    homepage,
+		Platforms:   []string{PlatformWindows},
+		Install:     Install{Manager: ManagerWinget, Identifier: m.PackageIdentifier},
+	}, true
+}
@@ -1,58 +1,133 @@
 package main
 
 import (
-	"fmt"
-	"log"
+	"context"
+	"errors"
+	"flag"
+	"log/slog"
 	"net/http"
-	"os/exec"
-	"path/filepath"
+	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
+
+	"packageSearch/internal/catalog"
 )
 
-type SearchRequest struct {
-	Search  string `json:"search"`
-	Exclude string `json:"exclude"`
-	Section string `json:"section"`
-}
+func main() {
+	addr := flag.String("addr", ":"+envOrDefault("PORT", "8080"), "Address to listen on")
+	dataDir := flag.String("data-dir", envOrDefault("PACKAGE_SEARCH_DATA_DIR", "data"), "Directory the ingested packages are kept in across restarts")
+	interval := flag.Duration("interval", envDurationOrDefault("PACKAGE_SEARCH_INTERVAL", catalog.DefaultInterval), "How often sources are ingested")
+	fetchTimeout := flag.Duration("fetch-timeout", envDurationOrDefault("PACKAGE_SEARCH_FETCH_TIMEOUT", 30*time.Minute), "How long the ingestion of a source may take")
+	sources := flag.String("sources", envOrDefault("PACKAGE_SEARCH_SOURCES", "apt,flatpak,homebrew,winget"), "Comma-separated sources to ingest")
+	aptMirror := flag.String("apt-mirror", envOrDefault("APT_MIRROR", "http://archive.ubuntu.com/ubuntu"), "Base URL of the apt repository")
+	aptSuites := flag.String("apt-suites", envOrDefault("APT_SUITES", "noble,noble-updates"), "Comma-separated apt suites")
+	aptComponents := flag.String("apt-components", envOrDefault("APT_COMPONENTS", "main,universe"), "Comma-separated apt components")
+	aptArch := flag.String("apt-arch", envOrDefault("APT_ARCH", "amd64"), "Architecture of the apt packages")
+	flatpakAppStream := flag.String("flatpak-appstream", envOrDefault("FLATPAK_APPSTREAM_URL", "https://dl.flathub.org/repo/appstream/x86_64/appstream.xml.gz"), "AppStream metadata of the flatpak remote")
+	flatpakRemote := flag.String("flatpak-remote", envOrDefault("FLATPAK_REMOTE", "flathub"), "Name of the flatpak remote applications install from")
+	homebrewAPI := flag.String("homebrew-api", envOrDefault("HOMEBREW_API_URL", "https://formulae.brew.sh/api"), "Base URL of the Homebrew JSON API")
+	wingetArchive := flag.String("winget-archive", envOrDefault("WINGET_ARCHIVE_URL", "https://github.com/microsoft/winget-pkgs/archive/refs/heads/master.tar.gz"), "Tar archive of the winget-pkgs repository")
+	debug := flag.Bool("debug", os.Getenv("PACKAGE_SEARCH_DEBUG") == "true", "Log debug messages")
+	flag.Parse()
 
-type SearchResult struct {
-	Output interface{} `json:"output"`
-	Error  string      `json:"error,omitempty"`
-}
+	level := slog.LevelInfo
+	if *debug {
+		level = slog.LevelDebug
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+
+	client := catalog.NewHTTPClient(*fetchTimeout)
+	available := map[string]catalog.Source{
+		catalog.SourceApt: &catalog.AptSource{
+			Mirror:     *aptMirror,
+			Suites:     splitList(*aptSuites),
+			Components: splitList(*aptComponents),
+			Arch:       *aptArch,
+			Client:     client,
+		},
+		catalog.SourceFlatpak:  &catalog.FlatpakSource{AppStreamURL: *flatpakAppStream, Remote: *flatpakRemote, Client: client},
+		catalog.SourceHomebrew: &catalog.HomebrewSource{API: *homebrewAPI, Client: client},
+		catalog.SourceWinget:   &catalog.WingetSource{ArchiveURL: *wingetArchive, Client: client},
+	}
+	var enabled []catalog.Source
+	for _, name := range splitList(*sources) {
+		src, ok := available[name]
+		if !ok {
+			logger.Error("Unknown source", "source", name)
+			os.Exit(2)
+		}
+		enabled = append(enabled, src)
+	}
+
+	cat, err := catalog.New(catalog.Config{
+		Sources:  enabled,
+		DataDir:  *dataDir,
+		Interval: *interval,
+		Logger:   logger,
+	})
+	if err != nil {
+		logger.Error("Failed to load catalog", "error", err)
+		os.Exit(1)
+	}
 
-func runScript(script string, search, exclude string, section string) (string, error) {
-	args := []string{
-		fmt.Sprintf("--search=%s", search),
-		fmt.Sprintf("--exclude=%s", exclude),
+	srv := &http.Server{
+		Addr:              *addr,
+		Handler:           newHandler(cat),
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		WriteTimeout:      60 * time.Second,
+		IdleTimeout:       120 * time.Second,
 	}
-	if strings.Contains(script, "apt") {
-		args = append(args, "--arch=amd64")
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		cat.Run(ctx)
+	}()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx) //nolint:errcheck
+	}()
+
+	logger.Info("Starting package search", "addr", *addr, "sources", *sources, "data_dir", *dataDir)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.Error("Package search stopped", "error", err)
+		os.Exit(1)
 	}
-	if len(section) > 0 {
-		args = append(args, fmt.Sprintf("--section=%s", section))
+	<-done
+}
+
+// splitList splits a comma-separated flag, dropping empty items
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
 	}
-	cmd := exec.Command(filepath.Join("internal/", script), args...)
-	output, err := cmd.CombinedOutput()
-	return string(output), err
+	return items
 }
 
-func updateHandler(w http.ResponseWriter, r *http.Request) {
-	cmd := exec.Command("bash", "-c", "apt update && flatpak update")
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		_, _ = w.Write([]byte(err.Error()))
+// envOrDefault returns the value of the environment variable key, or def if
+// unset
+func envOrDefault(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
 	}
-	_, _ = w.Write(output)
+	return def
 }
 
-func main() {
-	http.HandleFunc("/search/apt", aptHandler)
-	http.HandleFunc("/search/flatpak", flatpakHandler)
-	http.HandleFunc("/update", updateHandler)
-	http.HandleFunc("/search/windows", windowsHandler)
-	http.HandleFunc("/search/homebrew", homebrewHandler)
-
-	fmt.Println("Server running on port 8080...")
-	log.Fatal(http.ListenAndServe(":8080", nil))
+// envDurationOrDefault returns the duration in the environment variable
+// key, or def if unset or not a duration
+func envDurationOrDefault(key string, def time.Duration) time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(key)); err == nil {
+		return d
+	}
+	return def
 }
@@ -0,0 +1,188 @@
+package api_test
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/notawar/mobius/mobius-server/api"
+	"github.com/notawar/mobius/mobius-server/pkg/blobstore"
+	"github.com/notawar/mobius/mobius-server/pkg/database"
+	"github.com/notawar/mobius/mobius-server/pkg/service"
+)
+
+// testPassword is the password of the users of test servers
+const testPassword = "correct-horse-battery-1"
+
+// testServer serves the API over the services of a SQLite database, as
+// mobius-api-server does with -storage sqlite
+type testServer struct {
+	*httptest.Server
+	deps *api.Dependencies
+	// users counts the users created, to give each a unique email
+	users int
+}
+
+// newTestServer starts a test server. configure, when given, changes the
+// dependencies before the router is built.
+func newTestServer(t *testing.T, configure ...func(*api.Dependencies)) *testServer {
+	t.Helper()
+
+	db, err := database.Open(database.Config{
+		Driver: database.DriverSQLite,
+		Path:   filepath.Join(t.TempDir(), "mobius.db"),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error opening database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	tokens, err := service.NewTokenIssuer(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	signer, err := service.NewURLSigner(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	packages, err := blobstore.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	authService := database.NewAuthService(db, tokens)
+	deps := &api.Dependencies{
+		LicenseService:            service.NewLicenseService(),
+		DeviceService:             database.NewDeviceService(db),
+		DeviceGroupService:        database.NewDeviceGroupService(db),
+		PolicyService:             database.NewPolicyService(db),
+		ApplicationService:        database.NewApplicationService(db, packages),
+		AuthService:               authService,
+		UserService:               authService,
+		GroupService:              database.NewGroupService(db),
+		CommandService:            database.NewCommandService(db),
+		LiveQueryService:          database.NewLiveQueryService(db),
+		EnrollmentService:         database.NewEnrollmentService(db),
+		ComplianceService:         database.NewComplianceService(db),
+		AuditService:              database.NewAuditService(db),
+		BulkOperationService:      database.NewBulkOperationService(db),
+		ApplicationRequestService: database.NewApplicationRequestService(db),
+		DownloadSigner:            signer,
+	}
+	for _, configure := range configure {
+		configure(deps)
+	}
+
+	server := &testServer{Server: httptest.NewServer(api.NewRouter(deps)), deps: deps}
+	t.Cleanup(server.Close)
+	return server
+}
+
+// withLicense licenses a test server for a tier, with a key of its own
+func withLicense(t *testing.T, tier string) func(*api.Dependencies) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	license, err := service.SignLicense(key, service.LicenseClaims{Tier: tier, DeviceLimit: -1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	licenses := service.NewLicenseServiceWithKey(&key.PublicKey)
+	if err := licenses.UpdateLicense(license); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return func(deps *api.Dependencies) {
+		deps.LicenseService = licenses
+	}
+}
+
+// createUser creates a user with role, limited to groupIDs when given, and
+// returns them with a token of theirs
+func (s *testServer) createUser(t *testing.T, role string, groupIDs ...string) (*api.User, string) {
+	t.Helper()
+
+	s.users++
+	email := fmt.Sprintf("user%d@example.com", s.users)
+	user, err := s.deps.UserService.CreateUser(api.UserCreate{
+		Email:          email,
+		Name:           role,
+		Role:           role,
+		DeviceGroupIDs: groupIDs,
+		Password:       testPassword,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	auth, err := s.deps.AuthService.Login(email, testPassword)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return user, auth.Token
+}
+
+// do sends a request to the API with token, if any, and body encoded as
+// JSON unless it is a string
+func (s *testServer) do(t *testing.T, method, path, token string, body interface{}, header ...string) *http.Response {
+	t.Helper()
+
+	var reader io.Reader
+	switch body := body.(type) {
+	case nil:
+	case string:
+		reader = bytes.NewBufferString(body)
+	default:
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, s.URL+"/api/v1"+path, reader)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if reader != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+// decode checks the status of a response and decodes its JSON body into v
+func decode(t *testing.T, resp *http.Response, status int, v interface{}) {
+	t.Helper()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.StatusCode != status {
+		t.Fatalf("expected status %d, got %d: %s", status, resp.StatusCode, body)
+	}
+	if v != nil {
+		if err := json.Unmarshal(body, v); err != nil {
+			t.Fatalf("unexpected error decoding %s: %v", body, err)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Audit trail
+//
+// Handlers record the actions taken through the API with audit: logins,
+// changes to users, the license, devices, device groups, policies,
+// applications and enrollment secrets, device commands, live queries and
+// denied requests. The actor is taken from the request context, the target
+// and the before/after state from the handler.
+
+// DefaultAuditLimit and MaxAuditLimit bound the entries of an audit page
+const (
+	DefaultAuditLimit = 100
+	MaxAuditLimit     = 1000
+)
+
+// auditRedacted replaces the values of sensitive fields in audit changes
+const auditRedacted = "[redacted]"
+
+// auditSensitiveFields are never written to the audit trail; a change to
+// one only records that it changed
+var auditSensitiveFields = map[string]bool{
+	"password":      true,
+	"secret":        true,
+	"key":           true,
+	"token":         true,
+	"refresh_token": true,
+	"device_token":  true,
+}
+
+// auditIgnoredFields change with every write and would only add noise
+var auditIgnoredFields = map[string]bool{
+	"updated_at": true,
+}
+
+// auditRecord describes an audited action. Before and After are snapshots of
+// the target, nil when it did not exist; their top-level fields are compared
+// into the changes of the entry.
+type auditRecord struct {
+	Action     string
+	TargetType string
+	TargetID   string
+	Outcome    string // Defaults to success
+	Reason     string
+	Before     interface{}
+	After      interface{}
+	// Changes are added to those of the snapshots, for fields they omit
+	Changes []AuditChange
+	Details map[string]interface{}
+	// Actor overrides the user or device of the request context, for
+	// requests that authenticate in the handler
+	Actor *AuditActor
+}
+
+// audit records an action in the audit trail. Failing to record it is
+// logged and does not fail the request.
+func (d *Dependencies) audit(r *http.Request, rec auditRecord) {
+	if d.AuditService == nil {
+		return
+	}
+
+	limits := d.RateLimits
+	if limits == nil {
+		limits = &RateLimits{}
+	}
+
+	entry := &AuditEntry{
+		Actor:      auditActor(r, rec.Actor),
+		Action:     rec.Action,
+		TargetType: rec.TargetType,
+		TargetID:   rec.TargetID,
+		Outcome:    rec.Outcome,
+		Reason:     rec.Reason,
+		Request: AuditRequest{
+			Method:    r.Method,
+			Path:      r.URL.Path,
+			ClientIP:  limits.clientIP(r),
+			UserAgent: r.UserAgent(),
+		},
+		Changes: append(auditChanges(rec.Before, rec.After), rec.Changes...),
+		Details: rec.Details,
+	}
+	if entry.Outcome == "" {
+		entry.Outcome = AuditOutcomeSuccess
+	}
+
+	if err := d.AuditService.RecordAudit(entry); err != nil {
+		log.Error().
+			Err(err).
+			Str("action", rec.Action).
+			Str("target_id", rec.TargetID).
+			Msg("Failed to record audit entry")
+	}
+}
+
+// auditLogin records a login attempt. Failed attempts have an anonymous actor
+// with the email that was tried.
+func (d *Dependencies) auditLogin(r *http.Request, email string, resp *AuthResponse, err error) {
+	if err != nil || resp == nil || resp.User == nil {
+		d.audit(r, auditRecord{
+			Action:  "auth.login",
+			Outcome: AuditOutcomeFailure,
+			Reason:  "invalid credentials",
+			Actor:   &AuditActor{Type: AuditActorAnonymous, Email: email},
+		})
+		return
+	}
+
+	user := resp.User
+	d.audit(r, auditRecord{
+		Action:     "auth.login",
+		TargetType: "user",
+		TargetID:   user.ID,
+		Actor:      &AuditActor{Type: AuditActorUser, ID: user.ID, Email: user.Email, Role: user.Role},
+	})
+}
+
+// auditActor returns the actor of a request: the override when given, else
+// the authenticated user or device
+func auditActor(r *http.Request, override *AuditActor) AuditActor {
+	if override != nil {
+		return *override
+	}
+	if user, err := GetUserFromContext(r); err == nil {
+		return AuditActor{Type: AuditActorUser, ID: user.ID, Email: user.Email, Role: user.Role}
+	}
+	if device, err := GetDeviceFromContext(r); err == nil {
+		return AuditActor{Type: AuditActorDevice, ID: device.ID}
+	}
+	return AuditActor{Type: AuditActorAnonymous}
+}
+
+// auditChanges compares the top-level JSON fields of two snapshots
+func auditChanges(before, after interface{}) []AuditChange {
+	beforeFields := auditFields(before)
+	afterFields := auditFields(after)
+
+	names := make([]string, 0, len(beforeFields)+len(afterFields))
+	for name := range beforeFields {
+		names = append(names, name)
+	}
+	for name := range afterFields {
+		if _, ok := beforeFields[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var changes []AuditChange
+	for _, name := range names {
+		if auditIgnoredFields[name] {
+			continue
+		}
+		oldValue, newValue := beforeFields[name], afterFields[name]
+		if reflect.DeepEqual(oldValue, newValue) {
+			continue
+		}
+		if auditSensitiveFields[name] {
+			oldValue, newValue = redactAuditValue(oldValue), redactAuditValue(newValue)
+		}
+		changes = append(changes, AuditChange{Field: name, Before: oldValue, After: newValue})
+	}
+	return changes
+}
+
+// auditFields returns the top-level JSON fields of a snapshot, or nil when it
+// is nil or not a JSON object
+func auditFields(v interface{}) map[string]interface{} {
+	if v == nil {
+		return nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil
+	}
+	return fields
+}
+
+func redactAuditValue(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	return auditRedacted
+}
+
+// handleListAuditEntries lists audit entries, newest first, a page at a time
+func (d *Dependencies) handleListAuditEntries(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filters := AuditFilters{
+		ActorID:    query.Get("actor_id"),
+		ActorType:  query.Get("actor_type"),
+		Action:     query.Get("action"),
+		TargetType: query.Get("target_type"),
+		TargetID:   query.Get("target_id"),
+		Outcome:    query.Get("outcome"),
+		Cursor:     query.Get("cursor"),
+		Limit:      DefaultAuditLimit,
+	}
+
+	if limitStr := query.Get("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 || limit > MaxAuditLimit {
+			WriteError(w, http.StatusBadRequest, "Limit must be between 1 and "+strconv.Itoa(MaxAuditLimit))
+			return
+		}
+		filters.Limit = limit
+	}
+	for _, bound := range []struct {
+		name string
+		dest **time.Time
+	}{{"since", &filters.Since}, {"until", &filters.Until}} {
+		value := query.Get(bound.name)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, "Invalid "+bound.name+" time, expected RFC 3339")
+			return
+		}
+		*bound.dest = &t
+	}
+
+	page, err := d.AuditService.ListAuditEntries(filters)
+	if err != nil {
+		if errors.Is(err, ErrInvalidAuditCursor) {
+			WriteError(w, http.StatusBadRequest, "Invalid cursor")
+			return
+		}
+		log.Error().Err(err).Msg("Failed to list audit entries")
+		WriteError(w, http.StatusInternalServerError, "Failed to list audit entries")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, page)
+}
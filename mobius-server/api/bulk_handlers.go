@@ -0,0 +1,560 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog/log"
+)
+
+// Bulk device operations
+//
+// A bulk operation applies one action to every device a selector matches.
+// Creating one resolves the selector, records the operation and returns it
+// while the action runs in the background; callers poll the operation for
+// its progress and the devices it failed on. Actions skip devices already in
+// the requested state, so an operation can be repeated after a partial
+// failure.
+
+// handleListBulkOperations lists bulk operations newest first. Users scoped
+// to device groups only see their own operations.
+func (d *Dependencies) handleListBulkOperations(w http.ResponseWriter, r *http.Request) {
+	q, ok := readListQuery(w, r, bulkOperationListSpec)
+	if !ok {
+		return
+	}
+
+	user, err := GetUserFromContext(r)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, "User context required")
+		return
+	}
+
+	if user.IsScoped() {
+		q.Filters = append(q.Filters, ListFilter{Field: "created_by", Op: "eq", Operands: []interface{}{user.ID}})
+	}
+
+	var query func(*ListQuery) ([]*BulkOperation, int, error)
+	if querier, ok := d.BulkOperationService.(BulkOperationQuerier); ok {
+		query = querier.QueryBulkOperations
+	}
+	result, err := listItems(q, bulkOperationListSpec, query, d.BulkOperationService.ListBulkOperations)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list bulk operations")
+		WriteError(w, http.StatusInternalServerError, "Failed to list bulk operations")
+		return
+	}
+
+	writeList(w, "operations", result)
+}
+
+// handleCreateBulkOperation starts a bulk operation, or previews the devices
+// it would apply to for a dry run
+func (d *Dependencies) handleCreateBulkOperation(w http.ResponseWriter, r *http.Request) {
+	var req BulkOperationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	user, ok := d.requireBulkAction(w, r, req.Action)
+	if !ok {
+		return
+	}
+
+	devices, ok := d.selectDevices(w, r, user, req.Selector)
+	if !ok {
+		return
+	}
+	if len(devices) > MaxBulkDevices {
+		WriteError(w, http.StatusBadRequest, fmt.Sprintf("Selector matches %d devices, more than the limit of %d", len(devices), MaxBulkDevices))
+		return
+	}
+
+	if req.DryRun {
+		preview := &BulkOperationPreview{DryRun: true, Action: req.Action, Total: len(devices), Devices: devices}
+		if len(preview.Devices) > MaxListLimit {
+			preview.Devices = preview.Devices[:MaxListLimit]
+		}
+		WriteJSON(w, http.StatusOK, preview)
+		return
+	}
+	if len(devices) == 0 {
+		WriteError(w, http.StatusBadRequest, "Selector matches no devices")
+		return
+	}
+
+	op, err := d.BulkOperationService.CreateBulkOperation(BulkOperationCreate{
+		Action:    req.Action,
+		Selector:  req.Selector,
+		Total:     len(devices),
+		CreatedBy: user.ID,
+	})
+	if err != nil {
+		log.Error().Err(err).Str("user_id", user.ID).Msg("Failed to create bulk operation")
+		WriteError(w, http.StatusInternalServerError, "Failed to create bulk operation")
+		return
+	}
+
+	log.Info().
+		Str("operation_id", op.ID).
+		Str("action", op.Action.Type).
+		Int("devices", op.Total).
+		Str("user_id", user.ID).
+		Msg("Bulk operation started")
+
+	d.audit(r, auditRecord{
+		Action:     "bulk_operation.create",
+		TargetType: "bulk_operation",
+		TargetID:   op.ID,
+		Details: map[string]interface{}{
+			"action":   op.Action,
+			"selector": op.Selector,
+			"devices":  op.Total,
+		},
+	})
+
+	// The operation outlives the request; its audit entries keep the caller
+	go d.runBulkOperation(r.Clone(context.WithoutCancel(r.Context())), user, op, devices)
+
+	WriteJSON(w, http.StatusAccepted, op)
+}
+
+// handleGetBulkOperation returns the progress and failures of a bulk operation
+func (d *Dependencies) handleGetBulkOperation(w http.ResponseWriter, r *http.Request) {
+	op, ok := d.loadBulkOperation(w, r)
+	if !ok {
+		return
+	}
+	WriteJSON(w, http.StatusOK, op)
+}
+
+// handleCancelBulkOperation stops a running bulk operation before the devices
+// it has yet to process. Cancelling needs the permissions of its action.
+func (d *Dependencies) handleCancelBulkOperation(w http.ResponseWriter, r *http.Request) {
+	op, ok := d.loadBulkOperation(w, r)
+	if !ok {
+		return
+	}
+	for _, perm := range bulkActionPermissions(op.Action) {
+		if _, ok := d.requirePermission(w, r, perm); !ok {
+			return
+		}
+	}
+
+	cancelled, err := d.BulkOperationService.CancelBulkOperation(op.ID)
+	if errors.Is(err, ErrBulkOperationFinished) {
+		WriteError(w, http.StatusConflict, "Bulk operation already finished")
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Str("operation_id", op.ID).Msg("Failed to cancel bulk operation")
+		WriteError(w, http.StatusInternalServerError, "Failed to cancel bulk operation")
+		return
+	}
+
+	log.Info().Str("operation_id", op.ID).Int("processed", cancelled.Processed).Msg("Bulk operation cancelled")
+	d.audit(r, auditRecord{
+		Action:     "bulk_operation.cancel",
+		TargetType: "bulk_operation",
+		TargetID:   op.ID,
+		Details:    map[string]interface{}{"processed": cancelled.Processed, "total": cancelled.Total},
+	})
+
+	WriteJSON(w, http.StatusOK, cancelled)
+}
+
+// loadBulkOperation returns the operation of the operationId route variable,
+// writing 404 when it does not exist or belongs to another user and the
+// caller is scoped to device groups
+func (d *Dependencies) loadBulkOperation(w http.ResponseWriter, r *http.Request) (*BulkOperation, bool) {
+	user, err := GetUserFromContext(r)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, "User context required")
+		return nil, false
+	}
+
+	op, err := d.BulkOperationService.GetBulkOperation(mux.Vars(r)["operationId"])
+	if err != nil || (user.IsScoped() && op.CreatedBy != user.ID) {
+		WriteError(w, http.StatusNotFound, "Bulk operation not found")
+		return nil, false
+	}
+	return op, true
+}
+
+// bulkActionPermissions returns the permissions an action needs, those of the
+// endpoints that apply it to a single device
+func bulkActionPermissions(action BulkAction) []Permission {
+	switch action.Type {
+	case BulkActionCommand:
+		if action.Command == "wipe" {
+			return []Permission{PermDevicesCommand, PermDevicesWipe}
+		}
+		return []Permission{PermDevicesCommand}
+	case BulkActionAssignPolicy, BulkActionUnassignPolicy:
+		return []Permission{PermPoliciesWrite}
+	case BulkActionMoveToGroup:
+		return []Permission{PermDeviceGroupsWrite}
+	default:
+		return []Permission{PermDevicesWrite}
+	}
+}
+
+// requireBulkAction validates an action and writes an error response unless
+// the caller may apply it
+func (d *Dependencies) requireBulkAction(w http.ResponseWriter, r *http.Request, action BulkAction) (*User, bool) {
+	switch action.Type {
+	case BulkActionCommand:
+		if !validCommands[action.Command] {
+			WriteError(w, http.StatusBadRequest, "Invalid command")
+			return nil, false
+		}
+		if action.ExpiresIn < 0 {
+			WriteError(w, http.StatusBadRequest, "expires_in must not be negative")
+			return nil, false
+		}
+	case BulkActionAssignPolicy, BulkActionUnassignPolicy:
+		if action.PolicyID == "" {
+			WriteError(w, http.StatusBadRequest, "policy_id is required")
+			return nil, false
+		}
+	case BulkActionUpdateLabels:
+		if len(action.Labels) == 0 && len(action.RemoveLabels) == 0 {
+			WriteError(w, http.StatusBadRequest, "labels or remove_labels is required")
+			return nil, false
+		}
+	case BulkActionMoveToGroup:
+		if action.GroupID == "" {
+			WriteError(w, http.StatusBadRequest, "group_id is required")
+			return nil, false
+		}
+	case BulkActionUnenroll:
+	default:
+		WriteError(w, http.StatusBadRequest, "Invalid action type")
+		return nil, false
+	}
+
+	var user *User
+	for _, perm := range bulkActionPermissions(action) {
+		var ok bool
+		if user, ok = d.requirePermission(w, r, perm); !ok {
+			return nil, false
+		}
+	}
+
+	switch action.Type {
+	case BulkActionAssignPolicy, BulkActionUnassignPolicy:
+		if _, err := d.PolicyService.GetPolicy(action.PolicyID); err != nil {
+			WriteError(w, http.StatusNotFound, "Policy not found")
+			return nil, false
+		}
+	case BulkActionMoveToGroup:
+		for _, groupID := range append([]string{action.GroupID}, action.FromGroupIDs...) {
+			if !d.requireManualGroup(w, groupID) {
+				return nil, false
+			}
+			if user.IsScoped() && !groupInScope(user, groupID) {
+				d.auditDenied(r, user, PermDeviceGroupsWrite, "device group outside scope")
+				WriteError(w, http.StatusForbidden, "Device group is outside your device groups")
+				return nil, false
+			}
+		}
+	}
+	return user, true
+}
+
+// selectDevices resolves a selector into the devices it matches, in
+// enrollment order. Listing devices or groups outside the scope of the caller
+// is forbidden; the other selectors only match devices in scope.
+func (d *Dependencies) selectDevices(w http.ResponseWriter, r *http.Request, user *User, selector DeviceSelector) ([]*Device, bool) {
+	if len(selector.DeviceIDs) == 0 && len(selector.GroupIDs) == 0 && len(selector.Labels) == 0 &&
+		selector.Search == "" && len(selector.Filters) == 0 {
+		WriteError(w, http.StatusBadRequest, "Selector must name devices, groups, labels, a search or filters")
+		return nil, false
+	}
+
+	// Filters use the syntax of the device list query, without its paging
+	values := make(url.Values, len(selector.Filters))
+	for name, value := range selector.Filters {
+		if listParams[name] {
+			WriteError(w, http.StatusBadRequest, fmt.Sprintf("Selector filters cannot include %q", name))
+			return nil, false
+		}
+		values.Set(name, value)
+	}
+	q, err := parseListQuery(values, deviceListSpec)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid selector filters: "+err.Error())
+		return nil, false
+	}
+
+	selected := make(map[string]bool)
+	for _, deviceID := range selector.DeviceIDs {
+		if _, err := d.DeviceService.GetDevice(deviceID); err != nil {
+			WriteError(w, http.StatusBadRequest, fmt.Sprintf("Device %s not found", deviceID))
+			return nil, false
+		}
+		if !d.requireDeviceInScope(w, r, PermDevicesRead, deviceID) {
+			return nil, false
+		}
+		selected[deviceID] = true
+	}
+	for _, groupID := range selector.GroupIDs {
+		if user.IsScoped() && !groupInScope(user, groupID) {
+			d.auditDenied(r, user, PermDevicesRead, "device group outside scope")
+			WriteError(w, http.StatusForbidden, "Device group is outside your device groups")
+			return nil, false
+		}
+		members, err := d.DeviceGroupService.GetGroupDevices(groupID)
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, fmt.Sprintf("Device group %s not found", groupID))
+			return nil, false
+		}
+		for _, device := range members {
+			selected[device.ID] = true
+		}
+	}
+
+	filters := DeviceFilters{Search: selector.Search}
+	scope, err := d.scopedDeviceIDs(user)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to resolve device scope")
+		WriteError(w, http.StatusInternalServerError, "Failed to select devices")
+		return nil, false
+	}
+	if scope != nil {
+		filters.DeviceIDs = make([]string, 0, len(scope))
+		for id := range scope {
+			filters.DeviceIDs = append(filters.DeviceIDs, id)
+		}
+	}
+	candidates, err := d.findDevices(filters)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to select devices")
+		WriteError(w, http.StatusInternalServerError, "Failed to select devices")
+		return nil, false
+	}
+
+	// Devices, groups and labels add to the selection; without them every
+	// device is selected. The search and filters then narrow it.
+	union := len(selector.DeviceIDs) > 0 || len(selector.GroupIDs) > 0 || len(selector.Labels) > 0
+	devices := make([]*Device, 0)
+	for _, device := range candidates {
+		if union && !selected[device.ID] && (len(selector.Labels) == 0 || !matchesLabels(device, selector.Labels)) {
+			continue
+		}
+		if !matchesListFilters(device, deviceListSpec, q.Filters) {
+			continue
+		}
+		devices = append(devices, device)
+	}
+	return devices, true
+}
+
+// runBulkOperation applies the action of an operation to each device until
+// every device is processed or the operation is cancelled
+func (d *Dependencies) runBulkOperation(r *http.Request, user *User, op *BulkOperation, devices []*Device) {
+	for _, device := range devices {
+		current, err := d.BulkOperationService.GetBulkOperation(op.ID)
+		if err != nil {
+			log.Error().Err(err).Str("operation_id", op.ID).Msg("Failed to check bulk operation")
+			break
+		}
+		// Cancelled and interrupted operations stop
+		if current.Status != BulkStatusRunning {
+			break
+		}
+
+		errMsg := ""
+		if err := d.applyBulkAction(r, user, op, device); err != nil {
+			errMsg = err.Error()
+			log.Debug().Err(err).Str("operation_id", op.ID).Str("device_id", device.ID).Msg("Bulk action failed")
+		}
+		if err := d.BulkOperationService.RecordBulkResult(op.ID, device.ID, errMsg); err != nil {
+			log.Error().Err(err).Str("operation_id", op.ID).Str("device_id", device.ID).Msg("Failed to record bulk result")
+		}
+	}
+
+	finished, err := d.BulkOperationService.FinishBulkOperation(op.ID)
+	if err != nil {
+		log.Error().Err(err).Str("operation_id", op.ID).Msg("Failed to finish bulk operation")
+		return
+	}
+	log.Info().
+		Str("operation_id", op.ID).
+		Str("status", finished.Status).
+		Int("succeeded", finished.Succeeded).
+		Int("failed", finished.Failed).
+		Msg("Bulk operation finished")
+}
+
+// applyBulkAction applies the action of an operation to one device, with the
+// side effects and audit entries of the single-device endpoint
+func (d *Dependencies) applyBulkAction(r *http.Request, user *User, op *BulkOperation, device *Device) error {
+	action := op.Action
+	details := func(extra map[string]interface{}) map[string]interface{} {
+		extra["bulk_operation_id"] = op.ID
+		return extra
+	}
+
+	switch action.Type {
+	case BulkActionCommand:
+		command, err := d.CommandService.EnqueueCommand(device.ID, CommandCreate{
+			Command:    action.Command,
+			Parameters: action.Parameters,
+			TTL:        time.Duration(action.ExpiresIn) * time.Second,
+			CreatedBy:  user.ID,
+		})
+		if err != nil {
+			return err
+		}
+		d.audit(r, auditRecord{
+			Action:     "device." + command.Command,
+			TargetType: "device",
+			TargetID:   device.ID,
+			Details: details(map[string]interface{}{
+				"command_id": command.ID,
+				"parameters": command.Parameters,
+				"expires_at": command.ExpiresAt,
+			}),
+		})
+
+	case BulkActionAssignPolicy, BulkActionUnassignPolicy:
+		policies, err := d.PolicyService.GetDevicePolicies(device.ID)
+		if err != nil {
+			return err
+		}
+		assigned := false
+		for _, policy := range policies {
+			assigned = assigned || policy.ID == action.PolicyID
+		}
+		assign := action.Type == BulkActionAssignPolicy
+		if assigned == assign {
+			return nil
+		}
+		auditAction := "policy.assign"
+		if assign {
+			err = d.PolicyService.AssignPolicyToDevice(action.PolicyID, device.ID)
+		} else {
+			auditAction = "policy.unassign"
+			err = d.PolicyService.UnassignPolicyFromDevice(action.PolicyID, device.ID)
+		}
+		if err != nil {
+			return err
+		}
+		d.audit(r, auditRecord{
+			Action:     auditAction,
+			TargetType: "policy",
+			TargetID:   action.PolicyID,
+			Details:    details(map[string]interface{}{"device_id": device.ID}),
+		})
+
+	case BulkActionUpdateLabels:
+		before, err := d.DeviceService.GetDevice(device.ID)
+		if err != nil {
+			return err
+		}
+		labels := make(map[string]string, len(before.Labels)+len(action.Labels))
+		for key, value := range before.Labels {
+			labels[key] = value
+		}
+		for key, value := range action.Labels {
+			labels[key] = value
+		}
+		for _, key := range action.RemoveLabels {
+			delete(labels, key)
+		}
+		updated, err := d.DeviceService.UpdateDevice(device.ID, DeviceUpdates{Labels: &labels})
+		if err != nil {
+			return err
+		}
+		d.evaluateDeviceGroups(updated)
+		d.audit(r, auditRecord{
+			Action:     "device.update",
+			TargetType: "device",
+			TargetID:   device.ID,
+			Before:     before,
+			After:      updated,
+			Details:    details(map[string]interface{}{}),
+		})
+
+	case BulkActionMoveToGroup:
+		groups, err := d.DeviceGroupService.GetDeviceGroups(device.ID)
+		if err != nil {
+			return err
+		}
+		member := false
+		var leave []string
+		for _, group := range groups {
+			switch {
+			case group.ID == action.GroupID:
+				member = true
+			case bulkMoveLeaves(user, action, group):
+				leave = append(leave, group.ID)
+			}
+		}
+		if !member {
+			if err := d.DeviceGroupService.AddDeviceToGroup(action.GroupID, device.ID); err != nil {
+				return err
+			}
+			d.audit(r, auditRecord{
+				Action:     "device_group.add_device",
+				TargetType: "device_group",
+				TargetID:   action.GroupID,
+				Details:    details(map[string]interface{}{"device_id": device.ID}),
+			})
+		}
+		for _, groupID := range leave {
+			if err := d.DeviceGroupService.RemoveDeviceFromGroup(groupID, device.ID); err != nil {
+				return err
+			}
+			d.audit(r, auditRecord{
+				Action:     "device_group.remove_device",
+				TargetType: "device_group",
+				TargetID:   groupID,
+				Details:    details(map[string]interface{}{"device_id": device.ID}),
+			})
+		}
+
+	case BulkActionUnenroll:
+		before, err := d.DeviceService.GetDevice(device.ID)
+		if err != nil {
+			return err
+		}
+		if err := d.DeviceService.UnenrollDevice(device.ID); err != nil {
+			return err
+		}
+		if err := d.AuthService.RevokeDeviceToken(device.ID); err != nil {
+			log.Error().Err(err).Str("device_id", device.ID).Msg("Failed to revoke device token")
+		}
+		d.audit(r, auditRecord{
+			Action:     "device.unenroll",
+			TargetType: "device",
+			TargetID:   device.ID,
+			Before:     before,
+			Details:    details(map[string]interface{}{}),
+		})
+	}
+	return nil
+}
+
+// bulkMoveLeaves reports whether moving a device to another group removes it
+// from group: one of the groups named to leave or, when none are named,
+// every other manual group the user may manage
+func bulkMoveLeaves(user *User, action BulkAction, group *DeviceGroup) bool {
+	if len(action.FromGroupIDs) > 0 {
+		for _, id := range action.FromGroupIDs {
+			if id == group.ID {
+				return true
+			}
+		}
+		return false
+	}
+	return len(group.Filters) == 0 && (!user.IsScoped() || groupInScope(user, group.ID))
+}
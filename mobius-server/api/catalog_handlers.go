@@ -0,0 +1,687 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog/log"
+)
+
+// Self-service catalog
+//
+// Admins publish applications to device groups. The applications published
+// to the groups of a device, for its platform, make up its catalog: the
+// device user installs and uninstalls them on demand, each request becoming
+// a queued install_app or uninstall_app command. Restricted applications
+// need an approved request first; approving one queues the install.
+//
+// Published applications are only listed in /device/applications for the
+// devices whose catalog holds them, marked self_service so that the agent
+// does not install them on its own, and restricted ones only once approved.
+
+// Catalog statuses of an application on a device
+const (
+	CatalogStatusAvailable        = "available"
+	CatalogStatusApprovalRequired = "approval_required"
+	CatalogStatusPendingApproval  = "pending_approval"
+	CatalogStatusDenied           = "denied"
+	CatalogStatusInstalling       = "installing"
+	CatalogStatusInstalled        = "installed"
+	CatalogStatusInstallFailed    = "install_failed"
+	CatalogStatusUninstalling     = "uninstalling"
+	CatalogStatusUninstallFailed  = "uninstall_failed"
+)
+
+// CreatedBySelfService is the creator of the commands device users queue
+// from their catalog
+const CreatedBySelfService = "self_service"
+
+// MaxApplicationRequestReason bounds the reason given with a request
+const MaxApplicationRequestReason = 1000
+
+// CatalogApplication is an application of the catalog of a device, with its
+// status on the device
+type CatalogApplication struct {
+	*Application
+	Restricted bool   `json:"restricted"`
+	Status     string `json:"status"`
+	// Command is the latest install or uninstall command of the application
+	Command *DeviceCommand `json:"command,omitempty"`
+	// Request is the latest request of the device for a restricted application
+	Request *ApplicationRequest `json:"request,omitempty"`
+}
+
+// deviceCatalog is what a device may see of the published applications
+type deviceCatalog struct {
+	applications []*Application
+	// restricted tells, for every application of the catalog, whether the
+	// device needs an approved request to install it. An application
+	// published to several groups of the device is only restricted if it
+	// is in all of them.
+	restricted map[string]bool
+	// published holds every published application, in the catalog of the
+	// device or not
+	published map[string]bool
+}
+
+func (c *deviceCatalog) find(appID string) *Application {
+	for _, app := range c.applications {
+		if app.ID == appID {
+			return app
+		}
+	}
+	return nil
+}
+
+// loadDeviceCatalog returns the catalog of a device
+func (d *Dependencies) loadDeviceCatalog(device *Device) (*deviceCatalog, error) {
+	publications, err := d.ApplicationService.ListPublications()
+	if err != nil {
+		return nil, err
+	}
+	groups, err := d.DeviceGroupService.GetDeviceGroups(device.ID)
+	if err != nil {
+		return nil, err
+	}
+	inGroup := make(map[string]bool, len(groups))
+	for _, group := range groups {
+		inGroup[group.ID] = true
+	}
+
+	catalog := &deviceCatalog{restricted: make(map[string]bool), published: make(map[string]bool)}
+	for _, p := range publications {
+		catalog.published[p.ApplicationID] = true
+		if !inGroup[p.GroupID] {
+			continue
+		}
+		restricted, seen := catalog.restricted[p.ApplicationID]
+		catalog.restricted[p.ApplicationID] = p.Restricted && (restricted || !seen)
+	}
+	if len(catalog.restricted) == 0 {
+		return catalog, nil
+	}
+
+	applications, err := d.ApplicationService.ListApplications()
+	if err != nil {
+		return nil, err
+	}
+	for _, app := range applications {
+		if _, ok := catalog.restricted[app.ID]; ok && applicationFitsDevice(app, device) {
+			catalog.applications = append(catalog.applications, app)
+		}
+	}
+	return catalog, nil
+}
+
+// applicationFitsDevice reports whether an application is built for the
+// platform of a device
+func applicationFitsDevice(app *Application, device *Device) bool {
+	return app.Platform == device.Platform || app.Platform == "all"
+}
+
+// latestApplicationCommands returns the latest install_app or uninstall_app
+// command of a device for each application
+func (d *Dependencies) latestApplicationCommands(deviceID string) (map[string]*DeviceCommand, error) {
+	commands, err := d.CommandService.ListCommands(CommandFilters{DeviceID: deviceID})
+	if err != nil {
+		return nil, err
+	}
+	latest := make(map[string]*DeviceCommand)
+	for _, cmd := range commands { // newest first
+		if cmd.Command != "install_app" && cmd.Command != "uninstall_app" {
+			continue
+		}
+		appID, _ := cmd.Parameters["application_id"].(string)
+		if _, seen := latest[appID]; !seen && appID != "" {
+			latest[appID] = cmd
+		}
+	}
+	return latest, nil
+}
+
+// latestApplicationRequests returns the latest request of a device for each
+// application
+func (d *Dependencies) latestApplicationRequests(deviceID string) (map[string]*ApplicationRequest, error) {
+	requests, err := d.ApplicationRequestService.ListApplicationRequests(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	latest := make(map[string]*ApplicationRequest)
+	for _, req := range requests { // newest first
+		if _, seen := latest[req.ApplicationID]; !seen {
+			latest[req.ApplicationID] = req
+		}
+	}
+	return latest, nil
+}
+
+// approved reports whether the latest request for an application was
+// approved
+func approved(request *ApplicationRequest) bool {
+	return request != nil && request.Status == AppRequestStatusApproved
+}
+
+// catalogStatus is the status of an application on a device: that of its
+// latest install or uninstall command while it runs or when it failed, and
+// otherwise whether the device may install it
+func catalogStatus(restricted bool, request *ApplicationRequest, command *DeviceCommand) string {
+	if command != nil {
+		install := command.Command == "install_app"
+		switch {
+		case !command.IsTerminal() && install:
+			return CatalogStatusInstalling
+		case !command.IsTerminal():
+			return CatalogStatusUninstalling
+		case command.Status == CommandStatusCompleted && install:
+			return CatalogStatusInstalled
+		case command.Status != CommandStatusCompleted && install:
+			return CatalogStatusInstallFailed
+		case command.Status != CommandStatusCompleted:
+			return CatalogStatusUninstallFailed
+		}
+	}
+
+	switch {
+	case !restricted || approved(request):
+		return CatalogStatusAvailable
+	case request == nil:
+		return CatalogStatusApprovalRequired
+	case request.Status == AppRequestStatusPending:
+		return CatalogStatusPendingApproval
+	default:
+		return CatalogStatusDenied
+	}
+}
+
+// handleDeviceGetCatalog lists the catalog of the device with the status of
+// each application
+func (d *Dependencies) handleDeviceGetCatalog(w http.ResponseWriter, r *http.Request) {
+	device, err := GetDeviceFromContext(r)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, "Device context required")
+		return
+	}
+
+	catalog, err := d.loadDeviceCatalog(device)
+	if err != nil {
+		log.Error().Err(err).Str("device_id", device.ID).Msg("Failed to load catalog")
+		WriteError(w, http.StatusInternalServerError, "Failed to load catalog")
+		return
+	}
+	commands, err := d.latestApplicationCommands(device.ID)
+	if err != nil {
+		log.Error().Err(err).Str("device_id", device.ID).Msg("Failed to list device commands")
+		WriteError(w, http.StatusInternalServerError, "Failed to load catalog")
+		return
+	}
+	requests, err := d.latestApplicationRequests(device.ID)
+	if err != nil {
+		log.Error().Err(err).Str("device_id", device.ID).Msg("Failed to list application requests")
+		WriteError(w, http.StatusInternalServerError, "Failed to load catalog")
+		return
+	}
+
+	applications := make([]CatalogApplication, 0, len(catalog.applications))
+	for _, app := range catalog.applications {
+		restricted := catalog.restricted[app.ID]
+		item := CatalogApplication{
+			Application: app,
+			Restricted:  restricted,
+			Status:      catalogStatus(restricted, requests[app.ID], commands[app.ID]),
+			Command:     commands[app.ID],
+		}
+		if restricted {
+			item.Request = requests[app.ID]
+		}
+		applications = append(applications, item)
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"device_id":    device.ID,
+		"applications": applications,
+	})
+}
+
+func (d *Dependencies) handleDeviceInstallCatalogApplication(w http.ResponseWriter, r *http.Request) {
+	d.queueCatalogCommand(w, r, "install_app")
+}
+
+func (d *Dependencies) handleDeviceUninstallCatalogApplication(w http.ResponseWriter, r *http.Request) {
+	d.queueCatalogCommand(w, r, "uninstall_app")
+}
+
+// queueCatalogCommand queues the install or uninstall of a catalog
+// application the device user asked for. Restricted applications are only
+// installed with an approved request, and an application is not installed
+// or uninstalled while a command for it runs.
+func (d *Dependencies) queueCatalogCommand(w http.ResponseWriter, r *http.Request, command string) {
+	device, err := GetDeviceFromContext(r)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, "Device context required")
+		return
+	}
+	appID := mux.Vars(r)["appId"]
+
+	catalog, err := d.loadDeviceCatalog(device)
+	if err != nil {
+		log.Error().Err(err).Str("device_id", device.ID).Msg("Failed to load catalog")
+		WriteError(w, http.StatusInternalServerError, "Failed to load catalog")
+		return
+	}
+	if catalog.find(appID) == nil {
+		WriteError(w, http.StatusNotFound, "Application is not in the catalog of this device")
+		return
+	}
+
+	commands, err := d.latestApplicationCommands(device.ID)
+	if err != nil {
+		log.Error().Err(err).Str("device_id", device.ID).Msg("Failed to list device commands")
+		WriteError(w, http.StatusInternalServerError, "Failed to queue command")
+		return
+	}
+	if latest := commands[appID]; latest != nil && !latest.IsTerminal() {
+		WriteError(w, http.StatusConflict, "An install or uninstall of this application is already in progress")
+		return
+	}
+
+	if command == "install_app" && catalog.restricted[appID] {
+		requests, err := d.latestApplicationRequests(device.ID)
+		if err != nil {
+			log.Error().Err(err).Str("device_id", device.ID).Msg("Failed to list application requests")
+			WriteError(w, http.StatusInternalServerError, "Failed to queue command")
+			return
+		}
+		if !approved(requests[appID]) {
+			WriteError(w, http.StatusForbidden, "Application requires an approved request")
+			return
+		}
+	}
+
+	cmd, err := d.CommandService.EnqueueCommand(device.ID, CommandCreate{
+		Command:    command,
+		Parameters: map[string]interface{}{"application_id": appID},
+		CreatedBy:  CreatedBySelfService,
+	})
+	if err != nil {
+		log.Error().Err(err).Str("device_id", device.ID).Str("app_id", appID).Msg("Failed to queue catalog command")
+		WriteError(w, http.StatusInternalServerError, "Failed to queue command")
+		return
+	}
+
+	log.Info().
+		Str("command_id", cmd.ID).
+		Str("device_id", device.ID).
+		Str("command", command).
+		Str("app_id", appID).
+		Msg("Catalog command queued")
+
+	d.audit(r, auditRecord{
+		Action:     "device." + command,
+		TargetType: "device",
+		TargetID:   device.ID,
+		Details: map[string]interface{}{
+			"command_id":     cmd.ID,
+			"application_id": appID,
+			"self_service":   true,
+		},
+	})
+
+	WriteJSON(w, http.StatusAccepted, cmd)
+}
+
+// ApplicationRequestBody is the body of a request for a restricted
+// application
+type ApplicationRequestBody struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+// handleDeviceRequestApplication submits a request to install a restricted
+// application of the catalog for an admin to approve
+func (d *Dependencies) handleDeviceRequestApplication(w http.ResponseWriter, r *http.Request) {
+	device, err := GetDeviceFromContext(r)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, "Device context required")
+		return
+	}
+	appID := mux.Vars(r)["appId"]
+
+	var body ApplicationRequestBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && err != io.EOF {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if len(body.Reason) > MaxApplicationRequestReason {
+		WriteError(w, http.StatusBadRequest, "Reason is too long")
+		return
+	}
+
+	catalog, err := d.loadDeviceCatalog(device)
+	if err != nil {
+		log.Error().Err(err).Str("device_id", device.ID).Msg("Failed to load catalog")
+		WriteError(w, http.StatusInternalServerError, "Failed to load catalog")
+		return
+	}
+	if catalog.find(appID) == nil {
+		WriteError(w, http.StatusNotFound, "Application is not in the catalog of this device")
+		return
+	}
+	if !catalog.restricted[appID] {
+		WriteError(w, http.StatusConflict, "Application does not require approval")
+		return
+	}
+
+	requests, err := d.latestApplicationRequests(device.ID)
+	if err != nil {
+		log.Error().Err(err).Str("device_id", device.ID).Msg("Failed to list application requests")
+		WriteError(w, http.StatusInternalServerError, "Failed to submit request")
+		return
+	}
+	if approved(requests[appID]) {
+		WriteError(w, http.StatusConflict, "Application is already approved for this device")
+		return
+	}
+
+	request, err := d.ApplicationRequestService.CreateApplicationRequest(ApplicationRequestCreate{
+		ApplicationID: appID,
+		DeviceID:      device.ID,
+		Reason:        body.Reason,
+	})
+	if errors.Is(err, ErrApplicationRequestPending) {
+		WriteError(w, http.StatusConflict, "A request for this application is already pending")
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Str("device_id", device.ID).Str("app_id", appID).Msg("Failed to create application request")
+		WriteError(w, http.StatusInternalServerError, "Failed to submit request")
+		return
+	}
+
+	log.Info().
+		Str("request_id", request.ID).
+		Str("device_id", device.ID).
+		Str("app_id", appID).
+		Msg("Application requested")
+
+	d.audit(r, auditRecord{Action: "application_request.create", TargetType: "application_request", TargetID: request.ID, After: request})
+
+	WriteJSON(w, http.StatusCreated, request)
+}
+
+// handleDeviceListApplicationRequests lists the requests of the device,
+// newest first
+func (d *Dependencies) handleDeviceListApplicationRequests(w http.ResponseWriter, r *http.Request) {
+	device, err := GetDeviceFromContext(r)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, "Device context required")
+		return
+	}
+
+	requests, err := d.ApplicationRequestService.ListApplicationRequests(device.ID)
+	if err != nil {
+		log.Error().Err(err).Str("device_id", device.ID).Msg("Failed to list application requests")
+		WriteError(w, http.StatusInternalServerError, "Failed to list requests")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"device_id": device.ID,
+		"requests":  requests,
+	})
+}
+
+// handleListApplicationRequests lists the requests of every device. Users
+// scoped to device groups only see those of their devices.
+func (d *Dependencies) handleListApplicationRequests(w http.ResponseWriter, r *http.Request) {
+	q, ok := readListQuery(w, r, applicationRequestListSpec)
+	if !ok {
+		return
+	}
+
+	user, err := GetUserFromContext(r)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, "User context required")
+		return
+	}
+
+	scopeListQuery(q, user)
+
+	var query func(*ListQuery) ([]*ApplicationRequest, int, error)
+	if querier, ok := d.ApplicationRequestService.(ApplicationRequestQuerier); ok {
+		query = querier.QueryApplicationRequests
+	}
+	result, err := listItems(q, applicationRequestListSpec, query, func() ([]*ApplicationRequest, error) {
+		requests, err := d.ApplicationRequestService.ListApplicationRequests("")
+		if err != nil {
+			return nil, err
+		}
+		return filterDeviceScope(d, q, requests, func(req *ApplicationRequest) string { return req.DeviceID })
+	})
+	if err != nil {
+		log.Error().Err(err).Str("user_id", user.ID).Msg("Failed to list application requests")
+		WriteError(w, http.StatusInternalServerError, "Failed to list requests")
+		return
+	}
+
+	writeList(w, "requests", result)
+}
+
+func (d *Dependencies) handleGetApplicationRequest(w http.ResponseWriter, r *http.Request) {
+	request, err := d.ApplicationRequestService.GetApplicationRequest(mux.Vars(r)["requestId"])
+	if err != nil {
+		WriteError(w, http.StatusNotFound, "Application request not found")
+		return
+	}
+	if !d.requireDeviceInScope(w, r, PermApplicationsRead, request.DeviceID) {
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, request)
+}
+
+func (d *Dependencies) handleApproveApplicationRequest(w http.ResponseWriter, r *http.Request) {
+	d.decideApplicationRequest(w, r, AppRequestStatusApproved)
+}
+
+func (d *Dependencies) handleDenyApplicationRequest(w http.ResponseWriter, r *http.Request) {
+	d.decideApplicationRequest(w, r, AppRequestStatusDenied)
+}
+
+// ApplicationDecisionBody is the body of an approval or denial
+type ApplicationDecisionBody struct {
+	// Note is shown to the device user
+	Note string `json:"note,omitempty"`
+}
+
+// decideApplicationRequest approves or denies a pending request. Approving
+// queues the install of the application on the device.
+func (d *Dependencies) decideApplicationRequest(w http.ResponseWriter, r *http.Request, status string) {
+	requestID := mux.Vars(r)["requestId"]
+
+	var body ApplicationDecisionBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && err != io.EOF {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if len(body.Note) > MaxApplicationRequestReason {
+		WriteError(w, http.StatusBadRequest, "Note is too long")
+		return
+	}
+
+	before, err := d.ApplicationRequestService.GetApplicationRequest(requestID)
+	if err != nil {
+		WriteError(w, http.StatusNotFound, "Application request not found")
+		return
+	}
+	if !d.requireDeviceInScope(w, r, PermApplicationsWrite, before.DeviceID) {
+		return
+	}
+	if before.Status != AppRequestStatusPending {
+		WriteError(w, http.StatusConflict, "Application request is already "+before.Status)
+		return
+	}
+
+	user, err := GetUserFromContext(r)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, "User context required")
+		return
+	}
+	decision := ApplicationRequestDecision{Status: status, DecidedBy: user.ID, Note: body.Note}
+
+	if status == AppRequestStatusApproved {
+		if _, err := d.ApplicationService.GetApplication(before.ApplicationID); err != nil {
+			WriteError(w, http.StatusNotFound, "Application not found")
+			return
+		}
+		cmd, err := d.CommandService.EnqueueCommand(before.DeviceID, CommandCreate{
+			Command:    "install_app",
+			Parameters: map[string]interface{}{"application_id": before.ApplicationID},
+			CreatedBy:  user.ID,
+		})
+		if err != nil {
+			log.Error().Err(err).Str("request_id", requestID).Msg("Failed to queue install of approved application")
+			WriteError(w, http.StatusInternalServerError, "Failed to queue install")
+			return
+		}
+		decision.CommandID = cmd.ID
+	}
+
+	request, err := d.ApplicationRequestService.DecideApplicationRequest(requestID, decision)
+	if errors.Is(err, ErrApplicationRequestDecided) {
+		WriteError(w, http.StatusConflict, "Application request is already decided")
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Str("request_id", requestID).Msg("Failed to decide application request")
+		WriteError(w, http.StatusInternalServerError, "Failed to decide request")
+		return
+	}
+
+	log.Info().
+		Str("request_id", request.ID).
+		Str("status", request.Status).
+		Str("device_id", request.DeviceID).
+		Str("app_id", request.ApplicationID).
+		Str("user_id", user.ID).
+		Msg("Application request decided")
+
+	action := "application_request.approve"
+	if status == AppRequestStatusDenied {
+		action = "application_request.deny"
+	}
+	d.audit(r, auditRecord{Action: action, TargetType: "application_request", TargetID: request.ID, Before: before, After: request})
+
+	WriteJSON(w, http.StatusOK, request)
+}
+
+// handleListApplicationPublications lists the device groups an application
+// is published to
+func (d *Dependencies) handleListApplicationPublications(w http.ResponseWriter, r *http.Request) {
+	appID := mux.Vars(r)["appId"]
+	if _, err := d.ApplicationService.GetApplication(appID); err != nil {
+		WriteError(w, http.StatusNotFound, "Application not found")
+		return
+	}
+
+	publications, err := d.ApplicationService.ListApplicationPublications(appID)
+	if err != nil {
+		log.Error().Err(err).Str("app_id", appID).Msg("Failed to list application publications")
+		WriteError(w, http.StatusInternalServerError, "Failed to list publications")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"application_id": appID,
+		"publications":   publications,
+	})
+}
+
+// PublicationBody is the optional body of a publication
+type PublicationBody struct {
+	Restricted bool `json:"restricted"`
+}
+
+// handlePublishApplication publishes an application to the catalog of a
+// device group, or changes whether it is restricted there
+func (d *Dependencies) handlePublishApplication(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	appID, groupID := vars["appId"], vars["groupId"]
+
+	var body PublicationBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && err != io.EOF {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if !d.requireGroupInScope(w, r, groupID) {
+		return
+	}
+	if _, err := d.ApplicationService.GetApplication(appID); err != nil {
+		WriteError(w, http.StatusNotFound, "Application not found")
+		return
+	}
+	if _, err := d.DeviceGroupService.GetDeviceGroup(groupID); err != nil {
+		WriteError(w, http.StatusNotFound, "Device group not found")
+		return
+	}
+
+	publication, err := d.ApplicationService.PublishApplication(appID, groupID, body.Restricted)
+	if err != nil {
+		log.Error().Err(err).Str("app_id", appID).Str("group_id", groupID).Msg("Failed to publish application")
+		WriteError(w, http.StatusInternalServerError, "Failed to publish application")
+		return
+	}
+
+	d.audit(r, auditRecord{
+		Action:     "application.publish",
+		TargetType: "application",
+		TargetID:   appID,
+		Details:    map[string]interface{}{"group_id": groupID, "restricted": publication.Restricted},
+	})
+
+	WriteJSON(w, http.StatusOK, publication)
+}
+
+// handleUnpublishApplication removes an application from the catalog of a
+// device group. Devices keep the application if it is installed.
+func (d *Dependencies) handleUnpublishApplication(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	appID, groupID := vars["appId"], vars["groupId"]
+
+	if !d.requireGroupInScope(w, r, groupID) {
+		return
+	}
+	if err := d.ApplicationService.UnpublishApplication(appID, groupID); err != nil {
+		WriteError(w, http.StatusNotFound, "Application not published to device group")
+		return
+	}
+
+	d.audit(r, auditRecord{
+		Action:     "application.unpublish",
+		TargetType: "application",
+		TargetID:   appID,
+		Details:    map[string]interface{}{"group_id": groupID},
+	})
+
+	WriteJSON(w, http.StatusOK, map[string]string{
+		"message": "Application unpublished from group successfully",
+	})
+}
+
+// requireGroupInScope writes an error response unless the caller may act on
+// a device group
+func (d *Dependencies) requireGroupInScope(w http.ResponseWriter, r *http.Request, groupID string) bool {
+	user, err := GetUserFromContext(r)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, "User context required")
+		return false
+	}
+	if user.IsScoped() && !groupInScope(user, groupID) {
+		d.auditDenied(r, user, PermApplicationsWrite, "device group outside scope")
+		WriteError(w, http.StatusForbidden, "Device group is outside your device groups")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,195 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog/log"
+)
+
+// Device command queue handlers
+
+// handleListCommands lists queued and finished commands, newest first
+func (d *Dependencies) handleListCommands(w http.ResponseWriter, r *http.Request) {
+	q, ok := readListQuery(w, r, commandListSpec)
+	if !ok {
+		return
+	}
+
+	deviceID := q.filterValue("device_id")
+	if deviceID != "" && !d.requireDeviceInScope(w, r, PermDevicesRead, deviceID) {
+		return
+	}
+
+	d.listCommands(w, r, q, deviceID)
+}
+
+// handleListDeviceCommands lists the commands of a single device, newest first
+func (d *Dependencies) handleListDeviceCommands(w http.ResponseWriter, r *http.Request) {
+	q, ok := readListQuery(w, r, commandListSpec)
+	if !ok {
+		return
+	}
+	deviceID := mux.Vars(r)["deviceId"]
+
+	if _, err := d.DeviceService.GetDevice(deviceID); err != nil {
+		WriteError(w, http.StatusNotFound, "Device not found")
+		return
+	}
+	q.Filters = append(q.Filters, ListFilter{Field: "device_id", Op: "eq", Operands: []interface{}{deviceID}})
+
+	d.listCommands(w, r, q, deviceID)
+}
+
+// listCommands answers a list query for the commands of deviceID, or of
+// every device in the caller's scope
+func (d *Dependencies) listCommands(w http.ResponseWriter, r *http.Request, q *ListQuery, deviceID string) {
+	if deviceID == "" {
+		user, err := GetUserFromContext(r)
+		if err != nil {
+			WriteError(w, http.StatusUnauthorized, "User context required")
+			return
+		}
+		scopeListQuery(q, user)
+	}
+
+	var query func(*ListQuery) ([]*DeviceCommand, int, error)
+	if querier, ok := d.CommandService.(CommandQuerier); ok {
+		query = querier.QueryCommands
+	}
+	result, err := listItems(q, commandListSpec, query, func() ([]*DeviceCommand, error) {
+		commands, err := d.CommandService.ListCommands(CommandFilters{
+			DeviceID: deviceID,
+			Status:   q.filterValue("status"),
+		})
+		if err != nil {
+			return nil, err
+		}
+		return filterDeviceScope(d, q, commands, func(command *DeviceCommand) string { return command.DeviceID })
+	})
+	if err != nil {
+		log.Error().Err(err).Str("device_id", deviceID).Msg("Failed to list commands")
+		WriteError(w, http.StatusInternalServerError, "Failed to list commands")
+		return
+	}
+
+	writeList(w, "commands", result)
+}
+
+// handleGetCommand retrieves a command by ID
+func (d *Dependencies) handleGetCommand(w http.ResponseWriter, r *http.Request) {
+	commandID := mux.Vars(r)["commandId"]
+
+	command, err := d.CommandService.GetCommand(commandID)
+	if err != nil {
+		WriteError(w, http.StatusNotFound, "Command not found")
+		return
+	}
+	if !d.requireDeviceInScope(w, r, PermDevicesRead, command.DeviceID) {
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, command)
+}
+
+// Device API handlers (for client connections)
+
+// handleDeviceFetchCommands returns the outstanding commands of the calling
+// device and marks pending ones as delivered
+func (d *Dependencies) handleDeviceFetchCommands(w http.ResponseWriter, r *http.Request) {
+	device, err := GetDeviceFromContext(r)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, "Device context required")
+		return
+	}
+
+	commands, err := d.CommandService.FetchCommands(device.ID)
+	if err != nil {
+		log.Error().Err(err).Str("device_id", device.ID).Msg("Failed to fetch device commands")
+		WriteError(w, http.StatusInternalServerError, "Failed to fetch commands")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"device_id": device.ID,
+		"commands":  commands,
+	})
+}
+
+// handleDeviceAcknowledgeCommand records that the calling device received a command
+func (d *Dependencies) handleDeviceAcknowledgeCommand(w http.ResponseWriter, r *http.Request) {
+	device, err := GetDeviceFromContext(r)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, "Device context required")
+		return
+	}
+
+	commandID := mux.Vars(r)["commandId"]
+	if !d.deviceOwnsCommand(w, device.ID, commandID) {
+		return
+	}
+
+	command, err := d.CommandService.AcknowledgeCommand(device.ID, commandID)
+	if err != nil {
+		WriteError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	log.Debug().
+		Str("command_id", commandID).
+		Str("device_id", device.ID).
+		Msg("Device command acknowledged")
+
+	WriteJSON(w, http.StatusOK, command)
+}
+
+// handleDeviceCommandResult records the outcome of a command run by the calling device
+func (d *Dependencies) handleDeviceCommandResult(w http.ResponseWriter, r *http.Request) {
+	device, err := GetDeviceFromContext(r)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, "Device context required")
+		return
+	}
+
+	var report CommandResultReport
+	if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if report.Status != CommandStatusCompleted && report.Status != CommandStatusFailed {
+		WriteError(w, http.StatusBadRequest, "Status must be one of: completed, failed")
+		return
+	}
+
+	commandID := mux.Vars(r)["commandId"]
+	if !d.deviceOwnsCommand(w, device.ID, commandID) {
+		return
+	}
+
+	command, err := d.CommandService.ReportCommandResult(device.ID, commandID, report)
+	if err != nil {
+		WriteError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	log.Info().
+		Str("command_id", commandID).
+		Str("device_id", device.ID).
+		Str("status", command.Status).
+		Msg("Device command finished")
+
+	WriteJSON(w, http.StatusOK, command)
+}
+
+// deviceOwnsCommand writes a not found response unless the command exists and
+// was queued for deviceID
+func (d *Dependencies) deviceOwnsCommand(w http.ResponseWriter, deviceID, commandID string) bool {
+	command, err := d.CommandService.GetCommand(commandID)
+	if err != nil || command.DeviceID != deviceID {
+		WriteError(w, http.StatusNotFound, "Command not found")
+		return false
+	}
+	return true
+}
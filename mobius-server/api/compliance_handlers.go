@@ -0,0 +1,198 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog/log"
+)
+
+// Policy compliance handlers
+
+// ComplianceResponse is a compliance summary for a policy, a device group or,
+// with neither set, the whole fleet
+type ComplianceResponse struct {
+	PolicyID string `json:"policy_id,omitempty"`
+	GroupID  string `json:"group_id,omitempty"`
+	*ComplianceSummary
+}
+
+// handleGetFleetCompliance summarizes the latest policy results of every
+// device the caller may see
+func (d *Dependencies) handleGetFleetCompliance(w http.ResponseWriter, r *http.Request) {
+	scope, ok := d.complianceScope(w, r)
+	if !ok {
+		return
+	}
+
+	summary, err := d.ComplianceService.GetComplianceSummary(scope)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to summarize compliance")
+		WriteError(w, http.StatusInternalServerError, "Failed to summarize compliance")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, ComplianceResponse{ComplianceSummary: summary})
+}
+
+// handleGetPolicyCompliance summarizes the latest results of one policy
+func (d *Dependencies) handleGetPolicyCompliance(w http.ResponseWriter, r *http.Request) {
+	policyID := mux.Vars(r)["policyId"]
+
+	if _, err := d.PolicyService.GetPolicy(policyID); err != nil {
+		WriteError(w, http.StatusNotFound, "Policy not found")
+		return
+	}
+
+	scope, ok := d.complianceScope(w, r)
+	if !ok {
+		return
+	}
+	scope.PolicyID = policyID
+
+	summary, err := d.ComplianceService.GetComplianceSummary(scope)
+	if err != nil {
+		log.Error().Err(err).Str("policy_id", policyID).Msg("Failed to summarize policy compliance")
+		WriteError(w, http.StatusInternalServerError, "Failed to summarize compliance")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, ComplianceResponse{PolicyID: policyID, ComplianceSummary: summary})
+}
+
+// handleGetGroupCompliance summarizes the latest policy results of the
+// members of a device group
+func (d *Dependencies) handleGetGroupCompliance(w http.ResponseWriter, r *http.Request) {
+	groupID := mux.Vars(r)["groupId"]
+
+	devices, err := d.DeviceGroupService.GetGroupDevices(groupID)
+	if err != nil {
+		WriteError(w, http.StatusNotFound, "Device group not found")
+		return
+	}
+	deviceIDs := make([]string, 0, len(devices))
+	for _, device := range devices {
+		deviceIDs = append(deviceIDs, device.ID)
+	}
+
+	summary, err := d.ComplianceService.GetComplianceSummary(ComplianceScope{DeviceIDs: deviceIDs})
+	if err != nil {
+		log.Error().Err(err).Str("group_id", groupID).Msg("Failed to summarize group compliance")
+		WriteError(w, http.StatusInternalServerError, "Failed to summarize compliance")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, ComplianceResponse{GroupID: groupID, ComplianceSummary: summary})
+}
+
+// handleGetDeviceCompliance returns the latest result of each policy a device reported on
+func (d *Dependencies) handleGetDeviceCompliance(w http.ResponseWriter, r *http.Request) {
+	deviceID := mux.Vars(r)["deviceId"]
+
+	if _, err := d.DeviceService.GetDevice(deviceID); err != nil {
+		WriteError(w, http.StatusNotFound, "Device not found")
+		return
+	}
+
+	results, err := d.ComplianceService.GetDeviceCompliance(deviceID)
+	if err != nil {
+		log.Error().Err(err).Str("device_id", deviceID).Msg("Failed to get device compliance")
+		WriteError(w, http.StatusInternalServerError, "Failed to get device compliance")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"device_id": deviceID,
+		"results":   results,
+	})
+}
+
+// handleGetPolicyResultHistory returns the results a device reported for a
+// policy, newest first
+func (d *Dependencies) handleGetPolicyResultHistory(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	deviceID := vars["deviceId"]
+	policyID := vars["policyId"]
+
+	if _, err := d.DeviceService.GetDevice(deviceID); err != nil {
+		WriteError(w, http.StatusNotFound, "Device not found")
+		return
+	}
+	if _, err := d.PolicyService.GetPolicy(policyID); err != nil {
+		WriteError(w, http.StatusNotFound, "Policy not found")
+		return
+	}
+
+	history, err := d.ComplianceService.GetPolicyResultHistory(deviceID, policyID)
+	if err != nil {
+		log.Error().Err(err).Str("device_id", deviceID).Str("policy_id", policyID).Msg("Failed to get policy result history")
+		WriteError(w, http.StatusInternalServerError, "Failed to get policy result history")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"device_id": deviceID,
+		"policy_id": policyID,
+		"history":   history,
+	})
+}
+
+// complianceScope restricts compliance summaries to the devices of scoped users
+func (d *Dependencies) complianceScope(w http.ResponseWriter, r *http.Request) (ComplianceScope, bool) {
+	user, err := GetUserFromContext(r)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, "User context required")
+		return ComplianceScope{}, false
+	}
+
+	devices, err := d.scopedDeviceIDs(user)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to resolve device scope")
+		WriteError(w, http.StatusInternalServerError, "Failed to summarize compliance")
+		return ComplianceScope{}, false
+	}
+
+	var scope ComplianceScope
+	if devices != nil {
+		scope.DeviceIDs = make([]string, 0, len(devices))
+		for id := range devices {
+			scope.DeviceIDs = append(scope.DeviceIDs, id)
+		}
+	}
+	return scope, true
+}
+
+// recordPolicyResults stores the policy results in the "policies" entry of
+// check-in query results. Results for unknown policies are skipped.
+func (d *Dependencies) recordPolicyResults(device *Device, queryResults map[string]interface{}) error {
+	raw, ok := queryResults["policies"]
+	if !ok {
+		return nil
+	}
+
+	var reports []PolicyResultReport
+	b, err := json.Marshal(raw)
+	if err == nil {
+		err = json.Unmarshal(b, &reports)
+	}
+	if err != nil {
+		return fmt.Errorf("query_results.policies must be a list of policy results")
+	}
+
+	known := make([]PolicyResultReport, 0, len(reports))
+	for _, report := range reports {
+		if _, err := d.PolicyService.GetPolicy(report.PolicyID); err != nil {
+			log.Debug().Str("device_id", device.ID).Str("policy_id", report.PolicyID).Msg("Skipping result for unknown policy")
+			continue
+		}
+		known = append(known, report)
+	}
+	if len(known) == 0 {
+		return nil
+	}
+
+	_, err = d.ComplianceService.RecordPolicyResults(device.ID, known)
+	return err
+}
@@ -2,6 +2,7 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"github.com/gorilla/mux"
@@ -12,17 +13,36 @@ import (
 
 // handleListDeviceGroups lists all device groups with optional filtering
 func (d *Dependencies) handleListDeviceGroups(w http.ResponseWriter, r *http.Request) {
-	groups, err := d.DeviceGroupService.ListDeviceGroups()
+	q, ok := readListQuery(w, r, deviceGroupListSpec)
+	if !ok {
+		return
+	}
+
+	user, err := GetUserFromContext(r)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, "User context required")
+		return
+	}
+	scopeListQuery(q, user)
+
+	var query func(*ListQuery) ([]*DeviceGroup, int, error)
+	if querier, ok := d.DeviceGroupService.(DeviceGroupQuerier); ok {
+		query = querier.QueryDeviceGroups
+	}
+	result, err := listItems(q, deviceGroupListSpec, query, func() ([]*DeviceGroup, error) {
+		groups, err := d.DeviceGroupService.ListDeviceGroups()
+		if err != nil {
+			return nil, err
+		}
+		return filterGroupScope(q, groups), nil
+	})
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to list device groups")
 		WriteError(w, http.StatusInternalServerError, "Failed to list device groups")
 		return
 	}
 
-	WriteJSON(w, http.StatusOK, map[string]interface{}{
-		"device_groups": groups,
-		"count":         len(groups),
-	})
+	writeList(w, "device_groups", result)
 }
 
 // handleCreateDeviceGroup creates a new device group
@@ -47,21 +67,27 @@ func (d *Dependencies) handleCreateDeviceGroup(w http.ResponseWriter, r *http.Re
 
 	group, err := d.DeviceGroupService.CreateDeviceGroup(req)
 	if err != nil {
-		log.Error().
+		log.Debug().
 			Err(err).
 			Str("user_id", user.ID).
 			Str("group_name", req.Name).
 			Msg("Failed to create device group")
-		WriteError(w, http.StatusInternalServerError, "Failed to create device group")
+		WriteError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
+	if len(group.Filters) > 0 {
+		group = d.evaluateGroupMembers(group)
+	}
+
 	log.Info().
 		Str("group_id", group.ID).
 		Str("group_name", group.Name).
 		Str("user_id", user.ID).
 		Msg("Device group created")
 
+	d.audit(r, auditRecord{Action: "device_group.create", TargetType: "device_group", TargetID: group.ID, After: group})
+
 	WriteJSON(w, http.StatusCreated, group)
 }
 
@@ -106,22 +132,43 @@ func (d *Dependencies) handleUpdateDeviceGroup(w http.ResponseWriter, r *http.Re
 		return
 	}
 
+	before, err := d.DeviceGroupService.GetDeviceGroup(groupID)
+	if err != nil {
+		WriteError(w, http.StatusNotFound, "Device group not found")
+		return
+	}
+	rev, ok := checkIfMatch(w, r, before.Revision)
+	if !ok {
+		return
+	}
+	updates.IfRevision = rev
+
 	updatedGroup, err := d.DeviceGroupService.UpdateDeviceGroup(groupID, updates)
+	if errors.Is(err, ErrRevisionConflict) {
+		writeRevisionConflict(w)
+		return
+	}
 	if err != nil {
-		log.Error().
+		log.Debug().
 			Err(err).
 			Str("group_id", groupID).
 			Str("user_id", user.ID).
 			Msg("Failed to update device group")
-		WriteError(w, http.StatusInternalServerError, "Failed to update device group")
+		WriteError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
+	if updates.Filters != nil {
+		updatedGroup = d.evaluateGroupMembers(updatedGroup)
+	}
+
 	log.Info().
 		Str("group_id", groupID).
 		Str("user_id", user.ID).
 		Msg("Device group updated")
 
+	d.audit(r, auditRecord{Action: "device_group.update", TargetType: "device_group", TargetID: groupID, Before: before, After: updatedGroup})
+
 	WriteJSON(w, http.StatusOK, updatedGroup)
 }
 
@@ -141,6 +188,15 @@ func (d *Dependencies) handleDeleteDeviceGroup(w http.ResponseWriter, r *http.Re
 		return
 	}
 
+	before, err := d.DeviceGroupService.GetDeviceGroup(groupID)
+	if err != nil {
+		WriteError(w, http.StatusNotFound, "Device group not found")
+		return
+	}
+	if _, ok := checkIfMatch(w, r, before.Revision); !ok {
+		return
+	}
+
 	err = d.DeviceGroupService.DeleteDeviceGroup(groupID)
 	if err != nil {
 		log.Error().
@@ -157,6 +213,8 @@ func (d *Dependencies) handleDeleteDeviceGroup(w http.ResponseWriter, r *http.Re
 		Str("user_id", user.ID).
 		Msg("Device group deleted")
 
+	d.audit(r, auditRecord{Action: "device_group.delete", TargetType: "device_group", TargetID: groupID, Before: before})
+
 	WriteJSON(w, http.StatusOK, map[string]string{
 		"message": "Device group deleted successfully",
 	})
@@ -172,17 +230,25 @@ func (d *Dependencies) handleGetGroupDevices(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	devices, err := d.DeviceGroupService.GetGroupDevices(groupID)
+	q, ok := readListQuery(w, r, deviceListSpec)
+	if !ok {
+		return
+	}
+
+	var query func(*ListQuery) ([]*Device, int, error)
+	if querier, ok := d.DeviceGroupService.(DeviceGroupQuerier); ok {
+		query = func(q *ListQuery) ([]*Device, int, error) { return querier.QueryGroupDevices(groupID, q) }
+	}
+	result, err := listItems(q, deviceListSpec, query, func() ([]*Device, error) {
+		return d.DeviceGroupService.GetGroupDevices(groupID)
+	})
 	if err != nil {
 		log.Error().Err(err).Str("group_id", groupID).Msg("Failed to get group devices")
 		WriteError(w, http.StatusInternalServerError, "Failed to get group devices")
 		return
 	}
 
-	WriteJSON(w, http.StatusOK, map[string]interface{}{
-		"devices": devices,
-		"count":   len(devices),
-	})
+	writeList(w, "devices", result)
 }
 
 // handleAddDeviceToGroup adds a device to a group
@@ -202,6 +268,10 @@ func (d *Dependencies) handleAddDeviceToGroup(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	if !d.requireManualGroup(w, groupID) {
+		return
+	}
+
 	err = d.DeviceGroupService.AddDeviceToGroup(groupID, deviceID)
 	if err != nil {
 		log.Error().
@@ -220,6 +290,13 @@ func (d *Dependencies) handleAddDeviceToGroup(w http.ResponseWriter, r *http.Req
 		Str("user_id", user.ID).
 		Msg("Device added to group")
 
+	d.audit(r, auditRecord{
+		Action:     "device_group.add_device",
+		TargetType: "device_group",
+		TargetID:   groupID,
+		Details:    map[string]interface{}{"device_id": deviceID},
+	})
+
 	WriteJSON(w, http.StatusOK, map[string]string{
 		"message": "Device added to group successfully",
 	})
@@ -242,6 +319,10 @@ func (d *Dependencies) handleRemoveDeviceFromGroup(w http.ResponseWriter, r *htt
 		return
 	}
 
+	if !d.requireManualGroup(w, groupID) {
+		return
+	}
+
 	err = d.DeviceGroupService.RemoveDeviceFromGroup(groupID, deviceID)
 	if err != nil {
 		log.Error().
@@ -260,7 +341,82 @@ func (d *Dependencies) handleRemoveDeviceFromGroup(w http.ResponseWriter, r *htt
 		Str("user_id", user.ID).
 		Msg("Device removed from group")
 
+	d.audit(r, auditRecord{
+		Action:     "device_group.remove_device",
+		TargetType: "device_group",
+		TargetID:   groupID,
+		Details:    map[string]interface{}{"device_id": deviceID},
+	})
+
 	WriteJSON(w, http.StatusOK, map[string]string{
 		"message": "Device removed from group successfully",
 	})
 }
+
+// handleExplainGroupMembership shows how a device fares against the filters of
+// a group, condition by condition
+func (d *Dependencies) handleExplainGroupMembership(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	groupID := vars["groupId"]
+	deviceID := vars["deviceId"]
+
+	if _, err := d.DeviceGroupService.GetDeviceGroup(groupID); err != nil {
+		WriteError(w, http.StatusNotFound, "Device group not found")
+		return
+	}
+	device, err := d.DeviceService.GetDevice(deviceID)
+	if err != nil {
+		WriteError(w, http.StatusNotFound, "Device not found")
+		return
+	}
+
+	explanation, err := d.DeviceGroupService.ExplainDeviceMembership(groupID, device)
+	if err != nil {
+		log.Error().Err(err).Str("group_id", groupID).Str("device_id", deviceID).Msg("Failed to explain group membership")
+		WriteError(w, http.StatusInternalServerError, "Failed to explain group membership")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, explanation)
+}
+
+// requireManualGroup writes an error and returns false unless the group exists
+// and its membership is managed by hand rather than by filters
+func (d *Dependencies) requireManualGroup(w http.ResponseWriter, groupID string) bool {
+	group, err := d.DeviceGroupService.GetDeviceGroup(groupID)
+	if err != nil {
+		WriteError(w, http.StatusNotFound, "Device group not found")
+		return false
+	}
+	if len(group.Filters) > 0 {
+		WriteError(w, http.StatusConflict, "Device group membership is managed by its filters")
+		return false
+	}
+	return true
+}
+
+// evaluateDeviceGroups re-evaluates the dynamic groups of a device after it
+// enrolls, checks in or is updated. Failures are logged and do not fail the request.
+func (d *Dependencies) evaluateDeviceGroups(device *Device) {
+	if err := d.DeviceGroupService.EvaluateDeviceMembership(device); err != nil {
+		log.Error().Err(err).Str("device_id", device.ID).Msg("Failed to evaluate device group membership")
+	}
+}
+
+// evaluateGroupMembers re-evaluates every device against the filters of group
+// and returns the group with its updated device count
+func (d *Dependencies) evaluateGroupMembers(group *DeviceGroup) *DeviceGroup {
+	devices, err := d.allDevices()
+	if err == nil {
+		err = d.DeviceGroupService.EvaluateGroupMembership(group.ID, devices)
+	}
+	if err != nil {
+		log.Error().Err(err).Str("group_id", group.ID).Msg("Failed to evaluate device group membership")
+		return group
+	}
+
+	if updated, err := d.DeviceGroupService.GetDeviceGroup(group.ID); err == nil {
+		return updated
+	}
+	return group
+}
@@ -2,9 +2,11 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
-	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/rs/zerolog/log"
@@ -12,80 +14,46 @@ import (
 
 // Enhanced device management handlers with comprehensive MDM functionality
 
-// handleListDevices lists devices with advanced filtering and pagination
+// handleListDevices lists devices with filtering, sorting and cursor
+// pagination. search matches hostnames and UUIDs.
 func (d *Dependencies) handleListDevices(w http.ResponseWriter, r *http.Request) {
-	// Parse query parameters
-	limitStr := r.URL.Query().Get("limit")
-	offsetStr := r.URL.Query().Get("offset")
-	platform := r.URL.Query().Get("platform")
-	status := r.URL.Query().Get("status")
-	search := r.URL.Query().Get("search") // Search by hostname or UUID
-
-	// Set defaults
-	limit := 50
-	offset := 0
-
-	if limitStr != "" {
-		if parsed, err := strconv.Atoi(limitStr); err == nil && parsed > 0 && parsed <= 500 {
-			limit = parsed
-		}
-	}
-
-	if offsetStr != "" {
-		if parsed, err := strconv.Atoi(offsetStr); err == nil && parsed >= 0 {
-			offset = parsed
-		}
-	}
-
-	// Validate platform
-	validPlatforms := map[string]bool{
-		"windows": true, "macos": true, "linux": true, "ios": true, "android": true,
-	}
-	if platform != "" && !validPlatforms[platform] {
-		WriteError(w, http.StatusBadRequest, "Invalid platform. Must be one of: windows, macos, linux, ios, android")
+	q, ok := readListQuery(w, r, deviceListSpec, "search")
+	if !ok {
 		return
 	}
+	search := r.URL.Query().Get("search")
 
-	// Validate status
-	validStatuses := map[string]bool{
-		"online": true, "offline": true, "enrolled": true, "pending": true, "unenrolled": true,
-	}
-	if status != "" && !validStatuses[status] {
-		WriteError(w, http.StatusBadRequest, "Invalid status. Must be one of: online, offline, enrolled, pending, unenrolled")
+	// Users scoped to device groups only see the members of their groups
+	user, err := GetUserFromContext(r)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, "User context required")
 		return
 	}
+	scopeListQuery(q, user)
 
-	filters := DeviceFilters{
-		Limit:    limit,
-		Offset:   offset,
-		Platform: platform,
-		Status:   status,
-		Search:   search,
+	var query func(*ListQuery) ([]*Device, int, error)
+	if querier, ok := d.DeviceService.(DeviceQuerier); ok {
+		query = func(q *ListQuery) ([]*Device, int, error) { return querier.QueryDevices(search, q) }
 	}
-
-	devices, total, err := d.DeviceService.ListDevices(filters)
+	result, err := listItems(q, deviceListSpec, query, func() ([]*Device, error) {
+		devices, err := d.findDevices(DeviceFilters{Search: search})
+		if err != nil {
+			return nil, err
+		}
+		return filterDeviceScope(d, q, devices, func(device *Device) string { return device.ID })
+	})
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to list devices")
 		WriteError(w, http.StatusInternalServerError, "Failed to list devices")
 		return
 	}
 
-	log.Debug().
-		Int("total", total).
-		Int("returned", len(devices)).
-		Int("limit", limit).
-		Int("offset", offset).
-		Msg("Listed devices")
-
-	WriteJSON(w, http.StatusOK, map[string]interface{}{
-		"devices": devices,
-		"total":   total,
-		"limit":   limit,
-		"offset":  offset,
-	})
+	writeList(w, "devices", result)
 }
 
-// handleEnrollDevice handles device enrollment with enhanced validation
+// handleEnrollDevice enrolls a device on behalf of an authenticated user. An
+// enrollment secret is optional here; when given it must be valid and its
+// group scope applies.
 func (d *Dependencies) handleEnrollDevice(w http.ResponseWriter, r *http.Request) {
 	var enrollment DeviceEnrollmentRequest
 	if err := json.NewDecoder(r.Body).Decode(&enrollment); err != nil {
@@ -93,72 +61,17 @@ func (d *Dependencies) handleEnrollDevice(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	// Validate required fields
-	if enrollment.UUID == "" {
-		WriteError(w, http.StatusBadRequest, "Device UUID is required")
-		return
-	}
-	if enrollment.Hostname == "" {
-		WriteError(w, http.StatusBadRequest, "Device hostname is required")
-		return
-	}
-	if enrollment.Platform == "" {
-		WriteError(w, http.StatusBadRequest, "Device platform is required")
-		return
-	}
-
-	// Validate platform
-	validPlatforms := map[string]bool{
-		"windows": true, "macos": true, "linux": true, "ios": true, "android": true,
-	}
-	if !validPlatforms[enrollment.Platform] {
-		WriteError(w, http.StatusBadRequest, "Invalid platform")
-		return
-	}
-
-	// Check license limits
-	license, err := d.LicenseService.GetLicense()
-	if err != nil {
-		log.Error().Err(err).Msg("Failed to check license")
-		WriteError(w, http.StatusInternalServerError, "Failed to check license")
-		return
-	}
-
-	if license.DeviceLimit > 0 && license.DevicesEnrolled >= license.DeviceLimit {
-		WriteError(w, http.StatusForbidden, "Device enrollment limit reached for current license")
-		return
-	}
-
-	// Convert to service model
-	serviceEnrollment := DeviceEnrollment{
-		UUID:             enrollment.UUID,
-		Hostname:         enrollment.Hostname,
-		Platform:         enrollment.Platform,
-		OSVersion:        enrollment.OSVersion,
-		EnrollmentSecret: enrollment.EnrollmentSecret,
-		HardwareInfo:     enrollment.HardwareInfo,
-		SerialNumber:     enrollment.SerialNumber,
-	}
-
-	device, err := d.DeviceService.EnrollDevice(serviceEnrollment)
-	if err != nil {
-		log.Error().
-			Err(err).
-			Str("uuid", enrollment.UUID).
-			Str("hostname", enrollment.Hostname).
-			Msg("Failed to enroll device")
-		WriteError(w, http.StatusInternalServerError, "Failed to enroll device")
-		return
+	var secret *EnrollmentSecret
+	if enrollment.EnrollmentSecret != "" {
+		var err error
+		secret, err = d.EnrollmentService.ValidateEnrollmentSecret(enrollment.EnrollmentSecret)
+		if err != nil {
+			WriteError(w, http.StatusUnauthorized, "Invalid enrollment secret")
+			return
+		}
 	}
 
-	log.Info().
-		Str("device_id", device.ID).
-		Str("uuid", device.UUID).
-		Str("hostname", device.Hostname).
-		Str("platform", device.Platform).
-		Msg("Device enrolled successfully")
-
-	WriteJSON(w, http.StatusCreated, device)
+	d.enrollDevice(w, r, enrollment, secret)
 }
 
 // handleGetDevice retrieves detailed device information
@@ -197,13 +110,32 @@ func (d *Dependencies) handleUpdateDevice(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	before, err := d.DeviceService.GetDevice(deviceID)
+	if err != nil {
+		log.Debug().Err(err).Str("device_id", deviceID).Msg("Device not found for update")
+		WriteError(w, http.StatusNotFound, "Device not found")
+		return
+	}
+	rev, ok := checkIfMatch(w, r, before.Revision)
+	if !ok {
+		return
+	}
+	updates.IfRevision = rev
+
 	updatedDevice, err := d.DeviceService.UpdateDevice(deviceID, updates)
+	if errors.Is(err, ErrRevisionConflict) {
+		writeRevisionConflict(w)
+		return
+	}
 	if err != nil {
 		log.Debug().Err(err).Str("device_id", deviceID).Msg("Device not found for update")
 		WriteError(w, http.StatusNotFound, "Device not found")
 		return
 	}
 
+	d.evaluateDeviceGroups(updatedDevice)
+	d.audit(r, auditRecord{Action: "device.update", TargetType: "device", TargetID: deviceID, Before: before, After: updatedDevice})
+
 	log.Info().Str("device_id", deviceID).Msg("Device updated successfully")
 	WriteJSON(w, http.StatusOK, updatedDevice)
 }
@@ -218,18 +150,33 @@ func (d *Dependencies) handleUnenrollDevice(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	err := d.DeviceService.UnenrollDevice(deviceID)
+	before, err := d.DeviceService.GetDevice(deviceID)
 	if err != nil {
 		log.Debug().Err(err).Str("device_id", deviceID).Msg("Device not found for unenrollment")
 		WriteError(w, http.StatusNotFound, "Device not found")
 		return
 	}
+	if _, ok := checkIfMatch(w, r, before.Revision); !ok {
+		return
+	}
+
+	if err := d.DeviceService.UnenrollDevice(deviceID); err != nil {
+		log.Debug().Err(err).Str("device_id", deviceID).Msg("Device not found for unenrollment")
+		WriteError(w, http.StatusNotFound, "Device not found")
+		return
+	}
+	if err := d.AuthService.RevokeDeviceToken(deviceID); err != nil {
+		log.Error().Err(err).Str("device_id", deviceID).Msg("Failed to revoke device token")
+	}
+
+	d.audit(r, auditRecord{Action: "device.unenroll", TargetType: "device", TargetID: deviceID, Before: before})
 
 	log.Info().Str("device_id", deviceID).Msg("Device unenrolled successfully")
 	WriteJSON(w, http.StatusOK, map[string]string{"message": "Device unenrolled successfully"})
 }
 
-// handleDeviceCommand sends a command to a device
+// handleDeviceCommand queues a command for a device. Devices pick up queued
+// commands on their next fetch, so offline devices are accepted.
 func (d *Dependencies) handleDeviceCommand(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	deviceID := vars["deviceId"]
@@ -245,33 +192,26 @@ func (d *Dependencies) handleDeviceCommand(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	// Validate command
-	validCommands := map[string]bool{
-		"restart":       true,
-		"shutdown":      true,
-		"lock":          true,
-		"wipe":          true,
-		"collect_logs":  true,
-		"run_osquery":   true,
-		"install_app":   true,
-		"uninstall_app": true,
-	}
-
 	if !validCommands[commandReq.Command] {
 		WriteError(w, http.StatusBadRequest, "Invalid command")
 		return
 	}
 
-	// Check if device exists
-	device, err := d.DeviceService.GetDevice(deviceID)
-	if err != nil {
-		WriteError(w, http.StatusNotFound, "Device not found")
+	// Wiping is irreversible and needs its own permission
+	if commandReq.Command == "wipe" {
+		if _, ok := d.requirePermission(w, r, PermDevicesWipe); !ok {
+			return
+		}
+	}
+
+	if commandReq.ExpiresIn < 0 {
+		WriteError(w, http.StatusBadRequest, "expires_in must not be negative")
 		return
 	}
 
-	// Check if device is online
-	if device.Status != "online" {
-		WriteError(w, http.StatusConflict, "Device is not online")
+	// Check if device exists
+	if _, err := d.DeviceService.GetDevice(deviceID); err != nil {
+		WriteError(w, http.StatusNotFound, "Device not found")
 		return
 	}
 
@@ -281,29 +221,48 @@ func (d *Dependencies) handleDeviceCommand(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	// Execute command (this would integrate with device communication layer)
-	commandResult, err := d.DeviceService.ExecuteCommand(deviceID, commandReq.Command, commandReq.Parameters)
+	command, err := d.CommandService.EnqueueCommand(deviceID, CommandCreate{
+		Command:    commandReq.Command,
+		Parameters: commandReq.Parameters,
+		TTL:        time.Duration(commandReq.ExpiresIn) * time.Second,
+		CreatedBy:  user.ID,
+	})
 	if err != nil {
 		log.Error().
 			Err(err).
 			Str("device_id", deviceID).
 			Str("command", commandReq.Command).
 			Str("user_id", user.ID).
-			Msg("Failed to execute device command")
-		WriteError(w, http.StatusInternalServerError, "Failed to execute command")
+			Msg("Failed to queue device command")
+		WriteError(w, http.StatusInternalServerError, "Failed to queue command")
 		return
 	}
 
 	log.Info().
+		Str("command_id", command.ID).
 		Str("device_id", deviceID).
 		Str("command", commandReq.Command).
 		Str("user_id", user.ID).
-		Msg("Device command executed")
+		Msg("Device command queued")
+
+	// Each command is its own action, so that wipes can be found as device.wipe
+	d.audit(r, auditRecord{
+		Action:     "device." + command.Command,
+		TargetType: "device",
+		TargetID:   deviceID,
+		Details: map[string]interface{}{
+			"command_id": command.ID,
+			"parameters": command.Parameters,
+			"expires_at": command.ExpiresAt,
+		},
+	})
 
-	WriteJSON(w, http.StatusOK, commandResult)
+	WriteJSON(w, http.StatusAccepted, command)
 }
 
-// handleDeviceOSQuery executes an OSQuery on a device
+// handleDeviceOSQuery starts a live query campaign targeting a single device.
+// The device answers on its next check-in and the results are streamed to the
+// caller over the WebSocket hub.
 func (d *Dependencies) handleDeviceOSQuery(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	deviceID := vars["deviceId"]
@@ -319,43 +278,12 @@ func (d *Dependencies) handleDeviceOSQuery(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	if queryReq.Query == "" {
-		WriteError(w, http.StatusBadRequest, "OSQuery SQL is required")
-		return
-	}
-
-	// Validate SQL query (basic security check)
-	if !isValidOSQuery(queryReq.Query) {
-		WriteError(w, http.StatusBadRequest, "Invalid or dangerous OSQuery")
-		return
-	}
-
-	user, err := GetUserFromContext(r)
-	if err != nil {
-		WriteError(w, http.StatusUnauthorized, "User context required")
-		return
-	}
-
-	// Execute OSQuery
-	result, err := d.DeviceService.ExecuteOSQuery(deviceID, queryReq.Query)
-	if err != nil {
-		log.Error().
-			Err(err).
-			Str("device_id", deviceID).
-			Str("query", queryReq.Query).
-			Str("user_id", user.ID).
-			Msg("Failed to execute OSQuery")
-		WriteError(w, http.StatusInternalServerError, "Failed to execute OSQuery")
+	if _, err := d.DeviceService.GetDevice(deviceID); err != nil {
+		WriteError(w, http.StatusNotFound, "Device not found")
 		return
 	}
 
-	log.Info().
-		Str("device_id", deviceID).
-		Str("user_id", user.ID).
-		Int("rows", len(result.Rows)).
-		Msg("OSQuery executed successfully")
-
-	WriteJSON(w, http.StatusOK, result)
+	d.startLiveQuery(w, r, queryReq.Query, queryReq.Timeout, []string{deviceID})
 }
 
 // Enhanced data models (new types not in router.go)
@@ -373,14 +301,58 @@ type DeviceEnrollmentRequest struct {
 type DeviceCommandRequest struct {
 	Command    string                 `json:"command"`
 	Parameters map[string]interface{} `json:"parameters,omitempty"`
+	ExpiresIn  int                    `json:"expires_in,omitempty"` // seconds, defaults to DefaultCommandTTL
+}
+
+// validCommands are the commands devices accept
+var validCommands = map[string]bool{
+	"restart":       true,
+	"shutdown":      true,
+	"lock":          true,
+	"wipe":          true,
+	"collect_logs":  true,
+	"run_osquery":   true,
+	"install_app":   true,
+	"uninstall_app": true,
 }
 
 type OSQueryRequest struct {
-	Query string `json:"query"`
+	Query   string `json:"query"`
+	Timeout int    `json:"timeout,omitempty"` // seconds, defaults to DefaultLiveQueryTimeout
 }
 
 // Utility functions
 
+// allDevices returns every enrolled device
+func (d *Dependencies) allDevices() ([]*Device, error) {
+	return d.findDevices(DeviceFilters{})
+}
+
+// findDevices returns every device matching filters, paging through
+// DeviceService. A device re-enrolled while paging may move to a later page;
+// it is only returned once.
+func (d *Dependencies) findDevices(filters DeviceFilters) ([]*Device, error) {
+	const pageSize = 500
+	var all []*Device
+	seen := make(map[string]bool)
+	for offset := 0; ; offset += pageSize {
+		filters.Limit, filters.Offset = pageSize, offset
+		devices, total, err := d.DeviceService.ListDevices(filters)
+		if err != nil {
+			return nil, fmt.Errorf("list devices: %w", err)
+		}
+		for _, device := range devices {
+			if !seen[device.ID] {
+				seen[device.ID] = true
+				all = append(all, device)
+			}
+		}
+		if len(devices) == 0 || offset+len(devices) >= total {
+			return all, nil
+		}
+	}
+}
+
 // isValidOSQuery performs basic validation on OSQuery SQL
 func isValidOSQuery(query string) bool {
 	// Basic security checks - prevent dangerous operations
@@ -0,0 +1,352 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog/log"
+)
+
+// Enrollment secret handlers
+
+// handleListEnrollmentSecrets lists enrollment secrets without their values
+func (d *Dependencies) handleListEnrollmentSecrets(w http.ResponseWriter, r *http.Request) {
+	q, ok := readListQuery(w, r, enrollmentSecretListSpec)
+	if !ok {
+		return
+	}
+
+	var query func(*ListQuery) ([]*EnrollmentSecret, int, error)
+	if querier, ok := d.EnrollmentService.(EnrollmentSecretQuerier); ok {
+		query = querier.QueryEnrollmentSecrets
+	}
+	result, err := listItems(q, enrollmentSecretListSpec, query, d.EnrollmentService.ListEnrollmentSecrets)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list enrollment secrets")
+		WriteError(w, http.StatusInternalServerError, "Failed to list enrollment secrets")
+		return
+	}
+
+	writeList(w, "secrets", result)
+}
+
+// handleCreateEnrollmentSecret creates an enrollment secret, optionally scoped
+// to a device group. The secret value is only returned in this response.
+func (d *Dependencies) handleCreateEnrollmentSecret(w http.ResponseWriter, r *http.Request) {
+	user, err := GetUserFromContext(r)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, "User context required")
+		return
+	}
+
+	var req EnrollmentSecretCreate
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.Name == "" {
+		WriteError(w, http.StatusBadRequest, "Secret name is required")
+		return
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		WriteError(w, http.StatusBadRequest, "expires_at must be in the future")
+		return
+	}
+	if req.GroupID != "" {
+		if _, err := d.DeviceGroupService.GetDeviceGroup(req.GroupID); err != nil {
+			WriteError(w, http.StatusBadRequest, "Device group not found")
+			return
+		}
+	}
+	// Devices enrolled by scoped users must land in their groups
+	if user.IsScoped() && !groupInScope(user, req.GroupID) {
+		d.auditDenied(r, user, PermEnrollmentWrite, "device group outside scope")
+		WriteError(w, http.StatusForbidden, "Enrollment secrets must enroll into one of your device groups")
+		return
+	}
+	req.CreatedBy = user.ID
+
+	secret, err := d.EnrollmentService.CreateEnrollmentSecret(req)
+	if err != nil {
+		log.Error().Err(err).Str("user_id", user.ID).Msg("Failed to create enrollment secret")
+		WriteError(w, http.StatusInternalServerError, "Failed to create enrollment secret")
+		return
+	}
+
+	log.Info().
+		Str("secret_id", secret.ID).
+		Str("group_id", secret.GroupID).
+		Str("user_id", user.ID).
+		Msg("Enrollment secret created")
+
+	d.audit(r, auditRecord{Action: "enrollment_secret.create", TargetType: "enrollment_secret", TargetID: secret.ID, After: secret})
+
+	WriteJSON(w, http.StatusCreated, secret)
+}
+
+// handleGetEnrollmentSecret retrieves an enrollment secret without its value
+func (d *Dependencies) handleGetEnrollmentSecret(w http.ResponseWriter, r *http.Request) {
+	secret, err := d.EnrollmentService.GetEnrollmentSecret(mux.Vars(r)["secretId"])
+	if err != nil {
+		WriteError(w, http.StatusNotFound, "Enrollment secret not found")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, secret)
+}
+
+// handleRotateEnrollmentSecret replaces the value of an enrollment secret. The
+// old value stops working immediately; enrolled devices keep their tokens.
+func (d *Dependencies) handleRotateEnrollmentSecret(w http.ResponseWriter, r *http.Request) {
+	user, err := GetUserFromContext(r)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, "User context required")
+		return
+	}
+
+	secretID := mux.Vars(r)["secretId"]
+	current, err := d.EnrollmentService.GetEnrollmentSecret(secretID)
+	if err != nil {
+		WriteError(w, http.StatusNotFound, "Enrollment secret not found")
+		return
+	}
+	if _, ok := checkIfMatch(w, r, current.Revision); !ok {
+		return
+	}
+
+	secret, err := d.EnrollmentService.RotateEnrollmentSecret(secretID)
+	if err != nil {
+		WriteError(w, http.StatusNotFound, "Enrollment secret not found")
+		return
+	}
+
+	log.Info().
+		Str("secret_id", secretID).
+		Str("user_id", user.ID).
+		Msg("Enrollment secret rotated")
+
+	d.audit(r, auditRecord{Action: "enrollment_secret.rotate", TargetType: "enrollment_secret", TargetID: secretID})
+
+	WriteJSON(w, http.StatusOK, secret)
+}
+
+// handleDeleteEnrollmentSecret deletes an enrollment secret
+func (d *Dependencies) handleDeleteEnrollmentSecret(w http.ResponseWriter, r *http.Request) {
+	user, err := GetUserFromContext(r)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, "User context required")
+		return
+	}
+
+	secretID := mux.Vars(r)["secretId"]
+	before, err := d.EnrollmentService.GetEnrollmentSecret(secretID)
+	if err != nil {
+		WriteError(w, http.StatusNotFound, "Enrollment secret not found")
+		return
+	}
+	if _, ok := checkIfMatch(w, r, before.Revision); !ok {
+		return
+	}
+	if err := d.EnrollmentService.DeleteEnrollmentSecret(secretID); err != nil {
+		WriteError(w, http.StatusNotFound, "Enrollment secret not found")
+		return
+	}
+
+	log.Info().
+		Str("secret_id", secretID).
+		Str("user_id", user.ID).
+		Msg("Enrollment secret deleted")
+
+	d.audit(r, auditRecord{Action: "enrollment_secret.delete", TargetType: "enrollment_secret", TargetID: secretID, Before: before})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleRevokeDeviceToken revokes the token of a device, which must enroll
+// again to reach the device API
+func (d *Dependencies) handleRevokeDeviceToken(w http.ResponseWriter, r *http.Request) {
+	user, err := GetUserFromContext(r)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, "User context required")
+		return
+	}
+
+	deviceID := mux.Vars(r)["deviceId"]
+	if _, err := d.DeviceService.GetDevice(deviceID); err != nil {
+		WriteError(w, http.StatusNotFound, "Device not found")
+		return
+	}
+
+	if err := d.AuthService.RevokeDeviceToken(deviceID); err != nil {
+		log.Error().Err(err).Str("device_id", deviceID).Msg("Failed to revoke device token")
+		WriteError(w, http.StatusInternalServerError, "Failed to revoke device token")
+		return
+	}
+
+	log.Info().
+		Str("device_id", deviceID).
+		Str("user_id", user.ID).
+		Msg("Device token revoked")
+
+	d.audit(r, auditRecord{Action: "device.revoke_token", TargetType: "device", TargetID: deviceID})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Device API handlers (for client connections)
+
+// handleDeviceEnroll enrolls a device presenting a valid enrollment secret
+// and returns the token it uses for the device API
+func (d *Dependencies) handleDeviceEnroll(w http.ResponseWriter, r *http.Request) {
+	var enrollment DeviceEnrollmentRequest
+	if err := json.NewDecoder(r.Body).Decode(&enrollment); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if enrollment.EnrollmentSecret == "" {
+		WriteError(w, http.StatusUnauthorized, "Enrollment secret is required")
+		return
+	}
+	secret, err := d.EnrollmentService.ValidateEnrollmentSecret(enrollment.EnrollmentSecret)
+	if err != nil {
+		log.Debug().Err(err).Str("uuid", enrollment.UUID).Msg("Enrollment rejected")
+		d.audit(r, auditRecord{
+			Action:     "device.enroll",
+			TargetType: "device",
+			TargetID:   enrollment.UUID,
+			Outcome:    AuditOutcomeFailure,
+			Reason:     "invalid enrollment secret",
+		})
+		WriteError(w, http.StatusUnauthorized, "Invalid enrollment secret")
+		return
+	}
+
+	d.enrollDevice(w, r, enrollment, secret)
+}
+
+// handleDeviceRotateToken issues a new token to the calling device; the token
+// used for this request stops working
+func (d *Dependencies) handleDeviceRotateToken(w http.ResponseWriter, r *http.Request) {
+	device, err := GetDeviceFromContext(r)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, "Device context required")
+		return
+	}
+
+	token, err := d.AuthService.IssueDeviceToken(device)
+	if err != nil {
+		log.Error().Err(err).Str("device_id", device.ID).Msg("Failed to rotate device token")
+		WriteError(w, http.StatusInternalServerError, "Failed to rotate device token")
+		return
+	}
+
+	log.Info().Str("device_id", device.ID).Msg("Device token rotated")
+
+	d.audit(r, auditRecord{Action: "device.rotate_token", TargetType: "device", TargetID: device.ID})
+
+	WriteJSON(w, http.StatusOK, map[string]string{
+		"device_id":    device.ID,
+		"device_token": token,
+	})
+}
+
+// enrollDevice validates an enrollment, enrolls the device into the group the
+// secret is scoped to, if any, and responds with the device and its token
+func (d *Dependencies) enrollDevice(w http.ResponseWriter, r *http.Request, enrollment DeviceEnrollmentRequest, secret *EnrollmentSecret) {
+	// Validate required fields
+	if enrollment.UUID == "" {
+		WriteError(w, http.StatusBadRequest, "Device UUID is required")
+		return
+	}
+	if enrollment.Hostname == "" {
+		WriteError(w, http.StatusBadRequest, "Device hostname is required")
+		return
+	}
+	if enrollment.Platform == "" {
+		WriteError(w, http.StatusBadRequest, "Device platform is required")
+		return
+	}
+
+	// Validate platform
+	validPlatforms := map[string]bool{
+		"windows": true, "macos": true, "linux": true, "ios": true, "android": true,
+	}
+	if !validPlatforms[enrollment.Platform] {
+		WriteError(w, http.StatusBadRequest, "Invalid platform")
+		return
+	}
+
+	// Convert to service model
+	serviceEnrollment := DeviceEnrollment{
+		UUID:             enrollment.UUID,
+		Hostname:         enrollment.Hostname,
+		Platform:         enrollment.Platform,
+		OSVersion:        enrollment.OSVersion,
+		EnrollmentSecret: enrollment.EnrollmentSecret,
+		HardwareInfo:     enrollment.HardwareInfo,
+		SerialNumber:     enrollment.SerialNumber,
+	}
+
+	// The device service enforces the device limit of the license
+	device, err := d.DeviceService.EnrollDevice(serviceEnrollment)
+	if errors.Is(err, ErrLicenseDeviceLimit) {
+		log.Warn().Str("uuid", enrollment.UUID).Msg("Enrollment rejected by license device limit")
+		WriteError(w, http.StatusForbidden, "Device enrollment limit reached for current license")
+		return
+	}
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("uuid", enrollment.UUID).
+			Str("hostname", enrollment.Hostname).
+			Msg("Failed to enroll device")
+		WriteError(w, http.StatusInternalServerError, "Failed to enroll device")
+		return
+	}
+
+	if secret != nil && secret.GroupID != "" {
+		if err := d.DeviceGroupService.AddDeviceToGroup(secret.GroupID, device.ID); err != nil {
+			log.Error().
+				Err(err).
+				Str("device_id", device.ID).
+				Str("group_id", secret.GroupID).
+				Msg("Failed to add enrolled device to group")
+		}
+	}
+	d.evaluateDeviceGroups(device)
+
+	// Re-enrolling replaces the token the device held before
+	token, err := d.AuthService.IssueDeviceToken(device)
+	if err != nil {
+		log.Error().Err(err).Str("device_id", device.ID).Msg("Failed to issue device token")
+		WriteError(w, http.StatusInternalServerError, "Failed to issue device token")
+		return
+	}
+
+	event := log.Info().
+		Str("device_id", device.ID).
+		Str("uuid", device.UUID).
+		Str("hostname", device.Hostname).
+		Str("platform", device.Platform)
+	if secret != nil {
+		event = event.Str("secret_id", secret.ID)
+	}
+	event.Msg("Device enrolled successfully")
+
+	rec := auditRecord{Action: "device.enroll", TargetType: "device", TargetID: device.ID, After: device}
+	if secret != nil {
+		rec.Details = map[string]interface{}{"enrollment_secret_id": secret.ID}
+	}
+	if _, err := GetUserFromContext(r); err != nil {
+		// Devices enrolling with a secret act for themselves
+		rec.Actor = &AuditActor{Type: AuditActorDevice, ID: device.ID}
+	}
+	d.audit(r, rec)
+
+	WriteJSON(w, http.StatusCreated, DeviceEnrollmentResponse{Device: device, DeviceToken: token})
+}
@@ -1,88 +1,58 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"runtime"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/rs/zerolog/log"
+
+	"github.com/notawar/mobius/mobius-server/server/health"
 )
 
-// HealthHandler provides system health status
-func HealthHandler(w http.ResponseWriter, r *http.Request) {
-	health := HealthStatus{
-		Status:    "healthy",
-		Timestamp: time.Now(),
-		Version:   GetVersion(),
-		Components: map[string]ComponentStatus{
-			"database": {
-				Status:  "up",
-				Message: "Connected",
-			},
-			"cache": {
-				Status:  "up",
-				Message: "Redis operational",
-			},
-			"storage": {
-				Status:  "up",
-				Message: "File system accessible",
-			},
-		},
+// handleHealth reports the status of every registered backend. It responds
+// with 503 Service Unavailable when a required backend is down.
+func (d *Dependencies) handleHealth(w http.ResponseWriter, r *http.Request) {
+	d.writeHealth(w, r, d.Health.CheckReady)
+}
+
+// handleLiveness reports whether the process should keep running. Only probes
+// of the process itself take part, so an outage of a backend does not get the
+// server restarted.
+func (d *Dependencies) handleLiveness(w http.ResponseWriter, r *http.Request) {
+	d.writeHealth(w, r, d.Health.CheckLive)
+}
+
+func (d *Dependencies) writeHealth(w http.ResponseWriter, r *http.Request, check func(context.Context) health.Report) {
+	report := health.Report{Status: health.StatusHealthy, Components: map[string]health.Result{}}
+	if d.Health != nil {
+		report = check(r.Context())
 	}
 
-	// Check if any components are down
-	allHealthy := true
-	for _, component := range health.Components {
-		if component.Status != "up" {
-			allHealthy = false
-			break
+	for name, result := range report.Components {
+		if result.Status != health.StatusUp {
+			log.Warn().Str("component", name).Str("error", result.Error).Msg("Health check failed")
 		}
 	}
 
-	if !allHealthy {
-		health.Status = "degraded"
+	status := http.StatusOK
+	if !report.Ready() {
+		status = http.StatusServiceUnavailable
 	}
 
-	WriteJSON(w, http.StatusOK, health)
-}
-
-// MetricsHandler provides Prometheus-style metrics
-func MetricsHandler(w http.ResponseWriter, r *http.Request) {
-	var m runtime.MemStats
-	runtime.ReadMemStats(&m)
-
-	metrics := fmt.Sprintf(`# HELP mobius_info Information about Mobius server
-# TYPE mobius_info gauge
-mobius_info{version="%s"} 1
-
-# HELP mobius_memory_usage_bytes Memory usage in bytes
-# TYPE mobius_memory_usage_bytes gauge
-mobius_memory_usage_bytes{type="alloc"} %d
-mobius_memory_usage_bytes{type="total_alloc"} %d
-mobius_memory_usage_bytes{type="sys"} %d
-
-# HELP mobius_goroutines_total Total number of goroutines
-# TYPE mobius_goroutines_total gauge
-mobius_goroutines_total %d
-
-# HELP mobius_uptime_seconds Uptime in seconds
-# TYPE mobius_uptime_seconds gauge
-mobius_uptime_seconds %d
-`,
-		GetVersion(),
-		m.Alloc,
-		m.TotalAlloc,
-		m.Sys,
-		runtime.NumGoroutine(),
-		int64(time.Since(startTime).Seconds()),
-	)
-
-	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(metrics))
+	WriteJSON(w, status, HealthStatus{
+		Status:     report.Status,
+		Timestamp:  time.Now(),
+		Version:    GetVersion(),
+		Components: report.Components,
+	})
 }
 
 // handleLogin handles user authentication
@@ -99,6 +69,7 @@ func (d *Dependencies) handleLogin(w http.ResponseWriter, r *http.Request) {
 	}
 
 	authResp, err := d.AuthService.Login(loginReq.Email, loginReq.Password)
+	d.auditLogin(r, loginReq.Email, authResp, err)
 	if err != nil {
 		log.Warn().
 			Str("email", loginReq.Email).
@@ -116,6 +87,55 @@ func (d *Dependencies) handleLogin(w http.ResponseWriter, r *http.Request) {
 	WriteJSON(w, http.StatusOK, authResp)
 }
 
+// handleRefreshToken exchanges a refresh token for a new token pair
+func (d *Dependencies) handleRefreshToken(w http.ResponseWriter, r *http.Request) {
+	var refreshReq RefreshTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&refreshReq); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if refreshReq.RefreshToken == "" {
+		WriteError(w, http.StatusBadRequest, "Refresh token required")
+		return
+	}
+
+	authResp, err := d.AuthService.Refresh(refreshReq.RefreshToken)
+	if err != nil {
+		log.Debug().Err(err).Msg("Token refresh failed")
+		WriteError(w, http.StatusUnauthorized, "Invalid refresh token")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, authResp)
+}
+
+// handleLogout revokes the session of the current access token
+func (d *Dependencies) handleLogout(w http.ResponseWriter, r *http.Request) {
+	user, err := GetUserFromContext(r)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, "User context required")
+		return
+	}
+
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if err := d.AuthService.Logout(token); err != nil {
+		log.Error().Err(err).Str("user_id", user.ID).Msg("Failed to log out")
+		WriteError(w, http.StatusInternalServerError, "Failed to log out")
+		return
+	}
+
+	d.audit(r, auditRecord{Action: "auth.logout", TargetType: "user", TargetID: user.ID})
+
+	log.Info().
+		Str("user_id", user.ID).
+		Msg("User logged out")
+
+	WriteJSON(w, http.StatusOK, map[string]string{
+		"message": "Logged out successfully",
+	})
+}
+
 // handleGetLicense returns current license status
 func (d *Dependencies) handleGetLicense(w http.ResponseWriter, r *http.Request) {
 	license, err := d.LicenseService.GetLicense()
@@ -128,7 +148,7 @@ func (d *Dependencies) handleGetLicense(w http.ResponseWriter, r *http.Request)
 	WriteJSON(w, http.StatusOK, license)
 }
 
-// handleUpdateLicense updates the license key (admin only)
+// handleUpdateLicense updates the license key
 func (d *Dependencies) handleUpdateLicense(w http.ResponseWriter, r *http.Request) {
 	user, err := GetUserFromContext(r)
 	if err != nil {
@@ -136,11 +156,6 @@ func (d *Dependencies) handleUpdateLicense(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	if user.Role != "admin" {
-		WriteError(w, http.StatusForbidden, "Admin role required")
-		return
-	}
-
 	var licenseReq LicenseUpdateRequest
 	if err := json.NewDecoder(r.Body).Decode(&licenseReq); err != nil {
 		WriteError(w, http.StatusBadRequest, "Invalid request body")
@@ -152,12 +167,31 @@ func (d *Dependencies) handleUpdateLicense(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	before, err := d.LicenseService.GetLicense()
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get license")
+		WriteError(w, http.StatusInternalServerError, "Failed to retrieve license")
+		return
+	}
+
 	if err := d.LicenseService.UpdateLicense(licenseReq.Key); err != nil {
 		log.Error().Err(err).Msg("Failed to update license")
-		WriteError(w, http.StatusBadRequest, "Invalid license key")
+		d.audit(r, auditRecord{
+			Action:     "license.update",
+			TargetType: "license",
+			Outcome:    AuditOutcomeFailure,
+			Reason:     err.Error(),
+		})
+		WriteError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
+	after, err := d.LicenseService.GetLicense()
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get license")
+	}
+	d.audit(r, auditRecord{Action: "license.update", TargetType: "license", Before: before, After: after})
+
 	log.Info().
 		Str("user_id", user.ID).
 		Msg("License updated successfully")
@@ -181,10 +215,21 @@ func (d *Dependencies) handleDeviceCheckin(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	// Store the policy results before anything else so that a malformed
+	// report leaves the device untouched
+	if err := d.recordPolicyResults(device, checkinReq.QueryResults); err != nil {
+		log.Debug().Err(err).Str("device_id", device.ID).Msg("Rejected policy results")
+		WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	// Update device last seen and any other relevant info
 	updates := DeviceUpdates{
 		OSVersion: &checkinReq.OSVersion,
 	}
+	if checkinReq.SystemInfo != nil {
+		updates.SystemInfo = &checkinReq.SystemInfo
+	}
 
 	updatedDevice, err := d.DeviceService.UpdateDevice(device.ID, updates)
 	if err != nil {
@@ -192,29 +237,35 @@ func (d *Dependencies) handleDeviceCheckin(w http.ResponseWriter, r *http.Reques
 		WriteError(w, http.StatusInternalServerError, "Failed to update device")
 		return
 	}
+	d.evaluateDeviceGroups(updatedDevice)
+
+	// Hand out live queries the device has yet to answer
+	queries, err := d.LiveQueryService.PendingQueries(device.ID)
+	if err != nil {
+		log.Error().Err(err).Str("device_id", device.ID).Msg("Failed to get live queries")
+		WriteError(w, http.StatusInternalServerError, "Failed to get live queries")
+		return
+	}
 
 	log.Debug().
 		Str("device_id", device.ID).
 		Str("hostname", device.Hostname).
+		Int("queries", len(queries)).
 		Msg("Device checked in")
 
 	WriteJSON(w, http.StatusOK, map[string]interface{}{
 		"message": "Check-in successful",
 		"device":  updatedDevice,
+		"queries": queries,
 	})
 }
 
 // Data structures for handlers
 type HealthStatus struct {
-	Status     string                     `json:"status"`
-	Timestamp  time.Time                  `json:"timestamp"`
-	Version    string                     `json:"version"`
-	Components map[string]ComponentStatus `json:"components"`
-}
-
-type ComponentStatus struct {
-	Status  string `json:"status"`
-	Message string `json:"message"`
+	Status     string                   `json:"status"`
+	Timestamp  time.Time                `json:"timestamp"`
+	Version    string                   `json:"version"`
+	Components map[string]health.Result `json:"components"`
 }
 
 type LoginRequest struct {
@@ -222,6 +273,10 @@ type LoginRequest struct {
 	Password string `json:"password"`
 }
 
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
 type LicenseUpdateRequest struct {
 	Key string `json:"key"`
 }
@@ -233,7 +288,6 @@ type DeviceCheckinRequest struct {
 }
 
 // Global variables
-var startTime = time.Now()
 
 // GetVersion returns the current version
 func GetVersion() string {
@@ -311,17 +365,23 @@ func (d *Dependencies) handleAssignDevicePolicies(w http.ResponseWriter, r *http
 
 // Policy management handlers
 func (d *Dependencies) handleListPolicies(w http.ResponseWriter, r *http.Request) {
-	policies, err := d.PolicyService.ListPolicies()
+	q, ok := readListQuery(w, r, policyListSpec)
+	if !ok {
+		return
+	}
+
+	var query func(*ListQuery) ([]*Policy, int, error)
+	if querier, ok := d.PolicyService.(PolicyQuerier); ok {
+		query = querier.QueryPolicies
+	}
+	result, err := listItems(q, policyListSpec, query, d.PolicyService.ListPolicies)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to list policies")
 		WriteError(w, http.StatusInternalServerError, "Failed to list policies")
 		return
 	}
 
-	WriteJSON(w, http.StatusOK, map[string]interface{}{
-		"policies": policies,
-		"total":    len(policies),
-	})
+	writeList(w, "policies", result)
 }
 
 func (d *Dependencies) handleCreatePolicy(w http.ResponseWriter, r *http.Request) {
@@ -357,6 +417,8 @@ func (d *Dependencies) handleCreatePolicy(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	d.audit(r, auditRecord{Action: "policy.create", TargetType: "policy", TargetID: policy.ID, After: policy})
+
 	WriteJSON(w, http.StatusCreated, policy)
 }
 
@@ -393,13 +455,30 @@ func (d *Dependencies) handleUpdatePolicy(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	before, err := d.PolicyService.GetPolicy(policyID)
+	if err != nil {
+		WriteError(w, http.StatusNotFound, "Policy not found")
+		return
+	}
+	rev, ok := checkIfMatch(w, r, before.Revision)
+	if !ok {
+		return
+	}
+	updates.IfRevision = rev
+
 	policy, err := d.PolicyService.UpdatePolicy(policyID, updates)
+	if errors.Is(err, ErrRevisionConflict) {
+		writeRevisionConflict(w)
+		return
+	}
 	if err != nil {
 		log.Error().Err(err).Str("policy_id", policyID).Msg("Failed to update policy")
 		WriteError(w, http.StatusInternalServerError, "Failed to update policy")
 		return
 	}
 
+	d.audit(r, auditRecord{Action: "policy.update", TargetType: "policy", TargetID: policyID, Before: before, After: policy})
+
 	WriteJSON(w, http.StatusOK, policy)
 }
 
@@ -412,13 +491,23 @@ func (d *Dependencies) handleDeletePolicy(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	err := d.PolicyService.DeletePolicy(policyID)
+	before, err := d.PolicyService.GetPolicy(policyID)
 	if err != nil {
+		WriteError(w, http.StatusNotFound, "Policy not found")
+		return
+	}
+	if _, ok := checkIfMatch(w, r, before.Revision); !ok {
+		return
+	}
+
+	if err := d.PolicyService.DeletePolicy(policyID); err != nil {
 		log.Error().Err(err).Str("policy_id", policyID).Msg("Failed to delete policy")
 		WriteError(w, http.StatusInternalServerError, "Failed to delete policy")
 		return
 	}
 
+	d.audit(r, auditRecord{Action: "policy.delete", TargetType: "policy", TargetID: policyID, Before: before})
+
 	WriteJSON(w, http.StatusOK, map[string]string{
 		"message": "Policy deleted successfully",
 	})
@@ -436,17 +525,37 @@ func (d *Dependencies) handleGetPolicyDevices(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	devices, err := d.PolicyService.GetPolicyDevices(policyID)
+	q, ok := readListQuery(w, r, deviceListSpec)
+	if !ok {
+		return
+	}
+
+	// Users scoped to device groups only see the members of their groups
+	user, err := GetUserFromContext(r)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, "User context required")
+		return
+	}
+	scopeListQuery(q, user)
+
+	var query func(*ListQuery) ([]*Device, int, error)
+	if querier, ok := d.PolicyService.(PolicyQuerier); ok {
+		query = func(q *ListQuery) ([]*Device, int, error) { return querier.QueryPolicyDevices(policyID, q) }
+	}
+	result, err := listItems(q, deviceListSpec, query, func() ([]*Device, error) {
+		devices, err := d.PolicyService.GetPolicyDevices(policyID)
+		if err != nil {
+			return nil, err
+		}
+		return filterDeviceScope(d, q, devices, func(device *Device) string { return device.ID })
+	})
 	if err != nil {
 		log.Error().Err(err).Str("policy_id", policyID).Msg("Failed to get policy devices")
 		WriteError(w, http.StatusInternalServerError, "Failed to get policy devices")
 		return
 	}
 
-	WriteJSON(w, http.StatusOK, map[string]interface{}{
-		"devices": devices,
-		"count":   len(devices),
-	})
+	writeList(w, "devices", result)
 }
 
 // handleAssignPolicyToDevice assigns a policy to a device
@@ -484,6 +593,13 @@ func (d *Dependencies) handleAssignPolicyToDevice(w http.ResponseWriter, r *http
 		Str("user_id", user.ID).
 		Msg("Policy assigned to device")
 
+	d.audit(r, auditRecord{
+		Action:     "policy.assign",
+		TargetType: "policy",
+		TargetID:   policyID,
+		Details:    map[string]interface{}{"device_id": deviceID},
+	})
+
 	WriteJSON(w, http.StatusOK, map[string]string{
 		"message": "Policy assigned to device successfully",
 	})
@@ -524,6 +640,13 @@ func (d *Dependencies) handleUnassignPolicyFromDevice(w http.ResponseWriter, r *
 		Str("user_id", user.ID).
 		Msg("Policy unassigned from device")
 
+	d.audit(r, auditRecord{
+		Action:     "policy.unassign",
+		TargetType: "policy",
+		TargetID:   policyID,
+		Details:    map[string]interface{}{"device_id": deviceID},
+	})
+
 	WriteJSON(w, http.StatusOK, map[string]string{
 		"message": "Policy unassigned from device successfully",
 	})
@@ -539,17 +662,37 @@ func (d *Dependencies) handleGetPolicyGroups(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	groups, err := d.PolicyService.GetPolicyGroups(policyID)
+	q, ok := readListQuery(w, r, deviceGroupListSpec)
+	if !ok {
+		return
+	}
+
+	// Users scoped to device groups only see their own groups
+	user, err := GetUserFromContext(r)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, "User context required")
+		return
+	}
+	scopeListQuery(q, user)
+
+	var query func(*ListQuery) ([]*DeviceGroup, int, error)
+	if querier, ok := d.PolicyService.(PolicyQuerier); ok {
+		query = func(q *ListQuery) ([]*DeviceGroup, int, error) { return querier.QueryPolicyGroups(policyID, q) }
+	}
+	result, err := listItems(q, deviceGroupListSpec, query, func() ([]*DeviceGroup, error) {
+		groups, err := d.PolicyService.GetPolicyGroups(policyID)
+		if err != nil {
+			return nil, err
+		}
+		return filterGroupScope(q, groups), nil
+	})
 	if err != nil {
 		log.Error().Err(err).Str("policy_id", policyID).Msg("Failed to get policy groups")
 		WriteError(w, http.StatusInternalServerError, "Failed to get policy groups")
 		return
 	}
 
-	WriteJSON(w, http.StatusOK, map[string]interface{}{
-		"groups": groups,
-		"count":  len(groups),
-	})
+	writeList(w, "groups", result)
 }
 
 // handleAssignPolicyToGroup assigns a policy to a device group
@@ -587,6 +730,13 @@ func (d *Dependencies) handleAssignPolicyToGroup(w http.ResponseWriter, r *http.
 		Str("user_id", user.ID).
 		Msg("Policy assigned to group")
 
+	d.audit(r, auditRecord{
+		Action:     "policy.assign",
+		TargetType: "policy",
+		TargetID:   policyID,
+		Details:    map[string]interface{}{"group_id": groupID},
+	})
+
 	WriteJSON(w, http.StatusOK, map[string]string{
 		"message": "Policy assigned to group successfully",
 	})
@@ -627,6 +777,13 @@ func (d *Dependencies) handleUnassignPolicyFromGroup(w http.ResponseWriter, r *h
 		Str("user_id", user.ID).
 		Msg("Policy unassigned from group")
 
+	d.audit(r, auditRecord{
+		Action:     "policy.unassign",
+		TargetType: "policy",
+		TargetID:   policyID,
+		Details:    map[string]interface{}{"group_id": groupID},
+	})
+
 	WriteJSON(w, http.StatusOK, map[string]string{
 		"message": "Policy unassigned from group successfully",
 	})
@@ -634,56 +791,99 @@ func (d *Dependencies) handleUnassignPolicyFromGroup(w http.ResponseWriter, r *h
 
 // Application management handlers
 func (d *Dependencies) handleListApplications(w http.ResponseWriter, r *http.Request) {
-	applications, err := d.ApplicationService.ListApplications()
+	q, ok := readListQuery(w, r, applicationListSpec)
+	if !ok {
+		return
+	}
+
+	var query func(*ListQuery) ([]*Application, int, error)
+	if querier, ok := d.ApplicationService.(ApplicationQuerier); ok {
+		query = querier.QueryApplications
+	}
+	result, err := listItems(q, applicationListSpec, query, d.ApplicationService.ListApplications)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to list applications")
 		WriteError(w, http.StatusInternalServerError, "Failed to list applications")
 		return
 	}
 
-	WriteJSON(w, http.StatusOK, map[string]interface{}{
-		"applications": applications,
-		"total":        len(applications),
-	})
+	writeList(w, "applications", result)
 }
 
+// handleAddApplication adds an application from a multipart upload. The
+// package is streamed to the package store, so the "package" file must be
+// the last part, after the optional name, version and platform fields.
 func (d *Dependencies) handleAddApplication(w http.ResponseWriter, r *http.Request) {
-	var appCreate ApplicationCreate
-	if err := json.NewDecoder(r.Body).Decode(&appCreate); err != nil {
-		WriteError(w, http.StatusBadRequest, "Invalid request body")
-		return
+	// Large uploads take longer than the server timeouts allow
+	rc := http.NewResponseController(w)
+	if err := errors.Join(rc.SetReadDeadline(time.Time{}), rc.SetWriteDeadline(time.Time{})); err != nil {
+		log.Warn().Err(err).Msg("Failed to lift the deadlines of a package upload")
 	}
 
-	// Validate required fields
-	if appCreate.Name == "" {
-		WriteError(w, http.StatusBadRequest, "Application name is required")
-		return
-	}
-	if appCreate.Version == "" {
-		WriteError(w, http.StatusBadRequest, "Application version is required")
-		return
-	}
-	if appCreate.Platform == "" {
-		WriteError(w, http.StatusBadRequest, "Application platform is required")
+	r.Body = http.MaxBytesReader(w, r.Body, MaxPackageSize)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "Request must be multipart/form-data")
 		return
 	}
 
-	// Validate platform
-	validPlatforms := map[string]bool{
-		"windows": true, "macos": true, "linux": true, "ios": true, "android": true,
-	}
-	if !validPlatforms[appCreate.Platform] {
-		WriteError(w, http.StatusBadRequest, "Invalid platform")
-		return
+	var appCreate ApplicationCreate
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			WriteError(w, http.StatusBadRequest, "Application package is required")
+			return
+		}
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, "Invalid multipart body")
+			return
+		}
+
+		if part.FormName() == "package" {
+			appCreate.Filename = part.FileName()
+			appCreate.Package = part
+			break
+		}
+
+		value, err := io.ReadAll(io.LimitReader(part, 1024))
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, "Invalid multipart body")
+			return
+		}
+		switch part.FormName() {
+		case "name":
+			appCreate.Name = string(value)
+		case "version":
+			appCreate.Version = string(value)
+		case "platform":
+			appCreate.Platform = string(value)
+		}
 	}
 
 	application, err := d.ApplicationService.AddApplication(appCreate)
-	if err != nil {
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		WriteError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Package exceeds %d bytes", tooLarge.Limit))
+		return
+	case errors.Is(err, ErrInvalidApplication):
+		WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	case err != nil:
 		log.Error().Err(err).Str("name", appCreate.Name).Msg("Failed to add application")
 		WriteError(w, http.StatusInternalServerError, "Failed to add application")
 		return
 	}
 
+	log.Info().
+		Str("app_id", application.ID).
+		Str("name", application.Name).
+		Str("version", application.Version).
+		Int64("size", application.Size).
+		Msg("Application added")
+
+	d.audit(r, auditRecord{Action: "application.create", TargetType: "application", TargetID: application.ID, After: application})
+
 	WriteJSON(w, http.StatusCreated, application)
 }
 
@@ -720,13 +920,30 @@ func (d *Dependencies) handleUpdateApplication(w http.ResponseWriter, r *http.Re
 		return
 	}
 
+	before, err := d.ApplicationService.GetApplication(appID)
+	if err != nil {
+		WriteError(w, http.StatusNotFound, "Application not found")
+		return
+	}
+	rev, ok := checkIfMatch(w, r, before.Revision)
+	if !ok {
+		return
+	}
+	updates.IfRevision = rev
+
 	application, err := d.ApplicationService.UpdateApplication(appID, updates)
+	if errors.Is(err, ErrRevisionConflict) {
+		writeRevisionConflict(w)
+		return
+	}
 	if err != nil {
 		log.Error().Err(err).Str("app_id", appID).Msg("Failed to update application")
 		WriteError(w, http.StatusInternalServerError, "Failed to update application")
 		return
 	}
 
+	d.audit(r, auditRecord{Action: "application.update", TargetType: "application", TargetID: appID, Before: before, After: application})
+
 	WriteJSON(w, http.StatusOK, application)
 }
 
@@ -739,13 +956,23 @@ func (d *Dependencies) handleDeleteApplication(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	err := d.ApplicationService.DeleteApplication(appID)
+	before, err := d.ApplicationService.GetApplication(appID)
 	if err != nil {
+		WriteError(w, http.StatusNotFound, "Application not found")
+		return
+	}
+	if _, ok := checkIfMatch(w, r, before.Revision); !ok {
+		return
+	}
+
+	if err := d.ApplicationService.DeleteApplication(appID); err != nil {
 		log.Error().Err(err).Str("app_id", appID).Msg("Failed to delete application")
 		WriteError(w, http.StatusInternalServerError, "Failed to delete application")
 		return
 	}
 
+	d.audit(r, auditRecord{Action: "application.delete", TargetType: "application", TargetID: appID, Before: before})
+
 	WriteJSON(w, http.StatusOK, map[string]string{
 		"message": "Application deleted successfully",
 	})
@@ -789,12 +1016,46 @@ func (d *Dependencies) handleDeviceGetApplications(w http.ResponseWriter, r *htt
 		return
 	}
 
+	// Published applications are only listed to the devices whose catalog
+	// holds them, and restricted ones once approved
+	catalog, err := d.loadDeviceCatalog(device)
+	if err != nil {
+		log.Error().Err(err).Str("device_id", device.ID).Msg("Failed to load catalog")
+		WriteError(w, http.StatusInternalServerError, "Failed to get applications")
+		return
+	}
+	var requests map[string]*ApplicationRequest
+	if len(catalog.applications) > 0 {
+		requests, err = d.latestApplicationRequests(device.ID)
+		if err != nil {
+			log.Error().Err(err).Str("device_id", device.ID).Msg("Failed to list application requests")
+			WriteError(w, http.StatusInternalServerError, "Failed to get applications")
+			return
+		}
+	}
+
 	// Filter applications by device platform
-	var deviceApplications []*Application
+	deviceApplications := make([]DeviceApplication, 0)
+	expiresAt := time.Now().Add(DownloadURLTTL).Truncate(time.Second)
 	for _, app := range allApplications {
-		if app.Platform == device.Platform || app.Platform == "all" {
-			deviceApplications = append(deviceApplications, app)
+		if !applicationFitsDevice(app, device) {
+			continue
+		}
+		selfService := catalog.published[app.ID]
+		if selfService {
+			restricted, inCatalog := catalog.restricted[app.ID]
+			if !inCatalog || (restricted && !approved(requests[app.ID])) {
+				continue
+			}
+		}
+		deviceApp := DeviceApplication{Application: app, SelfService: selfService}
+		// Imported applications are installed by the package manager of
+		// the device and have no package to download
+		if app.Source == nil {
+			deviceApp.DownloadURL = d.signedPackageURL(r, app.ID, expiresAt)
+			deviceApp.DownloadExpiresAt = &expiresAt
 		}
+		deviceApplications = append(deviceApplications, deviceApp)
 	}
 
 	WriteJSON(w, http.StatusOK, map[string]interface{}{
@@ -820,6 +1081,7 @@ func (deps *Dependencies) handleLegacyLogin(w http.ResponseWriter, r *http.Reque
 
 	// Use the existing auth service
 	authResponse, err := deps.AuthService.Login(loginReq.Email, loginReq.Password)
+	deps.auditLogin(r, loginReq.Email, authResponse, err)
 	if err != nil {
 		WriteError(w, http.StatusUnauthorized, "Invalid credentials")
 		return
@@ -847,7 +1109,12 @@ func (deps *Dependencies) handleLegacyLogin(w http.ResponseWriter, r *http.Reque
 
 // handleLegacyLogout handles logout requests from legacy CLI
 func (deps *Dependencies) handleLegacyLogout(w http.ResponseWriter, r *http.Request) {
-	// Legacy logout - just return success
+	if token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "); token != "" {
+		if err := deps.AuthService.Logout(token); err != nil {
+			log.Debug().Err(err).Msg("Legacy logout with invalid token")
+		}
+	}
+
 	WriteJSON(w, http.StatusOK, map[string]interface{}{
 		"err": nil,
 	})
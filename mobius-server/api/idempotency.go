@@ -0,0 +1,241 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultIdempotencyTTL is how long responses are kept for replay
+const DefaultIdempotencyTTL = 24 * time.Hour
+
+// MaxIdempotencyKeyLength is the longest Idempotency-Key accepted
+const MaxIdempotencyKeyLength = 255
+
+// idempotencyLockTTL bounds how long a request holds its key. A server that
+// stops while handling the request releases it when the lock expires.
+const idempotencyLockTTL = 5 * time.Minute
+
+// idempotencyReplayHeaders are the response headers replayed with the body
+var idempotencyReplayHeaders = []string{"Content-Type", "ETag", "Location"}
+
+// IdempotencyStore holds the responses of requests by their idempotency key.
+// Share a Redis store between replicas so that a retry reaching another
+// replica is replayed too.
+type IdempotencyStore interface {
+	// Claim stores value under key for ttl unless key holds a value, and
+	// returns the value it holds otherwise
+	Claim(key string, value []byte, ttl time.Duration) (claimed bool, existing []byte, err error)
+	// Save replaces the value of key
+	Save(key string, value []byte, ttl time.Duration) error
+	// Release deletes key
+	Release(key string) error
+}
+
+// Idempotency replays the responses of retried requests. Clients send an
+// Idempotency-Key header with POST, PUT, PATCH and DELETE requests; the
+// first request with a key runs, and later ones with the same key and
+// request get its response back instead of running again. Keys are scoped to
+// the user or device sending them.
+//
+// Responses with a 5xx status are not kept, so those requests may be
+// retried. Neither are responses over MaxValidatedBodySize.
+type Idempotency struct {
+	Store IdempotencyStore
+	// TTL is how long responses are kept; DefaultIdempotencyTTL if zero
+	TTL time.Duration
+}
+
+// idempotentResponse is what a key holds: a request in progress, or the
+// response to replay
+type idempotentResponse struct {
+	// Fingerprint identifies the request, so that a key is not reused for
+	// another one
+	Fingerprint string            `json:"fingerprint"`
+	Pending     bool              `json:"pending,omitempty"`
+	Status      int               `json:"status,omitempty"`
+	Header      map[string]string `json:"header,omitempty"`
+	Body        []byte            `json:"body,omitempty"`
+}
+
+// Middleware applies idempotency keys to the requests of a router. A nil
+// Idempotency passes requests through.
+func (i *Idempotency) Middleware(next http.Handler) http.Handler {
+	if i == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" || !idempotentMethod(r.Method) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !validIdempotencyKey(key) {
+			WriteError(w, http.StatusBadRequest, "Idempotency-Key must be 1 to "+
+				strconv.Itoa(MaxIdempotencyKeyLength)+" printable ASCII characters")
+			return
+		}
+
+		fingerprint, err := requestFingerprint(r)
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, "Failed to read request body")
+			return
+		}
+
+		storeKey := idempotencyStoreKey(r, key)
+		pending, _ := json.Marshal(idempotentResponse{Fingerprint: fingerprint, Pending: true})
+		claimed, existing, err := i.Store.Claim(storeKey, pending, idempotencyLockTTL)
+		if err != nil {
+			// Failing open keeps the API available; the request runs as if
+			// it had no key
+			log.Error().Err(err).Msg("Failed to claim idempotency key")
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !claimed {
+			replayIdempotentResponse(w, existing, fingerprint)
+			return
+		}
+
+		recorder := &recordingResponseWriter{responseWriter: &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}}
+		next.ServeHTTP(recorder, r)
+		i.save(storeKey, fingerprint, recorder)
+	})
+}
+
+// save keeps the response to a request for replay, or releases its key for
+// a retry when it cannot be replayed
+func (i *Idempotency) save(storeKey, fingerprint string, recorder *recordingResponseWriter) {
+	if recorder.statusCode >= http.StatusInternalServerError || recorder.truncated {
+		if err := i.Store.Release(storeKey); err != nil {
+			log.Error().Err(err).Msg("Failed to release idempotency key")
+		}
+		return
+	}
+
+	resp := idempotentResponse{
+		Fingerprint: fingerprint,
+		Status:      recorder.statusCode,
+		Header:      make(map[string]string),
+		Body:        recorder.body.Bytes(),
+	}
+	for _, name := range idempotencyReplayHeaders {
+		if value := recorder.Header().Get(name); value != "" {
+			resp.Header[name] = value
+		}
+	}
+	value, err := json.Marshal(resp)
+	if err == nil {
+		err = i.Store.Save(storeKey, value, i.ttl())
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to save idempotent response")
+	}
+}
+
+func (i *Idempotency) ttl() time.Duration {
+	if i.TTL > 0 {
+		return i.TTL
+	}
+	return DefaultIdempotencyTTL
+}
+
+// replayIdempotentResponse answers a request whose key is held by an earlier
+// one
+func replayIdempotentResponse(w http.ResponseWriter, existing []byte, fingerprint string) {
+	var resp idempotentResponse
+	if err := json.Unmarshal(existing, &resp); err != nil {
+		log.Error().Err(err).Msg("Failed to decode idempotent response")
+		WriteError(w, http.StatusInternalServerError, "Failed to replay response")
+		return
+	}
+
+	switch {
+	case resp.Fingerprint != fingerprint:
+		WriteError(w, http.StatusUnprocessableEntity, "Idempotency-Key was already used for another request")
+	case resp.Pending:
+		w.Header().Set("Retry-After", "1")
+		WriteError(w, http.StatusConflict, "A request with this Idempotency-Key is in progress")
+	default:
+		for name, value := range resp.Header {
+			w.Header().Set(name, value)
+		}
+		w.Header().Set("Idempotent-Replayed", "true")
+		w.WriteHeader(resp.Status)
+		w.Write(resp.Body) //nolint:errcheck
+	}
+}
+
+func idempotentMethod(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+func validIdempotencyKey(key string) bool {
+	if len(key) > MaxIdempotencyKeyLength {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < 0x20 || key[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// idempotencyStoreKey scopes a key to the user or device sending it, so that
+// callers cannot replay each other's responses
+func idempotencyStoreKey(r *http.Request, key string) string {
+	scope := "anonymous"
+	if user, err := GetUserFromContext(r); err == nil {
+		scope = "user:" + user.ID
+	} else if device, err := GetDeviceFromContext(r); err == nil {
+		scope = "device:" + device.ID
+	}
+	sum := sha256.Sum256([]byte(scope + "\x00" + key))
+	return hex.EncodeToString(sum[:])
+}
+
+// requestFingerprint hashes the method, URL, content type and body of a
+// request. Only the first MaxValidatedBodySize bytes of the body are
+// hashed, with its length, so that package uploads are not held in memory;
+// the body is restored for the handler. Multipart bodies are not hashed:
+// clients pick a new boundary for every attempt, so they never match.
+func requestFingerprint(r *http.Request) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %s\n", r.Method, r.URL.RequestURI())
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if strings.HasPrefix(mediaType, "multipart/") {
+		fmt.Fprintf(h, "%s\n", mediaType)
+		return hex.EncodeToString(h.Sum(nil)), nil
+	}
+	fmt.Fprintf(h, "%s\n%d\n", r.Header.Get("Content-Type"), r.ContentLength)
+
+	if r.Body != nil {
+		prefix, err := io.ReadAll(io.LimitReader(r.Body, MaxValidatedBodySize))
+		if err != nil {
+			return "", err
+		}
+		h.Write(prefix)
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(prefix), r.Body), r.Body}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,158 @@
+package api_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/notawar/mobius/mobius-server/api"
+	"github.com/notawar/mobius/mobius-server/pkg/service"
+)
+
+// withIdempotency enables idempotency keys on a test server
+func withIdempotency(deps *api.Dependencies) {
+	deps.Idempotency = &api.Idempotency{Store: service.NewIdempotencyStore()}
+}
+
+func TestIdempotencyReplay(t *testing.T) {
+	server := newTestServer(t, withIdempotency)
+	_, token := server.createUser(t, api.RoleAdmin)
+
+	create := func(name, key string) *http.Response {
+		return server.do(t, "POST", "/device-groups", token, api.DeviceGroupCreate{Name: name}, "Idempotency-Key", key)
+	}
+
+	var first, replayed api.DeviceGroup
+	resp := create("Laptops", "create-laptops")
+	decode(t, resp, http.StatusCreated, &first)
+	if resp.Header.Get("Idempotent-Replayed") != "" {
+		t.Error("expected the first response not to be replayed")
+	}
+
+	resp = create("Laptops", "create-laptops")
+	decode(t, resp, http.StatusCreated, &replayed)
+	if resp.Header.Get("Idempotent-Replayed") != "true" {
+		t.Error("expected the retry to be replayed")
+	}
+	if replayed.ID != first.ID {
+		t.Errorf("expected group %s replayed, got %s", first.ID, replayed.ID)
+	}
+
+	// The same key cannot be reused for another request
+	decode(t, create("Desktops", "create-laptops"), http.StatusUnprocessableEntity, nil)
+
+	// Requests without a key, or with another one, run again
+	var again api.DeviceGroup
+	decode(t, create("Laptops", "create-laptops-again"), http.StatusCreated, &again)
+	if again.ID == first.ID {
+		t.Error("expected a new group for a new key")
+	}
+
+	groups, err := server.deps.DeviceGroupService.ListDeviceGroups()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(groups) != 2 {
+		t.Errorf("expected 2 groups, got %d", len(groups))
+	}
+
+	decode(t, create("Laptops", strings.Repeat("k", api.MaxIdempotencyKeyLength+1)), http.StatusBadRequest, nil)
+}
+
+func TestIdempotencyKeyScope(t *testing.T) {
+	server := newTestServer(t, withIdempotency)
+
+	t.Run("users", func(t *testing.T) {
+		var groupIDs []string
+		for i := 0; i < 2; i++ {
+			_, token := server.createUser(t, api.RoleAdmin)
+			var group api.DeviceGroup
+			resp := server.do(t, "POST", "/device-groups", token, api.DeviceGroupCreate{Name: "Servers"}, "Idempotency-Key", "create-servers")
+			decode(t, resp, http.StatusCreated, &group)
+			if resp.Header.Get("Idempotent-Replayed") != "" {
+				t.Errorf("expected user %d not to get a replayed response", i+1)
+			}
+			groupIDs = append(groupIDs, group.ID)
+		}
+		if groupIDs[0] == groupIDs[1] {
+			t.Error("expected each user to create their own group")
+		}
+	})
+
+	t.Run("devices", func(t *testing.T) {
+		for _, deviceID := range []string{"device-1", "device-2"} {
+			device, err := server.deps.DeviceService.EnrollDevice(api.DeviceEnrollment{UUID: deviceID, Hostname: deviceID, Platform: "linux"})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			token, err := server.deps.AuthService.IssueDeviceToken(device)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var checkin struct {
+				Device api.Device `json:"device"`
+			}
+			resp := server.do(t, "POST", "/device/checkin", token, api.DeviceCheckinRequest{OSVersion: "6.8"}, "Idempotency-Key", "checkin-1")
+			decode(t, resp, http.StatusOK, &checkin)
+			if checkin.Device.ID != device.ID || resp.Header.Get("Idempotent-Replayed") != "" {
+				t.Errorf("expected the check-in of %s, got that of %s", device.ID, checkin.Device.ID)
+			}
+		}
+	})
+}
+
+func TestIdempotencyRetries(t *testing.T) {
+	idempotency := &api.Idempotency{Store: service.NewIdempotencyStore()}
+
+	var calls int32
+	status := http.StatusInternalServerError
+	var started, release chan struct{}
+	handler := idempotency.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if started != nil {
+			close(started)
+			<-release
+		}
+		w.WriteHeader(status)
+	}))
+	send := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/", strings.NewReader("{}"))
+		req.Header.Set("Idempotency-Key", key)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Server errors are not kept, so the request may be retried
+	if rec := send("retry"); rec.Code != http.StatusInternalServerError {
+		t.Fatalf("expected status 500, got %d", rec.Code)
+	}
+	status = http.StatusAccepted
+	if rec := send("retry"); rec.Code != http.StatusAccepted || rec.Header().Get("Idempotent-Replayed") != "" {
+		t.Fatalf("expected the retry to run, got %d", rec.Code)
+	}
+	if rec := send("retry"); rec.Code != http.StatusAccepted || rec.Header().Get("Idempotent-Replayed") != "true" {
+		t.Fatalf("expected the response to be replayed, got %d", rec.Code)
+	}
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("expected the handler to run twice, got %d", n)
+	}
+
+	// A retry while the first request runs is refused
+	started, release = make(chan struct{}), make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		send("slow")
+	}()
+	<-started
+	rec := send("slow")
+	close(release)
+	<-done
+	if rec.Code != http.StatusConflict || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("expected status 409 with Retry-After, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,140 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// handleImportApplication adds an application from a package of the
+// package search catalog, such as a result of its /search/windows endpoint.
+// Devices install the application with their package manager.
+func (d *Dependencies) handleImportApplication(w http.ResponseWriter, r *http.Request) {
+	if d.PackageSearchService == nil {
+		WriteError(w, http.StatusServiceUnavailable, "Package search is not configured")
+		return
+	}
+
+	var req ApplicationImportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.PackageID == "" {
+		WriteError(w, http.StatusBadRequest, "package_id is required")
+		return
+	}
+
+	pkg, err := d.PackageSearchService.GetPackage(r.Context(), req.PackageID)
+	if errors.Is(err, ErrPackageNotFound) {
+		WriteError(w, http.StatusNotFound, "Package not found")
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Str("package_id", req.PackageID).Msg("Failed to look up package")
+		WriteError(w, http.StatusBadGateway, "Failed to look up package")
+		return
+	}
+
+	application, err := d.ApplicationService.ImportApplication(ApplicationImport{
+		Package:  pkg,
+		Platform: req.Platform,
+		Name:     req.Name,
+	})
+	if errors.Is(err, ErrInvalidApplication) {
+		WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Str("package_id", req.PackageID).Msg("Failed to import application")
+		WriteError(w, http.StatusInternalServerError, "Failed to import application")
+		return
+	}
+
+	log.Info().
+		Str("app_id", application.ID).
+		Str("package_id", req.PackageID).
+		Str("version", application.Version).
+		Msg("Application imported")
+
+	d.audit(r, auditRecord{
+		Action:     "application.import",
+		TargetType: "application",
+		TargetID:   application.ID,
+		After:      application,
+		Details:    map[string]interface{}{"package_id": req.PackageID},
+	})
+
+	WriteJSON(w, http.StatusCreated, application)
+}
+
+// handleCheckApplicationUpdates checks the imported applications for newer
+// upstream versions now, rather than at the next periodic check
+func (d *Dependencies) handleCheckApplicationUpdates(w http.ResponseWriter, r *http.Request) {
+	if d.PackageSearchService == nil {
+		WriteError(w, http.StatusServiceUnavailable, "Package search is not configured")
+		return
+	}
+
+	checked, updates, err := d.CheckApplicationUpdates(r.Context())
+	if err != nil {
+		// Applications checked before the error are still recorded
+		log.Warn().Err(err).Msg("Failed to check some applications for updates")
+	}
+
+	d.audit(r, auditRecord{
+		Action:     "application.check_updates",
+		TargetType: "application",
+		Details:    map[string]interface{}{"checked": checked, "updates_available": updates},
+	})
+
+	response := map[string]interface{}{
+		"checked":           checked,
+		"updates_available": updates,
+	}
+	if err != nil {
+		response["error"] = err.Error()
+	}
+	WriteJSON(w, http.StatusOK, response)
+}
+
+// CheckApplicationUpdates records the latest upstream version of every
+// imported application, returning how many were checked and how many have
+// a newer version than theirs. Packages no longer in the catalog are
+// skipped.
+func (d *Dependencies) CheckApplicationUpdates(ctx context.Context) (checked, updates int, err error) {
+	applications, err := d.ApplicationService.ListApplications()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var errs []error
+	for _, app := range applications {
+		if app.Source == nil {
+			continue
+		}
+		pkg, err := d.PackageSearchService.GetPackage(ctx, app.Source.PackageID)
+		if errors.Is(err, ErrPackageNotFound) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", app.Source.PackageID, err))
+			continue
+		}
+		updated, err := d.ApplicationService.SetLatestVersion(app.ID, pkg.Version, time.Now().UTC())
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", app.ID, err))
+			continue
+		}
+		checked++
+		if updated.UpdateAvailable {
+			updates++
+		}
+	}
+	return checked, updates, errors.Join(errs...)
+}
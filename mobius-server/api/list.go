@@ -0,0 +1,815 @@
+package api
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// List queries
+//
+// Collection endpoints share one query contract:
+//
+//	GET /api/v1/devices?platform[in]=macos,linux&last_seen[gte]=2026-10-01T00:00:00Z&sort=-last_seen&limit=50
+//
+// sort orders by comma-separated fields, descending with a leading "-", and
+// the ID breaks ties. Filters are "field=value" for equality or
+// "field[op]=value" with one of the listOperators. Responses hold a page of
+// items, the total matching the filters and, when more items follow, a
+// next_cursor continuing after the last item of the page. A cursor records
+// the sort values of that item rather than an offset, so items created or
+// deleted between requests do not shift the pages. The offset parameter of
+// earlier releases is still accepted, but deprecated.
+//
+// Services answer list queries in their datastore by implementing the
+// Querier interface of a collection, such as DeviceQuerier. Collections of
+// services that do not, or queries a datastore cannot answer, are filtered,
+// sorted and paged in memory.
+
+// DefaultListLimit and MaxListLimit bound the items of a list page
+const (
+	DefaultListLimit = 100
+	MaxListLimit     = 500
+)
+
+// errInvalidListCursor is returned for cursors that were not issued for the
+// sort order of the query
+var errInvalidListCursor = errors.New("invalid cursor")
+
+// ErrUnsupportedListQuery is returned by queriers for queries on fields their
+// datastore cannot filter or sort on; the collection is then paged in memory
+var ErrUnsupportedListQuery = errors.New("list query not supported by the datastore")
+
+// Queriers answer list queries in the datastore of a service. They return
+// the page of items in order, with one item more than the limit of the query
+// when more items follow, and the number of items matching its filters. They
+// return ErrUnsupportedListQuery for queries their datastore cannot answer.
+
+// DeviceQuerier answers list queries over devices; search matches hostnames
+// and UUIDs
+type DeviceQuerier interface {
+	QueryDevices(search string, q *ListQuery) ([]*Device, int, error)
+}
+
+// DeviceGroupQuerier answers list queries over device groups and their
+// members
+type DeviceGroupQuerier interface {
+	QueryDeviceGroups(q *ListQuery) ([]*DeviceGroup, int, error)
+	QueryGroupDevices(groupID string, q *ListQuery) ([]*Device, int, error)
+}
+
+// PolicyQuerier answers list queries over policies and the devices and
+// device groups they are assigned to
+type PolicyQuerier interface {
+	QueryPolicies(q *ListQuery) ([]*Policy, int, error)
+	QueryPolicyDevices(policyID string, q *ListQuery) ([]*Device, int, error)
+	QueryPolicyGroups(policyID string, q *ListQuery) ([]*DeviceGroup, int, error)
+}
+
+// ApplicationQuerier answers list queries over applications
+type ApplicationQuerier interface {
+	QueryApplications(q *ListQuery) ([]*Application, int, error)
+}
+
+// UserQuerier answers list queries over users
+type UserQuerier interface {
+	QueryUsers(q *ListQuery) ([]*User, int, error)
+}
+
+// EnrollmentSecretQuerier answers list queries over enrollment secrets
+type EnrollmentSecretQuerier interface {
+	QueryEnrollmentSecrets(q *ListQuery) ([]*EnrollmentSecret, int, error)
+}
+
+// CommandQuerier answers list queries over device commands
+type CommandQuerier interface {
+	QueryCommands(q *ListQuery) ([]*DeviceCommand, int, error)
+}
+
+// BulkOperationQuerier answers list queries over bulk operations
+type BulkOperationQuerier interface {
+	QueryBulkOperations(q *ListQuery) ([]*BulkOperation, int, error)
+}
+
+// ApplicationRequestQuerier answers list queries over application requests
+type ApplicationRequestQuerier interface {
+	QueryApplicationRequests(q *ListQuery) ([]*ApplicationRequest, int, error)
+}
+
+// listParams are the query parameters of the list contract itself
+var listParams = map[string]bool{"sort": true, "cursor": true, "limit": true, "offset": true}
+
+type listKind int
+
+const (
+	listString listKind = iota
+	listNumber
+	listTime
+	listBool
+)
+
+func (k listKind) String() string {
+	switch k {
+	case listNumber:
+		return "number"
+	case listTime:
+		return "RFC 3339 time"
+	case listBool:
+		return "boolean"
+	default:
+		return "string"
+	}
+}
+
+// listOperators are the filter operators each kind of field supports
+var listOperators = map[listKind]map[string]bool{
+	listString: {"eq": true, "ne": true, "in": true, "nin": true, "contains": true, "prefix": true,
+		"lt": true, "lte": true, "gt": true, "gte": true},
+	listNumber: {"eq": true, "ne": true, "in": true, "nin": true, "lt": true, "lte": true, "gt": true, "gte": true},
+	listTime:   {"eq": true, "ne": true, "in": true, "nin": true, "lt": true, "lte": true, "gt": true, "gte": true},
+	listBool:   {"eq": true, "ne": true},
+}
+
+// listField is a field of a collection that lists filter and sort on. value
+// returns a string, int64, time.Time or bool according to kind, or nil when
+// the item has no value, which sorts first and only matches ne and nin.
+type listField[T any] struct {
+	kind  listKind
+	value func(T) interface{}
+	// enum, when set, lists the values filters may use
+	enum []string
+}
+
+// listSpec describes the fields of a collection
+type listSpec[T any] struct {
+	fields map[string]listField[T]
+	// labels, when set, exposes the labels of an item as string fields
+	// named "labels.<key>"
+	labels      func(T) map[string]string
+	defaultSort string
+	id          func(T) string
+}
+
+func (s *listSpec[T]) field(name string) (listField[T], bool) {
+	if f, ok := s.fields[name]; ok {
+		return f, true
+	}
+	if key, ok := strings.CutPrefix(name, "labels."); ok && key != "" && s.labels != nil {
+		return listField[T]{kind: listString, value: func(item T) interface{} {
+			if value, ok := s.labels(item)[key]; ok {
+				return value
+			}
+			return nil
+		}}, true
+	}
+	return listField[T]{}, false
+}
+
+// ListSortKey is a field a list is sorted by
+type ListSortKey struct {
+	Field string
+	Desc  bool
+}
+
+// ListFilter is a filter of a list query. Operands are a string, int64,
+// time.Time or bool according to the kind of the field; there are several
+// for the in and nin operators.
+type ListFilter struct {
+	Field    string
+	Op       string
+	Operands []interface{}
+}
+
+// ListPosition is the sort values and ID of an item, nil for an item without
+// a value
+type ListPosition struct {
+	Values []interface{}
+	ID     string
+}
+
+// ListQuery is a parsed list request
+type ListQuery struct {
+	// Sort orders the items; the ID breaks ties in the direction of the
+	// last key
+	Sort []ListSortKey
+	// Filters are all matched by the items listed
+	Filters []ListFilter
+	// After, when set, is the position of the last item of the previous
+	// page, which the page starts after
+	After *ListPosition
+	// Limit is the number of items of a page
+	Limit int
+	// Offset skips this many items before the page. It is the deprecated
+	// alternative to After, for clients of the offset pagination of
+	// earlier releases, and is never set with After.
+	Offset int
+	// DeviceGroupIDs, when not nil, limits the devices listed, and the
+	// items of devices such as commands, to the members of these device
+	// groups, and device groups to these, for users scoped to them
+	DeviceGroupIDs []string
+}
+
+// sortString is the canonical form of the sort order, recorded in cursors
+func (q *ListQuery) sortString() string {
+	keys := make([]string, len(q.Sort))
+	for i, key := range q.Sort {
+		keys[i] = key.Field
+		if key.Desc {
+			keys[i] = "-" + key.Field
+		}
+	}
+	return strings.Join(keys, ",")
+}
+
+// filterValue returns the operand of an equality filter on a field, for
+// handlers that pass it on to their service
+func (q *ListQuery) filterValue(field string) string {
+	for _, f := range q.Filters {
+		if f.Field == field && f.Op == "eq" {
+			if s, ok := f.Operands[0].(string); ok {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+// parseListQuery parses the list parameters and filters of a request.
+// params names the other query parameters the handler reads itself.
+func parseListQuery[T any](values url.Values, spec *listSpec[T], params ...string) (*ListQuery, error) {
+	q := &ListQuery{Limit: DefaultListLimit}
+
+	if limitStr := values.Get("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 || limit > MaxListLimit {
+			return nil, fmt.Errorf("limit must be between 1 and %d", MaxListLimit)
+		}
+		q.Limit = limit
+	}
+
+	sortStr := values.Get("sort")
+	if sortStr == "" {
+		sortStr = spec.defaultSort
+	}
+	for _, name := range strings.Split(sortStr, ",") {
+		key := ListSortKey{Field: strings.TrimSpace(name)}
+		if rest, ok := strings.CutPrefix(key.Field, "-"); ok {
+			key.Field, key.Desc = rest, true
+		}
+		if _, ok := spec.field(key.Field); !ok {
+			return nil, fmt.Errorf("cannot sort by %q", key.Field)
+		}
+		q.Sort = append(q.Sort, key)
+	}
+
+	if cursor := values.Get("cursor"); cursor != "" {
+		after, err := decodeListCursor(cursor, q, spec)
+		if err != nil {
+			return nil, err
+		}
+		q.After = &after
+	}
+
+	if offsetStr := values.Get("offset"); offsetStr != "" {
+		offset, err := strconv.Atoi(offsetStr)
+		if err != nil || offset < 0 {
+			return nil, errors.New("offset must be a non-negative integer")
+		}
+		if q.After != nil && offset > 0 {
+			return nil, errors.New("offset cannot be combined with cursor")
+		}
+		q.Offset = offset
+	}
+
+	other := make(map[string]bool, len(params))
+	for _, param := range params {
+		other[param] = true
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if listParams[name] || other[name] {
+			continue
+		}
+
+		fieldName, op := name, "eq"
+		if i := strings.IndexByte(name, '['); i > 0 && strings.HasSuffix(name, "]") {
+			fieldName, op = name[:i], name[i+1:len(name)-1]
+		}
+		field, ok := spec.field(fieldName)
+		if !ok {
+			return nil, fmt.Errorf("unknown filter field %q", fieldName)
+		}
+		if !listOperators[field.kind][op] {
+			return nil, fmt.Errorf("operator %q is not supported on %s", op, fieldName)
+		}
+
+		for _, raw := range values[name] {
+			operands := []string{raw}
+			if op == "in" || op == "nin" {
+				operands = strings.Split(raw, ",")
+			}
+			filter := ListFilter{Field: fieldName, Op: op}
+			for _, operand := range operands {
+				value, err := parseListOperand(field, op, operand)
+				if err != nil {
+					return nil, fmt.Errorf("invalid %s filter: %v", fieldName, err)
+				}
+				filter.Operands = append(filter.Operands, value)
+			}
+			q.Filters = append(q.Filters, filter)
+		}
+	}
+	return q, nil
+}
+
+func parseListOperand[T any](field listField[T], op, s string) (interface{}, error) {
+	if len(field.enum) > 0 && op != "contains" && op != "prefix" {
+		valid := false
+		for _, value := range field.enum {
+			valid = valid || value == s
+		}
+		if !valid {
+			return nil, fmt.Errorf("must be one of: %s", strings.Join(field.enum, ", "))
+		}
+	}
+	return parseListValue(field.kind, s)
+}
+
+func parseListValue(kind listKind, s string) (interface{}, error) {
+	switch kind {
+	case listNumber:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("expected a %s", kind)
+		}
+		return n, nil
+	case listTime:
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return nil, fmt.Errorf("expected an %s", kind)
+		}
+		return t, nil
+	case listBool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, fmt.Errorf("expected a %s", kind)
+		}
+		return b, nil
+	default:
+		return s, nil
+	}
+}
+
+func formatListValue(v interface{}) *string {
+	var s string
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case string:
+		s = v
+	case int64:
+		s = strconv.FormatInt(v, 10)
+	case time.Time:
+		s = v.Format(time.RFC3339Nano)
+	case bool:
+		s = strconv.FormatBool(v)
+	}
+	return &s
+}
+
+// compareListValues orders two values of the same kind, nil first
+func compareListValues(a, b interface{}) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+	switch a := a.(type) {
+	case string:
+		return strings.Compare(a, b.(string))
+	case int64:
+		return cmp.Compare(a, b.(int64))
+	case time.Time:
+		return a.Compare(b.(time.Time))
+	case bool:
+		if a == b.(bool) {
+			return 0
+		}
+		if a {
+			return 1
+		}
+		return -1
+	}
+	return 0
+}
+
+// matches reports whether a value satisfies the filter
+func (f ListFilter) matches(v interface{}) bool {
+	switch f.Op {
+	case "ne":
+		return v == nil || compareListValues(v, f.Operands[0]) != 0
+	case "nin":
+		for _, operand := range f.Operands {
+			if v != nil && compareListValues(v, operand) == 0 {
+				return false
+			}
+		}
+		return true
+	}
+
+	if v == nil {
+		return false
+	}
+	switch f.Op {
+	case "in":
+		for _, operand := range f.Operands {
+			if compareListValues(v, operand) == 0 {
+				return true
+			}
+		}
+		return false
+	case "contains":
+		return strings.Contains(strings.ToLower(v.(string)), strings.ToLower(f.Operands[0].(string)))
+	case "prefix":
+		return strings.HasPrefix(strings.ToLower(v.(string)), strings.ToLower(f.Operands[0].(string)))
+	}
+
+	c := compareListValues(v, f.Operands[0])
+	switch f.Op {
+	case "lt":
+		return c < 0
+	case "lte":
+		return c <= 0
+	case "gt":
+		return c > 0
+	case "gte":
+		return c >= 0
+	default:
+		return c == 0
+	}
+}
+
+// listCursor is the position of the last item of a page
+type listCursor struct {
+	Sort   string    `json:"s"`
+	Values []*string `json:"v"`
+	ID     string    `json:"id"`
+}
+
+// listResult is a page of a collection
+type listResult[T any] struct {
+	Items      []T
+	Total      int
+	NextCursor string
+}
+
+// position returns the sort values and ID of an item
+func (s *listSpec[T]) position(q *ListQuery, item T) ListPosition {
+	p := ListPosition{Values: make([]interface{}, len(q.Sort)), ID: s.id(item)}
+	for i, key := range q.Sort {
+		field, _ := s.field(key.Field)
+		p.Values[i] = field.value(item)
+	}
+	return p
+}
+
+// compareListPositions orders two positions in the sort order of q. The ID
+// breaks ties in the direction of the last sort key.
+func compareListPositions(q *ListQuery, a, b ListPosition) int {
+	for i, key := range q.Sort {
+		if c := compareListValues(a.Values[i], b.Values[i]); c != 0 {
+			if key.Desc {
+				return -c
+			}
+			return c
+		}
+	}
+	c := strings.Compare(a.ID, b.ID)
+	if q.Sort[len(q.Sort)-1].Desc {
+		return -c
+	}
+	return c
+}
+
+// listPage filters and sorts items and returns the page the query asks for
+func listPage[T any](items []T, spec *listSpec[T], q *ListQuery) *listResult[T] {
+	type positioned struct {
+		item     T
+		position ListPosition
+	}
+	matched := make([]positioned, 0, len(items))
+	for _, item := range items {
+		if matchesListFilters(item, spec, q.Filters) {
+			matched = append(matched, positioned{item: item, position: spec.position(q, item)})
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		return compareListPositions(q, matched[i].position, matched[j].position) < 0
+	})
+
+	start := 0
+	if q.After != nil {
+		start = sort.Search(len(matched), func(i int) bool {
+			return compareListPositions(q, matched[i].position, *q.After) > 0
+		})
+	}
+	start = min(start+q.Offset, len(matched))
+	end := min(start+q.Limit+1, len(matched))
+
+	page := make([]T, 0, end-start)
+	for _, m := range matched[start:end] {
+		page = append(page, m.item)
+	}
+	return newListResult(page, len(matched), spec, q)
+}
+
+// newListResult returns the page of items, which holds one item more than
+// the limit of the query when more items follow
+func newListResult[T any](items []T, total int, spec *listSpec[T], q *ListQuery) *listResult[T] {
+	result := &listResult[T]{Items: items, Total: total}
+	if len(items) > q.Limit {
+		result.Items = items[:q.Limit]
+		result.NextCursor = encodeListCursor(q, spec.position(q, items[q.Limit-1]))
+	}
+	return result
+}
+
+// listItems answers a list query with query, which pages the collection in
+// its datastore. When query is nil or the datastore cannot answer the
+// query, the items load returns are paged in memory instead.
+func listItems[T any](q *ListQuery, spec *listSpec[T], query func(*ListQuery) ([]T, int, error), load func() ([]T, error)) (*listResult[T], error) {
+	if query != nil {
+		items, total, err := query(q)
+		if err == nil {
+			return newListResult(items, total, spec, q), nil
+		}
+		if !errors.Is(err, ErrUnsupportedListQuery) {
+			return nil, err
+		}
+	}
+
+	items, err := load()
+	if err != nil {
+		return nil, err
+	}
+	return listPage(items, spec, q), nil
+}
+
+func matchesListFilters[T any](item T, spec *listSpec[T], filters []ListFilter) bool {
+	for _, filter := range filters {
+		field, _ := spec.field(filter.Field)
+		if !filter.matches(field.value(item)) {
+			return false
+		}
+	}
+	return true
+}
+
+func encodeListCursor(q *ListQuery, p ListPosition) string {
+	cursor := listCursor{Sort: q.sortString(), Values: make([]*string, len(p.Values)), ID: p.ID}
+	for i, value := range p.Values {
+		cursor.Values[i] = formatListValue(value)
+	}
+	b, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeListCursor[T any](s string, q *ListQuery, spec *listSpec[T]) (ListPosition, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return ListPosition{}, errInvalidListCursor
+	}
+	var cursor listCursor
+	if err := json.Unmarshal(b, &cursor); err != nil {
+		return ListPosition{}, errInvalidListCursor
+	}
+	if cursor.Sort != q.sortString() || len(cursor.Values) != len(q.Sort) || cursor.ID == "" {
+		return ListPosition{}, errInvalidListCursor
+	}
+
+	p := ListPosition{Values: make([]interface{}, len(q.Sort)), ID: cursor.ID}
+	for i, raw := range cursor.Values {
+		if raw == nil {
+			continue
+		}
+		field, _ := spec.field(q.Sort[i].Field)
+		value, err := parseListValue(field.kind, *raw)
+		if err != nil {
+			return ListPosition{}, errInvalidListCursor
+		}
+		p.Values[i] = value
+	}
+	return p, nil
+}
+
+// writeList responds with a page of a collection, under key
+func writeList[T any](w http.ResponseWriter, key string, result *listResult[T]) {
+	resp := map[string]interface{}{
+		key:     result.Items,
+		"total": result.Total,
+		"count": len(result.Items),
+	}
+	if result.NextCursor != "" {
+		resp["next_cursor"] = result.NextCursor
+	}
+	WriteJSON(w, http.StatusOK, resp)
+}
+
+// readListQuery parses the list query of a request, responding 400 when it is
+// invalid
+func readListQuery[T any](w http.ResponseWriter, r *http.Request, spec *listSpec[T], params ...string) (*ListQuery, bool) {
+	q, err := parseListQuery(r.URL.Query(), spec, params...)
+	if r.URL.Query().Has("offset") {
+		w.Header().Set("Deprecation", "true")
+	}
+	if errors.Is(err, errInvalidListCursor) {
+		WriteError(w, http.StatusBadRequest, "Invalid cursor")
+		return nil, false
+	}
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+	return q, true
+}
+
+// Collections
+
+func timeValue(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
+
+func timePtrValue(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return timeValue(*t)
+}
+
+var deviceListSpec = &listSpec[*Device]{
+	fields: map[string]listField[*Device]{
+		"id":       {kind: listString, value: func(d *Device) interface{} { return d.ID }},
+		"uuid":     {kind: listString, value: func(d *Device) interface{} { return d.UUID }},
+		"hostname": {kind: listString, value: func(d *Device) interface{} { return d.Hostname }},
+		"platform": {kind: listString, value: func(d *Device) interface{} { return d.Platform },
+			enum: []string{"windows", "macos", "linux", "ios", "android"}},
+		"os_version": {kind: listString, value: func(d *Device) interface{} { return d.OSVersion }},
+		"status": {kind: listString, value: func(d *Device) interface{} { return d.Status },
+			enum: []string{"online", "offline", "enrolled", "pending", "unenrolled"}},
+		"last_seen":   {kind: listTime, value: func(d *Device) interface{} { return timeValue(d.LastSeen) }},
+		"enrolled_at": {kind: listTime, value: func(d *Device) interface{} { return timeValue(d.EnrolledAt) }},
+	},
+	labels:      func(d *Device) map[string]string { return d.Labels },
+	defaultSort: "enrolled_at",
+	id:          func(d *Device) string { return d.ID },
+}
+
+var deviceGroupListSpec = &listSpec[*DeviceGroup]{
+	fields: map[string]listField[*DeviceGroup]{
+		"id":           {kind: listString, value: func(g *DeviceGroup) interface{} { return g.ID }},
+		"name":         {kind: listString, value: func(g *DeviceGroup) interface{} { return g.Name }},
+		"description":  {kind: listString, value: func(g *DeviceGroup) interface{} { return g.Description }},
+		"device_count": {kind: listNumber, value: func(g *DeviceGroup) interface{} { return int64(g.DeviceCount) }},
+		"created_at":   {kind: listTime, value: func(g *DeviceGroup) interface{} { return timeValue(g.CreatedAt) }},
+		"updated_at":   {kind: listTime, value: func(g *DeviceGroup) interface{} { return timeValue(g.UpdatedAt) }},
+	},
+	labels:      func(g *DeviceGroup) map[string]string { return g.Labels },
+	defaultSort: "created_at",
+	id:          func(g *DeviceGroup) string { return g.ID },
+}
+
+var policyListSpec = &listSpec[*Policy]{
+	fields: map[string]listField[*Policy]{
+		"id":          {kind: listString, value: func(p *Policy) interface{} { return p.ID }},
+		"name":        {kind: listString, value: func(p *Policy) interface{} { return p.Name }},
+		"description": {kind: listString, value: func(p *Policy) interface{} { return p.Description }},
+		"platform":    {kind: listString, value: func(p *Policy) interface{} { return p.Platform }},
+		"enabled":     {kind: listBool, value: func(p *Policy) interface{} { return p.Enabled }},
+		"created_at":  {kind: listTime, value: func(p *Policy) interface{} { return timeValue(p.CreatedAt) }},
+		"updated_at":  {kind: listTime, value: func(p *Policy) interface{} { return timeValue(p.UpdatedAt) }},
+	},
+	defaultSort: "created_at",
+	id:          func(p *Policy) string { return p.ID },
+}
+
+var applicationListSpec = &listSpec[*Application]{
+	fields: map[string]listField[*Application]{
+		"id":           {kind: listString, value: func(a *Application) interface{} { return a.ID }},
+		"name":         {kind: listString, value: func(a *Application) interface{} { return a.Name }},
+		"version":      {kind: listString, value: func(a *Application) interface{} { return a.Version }},
+		"platform":     {kind: listString, value: func(a *Application) interface{} { return a.Platform }},
+		"bundle_id":    {kind: listString, value: func(a *Application) interface{} { return a.BundleID }},
+		"package_type": {kind: listString, value: func(a *Application) interface{} { return a.PackageType }},
+		"filename":     {kind: listString, value: func(a *Application) interface{} { return a.Filename }},
+		"size":         {kind: listNumber, value: func(a *Application) interface{} { return a.Size }},
+		"created_at":   {kind: listTime, value: func(a *Application) interface{} { return timeValue(a.CreatedAt) }},
+		"latest_version": {kind: listString, value: func(a *Application) interface{} {
+			if a.LatestVersion == "" {
+				return nil
+			}
+			return a.LatestVersion
+		}},
+		"update_available": {kind: listBool, value: func(a *Application) interface{} { return a.UpdateAvailable }},
+	},
+	defaultSort: "created_at",
+	id:          func(a *Application) string { return a.ID },
+}
+
+var userListSpec = &listSpec[*User]{
+	fields: map[string]listField[*User]{
+		"id":         {kind: listString, value: func(u *User) interface{} { return u.ID }},
+		"email":      {kind: listString, value: func(u *User) interface{} { return u.Email }},
+		"name":       {kind: listString, value: func(u *User) interface{} { return u.Name }},
+		"role":       {kind: listString, value: func(u *User) interface{} { return u.Role }},
+		"created_at": {kind: listTime, value: func(u *User) interface{} { return timeValue(u.CreatedAt) }},
+		"updated_at": {kind: listTime, value: func(u *User) interface{} { return timeValue(u.UpdatedAt) }},
+	},
+	defaultSort: "email",
+	id:          func(u *User) string { return u.ID },
+}
+
+var enrollmentSecretListSpec = &listSpec[*EnrollmentSecret]{
+	fields: map[string]listField[*EnrollmentSecret]{
+		"id":         {kind: listString, value: func(s *EnrollmentSecret) interface{} { return s.ID }},
+		"name":       {kind: listString, value: func(s *EnrollmentSecret) interface{} { return s.Name }},
+		"group_id":   {kind: listString, value: func(s *EnrollmentSecret) interface{} { return s.GroupID }},
+		"created_by": {kind: listString, value: func(s *EnrollmentSecret) interface{} { return s.CreatedBy }},
+		"created_at": {kind: listTime, value: func(s *EnrollmentSecret) interface{} { return timeValue(s.CreatedAt) }},
+		"rotated_at": {kind: listTime, value: func(s *EnrollmentSecret) interface{} { return timePtrValue(s.RotatedAt) }},
+		"expires_at": {kind: listTime, value: func(s *EnrollmentSecret) interface{} { return timePtrValue(s.ExpiresAt) }},
+	},
+	defaultSort: "created_at",
+	id:          func(s *EnrollmentSecret) string { return s.ID },
+}
+
+var commandListSpec = &listSpec[*DeviceCommand]{
+	fields: map[string]listField[*DeviceCommand]{
+		"id":        {kind: listString, value: func(c *DeviceCommand) interface{} { return c.ID }},
+		"device_id": {kind: listString, value: func(c *DeviceCommand) interface{} { return c.DeviceID }},
+		"command":   {kind: listString, value: func(c *DeviceCommand) interface{} { return c.Command }},
+		"status": {kind: listString, value: func(c *DeviceCommand) interface{} { return c.Status },
+			enum: []string{CommandStatusPending, CommandStatusDelivered, CommandStatusAcknowledged,
+				CommandStatusCompleted, CommandStatusFailed, CommandStatusExpired}},
+		"created_by":   {kind: listString, value: func(c *DeviceCommand) interface{} { return c.CreatedBy }},
+		"created_at":   {kind: listTime, value: func(c *DeviceCommand) interface{} { return timeValue(c.CreatedAt) }},
+		"updated_at":   {kind: listTime, value: func(c *DeviceCommand) interface{} { return timeValue(c.UpdatedAt) }},
+		"expires_at":   {kind: listTime, value: func(c *DeviceCommand) interface{} { return timeValue(c.ExpiresAt) }},
+		"completed_at": {kind: listTime, value: func(c *DeviceCommand) interface{} { return timePtrValue(c.CompletedAt) }},
+	},
+	defaultSort: "-created_at",
+	id:          func(c *DeviceCommand) string { return c.ID },
+}
+
+var bulkOperationListSpec = &listSpec[*BulkOperation]{
+	fields: map[string]listField[*BulkOperation]{
+		"id": {kind: listString, value: func(o *BulkOperation) interface{} { return o.ID }},
+		"status": {kind: listString, value: func(o *BulkOperation) interface{} { return o.Status },
+			enum: []string{BulkStatusRunning, BulkStatusCompleted, BulkStatusPartiallyFailed,
+				BulkStatusFailed, BulkStatusCancelled, BulkStatusInterrupted}},
+		"action": {kind: listString, value: func(o *BulkOperation) interface{} { return o.Action.Type },
+			enum: []string{BulkActionCommand, BulkActionAssignPolicy, BulkActionUnassignPolicy,
+				BulkActionUpdateLabels, BulkActionMoveToGroup, BulkActionUnenroll}},
+		"created_by":  {kind: listString, value: func(o *BulkOperation) interface{} { return o.CreatedBy }},
+		"created_at":  {kind: listTime, value: func(o *BulkOperation) interface{} { return timeValue(o.CreatedAt) }},
+		"updated_at":  {kind: listTime, value: func(o *BulkOperation) interface{} { return timeValue(o.UpdatedAt) }},
+		"finished_at": {kind: listTime, value: func(o *BulkOperation) interface{} { return timePtrValue(o.FinishedAt) }},
+		"total":       {kind: listNumber, value: func(o *BulkOperation) interface{} { return int64(o.Total) }},
+		"failed":      {kind: listNumber, value: func(o *BulkOperation) interface{} { return int64(o.Failed) }},
+	},
+	defaultSort: "-created_at",
+	id:          func(o *BulkOperation) string { return o.ID },
+}
+
+var applicationRequestListSpec = &listSpec[*ApplicationRequest]{
+	fields: map[string]listField[*ApplicationRequest]{
+		"id": {kind: listString, value: func(a *ApplicationRequest) interface{} { return a.ID }},
+		"status": {kind: listString, value: func(a *ApplicationRequest) interface{} { return a.Status },
+			enum: []string{AppRequestStatusPending, AppRequestStatusApproved, AppRequestStatusDenied}},
+		"application_id": {kind: listString, value: func(a *ApplicationRequest) interface{} { return a.ApplicationID }},
+		"device_id":      {kind: listString, value: func(a *ApplicationRequest) interface{} { return a.DeviceID }},
+		"decided_by":     {kind: listString, value: func(a *ApplicationRequest) interface{} { return a.DecidedBy }},
+		"created_at":     {kind: listTime, value: func(a *ApplicationRequest) interface{} { return timeValue(a.CreatedAt) }},
+		"decided_at":     {kind: listTime, value: func(a *ApplicationRequest) interface{} { return timePtrValue(a.DecidedAt) }},
+	},
+	defaultSort: "-created_at",
+	id:          func(a *ApplicationRequest) string { return a.ID },
+}
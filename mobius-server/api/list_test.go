@@ -0,0 +1,73 @@
+package api_test
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/notawar/mobius/mobius-server/api"
+)
+
+func TestListOffset(t *testing.T) {
+	spec, err := api.LoadOpenAPISpec()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	server := newTestServer(t, func(deps *api.Dependencies) {
+		deps.OpenAPIValidator = api.NewOpenAPIValidator(spec)
+	})
+	_, token := server.createUser(t, api.RoleObserver)
+	for i := 1; i <= 5; i++ {
+		if _, err := server.deps.DeviceService.EnrollDevice(api.DeviceEnrollment{
+			UUID: fmt.Sprintf("uuid-%d", i), Hostname: fmt.Sprintf("host-%d", i), Platform: "linux",
+		}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	type page struct {
+		Devices    []api.Device `json:"devices"`
+		Total      int          `json:"total"`
+		NextCursor string       `json:"next_cursor"`
+	}
+	hostnames := func(p page) []string {
+		var hostnames []string
+		for _, device := range p.Devices {
+			hostnames = append(hostnames, device.Hostname)
+		}
+		return hostnames
+	}
+
+	// Clients of the offset pagination of earlier releases keep working
+	var offset page
+	resp := server.do(t, "GET", "/devices?sort=hostname&limit=2&offset=2", token, nil)
+	decode(t, resp, http.StatusOK, &offset)
+	if want := []string{"host-3", "host-4"}; offset.Total != 5 || !reflect.DeepEqual(hostnames(offset), want) {
+		t.Errorf("expected %v of 5, got %v of %d", want, hostnames(offset), offset.Total)
+	}
+	if resp.Header.Get("Deprecation") != "true" {
+		t.Error("expected offset to be reported as deprecated")
+	}
+
+	// and the cursor of an offset page continues after it
+	var next page
+	resp = server.do(t, "GET", "/devices?sort=hostname&limit=2&cursor="+offset.NextCursor, token, nil)
+	decode(t, resp, http.StatusOK, &next)
+	if want := []string{"host-5"}; !reflect.DeepEqual(hostnames(next), want) {
+		t.Errorf("expected %v, got %v", want, hostnames(next))
+	}
+	if resp.Header.Get("Deprecation") != "" {
+		t.Error("expected cursors not to be reported as deprecated")
+	}
+
+	var past page
+	decode(t, server.do(t, "GET", "/devices?offset=10", token, nil), http.StatusOK, &past)
+	if len(past.Devices) != 0 || past.Total != 5 || past.NextCursor != "" {
+		t.Errorf("expected an empty last page, got %d devices", len(past.Devices))
+	}
+
+	for _, query := range []string{"offset=-1", "offset=ten", "offset=1&cursor=" + offset.NextCursor} {
+		decode(t, server.do(t, "GET", "/devices?sort=hostname&"+query, token, nil), http.StatusBadRequest, nil)
+	}
+}
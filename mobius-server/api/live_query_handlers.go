@@ -0,0 +1,239 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog/log"
+)
+
+// Live query campaign handlers
+
+// handleCreateLiveQuery starts a live query campaign for a set of devices,
+// device groups and label selectors
+func (d *Dependencies) handleCreateLiveQuery(w http.ResponseWriter, r *http.Request) {
+	var req LiveQueryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	deviceIDs, err := d.resolveLiveQueryTargets(req.Targets)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	for _, deviceID := range deviceIDs {
+		if !d.requireDeviceInScope(w, r, PermDevicesQuery, deviceID) {
+			return
+		}
+	}
+
+	d.startLiveQuery(w, r, req.Query, req.Timeout, deviceIDs)
+}
+
+// handleGetLiveQuery returns a campaign with the results received so far
+func (d *Dependencies) handleGetLiveQuery(w http.ResponseWriter, r *http.Request) {
+	campaignID := mux.Vars(r)["campaignId"]
+
+	campaign, err := d.LiveQueryService.GetCampaign(campaignID)
+	if err != nil {
+		WriteError(w, http.StatusNotFound, "Live query not found")
+		return
+	}
+
+	// Results may cover devices outside the caller's groups, so scoped users
+	// only read their own campaigns
+	user, err := GetUserFromContext(r)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, "User context required")
+		return
+	}
+	if user.IsScoped() && campaign.CreatedBy != user.ID {
+		d.auditDenied(r, user, PermDevicesQuery, "live query of another user")
+		WriteError(w, http.StatusForbidden, "Live query was started by another user")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, campaign)
+}
+
+// startLiveQuery validates a query and distributes it to deviceIDs
+func (d *Dependencies) startLiveQuery(w http.ResponseWriter, r *http.Request, query string, timeoutSeconds int, deviceIDs []string) {
+	if query == "" {
+		WriteError(w, http.StatusBadRequest, "OSQuery SQL is required")
+		return
+	}
+
+	// Validate SQL query (basic security check)
+	if !isValidOSQuery(query) {
+		WriteError(w, http.StatusBadRequest, "Invalid or dangerous OSQuery")
+		return
+	}
+
+	if timeoutSeconds < 0 || time.Duration(timeoutSeconds)*time.Second > MaxLiveQueryTimeout {
+		WriteError(w, http.StatusBadRequest, fmt.Sprintf("timeout must be between 0 and %d seconds", int(MaxLiveQueryTimeout.Seconds())))
+		return
+	}
+
+	if len(deviceIDs) == 0 {
+		WriteError(w, http.StatusBadRequest, "No devices match the targets")
+		return
+	}
+
+	user, err := GetUserFromContext(r)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, "User context required")
+		return
+	}
+
+	campaign, err := d.LiveQueryService.StartCampaign(LiveQueryCreate{
+		Query:     query,
+		DeviceIDs: deviceIDs,
+		Timeout:   time.Duration(timeoutSeconds) * time.Second,
+		CreatedBy: user.ID,
+	})
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("query", query).
+			Str("user_id", user.ID).
+			Msg("Failed to start live query")
+		WriteError(w, http.StatusInternalServerError, "Failed to start live query")
+		return
+	}
+
+	log.Info().
+		Str("campaign_id", campaign.ID).
+		Int("devices", campaign.DevicesTotal).
+		Str("user_id", user.ID).
+		Msg("Live query started")
+
+	d.audit(r, auditRecord{
+		Action:     "live_query.create",
+		TargetType: "live_query",
+		TargetID:   campaign.ID,
+		Details: map[string]interface{}{
+			"query":   query,
+			"devices": campaign.DevicesTotal,
+		},
+	})
+
+	WriteJSON(w, http.StatusAccepted, campaign)
+}
+
+// resolveLiveQueryTargets expands device, group and label selectors into the
+// IDs of the targeted devices
+func (d *Dependencies) resolveLiveQueryTargets(targets LiveQueryTargets) ([]string, error) {
+	var deviceIDs []string
+
+	for _, deviceID := range targets.DeviceIDs {
+		if _, err := d.DeviceService.GetDevice(deviceID); err != nil {
+			return nil, fmt.Errorf("device %s not found", deviceID)
+		}
+		deviceIDs = append(deviceIDs, deviceID)
+	}
+
+	for _, groupID := range targets.GroupIDs {
+		devices, err := d.DeviceGroupService.GetGroupDevices(groupID)
+		if err != nil {
+			return nil, fmt.Errorf("device group %s not found", groupID)
+		}
+		for _, device := range devices {
+			deviceIDs = append(deviceIDs, device.ID)
+		}
+	}
+
+	if len(targets.Labels) > 0 {
+		devices, err := d.allDevices()
+		if err != nil {
+			return nil, err
+		}
+		for _, device := range devices {
+			if matchesLabels(device, targets.Labels) {
+				deviceIDs = append(deviceIDs, device.ID)
+			}
+		}
+	}
+
+	return deviceIDs, nil
+}
+
+// matchesLabels reports whether a device carries every label in selector
+func matchesLabels(device *Device, selector map[string]string) bool {
+	for key, value := range selector {
+		if device.Labels[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// Device API handlers (for client connections)
+
+// handleDeviceGetLiveQueries returns the live queries the calling device has
+// yet to answer. The same list is included in check-in responses.
+func (d *Dependencies) handleDeviceGetLiveQueries(w http.ResponseWriter, r *http.Request) {
+	device, err := GetDeviceFromContext(r)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, "Device context required")
+		return
+	}
+
+	queries, err := d.LiveQueryService.PendingQueries(device.ID)
+	if err != nil {
+		log.Error().Err(err).Str("device_id", device.ID).Msg("Failed to get live queries")
+		WriteError(w, http.StatusInternalServerError, "Failed to get live queries")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"device_id": device.ID,
+		"queries":   queries,
+	})
+}
+
+// handleDeviceLiveQueryResult records the result of a live query run by the calling device
+func (d *Dependencies) handleDeviceLiveQueryResult(w http.ResponseWriter, r *http.Request) {
+	device, err := GetDeviceFromContext(r)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, "Device context required")
+		return
+	}
+
+	var report LiveQueryReport
+	if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	campaignID := mux.Vars(r)["campaignId"]
+	if _, err := d.LiveQueryService.GetCampaign(campaignID); err != nil {
+		WriteError(w, http.StatusNotFound, "Live query not found")
+		return
+	}
+
+	result, err := d.LiveQueryService.SubmitResult(campaignID, device.ID, report)
+	if err != nil {
+		WriteError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	log.Debug().
+		Str("campaign_id", campaignID).
+		Str("device_id", device.ID).
+		Str("status", result.Status).
+		Int("rows", len(result.Rows)).
+		Msg("Live query result received")
+
+	WriteJSON(w, http.StatusOK, result)
+}
+
+type LiveQueryRequest struct {
+	Query   string           `json:"query"`
+	Targets LiveQueryTargets `json:"targets"`
+	Timeout int              `json:"timeout,omitempty"` // seconds, defaults to DefaultLiveQueryTimeout
+}
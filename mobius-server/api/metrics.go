@@ -0,0 +1,214 @@
+package api
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rs/zerolog/log"
+
+	"github.com/notawar/mobius/mobius-server/pkg/websocket"
+)
+
+// metrics is the Prometheus registry of a router. Each router has its own, so
+// that several routers can live in one process.
+type metrics struct {
+	registry *prometheus.Registry
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	inFlight prometheus.Gauge
+}
+
+func newMetrics(d *Dependencies) *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "mobius_http_requests_total",
+			Help: "HTTP requests by method, route template and status code",
+		}, []string{"method", "route", "status"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "mobius_http_request_duration_seconds",
+			Help:    "HTTP request latency by method and route template",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+		inFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "mobius_http_requests_in_flight",
+			Help: "HTTP requests being served",
+		}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests,
+		m.duration,
+		m.inFlight,
+		&stateCollector{deps: d},
+	)
+	return m
+}
+
+// middleware records every request under its route template, so that
+// requests for different devices share one series
+func (m *metrics) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := "unmatched"
+		if current := mux.CurrentRoute(r); current != nil {
+			if tmpl, err := current.GetPathTemplate(); err == nil {
+				route = tmpl
+			}
+		}
+
+		m.inFlight.Inc()
+		defer m.inFlight.Dec()
+
+		start := time.Now()
+		wrapped := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+		next.ServeHTTP(wrapped, r)
+
+		m.duration.WithLabelValues(r.Method, route).Observe(time.Since(start).Seconds())
+		m.requests.WithLabelValues(r.Method, route, strconv.Itoa(wrapped.statusCode)).Inc()
+	})
+}
+
+// handler serves the registry, requiring HTTP basic auth when both
+// credentials are set
+func (m *metrics) handler(username, password string) http.Handler {
+	h := promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+	if username == "" || password == "" {
+		return h
+	}
+	return basicAuth(username, password, h)
+}
+
+// basicAuth rejects requests without the given credentials. Hashing both
+// sides keeps the comparison constant-time regardless of their lengths.
+func basicAuth(username, password string, next http.Handler) http.Handler {
+	hash := func(s string) []byte {
+		h := sha256.Sum256([]byte(s))
+		return h[:]
+	}
+	expectedUsername := hash(username)
+	expectedPassword := hash(password)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if u, p, ok := r.BasicAuth(); ok {
+			usernameMatch := subtle.ConstantTimeCompare(hash(u), expectedUsername) == 1
+			passwordMatch := subtle.ConstantTimeCompare(hash(p), expectedPassword) == 1
+			if usernameMatch && passwordMatch {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		w.Header().Set("WWW-Authenticate", `Basic realm="metrics", charset="UTF-8"`)
+		WriteError(w, http.StatusUnauthorized, "Authentication required")
+	})
+}
+
+// stateCollector reads the state of the fleet from the services at every
+// scrape. A service that fails is logged and its metrics are left out.
+type stateCollector struct {
+	deps *Dependencies
+}
+
+var (
+	infoDesc = prometheus.NewDesc("mobius_info",
+		"Information about the Mobius server", []string{"version"}, nil)
+	devicesDesc = prometheus.NewDesc("mobius_devices",
+		"Enrolled devices by platform and status", []string{"platform", "status"}, nil)
+	commandsDesc = prometheus.NewDesc("mobius_device_commands",
+		"Device commands by status; pending and delivered commands are the queue", []string{"status"}, nil)
+	complianceDevicesDesc = prometheus.NewDesc("mobius_policy_compliance_devices",
+		"Devices with policy results by compliance", []string{"compliance"}, nil)
+	complianceRateDesc = prometheus.NewDesc("mobius_policy_compliance_ratio",
+		"Share of devices with policy results that pass every policy", nil, nil)
+	policyResultsDesc = prometheus.NewDesc("mobius_policy_results",
+		"Latest policy results of devices by policy and result", []string{"policy_id", "result"}, nil)
+	websocketClientsDesc = prometheus.NewDesc("mobius_websocket_clients",
+		"Connected WebSocket clients", nil, nil)
+	websocketPublishedDesc = prometheus.NewDesc("mobius_websocket_events_published_total",
+		"WebSocket events this replica published on the event bus", nil, nil)
+	websocketReceivedDesc = prometheus.NewDesc("mobius_websocket_events_received_total",
+		"WebSocket events this replica received from the event bus", nil, nil)
+	websocketDroppedDesc = prometheus.NewDesc("mobius_websocket_events_dropped_total",
+		"WebSocket events dropped by reason: outbox, publish, inbox or client", []string{"reason"}, nil)
+	websocketLagDesc = prometheus.NewDesc("mobius_websocket_bus_lag_seconds",
+		"Time from the creation of WebSocket events to their receipt from the event bus", nil, nil)
+)
+
+// Describe sends the descriptors of every metric the collector can produce
+func (c *stateCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- infoDesc
+	ch <- devicesDesc
+	ch <- commandsDesc
+	ch <- complianceDevicesDesc
+	ch <- complianceRateDesc
+	ch <- policyResultsDesc
+	ch <- websocketClientsDesc
+	ch <- websocketPublishedDesc
+	ch <- websocketReceivedDesc
+	ch <- websocketDroppedDesc
+	ch <- websocketLagDesc
+}
+
+// Collect reads the current state from the services
+func (c *stateCollector) Collect(ch chan<- prometheus.Metric) {
+	d := c.deps
+	ch <- prometheus.MustNewConstMetric(infoDesc, prometheus.GaugeValue, 1, GetVersion())
+
+	if d.DeviceService != nil {
+		counts, err := d.DeviceService.CountDevices()
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to count devices for metrics")
+		}
+		for _, count := range counts {
+			ch <- prometheus.MustNewConstMetric(devicesDesc, prometheus.GaugeValue, float64(count.Count), count.Platform, count.Status)
+		}
+	}
+
+	if d.CommandService != nil {
+		counts, err := d.CommandService.CountCommands()
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to count device commands for metrics")
+		}
+		for status, n := range counts {
+			ch <- prometheus.MustNewConstMetric(commandsDesc, prometheus.GaugeValue, float64(n), status)
+		}
+	}
+
+	if d.ComplianceService != nil {
+		summary, err := d.ComplianceService.GetComplianceSummary(ComplianceScope{})
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to summarize compliance for metrics")
+		} else {
+			ch <- prometheus.MustNewConstMetric(complianceDevicesDesc, prometheus.GaugeValue, float64(summary.Compliant), "compliant")
+			ch <- prometheus.MustNewConstMetric(complianceDevicesDesc, prometheus.GaugeValue, float64(summary.NonCompliant), "non_compliant")
+			ch <- prometheus.MustNewConstMetric(complianceDevicesDesc, prometheus.GaugeValue, float64(summary.Errored), "errored")
+			ch <- prometheus.MustNewConstMetric(complianceRateDesc, prometheus.GaugeValue, summary.ComplianceRate)
+			for _, policy := range summary.Policies {
+				ch <- prometheus.MustNewConstMetric(policyResultsDesc, prometheus.GaugeValue, float64(policy.Pass), policy.PolicyID, "pass")
+				ch <- prometheus.MustNewConstMetric(policyResultsDesc, prometheus.GaugeValue, float64(policy.Fail), policy.PolicyID, "fail")
+				ch <- prometheus.MustNewConstMetric(policyResultsDesc, prometheus.GaugeValue, float64(policy.Error), policy.PolicyID, "error")
+			}
+		}
+	}
+
+	if d.WSHub != nil {
+		ch <- prometheus.MustNewConstMetric(websocketClientsDesc, prometheus.GaugeValue, float64(d.WSHub.GetClientCount()))
+
+		stats := d.WSHub.Stats()
+		ch <- prometheus.MustNewConstMetric(websocketPublishedDesc, prometheus.CounterValue, float64(stats.Published))
+		ch <- prometheus.MustNewConstMetric(websocketReceivedDesc, prometheus.CounterValue, float64(stats.Received))
+		for _, reason := range []string{websocket.DropOutbox, websocket.DropPublish, websocket.DropInbox, websocket.DropClient} {
+			ch <- prometheus.MustNewConstMetric(websocketDroppedDesc, prometheus.CounterValue, float64(stats.Dropped[reason]), reason)
+		}
+		ch <- prometheus.MustNewConstHistogram(websocketLagDesc, stats.LagCount, stats.LagSum, stats.LagBuckets)
+	}
+}
@@ -0,0 +1,98 @@
+package api_test
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/notawar/mobius/mobius-server/api"
+)
+
+// scrape reads the metrics of a server with the given credentials, if any,
+// expecting status
+func scrape(t *testing.T, server *testServer, username, password string, status int) string {
+	t.Helper()
+
+	req, err := http.NewRequest("GET", server.URL+"/api/v1/metrics", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if username != "" || password != "" {
+		req.SetBasicAuth(username, password)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.StatusCode != status {
+		t.Fatalf("expected status %d, got %d: %s", status, resp.StatusCode, body)
+	}
+	if status == http.StatusUnauthorized && resp.Header.Get("WWW-Authenticate") == "" {
+		t.Error("expected a WWW-Authenticate challenge")
+	}
+	return string(body)
+}
+
+func TestMetrics(t *testing.T) {
+	server := newTestServer(t, func(deps *api.Dependencies) {
+		deps.MetricsUsername = "prometheus"
+		deps.MetricsPassword = "scrape-secret"
+	})
+	_, token := server.createUser(t, api.RoleObserver)
+	device, err := server.deps.DeviceService.EnrollDevice(api.DeviceEnrollment{UUID: "uuid-1", Hostname: "host-1", Platform: "linux"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	decode(t, server.do(t, "GET", "/devices/"+device.ID, token, nil), http.StatusOK, nil)
+	decode(t, server.do(t, "GET", "/devices/"+device.ID, token, nil), http.StatusOK, nil)
+	decode(t, server.do(t, "GET", "/devices/missing", token, nil), http.StatusNotFound, nil)
+	decode(t, server.do(t, "GET", "/devices/"+device.ID, "", nil), http.StatusUnauthorized, nil)
+
+	t.Run("credentials are required", func(t *testing.T) {
+		scrape(t, server, "", "", http.StatusUnauthorized)
+		scrape(t, server, "prometheus", "wrong", http.StatusUnauthorized)
+		scrape(t, server, "grafana", "scrape-secret", http.StatusUnauthorized)
+	})
+
+	body := scrape(t, server, "prometheus", "scrape-secret", http.StatusOK)
+
+	t.Run("requests are labelled with their route and status", func(t *testing.T) {
+		for _, want := range []string{
+			`mobius_http_requests_total{method="GET",route="/api/v1/devices/{deviceId}",status="200"} 2`,
+			`mobius_http_requests_total{method="GET",route="/api/v1/devices/{deviceId}",status="404"} 1`,
+			`mobius_http_requests_total{method="GET",route="/api/v1/devices/{deviceId}",status="401"} 1`,
+			`mobius_http_requests_total{method="GET",route="/api/v1/metrics",status="401"} 3`,
+			`mobius_http_request_duration_seconds_count{method="GET",route="/api/v1/devices/{deviceId}"} 4`,
+		} {
+			if !strings.Contains(body, want+"\n") {
+				t.Errorf("expected %s in:\n%s", want, body)
+			}
+		}
+		for _, path := range []string{device.ID, "/devices/missing"} {
+			if strings.Contains(body, path) {
+				t.Errorf("expected no series for the path of %s", path)
+			}
+		}
+	})
+
+	t.Run("fleet state", func(t *testing.T) {
+		if !strings.Contains(body, "mobius_devices{") || !strings.Contains(body, `platform="linux"`) {
+			t.Errorf("expected the enrolled device to be counted in:\n%s", body)
+		}
+	})
+
+	t.Run("open without credentials", func(t *testing.T) {
+		open := newTestServer(t)
+		if body := scrape(t, open, "", "", http.StatusOK); !strings.Contains(body, "mobius_http_requests_in_flight") {
+			t.Errorf("expected the request metrics, got:\n%s", body)
+		}
+	})
+}
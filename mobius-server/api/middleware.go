@@ -1,8 +1,11 @@
 package api
 
 import (
+	"bufio"
 	"context"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"runtime"
 	"strings"
@@ -34,12 +37,15 @@ func LoggingMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-// CORSMiddleware handles Cross-Origin Resource Sharing
+// CORSMiddleware handles Cross-Origin Resource Sharing. Browsers may send the
+// headers of conditional and retried requests and read those of the
+// responses to them and of rate limiting.
 func CORSMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, X-API-Key")
+		w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, X-API-Key, Idempotency-Key, If-Match")
+		w.Header().Set("Access-Control-Expose-Headers", "ETag, Idempotent-Replayed, Retry-After, X-RateLimit-Limit, X-RateLimit-Remaining, X-RateLimit-Reset")
 
 		if r.Method == "OPTIONS" {
 			return
@@ -83,12 +89,30 @@ func (d *Dependencies) authMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+		if user.MustChangePassword && !passwordChangeRequest(r, user) {
+			WriteError(w, http.StatusForbidden, "Password change required")
+			return
+		}
+
 		// Add user to request context
 		ctx := context.WithValue(r.Context(), "user", user)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// passwordChangeRequest reports whether a request is one of those users who
+// must change their password may still make: reading and updating their own
+// account, and logging out
+func passwordChangeRequest(r *http.Request, user *User) bool {
+	switch r.URL.Path {
+	case "/api/v1/users/" + user.ID:
+		return r.Method == http.MethodGet || r.Method == http.MethodPut
+	case "/api/v1/auth/logout":
+		return true
+	}
+	return false
+}
+
 // deviceAuthMiddleware validates device tokens
 func (d *Dependencies) deviceAuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -127,18 +151,27 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
-// RequireRole middleware checks user role
-func RequireRole(role string) func(http.Handler) http.Handler {
+// Unwrap lets http.ResponseController reach the connection, to change its
+// deadlines
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// Hijack lets WebSocket upgrades through the wrapper
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := rw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	return hijacker.Hijack()
+}
+
+// requireFeature rejects requests for a feature the current license does not include
+func (d *Dependencies) requireFeature(feature string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			user, ok := r.Context().Value("user").(*User)
-			if !ok {
-				WriteError(w, http.StatusUnauthorized, "User context required")
-				return
-			}
-
-			if !hasRole(user.Role, role) {
-				WriteError(w, http.StatusForbidden, "Insufficient permissions")
+			if !d.LicenseService.HasFeature(feature) {
+				WriteError(w, http.StatusForbidden, fmt.Sprintf("Current license does not include %s", feature))
 				return
 			}
 
@@ -147,27 +180,6 @@ func RequireRole(role string) func(http.Handler) http.Handler {
 	}
 }
 
-// hasRole checks if user has required role or higher
-func hasRole(userRole, requiredRole string) bool {
-	roles := map[string]int{
-		"viewer":   1,
-		"operator": 2,
-		"admin":    3,
-	}
-
-	userLevel, exists := roles[userRole]
-	if !exists {
-		return false
-	}
-
-	requiredLevel, exists := roles[requiredRole]
-	if !exists {
-		return false
-	}
-
-	return userLevel >= requiredLevel
-}
-
 // GetUserFromContext extracts user from request context
 func GetUserFromContext(r *http.Request) (*User, error) {
 	user, ok := r.Context().Value("user").(*User)
@@ -186,91 +198,6 @@ func GetDeviceFromContext(r *http.Request) (*Device, error) {
 	return device, nil
 }
 
-// RateLimitMiddleware implements basic rate limiting
-func RateLimitMiddleware(requestsPerMinute int) func(http.Handler) http.Handler {
-	clients := make(map[string]*rateLimiter)
-
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			clientIP := getClientIP(r)
-
-			limiter, exists := clients[clientIP]
-			if !exists {
-				limiter = newRateLimiter(requestsPerMinute)
-				clients[clientIP] = limiter
-			}
-
-			if !limiter.allow() {
-				WriteError(w, http.StatusTooManyRequests, "Rate limit exceeded")
-				return
-			}
-
-			next.ServeHTTP(w, r)
-		})
-	}
-}
-
-// getClientIP extracts client IP from request
-func getClientIP(r *http.Request) string {
-	// Check X-Forwarded-For header
-	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-		ips := strings.Split(xff, ",")
-		return strings.TrimSpace(ips[0])
-	}
-
-	// Check X-Real-IP header
-	if xri := r.Header.Get("X-Real-IP"); xri != "" {
-		return xri
-	}
-
-	// Use remote address
-	return r.RemoteAddr
-}
-
-// rateLimiter implements token bucket algorithm
-type rateLimiter struct {
-	tokens     int
-	capacity   int
-	refillRate int
-	lastRefill time.Time
-}
-
-func newRateLimiter(requestsPerMinute int) *rateLimiter {
-	return &rateLimiter{
-		tokens:     requestsPerMinute,
-		capacity:   requestsPerMinute,
-		refillRate: requestsPerMinute,
-		lastRefill: time.Now(),
-	}
-}
-
-func (rl *rateLimiter) allow() bool {
-	now := time.Now()
-	elapsed := now.Sub(rl.lastRefill)
-
-	// Refill tokens based on elapsed time
-	tokensToAdd := int(elapsed.Minutes()) * rl.refillRate
-	if tokensToAdd > 0 {
-		rl.tokens = min(rl.capacity, rl.tokens+tokensToAdd)
-		rl.lastRefill = now
-	}
-
-	// Check if request is allowed
-	if rl.tokens > 0 {
-		rl.tokens--
-		return true
-	}
-
-	return false
-}
-
-func min(a, b int) int {
-	if a < b {
-		return a
-	}
-	return b
-}
-
 // RecoveryMiddleware recovers from panics
 func RecoveryMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
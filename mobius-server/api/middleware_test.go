@@ -0,0 +1,34 @@
+package api_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/notawar/mobius/mobius-server/api"
+)
+
+func TestCORSMiddleware(t *testing.T) {
+	handler := api.CORSMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"1"`)
+	}))
+
+	preflight := httptest.NewRecorder()
+	handler.ServeHTTP(preflight, httptest.NewRequest("OPTIONS", "/api/v1/devices/device-1", nil))
+	allowed := preflight.Header().Get("Access-Control-Allow-Headers")
+	for _, header := range []string{"Authorization", "Idempotency-Key", "If-Match"} {
+		if !strings.Contains(allowed, header) {
+			t.Errorf("expected %s to be allowed, got %q", header, allowed)
+		}
+	}
+	if preflight.Header().Get("ETag") != "" {
+		t.Errorf("expected preflight requests not to reach the handler")
+	}
+
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, httptest.NewRequest("GET", "/api/v1/devices/device-1", nil))
+	if exposed := resp.Header().Get("Access-Control-Expose-Headers"); !strings.Contains(exposed, "ETag") {
+		t.Errorf("expected ETag to be exposed, got %q", exposed)
+	}
+}
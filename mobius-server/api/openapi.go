@@ -0,0 +1,817 @@
+package api
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// openAPIDocument is the OpenAPI document describing the /api/v1 routes
+//
+//go:embed openapi.yaml
+var openAPIDocument []byte
+
+// openAPIPrefix is the path of the /api/v1 routes relative to which the
+// document describes them
+const openAPIPrefix = "/api/v1"
+
+// MaxValidatedBodySize is the largest JSON request body checked against the
+// OpenAPI document; larger ones are refused
+const MaxValidatedBodySize = 10 << 20
+
+// OpenAPISpec is the part of an OpenAPI 3 document the server and the client
+// generator rely on
+type OpenAPISpec struct {
+	OpenAPI    string                      `json:"openapi"`
+	Info       OpenAPIInfo                 `json:"info"`
+	Paths      map[string]*OpenAPIPathItem `json:"paths"`
+	Components OpenAPIComponents           `json:"components"`
+}
+
+type OpenAPIInfo struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+type OpenAPIComponents struct {
+	Schemas       map[string]*OpenAPISchema      `json:"schemas,omitempty"`
+	Parameters    map[string]*OpenAPIParameter   `json:"parameters,omitempty"`
+	RequestBodies map[string]*OpenAPIRequestBody `json:"requestBodies,omitempty"`
+	Responses     map[string]*OpenAPIResponse    `json:"responses,omitempty"`
+}
+
+type OpenAPIPathItem struct {
+	Parameters []*OpenAPIParameter `json:"parameters,omitempty"`
+	Get        *OpenAPIOperation   `json:"get,omitempty"`
+	Put        *OpenAPIOperation   `json:"put,omitempty"`
+	Post       *OpenAPIOperation   `json:"post,omitempty"`
+	Delete     *OpenAPIOperation   `json:"delete,omitempty"`
+	Patch      *OpenAPIOperation   `json:"patch,omitempty"`
+}
+
+// Operations returns the operations of the path by HTTP method
+func (p *OpenAPIPathItem) Operations() map[string]*OpenAPIOperation {
+	operations := make(map[string]*OpenAPIOperation)
+	for method, op := range map[string]*OpenAPIOperation{
+		http.MethodGet:    p.Get,
+		http.MethodPut:    p.Put,
+		http.MethodPost:   p.Post,
+		http.MethodDelete: p.Delete,
+		http.MethodPatch:  p.Patch,
+	} {
+		if op != nil {
+			operations[method] = op
+		}
+	}
+	return operations
+}
+
+type OpenAPIOperation struct {
+	Tags        []string                    `json:"tags,omitempty"`
+	Summary     string                      `json:"summary,omitempty"`
+	Description string                      `json:"description,omitempty"`
+	OperationID string                      `json:"operationId,omitempty"`
+	Parameters  []*OpenAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *OpenAPIRequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*OpenAPIResponse `json:"responses,omitempty"`
+	Security    []map[string][]string       `json:"security,omitempty"`
+}
+
+type OpenAPIParameter struct {
+	Ref         string         `json:"$ref,omitempty"`
+	Name        string         `json:"name,omitempty"`
+	In          string         `json:"in,omitempty"` // "path", "query" or "header"
+	Description string         `json:"description,omitempty"`
+	Required    bool           `json:"required,omitempty"`
+	Deprecated  bool           `json:"deprecated,omitempty"`
+	Schema      *OpenAPISchema `json:"schema,omitempty"`
+}
+
+type OpenAPIRequestBody struct {
+	Ref      string                       `json:"$ref,omitempty"`
+	Required bool                         `json:"required,omitempty"`
+	Content  map[string]*OpenAPIMediaType `json:"content,omitempty"`
+}
+
+type OpenAPIResponse struct {
+	Ref         string                       `json:"$ref,omitempty"`
+	Description string                       `json:"description,omitempty"`
+	Content     map[string]*OpenAPIMediaType `json:"content,omitempty"`
+}
+
+type OpenAPIMediaType struct {
+	Schema *OpenAPISchema `json:"schema,omitempty"`
+}
+
+// OpenAPISchema is a JSON schema of the document. Schemas without a type
+// accept any value.
+type OpenAPISchema struct {
+	Ref                  string                       `json:"$ref,omitempty"`
+	Type                 OpenAPITypes                 `json:"type,omitempty"`
+	Format               string                       `json:"format,omitempty"`
+	Description          string                       `json:"description,omitempty"`
+	Nullable             bool                         `json:"nullable,omitempty"`
+	Enum                 []interface{}                `json:"enum,omitempty"`
+	Properties           map[string]*OpenAPISchema    `json:"properties,omitempty"`
+	Required             []string                     `json:"required,omitempty"`
+	AdditionalProperties *OpenAPIAdditionalProperties `json:"additionalProperties,omitempty"`
+	Items                *OpenAPISchema               `json:"items,omitempty"`
+	AllOf                []*OpenAPISchema             `json:"allOf,omitempty"`
+	AnyOf                []*OpenAPISchema             `json:"anyOf,omitempty"`
+	OneOf                []*OpenAPISchema             `json:"oneOf,omitempty"`
+	Minimum              *float64                     `json:"minimum,omitempty"`
+	Maximum              *float64                     `json:"maximum,omitempty"`
+	MinLength            *int                         `json:"minLength,omitempty"`
+	MaxLength            *int                         `json:"maxLength,omitempty"`
+	MinItems             *int                         `json:"minItems,omitempty"`
+	MaxItems             *int                         `json:"maxItems,omitempty"`
+	Pattern              string                       `json:"pattern,omitempty"`
+}
+
+// IsRequired reports whether the schema requires the property
+func (s *OpenAPISchema) IsRequired(property string) bool {
+	for _, name := range s.Required {
+		if name == property {
+			return true
+		}
+	}
+	return false
+}
+
+// OpenAPITypes are the types a schema allows, written as one type or, as of
+// OpenAPI 3.1, a list of them
+type OpenAPITypes []string
+
+func (t *OpenAPITypes) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = OpenAPITypes{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("schema type must be a string or a list of strings")
+	}
+	*t = list
+	return nil
+}
+
+// Has reports whether the type is allowed
+func (t OpenAPITypes) Has(name string) bool {
+	for _, typ := range t {
+		if typ == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Primary returns the allowed type other than null
+func (t OpenAPITypes) Primary() string {
+	for _, typ := range t {
+		if typ != "null" {
+			return typ
+		}
+	}
+	return ""
+}
+
+// OpenAPIAdditionalProperties is either a boolean allowing or forbidding
+// properties not listed by a schema, or the schema of their values
+type OpenAPIAdditionalProperties struct {
+	Allowed bool
+	Schema  *OpenAPISchema
+}
+
+func (a *OpenAPIAdditionalProperties) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &a.Allowed); err == nil {
+		return nil
+	}
+	a.Allowed = true
+	return json.Unmarshal(data, &a.Schema)
+}
+
+func (a OpenAPIAdditionalProperties) MarshalJSON() ([]byte, error) {
+	if a.Schema != nil {
+		return json.Marshal(a.Schema)
+	}
+	return json.Marshal(a.Allowed)
+}
+
+// LoadOpenAPISpec parses the OpenAPI document embedded in the server
+func LoadOpenAPISpec() (*OpenAPISpec, error) {
+	return ParseOpenAPISpec(openAPIDocument)
+}
+
+// ParseOpenAPISpec parses a YAML or JSON OpenAPI document
+func ParseOpenAPISpec(data []byte) (*OpenAPISpec, error) {
+	doc, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse OpenAPI document: %w", err)
+	}
+	var spec OpenAPISpec
+	if err := json.Unmarshal(doc, &spec); err != nil {
+		return nil, fmt.Errorf("decode OpenAPI document: %w", err)
+	}
+	if !strings.HasPrefix(spec.OpenAPI, "3.") {
+		return nil, fmt.Errorf("unsupported OpenAPI version %q", spec.OpenAPI)
+	}
+	return &spec, nil
+}
+
+// Schema resolves a schema reference, returning nil for unknown ones
+func (s *OpenAPISpec) Schema(schema *OpenAPISchema) *OpenAPISchema {
+	for schema != nil && schema.Ref != "" {
+		schema = s.Components.Schemas[strings.TrimPrefix(schema.Ref, "#/components/schemas/")]
+	}
+	return schema
+}
+
+// Parameter resolves a parameter reference, returning nil for unknown ones
+func (s *OpenAPISpec) Parameter(param *OpenAPIParameter) *OpenAPIParameter {
+	if param != nil && param.Ref != "" {
+		return s.Components.Parameters[strings.TrimPrefix(param.Ref, "#/components/parameters/")]
+	}
+	return param
+}
+
+// RequestBody resolves a request body reference, returning nil for unknown
+// ones
+func (s *OpenAPISpec) RequestBody(body *OpenAPIRequestBody) *OpenAPIRequestBody {
+	if body != nil && body.Ref != "" {
+		return s.Components.RequestBodies[strings.TrimPrefix(body.Ref, "#/components/requestBodies/")]
+	}
+	return body
+}
+
+// Response resolves a response reference, returning nil for unknown ones
+func (s *OpenAPISpec) Response(resp *OpenAPIResponse) *OpenAPIResponse {
+	if resp != nil && resp.Ref != "" {
+		return s.Components.Responses[strings.TrimPrefix(resp.Ref, "#/components/responses/")]
+	}
+	return resp
+}
+
+// OperationParameters returns the resolved parameters of an operation,
+// including those shared by every operation of its path
+func (s *OpenAPISpec) OperationParameters(path string, op *OpenAPIOperation) []*OpenAPIParameter {
+	var params []*OpenAPIParameter
+	if item := s.Paths[path]; item != nil {
+		for _, param := range item.Parameters {
+			if param = s.Parameter(param); param != nil {
+				params = append(params, param)
+			}
+		}
+	}
+	for _, param := range op.Parameters {
+		if param = s.Parameter(param); param != nil {
+			params = append(params, param)
+		}
+	}
+	return params
+}
+
+// JSONSchema returns the schema of the JSON content, or nil when there is
+// none
+func JSONSchema(content map[string]*OpenAPIMediaType) *OpenAPISchema {
+	if media := content["application/json"]; media != nil {
+		return media.Schema
+	}
+	return nil
+}
+
+// Validate checks a decoded JSON value against a schema. Every mismatch is
+// described with the location of the offending value, such as
+// "body.action.type: must be one of command, assign_policy".
+//
+// Properties set to null are treated as absent, as the handlers decode
+// them.
+func (s *OpenAPISpec) Validate(schema *OpenAPISchema, value interface{}, location string) []string {
+	var problems []string
+	s.validate(schema, value, location, &problems)
+	return problems
+}
+
+func (s *OpenAPISpec) validate(schema *OpenAPISchema, value interface{}, at string, problems *[]string) {
+	schema = s.Schema(schema)
+	if schema == nil {
+		return
+	}
+
+	for _, part := range schema.AllOf {
+		s.validate(part, value, at, problems)
+	}
+	if alternatives := append(append([]*OpenAPISchema(nil), schema.AnyOf...), schema.OneOf...); len(alternatives) > 0 {
+		matched := false
+		for _, alternative := range alternatives {
+			if len(s.Validate(alternative, value, at)) == 0 {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			*problems = append(*problems, at+": does not match any of the allowed schemas")
+		}
+	}
+
+	if value == nil {
+		if len(schema.Type) > 0 && !schema.Type.Has("null") && !schema.Nullable {
+			*problems = append(*problems, at+": must not be null")
+		}
+		return
+	}
+	if len(schema.Type) > 0 && !matchesType(schema.Type, value) {
+		*problems = append(*problems, fmt.Sprintf("%s: must be %s", at, describeTypes(schema.Type)))
+		return
+	}
+	if len(schema.Enum) > 0 && !enumContains(schema.Enum, value) {
+		allowed := make([]string, len(schema.Enum))
+		for i, v := range schema.Enum {
+			allowed[i] = fmt.Sprint(v)
+		}
+		*problems = append(*problems, fmt.Sprintf("%s: must be one of %s", at, strings.Join(allowed, ", ")))
+	}
+
+	switch value := value.(type) {
+	case string:
+		length := len([]rune(value))
+		if schema.MinLength != nil && length < *schema.MinLength {
+			*problems = append(*problems, fmt.Sprintf("%s: must be at least %d characters", at, *schema.MinLength))
+		}
+		if schema.MaxLength != nil && length > *schema.MaxLength {
+			*problems = append(*problems, fmt.Sprintf("%s: must be at most %d characters", at, *schema.MaxLength))
+		}
+		if schema.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339, value); err != nil {
+				*problems = append(*problems, at+": must be an RFC 3339 date-time")
+			}
+		}
+		if schema.Pattern != "" {
+			if re, err := regexp.Compile(schema.Pattern); err == nil && !re.MatchString(value) {
+				*problems = append(*problems, fmt.Sprintf("%s: must match %s", at, schema.Pattern))
+			}
+		}
+
+	case float64:
+		if schema.Minimum != nil && value < *schema.Minimum {
+			*problems = append(*problems, fmt.Sprintf("%s: must be at least %v", at, *schema.Minimum))
+		}
+		if schema.Maximum != nil && value > *schema.Maximum {
+			*problems = append(*problems, fmt.Sprintf("%s: must be at most %v", at, *schema.Maximum))
+		}
+
+	case []interface{}:
+		if schema.MinItems != nil && len(value) < *schema.MinItems {
+			*problems = append(*problems, fmt.Sprintf("%s: must have at least %d items", at, *schema.MinItems))
+		}
+		if schema.MaxItems != nil && len(value) > *schema.MaxItems {
+			*problems = append(*problems, fmt.Sprintf("%s: must have at most %d items", at, *schema.MaxItems))
+		}
+		if schema.Items != nil {
+			for i, item := range value {
+				s.validate(schema.Items, item, fmt.Sprintf("%s[%d]", at, i), problems)
+			}
+		}
+
+	case map[string]interface{}:
+		for _, name := range schema.Required {
+			if value[name] == nil {
+				*problems = append(*problems, at+"."+name+": is required")
+			}
+		}
+		names := make([]string, 0, len(value))
+		for name := range value {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if value[name] == nil {
+				continue
+			}
+			if property, ok := schema.Properties[name]; ok {
+				s.validate(property, value[name], at+"."+name, problems)
+				continue
+			}
+			if extra := schema.AdditionalProperties; extra != nil {
+				if extra.Schema != nil {
+					s.validate(extra.Schema, value[name], at+"."+name, problems)
+				} else if !extra.Allowed {
+					*problems = append(*problems, at+"."+name+": is not allowed")
+				}
+			}
+		}
+	}
+}
+
+func matchesType(types OpenAPITypes, value interface{}) bool {
+	for _, typ := range types {
+		switch v := value.(type) {
+		case string:
+			if typ == "string" {
+				return true
+			}
+		case bool:
+			if typ == "boolean" {
+				return true
+			}
+		case float64:
+			if typ == "number" || (typ == "integer" && v == math.Trunc(v)) {
+				return true
+			}
+		case []interface{}:
+			if typ == "array" {
+				return true
+			}
+		case map[string]interface{}:
+			if typ == "object" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func describeTypes(types OpenAPITypes) string {
+	var names []string
+	for _, typ := range types {
+		switch typ {
+		case "null":
+		case "object", "array", "integer":
+			names = append(names, "an "+typ)
+		default:
+			names = append(names, "a "+typ)
+		}
+	}
+	return strings.Join(names, " or ")
+}
+
+func enumContains(enum []interface{}, value interface{}) bool {
+	for _, allowed := range enum {
+		if fmt.Sprint(allowed) == fmt.Sprint(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// OpenAPIValidator checks requests to the /api/v1 routes against the
+// OpenAPI document before they reach the handlers
+type OpenAPIValidator struct {
+	spec *OpenAPISpec
+
+	// ValidateResponses logs the JSON responses that do not match the
+	// document. Responses are buffered to check them, so this is meant for
+	// development and tests.
+	ValidateResponses bool
+}
+
+// NewOpenAPIValidator creates a validator for the operations of spec
+func NewOpenAPIValidator(spec *OpenAPISpec) *OpenAPIValidator {
+	return &OpenAPIValidator{spec: spec}
+}
+
+// Middleware refuses requests whose query parameters or JSON body do not
+// match the operation of the document with 400 Bad Request, listing every
+// mismatch in the details of the error. Routes the document does not
+// describe are passed through; CheckRouter reports them.
+func (v *OpenAPIValidator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, op := v.operation(r)
+		if op == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		problems, err := v.validateRequest(r, path, op)
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				WriteError(w, http.StatusRequestEntityTooLarge, "Request body too large")
+				return
+			}
+			WriteError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+		if len(problems) > 0 {
+			WriteJSON(w, http.StatusBadRequest, APIError{
+				Error:   http.StatusText(http.StatusBadRequest),
+				Message: "Request does not match the API specification: " + problems[0],
+				Code:    http.StatusBadRequest,
+				Details: problems,
+			})
+			return
+		}
+
+		if !v.ValidateResponses || !hasJSONResponse(v.spec, op) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		recorder := &recordingResponseWriter{responseWriter: &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}}
+		next.ServeHTTP(recorder, r)
+		v.checkResponse(r, path, op, recorder)
+	})
+}
+
+// operation finds the operation of the route that matched the request
+func (v *OpenAPIValidator) operation(r *http.Request) (string, *OpenAPIOperation) {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return "", nil
+	}
+	template, err := route.GetPathTemplate()
+	if err != nil {
+		return "", nil
+	}
+	path := strings.TrimPrefix(template, openAPIPrefix)
+	item := v.spec.Paths[path]
+	if item == nil {
+		return "", nil
+	}
+	return path, item.Operations()[r.Method]
+}
+
+// validateRequest checks the query parameters and JSON body of a request,
+// leaving the body readable by the handler. It fails only when the body
+// cannot be read or parsed.
+func (v *OpenAPIValidator) validateRequest(r *http.Request, path string, op *OpenAPIOperation) ([]string, error) {
+	var problems []string
+
+	query := r.URL.Query()
+	for _, param := range v.spec.OperationParameters(path, op) {
+		if param.In != "query" {
+			continue
+		}
+		schema := v.spec.Schema(param.Schema)
+		if schema != nil && schema.Type.Primary() == "object" {
+			// Exploded objects, such as the list filters, take the
+			// remaining parameters
+			continue
+		}
+
+		var values []string
+		for _, value := range query[param.Name] {
+			if value != "" {
+				values = append(values, value)
+			}
+		}
+		if len(values) == 0 {
+			if param.Required {
+				problems = append(problems, "query."+param.Name+": is required")
+			}
+			continue
+		}
+		problems = append(problems, v.spec.Validate(schema, queryValue(schema, values), "query."+param.Name)...)
+	}
+
+	body := v.spec.RequestBody(op.RequestBody)
+	schema := (*OpenAPISchema)(nil)
+	if body != nil {
+		schema = JSONSchema(body.Content)
+	}
+	if schema == nil || !isJSONRequest(r) {
+		return problems, nil
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(nil, r.Body, MaxValidatedBodySize))
+	r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(data))
+
+	if len(bytes.TrimSpace(data)) == 0 {
+		if body.Required {
+			problems = append(problems, "body: is required")
+		}
+		return problems, nil
+	}
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	return append(problems, v.spec.Validate(schema, value, "body")...), nil
+}
+
+// queryValue converts query parameter values to the JSON type of their
+// schema; values that do not convert are left as strings so that the
+// schema reports them
+func queryValue(schema *OpenAPISchema, values []string) interface{} {
+	if schema == nil {
+		return values[0]
+	}
+	if schema.Type.Primary() == "array" {
+		items := make([]interface{}, len(values))
+		for i, value := range values {
+			items[i] = queryValue(schema.Items, []string{value})
+		}
+		return items
+	}
+
+	value := values[0]
+	switch schema.Type.Primary() {
+	case "integer", "number":
+		if n, err := strconv.ParseFloat(value, 64); err == nil {
+			return n
+		}
+	case "boolean":
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return value
+}
+
+// isJSONRequest reports whether the body of a request is JSON, which the
+// handlers assume when no content type is sent
+func isJSONRequest(r *http.Request) bool {
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+func hasJSONResponse(spec *OpenAPISpec, op *OpenAPIOperation) bool {
+	for _, resp := range op.Responses {
+		if resp = spec.Response(resp); resp != nil && JSONSchema(resp.Content) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// checkResponse logs a recorded response that does not match the document
+func (v *OpenAPIValidator) checkResponse(r *http.Request, path string, op *OpenAPIOperation, recorder *recordingResponseWriter) {
+	status := recorder.statusCode
+	resp := op.Responses[strconv.Itoa(status)]
+	if resp == nil {
+		resp = op.Responses["default"]
+	}
+	warn := func() *zerolog.Event {
+		return log.Warn().Str("method", r.Method).Str("path", openAPIPrefix+path).Int("status", status)
+	}
+
+	if resp == nil {
+		// Errors such as 401 and 500 are shared by every operation and
+		// only listed where they say something specific
+		if status < 400 {
+			warn().Msg("Response status is not documented in the API specification")
+		}
+		return
+	}
+	schema := JSONSchema(v.spec.Response(resp).Content)
+	if schema == nil || recorder.truncated {
+		return
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(recorder.body.Bytes(), &value); err != nil {
+		warn().Err(err).Msg("Response is not the JSON the API specification documents")
+		return
+	}
+	if problems := v.spec.Validate(schema, value, "response"); len(problems) > 0 {
+		warn().Strs("problems", problems).Msg("Response does not match the API specification")
+	}
+}
+
+// recordingResponseWriter keeps a copy of the response body for validation
+type recordingResponseWriter struct {
+	*responseWriter
+	body      bytes.Buffer
+	truncated bool
+}
+
+func (rw *recordingResponseWriter) Write(p []byte) (int, error) {
+	if !rw.truncated {
+		if rw.body.Len()+len(p) > MaxValidatedBodySize {
+			rw.truncated = true
+			rw.body.Reset()
+		} else {
+			rw.body.Write(p)
+		}
+	}
+	return rw.responseWriter.Write(p)
+}
+
+// CheckRouter compares the document with the /api/v1 routes of a router. It
+// describes every route the document lacks, every operation no route
+// serves, operations without a unique operationId, path parameters that are
+// not declared and references to unknown components.
+func (s *OpenAPISpec) CheckRouter(router *mux.Router) []string {
+	var problems []string
+
+	routes := make(map[string]bool)
+	err := router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		if err != nil || !strings.HasPrefix(template, openAPIPrefix+"/") {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		path := strings.TrimPrefix(template, openAPIPrefix)
+		for _, method := range methods {
+			routes[method+" "+path] = true
+			if item := s.Paths[path]; item == nil || item.Operations()[method] == nil {
+				problems = append(problems, fmt.Sprintf("%s %s: route is not documented", method, path))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("walk routes: %v", err))
+	}
+
+	operationIDs := make(map[string]string)
+	pathParam := regexp.MustCompile(`{([^}:]+)`)
+	for path, item := range s.Paths {
+		for method, op := range item.Operations() {
+			name := method + " " + path
+			if !routes[name] {
+				problems = append(problems, name+": operation has no route")
+			}
+
+			switch other, taken := operationIDs[op.OperationID]; {
+			case op.OperationID == "":
+				problems = append(problems, name+": operation has no operationId")
+			case taken:
+				problems = append(problems, fmt.Sprintf("%s: operationId %s is also used by %s", name, op.OperationID, other))
+			default:
+				operationIDs[op.OperationID] = name
+			}
+
+			declared := make(map[string]bool)
+			for _, param := range s.OperationParameters(path, op) {
+				if param.In == "path" {
+					declared[param.Name] = true
+				}
+			}
+			for _, match := range pathParam.FindAllStringSubmatch(path, -1) {
+				if !declared[match[1]] {
+					problems = append(problems, fmt.Sprintf("%s: path parameter %s is not declared", name, match[1]))
+				}
+			}
+		}
+	}
+
+	problems = append(problems, s.checkRefs()...)
+	sort.Strings(problems)
+	return problems
+}
+
+// checkRefs describes every reference to a component the document lacks
+func (s *OpenAPISpec) checkRefs() []string {
+	doc, err := json.Marshal(s)
+	if err != nil {
+		return []string{fmt.Sprintf("encode document: %v", err)}
+	}
+
+	var problems []string
+	seen := make(map[string]bool)
+	for _, match := range regexp.MustCompile(`"\$ref":"#/components/(\w+)/([^"]+)"`).FindAllSubmatch(doc, -1) {
+		kind, name := string(match[1]), string(match[2])
+		if seen[kind+"/"+name] {
+			continue
+		}
+		seen[kind+"/"+name] = true
+
+		var found bool
+		switch kind {
+		case "schemas":
+			_, found = s.Components.Schemas[name]
+		case "parameters":
+			_, found = s.Components.Parameters[name]
+		case "requestBodies":
+			_, found = s.Components.RequestBodies[name]
+		case "responses":
+			_, found = s.Components.Responses[name]
+		}
+		if !found {
+			problems = append(problems, fmt.Sprintf("#/components/%s/%s: reference to an unknown component", kind, name))
+		}
+	}
+	return problems
+}
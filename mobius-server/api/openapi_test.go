@@ -0,0 +1,106 @@
+package api_test
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/notawar/mobius/mobius-server/api"
+)
+
+func TestOpenAPIMatchesRouter(t *testing.T) {
+	spec, err := api.LoadOpenAPISpec()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, problem := range spec.CheckRouter(api.NewRouter(&api.Dependencies{})) {
+		t.Error(problem)
+	}
+}
+
+func TestOpenAPIValidator(t *testing.T) {
+	spec, err := api.LoadOpenAPISpec()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	server := newTestServer(t, func(deps *api.Dependencies) {
+		deps.OpenAPIValidator = api.NewOpenAPIValidator(spec)
+	})
+	_, token := server.createUser(t, api.RoleAdmin)
+
+	for _, tc := range []struct {
+		name    string
+		method  string
+		path    string
+		body    interface{}
+		status  int
+		details []string
+	}{
+		{
+			name:   "valid body",
+			method: "POST",
+			path:   "/users",
+			body:   map[string]interface{}{"email": "valid@example.com", "role": "observer", "password": testPassword},
+			status: http.StatusCreated,
+		},
+		{
+			name:   "invalid body",
+			method: "POST",
+			path:   "/users",
+			body:   map[string]interface{}{"email": "invalid@example.com", "role": "root", "device_group_ids": "group-1"},
+			status: http.StatusBadRequest,
+			details: []string{
+				"body.password: is required",
+				"body.device_group_ids: must be an array",
+				"body.role: must be one of admin, maintainer, observer, device-technician",
+			},
+		},
+		{
+			name:   "malformed body",
+			method: "POST",
+			path:   "/users",
+			body:   `{"email": `,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "valid parameter",
+			method: "GET",
+			path:   "/devices?limit=10&sort=hostname",
+			status: http.StatusOK,
+		},
+		{
+			name:    "parameter out of range",
+			method:  "GET",
+			path:    "/devices?limit=0",
+			status:  http.StatusBadRequest,
+			details: []string{"query.limit: must be at least 1"},
+		},
+		{
+			name:    "parameter of the wrong type",
+			method:  "GET",
+			path:    "/devices?limit=ten",
+			status:  http.StatusBadRequest,
+			details: []string{"query.limit: must be an integer"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var apiErr api.APIError
+			resp := server.do(t, tc.method, tc.path, token, tc.body)
+			if tc.status != http.StatusBadRequest {
+				decode(t, resp, tc.status, nil)
+				return
+			}
+			decode(t, resp, tc.status, &apiErr)
+
+			var details []string
+			if list, ok := apiErr.Details.([]interface{}); ok {
+				for _, detail := range list {
+					details = append(details, detail.(string))
+				}
+			}
+			if !reflect.DeepEqual(details, tc.details) {
+				t.Errorf("expected details %q, got %q", tc.details, details)
+			}
+		})
+	}
+}
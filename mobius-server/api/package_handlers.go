@@ -0,0 +1,99 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog/log"
+)
+
+// Application package limits
+const (
+	// MaxPackageSize is the largest package accepted on upload
+	MaxPackageSize = 4 << 30
+	// DownloadURLTTL is how long the download URLs handed to devices stay valid
+	DownloadURLTTL = time.Hour
+)
+
+// signedPackagePath is the path of the signed download route of an application
+func signedPackagePath(appID string) string {
+	return "/api/v1/downloads/applications/" + appID
+}
+
+// signedPackageURL returns an absolute URL to download the package of an
+// application until expiresAt
+func (d *Dependencies) signedPackageURL(r *http.Request, appID string, expiresAt time.Time) string {
+	path := signedPackagePath(appID)
+	signature := d.DownloadSigner.Sign(path, expiresAt)
+
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s%s?expires=%d&signature=%s", scheme, r.Host, path, expiresAt.Unix(), signature)
+}
+
+// handleSignedPackageDownload serves a package to anyone holding a valid,
+// unexpired signed URL
+func (d *Dependencies) handleSignedPackageDownload(w http.ResponseWriter, r *http.Request) {
+	appID := mux.Vars(r)["appId"]
+
+	expires, err := strconv.ParseInt(r.URL.Query().Get("expires"), 10, 64)
+	if err != nil {
+		WriteError(w, http.StatusForbidden, "Invalid or expired download URL")
+		return
+	}
+	if err := d.DownloadSigner.Verify(signedPackagePath(appID), time.Unix(expires, 0), r.URL.Query().Get("signature")); err != nil {
+		log.Debug().Err(err).Str("app_id", appID).Msg("Package download rejected")
+		WriteError(w, http.StatusForbidden, "Invalid or expired download URL")
+		return
+	}
+
+	d.servePackage(w, appID)
+}
+
+// handleDownloadApplicationPackage serves a package to an authenticated user
+func (d *Dependencies) handleDownloadApplicationPackage(w http.ResponseWriter, r *http.Request) {
+	d.servePackage(w, mux.Vars(r)["appId"])
+}
+
+// servePackage streams the package of an application
+func (d *Dependencies) servePackage(w http.ResponseWriter, appID string) {
+	app, err := d.ApplicationService.GetApplication(appID)
+	if err != nil {
+		WriteError(w, http.StatusNotFound, "Application not found")
+		return
+	}
+
+	content, size, err := d.ApplicationService.OpenPackage(appID)
+	if err != nil {
+		log.Error().Err(err).Str("app_id", appID).Msg("Failed to open application package")
+		WriteError(w, http.StatusNotFound, "Application package not found")
+		return
+	}
+	defer content.Close()
+
+	// Large downloads take longer than the server timeouts allow
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		log.Warn().Err(err).Str("app_id", appID).Msg("Failed to lift the deadline of a package download")
+	}
+
+	filename := app.Filename
+	if filename == "" {
+		filename = app.ID
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	w.Header().Set("ETag", strconv.Quote(app.Checksum))
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := io.Copy(w, content); err != nil {
+		log.Warn().Err(err).Str("app_id", appID).Msg("Application package download interrupted")
+	}
+}
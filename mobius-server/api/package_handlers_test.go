@@ -0,0 +1,101 @@
+package api_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/notawar/mobius/mobius-server/api"
+	"github.com/notawar/mobius/mobius-server/pkg/service"
+)
+
+// TestPackageTransfersOutlastTimeouts sends packages through the whole
+// middleware chain of a server whose timeouts are shorter than the
+// transfers, as the 15 second timeouts of mobius-api-server are for large
+// packages
+func TestPackageTransfersOutlastTimeouts(t *testing.T) {
+	base := newTestServer(t, withLicense(t, service.TierProfessional))
+	_, token := base.createUser(t, api.RoleAdmin)
+
+	ts := httptest.NewUnstartedServer(api.NewRouter(base.deps))
+	ts.Config.ReadTimeout = 200 * time.Millisecond
+	ts.Config.WriteTimeout = 200 * time.Millisecond
+	ts.Start()
+	t.Cleanup(ts.Close)
+
+	content := bytes.Repeat([]byte("package "), 2<<20)
+	body, writer := io.Pipe()
+	form := multipart.NewWriter(writer)
+	go func() {
+		for name, value := range map[string]string{"name": "Tool", "version": "1.0", "platform": "linux"} {
+			form.WriteField(name, value) //nolint:errcheck
+		}
+		// Sent a chunk at a time, past the read timeout of the server
+		part, err := form.CreateFormFile("package", "tool.tar.gz")
+		for chunk := 0; err == nil && chunk < len(content); chunk += 2 << 20 {
+			time.Sleep(50 * time.Millisecond)
+			_, err = part.Write(content[chunk : chunk+2<<20])
+		}
+		if err == nil {
+			err = form.Close()
+		}
+		writer.CloseWithError(err)
+	}()
+
+	req, err := http.NewRequest("POST", ts.URL+"/api/v1/applications", body)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var app api.Application
+	decode(t, resp, http.StatusCreated, &app)
+	sum := sha256.Sum256(content)
+	if app.Size != int64(len(content)) || app.Checksum != hex.EncodeToString(sum[:]) {
+		t.Fatalf("expected a package of %d bytes, got %d", len(content), app.Size)
+	}
+
+	req, err = http.NewRequest("GET", ts.URL+"/api/v1/applications/"+app.ID+"/package", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+
+	// Read slower than the server writes, past its write timeout
+	var downloaded bytes.Buffer
+	buf := make([]byte, 1<<20)
+	for {
+		n, err := resp.Body.Read(buf)
+		downloaded.Write(buf[:n])
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("download interrupted after %d bytes: %v", downloaded.Len(), err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if !bytes.Equal(downloaded.Bytes(), content) {
+		t.Errorf("expected the package of %d bytes, got %d bytes", len(content), downloaded.Len())
+	}
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Devices, device groups, policies, applications, users and enrollment
+// secrets carry a revision that increases with every change. It is sent as
+// the ETag of their responses, and changes made with an If-Match header only
+// apply to the revisions it names.
+
+// ErrRevisionConflict is returned when a change expects another revision of
+// a resource than the stored one
+var ErrRevisionConflict = errors.New("resource was modified by another request")
+
+// FormatETag returns the entity tag of a revision
+func FormatETag(revision int) string {
+	return `"` + strconv.Itoa(revision) + `"`
+}
+
+// revisioned is implemented by the resources that carry a revision;
+// WriteJSON sends it as their ETag
+type revisioned interface {
+	ETag() string
+}
+
+func (d *Device) ETag() string           { return FormatETag(d.Revision) }
+func (g *DeviceGroup) ETag() string      { return FormatETag(g.Revision) }
+func (p *Policy) ETag() string           { return FormatETag(p.Revision) }
+func (a *Application) ETag() string      { return FormatETag(a.Revision) }
+func (u *User) ETag() string             { return FormatETag(u.Revision) }
+func (s *EnrollmentSecret) ETag() string { return FormatETag(s.Revision) }
+
+// checkIfMatch compares the If-Match header of a request with the current
+// revision of the resource it changes. It returns the revision the change
+// must apply to, 0 without the header or for "*", and writes 412
+// Precondition Failed when no entity tag matches. Weak tags never match.
+func checkIfMatch(w http.ResponseWriter, r *http.Request, current int) (int, bool) {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return 0, true
+	}
+
+	etag := FormatETag(current)
+	for _, tag := range strings.Split(header, ",") {
+		switch strings.TrimSpace(tag) {
+		case "*":
+			return 0, true
+		case etag:
+			return current, true
+		}
+	}
+
+	w.Header().Set("ETag", etag)
+	WriteError(w, http.StatusPreconditionFailed, "If-Match does not match the current revision "+etag)
+	return 0, false
+}
+
+// writeRevisionConflict answers a change whose expected revision was
+// replaced by another request after it was checked
+func writeRevisionConflict(w http.ResponseWriter) {
+	WriteError(w, http.StatusPreconditionFailed, "Resource was modified by another request; fetch it and retry")
+}
@@ -0,0 +1,272 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/throttled/throttled/v2"
+)
+
+// Rate limit policies, which prefix the keys of their limits
+const (
+	// RateLimitLogin limits login attempts per account
+	RateLimitLogin = "login"
+	// RateLimitDevice limits the device API per device token
+	RateLimitDevice = "device"
+	// RateLimitUser limits protected routes per user
+	RateLimitUser = "user"
+	// RateLimitPublic limits unauthenticated routes per client IP
+	RateLimitPublic = "public"
+)
+
+// Default requests per minute of the rate limit policies
+const (
+	DefaultLoginPerMinute  = 10
+	DefaultDevicePerMinute = 120
+	DefaultUserPerMinute   = 600
+	DefaultPublicPerMinute = 60
+)
+
+// maxLoginBodyPeek bounds how much of a login body is read to find its account
+const maxLoginBodyPeek = 64 << 10
+
+// RateLimits configures the rate limits of a router. Limits follow the
+// generic cell rate algorithm: each key may make its quota of requests per
+// minute, evenly spaced, and may burst up to the whole quota at once.
+type RateLimits struct {
+	// Store holds the state of the limits; share a Redis store between
+	// replicas so that they enforce one limit
+	Store throttled.GCRAStore
+
+	// TrustedProxies are the reverse proxies whose X-Forwarded-For headers
+	// are believed. Requests from other addresses are keyed by their own
+	// address, whatever they claim.
+	TrustedProxies []netip.Prefix
+
+	// Requests per minute of each policy; zero disables the policy
+	LoginPerMinute  int
+	DevicePerMinute int
+	UserPerMinute   int
+	PublicPerMinute int
+}
+
+// ParseTrustedProxies parses a comma-separated list of IP addresses and CIDR
+// prefixes
+func ParseTrustedProxies(s string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		if strings.Contains(field, "/") {
+			prefix, err := netip.ParsePrefix(field)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", field, err)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+
+		addr, err := netip.ParseAddr(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", field, err)
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+// limit returns a middleware enforcing perMinute requests per key for a
+// policy. Requests that key returns an empty key for are not limited. Without
+// a store or a quota the middleware does nothing.
+func (l *RateLimits) limit(policy string, perMinute int, key func(*http.Request) string) func(http.Handler) http.Handler {
+	if l.Store == nil || perMinute <= 0 {
+		return func(next http.Handler) http.Handler { return next }
+	}
+
+	limiter, err := throttled.NewGCRARateLimiter(l.Store, throttled.RateQuota{
+		MaxRate:  throttled.PerMin(perMinute),
+		MaxBurst: perMinute - 1,
+	})
+	if err != nil {
+		// Only an invalid quota fails, which perMinute rules out
+		panic(err)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			k := key(r)
+			if k == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			limited, result, err := limiter.RateLimit(policy+":"+k, 1)
+			if err != nil {
+				// Fail open: an unavailable store must not take the API down
+				log.Error().Err(err).Str("policy", policy).Msg("Failed to check rate limit")
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			setRateLimitHeaders(w, result)
+			if limited {
+				log.Warn().
+					Str("policy", policy).
+					Str("method", r.Method).
+					Str("path", r.URL.Path).
+					Str("client_ip", l.clientIP(r)).
+					Msg("Rate limit exceeded")
+				w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter.Seconds())))
+				WriteError(w, http.StatusTooManyRequests, "Rate limit exceeded")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Login limits login attempts per account, so that guessing one account's
+// password from many addresses is as slow as from one
+func (l *RateLimits) Login() func(http.Handler) http.Handler {
+	return l.limit(RateLimitLogin, l.LoginPerMinute, func(r *http.Request) string {
+		if account := loginAccount(r); account != "" {
+			return account
+		}
+		return "ip:" + l.clientIP(r)
+	})
+}
+
+// Device limits the device API per device token
+func (l *RateLimits) Device() func(http.Handler) http.Handler {
+	return l.limit(RateLimitDevice, l.DevicePerMinute, func(r *http.Request) string {
+		if token := bearerToken(r); token != "" {
+			// Hashed so that tokens never reach the store
+			sum := sha256.Sum256([]byte(token))
+			return hex.EncodeToString(sum[:])
+		}
+		return "ip:" + l.clientIP(r)
+	})
+}
+
+// User limits protected routes per user. It must follow authMiddleware.
+func (l *RateLimits) User() func(http.Handler) http.Handler {
+	return l.limit(RateLimitUser, l.UserPerMinute, func(r *http.Request) string {
+		user, err := GetUserFromContext(r)
+		if err != nil {
+			return ""
+		}
+		return user.ID
+	})
+}
+
+// Public limits unauthenticated routes per client IP
+func (l *RateLimits) Public() func(http.Handler) http.Handler {
+	return l.limit(RateLimitPublic, l.PublicPerMinute, l.clientIP)
+}
+
+// clientIP returns the address of the client. X-Forwarded-For is only
+// believed when the request comes from a trusted proxy, and is read from the
+// right: the first hop that is not a trusted proxy is the client, since
+// anything to its left was written by the client itself.
+func (l *RateLimits) clientIP(r *http.Request) string {
+	remote := remoteAddr(r)
+	if !remote.IsValid() {
+		return r.RemoteAddr
+	}
+	if !l.trusted(remote) {
+		return remote.String()
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			// A malformed hop cannot be attributed; stop at the last known one
+			break
+		}
+		hop = hop.Unmap()
+		if !l.trusted(hop) {
+			return hop.String()
+		}
+		remote = hop
+	}
+	return remote.String()
+}
+
+func (l *RateLimits) trusted(addr netip.Addr) bool {
+	for _, prefix := range l.TrustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func remoteAddr(r *http.Request) netip.Addr {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}
+	}
+	return addr.Unmap()
+}
+
+// loginAccount returns the lowercased email of a login request, leaving the
+// body for the handler to read
+func loginAccount(r *http.Request) string {
+	if r.Body == nil {
+		return ""
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxLoginBodyPeek))
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+	if err != nil {
+		return ""
+	}
+
+	var req LoginRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSpace(req.Email))
+}
+
+func bearerToken(r *http.Request) string {
+	authHeader := r.Header.Get("Authorization")
+	if !strings.HasPrefix(authHeader, "Bearer ") {
+		return ""
+	}
+	return strings.TrimPrefix(authHeader, "Bearer ")
+}
+
+func setRateLimitHeaders(w http.ResponseWriter, result throttled.RateLimitResult) {
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	w.Header().Set("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(result.ResetAfter.Seconds())))
+}
+
+func ceilSeconds(s float64) int {
+	return int(math.Ceil(s))
+}
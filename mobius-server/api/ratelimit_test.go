@@ -0,0 +1,149 @@
+package api_test
+
+import (
+	"net/http"
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/notawar/mobius/mobius-server/api"
+	"github.com/notawar/mobius/mobius-server/pkg/service"
+)
+
+// clockStore is a rate limit store whose clock only moves when told to
+type clockStore struct {
+	*service.RateLimitStore
+	now time.Time
+}
+
+func newClockStore() *clockStore {
+	return &clockStore{RateLimitStore: service.NewRateLimitStore(), now: time.Now()}
+}
+
+func (s *clockStore) GetWithTime(key string) (int64, time.Time, error) {
+	value, _, err := s.RateLimitStore.GetWithTime(key)
+	return value, s.now, err
+}
+
+// expectLimited checks whether a response was refused by a rate limit
+func expectLimited(t *testing.T, resp *http.Response, limited bool, name string) {
+	t.Helper()
+
+	if got := resp.StatusCode == http.StatusTooManyRequests; got != limited {
+		t.Errorf("%s: expected limited %v, got status %d", name, limited, resp.StatusCode)
+	}
+}
+
+func TestRateLimitResets(t *testing.T) {
+	store := newClockStore()
+	server := newTestServer(t, func(deps *api.Dependencies) {
+		deps.RateLimits = &api.RateLimits{Store: store, UserPerMinute: 2}
+	})
+	_, token := server.createUser(t, api.RoleObserver)
+	_, other := server.createUser(t, api.RoleObserver)
+
+	for _, remaining := range []string{"1", "0"} {
+		resp := server.do(t, "GET", "/devices", token, nil)
+		decode(t, resp, http.StatusOK, nil)
+		if limit := resp.Header.Get("X-RateLimit-Limit"); limit != "2" {
+			t.Errorf("expected limit 2, got %q", limit)
+		}
+		if got := resp.Header.Get("X-RateLimit-Remaining"); got != remaining {
+			t.Errorf("expected %s remaining, got %q", remaining, got)
+		}
+	}
+
+	resp := server.do(t, "GET", "/devices", token, nil)
+	decode(t, resp, http.StatusTooManyRequests, nil)
+	if retryAfter := resp.Header.Get("Retry-After"); retryAfter != "30" {
+		t.Errorf("expected to retry after 30 seconds, got %q", retryAfter)
+	}
+
+	// Each user has their own quota
+	decode(t, server.do(t, "GET", "/devices", other, nil), http.StatusOK, nil)
+
+	// One request is allowed again every 30 seconds
+	store.now = store.now.Add(29 * time.Second)
+	decode(t, server.do(t, "GET", "/devices", token, nil), http.StatusTooManyRequests, nil)
+	store.now = store.now.Add(time.Second)
+	decode(t, server.do(t, "GET", "/devices", token, nil), http.StatusOK, nil)
+	decode(t, server.do(t, "GET", "/devices", token, nil), http.StatusTooManyRequests, nil)
+
+	// A minute restores the whole quota
+	store.now = store.now.Add(time.Minute)
+	for i := 0; i < 2; i++ {
+		decode(t, server.do(t, "GET", "/devices", token, nil), http.StatusOK, nil)
+	}
+}
+
+func TestRateLimitTrustedProxies(t *testing.T) {
+	proxies, err := api.ParseTrustedProxies("127.0.0.1, 10.0.0.0/8")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []netip.Prefix{netip.MustParsePrefix("127.0.0.1/32"), netip.MustParsePrefix("10.0.0.0/8")}
+	if !reflect.DeepEqual(proxies, want) {
+		t.Fatalf("expected %v, got %v", want, proxies)
+	}
+	if _, err := api.ParseTrustedProxies("10.0.0.0/33"); err == nil {
+		t.Error("expected an invalid prefix to fail")
+	}
+
+	refresh := func(server *testServer, forwardedFor string) *http.Response {
+		return server.do(t, "POST", "/auth/refresh", "", map[string]string{}, "X-Forwarded-For", forwardedFor)
+	}
+
+	t.Run("trusted", func(t *testing.T) {
+		server := newTestServer(t, func(deps *api.Dependencies) {
+			deps.RateLimits = &api.RateLimits{Store: newClockStore(), TrustedProxies: proxies, PublicPerMinute: 1}
+		})
+
+		expectLimited(t, refresh(server, "203.0.113.1"), false, "first request of a client")
+		expectLimited(t, refresh(server, "203.0.113.1"), true, "second request of a client")
+		expectLimited(t, refresh(server, "203.0.113.2"), false, "first request of another client")
+		// Trusted proxies are skipped from the right
+		expectLimited(t, refresh(server, "203.0.113.1, 10.0.0.5"), true, "client behind another proxy")
+		// Hops left of the first untrusted one are written by the client
+		expectLimited(t, refresh(server, "198.51.100.1, 203.0.113.2"), true, "client claiming another address")
+		expectLimited(t, refresh(server, "198.51.100.1, 203.0.113.3"), false, "first request of a third client")
+		// A malformed hop stops the walk at the last trusted proxy
+		expectLimited(t, refresh(server, "203.0.113.4, bogus, 10.0.0.5"), false, "first request through the proxy")
+		expectLimited(t, refresh(server, "203.0.113.5, bogus, 10.0.0.5"), true, "second request through the proxy")
+	})
+
+	t.Run("untrusted", func(t *testing.T) {
+		server := newTestServer(t, func(deps *api.Dependencies) {
+			deps.RateLimits = &api.RateLimits{Store: newClockStore(), PublicPerMinute: 1}
+		})
+
+		expectLimited(t, refresh(server, "203.0.113.1"), false, "first request")
+		expectLimited(t, refresh(server, "203.0.113.2"), true, "request claiming another address")
+	})
+}
+
+func TestLoginRateLimit(t *testing.T) {
+	server := newTestServer(t, func(deps *api.Dependencies) {
+		deps.RateLimits = &api.RateLimits{Store: newClockStore(), LoginPerMinute: 1}
+	})
+	first, _ := server.createUser(t, api.RoleObserver)
+	second, _ := server.createUser(t, api.RoleObserver)
+
+	login := func(email, password string) *http.Response {
+		return server.do(t, "POST", "/auth/login", "", api.LoginRequest{Email: email, Password: password})
+	}
+
+	decode(t, login(first.Email, "wrong password"), http.StatusUnauthorized, nil)
+	decode(t, login(first.Email, testPassword), http.StatusTooManyRequests, nil)
+	// Accounts are matched whatever the case of their email
+	decode(t, login("  "+strings.ToUpper(first.Email), testPassword), http.StatusTooManyRequests, nil)
+
+	// Other accounts are not limited by guesses at the first, from the same
+	// address, and the handler still reads the body
+	var auth api.AuthResponse
+	decode(t, login(second.Email, testPassword), http.StatusOK, &auth)
+	if auth.Token == "" {
+		t.Error("expected a token")
+	}
+}
@@ -0,0 +1,361 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog/log"
+
+	"github.com/notawar/mobius/mobius-server/pkg/websocket"
+)
+
+// User roles
+const (
+	// RoleAdmin may do everything, including managing users and the license
+	// and reading the audit trail
+	RoleAdmin = "admin"
+	// RoleMaintainer manages devices, policies and applications
+	RoleMaintainer = "maintainer"
+	// RoleObserver has read-only access
+	RoleObserver = "observer"
+	// RoleDeviceTechnician enrolls and services devices but cannot change
+	// policies or applications, or wipe devices
+	RoleDeviceTechnician = "device-technician"
+)
+
+// Permission is an action on a kind of resource, checked for every protected route
+type Permission string
+
+// Permissions
+const (
+	// PermAccount covers logging out, the caller's own account and real-time
+	// events; every role has it
+	PermAccount Permission = "account"
+
+	PermUsersRead  Permission = "users:read"
+	PermUsersWrite Permission = "users:write"
+
+	PermLicenseRead  Permission = "license:read"
+	PermLicenseWrite Permission = "license:write"
+
+	PermDevicesRead    Permission = "devices:read"
+	PermDevicesWrite   Permission = "devices:write"
+	PermDevicesCommand Permission = "devices:command"
+	PermDevicesWipe    Permission = "devices:wipe"
+	PermDevicesQuery   Permission = "devices:query"
+
+	PermEnrollmentRead  Permission = "enrollment:read"
+	PermEnrollmentWrite Permission = "enrollment:write"
+
+	PermDeviceGroupsRead  Permission = "device_groups:read"
+	PermDeviceGroupsWrite Permission = "device_groups:write"
+
+	PermPoliciesRead  Permission = "policies:read"
+	PermPoliciesWrite Permission = "policies:write"
+
+	PermApplicationsRead  Permission = "applications:read"
+	PermApplicationsWrite Permission = "applications:write"
+
+	PermAuditRead Permission = "audit:read"
+)
+
+// RolePermissions maps each role to the permissions it grants
+var RolePermissions = map[string][]Permission{
+	RoleAdmin: {
+		PermAccount,
+		PermUsersRead, PermUsersWrite,
+		PermLicenseRead, PermLicenseWrite,
+		PermDevicesRead, PermDevicesWrite, PermDevicesCommand, PermDevicesWipe, PermDevicesQuery,
+		PermEnrollmentRead, PermEnrollmentWrite,
+		PermDeviceGroupsRead, PermDeviceGroupsWrite,
+		PermPoliciesRead, PermPoliciesWrite,
+		PermApplicationsRead, PermApplicationsWrite,
+		PermAuditRead,
+	},
+	RoleMaintainer: {
+		PermAccount,
+		PermLicenseRead,
+		PermDevicesRead, PermDevicesWrite, PermDevicesCommand, PermDevicesWipe, PermDevicesQuery,
+		PermEnrollmentRead, PermEnrollmentWrite,
+		PermDeviceGroupsRead, PermDeviceGroupsWrite,
+		PermPoliciesRead, PermPoliciesWrite,
+		PermApplicationsRead, PermApplicationsWrite,
+	},
+	RoleObserver: {
+		PermAccount,
+		PermLicenseRead,
+		PermDevicesRead,
+		PermDeviceGroupsRead,
+		PermPoliciesRead,
+		PermApplicationsRead,
+	},
+	RoleDeviceTechnician: {
+		PermAccount,
+		PermLicenseRead,
+		PermDevicesRead, PermDevicesWrite, PermDevicesCommand, PermDevicesQuery,
+		PermEnrollmentRead, PermEnrollmentWrite,
+		PermDeviceGroupsRead,
+		PermPoliciesRead,
+		PermApplicationsRead,
+	},
+}
+
+// HasPermission reports whether role grants perm. Unknown roles grant nothing.
+func HasPermission(role string, perm Permission) bool {
+	for _, p := range RolePermissions[role] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// IsScoped reports whether the user may only act on the devices of their
+// device groups
+func (u *User) IsScoped() bool {
+	return len(u.DeviceGroupIDs) > 0
+}
+
+// authorize rejects requests from users whose role lacks perm. Users scoped
+// to device groups are also rejected for devices and device groups outside
+// their groups, named by the deviceId and groupId route variables.
+func (d *Dependencies) authorize(perm Permission, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, err := GetUserFromContext(r)
+		if err != nil {
+			WriteError(w, http.StatusUnauthorized, "User context required")
+			return
+		}
+
+		if !HasPermission(user.Role, perm) {
+			d.auditDenied(r, user, perm, "role lacks permission")
+			WriteError(w, http.StatusForbidden, "Insufficient permissions")
+			return
+		}
+
+		if user.IsScoped() {
+			vars := mux.Vars(r)
+			if groupID, ok := vars["groupId"]; ok && !groupInScope(user, groupID) {
+				d.auditDenied(r, user, perm, "device group outside scope")
+				WriteError(w, http.StatusForbidden, "Device group is outside your device groups")
+				return
+			}
+			if deviceID, ok := vars["deviceId"]; ok && !d.requireDeviceInScope(w, r, perm, deviceID) {
+				return
+			}
+		}
+
+		next(w, r)
+	}
+}
+
+// requirePermission writes an error response unless the caller's role grants
+// perm, for checks that depend on the request beyond its route
+func (d *Dependencies) requirePermission(w http.ResponseWriter, r *http.Request, perm Permission) (*User, bool) {
+	user, err := GetUserFromContext(r)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, "User context required")
+		return nil, false
+	}
+
+	if !HasPermission(user.Role, perm) {
+		d.auditDenied(r, user, perm, "role lacks permission")
+		WriteError(w, http.StatusForbidden, "Insufficient permissions")
+		return nil, false
+	}
+
+	return user, true
+}
+
+// auditDenied records a request rejected by an authorization check
+func (d *Dependencies) auditDenied(r *http.Request, user *User, perm Permission, reason string) {
+	log.Warn().
+		Str("audit", "access_denied").
+		Str("user_id", user.ID).
+		Str("role", user.Role).
+		Str("permission", string(perm)).
+		Str("method", r.Method).
+		Str("path", r.URL.Path).
+		Str("reason", reason).
+		Msg("Access denied")
+
+	d.audit(r, auditRecord{
+		Action:  "access.denied",
+		Outcome: AuditOutcomeDenied,
+		Reason:  reason,
+		Details: map[string]interface{}{"permission": string(perm)},
+	})
+}
+
+// groupInScope reports whether a scoped user may act on a device group
+func groupInScope(user *User, groupID string) bool {
+	for _, id := range user.DeviceGroupIDs {
+		if id == groupID {
+			return true
+		}
+	}
+	return false
+}
+
+// deviceInScope reports whether the user may act on a device: unscoped users
+// may act on every device, scoped users on the members of their groups
+func (d *Dependencies) deviceInScope(user *User, deviceID string) (bool, error) {
+	if !user.IsScoped() {
+		return true, nil
+	}
+
+	groups, err := d.DeviceGroupService.GetDeviceGroups(deviceID)
+	if err != nil {
+		return false, err
+	}
+	for _, group := range groups {
+		if groupInScope(user, group.ID) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// requireDeviceInScope writes an error response unless the caller may act on
+// a device
+func (d *Dependencies) requireDeviceInScope(w http.ResponseWriter, r *http.Request, perm Permission, deviceID string) bool {
+	user, err := GetUserFromContext(r)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, "User context required")
+		return false
+	}
+
+	inScope, err := d.deviceInScope(user, deviceID)
+	if err != nil {
+		log.Error().Err(err).Str("device_id", deviceID).Msg("Failed to check device scope")
+		WriteError(w, http.StatusInternalServerError, "Failed to check permissions")
+		return false
+	}
+	if !inScope {
+		d.auditDenied(r, user, perm, "device outside scope")
+		WriteError(w, http.StatusForbidden, "Device is outside your device groups")
+		return false
+	}
+	return true
+}
+
+// scopedDeviceIDs returns the devices a scoped user may act on, or nil for
+// unscoped users
+func (d *Dependencies) scopedDeviceIDs(user *User) (map[string]bool, error) {
+	if !user.IsScoped() {
+		return nil, nil
+	}
+	return d.groupDeviceIDs(user.DeviceGroupIDs)
+}
+
+// scopeListQuery limits a list query to the device groups of a scoped user
+func scopeListQuery(q *ListQuery, user *User) {
+	if user.IsScoped() {
+		q.DeviceGroupIDs = user.DeviceGroupIDs
+	}
+}
+
+// filterDeviceScope keeps the items whose device, as deviceID returns it, is
+// in the device groups a list query is limited to, for collections paged in
+// memory
+func filterDeviceScope[T any](d *Dependencies, q *ListQuery, items []T, deviceID func(T) string) ([]T, error) {
+	if q.DeviceGroupIDs == nil {
+		return items, nil
+	}
+	scope, err := d.groupDeviceIDs(q.DeviceGroupIDs)
+	if err != nil {
+		return nil, err
+	}
+	inScope := make([]T, 0, len(items))
+	for _, item := range items {
+		if scope[deviceID(item)] {
+			inScope = append(inScope, item)
+		}
+	}
+	return inScope, nil
+}
+
+// filterGroupScope keeps the device groups a list query is limited to, for
+// collections paged in memory
+func filterGroupScope(q *ListQuery, groups []*DeviceGroup) []*DeviceGroup {
+	if q.DeviceGroupIDs == nil {
+		return groups
+	}
+	inScope := make([]*DeviceGroup, 0, len(q.DeviceGroupIDs))
+	for _, group := range groups {
+		if slices.Contains(q.DeviceGroupIDs, group.ID) {
+			inScope = append(inScope, group)
+		}
+	}
+	return inScope
+}
+
+// groupDeviceIDs returns the members of device groups
+func (d *Dependencies) groupDeviceIDs(groupIDs []string) (map[string]bool, error) {
+	deviceIDs := make(map[string]bool)
+	for _, groupID := range groupIDs {
+		devices, err := d.DeviceGroupService.GetGroupDevices(groupID)
+		if err != nil {
+			// A deleted group no longer grants access
+			continue
+		}
+		for _, device := range devices {
+			deviceIDs[device.ID] = true
+		}
+	}
+	return deviceIDs, nil
+}
+
+// eventPermissions maps each WebSocket event type to the permission needed
+// to receive it. Unlisted event types are not delivered.
+var eventPermissions = map[websocket.EventType]Permission{
+	websocket.EventDeviceStatusChange: PermDevicesRead,
+	websocket.EventCommandExecution:   PermDevicesRead,
+	websocket.EventGroupMembership:    PermDeviceGroupsRead,
+	websocket.EventPolicyAssignment:   PermPoliciesRead,
+	websocket.EventPolicyCompliance:   PermPoliciesRead,
+	websocket.EventLiveQueryResult:    PermDevicesQuery,
+	websocket.EventLiveQueryCompleted: PermDevicesQuery,
+}
+
+// eventAccess limits the WebSocket events of a user to those their role may
+// read, about the devices and groups of their scope
+type eventAccess struct {
+	deps *Dependencies
+	user *User
+}
+
+// CanReceive reports whether the user's role may receive events of a type
+func (a *eventAccess) CanReceive(eventType websocket.EventType) bool {
+	perm, ok := eventPermissions[eventType]
+	return ok && HasPermission(a.user.Role, perm)
+}
+
+// CanSeeDevice reports whether the device is in the user's scope
+func (a *eventAccess) CanSeeDevice(deviceID string) bool {
+	inScope, err := a.deps.deviceInScope(a.user, deviceID)
+	if err != nil {
+		log.Error().Err(err).Str("device_id", deviceID).Msg("Failed to check device scope of event")
+		return false
+	}
+	return inScope
+}
+
+// CanSeeGroup reports whether the device group is in the user's scope
+func (a *eventAccess) CanSeeGroup(groupID string) bool {
+	return !a.user.IsScoped() || groupInScope(a.user, groupID)
+}
+
+// DeviceGroups returns the groups of a device
+func (a *eventAccess) DeviceGroups(deviceID string) []string {
+	groups, err := a.deps.DeviceGroupService.GetDeviceGroups(deviceID)
+	if err != nil {
+		return nil
+	}
+	ids := make([]string, 0, len(groups))
+	for _, group := range groups {
+		ids = append(ids, group.ID)
+	}
+	return ids
+}
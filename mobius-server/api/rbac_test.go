@@ -0,0 +1,259 @@
+package api_test
+
+import (
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/notawar/mobius/mobius-server/api"
+	"github.com/notawar/mobius/mobius-server/pkg/service"
+)
+
+// unqueriedPolicies hides the list queries of a policy service, so that its
+// lists are paged in memory
+type unqueriedPolicies struct {
+	api.PolicyService
+}
+
+func TestPolicyScope(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		configure func(*api.Dependencies)
+	}{
+		{"datastore", func(*api.Dependencies) {}},
+		{"in memory", func(deps *api.Dependencies) {
+			deps.PolicyService = unqueriedPolicies{deps.PolicyService}
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			server := newTestServer(t, tc.configure)
+			deps := server.deps
+
+			var groupIDs []string
+			for i, name := range []string{"Scoped", "Other"} {
+				group, err := deps.DeviceGroupService.CreateDeviceGroup(api.DeviceGroupCreate{Name: name})
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				groupIDs = append(groupIDs, group.ID)
+
+				deviceID := []string{"scoped-device", "other-device"}[i]
+				if _, err := deps.DeviceService.EnrollDevice(api.DeviceEnrollment{UUID: deviceID, Hostname: deviceID, Platform: "linux"}); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if err := deps.DeviceGroupService.AddDeviceToGroup(group.ID, deviceID); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+
+			policy, err := deps.PolicyService.CreatePolicy(api.PolicyCreate{Name: "Baseline", Platform: "linux"})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for _, deviceID := range []string{"scoped-device", "other-device"} {
+				if err := deps.PolicyService.AssignPolicyToDevice(policy.ID, deviceID); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+			for _, groupID := range groupIDs {
+				if err := deps.PolicyService.AssignPolicyToGroup(policy.ID, groupID); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+
+			_, unscoped := server.createUser(t, api.RoleObserver)
+			_, scoped := server.createUser(t, api.RoleObserver, groupIDs[0])
+			for _, user := range []struct {
+				name    string
+				token   string
+				devices []string
+				groups  []string
+			}{
+				{"unscoped", unscoped, []string{"other-device", "scoped-device"}, groupIDs},
+				{"scoped", scoped, []string{"scoped-device"}, groupIDs[:1]},
+			} {
+				var devices struct {
+					Devices []*api.Device `json:"devices"`
+					Total   int           `json:"total"`
+				}
+				decode(t, server.do(t, "GET", "/policies/"+policy.ID+"/devices?sort=hostname", user.token, nil), http.StatusOK, &devices)
+				var deviceIDs []string
+				for _, device := range devices.Devices {
+					deviceIDs = append(deviceIDs, device.ID)
+				}
+				if !reflect.DeepEqual(deviceIDs, user.devices) || devices.Total != len(user.devices) {
+					t.Errorf("%s: expected devices %v, got %v of %d", user.name, user.devices, deviceIDs, devices.Total)
+				}
+
+				var groups struct {
+					Groups []*api.DeviceGroup `json:"groups"`
+					Total  int                `json:"total"`
+				}
+				decode(t, server.do(t, "GET", "/policies/"+policy.ID+"/groups?sort=-name", user.token, nil), http.StatusOK, &groups)
+				var gotGroupIDs []string
+				for _, group := range groups.Groups {
+					gotGroupIDs = append(gotGroupIDs, group.ID)
+				}
+				if !reflect.DeepEqual(gotGroupIDs, user.groups) || groups.Total != len(user.groups) {
+					t.Errorf("%s: expected groups %v, got %v of %d", user.name, user.groups, gotGroupIDs, groups.Total)
+				}
+			}
+		})
+	}
+}
+
+func TestRolePermissions(t *testing.T) {
+	server := newTestServer(t, withLicense(t, service.TierProfessional))
+	if _, err := server.deps.DeviceService.EnrollDevice(api.DeviceEnrollment{UUID: "device-1", Hostname: "device-1", Platform: "linux"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	all := []string{api.RoleAdmin, api.RoleMaintainer, api.RoleObserver, api.RoleDeviceTechnician}
+	managers := []string{api.RoleAdmin, api.RoleMaintainer}
+	fieldStaff := []string{api.RoleAdmin, api.RoleMaintainer, api.RoleDeviceTechnician}
+
+	// Each request needs one permission. Writes send bodies the handlers
+	// refuse, so that allowed requests fail after the permission check
+	// without changing anything.
+	checks := []struct {
+		perm   api.Permission
+		method string
+		path   string
+		body   interface{}
+		roles  []string
+	}{
+		{api.PermAccount, "GET", "/users/{self}", nil, all},
+		{api.PermUsersRead, "GET", "/users", nil, []string{api.RoleAdmin}},
+		{api.PermUsersWrite, "POST", "/users", "{", []string{api.RoleAdmin}},
+		{api.PermLicenseRead, "GET", "/license/status", nil, all},
+		{api.PermLicenseWrite, "PUT", "/license", "{", []string{api.RoleAdmin}},
+		{api.PermDevicesRead, "GET", "/devices", nil, all},
+		{api.PermDevicesWrite, "PUT", "/devices/device-1", "{", fieldStaff},
+		{api.PermDevicesCommand, "POST", "/devices/device-1/commands", "{", fieldStaff},
+		{api.PermDevicesWipe, "POST", "/devices/device-1/commands", map[string]interface{}{"command": "wipe", "expires_in": -1}, managers},
+		{api.PermDevicesQuery, "POST", "/devices/device-1/osquery", "{", fieldStaff},
+		{api.PermEnrollmentRead, "GET", "/enrollment-secrets", nil, fieldStaff},
+		{api.PermEnrollmentWrite, "POST", "/enrollment-secrets", "{", fieldStaff},
+		{api.PermDeviceGroupsRead, "GET", "/device-groups", nil, all},
+		{api.PermDeviceGroupsWrite, "POST", "/device-groups", "{", managers},
+		{api.PermPoliciesRead, "GET", "/policies", nil, all},
+		{api.PermPoliciesWrite, "POST", "/policies", "{", managers},
+		{api.PermApplicationsRead, "GET", "/applications", nil, all},
+		{api.PermApplicationsWrite, "PUT", "/applications/app-1", "{", managers},
+		{api.PermAuditRead, "GET", "/audit", nil, []string{api.RoleAdmin}},
+	}
+
+	checked := make(map[api.Permission]bool)
+	for _, role := range all {
+		user, token := server.createUser(t, role)
+		for _, check := range checks {
+			checked[check.perm] = true
+			path := strings.ReplaceAll(check.path, "{self}", user.ID)
+			resp := server.do(t, check.method, path, token, check.body)
+			resp.Body.Close()
+
+			allowed := slices.Contains(check.roles, role)
+			if denied := resp.StatusCode == http.StatusForbidden; denied == allowed {
+				t.Errorf("%s %s %s: expected allowed %v, got status %d", role, check.method, path, allowed, resp.StatusCode)
+			}
+			if allowed != api.HasPermission(role, check.perm) {
+				t.Errorf("%s: expected %s granted %v", role, check.perm, allowed)
+			}
+		}
+	}
+
+	// Every permission a role grants is checked
+	for role, perms := range api.RolePermissions {
+		for _, perm := range perms {
+			if !checked[perm] {
+				t.Errorf("%s: permission %s is not checked", role, perm)
+			}
+		}
+	}
+	if api.HasPermission("root", api.PermAccount) {
+		t.Error("expected unknown roles to grant nothing")
+	}
+}
+
+func TestDeviceGroupScope(t *testing.T) {
+	server := newTestServer(t)
+	deps := server.deps
+
+	var groupIDs []string
+	for i, name := range []string{"Scoped", "Other"} {
+		group, err := deps.DeviceGroupService.CreateDeviceGroup(api.DeviceGroupCreate{Name: name})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		groupIDs = append(groupIDs, group.ID)
+
+		deviceID := []string{"scoped-device", "other-device"}[i]
+		if _, err := deps.DeviceService.EnrollDevice(api.DeviceEnrollment{UUID: deviceID, Hostname: deviceID, Platform: "linux"}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := deps.DeviceGroupService.AddDeviceToGroup(group.ID, deviceID); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	policy, err := deps.PolicyService.CreatePolicy(api.PolicyCreate{Name: "Baseline", Platform: "linux"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Admins cannot be limited to device groups
+	decode(t, server.do(t, "POST", "/users", adminToken(t, server), api.UserCreate{
+		Email: "scoped-admin@example.com", Role: api.RoleAdmin, DeviceGroupIDs: groupIDs[:1], Password: testPassword,
+	}), http.StatusBadRequest, nil)
+
+	for _, role := range []string{api.RoleMaintainer, api.RoleObserver, api.RoleDeviceTechnician} {
+		_, token := server.createUser(t, role, groupIDs[0])
+
+		for _, check := range []struct {
+			path   string
+			status int
+		}{
+			{"/devices/scoped-device", http.StatusOK},
+			{"/devices/other-device", http.StatusForbidden},
+			{"/devices/other-device/compliance", http.StatusForbidden},
+			{"/device-groups/" + groupIDs[0], http.StatusOK},
+			{"/device-groups/" + groupIDs[1], http.StatusForbidden},
+			{"/device-groups/" + groupIDs[1] + "/devices", http.StatusForbidden},
+		} {
+			decode(t, server.do(t, "GET", check.path, token, nil), check.status, nil)
+		}
+
+		var devices struct {
+			Devices []*api.Device `json:"devices"`
+		}
+		decode(t, server.do(t, "GET", "/devices", token, nil), http.StatusOK, &devices)
+		if len(devices.Devices) != 1 || devices.Devices[0].ID != "scoped-device" {
+			t.Errorf("%s: expected only scoped-device, got %d devices", role, len(devices.Devices))
+		}
+		var groups struct {
+			Groups []*api.DeviceGroup `json:"device_groups"`
+		}
+		decode(t, server.do(t, "GET", "/device-groups", token, nil), http.StatusOK, &groups)
+		if len(groups.Groups) != 1 || groups.Groups[0].ID != groupIDs[0] {
+			t.Errorf("%s: expected only the scoped group, got %d groups", role, len(groups.Groups))
+		}
+
+		// Writes outside the scope are refused even when the role allows them
+		if api.HasPermission(role, api.PermPoliciesWrite) {
+			decode(t, server.do(t, "POST", "/policies/"+policy.ID+"/devices/other-device", token, nil), http.StatusForbidden, nil)
+			decode(t, server.do(t, "POST", "/policies/"+policy.ID+"/groups/"+groupIDs[1], token, nil), http.StatusForbidden, nil)
+		}
+		if api.HasPermission(role, api.PermDevicesCommand) {
+			decode(t, server.do(t, "POST", "/devices/other-device/commands", token, api.DeviceCommandRequest{Command: "restart"}), http.StatusForbidden, nil)
+		}
+	}
+}
+
+// adminToken returns the token of a new admin of a test server
+func adminToken(t *testing.T, server *testServer) string {
+	t.Helper()
+
+	_, token := server.createUser(t, api.RoleAdmin)
+	return token
+}
@@ -3,6 +3,8 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"path/filepath"
 	"strings"
@@ -10,93 +12,202 @@ import (
 
 	"github.com/gorilla/mux"
 	"github.com/rs/zerolog/log"
+
+	"github.com/notawar/mobius/mobius-server/pkg/websocket"
+	"github.com/notawar/mobius/mobius-server/server/health"
 )
 
 // Router creates and configures the main API router
 func NewRouter(deps *Dependencies) *mux.Router {
 	r := mux.NewRouter()
 
+	metrics := newMetrics(deps)
+
+	limits := deps.RateLimits
+	if limits == nil {
+		limits = &RateLimits{}
+	}
+
 	// Middleware
 	r.Use(LoggingMiddleware)
+	r.Use(metrics.middleware)
 	r.Use(CORSMiddleware)
 	r.Use(SecurityHeadersMiddleware)
 
 	// API versioning
 	api := r.PathPrefix("/api/v1").Subrouter()
+	if deps.OpenAPIValidator != nil {
+		api.Use(deps.OpenAPIValidator.Middleware)
+	}
 
 	// Public routes (no auth required)
-	api.HandleFunc("/health", HealthHandler).Methods("GET")
-	api.HandleFunc("/metrics", MetricsHandler).Methods("GET")
-	api.HandleFunc("/auth/login", deps.handleLogin).Methods("POST")
+	api.HandleFunc("/health", deps.handleHealth).Methods("GET")
+	api.HandleFunc("/health/live", deps.handleLiveness).Methods("GET")
+	api.HandleFunc("/health/ready", deps.handleHealth).Methods("GET")
+	api.Handle("/metrics", metrics.handler(deps.MetricsUsername, deps.MetricsPassword)).Methods("GET")
+	// Logins are limited per client IP and per account (see ratelimit.go)
+	api.Handle("/auth/login", limits.Public()(limits.Login()(http.HandlerFunc(deps.handleLogin)))).Methods("POST")
+	api.Handle("/auth/refresh", limits.Public()(http.HandlerFunc(deps.handleRefreshToken))).Methods("POST")
+	api.Handle("/device/enroll", limits.Public()(deps.Idempotency.Middleware(http.HandlerFunc(deps.handleDeviceEnroll)))).Methods("POST")
+	// Package downloads are authorized by the signature in the URL
+	api.Handle("/downloads/applications/{appId}", limits.Public()(http.HandlerFunc(deps.handleSignedPackageDownload))).Methods("GET")
 
-	// Protected routes
+	// Protected routes; each names the permission its caller's role must
+	// grant (see rbac.go)
 	protected := api.PathPrefix("").Subrouter()
 	protected.Use(deps.authMiddleware)
+	protected.Use(limits.User())
+	// Retries with an Idempotency-Key replay the first response (see idempotency.go)
+	protected.Use(deps.Idempotency.Middleware)
+
+	protected.HandleFunc("/auth/logout", deps.authorize(PermAccount, deps.handleLogout)).Methods("POST")
+
+	// User management
+	users := protected.PathPrefix("/users").Subrouter()
+	users.HandleFunc("", deps.authorize(PermUsersRead, deps.handleListUsers)).Methods("GET")
+	users.HandleFunc("", deps.authorize(PermUsersWrite, deps.handleCreateUser)).Methods("POST")
+	users.HandleFunc("/{userId}", deps.authorize(PermAccount, deps.handleGetUser)).Methods("GET")
+	users.HandleFunc("/{userId}", deps.authorize(PermAccount, deps.handleUpdateUser)).Methods("PUT")
+	users.HandleFunc("/{userId}", deps.authorize(PermUsersWrite, deps.handleDeleteUser)).Methods("DELETE")
+	users.HandleFunc("/{userId}/sessions", deps.authorize(PermUsersWrite, deps.handleRevokeUserSessions)).Methods("DELETE")
 
 	// License management
-	protected.HandleFunc("/license/status", deps.handleGetLicense).Methods("GET")
-	protected.HandleFunc("/license", deps.handleUpdateLicense).Methods("PUT")
+	protected.HandleFunc("/license/status", deps.authorize(PermLicenseRead, deps.handleGetLicense)).Methods("GET")
+	protected.HandleFunc("/license", deps.authorize(PermLicenseWrite, deps.handleUpdateLicense)).Methods("PUT")
 
 	// Device routes
 	devices := protected.PathPrefix("/devices").Subrouter()
-	devices.HandleFunc("", deps.handleListDevices).Methods("GET")
-	devices.HandleFunc("", deps.handleEnrollDevice).Methods("POST")
-	devices.HandleFunc("/{deviceId}", deps.handleGetDevice).Methods("GET")
-	devices.HandleFunc("/{deviceId}", deps.handleUpdateDevice).Methods("PUT")
-	devices.HandleFunc("/{deviceId}", deps.handleUnenrollDevice).Methods("DELETE")
-	devices.HandleFunc("/{deviceId}/commands", deps.handleDeviceCommand).Methods("POST")
-	devices.HandleFunc("/{deviceId}/osquery", deps.handleDeviceOSQuery).Methods("POST")
+	devices.HandleFunc("", deps.authorize(PermDevicesRead, deps.handleListDevices)).Methods("GET")
+	devices.HandleFunc("", deps.authorize(PermDevicesWrite, deps.handleEnrollDevice)).Methods("POST")
+	devices.HandleFunc("/{deviceId}", deps.authorize(PermDevicesRead, deps.handleGetDevice)).Methods("GET")
+	devices.HandleFunc("/{deviceId}", deps.authorize(PermDevicesWrite, deps.handleUpdateDevice)).Methods("PUT")
+	devices.HandleFunc("/{deviceId}", deps.authorize(PermDevicesWrite, deps.handleUnenrollDevice)).Methods("DELETE")
+	devices.HandleFunc("/{deviceId}/commands", deps.authorize(PermDevicesCommand, deps.handleDeviceCommand)).Methods("POST")
+	devices.HandleFunc("/{deviceId}/commands", deps.authorize(PermDevicesRead, deps.handleListDeviceCommands)).Methods("GET")
+	devices.HandleFunc("/{deviceId}/osquery", deps.authorize(PermDevicesQuery, deps.handleDeviceOSQuery)).Methods("POST")
+	devices.HandleFunc("/{deviceId}/token", deps.authorize(PermDevicesWrite, deps.handleRevokeDeviceToken)).Methods("DELETE")
+	devices.HandleFunc("/{deviceId}/compliance", deps.authorize(PermDevicesRead, deps.handleGetDeviceCompliance)).Methods("GET")
+	devices.HandleFunc("/{deviceId}/compliance/{policyId}", deps.authorize(PermDevicesRead, deps.handleGetPolicyResultHistory)).Methods("GET")
+
+	// Enrollment secrets
+	secrets := protected.PathPrefix("/enrollment-secrets").Subrouter()
+	secrets.HandleFunc("", deps.authorize(PermEnrollmentRead, deps.handleListEnrollmentSecrets)).Methods("GET")
+	secrets.HandleFunc("", deps.authorize(PermEnrollmentWrite, deps.handleCreateEnrollmentSecret)).Methods("POST")
+	secrets.HandleFunc("/{secretId}", deps.authorize(PermEnrollmentRead, deps.handleGetEnrollmentSecret)).Methods("GET")
+	secrets.HandleFunc("/{secretId}", deps.authorize(PermEnrollmentWrite, deps.handleDeleteEnrollmentSecret)).Methods("DELETE")
+	secrets.HandleFunc("/{secretId}/rotate", deps.authorize(PermEnrollmentWrite, deps.handleRotateEnrollmentSecret)).Methods("POST")
+
+	// Device command queue
+	commands := protected.PathPrefix("/commands").Subrouter()
+	commands.HandleFunc("", deps.authorize(PermDevicesRead, deps.handleListCommands)).Methods("GET")
+	commands.HandleFunc("/{commandId}", deps.authorize(PermDevicesRead, deps.handleGetCommand)).Methods("GET")
+
+	// Live query campaigns
+	liveQueries := protected.PathPrefix("/live-queries").Subrouter()
+	liveQueries.HandleFunc("", deps.authorize(PermDevicesQuery, deps.handleCreateLiveQuery)).Methods("POST")
+	liveQueries.HandleFunc("/{campaignId}", deps.authorize(PermDevicesQuery, deps.handleGetLiveQuery)).Methods("GET")
+
+	// Bulk device operations; creating and cancelling also require the
+	// permission of the action
+	bulk := protected.PathPrefix("/bulk-operations").Subrouter()
+	bulk.HandleFunc("", deps.authorize(PermDevicesRead, deps.handleListBulkOperations)).Methods("GET")
+	bulk.HandleFunc("", deps.authorize(PermDevicesRead, deps.handleCreateBulkOperation)).Methods("POST")
+	bulk.HandleFunc("/{operationId}", deps.authorize(PermDevicesRead, deps.handleGetBulkOperation)).Methods("GET")
+	bulk.HandleFunc("/{operationId}/cancel", deps.authorize(PermDevicesRead, deps.handleCancelBulkOperation)).Methods("POST")
 
 	// Device Groups management
 	groups := protected.PathPrefix("/device-groups").Subrouter()
-	groups.HandleFunc("", deps.handleListDeviceGroups).Methods("GET")
-	groups.HandleFunc("", deps.handleCreateDeviceGroup).Methods("POST")
-	groups.HandleFunc("/{groupId}", deps.handleGetDeviceGroup).Methods("GET")
-	groups.HandleFunc("/{groupId}", deps.handleUpdateDeviceGroup).Methods("PUT")
-	groups.HandleFunc("/{groupId}", deps.handleDeleteDeviceGroup).Methods("DELETE")
-	groups.HandleFunc("/{groupId}/devices", deps.handleGetGroupDevices).Methods("GET")
-	groups.HandleFunc("/{groupId}/devices/{deviceId}", deps.handleAddDeviceToGroup).Methods("POST")
-	groups.HandleFunc("/{groupId}/devices/{deviceId}", deps.handleRemoveDeviceFromGroup).Methods("DELETE")
+	groups.HandleFunc("", deps.authorize(PermDeviceGroupsRead, deps.handleListDeviceGroups)).Methods("GET")
+	groups.HandleFunc("", deps.authorize(PermDeviceGroupsWrite, deps.handleCreateDeviceGroup)).Methods("POST")
+	groups.HandleFunc("/{groupId}", deps.authorize(PermDeviceGroupsRead, deps.handleGetDeviceGroup)).Methods("GET")
+	groups.HandleFunc("/{groupId}", deps.authorize(PermDeviceGroupsWrite, deps.handleUpdateDeviceGroup)).Methods("PUT")
+	groups.HandleFunc("/{groupId}", deps.authorize(PermDeviceGroupsWrite, deps.handleDeleteDeviceGroup)).Methods("DELETE")
+	groups.HandleFunc("/{groupId}/devices", deps.authorize(PermDeviceGroupsRead, deps.handleGetGroupDevices)).Methods("GET")
+	groups.HandleFunc("/{groupId}/devices/{deviceId}", deps.authorize(PermDeviceGroupsWrite, deps.handleAddDeviceToGroup)).Methods("POST")
+	groups.HandleFunc("/{groupId}/devices/{deviceId}", deps.authorize(PermDeviceGroupsWrite, deps.handleRemoveDeviceFromGroup)).Methods("DELETE")
+	groups.HandleFunc("/{groupId}/devices/{deviceId}/explain", deps.authorize(PermDeviceGroupsRead, deps.handleExplainGroupMembership)).Methods("GET")
+	groups.HandleFunc("/{groupId}/compliance", deps.authorize(PermDeviceGroupsRead, deps.handleGetGroupCompliance)).Methods("GET")
 
 	// Policy management
 	policies := protected.PathPrefix("/policies").Subrouter()
-	policies.HandleFunc("", deps.handleListPolicies).Methods("GET")
-	policies.HandleFunc("", deps.handleCreatePolicy).Methods("POST")
-	policies.HandleFunc("/{policyId}", deps.handleGetPolicy).Methods("GET")
-	policies.HandleFunc("/{policyId}", deps.handleUpdatePolicy).Methods("PUT")
-	policies.HandleFunc("/{policyId}", deps.handleDeletePolicy).Methods("DELETE")
+	policies.HandleFunc("", deps.authorize(PermPoliciesRead, deps.handleListPolicies)).Methods("GET")
+	policies.HandleFunc("", deps.authorize(PermPoliciesWrite, deps.handleCreatePolicy)).Methods("POST")
+	policies.HandleFunc("/{policyId}", deps.authorize(PermPoliciesRead, deps.handleGetPolicy)).Methods("GET")
+	policies.HandleFunc("/{policyId}", deps.authorize(PermPoliciesWrite, deps.handleUpdatePolicy)).Methods("PUT")
+	policies.HandleFunc("/{policyId}", deps.authorize(PermPoliciesWrite, deps.handleDeletePolicy)).Methods("DELETE")
 	
 	// Policy assignment endpoints
-	policies.HandleFunc("/{policyId}/devices", deps.handleGetPolicyDevices).Methods("GET")
-	policies.HandleFunc("/{policyId}/devices/{deviceId}", deps.handleAssignPolicyToDevice).Methods("POST")
-	policies.HandleFunc("/{policyId}/devices/{deviceId}", deps.handleUnassignPolicyFromDevice).Methods("DELETE")
-	policies.HandleFunc("/{policyId}/groups", deps.handleGetPolicyGroups).Methods("GET")
-	policies.HandleFunc("/{policyId}/groups/{groupId}", deps.handleAssignPolicyToGroup).Methods("POST")
-	policies.HandleFunc("/{policyId}/groups/{groupId}", deps.handleUnassignPolicyFromGroup).Methods("DELETE")
+	policies.HandleFunc("/{policyId}/devices", deps.authorize(PermPoliciesRead, deps.handleGetPolicyDevices)).Methods("GET")
+	policies.HandleFunc("/{policyId}/devices/{deviceId}", deps.authorize(PermPoliciesWrite, deps.handleAssignPolicyToDevice)).Methods("POST")
+	policies.HandleFunc("/{policyId}/devices/{deviceId}", deps.authorize(PermPoliciesWrite, deps.handleUnassignPolicyFromDevice)).Methods("DELETE")
+	policies.HandleFunc("/{policyId}/groups", deps.authorize(PermPoliciesRead, deps.handleGetPolicyGroups)).Methods("GET")
+	policies.HandleFunc("/{policyId}/groups/{groupId}", deps.authorize(PermPoliciesWrite, deps.handleAssignPolicyToGroup)).Methods("POST")
+	policies.HandleFunc("/{policyId}/groups/{groupId}", deps.authorize(PermPoliciesWrite, deps.handleUnassignPolicyFromGroup)).Methods("DELETE")
+	policies.HandleFunc("/{policyId}/compliance", deps.authorize(PermPoliciesRead, deps.handleGetPolicyCompliance)).Methods("GET")
+
+	// Policy compliance
+	protected.HandleFunc("/compliance", deps.authorize(PermDevicesRead, deps.handleGetFleetCompliance)).Methods("GET")
+
+	// Audit trail
+	protected.HandleFunc("/audit", deps.authorize(PermAuditRead, deps.handleListAuditEntries)).Methods("GET")
 
 	// Application management
 	apps := protected.PathPrefix("/applications").Subrouter()
-	apps.HandleFunc("", deps.handleListApplications).Methods("GET")
-	apps.HandleFunc("", deps.handleAddApplication).Methods("POST")
-	apps.HandleFunc("/{appId}", deps.handleGetApplication).Methods("GET")
-	apps.HandleFunc("/{appId}", deps.handleUpdateApplication).Methods("PUT")
-	apps.HandleFunc("/{appId}", deps.handleDeleteApplication).Methods("DELETE")
+	apps.Use(deps.requireFeature("application_management"))
+	apps.HandleFunc("", deps.authorize(PermApplicationsRead, deps.handleListApplications)).Methods("GET")
+	apps.HandleFunc("", deps.authorize(PermApplicationsWrite, deps.handleAddApplication)).Methods("POST")
+	apps.HandleFunc("/import", deps.authorize(PermApplicationsWrite, deps.handleImportApplication)).Methods("POST")
+	apps.HandleFunc("/check-updates", deps.authorize(PermApplicationsWrite, deps.handleCheckApplicationUpdates)).Methods("POST")
+	apps.HandleFunc("/{appId}", deps.authorize(PermApplicationsRead, deps.handleGetApplication)).Methods("GET")
+	apps.HandleFunc("/{appId}", deps.authorize(PermApplicationsWrite, deps.handleUpdateApplication)).Methods("PUT")
+	apps.HandleFunc("/{appId}", deps.authorize(PermApplicationsWrite, deps.handleDeleteApplication)).Methods("DELETE")
+	apps.HandleFunc("/{appId}/package", deps.authorize(PermApplicationsRead, deps.handleDownloadApplicationPackage)).Methods("GET")
+	apps.HandleFunc("/{appId}/groups", deps.authorize(PermApplicationsRead, deps.handleListApplicationPublications)).Methods("GET")
+	apps.HandleFunc("/{appId}/groups/{groupId}", deps.authorize(PermApplicationsWrite, deps.handlePublishApplication)).Methods("POST")
+	apps.HandleFunc("/{appId}/groups/{groupId}", deps.authorize(PermApplicationsWrite, deps.handleUnpublishApplication)).Methods("DELETE")
+
+	// Requests of devices to install restricted catalog applications
+	appRequests := protected.PathPrefix("/application-requests").Subrouter()
+	appRequests.Use(deps.requireFeature("application_management"))
+	appRequests.HandleFunc("", deps.authorize(PermApplicationsRead, deps.handleListApplicationRequests)).Methods("GET")
+	appRequests.HandleFunc("/{requestId}", deps.authorize(PermApplicationsRead, deps.handleGetApplicationRequest)).Methods("GET")
+	appRequests.HandleFunc("/{requestId}/approve", deps.authorize(PermApplicationsWrite, deps.handleApproveApplicationRequest)).Methods("POST")
+	appRequests.HandleFunc("/{requestId}/deny", deps.authorize(PermApplicationsWrite, deps.handleDenyApplicationRequest)).Methods("POST")
 
 	// WebSocket endpoint for real-time updates
-	protected.HandleFunc("/ws", deps.handleWebSocket).Methods("GET")
+	protected.HandleFunc("/ws", deps.authorize(PermAccount, deps.handleWebSocket)).Methods("GET")
 
 	// Device API (for client connections)
 	deviceAPI := api.PathPrefix("/device").Subrouter()
+	// Limited per device token, before the token is looked up
+	deviceAPI.Use(limits.Device())
 	deviceAPI.Use(deps.deviceAuthMiddleware)
+	deviceAPI.Use(deps.Idempotency.Middleware)
 	deviceAPI.HandleFunc("/checkin", deps.handleDeviceCheckin).Methods("POST")
+	deviceAPI.HandleFunc("/token/rotate", deps.handleDeviceRotateToken).Methods("POST")
 	deviceAPI.HandleFunc("/policies", deps.handleDeviceGetPolicies).Methods("GET")
 	deviceAPI.HandleFunc("/applications", deps.handleDeviceGetApplications).Methods("GET")
+	deviceAPI.HandleFunc("/commands", deps.handleDeviceFetchCommands).Methods("GET")
+	deviceAPI.HandleFunc("/commands/{commandId}/ack", deps.handleDeviceAcknowledgeCommand).Methods("POST")
+	deviceAPI.HandleFunc("/commands/{commandId}/result", deps.handleDeviceCommandResult).Methods("POST")
+	deviceAPI.HandleFunc("/queries", deps.handleDeviceGetLiveQueries).Methods("GET")
+	deviceAPI.HandleFunc("/queries/{campaignId}/results", deps.handleDeviceLiveQueryResult).Methods("POST")
+
+	// Self-service catalog of the applications published to the device's
+	// groups (see catalog_handlers.go)
+	catalog := deviceAPI.PathPrefix("/catalog").Subrouter()
+	catalog.Use(deps.requireFeature("application_management"))
+	catalog.HandleFunc("", deps.handleDeviceGetCatalog).Methods("GET")
+	catalog.HandleFunc("/requests", deps.handleDeviceListApplicationRequests).Methods("GET")
+	catalog.HandleFunc("/{appId}/install", deps.handleDeviceInstallCatalogApplication).Methods("POST")
+	catalog.HandleFunc("/{appId}/uninstall", deps.handleDeviceUninstallCatalogApplication).Methods("POST")
+	catalog.HandleFunc("/{appId}/requests", deps.handleDeviceRequestApplication).Methods("POST")
 
 	// Legacy CLI compatibility routes (/api/latest/mobius/*)
 	legacyAPI := r.PathPrefix("/api/latest/mobius").Subrouter()
 
 	// Legacy authentication
-	legacyAPI.HandleFunc("/login", deps.handleLegacyLogin).Methods("POST")
+	legacyAPI.Handle("/login", limits.Public()(limits.Login()(http.HandlerFunc(deps.handleLegacyLogin)))).Methods("POST")
 	legacyAPI.HandleFunc("/logout", deps.handleLegacyLogout).Methods("POST")
 
 	// Legacy version endpoint
@@ -105,14 +216,15 @@ func NewRouter(deps *Dependencies) *mux.Router {
 	// Legacy protected routes
 	legacyProtected := legacyAPI.PathPrefix("").Subrouter()
 	legacyProtected.Use(deps.authMiddleware)
+	legacyProtected.Use(limits.User())
 
 	// Legacy config endpoint
-	legacyProtected.HandleFunc("/config", deps.handleLegacyConfig).Methods("GET")
+	legacyProtected.HandleFunc("/config", deps.authorize(PermAccount, deps.handleLegacyConfig)).Methods("GET")
 
 	// Legacy license endpoints
-	legacyProtected.HandleFunc("/license", deps.handleGetLicense).Methods("GET")
-	legacyProtected.HandleFunc("/license/status", deps.handleGetLicense).Methods("GET")
-	legacyProtected.HandleFunc("/license", deps.handleUpdateLicense).Methods("PUT")
+	legacyProtected.HandleFunc("/license", deps.authorize(PermLicenseRead, deps.handleGetLicense)).Methods("GET")
+	legacyProtected.HandleFunc("/license/status", deps.authorize(PermLicenseRead, deps.handleGetLicense)).Methods("GET")
+	legacyProtected.HandleFunc("/license", deps.authorize(PermLicenseWrite, deps.handleUpdateLicense)).Methods("PUT")
 
 	// Legacy setup endpoint (for initial setup check)
 	legacyAPI.HandleFunc("/setup", deps.handleLegacySetup).Methods("GET", "POST")
@@ -147,13 +259,49 @@ func NewRouter(deps *Dependencies) *mux.Router {
 // Dependencies holds all handler dependencies
 type Dependencies struct {
 	// Services
-	LicenseService     LicenseService
-	DeviceService      DeviceService
-	DeviceGroupService DeviceGroupService
-	PolicyService      PolicyService
-	ApplicationService ApplicationService
-	AuthService        AuthService
-	GroupService       GroupService
+	LicenseService       LicenseService
+	DeviceService        DeviceService
+	DeviceGroupService   DeviceGroupService
+	PolicyService        PolicyService
+	ApplicationService   ApplicationService
+	AuthService          AuthService
+	UserService          UserService
+	GroupService         GroupService
+	CommandService       CommandService
+	LiveQueryService     LiveQueryService
+	EnrollmentService    EnrollmentService
+	ComplianceService    ComplianceService
+	AuditService         AuditService
+	BulkOperationService BulkOperationService
+
+	ApplicationRequestService ApplicationRequestService
+
+	// PackageSearchService looks up the packages applications are imported
+	// from; nil disables imports and version tracking
+	PackageSearchService PackageSearchService
+
+	// DownloadSigner signs the package download URLs handed to devices
+	DownloadSigner URLSigner
+
+	// Health probes the backends for the health endpoints
+	Health *health.Registry
+
+	// MetricsUsername and MetricsPassword protect the Prometheus metrics
+	// with HTTP basic auth when both are set
+	MetricsUsername string
+	MetricsPassword string
+
+	// RateLimits limits requests per account, device, user and client IP;
+	// nil disables rate limiting
+	RateLimits *RateLimits
+
+	// OpenAPIValidator checks /api/v1 requests against the OpenAPI document;
+	// nil disables validation
+	OpenAPIValidator *OpenAPIValidator
+
+	// Idempotency replays the responses of requests retried with the same
+	// Idempotency-Key; nil disables it
+	Idempotency *Idempotency
 	
 	// WebSocket support
 	WSHub WSHub
@@ -167,16 +315,25 @@ type LicenseService interface {
 	GetLicense() (*License, error)
 	UpdateLicense(key string) error
 	ValidateLicense() error
+	// CheckEnrollment returns ErrLicenseDeviceLimit if the license does not
+	// allow another device when enrolled devices are already managed
+	CheckEnrollment(enrolled int) error
+	SetDevicesEnrolled(enrolled int)
+	HasFeature(feature string) bool
 }
 
+// ErrLicenseDeviceLimit is returned when enrolling a device would exceed the
+// device limit of the current license
+var ErrLicenseDeviceLimit = errors.New("device enrollment limit reached for current license")
+
 type DeviceService interface {
 	ListDevices(filters DeviceFilters) ([]*Device, int, error)
 	GetDevice(id string) (*Device, error)
 	EnrollDevice(enrollment DeviceEnrollment) (*Device, error)
 	UnenrollDevice(id string) error
 	UpdateDevice(id string, updates DeviceUpdates) (*Device, error)
-	ExecuteCommand(deviceID, command string, parameters map[string]interface{}) (*DeviceCommandResult, error)
-	ExecuteOSQuery(deviceID, query string) (*OSQueryResult, error)
+	// CountDevices counts the managed devices by platform and status
+	CountDevices() ([]DeviceCount, error)
 }
 
 type DeviceGroupService interface {
@@ -189,6 +346,15 @@ type DeviceGroupService interface {
 	AddDeviceToGroup(groupID, deviceID string) error
 	RemoveDeviceFromGroup(groupID, deviceID string) error
 	GetDeviceGroups(deviceID string) ([]*DeviceGroup, error)
+	// EvaluateDeviceMembership adds a device to the dynamic groups whose
+	// filters it matches and removes it from those it no longer matches
+	EvaluateDeviceMembership(device *Device) error
+	// EvaluateGroupMembership sets the members of a dynamic group to the
+	// given devices that match its filters
+	EvaluateGroupMembership(groupID string, devices []*Device) error
+	// ExplainDeviceMembership describes how a device fares against the
+	// filters of a group
+	ExplainDeviceMembership(groupID string, device *Device) (*GroupMembershipExplanation, error)
 }
 
 type PolicyService interface {
@@ -212,17 +378,115 @@ type PolicyService interface {
 type ApplicationService interface {
 	ListApplications() ([]*Application, error)
 	GetApplication(id string) (*Application, error)
+	// AddApplication stores the package and adds the application, filling in
+	// the name, version and platform from the package when they are not given
 	AddApplication(app ApplicationCreate) (*Application, error)
+	// ImportApplication adds an application installed by a package manager
+	// from a package of the package search catalog
+	ImportApplication(imp ApplicationImport) (*Application, error)
 	UpdateApplication(id string, updates ApplicationUpdate) (*Application, error)
 	DeleteApplication(id string) error
+	// SetLatestVersion records the latest upstream version of an imported
+	// application
+	SetLatestVersion(id, version string, checkedAt time.Time) (*Application, error)
+	// OpenPackage returns the package of an application and its size; the
+	// caller closes the reader
+	OpenPackage(id string) (io.ReadCloser, int64, error)
+
+	// Self-service catalog publications
+	ListPublications() ([]*ApplicationPublication, error)
+	ListApplicationPublications(appID string) ([]*ApplicationPublication, error)
+	// PublishApplication publishes an application to the catalog of a
+	// device group, or changes whether it is restricted there
+	PublishApplication(appID, groupID string, restricted bool) (*ApplicationPublication, error)
+	UnpublishApplication(appID, groupID string) error
+}
+
+// ApplicationRequestService keeps the requests devices submit to install
+// restricted applications of their catalog, and the decisions of admins on
+// them. A request is pending until it is approved or denied.
+type ApplicationRequestService interface {
+	// CreateApplicationRequest records a pending request; it returns
+	// ErrApplicationRequestPending if the device already has one for the
+	// application
+	CreateApplicationRequest(req ApplicationRequestCreate) (*ApplicationRequest, error)
+	GetApplicationRequest(id string) (*ApplicationRequest, error)
+	// ListApplicationRequests returns the requests newest first, only those
+	// of a device when deviceID is set
+	ListApplicationRequests(deviceID string) ([]*ApplicationRequest, error)
+	// DecideApplicationRequest approves or denies a pending request; it
+	// returns ErrApplicationRequestDecided for requests already decided
+	DecideApplicationRequest(id string, decision ApplicationRequestDecision) (*ApplicationRequest, error)
+}
+
+// ErrApplicationRequestPending is returned when a device requests an
+// application it has a pending request for
+var ErrApplicationRequestPending = errors.New("application request already pending")
+
+// ErrApplicationRequestDecided is returned when deciding a request that was
+// already approved or denied
+var ErrApplicationRequestDecided = errors.New("application request already decided")
+
+// ErrInvalidApplication wraps the reasons an application or its package is rejected
+var ErrInvalidApplication = errors.New("invalid application")
+
+// PackageSearchService looks packages up in the catalog of
+// mobius-package-search
+type PackageSearchService interface {
+	// GetPackage returns a package by ID, or ErrPackageNotFound
+	GetPackage(ctx context.Context, id string) (*UpstreamPackage, error)
+}
+
+// ErrPackageNotFound is returned for packages missing from the package
+// search catalog
+var ErrPackageNotFound = errors.New("package not found")
+
+// URLSigner signs and verifies expiring download URLs
+type URLSigner interface {
+	Sign(path string, expiresAt time.Time) string
+	// Verify returns an error if the signature does not match or has expired
+	Verify(path string, expiresAt time.Time, signature string) error
 }
 
 type AuthService interface {
 	Login(email, password string) (*AuthResponse, error)
+	Refresh(refreshToken string) (*AuthResponse, error)
+	Logout(token string) error
 	ValidateToken(token string) (*User, error)
 	ValidateDeviceToken(token string) (*Device, error)
+	// IssueDeviceToken issues a new token for a device, replacing any
+	// token it held before
+	IssueDeviceToken(device *Device) (string, error)
+	RevokeDeviceToken(deviceID string) error
+}
+
+// EnrollmentService manages the secrets devices present to enroll. Secret
+// values are only returned when a secret is created or rotated.
+type EnrollmentService interface {
+	ListEnrollmentSecrets() ([]*EnrollmentSecret, error)
+	GetEnrollmentSecret(id string) (*EnrollmentSecret, error)
+	CreateEnrollmentSecret(req EnrollmentSecretCreate) (*EnrollmentSecret, error)
+	RotateEnrollmentSecret(id string) (*EnrollmentSecret, error)
+	DeleteEnrollmentSecret(id string) error
+	// ValidateEnrollmentSecret returns the unexpired secret matching value
+	ValidateEnrollmentSecret(value string) (*EnrollmentSecret, error)
+}
+
+type UserService interface {
+	ListUsers() ([]*User, error)
+	GetUser(id string) (*User, error)
+	CreateUser(user UserCreate) (*User, error)
+	UpdateUser(id string, updates UserUpdate) (*User, error)
+	DeleteUser(id string) error
+	RevokeUserSessions(id string) error
+	// VerifyPassword returns ErrInvalidPassword unless password is the
+	// user's password
+	VerifyPassword(id, password string) error
 }
 
+// ErrInvalidPassword is returned when a password does not match the user's
+var ErrInvalidPassword = errors.New("invalid password")
+
 type GroupService interface {
 	CreateGroup(group Group) error
 	GetGroups() ([]Group, error)
@@ -233,21 +497,106 @@ type GroupService interface {
 	RemoveDeviceFromGroup(groupID, deviceID string) error
 }
 
+// CommandService queues commands for devices and tracks their lifecycle:
+// pending -> delivered -> acknowledged -> completed/failed, or expired when
+// the command does not finish before its deadline
+type CommandService interface {
+	EnqueueCommand(deviceID string, req CommandCreate) (*DeviceCommand, error)
+	GetCommand(id string) (*DeviceCommand, error)
+	ListCommands(filters CommandFilters) ([]*DeviceCommand, error)
+	// FetchCommands returns the outstanding commands of a device and marks
+	// pending ones as delivered. Delivered commands that were never
+	// acknowledged are returned again.
+	FetchCommands(deviceID string) ([]*DeviceCommand, error)
+	AcknowledgeCommand(deviceID, commandID string) (*DeviceCommand, error)
+	ReportCommandResult(deviceID, commandID string, report CommandResultReport) (*DeviceCommand, error)
+	ExpireCommands() (int, error)
+	// CountCommands counts the commands in each status
+	CountCommands() (map[string]int, error)
+}
+
+// LiveQueryService distributes osquery queries to devices as campaigns.
+// Devices pick up their queries during check-in and post results back; a
+// campaign completes when every device has answered or times out.
+type LiveQueryService interface {
+	StartCampaign(req LiveQueryCreate) (*LiveQueryCampaign, error)
+	GetCampaign(id string) (*LiveQueryCampaign, error)
+	PendingQueries(deviceID string) ([]*DeviceLiveQuery, error)
+	SubmitResult(campaignID, deviceID string, report LiveQueryReport) (*LiveQueryResult, error)
+	ExpireCampaigns() (int, error)
+}
+
+// ComplianceService records the policy results devices report at check-in.
+// Consecutive identical results of a device and policy are folded into one
+// history entry; a change of status is broadcast as a compliance flip.
+type ComplianceService interface {
+	// RecordPolicyResults stores the results a device reported and returns
+	// the latest result of each reported policy
+	RecordPolicyResults(deviceID string, reports []PolicyResultReport) ([]*PolicyResult, error)
+	// GetDeviceCompliance returns the latest result of each policy a device reported on
+	GetDeviceCompliance(deviceID string) ([]*PolicyResult, error)
+	// GetPolicyResultHistory returns the results of a device for a policy, newest first
+	GetPolicyResultHistory(deviceID, policyID string) ([]*PolicyResult, error)
+	GetComplianceSummary(scope ComplianceScope) (*ComplianceSummary, error)
+}
+
+// AuditService keeps the audit trail of the actions taken through the API.
+// Entries are listed newest first and paged with opaque cursors.
+type AuditService interface {
+	// RecordAudit stores an entry, assigning its ID and timestamp when unset
+	RecordAudit(entry *AuditEntry) error
+	ListAuditEntries(filters AuditFilters) (*AuditPage, error)
+}
+
+// ErrInvalidAuditCursor is returned for cursors that were not issued by the
+// audit service
+var ErrInvalidAuditCursor = errors.New("invalid audit cursor")
+
+// BulkOperationService tracks bulk device operations. The API applies the
+// action to each device in the background and records the outcomes here.
+type BulkOperationService interface {
+	CreateBulkOperation(req BulkOperationCreate) (*BulkOperation, error)
+	GetBulkOperation(id string) (*BulkOperation, error)
+	// ListBulkOperations returns every operation without its failures,
+	// newest first
+	ListBulkOperations() ([]*BulkOperation, error)
+	// RecordBulkResult counts the outcome for a device; a non-empty errMsg
+	// is a failure
+	RecordBulkResult(id, deviceID, errMsg string) error
+	// FinishBulkOperation settles the status of a running operation from its
+	// results. Cancelled operations keep their status.
+	FinishBulkOperation(id string) (*BulkOperation, error)
+	// CancelBulkOperation stops a running operation before its remaining
+	// devices; it returns ErrBulkOperationFinished for finished ones
+	CancelBulkOperation(id string) (*BulkOperation, error)
+	// InterruptBulkOperations marks the running operations without progress
+	// since before as interrupted, returning how many it marked
+	InterruptBulkOperations(before time.Time) (int, error)
+}
+
+// ErrBulkOperationFinished is returned when cancelling a finished operation
+var ErrBulkOperationFinished = errors.New("bulk operation already finished")
+
 type WSHub interface {
 	Run(ctx context.Context)
 	BroadcastEvent(eventType string, data interface{})
 	GetClientCount() int
-	HandleWebSocket(w http.ResponseWriter, r *http.Request, userID, userRole string)
+	HandleWebSocket(w http.ResponseWriter, r *http.Request, userID, userRole string, access websocket.Access)
+	Stats() websocket.HubStats
 }
 
 // Data models
 type License struct {
-	Valid           bool       `json:"valid"`
-	Tier            string     `json:"tier"`
-	DeviceLimit     int        `json:"device_limit"`
-	DevicesEnrolled int        `json:"devices_enrolled"`
-	ExpiresAt       *time.Time `json:"expires_at,omitempty"`
-	Features        []string   `json:"features"`
+	Valid             bool       `json:"valid"`
+	Tier              string     `json:"tier"`
+	Organization      string     `json:"organization,omitempty"`
+	DeviceLimit       int        `json:"device_limit"` // -1 is unlimited
+	DevicesEnrolled   int        `json:"devices_enrolled"`
+	ExpiresAt         *time.Time `json:"expires_at,omitempty"`
+	GracePeriodEndsAt *time.Time `json:"grace_period_ends_at,omitempty"`
+	InGracePeriod     bool       `json:"in_grace_period"`
+	Features          []string   `json:"features"`
+	Warnings          []string   `json:"warnings,omitempty"`
 }
 
 type Device struct {
@@ -260,6 +609,8 @@ type Device struct {
 	Status     string            `json:"status"`
 	EnrolledAt time.Time         `json:"enrolled_at"`
 	Labels     map[string]string `json:"labels,omitempty"`
+	SystemInfo map[string]string `json:"system_info,omitempty"` // Reported at check-in
+	Revision   int               `json:"revision"`
 }
 
 type Group struct {
@@ -277,6 +628,15 @@ type DeviceFilters struct {
 	Platform string `json:"platform,omitempty"`
 	Status   string `json:"status,omitempty"`
 	Search   string `json:"search,omitempty"`
+	// DeviceIDs restricts the results to these devices when not nil
+	DeviceIDs []string `json:"-"`
+}
+
+// DeviceCount is the number of devices of a platform in a status
+type DeviceCount struct {
+	Platform string `json:"platform"`
+	Status   string `json:"status"`
+	Count    int    `json:"count"`
 }
 
 type DeviceEnrollment struct {
@@ -289,28 +649,398 @@ type DeviceEnrollment struct {
 	SerialNumber     string                 `json:"serial_number,omitempty"`
 }
 
+// EnrollmentSecret allows devices to enroll, optionally into a device group
+type EnrollmentSecret struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	GroupID   string     `json:"group_id,omitempty"`
+	Secret    string     `json:"secret,omitempty"`
+	CreatedBy string     `json:"created_by,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	RotatedAt *time.Time `json:"rotated_at,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Revision  int        `json:"revision"`
+}
+
+type EnrollmentSecretCreate struct {
+	Name      string     `json:"name"`
+	GroupID   string     `json:"group_id,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	CreatedBy string     `json:"-"`
+}
+
+// DeviceEnrollmentResponse is returned on enrollment with the token the
+// device uses to authenticate against the device API
+type DeviceEnrollmentResponse struct {
+	*Device
+	DeviceToken string `json:"device_token"`
+}
+
 type DeviceUpdates struct {
-	Hostname  *string            `json:"hostname,omitempty"`
-	OSVersion *string            `json:"os_version,omitempty"`
-	Labels    *map[string]string `json:"labels,omitempty"`
+	Hostname   *string            `json:"hostname,omitempty"`
+	OSVersion  *string            `json:"os_version,omitempty"`
+	Labels     *map[string]string `json:"labels,omitempty"`
+	SystemInfo *map[string]string `json:"system_info,omitempty"`
+	// IfRevision applies the update only to this revision, returning
+	// ErrRevisionConflict otherwise; 0 applies it to any revision
+	IfRevision int `json:"-"`
 }
 
 // Enhanced MDM types for device management
-type DeviceCommandResult struct {
-	ID         string                 `json:"id"`
+// Command statuses
+const (
+	CommandStatusPending      = "pending"
+	CommandStatusDelivered    = "delivered"
+	CommandStatusAcknowledged = "acknowledged"
+	CommandStatusCompleted    = "completed"
+	CommandStatusFailed       = "failed"
+	CommandStatusExpired      = "expired"
+)
+
+// DefaultCommandTTL is how long a command may stay unfinished before it expires
+const DefaultCommandTTL = 24 * time.Hour
+
+type DeviceCommand struct {
+	ID             string                 `json:"id"`
+	DeviceID       string                 `json:"device_id"`
+	Command        string                 `json:"command"`
+	Parameters     map[string]interface{} `json:"parameters,omitempty"`
+	Status         string                 `json:"status"` // "pending", "delivered", "acknowledged", "completed", "failed", "expired"
+	Result         map[string]interface{} `json:"result,omitempty"`
+	Error          string                 `json:"error,omitempty"`
+	CreatedBy      string                 `json:"created_by,omitempty"`
+	CreatedAt      time.Time              `json:"created_at"`
+	UpdatedAt      time.Time              `json:"updated_at"`
+	ExpiresAt      time.Time              `json:"expires_at"`
+	DeliveredAt    *time.Time             `json:"delivered_at,omitempty"`
+	AcknowledgedAt *time.Time             `json:"acknowledged_at,omitempty"`
+	CompletedAt    *time.Time             `json:"completed_at,omitempty"`
+}
+
+// IsTerminal reports whether the command can no longer change status
+func (c *DeviceCommand) IsTerminal() bool {
+	switch c.Status {
+	case CommandStatusCompleted, CommandStatusFailed, CommandStatusExpired:
+		return true
+	}
+	return false
+}
+
+type CommandCreate struct {
 	Command    string                 `json:"command"`
-	Status     string                 `json:"status"` // "pending", "running", "completed", "failed"
-	Result     map[string]interface{} `json:"result,omitempty"`
-	Error      string                 `json:"error,omitempty"`
-	ExecutedAt *time.Time             `json:"executed_at,omitempty"`
+	Parameters map[string]interface{} `json:"parameters,omitempty"`
+	TTL        time.Duration          `json:"-"`
+	CreatedBy  string                 `json:"-"`
+}
+
+type CommandFilters struct {
+	DeviceID string
+	Status   string
+	Limit    int
+}
+
+type CommandResultReport struct {
+	Status string                 `json:"status"` // "completed" or "failed"
+	Result map[string]interface{} `json:"result,omitempty"`
+	Error  string                 `json:"error,omitempty"`
+}
+
+// Live query statuses. Campaigns are running, completed or timed_out; the
+// result of each targeted device is pending, completed, failed or timed_out.
+const (
+	LiveQueryStatusRunning   = "running"
+	LiveQueryStatusPending   = "pending"
+	LiveQueryStatusCompleted = "completed"
+	LiveQueryStatusFailed    = "failed"
+	LiveQueryStatusTimedOut  = "timed_out"
+)
+
+// Live query timeouts
+const (
+	DefaultLiveQueryTimeout = 5 * time.Minute
+	MaxLiveQueryTimeout     = time.Hour
+)
+
+type LiveQueryCampaign struct {
+	ID               string             `json:"id"`
+	Query            string             `json:"query"`
+	Status           string             `json:"status"`
+	CreatedBy        string             `json:"created_by,omitempty"`
+	CreatedAt        time.Time          `json:"created_at"`
+	ExpiresAt        time.Time          `json:"expires_at"`
+	CompletedAt      *time.Time         `json:"completed_at,omitempty"`
+	DevicesTotal     int                `json:"devices_total"`
+	DevicesResponded int                `json:"devices_responded"`
+	Results          []*LiveQueryResult `json:"results"`
+}
+
+type LiveQueryResult struct {
+	DeviceID    string              `json:"device_id"`
+	Status      string              `json:"status"`
+	Rows        []map[string]string `json:"rows,omitempty"`
+	Error       string              `json:"error,omitempty"`
+	DurationMS  int64               `json:"duration_ms,omitempty"`
+	RespondedAt *time.Time          `json:"responded_at,omitempty"`
+}
+
+type LiveQueryCreate struct {
+	Query     string
+	DeviceIDs []string
+	Timeout   time.Duration
+	CreatedBy string
+}
+
+// LiveQueryTargets selects the devices of a campaign. Devices matching any
+// of the selectors are targeted; a label selector matches devices that carry
+// every listed label.
+type LiveQueryTargets struct {
+	DeviceIDs []string          `json:"device_ids,omitempty"`
+	GroupIDs  []string          `json:"group_ids,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
+// DeviceLiveQuery is a query handed to a device during check-in
+type DeviceLiveQuery struct {
+	CampaignID string `json:"campaign_id"`
+	Query      string `json:"query"`
 }
 
-type OSQueryResult struct {
-	Query    string                   `json:"query"`
-	Columns  []string                 `json:"columns"`
-	Rows     []map[string]interface{} `json:"rows"`
-	Duration int64                    `json:"duration_ms"`
-	Error    string                   `json:"error,omitempty"`
+// LiveQueryReport is the result of a live query posted by a device
+type LiveQueryReport struct {
+	Rows       []map[string]string `json:"rows"`
+	Error      string              `json:"error,omitempty"`
+	DurationMS int64               `json:"duration_ms,omitempty"`
+}
+
+// Policy result statuses reported by devices
+const (
+	PolicyResultPass  = "pass"
+	PolicyResultFail  = "fail"
+	PolicyResultError = "error"
+)
+
+// PolicyResultReport is the result of one policy reported by a device in the
+// "policies" entry of the check-in query_results
+type PolicyResultReport struct {
+	PolicyID string `json:"policy_id"`
+	Status   string `json:"status"` // "pass", "fail" or "error"
+	Message  string `json:"message,omitempty"`
+}
+
+// PolicyResult is a period during which a device reported the same result
+// for a policy
+type PolicyResult struct {
+	DeviceID        string    `json:"device_id"`
+	PolicyID        string    `json:"policy_id"`
+	Status          string    `json:"status"`
+	Message         string    `json:"message,omitempty"`
+	FirstReportedAt time.Time `json:"first_reported_at"`
+	LastReportedAt  time.Time `json:"last_reported_at"`
+	Reports         int       `json:"reports"`
+}
+
+// ComplianceScope restricts a compliance summary to one policy and to a set
+// of devices. A nil DeviceIDs covers every device.
+type ComplianceScope struct {
+	PolicyID  string
+	DeviceIDs []string
+}
+
+// ComplianceSummary counts the latest policy results of the devices in scope
+type ComplianceSummary struct {
+	Devices        int                      `json:"devices"`         // Devices with at least one result
+	Compliant      int                      `json:"compliant"`       // Devices passing every policy
+	NonCompliant   int                      `json:"non_compliant"`   // Devices failing at least one policy
+	Errored        int                      `json:"errored"`         // Devices with errors but no failures
+	ComplianceRate float64                  `json:"compliance_rate"` // Compliant devices / devices
+	Policies       []PolicyComplianceCounts `json:"policies"`
+}
+
+// PolicyComplianceCounts counts the latest results of one policy
+type PolicyComplianceCounts struct {
+	PolicyID string `json:"policy_id"`
+	Pass     int    `json:"pass"`
+	Fail     int    `json:"fail"`
+	Error    int    `json:"error"`
+}
+
+// Audit actor types
+const (
+	AuditActorUser      = "user"
+	AuditActorDevice    = "device"
+	AuditActorAnonymous = "anonymous"
+)
+
+// Audit outcomes
+const (
+	AuditOutcomeSuccess = "success"
+	AuditOutcomeFailure = "failure"
+	AuditOutcomeDenied  = "denied"
+)
+
+// AuditEntry records who did what to which resource, and how it changed
+type AuditEntry struct {
+	ID         string                 `json:"id"`
+	Timestamp  time.Time              `json:"timestamp"`
+	Actor      AuditActor             `json:"actor"`
+	Action     string                 `json:"action"` // e.g. "policy.update", "device.wipe"
+	TargetType string                 `json:"target_type,omitempty"`
+	TargetID   string                 `json:"target_id,omitempty"`
+	Outcome    string                 `json:"outcome"` // "success", "failure" or "denied"
+	Reason     string                 `json:"reason,omitempty"`
+	Request    AuditRequest           `json:"request"`
+	Changes    []AuditChange          `json:"changes,omitempty"`
+	Details    map[string]interface{} `json:"details,omitempty"`
+}
+
+// AuditActor is the user or device that acted. Failed logins have an
+// anonymous actor with the email that was tried.
+type AuditActor struct {
+	Type  string `json:"type"` // "user", "device" or "anonymous"
+	ID    string `json:"id,omitempty"`
+	Email string `json:"email,omitempty"`
+	Role  string `json:"role,omitempty"`
+}
+
+// AuditRequest is the HTTP request an audited action came from
+type AuditRequest struct {
+	Method    string `json:"method"`
+	Path      string `json:"path"`
+	ClientIP  string `json:"client_ip"`
+	UserAgent string `json:"user_agent,omitempty"`
+}
+
+// AuditChange is a top-level field of a resource that an action changed.
+// Before is unset for created fields and After for removed ones.
+type AuditChange struct {
+	Field  string      `json:"field"`
+	Before interface{} `json:"before,omitempty"`
+	After  interface{} `json:"after,omitempty"`
+}
+
+// AuditFilters selects audit entries; empty fields match every entry
+type AuditFilters struct {
+	ActorID    string
+	ActorType  string
+	Action     string // An exact action, or a prefix ending with "." such as "policy."
+	TargetType string
+	TargetID   string
+	Outcome    string
+	Since      *time.Time // Inclusive
+	Until      *time.Time // Exclusive
+	Cursor     string     // NextCursor of the previous page
+	Limit      int
+}
+
+// AuditPage is a page of audit entries, newest first. NextCursor is empty on
+// the last page.
+type AuditPage struct {
+	Entries    []*AuditEntry `json:"entries"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+}
+
+// Bulk operation statuses. An operation runs until every device has been
+// processed, then completes, partially fails or fails depending on the
+// outcomes, unless it is cancelled first. Operations left running by a
+// server that stopped are interrupted.
+const (
+	BulkStatusRunning         = "running"
+	BulkStatusCompleted       = "completed"
+	BulkStatusPartiallyFailed = "partially_failed"
+	BulkStatusFailed          = "failed"
+	BulkStatusCancelled       = "cancelled"
+	BulkStatusInterrupted     = "interrupted"
+)
+
+// Bulk actions
+const (
+	BulkActionCommand        = "command"
+	BulkActionAssignPolicy   = "assign_policy"
+	BulkActionUnassignPolicy = "unassign_policy"
+	BulkActionUpdateLabels   = "update_labels"
+	BulkActionMoveToGroup    = "move_to_group"
+	BulkActionUnenroll       = "unenroll"
+)
+
+// MaxBulkDevices bounds the devices a bulk operation may select
+const MaxBulkDevices = 10000
+
+// BulkOperationStaleAfter is how long a running operation may go without
+// progress before it is considered orphaned by a server that stopped
+const BulkOperationStaleAfter = 5 * time.Minute
+
+// DeviceSelector selects the devices of a bulk operation. Devices listed,
+// in one of the groups or carrying every label are selected; without any of
+// those every device is. Search and Filters, which take the filters of the
+// device list such as "platform[in]", then narrow the selection.
+type DeviceSelector struct {
+	DeviceIDs []string          `json:"device_ids,omitempty"`
+	GroupIDs  []string          `json:"group_ids,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Search    string            `json:"search,omitempty"`
+	Filters   map[string]string `json:"filters,omitempty"`
+}
+
+// BulkAction is the action a bulk operation applies to each device
+type BulkAction struct {
+	Type string `json:"type"`
+	// command
+	Command    string                 `json:"command,omitempty"`
+	Parameters map[string]interface{} `json:"parameters,omitempty"`
+	ExpiresIn  int                    `json:"expires_in,omitempty"` // seconds
+	// assign_policy and unassign_policy
+	PolicyID string `json:"policy_id,omitempty"`
+	// update_labels sets Labels and removes RemoveLabels
+	Labels       map[string]string `json:"labels,omitempty"`
+	RemoveLabels []string          `json:"remove_labels,omitempty"`
+	// move_to_group adds devices to GroupID and removes them from
+	// FromGroupIDs, or from every other manual group when empty
+	GroupID      string   `json:"group_id,omitempty"`
+	FromGroupIDs []string `json:"from_group_ids,omitempty"`
+}
+
+type BulkOperationRequest struct {
+	Selector DeviceSelector `json:"selector"`
+	Action   BulkAction     `json:"action"`
+	// DryRun previews the selected devices without changing anything
+	DryRun bool `json:"dry_run,omitempty"`
+}
+
+// BulkOperationPreview is the response to a dry run
+type BulkOperationPreview struct {
+	DryRun  bool       `json:"dry_run"`
+	Action  BulkAction `json:"action"`
+	Total   int        `json:"total"`
+	Devices []*Device  `json:"devices"`
+}
+
+type BulkOperationCreate struct {
+	Action    BulkAction
+	Selector  DeviceSelector
+	Total     int
+	CreatedBy string
+}
+
+type BulkOperation struct {
+	ID         string         `json:"id"`
+	Status     string         `json:"status"`
+	Action     BulkAction     `json:"action"`
+	Selector   DeviceSelector `json:"selector"`
+	CreatedBy  string         `json:"created_by,omitempty"`
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+	FinishedAt *time.Time     `json:"finished_at,omitempty"`
+	Total      int            `json:"total"`
+	Processed  int            `json:"processed"`
+	Succeeded  int            `json:"succeeded"`
+	Failed     int            `json:"failed"`
+	Failures   []BulkFailure  `json:"failures,omitempty"`
+}
+
+// BulkFailure is a device a bulk operation failed on
+type BulkFailure struct {
+	DeviceID string `json:"device_id"`
+	Error    string `json:"error"`
 }
 
 type Policy struct {
@@ -322,6 +1052,7 @@ type Policy struct {
 	Configuration map[string]interface{} `json:"configuration"`
 	CreatedAt     time.Time              `json:"created_at"`
 	UpdatedAt     time.Time              `json:"updated_at"`
+	Revision      int                    `json:"revision"`
 }
 
 type PolicyCreate struct {
@@ -336,43 +1067,212 @@ type PolicyUpdate struct {
 	Description   *string                 `json:"description,omitempty"`
 	Enabled       *bool                   `json:"enabled,omitempty"`
 	Configuration *map[string]interface{} `json:"configuration,omitempty"`
+	IfRevision    int                     `json:"-"`
 }
 
 type Application struct {
-	ID        string    `json:"id"`
-	Name      string    `json:"name"`
-	Version   string    `json:"version"`
-	Platform  string    `json:"platform"`
-	Size      int64     `json:"size"`
-	Checksum  string    `json:"checksum"`
-	CreatedAt time.Time `json:"created_at"`
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Version     string    `json:"version"`
+	Platform    string    `json:"platform"`
+	BundleID    string    `json:"bundle_id,omitempty"`
+	PackageType string    `json:"package_type,omitempty"` // deb, rpm, msi, exe, pkg or tar.gz
+	Filename    string    `json:"filename,omitempty"`
+	Size        int64     `json:"size"`
+	Checksum    string    `json:"checksum"` // SHA-256 of the package
+	CreatedAt   time.Time `json:"created_at"`
+	Revision    int       `json:"revision"` // Unrelated to Version, the version of the package
+
+	// Source is set for applications imported from the package search
+	// catalog, which devices install with their package manager instead
+	// of downloading a package
+	Source           *ApplicationSource `json:"source,omitempty"`
+	InstallCommand   string             `json:"install_command,omitempty"`
+	UninstallCommand string             `json:"uninstall_command,omitempty"`
+	// DetectionQuery is an osquery query returning a row when the
+	// application is installed
+	DetectionQuery string `json:"detection_query,omitempty"`
+	// LatestVersion is the upstream version of an imported application
+	// when it was last checked; UpdateAvailable is set when it is newer
+	// than Version
+	LatestVersion          string     `json:"latest_version,omitempty"`
+	LatestVersionCheckedAt *time.Time `json:"latest_version_checked_at,omitempty"`
+	UpdateAvailable        bool       `json:"update_available,omitempty"`
+}
+
+// ApplicationSource is the package of the package search catalog an
+// application was imported from
+type ApplicationSource struct {
+	// PackageID is the ID of the package in the catalog, such as
+	// winget:Mozilla.Firefox
+	PackageID string `json:"package_id"`
+	// Manager is the package manager installing it: apt, flatpak, brew or
+	// winget
+	Manager    string `json:"manager"`
+	Identifier string `json:"identifier"`
+	// Remote is the flatpak remote of the application
+	Remote string `json:"remote,omitempty"`
+	// Cask is set for Homebrew casks
+	Cask bool `json:"cask,omitempty"`
+}
+
+// UpstreamPackage is a package of the package search catalog
+type UpstreamPackage struct {
+	ID          string          `json:"id"`
+	Source      string          `json:"source"`
+	Name        string          `json:"name"`
+	Version     string          `json:"version"`
+	Publisher   string          `json:"publisher,omitempty"`
+	Description string          `json:"description,omitempty"`
+	Homepage    string          `json:"homepage,omitempty"`
+	Platforms   []string        `json:"platforms"`
+	Install     UpstreamInstall `json:"install"`
+}
+
+// UpstreamInstall identifies a package of the package search catalog to
+// its package manager
+type UpstreamInstall struct {
+	Manager    string `json:"manager"`
+	Identifier string `json:"identifier"`
+	Remote     string `json:"remote,omitempty"`
+	Cask       bool   `json:"cask,omitempty"`
+}
+
+// ApplicationImport imports a package of the package search catalog as an
+// application
+type ApplicationImport struct {
+	Package *UpstreamPackage
+	// Platform selects the platform of packages of several; optional
+	// otherwise
+	Platform string
+	// Name overrides the name of the package, if set
+	Name string
+}
+
+// ApplicationImportRequest is the body of POST /applications/import
+type ApplicationImportRequest struct {
+	PackageID string `json:"package_id"`
+	Platform  string `json:"platform,omitempty"`
+	Name      string `json:"name,omitempty"`
 }
 
 type ApplicationCreate struct {
-	Name     string `json:"name"`
-	Version  string `json:"version"`
-	Platform string `json:"platform"`
-	Package  []byte `json:"-"` // Binary data
+	Name     string    `json:"name"`
+	Version  string    `json:"version"`
+	Platform string    `json:"platform"`
+	Filename string    `json:"filename"`
+	Package  io.Reader `json:"-"` // Package contents, read once
+}
+
+// DeviceApplication is an application offered to a device with a signed,
+// expiring URL to download its package
+type DeviceApplication struct {
+	*Application
+	// DownloadURL is not set for imported applications, which have no
+	// package
+	DownloadURL       string     `json:"download_url,omitempty"`
+	DownloadExpiresAt *time.Time `json:"download_expires_at,omitempty"`
+	// SelfService marks applications of the self-service catalog, which
+	// are installed on request rather than on sync
+	SelfService bool `json:"self_service,omitempty"`
 }
 
 type ApplicationUpdate struct {
-	Name    *string `json:"name,omitempty"`
-	Version *string `json:"version,omitempty"`
+	Name       *string `json:"name,omitempty"`
+	Version    *string `json:"version,omitempty"`
+	IfRevision int     `json:"-"`
+}
+
+// ApplicationPublication makes an application available in the self-service
+// catalog of the devices of a group. Devices install restricted
+// applications only once an admin approved their request.
+type ApplicationPublication struct {
+	ApplicationID string    `json:"application_id"`
+	GroupID       string    `json:"group_id"`
+	Restricted    bool      `json:"restricted"`
+	PublishedAt   time.Time `json:"published_at"`
+}
+
+// Application request statuses
+const (
+	AppRequestStatusPending  = "pending"
+	AppRequestStatusApproved = "approved"
+	AppRequestStatusDenied   = "denied"
+)
+
+// ApplicationRequest is the request of a device to install a restricted
+// application of its catalog
+type ApplicationRequest struct {
+	ID            string `json:"id"`
+	ApplicationID string `json:"application_id"`
+	DeviceID      string `json:"device_id"`
+	Status        string `json:"status"` // "pending", "approved" or "denied"
+	Reason        string `json:"reason,omitempty"`
+	// DecidedBy is the user who approved or denied the request, with an
+	// optional note for the device user
+	DecidedBy    string `json:"decided_by,omitempty"`
+	DecisionNote string `json:"decision_note,omitempty"`
+	// CommandID is the install command queued when the request was approved
+	CommandID string     `json:"command_id,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	DecidedAt *time.Time `json:"decided_at,omitempty"`
+}
+
+type ApplicationRequestCreate struct {
+	ApplicationID string
+	DeviceID      string
+	Reason        string
+}
+
+// ApplicationRequestDecision approves or denies a request
+type ApplicationRequestDecision struct {
+	Status    string // "approved" or "denied"
+	DecidedBy string
+	Note      string
+	CommandID string
 }
 
 type User struct {
-	ID        string    `json:"id"`
-	Email     string    `json:"email"`
-	Name      string    `json:"name"`
-	Role      string    `json:"role"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID    string `json:"id"`
+	Email string `json:"email"`
+	Name  string `json:"name"`
+	Role  string `json:"role"`
+	// DeviceGroupIDs limits the user to the devices of these groups; empty
+	// means every device
+	DeviceGroupIDs []string  `json:"device_group_ids,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+	Revision       int       `json:"revision"`
+	// MustChangePassword limits the user to changing their password, which
+	// clears it; the bootstrap admin starts with it
+	MustChangePassword bool `json:"must_change_password,omitempty"`
+}
+
+type UserCreate struct {
+	Email          string   `json:"email"`
+	Name           string   `json:"name"`
+	Role           string   `json:"role"`
+	DeviceGroupIDs []string `json:"device_group_ids,omitempty"`
+	Password       string   `json:"password"`
+}
+
+type UserUpdate struct {
+	Name           *string   `json:"name,omitempty"`
+	Role           *string   `json:"role,omitempty"`
+	DeviceGroupIDs *[]string `json:"device_group_ids,omitempty"`
+	Password       *string   `json:"password,omitempty"`
+	// CurrentPassword must accompany a change of the caller's own password;
+	// the API checks it before updating the user
+	CurrentPassword *string `json:"current_password,omitempty"`
+	IfRevision      int     `json:"-"`
 }
 
 type AuthResponse struct {
-	Token     string    `json:"token"`
-	ExpiresAt time.Time `json:"expires_at"`
-	User      *User     `json:"user"`
+	Token            string    `json:"token"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	RefreshToken     string    `json:"refresh_token,omitempty"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at,omitempty"`
+	User             *User     `json:"user"`
 }
 
 type APIError struct {
@@ -392,6 +1292,7 @@ type DeviceGroup struct {
 	Labels      map[string]string `json:"labels,omitempty"`      // Group metadata
 	CreatedAt   time.Time         `json:"created_at"`
 	UpdatedAt   time.Time         `json:"updated_at"`
+	Revision    int               `json:"revision"`
 }
 
 type DeviceGroupCreate struct {
@@ -406,11 +1307,45 @@ type DeviceGroupUpdate struct {
 	Description *string            `json:"description,omitempty"`
 	Filters     *map[string]string `json:"filters,omitempty"`
 	Labels      *map[string]string `json:"labels,omitempty"`
+	IfRevision  int                `json:"-"`
+}
+
+// GroupMembershipExplanation describes why a device does or does not match
+// the filters of a device group
+type GroupMembershipExplanation struct {
+	GroupID  string             `json:"group_id"`
+	DeviceID string             `json:"device_id"`
+	Dynamic  bool               `json:"dynamic"` // Membership is managed by filters
+	Member   bool               `json:"member"`  // Device is currently in the group
+	Matched  bool               `json:"matched"` // Device matches every filter rule
+	Rules    []FilterRuleResult `json:"rules"`
+}
+
+// FilterRuleResult is the outcome of one named filter rule
+type FilterRuleResult struct {
+	Name       string                  `json:"name"`
+	Expression string                  `json:"expression"`
+	Matched    bool                    `json:"matched"`
+	Error      string                  `json:"error,omitempty"`
+	Conditions []FilterConditionResult `json:"conditions,omitempty"`
+}
+
+// FilterConditionResult is the outcome of one condition of a filter rule
+type FilterConditionResult struct {
+	Field    string   `json:"field"`
+	Operator string   `json:"operator"`
+	Values   []string `json:"values,omitempty"`
+	Actual   string   `json:"actual"`
+	Present  bool     `json:"present"`
+	Matched  bool     `json:"matched"`
 }
 
 // Utility functions
 func WriteJSON(w http.ResponseWriter, status int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
+	if resource, ok := data.(revisioned); ok && status < http.StatusMultipleChoices {
+		w.Header().Set("ETag", resource.ETag())
+	}
 	w.WriteHeader(status)
 	if err := json.NewEncoder(w).Encode(data); err != nil {
 		log.Error().Err(err).Msg("Failed to encode JSON response")
@@ -428,16 +1363,14 @@ func WriteError(w http.ResponseWriter, status int, message string) {
 // handleWebSocket handles WebSocket connection requests
 func (d *Dependencies) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	// Extract user info from the auth middleware context
-	userID := r.Header.Get("X-User-ID")
-	userRole := r.Header.Get("X-User-Role")
-	
-	if userID == "" {
+	user, err := GetUserFromContext(r)
+	if err != nil {
 		WriteError(w, http.StatusUnauthorized, "User not authenticated")
 		return
 	}
-	
+
 	if d.WSHub != nil {
-		d.WSHub.HandleWebSocket(w, r, userID, userRole)
+		d.WSHub.HandleWebSocket(w, r, user.ID, user.Role, &eventAccess{deps: d, user: user})
 	} else {
 		WriteError(w, http.StatusServiceUnavailable, "WebSocket service not available")
 	}
@@ -0,0 +1,305 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog/log"
+)
+
+// User Management Handlers
+
+// handleListUsers lists all users
+func (d *Dependencies) handleListUsers(w http.ResponseWriter, r *http.Request) {
+	q, ok := readListQuery(w, r, userListSpec)
+	if !ok {
+		return
+	}
+
+	var query func(*ListQuery) ([]*User, int, error)
+	if querier, ok := d.UserService.(UserQuerier); ok {
+		query = querier.QueryUsers
+	}
+	result, err := listItems(q, userListSpec, query, d.UserService.ListUsers)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list users")
+		WriteError(w, http.StatusInternalServerError, "Failed to list users")
+		return
+	}
+
+	writeList(w, "users", result)
+}
+
+// handleCreateUser creates a new user account
+func (d *Dependencies) handleCreateUser(w http.ResponseWriter, r *http.Request) {
+	user, err := GetUserFromContext(r)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, "User context required")
+		return
+	}
+
+	var req UserCreate
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.Email == "" || req.Password == "" {
+		WriteError(w, http.StatusBadRequest, "Email and password are required")
+		return
+	}
+	if !d.validDeviceGroups(w, req.DeviceGroupIDs) {
+		return
+	}
+
+	created, err := d.UserService.CreateUser(req)
+	if err != nil {
+		log.Debug().
+			Err(err).
+			Str("email", req.Email).
+			Str("user_id", user.ID).
+			Msg("Failed to create user")
+		WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	log.Info().
+		Str("created_user_id", created.ID).
+		Str("role", created.Role).
+		Str("user_id", user.ID).
+		Msg("User created")
+
+	d.audit(r, auditRecord{Action: "user.create", TargetType: "user", TargetID: created.ID, After: created})
+
+	WriteJSON(w, http.StatusCreated, created)
+}
+
+// handleGetUser retrieves a user; reading other accounts requires the
+// users:read permission
+func (d *Dependencies) handleGetUser(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["userId"]
+
+	if _, ok := d.requireSelfOrPermission(w, r, userID, PermUsersRead); !ok {
+		return
+	}
+
+	user, err := d.UserService.GetUser(userID)
+	if err != nil {
+		WriteError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, user)
+}
+
+// handleUpdateUser updates a user; without the users:write permission users
+// may only change their own name and password. Users changing their own
+// password must give their current one, and the last admin keeps its role.
+func (d *Dependencies) handleUpdateUser(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["userId"]
+
+	caller, ok := d.requireSelfOrPermission(w, r, userID, PermUsersWrite)
+	if !ok {
+		return
+	}
+
+	var updates UserUpdate
+	if err := json.NewDecoder(r.Body).Decode(&updates); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if updates.Role != nil || updates.DeviceGroupIDs != nil {
+		if _, ok := d.requirePermission(w, r, PermUsersWrite); !ok {
+			return
+		}
+	}
+	if updates.DeviceGroupIDs != nil && !d.validDeviceGroups(w, *updates.DeviceGroupIDs) {
+		return
+	}
+
+	before, err := d.UserService.GetUser(userID)
+	if err != nil {
+		WriteError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	rev, ok := checkIfMatch(w, r, before.Revision)
+	if !ok {
+		return
+	}
+	updates.IfRevision = rev
+
+	// A stolen session must not be enough to take over the account
+	if updates.Password != nil && userID == caller.ID {
+		if updates.CurrentPassword == nil || *updates.CurrentPassword == "" {
+			WriteError(w, http.StatusBadRequest, "Current password is required to change your password")
+			return
+		}
+		err := d.UserService.VerifyPassword(userID, *updates.CurrentPassword)
+		if errors.Is(err, ErrInvalidPassword) {
+			WriteError(w, http.StatusForbidden, "Current password is incorrect")
+			return
+		}
+		if err != nil {
+			log.Error().Err(err).Str("user_id", caller.ID).Msg("Failed to verify password")
+			WriteError(w, http.StatusInternalServerError, "Failed to update user")
+			return
+		}
+	}
+
+	if updates.Role != nil && *updates.Role != RoleAdmin && before.Role == RoleAdmin {
+		last, err := d.isLastAdmin(userID)
+		if err != nil {
+			log.Error().Err(err).Str("target_user_id", userID).Msg("Failed to count admins")
+			WriteError(w, http.StatusInternalServerError, "Failed to update user")
+			return
+		}
+		if last {
+			WriteError(w, http.StatusConflict, "Cannot change the role of the last admin")
+			return
+		}
+	}
+
+	updated, err := d.UserService.UpdateUser(userID, updates)
+	if errors.Is(err, ErrRevisionConflict) {
+		writeRevisionConflict(w)
+		return
+	}
+	if err != nil {
+		log.Debug().
+			Err(err).
+			Str("target_user_id", userID).
+			Str("user_id", caller.ID).
+			Msg("Failed to update user")
+		WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	log.Info().
+		Str("target_user_id", userID).
+		Str("user_id", caller.ID).
+		Msg("User updated")
+
+	rec := auditRecord{Action: "user.update", TargetType: "user", TargetID: userID, Before: before, After: updated}
+	if updates.Password != nil {
+		// Users carry no password; record that it changed without its value
+		rec.Changes = []AuditChange{{Field: "password", Before: auditRedacted, After: auditRedacted}}
+	}
+	d.audit(r, rec)
+
+	WriteJSON(w, http.StatusOK, updated)
+}
+
+// handleDeleteUser deletes a user account and revokes its sessions
+func (d *Dependencies) handleDeleteUser(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["userId"]
+
+	user, err := GetUserFromContext(r)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, "User context required")
+		return
+	}
+
+	if userID == user.ID {
+		WriteError(w, http.StatusBadRequest, "Cannot delete your own account")
+		return
+	}
+
+	before, err := d.UserService.GetUser(userID)
+	if err != nil {
+		log.Debug().Err(err).Str("target_user_id", userID).Msg("User not found for deletion")
+		WriteError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if _, ok := checkIfMatch(w, r, before.Revision); !ok {
+		return
+	}
+
+	if err := d.UserService.DeleteUser(userID); err != nil {
+		log.Debug().Err(err).Str("target_user_id", userID).Msg("User not found for deletion")
+		WriteError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	log.Info().
+		Str("target_user_id", userID).
+		Str("user_id", user.ID).
+		Msg("User deleted")
+
+	d.audit(r, auditRecord{Action: "user.delete", TargetType: "user", TargetID: userID, Before: before})
+
+	WriteJSON(w, http.StatusOK, map[string]string{
+		"message": "User deleted successfully",
+	})
+}
+
+// handleRevokeUserSessions revokes every session of a user
+func (d *Dependencies) handleRevokeUserSessions(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["userId"]
+
+	user, err := GetUserFromContext(r)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, "User context required")
+		return
+	}
+
+	if err := d.UserService.RevokeUserSessions(userID); err != nil {
+		log.Debug().Err(err).Str("target_user_id", userID).Msg("User not found for session revocation")
+		WriteError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	log.Info().
+		Str("target_user_id", userID).
+		Str("user_id", user.ID).
+		Msg("User sessions revoked")
+
+	d.audit(r, auditRecord{Action: "user.revoke_sessions", TargetType: "user", TargetID: userID})
+
+	WriteJSON(w, http.StatusOK, map[string]string{
+		"message": "User sessions revoked successfully",
+	})
+}
+
+// requireSelfOrPermission writes an error response unless the caller is
+// acting on their own account or their role grants perm
+func (d *Dependencies) requireSelfOrPermission(w http.ResponseWriter, r *http.Request, userID string, perm Permission) (*User, bool) {
+	user, err := GetUserFromContext(r)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, "User context required")
+		return nil, false
+	}
+
+	if user.ID == userID {
+		return user, true
+	}
+	return d.requirePermission(w, r, perm)
+}
+
+// isLastAdmin reports whether no user other than userID is an admin
+func (d *Dependencies) isLastAdmin(userID string) (bool, error) {
+	users, err := d.UserService.ListUsers()
+	if err != nil {
+		return false, err
+	}
+	for _, user := range users {
+		if user.ID != userID && user.Role == RoleAdmin {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// validDeviceGroups writes an error response unless every group exists
+func (d *Dependencies) validDeviceGroups(w http.ResponseWriter, groupIDs []string) bool {
+	for _, groupID := range groupIDs {
+		if _, err := d.DeviceGroupService.GetDeviceGroup(groupID); err != nil {
+			WriteError(w, http.StatusBadRequest, fmt.Sprintf("Device group %s not found", groupID))
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,97 @@
+package api_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/notawar/mobius/mobius-server/api"
+)
+
+func TestUpdateOwnPassword(t *testing.T) {
+	server := newTestServer(t)
+	user, token := server.createUser(t, api.RoleObserver)
+	path := "/users/" + user.ID
+
+	for _, tc := range []struct {
+		name   string
+		body   map[string]string
+		status int
+	}{
+		{"without the current password", map[string]string{"password": "new-password-123"}, http.StatusBadRequest},
+		{"with a wrong current password", map[string]string{"password": "new-password-123", "current_password": "wrong-password-1"}, http.StatusForbidden},
+		{"with the current password", map[string]string{"password": "new-password-123", "current_password": testPassword}, http.StatusOK},
+	} {
+		resp := server.do(t, "PUT", path, token, tc.body)
+		if resp.StatusCode != tc.status {
+			t.Errorf("%s: expected status %d, got %d", tc.name, tc.status, resp.StatusCode)
+		}
+	}
+
+	if _, err := server.deps.AuthService.Login(user.Email, "new-password-123"); err != nil {
+		t.Errorf("expected the new password to be set, got %v", err)
+	}
+
+	// Admins reset the passwords of others without knowing them
+	_, admin := server.createUser(t, api.RoleAdmin)
+	decode(t, server.do(t, "PUT", path, admin, map[string]string{"password": "reset-password-123"}), http.StatusOK, nil)
+}
+
+func TestUpdateLastAdmin(t *testing.T) {
+	server := newTestServer(t)
+	admin, token := server.createUser(t, api.RoleAdmin)
+	observer := api.RoleObserver
+
+	// The migrations seed a bootstrap admin; demoting it leaves the new one
+	decode(t, server.do(t, "PUT", "/users/admin-1", token, api.UserUpdate{Role: &observer}), http.StatusOK, nil)
+
+	resp := server.do(t, "PUT", "/users/"+admin.ID, token, api.UserUpdate{Role: &observer})
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("expected demoting the last admin to conflict, got %d", resp.StatusCode)
+	}
+
+	name := "Still admin"
+	decode(t, server.do(t, "PUT", "/users/"+admin.ID, token, api.UserUpdate{Name: &name}), http.StatusOK, nil)
+	if got, _ := server.deps.UserService.GetUser(admin.ID); got.Role != api.RoleAdmin {
+		t.Errorf("expected the last admin to keep its role, got %s", got.Role)
+	}
+}
+
+func TestMustChangePassword(t *testing.T) {
+	server := newTestServer(t)
+
+	// The migrations seed the bootstrap admin with the default password
+	auth, err := server.deps.AuthService.Login("admin@mobius.local", "admin123")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !auth.User.MustChangePassword {
+		t.Fatalf("expected the bootstrap admin to have to change its password")
+	}
+
+	for _, route := range [][2]string{{"GET", "/devices"}, {"GET", "/users"}, {"DELETE", "/users/admin-1/sessions"}} {
+		if resp := server.do(t, route[0], route[1], auth.Token, nil); resp.StatusCode != http.StatusForbidden {
+			t.Errorf("%s %s: expected status 403, got %d", route[0], route[1], resp.StatusCode)
+		}
+	}
+
+	var user api.User
+	decode(t, server.do(t, "GET", "/users/admin-1", auth.Token, nil), http.StatusOK, &user)
+	if !user.MustChangePassword {
+		t.Errorf("expected must_change_password in the account")
+	}
+	var updated api.User
+	decode(t, server.do(t, "PUT", "/users/admin-1", auth.Token, map[string]string{
+		"current_password": "admin123",
+		"password":         "new-admin-password-1",
+	}), http.StatusOK, &updated)
+	if updated.MustChangePassword {
+		t.Errorf("expected changing the password to clear must_change_password")
+	}
+
+	// Changing the password ends the session it was changed with
+	auth, err = server.deps.AuthService.Login("admin@mobius.local", "new-admin-password-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	decode(t, server.do(t, "GET", "/devices", auth.Token, nil), http.StatusOK, nil)
+}
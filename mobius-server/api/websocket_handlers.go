@@ -30,7 +30,7 @@ func (h *WebSocketHandler) HandleConnection(w http.ResponseWriter, r *http.Reque
 	}
 
 	// Upgrade the connection to WebSocket
-	h.hub.HandleWebSocket(w, r, userID, userRole)
+	h.hub.HandleWebSocket(w, r, userID, userRole, nil)
 }
 
 // HandleStatus returns WebSocket connection status
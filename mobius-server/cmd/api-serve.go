@@ -13,7 +13,9 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/notawar/mobius/mobius-server/api"
+	"github.com/notawar/mobius/mobius-server/pkg/blobstore"
 	"github.com/notawar/mobius/mobius-server/pkg/service"
+	"github.com/notawar/mobius/mobius-server/server/health"
 )
 
 // simpleServeCmd represents a simplified serve command for the new API
@@ -32,6 +34,13 @@ func init() {
 	// Server configuration flags
 	simpleServeCmd.Flags().String("addr", ":8081", "Address to bind the API server to")
 	simpleServeCmd.Flags().Bool("dev-mode", false, "Enable development mode")
+	simpleServeCmd.Flags().String("license-key", os.Getenv("MOBIUS_LICENSE_KEY"), "Signed license key")
+	simpleServeCmd.Flags().String("package-dir", "packages", "Directory to store application packages in")
+	simpleServeCmd.Flags().String("download-key", os.Getenv("MOBIUS_DOWNLOAD_KEY"), "Key used to sign package download URLs")
+	simpleServeCmd.Flags().String("package-search-url", os.Getenv("MOBIUS_PACKAGE_SEARCH_URL"), "URL of mobius-package-search, to import applications from its packages")
+	simpleServeCmd.Flags().String("metrics-username", os.Getenv("MOBIUS_PROMETHEUS_BASIC_AUTH_USERNAME"), "HTTP basic auth username for /api/v1/metrics")
+	simpleServeCmd.Flags().String("metrics-password", os.Getenv("MOBIUS_PROMETHEUS_BASIC_AUTH_PASSWORD"), "HTTP basic auth password for /api/v1/metrics")
+	simpleServeCmd.Flags().Bool("openapi-validation", os.Getenv("MOBIUS_OPENAPI_VALIDATION") != "false", "Reject /api/v1 requests that do not match the OpenAPI document")
 }
 
 func runSimpleServe(cmd *cobra.Command, args []string) error {
@@ -51,18 +60,75 @@ func runSimpleServe(cmd *cobra.Command, args []string) error {
 
 	// Initialize services
 	licenseService := service.NewLicenseService()
+	if key, _ := cmd.Flags().GetString("license-key"); key != "" {
+		if err := licenseService.UpdateLicense(key); err != nil {
+			log.Error().Err(err).Msg("Failed to load license key, using the community license")
+		}
+	}
 	deviceService := service.NewDeviceService()
+	deviceService.SetLicenseService(licenseService)
 	policyService := service.NewPolicyService()
 	authService := service.NewAuthService()
-	applicationService := service.NewApplicationService()
+	packageDir, _ := cmd.Flags().GetString("package-dir")
+	packages, err := blobstore.NewFileStore(packageDir)
+	if err != nil {
+		return err
+	}
+	applicationService := service.NewApplicationService(packages)
+	downloadKey, _ := cmd.Flags().GetString("download-key")
+	downloadSigner, err := service.NewURLSigner([]byte(downloadKey))
+	if err != nil {
+		return err
+	}
+	commandService := service.NewCommandService(deviceService)
+	liveQueryService := service.NewLiveQueryService()
+	metricsUsername, _ := cmd.Flags().GetString("metrics-username")
+	metricsPassword, _ := cmd.Flags().GetString("metrics-password")
+
+	var openAPIValidator *api.OpenAPIValidator
+	if validate, _ := cmd.Flags().GetBool("openapi-validation"); validate {
+		spec, err := api.LoadOpenAPISpec()
+		if err != nil {
+			return err
+		}
+		openAPIValidator = api.NewOpenAPIValidator(spec)
+	}
+
+	probes := health.NewRegistry()
+	probes.Register(health.Probe{Name: "blob_store", Checker: health.CheckerFunc(packages.HealthCheckContext), Optional: true})
 
 	// Create dependencies
 	deps := &api.Dependencies{
-		LicenseService:     licenseService,
-		DeviceService:      deviceService,
-		PolicyService:      policyService,
-		ApplicationService: applicationService,
-		AuthService:        authService,
+		LicenseService:            licenseService,
+		DeviceService:             deviceService,
+		DeviceGroupService:        service.NewDeviceGroupService(),
+		PolicyService:             policyService,
+		ApplicationService:        applicationService,
+		AuthService:               authService,
+		UserService:               authService,
+		CommandService:            commandService,
+		LiveQueryService:          liveQueryService,
+		EnrollmentService:         service.NewEnrollmentService(),
+		ComplianceService:         service.NewComplianceService(),
+		AuditService:              service.NewAuditService(),
+		BulkOperationService:      service.NewBulkOperationService(),
+		ApplicationRequestService: service.NewApplicationRequestService(),
+		DownloadSigner:            downloadSigner,
+		Health:                    probes,
+		MetricsUsername:           metricsUsername,
+		MetricsPassword:           metricsPassword,
+		RateLimits: &api.RateLimits{
+			Store:           service.NewRateLimitStore(),
+			LoginPerMinute:  api.DefaultLoginPerMinute,
+			DevicePerMinute: api.DefaultDevicePerMinute,
+			UserPerMinute:   api.DefaultUserPerMinute,
+			PublicPerMinute: api.DefaultPublicPerMinute,
+		},
+		OpenAPIValidator: openAPIValidator,
+		Idempotency:      &api.Idempotency{Store: service.NewIdempotencyStore()},
+	}
+	if url, _ := cmd.Flags().GetString("package-search-url"); url != "" {
+		deps.PackageSearchService = service.NewPackageSearchClient(url, nil)
 	}
 
 	// Create router
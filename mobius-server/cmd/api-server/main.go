@@ -2,18 +2,29 @@ package main
 
 import (
 	"context"
+	"flag"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
+	kitlog "github.com/go-kit/log"
+	redigo "github.com/gomodule/redigo/redis"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 
 	"github.com/notawar/mobius/mobius-server/api"
+	"github.com/notawar/mobius/mobius-server/pkg/blobstore"
+	"github.com/notawar/mobius/mobius-server/pkg/database"
 	"github.com/notawar/mobius/mobius-server/pkg/service"
 	"github.com/notawar/mobius/mobius-server/pkg/websocket"
+	"github.com/notawar/mobius/mobius-server/server/config"
+	"github.com/notawar/mobius/mobius-server/server/datastore/redis"
+	"github.com/notawar/mobius/mobius-server/server/health"
+	"github.com/notawar/mobius/mobius-server/server/logging"
+	"github.com/notawar/mobius/mobius-server/server/mobius"
 )
 
 func main() {
@@ -21,45 +32,355 @@ func main() {
 	zerolog.SetGlobalLevel(zerolog.DebugLevel)
 	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
 
-	addr := ":8081"
+	addr := flag.String("addr", ":8081", "Address to bind the API server to")
+	storage := flag.String("storage", envOrDefault("MOBIUS_STORAGE", "memory"), "Storage backend: memory, mysql or sqlite3")
+	sqlitePath := flag.String("sqlite-path", envOrDefault("MOBIUS_SQLITE_PATH", "mobius.db"), "SQLite database file")
+	mysqlHost := flag.String("mysql-host", envOrDefault("MOBIUS_MYSQL_HOST", "localhost"), "MySQL host")
+	mysqlPort := flag.Int("mysql-port", 3306, "MySQL port")
+	mysqlDatabase := flag.String("mysql-database", envOrDefault("MOBIUS_MYSQL_DATABASE", "mobius"), "MySQL database name")
+	mysqlUser := flag.String("mysql-user", envOrDefault("MOBIUS_MYSQL_USERNAME", "mobius"), "MySQL username")
+	mysqlPassword := flag.String("mysql-password", os.Getenv("MOBIUS_MYSQL_PASSWORD"), "MySQL password")
+	jwtKey := flag.String("jwt-key", os.Getenv("MOBIUS_JWT_KEY"), "Key used to sign user access tokens")
+	licenseKey := flag.String("license-key", os.Getenv("MOBIUS_LICENSE_KEY"), "Signed license key, used until a key is updated through the API")
+	packageStore := flag.String("package-store", envOrDefault("MOBIUS_PACKAGE_STORE", "fs"), "Application package store: fs or s3")
+	packageDir := flag.String("package-dir", envOrDefault("MOBIUS_PACKAGE_DIR", "packages"), "Directory of the fs package store")
+	s3Bucket := flag.String("s3-bucket", os.Getenv("MOBIUS_S3_BUCKET"), "S3 bucket of the s3 package store")
+	s3Prefix := flag.String("s3-prefix", os.Getenv("MOBIUS_S3_PREFIX"), "Key prefix in the S3 bucket")
+	s3Region := flag.String("s3-region", os.Getenv("MOBIUS_S3_REGION"), "S3 region")
+	s3Endpoint := flag.String("s3-endpoint-url", os.Getenv("MOBIUS_S3_ENDPOINT_URL"), "S3 endpoint URL, for S3-compatible stores")
+	s3AccessKeyID := flag.String("s3-access-key-id", os.Getenv("MOBIUS_S3_ACCESS_KEY_ID"), "S3 access key ID")
+	s3SecretAccessKey := flag.String("s3-secret-access-key", os.Getenv("MOBIUS_S3_SECRET_ACCESS_KEY"), "S3 secret access key")
+	s3PathStyle := flag.Bool("s3-force-path-style", os.Getenv("MOBIUS_S3_FORCE_PATH_STYLE") == "true", "Use path-style S3 URLs")
+	downloadKey := flag.String("download-key", os.Getenv("MOBIUS_DOWNLOAD_KEY"), "Key used to sign package download URLs")
+	packageSearchURL := flag.String("package-search-url", os.Getenv("MOBIUS_PACKAGE_SEARCH_URL"), "URL of mobius-package-search, to import applications from its packages")
+	packageUpdateInterval := flag.Duration("package-update-interval", 6*time.Hour, "How often imported applications are checked for newer upstream versions")
+	metricsUsername := flag.String("metrics-username", os.Getenv("MOBIUS_PROMETHEUS_BASIC_AUTH_USERNAME"), "HTTP basic auth username for /api/v1/metrics")
+	metricsPassword := flag.String("metrics-password", os.Getenv("MOBIUS_PROMETHEUS_BASIC_AUTH_PASSWORD"), "HTTP basic auth password for /api/v1/metrics")
+	websocketBus := flag.String("websocket-bus", envOrDefault("MOBIUS_WEBSOCKET_BUS", "memory"), "WebSocket event bus: memory, or redis to deliver events to clients of every replica")
+	rateLimitStore := flag.String("rate-limit-store", envOrDefault("MOBIUS_RATE_LIMIT_STORE", "memory"), "Rate limit store: memory, or redis to share limits between replicas")
+	idempotencyStore := flag.String("idempotency-store", envOrDefault("MOBIUS_IDEMPOTENCY_STORE", "memory"), "Idempotency key store: memory, or redis to replay retries on every replica")
+	idempotencyTTL := flag.Duration("idempotency-ttl", api.DefaultIdempotencyTTL, "How long responses to requests with an Idempotency-Key are replayed")
+	redisAddress := flag.String("redis-address", envOrDefault("MOBIUS_REDIS_ADDRESS", "localhost:6379"), "Redis address of the redis rate limit store, idempotency store and WebSocket bus")
+	redisUsername := flag.String("redis-username", os.Getenv("MOBIUS_REDIS_USERNAME"), "Redis username")
+	redisPassword := flag.String("redis-password", os.Getenv("MOBIUS_REDIS_PASSWORD"), "Redis password")
+	redisDatabase := flag.Int("redis-database", envIntOrDefault("MOBIUS_REDIS_DATABASE", 0), "Redis database number")
+	redisTLS := flag.Bool("redis-use-tls", os.Getenv("MOBIUS_REDIS_USE_TLS") == "true", "Connect to Redis over TLS")
+	trustedProxies := flag.String("trusted-proxies", os.Getenv("MOBIUS_TRUSTED_PROXIES"), "Comma-separated IPs and CIDRs of reverse proxies whose X-Forwarded-For is trusted")
+	loginRateLimit := flag.Int("login-rate-limit", envIntOrDefault("MOBIUS_LOGIN_RATE_LIMIT", api.DefaultLoginPerMinute), "Login attempts per account per minute, 0 to disable")
+	deviceRateLimit := flag.Int("device-rate-limit", envIntOrDefault("MOBIUS_DEVICE_RATE_LIMIT", api.DefaultDevicePerMinute), "Device API requests per device per minute, 0 to disable")
+	userRateLimit := flag.Int("user-rate-limit", envIntOrDefault("MOBIUS_USER_RATE_LIMIT", api.DefaultUserPerMinute), "API requests per user per minute, 0 to disable")
+	publicRateLimit := flag.Int("public-rate-limit", envIntOrDefault("MOBIUS_PUBLIC_RATE_LIMIT", api.DefaultPublicPerMinute), "Unauthenticated requests per client IP per minute, 0 to disable")
+	auditLogPlugin := flag.String("audit-log-plugin", os.Getenv("MOBIUS_AUDIT_LOG_PLUGIN"), "Also forward audit entries to: filesystem, stdout, webhook, kinesis, firehose, lambda, pubsub or kafkarest")
+	auditLogFile := flag.String("audit-log-file", envOrDefault("MOBIUS_AUDIT_LOG_FILE", "audit.log"), "File of the filesystem audit log plugin")
+	auditLogWebhookURL := flag.String("audit-log-webhook-url", os.Getenv("MOBIUS_AUDIT_LOG_WEBHOOK_URL"), "URL of the webhook audit log plugin")
+	auditLogStream := flag.String("audit-log-stream", os.Getenv("MOBIUS_AUDIT_LOG_STREAM"), "Stream of the kinesis and firehose audit log plugins")
+	auditLogFunction := flag.String("audit-log-lambda-function", os.Getenv("MOBIUS_AUDIT_LOG_LAMBDA_FUNCTION"), "Function of the lambda audit log plugin")
+	auditLogAWSRegion := flag.String("audit-log-aws-region", os.Getenv("MOBIUS_AUDIT_LOG_AWS_REGION"), "AWS region of the kinesis, firehose and lambda audit log plugins")
+	auditLogPubSubProject := flag.String("audit-log-pubsub-project", os.Getenv("MOBIUS_AUDIT_LOG_PUBSUB_PROJECT"), "Project of the pubsub audit log plugin")
+	auditLogTopic := flag.String("audit-log-topic", os.Getenv("MOBIUS_AUDIT_LOG_TOPIC"), "Topic of the pubsub and kafkarest audit log plugins")
+	auditLogKafkaProxy := flag.String("audit-log-kafka-proxy", os.Getenv("MOBIUS_AUDIT_LOG_KAFKA_PROXY"), "Kafka REST proxy of the kafkarest audit log plugin")
+	openAPIValidation := flag.Bool("openapi-validation", os.Getenv("MOBIUS_OPENAPI_VALIDATION") != "false", "Reject /api/v1 requests that do not match the OpenAPI document")
+	validateResponses := flag.Bool("openapi-validate-responses", os.Getenv("MOBIUS_OPENAPI_VALIDATE_RESPONSES") == "true", "Log /api/v1 responses that do not match the OpenAPI document")
+	flag.Parse()
 
 	log.Info().
-		Str("addr", addr).
+		Str("addr", *addr).
+		Str("storage", *storage).
 		Msg("Starting Mobius MDM API server")
 
-	// Initialize services
-	licenseService := service.NewLicenseService()
-	deviceService := service.NewDeviceService()
-	deviceGroupService := service.NewDeviceGroupService()
-	policyService := service.NewPolicyService()
-	groupService := service.NewGroupService()
-	authService := service.NewAuthService()
-	applicationService := service.NewApplicationService()
-
-	// Initialize WebSocket hub
-	wsHub := websocket.NewHub()
+	// Redis is shared by the rate limits, idempotency keys and the WebSocket
+	// event bus
+	var redisPool mobius.RedisPool
+	if *rateLimitStore == "redis" || *idempotencyStore == "redis" || *websocketBus == "redis" {
+		pool, err := redis.NewPool(redis.PoolConfig{
+			Server:      *redisAddress,
+			Username:    *redisUsername,
+			Password:    *redisPassword,
+			Database:    *redisDatabase,
+			UseTLS:      *redisTLS,
+			ConnTimeout: 5 * time.Second,
+			KeepAlive:   10 * time.Second,
+		})
+		if err != nil {
+			log.Fatal().Err(err).Str("redis_address", *redisAddress).Msg("Failed to connect to Redis")
+		}
+		redisPool = pool
+	}
+
+	// Initialize WebSocket hub; with the redis bus, events reach the clients
+	// of every replica
+	var wsHub *websocket.Hub
+	switch *websocketBus {
+	case "memory":
+		wsHub = websocket.NewHub()
+	case "redis":
+		wsHub = websocket.NewHubWithBus(websocket.NewRedisBus(redisPool, ""))
+	default:
+		log.Fatal().Str("websocket_bus", *websocketBus).Msg("Unknown WebSocket bus")
+	}
 	ctx := context.Background()
 	go wsHub.Run(ctx)
 
+	// The license key is loaded once the storage is set up, as keys updated
+	// through the API are stored there
+	licenseService := service.NewLicenseService()
+
+	// Application packages are kept outside the database
+	var packages blobstore.Store
+	var err error
+	switch *packageStore {
+	case "fs":
+		packages, err = blobstore.NewFileStore(*packageDir)
+	case "s3":
+		packages, err = blobstore.NewS3Store(config.S3Config{
+			SoftwareInstallersBucket:           *s3Bucket,
+			SoftwareInstallersPrefix:           *s3Prefix,
+			SoftwareInstallersRegion:           *s3Region,
+			SoftwareInstallersEndpointURL:      *s3Endpoint,
+			SoftwareInstallersAccessKeyID:      *s3AccessKeyID,
+			SoftwareInstallersSecretAccessKey:  *s3SecretAccessKey,
+			SoftwareInstallersForceS3PathStyle: *s3PathStyle,
+		})
+	default:
+		log.Fatal().Str("package_store", *packageStore).Msg("Unknown package store")
+	}
+	if err != nil {
+		log.Fatal().Err(err).Str("package_store", *packageStore).Msg("Failed to open package store")
+	}
+
+	if *downloadKey == "" {
+		log.Warn().Msg("No download key configured, package download URLs will not survive a restart")
+	}
+	downloadSigner, err := service.NewURLSigner([]byte(*downloadKey))
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to create download URL signer")
+	}
+
+	// Backends register health probes as they are set up
+	probes := health.NewRegistry()
+	probes.Register(health.Probe{Name: "websocket_hub", Checker: health.CheckerFunc(wsHub.HealthCheckContext), Live: true})
+	if checker, ok := packages.(health.ContextChecker); ok {
+		probes.Register(health.Probe{Name: "blob_store", Checker: health.CheckerFunc(checker.HealthCheckContext), Timeout: 5 * time.Second, Optional: true})
+	}
+
+	if redisPool != nil {
+		probes.Register(health.Probe{Name: "redis", Checker: health.CheckerFunc(func(context.Context) error {
+			conn := redisPool.Get()
+			defer conn.Close()
+			_, err := redigo.String(conn.Do("PING"))
+			return err
+		})})
+	}
+
+	// Rate limits are kept in memory, or in Redis to share them between replicas
+	proxies, err := api.ParseTrustedProxies(*trustedProxies)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to parse trusted proxies")
+	}
+	rateLimits := &api.RateLimits{
+		TrustedProxies:  proxies,
+		LoginPerMinute:  *loginRateLimit,
+		DevicePerMinute: *deviceRateLimit,
+		UserPerMinute:   *userRateLimit,
+		PublicPerMinute: *publicRateLimit,
+	}
+	switch *rateLimitStore {
+	case "memory":
+		rateLimits.Store = service.NewRateLimitStore()
+	case "redis":
+		rateLimits.Store = &redis.ThrottledStore{Pool: redisPool, KeyPrefix: "mobius:ratelimit:"}
+	default:
+		log.Fatal().Str("rate_limit_store", *rateLimitStore).Msg("Unknown rate limit store")
+	}
+
+	// Responses to retried requests are replayed from memory, or from Redis
+	// to replay them on every replica
+	idempotency := &api.Idempotency{TTL: *idempotencyTTL}
+	switch *idempotencyStore {
+	case "memory":
+		idempotency.Store = service.NewIdempotencyStore()
+	case "redis":
+		idempotency.Store = &redis.IdempotencyStore{Pool: redisPool, KeyPrefix: "mobius:idempotency:"}
+	default:
+		log.Fatal().Str("idempotency_store", *idempotencyStore).Msg("Unknown idempotency store")
+	}
+
+	// Requests, and optionally responses, are checked against the OpenAPI document
+	var openAPIValidator *api.OpenAPIValidator
+	if *openAPIValidation {
+		spec, err := api.LoadOpenAPISpec()
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to load the OpenAPI document")
+		}
+		openAPIValidator = api.NewOpenAPIValidator(spec)
+		openAPIValidator.ValidateResponses = *validateResponses
+	}
+
 	// Create dependencies
 	deps := &api.Dependencies{
-		LicenseService:     licenseService,
-		DeviceService:      deviceService,
-		DeviceGroupService: deviceGroupService,
-		PolicyService:      policyService,
-		GroupService:       groupService,
-		ApplicationService: applicationService,
-		AuthService:        authService,
-		WSHub:              wsHub,
-		StaticDir:          "./static", // Serve Svelte frontend from static directory
+		LicenseService:   licenseService,
+		DownloadSigner:   downloadSigner,
+		Health:           probes,
+		MetricsUsername:  *metricsUsername,
+		MetricsPassword:  *metricsPassword,
+		RateLimits:       rateLimits,
+		OpenAPIValidator: openAPIValidator,
+		Idempotency:      idempotency,
+		WSHub:            wsHub,
+		StaticDir:        "./static", // Serve Svelte frontend from static directory
+	}
+	if *packageSearchURL != "" {
+		deps.PackageSearchService = service.NewPackageSearchClient(*packageSearchURL, nil)
+	}
+
+	// Initialize services; their changes are broadcast on the WebSocket hub
+	notifier := websocket.NewServiceNotifier(wsHub)
+	switch *storage {
+	case "memory":
+		deviceService := service.NewDeviceService()
+		deviceService.SetWebSocketNotifier(notifier)
+		deviceService.SetLicenseService(licenseService)
+		deviceGroupService := service.NewDeviceGroupService()
+		deviceGroupService.SetWebSocketNotifier(notifier)
+		policyService := service.NewPolicyService()
+		policyService.SetWebSocketNotifier(notifier)
+		commandService := service.NewCommandService(deviceService)
+		commandService.SetWebSocketNotifier(notifier)
+		liveQueryService := service.NewLiveQueryService()
+		liveQueryService.SetWebSocketNotifier(notifier)
+		complianceService := service.NewComplianceService()
+		complianceService.SetWebSocketNotifier(notifier)
+
+		deps.DeviceService = deviceService
+		deps.DeviceGroupService = deviceGroupService
+		deps.PolicyService = policyService
+		deps.CommandService = commandService
+		deps.LiveQueryService = liveQueryService
+		deps.ComplianceService = complianceService
+		deps.GroupService = service.NewGroupService()
+		deps.EnrollmentService = service.NewEnrollmentService()
+		deps.ApplicationService = service.NewApplicationService(packages)
+		authService := service.NewAuthService()
+		deps.AuthService = authService
+		deps.UserService = authService
+		deps.AuditService = service.NewAuditService()
+		deps.BulkOperationService = service.NewBulkOperationService()
+		deps.ApplicationRequestService = service.NewApplicationRequestService()
+	case database.DriverMySQL, database.DriverSQLite:
+		db, err := database.Open(database.Config{
+			Driver:   *storage,
+			Host:     *mysqlHost,
+			Port:     *mysqlPort,
+			Name:     *mysqlDatabase,
+			User:     *mysqlUser,
+			Password: *mysqlPassword,
+			Path:     *sqlitePath,
+		})
+		if err != nil {
+			log.Fatal().Err(err).Str("storage", *storage).Msg("Failed to open database")
+		}
+		defer db.Close()
+		probes.Register(health.Probe{Name: "datastore", Checker: db})
+		licenseService.SetLicenseStore(database.NewLicenseStore(db))
+
+		deviceService := database.NewDeviceService(db)
+		deviceService.SetWebSocketNotifier(notifier)
+		if err := deviceService.SetLicenseService(licenseService); err != nil {
+			log.Fatal().Err(err).Msg("Failed to count enrolled devices")
+		}
+		deviceGroupService := database.NewDeviceGroupService(db)
+		deviceGroupService.SetWebSocketNotifier(notifier)
+		policyService := database.NewPolicyService(db)
+		policyService.SetWebSocketNotifier(notifier)
+		commandService := database.NewCommandService(db)
+		commandService.SetWebSocketNotifier(notifier)
+		liveQueryService := database.NewLiveQueryService(db)
+		liveQueryService.SetWebSocketNotifier(notifier)
+		complianceService := database.NewComplianceService(db)
+		complianceService.SetWebSocketNotifier(notifier)
+
+		deps.DeviceService = deviceService
+		deps.DeviceGroupService = deviceGroupService
+		deps.PolicyService = policyService
+		deps.CommandService = commandService
+		deps.LiveQueryService = liveQueryService
+		deps.ComplianceService = complianceService
+		deps.GroupService = database.NewGroupService(db)
+		deps.EnrollmentService = database.NewEnrollmentService(db)
+		deps.ApplicationService = database.NewApplicationService(db, packages)
+		if *jwtKey == "" {
+			log.Warn().Msg("No JWT key configured, user sessions will not survive a restart")
+		}
+		tokens, err := service.NewTokenIssuer([]byte(*jwtKey))
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to create token issuer")
+		}
+		authService := database.NewAuthService(db, tokens)
+		deps.AuthService = authService
+		deps.UserService = authService
+		deps.AuditService = database.NewAuditService(db)
+		deps.BulkOperationService = database.NewBulkOperationService(db)
+		deps.ApplicationRequestService = database.NewApplicationRequestService(db)
+	default:
+		log.Fatal().Str("storage", *storage).Msg("Unknown storage backend")
 	}
 
+	// A license key updated through the API takes precedence over the configured one
+	if err := licenseService.LoadLicense(*licenseKey); err != nil {
+		log.Error().Err(err).Msg("Failed to load license key, using the community license")
+	}
+
+	// Audit entries are stored with the other data and may also be forwarded
+	// through one of the log plugins
+	auditCtx, stopAudit := context.WithCancel(context.Background())
+	auditDone := make(chan struct{})
+	if *auditLogPlugin != "" {
+		auditLogger, err := logging.NewJSONLogger("audit", logging.Config{
+			Plugin: *auditLogPlugin,
+			Filesystem: logging.FilesystemConfig{
+				LogFile: *auditLogFile,
+			},
+			Webhook:   logging.WebhookConfig{URL: *auditLogWebhookURL},
+			Firehose:  logging.FirehoseConfig{StreamName: *auditLogStream, Region: *auditLogAWSRegion},
+			Kinesis:   logging.KinesisConfig{StreamName: *auditLogStream, Region: *auditLogAWSRegion},
+			Lambda:    logging.LambdaConfig{Function: *auditLogFunction, Region: *auditLogAWSRegion},
+			PubSub:    logging.PubSubConfig{Project: *auditLogPubSubProject, Topic: *auditLogTopic},
+			KafkaREST: logging.KafkaRESTConfig{ProxyHost: *auditLogKafkaProxy, Topic: *auditLogTopic},
+		}, kitlog.NewLogfmtLogger(os.Stderr))
+		if err != nil {
+			log.Fatal().Err(err).Str("plugin", *auditLogPlugin).Msg("Failed to create audit log forwarder")
+		}
+		forwarder := service.NewAuditForwarder(deps.AuditService, auditLogger)
+		deps.AuditService = forwarder
+		go func() {
+			forwarder.Run(auditCtx)
+			close(auditDone)
+		}()
+	} else {
+		close(auditDone)
+	}
+
+	// Expire commands and live queries that devices did not finish in time.
+	// A worker that misses three runs fails its health probe.
+	commandWorker := health.NewHeartbeat(3 * time.Minute)
+	probes.Register(health.Probe{Name: "command_expiry_worker", Checker: commandWorker, Live: true})
+	go expireCommands(ctx, deps.CommandService, time.Minute, commandWorker)
+	liveQueryWorker := health.NewHeartbeat(30 * time.Second)
+	probes.Register(health.Probe{Name: "live_query_expiry_worker", Checker: liveQueryWorker, Live: true})
+	go expireLiveQueries(ctx, deps.LiveQueryService, 10*time.Second, liveQueryWorker)
+	if deps.PackageSearchService != nil {
+		go checkApplicationUpdates(ctx, deps, *packageUpdateInterval)
+	}
+	// Bulk operations run by a server that stopped, this one included, are
+	// interrupted once they make no progress
+	go interruptBulkOperations(ctx, deps.BulkOperationService, time.Minute)
+
 	// Create router
 	router := api.NewRouter(deps)
 
 	// Create server
 	server := &http.Server{
-		Addr:         addr,
+		Addr:         *addr,
 		Handler:      router,
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 15 * time.Second,
@@ -74,14 +395,18 @@ func main() {
 		}
 	}()
 
-	log.Info().Str("addr", addr).Msg("Mobius MDM API server started successfully")
+	log.Info().Str("addr", *addr).Msg("Mobius MDM API server started successfully")
 	log.Info().Msg("Available endpoints:")
 	log.Info().Msg("  GET  /api/v1/health - Health check")
-	log.Info().Msg("  POST /api/v1/auth/login - User login (admin@mobius.local / admin123)")
+	log.Info().Msg("  GET  /api/v1/health/live - Liveness probe")
+	log.Info().Msg("  GET  /api/v1/health/ready - Readiness probe")
+	log.Info().Msg("  GET  /api/v1/metrics - Prometheus metrics")
+	log.Info().Msg("  POST /api/v1/auth/login - User login (admin@mobius.local / admin123, changed at the first login)")
 	log.Info().Msg("  GET  /api/v1/license/status - License status")
 	log.Info().Msg("  GET  /api/v1/devices - List devices")
 	log.Info().Msg("  GET  /api/v1/policies - List policies")
 	log.Info().Msg("  GET  /api/v1/applications - List applications")
+	log.Info().Msg("  GET  /api/v1/audit - Audit trail")
 
 	// Wait for interrupt signal to gracefully shutdown
 	quit := make(chan os.Signal, 1)
@@ -100,5 +425,118 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Forward the audit entries of the last requests
+	stopAudit()
+	<-auditDone
+
 	log.Info().Msg("Server shutdown complete")
 }
+
+// expireCommands periodically marks overdue device commands as expired,
+// beating heartbeat after every run
+func expireCommands(ctx context.Context, commands api.CommandService, interval time.Duration, heartbeat *health.Heartbeat) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := commands.ExpireCommands()
+			heartbeat.Beat()
+			if err != nil {
+				log.Error().Err(err).Msg("Failed to expire device commands")
+				continue
+			}
+			if n > 0 {
+				log.Info().Int("count", n).Msg("Expired device commands")
+			}
+		}
+	}
+}
+
+// expireLiveQueries periodically times out live query campaigns past their
+// deadline, beating heartbeat after every run
+func expireLiveQueries(ctx context.Context, liveQueries api.LiveQueryService, interval time.Duration, heartbeat *health.Heartbeat) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := liveQueries.ExpireCampaigns()
+			heartbeat.Beat()
+			if err != nil {
+				log.Error().Err(err).Msg("Failed to expire live queries")
+				continue
+			}
+			if n > 0 {
+				log.Info().Int("count", n).Msg("Timed out live queries")
+			}
+		}
+	}
+}
+
+// interruptBulkOperations marks the bulk operations orphaned by a server that
+// stopped as interrupted, at startup and then periodically
+func interruptBulkOperations(ctx context.Context, operations api.BulkOperationService, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := operations.InterruptBulkOperations(time.Now().Add(-api.BulkOperationStaleAfter))
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to interrupt orphaned bulk operations")
+		} else if n > 0 {
+			log.Warn().Int("count", n).Msg("Interrupted orphaned bulk operations")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkApplicationUpdates periodically flags the imported applications with
+// a newer upstream version
+func checkApplicationUpdates(ctx context.Context, deps *api.Dependencies, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			checked, updates, err := deps.CheckApplicationUpdates(ctx)
+			if err != nil {
+				log.Error().Err(err).Msg("Failed to check some applications for updates")
+			}
+			if updates > 0 {
+				log.Info().Int("checked", checked).Int("updates", updates).Msg("Imported applications have updates")
+			}
+		}
+	}
+}
+
+// envOrDefault returns the value of the environment variable key, or def if unset
+func envOrDefault(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// envIntOrDefault returns the integer value of the environment variable key,
+// or def if unset or not an integer
+func envIntOrDefault(key string, def int) int {
+	if v, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return v
+	}
+	return def
+}
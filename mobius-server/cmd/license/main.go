@@ -0,0 +1,176 @@
+// Command license issues the license keys Mobius servers accept. Keys are
+// ES256 JWTs verified offline against pkg/service/license_public_key.pem;
+// the matching private key is kept by the license issuer, outside this
+// repository.
+//
+//	license keygen -private-key FILE -public-key FILE
+//	license sign -private-key FILE -tier TIER -organization NAME -devices N -expires DATE
+//	license verify KEY
+//
+// keygen creates the issuer key pair, once; its public key replaces
+// pkg/service/license_public_key.pem. sign prints a license key, which
+// verify checks against the public key built into the server.
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/notawar/mobius/mobius-server/pkg/service"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "keygen":
+		flags := flag.NewFlagSet("keygen", flag.ExitOnError)
+		privateKey := flags.String("private-key", "", "File to write the private key to; it must not exist")
+		publicKey := flags.String("public-key", "license_public_key.pem", "File to write the public key to")
+		flags.Parse(os.Args[2:]) //nolint:errcheck // exits on error
+		err = keygen(*privateKey, *publicKey)
+
+	case "sign":
+		flags := flag.NewFlagSet("sign", flag.ExitOnError)
+		privateKey := flags.String("private-key", "", "Private key of the license issuer")
+		tier := flags.String("tier", service.TierProfessional, "Tier: community, professional or enterprise")
+		organization := flags.String("organization", "", "Organization the license is issued to")
+		devices := flags.Int("devices", 0, "Device limit, -1 for unlimited")
+		expires := flags.String("expires", "", "Expiry date, such as 2027-01-31; empty for a license that does not expire")
+		features := flags.String("features", "", "Comma-separated features, instead of those of the tier")
+		flags.Parse(os.Args[2:]) //nolint:errcheck // exits on error
+
+		claims := service.LicenseClaims{
+			Tier:         *tier,
+			Organization: *organization,
+			DeviceLimit:  *devices,
+			RegisteredClaims: jwt.RegisteredClaims{
+				Subject:  *organization,
+				IssuedAt: jwt.NewNumericDate(time.Now()),
+			},
+		}
+		if *features != "" {
+			claims.Features = strings.Split(*features, ",")
+		}
+		if *expires != "" {
+			expiresAt, perr := time.Parse(time.DateOnly, *expires)
+			if perr != nil {
+				fmt.Fprintf(os.Stderr, "invalid -expires: %v\n", perr)
+				os.Exit(2)
+			}
+			claims.ExpiresAt = jwt.NewNumericDate(expiresAt)
+		}
+		err = sign(*privateKey, claims)
+
+	case "verify":
+		if len(os.Args) != 3 {
+			usage()
+		}
+		err = verify(os.Args[2])
+
+	default:
+		usage()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// keygen writes a new P-256 issuer key pair
+func keygen(privatePath, publicPath string) error {
+	if privatePath == "" {
+		return errors.New("-private-key is required")
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	privateDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return err
+	}
+
+	// An existing private key is never overwritten: licenses signed with it
+	// would stop verifying
+	f, err := os.OpenFile(privatePath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	if err := pem.Encode(f, &pem.Block{Type: "EC PRIVATE KEY", Bytes: privateDER}); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.WriteFile(publicPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}), 0o644)
+}
+
+// sign prints a license key for claims, once the server would accept it
+func sign(privatePath string, claims service.LicenseClaims) error {
+	if privatePath == "" {
+		return errors.New("-private-key is required")
+	}
+	data, err := os.ReadFile(privatePath)
+	if err != nil {
+		return err
+	}
+	key, err := jwt.ParseECPrivateKeyFromPEM(data)
+	if err != nil {
+		return fmt.Errorf("parse private key: %w", err)
+	}
+
+	license, err := service.SignLicense(key, claims)
+	if err != nil {
+		return err
+	}
+	// Checked against the issuer's own public key, so that a license with
+	// invalid claims is never handed out
+	if err := service.NewLicenseServiceWithKey(&key.PublicKey).UpdateLicense(license); err != nil {
+		return err
+	}
+	fmt.Println(license)
+	return nil
+}
+
+// verify prints the license of a key the server accepts
+func verify(key string) error {
+	licenses := service.NewLicenseService()
+	if err := licenses.UpdateLicense(strings.TrimSpace(key)); err != nil {
+		return fmt.Errorf("not accepted by the built-in public key: %w", err)
+	}
+	license, err := licenses.GetLicense()
+	if err != nil {
+		return err
+	}
+	out := json.NewEncoder(os.Stdout)
+	out.SetIndent("", "  ")
+	return out.Encode(license)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: license keygen -private-key FILE [-public-key FILE]")
+	fmt.Fprintln(os.Stderr, "       license sign -private-key FILE -tier TIER -organization NAME -devices N [-expires DATE] [-features LIST]")
+	fmt.Fprintln(os.Stderr, "       license verify KEY")
+	os.Exit(2)
+}
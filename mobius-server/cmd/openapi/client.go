@@ -0,0 +1,714 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/notawar/mobius/mobius-server/api"
+)
+
+// handwrittenTypes are schemas the client package declares itself
+var handwrittenTypes = map[string]bool{
+	"Error": true, // returned for every error status
+}
+
+// initialisms are written in capitals in Go names
+var initialisms = map[string]string{
+	"api": "API", "http": "HTTP", "id": "ID", "ids": "IDs", "ip": "IP", "json": "JSON",
+	"ms": "MS", "os": "OS", "sql": "SQL", "ttl": "TTL", "url": "URL", "uuid": "UUID",
+}
+
+// methodOrder is the order of the methods of a path in the client
+var methodOrder = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+// generator writes a Go client for the operations of an OpenAPI document.
+//
+// Named schemas become structs, as do inline objects, which are named after
+// their parent and property. Required properties are plain values. Optional
+// ones are pointers in the schemas sent to the server, so that every value
+// can be sent, and in the schemas the server returns only when their zero
+// value is ambiguous: timestamps and structs. Slices and maps are never
+// pointers; nil leaves them out.
+type generator struct {
+	spec    *api.OpenAPISpec
+	input   map[string]bool // Named schemas sent in request bodies
+	named   map[string]string
+	types   bytes.Buffer
+	methods bytes.Buffer
+	names   map[string]bool
+	imports map[string]bool
+}
+
+// methodConst returns the net/http constant of an HTTP method
+func methodConst(method string) string {
+	return "http.Method" + method[:1] + strings.ToLower(method[1:])
+}
+
+func generateClient(spec *api.OpenAPISpec, pkg string) ([]byte, error) {
+	g := &generator{
+		spec:    spec,
+		input:   make(map[string]bool),
+		named:   make(map[string]string),
+		names:   make(map[string]bool),
+		imports: map[string]bool{"context": true, "net/http": true},
+	}
+	for name := range handwrittenTypes {
+		g.names[name] = true
+	}
+
+	paths := make([]string, 0, len(spec.Paths))
+	for path, item := range spec.Paths {
+		paths = append(paths, path)
+		for _, op := range item.Operations() {
+			if body := spec.RequestBody(op.RequestBody); body != nil {
+				for _, media := range body.Content {
+					g.markInput(media.Schema, make(map[*api.OpenAPISchema]bool))
+				}
+			}
+		}
+	}
+	sort.Strings(paths)
+
+	schemas := make([]string, 0, len(spec.Components.Schemas))
+	for name := range spec.Components.Schemas {
+		schemas = append(schemas, name)
+	}
+	sort.Strings(schemas)
+	for _, name := range schemas {
+		if handwrittenTypes[name] || !isStruct(spec, spec.Components.Schemas[name]) {
+			continue
+		}
+		if _, err := g.schemaType(&api.OpenAPISchema{Ref: "#/components/schemas/" + name}, "", false); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, path := range paths {
+		operations := spec.Paths[path].Operations()
+		for _, method := range methodOrder {
+			if op := operations[method]; op != nil {
+				if err := g.operation(path, method, op); err != nil {
+					return nil, fmt.Errorf("%s %s: %w", method, path, err)
+				}
+			}
+		}
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by mobius-server/cmd/openapi from api/openapi.yaml. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&out, "package %s\n\n", pkg)
+	imports := make([]string, 0, len(g.imports))
+	for imp := range g.imports {
+		imports = append(imports, imp)
+	}
+	sort.Strings(imports)
+	fmt.Fprintf(&out, "import (\n")
+	for _, imp := range imports {
+		fmt.Fprintf(&out, "\t%q\n", imp)
+	}
+	fmt.Fprintf(&out, ")\n\n")
+	fmt.Fprintf(&out, "// APIVersion is the version of the API document the client was generated from\n")
+	fmt.Fprintf(&out, "const APIVersion = %q\n\n", spec.Info.Version)
+	out.Write(g.types.Bytes())
+	out.Write(g.methods.Bytes())
+
+	source, err := format.Source(out.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("format client: %w", err)
+	}
+	return source, nil
+}
+
+// markInput records the named schemas a schema refers to
+func (g *generator) markInput(schema *api.OpenAPISchema, seen map[*api.OpenAPISchema]bool) {
+	if schema == nil || seen[schema] {
+		return
+	}
+	seen[schema] = true
+	if schema.Ref != "" {
+		g.input[refName(schema.Ref)] = true
+		g.markInput(g.spec.Schema(schema), seen)
+		return
+	}
+	for _, property := range schema.Properties {
+		g.markInput(property, seen)
+	}
+	for _, part := range schema.AllOf {
+		g.markInput(part, seen)
+	}
+	g.markInput(schema.Items, seen)
+	if schema.AdditionalProperties != nil {
+		g.markInput(schema.AdditionalProperties.Schema, seen)
+	}
+}
+
+// schemaType returns the Go type of a schema, declaring the structs it
+// needs. Inline objects are named hint.
+func (g *generator) schemaType(schema *api.OpenAPISchema, hint string, input bool) (string, error) {
+	if schema == nil {
+		return "interface{}", nil
+	}
+	if schema.Ref != "" {
+		name := refName(schema.Ref)
+		target := g.spec.Schema(schema)
+		if target == nil {
+			return "", fmt.Errorf("unknown schema %s", schema.Ref)
+		}
+		if !isStruct(g.spec, target) {
+			return g.schemaType(target, name, g.input[name])
+		}
+		if typ, ok := g.named[name]; ok {
+			return typ, nil
+		}
+		g.named[name] = name
+		if err := g.declareStruct(name, target, g.input[name]); err != nil {
+			return "", err
+		}
+		return name, nil
+	}
+
+	if isStruct(g.spec, schema) {
+		if err := g.declareStruct(hint, schema, input); err != nil {
+			return "", err
+		}
+		return hint, nil
+	}
+	if len(schema.AnyOf)+len(schema.OneOf) > 0 {
+		return "interface{}", nil
+	}
+
+	switch schema.Type.Primary() {
+	case "array":
+		item, err := g.schemaType(schema.Items, singular(hint), input)
+		if err != nil {
+			return "", err
+		}
+		return "[]" + item, nil
+	case "object":
+		if extra := schema.AdditionalProperties; extra != nil && extra.Schema != nil {
+			value, err := g.schemaType(extra.Schema, singular(hint), input)
+			if err != nil {
+				return "", err
+			}
+			return "map[string]" + value, nil
+		}
+		return "map[string]interface{}", nil
+	case "string":
+		if schema.Format == "date-time" {
+			g.imports["time"] = true
+			return "time.Time", nil
+		}
+		return "string", nil
+	case "integer":
+		if schema.Format == "int64" {
+			return "int64", nil
+		}
+		return "int", nil
+	case "number":
+		return "float64", nil
+	case "boolean":
+		return "bool", nil
+	}
+	return "interface{}", nil
+}
+
+// isStruct reports whether a schema becomes a struct: an object with
+// properties, or a composition of schemas
+func isStruct(spec *api.OpenAPISpec, schema *api.OpenAPISchema) bool {
+	schema = spec.Schema(schema)
+	return schema != nil && (len(schema.Properties) > 0 || len(schema.AllOf) > 0)
+}
+
+// declareStruct declares a struct with the properties of a schema. Named
+// schemas it is composed of are embedded.
+func (g *generator) declareStruct(name string, schema *api.OpenAPISchema, input bool) error {
+	if name == "" {
+		return fmt.Errorf("inline object without a name")
+	}
+	if g.names[name] {
+		return fmt.Errorf("type %s is declared twice", name)
+	}
+	g.names[name] = true
+
+	var embedded []string
+	properties := make(map[string]*api.OpenAPISchema)
+	required := make(map[string]bool)
+	parts := append([]*api.OpenAPISchema{schema}, schema.AllOf...)
+	for i, part := range parts {
+		if i > 0 && part.Ref != "" && isStruct(g.spec, part) {
+			typ, err := g.schemaType(part, "", input)
+			if err != nil {
+				return err
+			}
+			embedded = append(embedded, typ)
+			continue
+		}
+		part = g.spec.Schema(part)
+		for property, propertySchema := range part.Properties {
+			properties[property] = propertySchema
+		}
+		for _, property := range part.Required {
+			required[property] = true
+		}
+	}
+
+	names := make([]string, 0, len(properties))
+	for property := range properties {
+		names = append(names, property)
+	}
+	sort.Strings(names)
+
+	var fields bytes.Buffer
+	for _, typ := range embedded {
+		fmt.Fprintf(&fields, "\t%s\n", typ)
+	}
+	for _, property := range names {
+		propertySchema := properties[property]
+		field := goName(property)
+		typ, err := g.schemaType(propertySchema, name+field, input)
+		if err != nil {
+			return fmt.Errorf("%s.%s: %w", name, property, err)
+		}
+
+		tag := property
+		if !required[property] {
+			tag += ",omitempty"
+			nilable := strings.HasPrefix(typ, "[]") || strings.HasPrefix(typ, "map[") || typ == "interface{}"
+			if (input && !nilable) || typ == "time.Time" || isStruct(g.spec, propertySchema) {
+				typ = "*" + typ
+			}
+		}
+		if comment := fieldComment(g.spec.Schema(propertySchema)); comment != "" {
+			fields.WriteString(wrapComment("\t", comment))
+		}
+		fmt.Fprintf(&fields, "\t%s %s `json:%q`\n", field, typ, tag)
+	}
+
+	doc := fmt.Sprintf("// %s is the %s schema of the API\n", name, name)
+	if description := firstSentence(schema.Description); description != "" {
+		doc += "//\n" + wrapComment("", description+".")
+	}
+	fmt.Fprintf(&g.types, "%stype %s struct {\n%s}\n\n", doc, name, fields.String())
+	return nil
+}
+
+// pathParam is a path parameter, passed to the method as an argument
+type pathParam struct {
+	name string
+	arg  string
+}
+
+// operation writes the method calling an operation
+func (g *generator) operation(path, method string, op *api.OpenAPIOperation) error {
+	name := goName(op.OperationID)
+
+	type success struct {
+		status int
+		typ    string // Go type of a JSON body
+		binary bool   // Other content, returned as a stream
+	}
+	var successes []success
+	var statuses []string
+	for status := range op.Responses {
+		statuses = append(statuses, status)
+	}
+	sort.Strings(statuses)
+	for _, status := range statuses {
+		code, err := strconv.Atoi(status)
+		if err != nil || code < 200 || code > 299 {
+			continue
+		}
+		resp := g.spec.Response(op.Responses[status])
+		s := success{status: code}
+		if schema := api.JSONSchema(resp.Content); schema != nil {
+			hint := name + "Response"
+			if countSuccesses(op) > 1 {
+				hint += status
+			}
+			typ, err := g.schemaType(schema, hint, false)
+			if err != nil {
+				return err
+			}
+			s.typ = typ
+		} else if len(resp.Content) > 0 {
+			s.binary = true
+		}
+		successes = append(successes, s)
+	}
+	if len(successes) == 0 {
+		// Protocol switches, such as the WebSocket, are not plain requests
+		return nil
+	}
+
+	// Arguments
+	var params []pathParam
+	var queryParams []*api.OpenAPIParameter
+	for _, param := range g.spec.OperationParameters(path, op) {
+		switch param.In {
+		case "path":
+			params = append(params, pathParam{name: param.Name, arg: lowerGoName(param.Name)})
+		case "query":
+			// Deprecated parameters are kept for older clients only
+			if !param.Deprecated {
+				queryParams = append(queryParams, param)
+			}
+		}
+	}
+	sort.SliceStable(params, func(i, j int) bool {
+		return strings.Index(path, "{"+params[i].name+"}") < strings.Index(path, "{"+params[j].name+"}")
+	})
+	args := []string{"ctx context.Context"}
+	for _, param := range params {
+		args = append(args, param.arg+" string")
+	}
+
+	paramsType := ""
+	if len(queryParams) > 0 {
+		paramsType = name + "Params"
+		if err := g.declareParams(paramsType, queryParams); err != nil {
+			return err
+		}
+		args = append(args, "params *"+paramsType)
+	}
+
+	bodyType, multipart := "", false
+	if body := g.spec.RequestBody(op.RequestBody); body != nil {
+		if schema := api.JSONSchema(body.Content); schema != nil {
+			typ, err := g.schemaType(schema, name+"Request", true)
+			if err != nil {
+				return err
+			}
+			bodyType = typ
+		} else if media := body.Content["multipart/form-data"]; media != nil {
+			bodyType, multipart = name+"Request", true
+			if err := g.declareForm(bodyType, g.spec.Schema(media.Schema)); err != nil {
+				return err
+			}
+		}
+		if bodyType != "" {
+			args = append(args, "body "+bodyType)
+		}
+	}
+
+	// Results
+	var result, zero string
+	switch {
+	case len(successes) > 1:
+		result, zero = "*"+name+"Response", "nil"
+		var fields bytes.Buffer
+		fmt.Fprintf(&fields, "\tStatusCode int\n")
+		for _, s := range successes {
+			if s.typ != "" {
+				fmt.Fprintf(&fields, "\tJSON%d *%s\n", s.status, s.typ)
+			}
+		}
+		if g.names[name+"Response"] {
+			return fmt.Errorf("type %sResponse is declared twice", name)
+		}
+		g.names[name+"Response"] = true
+		fmt.Fprintf(&g.types, "// %sResponse holds the body of the status %s answered with\ntype %sResponse struct {\n%s}\n\n",
+			name, op.OperationID, name, fields.String())
+	case successes[0].binary:
+		g.imports["io"] = true
+		result, zero = "io.ReadCloser", "nil"
+	case successes[0].typ != "":
+		result, zero = resultType(successes[0].typ)
+	}
+
+	// Method
+	m := &g.methods
+	fmt.Fprintf(m, "// %s calls %s /api/v1%s: %s\n", name, method, path, op.Summary)
+	if result == "io.ReadCloser" {
+		fmt.Fprintf(m, "//\n// The caller must close the returned body.\n")
+	}
+	if result == "" {
+		fmt.Fprintf(m, "func (c *Client) %s(%s) error {\n", name, strings.Join(args, ", "))
+	} else {
+		fmt.Fprintf(m, "func (c *Client) %s(%s) (%s, error) {\n", name, strings.Join(args, ", "), result)
+	}
+
+	urlPath := strconv.Quote(path)
+	for _, param := range params {
+		g.imports["net/url"] = true
+		urlPath = strings.Replace(urlPath, "{"+param.name+"}", `" + url.PathEscape(`+param.arg+`) + "`, 1)
+	}
+	urlPath = strings.TrimSuffix(strings.TrimPrefix(urlPath, `"" + `), ` + ""`)
+
+	query := "nil"
+	if paramsType != "" {
+		query = "params.values()"
+	}
+	fail := "return err"
+	if result != "" {
+		fail = "return " + zero + ", err"
+	}
+
+	switch {
+	case multipart:
+		fmt.Fprintf(m, "\tresp, err := c.doForm(ctx, %s, %s, body.parts())\n", methodConst(method), urlPath)
+	case bodyType != "":
+		fmt.Fprintf(m, "\tresp, err := c.do(ctx, %s, %s, %s, body)\n", methodConst(method), urlPath, query)
+	default:
+		fmt.Fprintf(m, "\tresp, err := c.do(ctx, %s, %s, %s, nil)\n", methodConst(method), urlPath, query)
+	}
+	fmt.Fprintf(m, "\tif err != nil {\n\t\t%s\n\t}\n", fail)
+
+	switch {
+	case len(successes) > 1:
+		fmt.Fprintf(m, "\tout := &%sResponse{StatusCode: resp.StatusCode}\n", name)
+		fmt.Fprintf(m, "\tswitch resp.StatusCode {\n")
+		for _, s := range successes {
+			if s.typ != "" {
+				fmt.Fprintf(m, "\tcase %d:\n\t\tout.JSON%d = new(%s)\n\t\terr = decodeResponse(resp, out.JSON%d)\n", s.status, s.status, s.typ, s.status)
+			}
+		}
+		fmt.Fprintf(m, "\tdefault:\n\t\terr = decodeResponse(resp, nil)\n\t}\n")
+		fmt.Fprintf(m, "\tif err != nil {\n\t\treturn nil, err\n\t}\n\treturn out, nil\n")
+	case result == "io.ReadCloser":
+		fmt.Fprintf(m, "\treturn resp.Body, nil\n")
+	case result == "":
+		fmt.Fprintf(m, "\treturn decodeResponse(resp, nil)\n")
+	case strings.HasPrefix(result, "*"):
+		fmt.Fprintf(m, "\tvar out %s\n", strings.TrimPrefix(result, "*"))
+		fmt.Fprintf(m, "\tif err := decodeResponse(resp, &out); err != nil {\n\t\treturn nil, err\n\t}\n\treturn &out, nil\n")
+	default:
+		fmt.Fprintf(m, "\tvar out %s\n", result)
+		fmt.Fprintf(m, "\tif err := decodeResponse(resp, &out); err != nil {\n\t\treturn nil, err\n\t}\n\treturn out, nil\n")
+	}
+	fmt.Fprintf(m, "}\n\n")
+	return nil
+}
+
+// resultType returns how a method returns a JSON body: structs by pointer,
+// slices and maps as they are
+func resultType(typ string) (string, string) {
+	if strings.HasPrefix(typ, "[]") || strings.HasPrefix(typ, "map[") || typ == "interface{}" {
+		return typ, "nil"
+	}
+	return "*" + typ, "nil"
+}
+
+func countSuccesses(op *api.OpenAPIOperation) int {
+	n := 0
+	for status := range op.Responses {
+		if code, err := strconv.Atoi(status); err == nil && code >= 200 && code <= 299 {
+			n++
+		}
+	}
+	return n
+}
+
+// declareParams declares the query parameters of an operation and their
+// encoding. Zero values are not sent. Exploded object parameters, such as
+// the list filters, are a map of parameters.
+func (g *generator) declareParams(name string, params []*api.OpenAPIParameter) error {
+	if g.names[name] {
+		return fmt.Errorf("type %s is declared twice", name)
+	}
+	g.names[name] = true
+	g.imports["net/url"] = true
+
+	var fields, encode bytes.Buffer
+	for _, param := range params {
+		schema := g.spec.Schema(param.Schema)
+		field := goName(param.Name)
+		if comment := firstSentence(param.Description); comment != "" {
+			fields.WriteString(wrapComment("\t", comment))
+		}
+
+		typ := "string"
+		if schema != nil {
+			typ = schema.Type.Primary()
+		}
+		switch {
+		case typ == "object":
+			fmt.Fprintf(&fields, "\t%s map[string]string\n", field)
+			fmt.Fprintf(&encode, "\tfor key, value := range p.%s {\n\t\tquery.Set(key, value)\n\t}\n", field)
+		case typ == "integer":
+			g.imports["strconv"] = true
+			fmt.Fprintf(&fields, "\t%s int\n", field)
+			fmt.Fprintf(&encode, "\tif p.%s != 0 {\n\t\tquery.Set(%q, strconv.Itoa(p.%s))\n\t}\n", field, param.Name, field)
+		case typ == "boolean":
+			g.imports["strconv"] = true
+			fmt.Fprintf(&fields, "\t%s *bool\n", field)
+			fmt.Fprintf(&encode, "\tif p.%s != nil {\n\t\tquery.Set(%q, strconv.FormatBool(*p.%s))\n\t}\n", field, param.Name, field)
+		case typ == "array":
+			fmt.Fprintf(&fields, "\t%s []string\n", field)
+			fmt.Fprintf(&encode, "\tfor _, value := range p.%s {\n\t\tquery.Add(%q, value)\n\t}\n", field, param.Name)
+		case typ == "string" && schema.Format == "date-time":
+			g.imports["time"] = true
+			fmt.Fprintf(&fields, "\t%s *time.Time\n", field)
+			fmt.Fprintf(&encode, "\tif p.%s != nil {\n\t\tquery.Set(%q, p.%s.Format(time.RFC3339Nano))\n\t}\n", field, param.Name, field)
+		default:
+			fmt.Fprintf(&fields, "\t%s string\n", field)
+			fmt.Fprintf(&encode, "\tif p.%s != \"\" {\n\t\tquery.Set(%q, p.%s)\n\t}\n", field, param.Name, field)
+		}
+	}
+
+	fmt.Fprintf(&g.types, "// %s are the query parameters of %s\ntype %s struct {\n%s}\n\n", name, lowerFirst(strings.TrimSuffix(name, "Params")), name, fields.String())
+	fmt.Fprintf(&g.types, "func (p *%s) values() url.Values {\n\tquery := url.Values{}\n\tif p == nil {\n\t\treturn query\n\t}\n%s\treturn query\n}\n\n", name, encode.String())
+	return nil
+}
+
+// declareForm declares a multipart form. Binary properties are read from an
+// io.Reader and sent last, after the other fields.
+func (g *generator) declareForm(name string, schema *api.OpenAPISchema) error {
+	if schema == nil || len(schema.Properties) == 0 {
+		return fmt.Errorf("multipart body without properties")
+	}
+	if g.names[name] {
+		return fmt.Errorf("type %s is declared twice", name)
+	}
+	g.names[name] = true
+	g.imports["io"] = true
+
+	names := make([]string, 0, len(schema.Properties))
+	for property := range schema.Properties {
+		names = append(names, property)
+	}
+	sort.Strings(names)
+
+	var fields, values, files bytes.Buffer
+	for _, property := range names {
+		propertySchema := g.spec.Schema(schema.Properties[property])
+		field := goName(property)
+		if propertySchema.Format == "binary" {
+			fmt.Fprintf(&fields, "\t%s io.Reader\n\t// %sFilename is the file name sent with %s\n\t%sFilename string\n", field, field, field, field)
+			fmt.Fprintf(&files, "\tparts = append(parts, formPart{name: %q, filename: f.%sFilename, content: f.%s})\n", property, field, field)
+			continue
+		}
+		if comment := fieldComment(propertySchema); comment != "" {
+			fields.WriteString(wrapComment("\t", comment))
+		}
+		fmt.Fprintf(&fields, "\t%s string\n", field)
+		fmt.Fprintf(&values, "\tif f.%s != \"\" {\n\t\tparts = append(parts, formPart{name: %q, value: f.%s})\n\t}\n", field, property, field)
+	}
+
+	fmt.Fprintf(&g.types, "// %s is the multipart form of %s\ntype %s struct {\n%s}\n\n", name, lowerFirst(strings.TrimSuffix(name, "Request")), name, fields.String())
+	fmt.Fprintf(&g.types, "func (f %s) parts() []formPart {\n\tvar parts []formPart\n%s%s\treturn parts\n}\n\n", name, values.String(), files.String())
+	return nil
+}
+
+// fieldComment describes a property: its description and allowed values
+func fieldComment(schema *api.OpenAPISchema) string {
+	if schema == nil {
+		return ""
+	}
+	comment := firstSentence(schema.Description)
+	if len(schema.Enum) > 0 {
+		values := make([]string, len(schema.Enum))
+		for i, value := range schema.Enum {
+			values[i] = fmt.Sprint(value)
+		}
+		if comment != "" {
+			comment += "; "
+		}
+		comment += "one of " + strings.Join(values, ", ")
+	}
+	return comment
+}
+
+// wrapComment writes text as a comment of lines up to 80 columns
+func wrapComment(indent, text string) string {
+	var b strings.Builder
+	line := ""
+	for _, word := range strings.Fields(text) {
+		if line != "" && len(line)+len(word) >= 76 {
+			b.WriteString(indent + "// " + line + "\n")
+			line = ""
+		}
+		if line != "" {
+			line += " "
+		}
+		line += word
+	}
+	b.WriteString(indent + "// " + line + "\n")
+	return b.String()
+}
+
+// firstSentence returns the first sentence of a description without its
+// final period
+func firstSentence(description string) string {
+	description = strings.Join(strings.Fields(description), " ")
+	if i := strings.Index(description, ". "); i >= 0 {
+		description = description[:i]
+	}
+	return strings.TrimSuffix(description, ".")
+}
+
+func refName(ref string) string {
+	return ref[strings.LastIndex(ref, "/")+1:]
+}
+
+// goName converts snake_case and camelCase names to exported Go names,
+// writing initialisms in capitals
+func goName(name string) string {
+	var b strings.Builder
+	for _, word := range words(name) {
+		if initialism, ok := initialisms[strings.ToLower(word)]; ok {
+			b.WriteString(initialism)
+			continue
+		}
+		r := []rune(word)
+		b.WriteString(string(unicode.ToUpper(r[0])) + string(r[1:]))
+	}
+	return b.String()
+}
+
+// lowerGoName is goName for unexported names
+func lowerGoName(name string) string {
+	all := words(name)
+	if len(all) == 0 {
+		return ""
+	}
+	return strings.ToLower(all[0]) + goName(strings.Join(all[1:], "_"))
+}
+
+func lowerFirst(name string) string {
+	r := []rune(name)
+	return string(unicode.ToLower(r[0])) + string(r[1:])
+}
+
+// words splits a name at underscores, dashes, dots and the start of
+// capitalized words
+func words(name string) []string {
+	var all []string
+	var word []rune
+	for i, r := range name {
+		switch {
+		case r == '_' || r == '-' || r == '.' || r == ' ':
+			if len(word) > 0 {
+				all = append(all, string(word))
+			}
+			word = nil
+			continue
+		case unicode.IsUpper(r) && i > 0 && len(word) > 0 && !unicode.IsUpper(word[len(word)-1]):
+			all = append(all, string(word))
+			word = nil
+		}
+		word = append(word, r)
+	}
+	if len(word) > 0 {
+		all = append(all, string(word))
+	}
+	return all
+}
+
+// singular names the item of a list named name
+func singular(name string) string {
+	switch {
+	case strings.HasSuffix(name, "ies"):
+		return strings.TrimSuffix(name, "ies") + "y"
+	case strings.HasSuffix(name, "ss"):
+		return name
+	case strings.HasSuffix(name, "s"):
+		return strings.TrimSuffix(name, "s")
+	}
+	return name + "Item"
+}
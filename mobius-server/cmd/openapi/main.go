@@ -0,0 +1,68 @@
+// Command openapi keeps the OpenAPI document of the /api/v1 routes honest.
+//
+//	openapi check                 compare api/openapi.yaml with the router
+//	openapi client -o FILE        generate the Go API client from the document
+//
+// Both run in CI; see .github/workflows/openapi.yml.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/notawar/mobius/mobius-server/api"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	spec, err := api.LoadOpenAPISpec()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	switch os.Args[1] {
+	case "check":
+		problems := spec.CheckRouter(api.NewRouter(&api.Dependencies{}))
+		for _, problem := range problems {
+			fmt.Fprintln(os.Stderr, problem)
+		}
+		if len(problems) > 0 {
+			fmt.Fprintf(os.Stderr, "api/openapi.yaml does not match the router: %d problems\n", len(problems))
+			os.Exit(1)
+		}
+		fmt.Println("api/openapi.yaml matches the router")
+
+	case "client":
+		flags := flag.NewFlagSet("client", flag.ExitOnError)
+		output := flags.String("o", "", "File to write the client to, stdout when empty")
+		pkg := flags.String("package", "apiclient", "Package name of the client")
+		flags.Parse(os.Args[2:]) //nolint:errcheck // exits on error
+
+		source, err := generateClient(spec, *pkg)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if *output == "" {
+			os.Stdout.Write(source) //nolint:errcheck
+			return
+		}
+		if err := os.WriteFile(*output, source, 0o644); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+	default:
+		usage()
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: openapi check | openapi client [-o FILE] [-package NAME]")
+	os.Exit(2)
+}
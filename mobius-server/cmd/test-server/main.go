@@ -2,6 +2,9 @@ package main
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"fmt"
 	"log"
 	"net/http"
@@ -10,9 +13,13 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/golang-jwt/jwt/v4"
+
 	"github.com/notawar/mobius/mobius-server/api"
+	"github.com/notawar/mobius/mobius-server/pkg/blobstore"
 	"github.com/notawar/mobius/mobius-server/pkg/service"
 	"github.com/notawar/mobius/mobius-server/pkg/websocket"
+	"github.com/notawar/mobius/mobius-server/server/health"
 )
 
 func main() {
@@ -23,22 +30,87 @@ func main() {
 	ctx := context.Background()
 	go wsHub.Run(ctx)
 
+	// The test server trusts a throwaway signing key and starts with an
+	// enterprise license so that every feature is available
+	licenseService, err := testLicenseService()
+	if err != nil {
+		log.Fatalf("Failed to create license: %v", err)
+	}
+
 	// Create service implementations
 	deviceService := service.NewDeviceService()
+	deviceService.SetLicenseService(licenseService)
 	policyService := service.NewPolicyService()
-	applicationService := service.NewApplicationService()
+	packageDir, err := os.MkdirTemp("", "mobius-packages-")
+	if err != nil {
+		log.Fatalf("Failed to create package directory: %v", err)
+	}
+	defer os.RemoveAll(packageDir)
+	packages, err := blobstore.NewFileStore(packageDir)
+	if err != nil {
+		log.Fatalf("Failed to create package store: %v", err)
+	}
+	applicationService := service.NewApplicationService(packages)
+	downloadSigner, err := service.NewURLSigner(nil)
+	if err != nil {
+		log.Fatalf("Failed to create download URL signer: %v", err)
+	}
 	authService := service.NewAuthService()
 	groupService := service.NewGroupService()
+	commandService := service.NewCommandService(deviceService)
+	commandService.SetWebSocketNotifier(websocket.NewServiceNotifier(wsHub))
+	liveQueryService := service.NewLiveQueryService()
+	liveQueryService.SetWebSocketNotifier(websocket.NewServiceNotifier(wsHub))
+	deviceGroupService := service.NewDeviceGroupService()
+	deviceGroupService.SetWebSocketNotifier(websocket.NewServiceNotifier(wsHub))
+	complianceService := service.NewComplianceService()
+	complianceService.SetWebSocketNotifier(websocket.NewServiceNotifier(wsHub))
+
+	probes := health.NewRegistry()
+	probes.Register(health.Probe{Name: "websocket_hub", Checker: health.CheckerFunc(wsHub.HealthCheckContext), Live: true})
+	probes.Register(health.Probe{Name: "blob_store", Checker: health.CheckerFunc(packages.HealthCheckContext), Optional: true})
+
+	// Every request and response is checked against the OpenAPI document
+	spec, err := api.LoadOpenAPISpec()
+	if err != nil {
+		log.Fatalf("Failed to load the OpenAPI document: %v", err)
+	}
+	openAPIValidator := api.NewOpenAPIValidator(spec)
+	openAPIValidator.ValidateResponses = true
 
 	// Create API dependencies with WebSocket support
 	deps := &api.Dependencies{
-		DeviceService:      deviceService,
-		PolicyService:      policyService,
-		GroupService:       groupService,
-		ApplicationService: applicationService,
-		AuthService:        authService,
+		LicenseService:            licenseService,
+		DeviceService:             deviceService,
+		DeviceGroupService:        deviceGroupService,
+		PolicyService:             policyService,
+		GroupService:              groupService,
+		ApplicationService:        applicationService,
+		AuthService:               authService,
+		UserService:               authService,
+		CommandService:            commandService,
+		LiveQueryService:          liveQueryService,
+		EnrollmentService:         service.NewEnrollmentService(),
+		ComplianceService:         complianceService,
+		AuditService:              service.NewAuditService(),
+		BulkOperationService:      service.NewBulkOperationService(),
+		ApplicationRequestService: service.NewApplicationRequestService(),
+		DownloadSigner:            downloadSigner,
+		Health:                    probes,
+		RateLimits: &api.RateLimits{
+			Store:           service.NewRateLimitStore(),
+			LoginPerMinute:  api.DefaultLoginPerMinute,
+			DevicePerMinute: api.DefaultDevicePerMinute,
+			UserPerMinute:   api.DefaultUserPerMinute,
+			PublicPerMinute: api.DefaultPublicPerMinute,
+		},
+		OpenAPIValidator: openAPIValidator,
+		Idempotency:      &api.Idempotency{Store: service.NewIdempotencyStore()},
 		WSHub:             wsHub,
 	}
+	if url := os.Getenv("MOBIUS_PACKAGE_SEARCH_URL"); url != "" {
+		deps.PackageSearchService = service.NewPackageSearchClient(url, nil)
+	}
 
 	// Create router
 	router := api.NewRouter(deps)
@@ -83,3 +155,29 @@ func main() {
 
 	fmt.Println("✅ Server exited cleanly")
 }
+
+// testLicenseService returns a license service holding an enterprise license
+// signed with a key generated for this run
+func testLicenseService() (*service.LicenseServiceImpl, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	licenseService := service.NewLicenseServiceWithKey(&key.PublicKey)
+
+	license, err := service.SignLicense(key, service.LicenseClaims{
+		Tier:         service.TierEnterprise,
+		Organization: "Mobius Test Server",
+		DeviceLimit:  -1,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().AddDate(1, 0, 0)),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := licenseService.UpdateLicense(license); err != nil {
+		return nil, err
+	}
+	return licenseService, nil
+}
@@ -0,0 +1,142 @@
+// Package blobstore stores application packages. Packages are kept on the
+// local filesystem or in an S3-compatible bucket.
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/notawar/mobius/mobius-server/server/config"
+	"github.com/notawar/mobius/mobius-server/server/datastore/s3"
+)
+
+// ErrNotFound is returned when a blob does not exist
+var ErrNotFound = errors.New("blob not found")
+
+// Store stores blobs by ID
+type Store interface {
+	// Put stores content under id, replacing any previous blob
+	Put(ctx context.Context, id string, content io.ReadSeeker) error
+	// Get returns the blob and its size; the caller closes the reader
+	Get(ctx context.Context, id string) (io.ReadCloser, int64, error)
+	// Delete removes the blob; deleting a missing blob is not an error
+	Delete(ctx context.Context, id string) error
+}
+
+// IsNotFound reports whether err means the blob does not exist
+func IsNotFound(err error) bool {
+	var nf interface{ IsNotFound() bool }
+	return errors.Is(err, ErrNotFound) || (errors.As(err, &nf) && nf.IsNotFound())
+}
+
+// FileStore keeps blobs as files in a directory
+type FileStore struct {
+	dir string
+}
+
+// NewFileStore creates a store in dir, creating the directory if needed
+func NewFileStore(dir string) (*FileStore, error) {
+	if dir == "" {
+		return nil, errors.New("blob store directory is required")
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("create blob store directory: %w", err)
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+func (s *FileStore) path(id string) (string, error) {
+	if id == "" || id != filepath.Base(id) || strings.HasPrefix(id, ".") {
+		return "", fmt.Errorf("invalid blob id %q", id)
+	}
+	return filepath.Join(s.dir, id), nil
+}
+
+// Put writes content to a temporary file and moves it into place, so readers
+// never see a partial blob
+func (s *FileStore) Put(ctx context.Context, id string, content io.ReadSeeker) error {
+	path, err := s.path(id)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(s.dir, ".upload-*")
+	if err != nil {
+		return fmt.Errorf("create blob: %w", err)
+	}
+	defer os.Remove(tmp.Name()) //nolint:errcheck
+
+	if _, err := io.Copy(tmp, content); err != nil {
+		tmp.Close() //nolint:errcheck
+		return fmt.Errorf("write blob: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write blob: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("store blob: %w", err)
+	}
+	return nil
+}
+
+// Get opens the blob
+func (s *FileStore) Get(ctx context.Context, id string) (io.ReadCloser, int64, error) {
+	path, err := s.path(id)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, 0, ErrNotFound
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("open blob: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close() //nolint:errcheck
+		return nil, 0, fmt.Errorf("stat blob: %w", err)
+	}
+	return f, info.Size(), nil
+}
+
+// Delete removes the blob
+func (s *FileStore) Delete(ctx context.Context, id string) error {
+	path, err := s.path(id)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("delete blob: %w", err)
+	}
+	return nil
+}
+
+// HealthCheckContext checks that blobs can be written to the directory
+func (s *FileStore) HealthCheckContext(ctx context.Context) error {
+	tmp, err := os.CreateTemp(s.dir, ".health-*")
+	if err != nil {
+		return fmt.Errorf("write to blob store: %w", err)
+	}
+	tmp.Close() //nolint:errcheck
+	if err := os.Remove(tmp.Name()); err != nil {
+		return fmt.Errorf("write to blob store: %w", err)
+	}
+	return nil
+}
+
+// NewS3Store creates a store in the software installers bucket of cfg, under
+// the application-packages prefix
+func NewS3Store(cfg config.S3Config) (Store, error) {
+	store, err := s3.NewApplicationPackageStore(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("create S3 blob store: %w", err)
+	}
+	return store, nil
+}
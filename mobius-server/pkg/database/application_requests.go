@@ -0,0 +1,186 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/notawar/mobius/mobius-server/api"
+	"github.com/notawar/mobius/mobius-server/pkg/service"
+)
+
+// applicationRequestRow is the storage representation of
+// api.ApplicationRequest
+type applicationRequestRow struct {
+	ID            string     `db:"id"`
+	ApplicationID string     `db:"application_id"`
+	DeviceID      string     `db:"device_id"`
+	Status        string     `db:"status"`
+	Reason        string     `db:"reason"`
+	DecidedBy     string     `db:"decided_by"`
+	DecisionNote  string     `db:"decision_note"`
+	CommandID     string     `db:"command_id"`
+	CreatedAt     time.Time  `db:"created_at"`
+	DecidedAt     *time.Time `db:"decided_at"`
+}
+
+const applicationRequestColumns = `id, application_id, device_id, status, COALESCE(reason, '') AS reason, decided_by,
+COALESCE(decision_note, '') AS decision_note, command_id, created_at, decided_at`
+
+func (r *applicationRequestRow) toAPI() *api.ApplicationRequest {
+	return &api.ApplicationRequest{
+		ID:            r.ID,
+		ApplicationID: r.ApplicationID,
+		DeviceID:      r.DeviceID,
+		Status:        r.Status,
+		Reason:        r.Reason,
+		DecidedBy:     r.DecidedBy,
+		DecisionNote:  r.DecisionNote,
+		CommandID:     r.CommandID,
+		CreatedAt:     r.CreatedAt,
+		DecidedAt:     r.DecidedAt,
+	}
+}
+
+// applicationRequestListTable answers list queries over application requests
+var applicationRequestListTable = listTable{
+	from: "application_requests",
+	id:   "id",
+	columns: map[string]string{
+		"id":             "id",
+		"status":         "status",
+		"application_id": "application_id",
+		"device_id":      "device_id",
+		"decided_by":     "decided_by",
+		"created_at":     "created_at",
+		"decided_at":     "decided_at",
+	},
+	deviceColumn: "device_id",
+}
+
+// ApplicationRequestService is a database-backed implementation of
+// api.ApplicationRequestService
+type ApplicationRequestService struct {
+	db *DB
+}
+
+// NewApplicationRequestService creates a new database-backed application
+// request service
+func NewApplicationRequestService(db *DB) *ApplicationRequestService {
+	return &ApplicationRequestService{db: db}
+}
+
+// CreateApplicationRequest records a pending request unless the device
+// already has one for the application
+func (s *ApplicationRequestService) CreateApplicationRequest(req api.ApplicationRequestCreate) (*api.ApplicationRequest, error) {
+	tx, err := s.db.conn.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	var pending int
+	err = tx.Get(&pending, "SELECT COUNT(*) FROM application_requests WHERE device_id = ? AND application_id = ? AND status = ?",
+		req.DeviceID, req.ApplicationID, api.AppRequestStatusPending)
+	if err != nil {
+		return nil, fmt.Errorf("check pending application requests: %w", err)
+	}
+	if pending > 0 {
+		return nil, api.ErrApplicationRequestPending
+	}
+
+	request := &api.ApplicationRequest{
+		ID:            generateID(),
+		ApplicationID: req.ApplicationID,
+		DeviceID:      req.DeviceID,
+		Status:        api.AppRequestStatusPending,
+		Reason:        req.Reason,
+		CreatedAt:     time.Now().UTC(),
+	}
+	_, err = tx.Exec(`INSERT INTO application_requests (id, application_id, device_id, status, reason, created_at)
+VALUES (?, ?, ?, ?, ?, ?)`,
+		request.ID, request.ApplicationID, request.DeviceID, request.Status, request.Reason, request.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("insert application request: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+// GetApplicationRequest returns a request by ID
+func (s *ApplicationRequestService) GetApplicationRequest(id string) (*api.ApplicationRequest, error) {
+	var row applicationRequestRow
+	err := s.db.conn.Get(&row, "SELECT "+applicationRequestColumns+" FROM application_requests WHERE id = ?", id)
+	if isNotFound(err) {
+		return nil, fmt.Errorf("application request not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get application request: %w", err)
+	}
+	return row.toAPI(), nil
+}
+
+// ListApplicationRequests returns the requests of a device, or of every
+// device if deviceID is empty, newest first
+func (s *ApplicationRequestService) ListApplicationRequests(deviceID string) ([]*api.ApplicationRequest, error) {
+	query := "SELECT " + applicationRequestColumns + " FROM application_requests"
+	var args []interface{}
+	if deviceID != "" {
+		query += " WHERE device_id = ?"
+		args = append(args, deviceID)
+	}
+	query += " ORDER BY created_at DESC, id DESC"
+
+	var rows []applicationRequestRow
+	if err := s.db.conn.Select(&rows, query, args...); err != nil {
+		return nil, fmt.Errorf("list application requests: %w", err)
+	}
+
+	requests := make([]*api.ApplicationRequest, 0, len(rows))
+	for i := range rows {
+		requests = append(requests, rows[i].toAPI())
+	}
+	return requests, nil
+}
+
+// QueryApplicationRequests answers a list query over the requests of every
+// device
+func (s *ApplicationRequestService) QueryApplicationRequests(q *api.ListQuery) ([]*api.ApplicationRequest, int, error) {
+	var rows []applicationRequestRow
+	total, err := s.db.queryList(&rows, applicationRequestColumns, applicationRequestListTable, q, nil, nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("list application requests: %w", err)
+	}
+
+	requests := make([]*api.ApplicationRequest, 0, len(rows))
+	for i := range rows {
+		requests = append(requests, rows[i].toAPI())
+	}
+	return requests, total, nil
+}
+
+// DecideApplicationRequest approves or denies a pending request. The update
+// only applies while the request is pending, so concurrent decisions cannot
+// both win.
+func (s *ApplicationRequestService) DecideApplicationRequest(id string, decision api.ApplicationRequestDecision) (*api.ApplicationRequest, error) {
+	request, err := s.GetApplicationRequest(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := service.ApplyApplicationDecision(request, decision, time.Now().UTC()); err != nil {
+		return nil, err
+	}
+
+	res, err := s.db.conn.Exec(`UPDATE application_requests SET status = ?, decided_by = ?, decision_note = ?, command_id = ?,
+	decided_at = ? WHERE id = ? AND status = ?`,
+		request.Status, request.DecidedBy, request.DecisionNote, request.CommandID, request.DecidedAt,
+		id, api.AppRequestStatusPending)
+	if err != nil {
+		return nil, fmt.Errorf("decide application request: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, api.ErrApplicationRequestDecided
+	}
+	return request, nil
+}
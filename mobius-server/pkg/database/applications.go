@@ -0,0 +1,378 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/notawar/mobius/mobius-server/api"
+	"github.com/notawar/mobius/mobius-server/pkg/blobstore"
+	"github.com/notawar/mobius/mobius-server/pkg/service"
+)
+
+// applicationRow is the storage representation of api.Application
+type applicationRow struct {
+	ID          string    `db:"id"`
+	Name        string    `db:"name"`
+	Version     string    `db:"version"`
+	Platform    string    `db:"platform"`
+	BundleID    string    `db:"bundle_id"`
+	PackageType string    `db:"package_type"`
+	Filename    string    `db:"filename"`
+	Size        int64     `db:"size"`
+	Checksum    string    `db:"checksum"`
+	CreatedAt   time.Time `db:"created_at"`
+	Revision    int       `db:"revision"`
+
+	Source                 string     `db:"source"`
+	InstallCommand         string     `db:"install_command"`
+	UninstallCommand       string     `db:"uninstall_command"`
+	DetectionQuery         string     `db:"detection_query"`
+	LatestVersion          string     `db:"latest_version"`
+	LatestVersionCheckedAt *time.Time `db:"latest_version_checked_at"`
+}
+
+const applicationColumns = `id, name, version, platform, bundle_id, package_type, filename, size, checksum, created_at, revision,
+	COALESCE(source, '') AS source, COALESCE(install_command, '') AS install_command,
+	COALESCE(uninstall_command, '') AS uninstall_command, COALESCE(detection_query, '') AS detection_query,
+	latest_version, latest_version_checked_at`
+
+func (r *applicationRow) toAPI() (*api.Application, error) {
+	app := &api.Application{
+		ID:                     r.ID,
+		Name:                   r.Name,
+		Version:                r.Version,
+		Platform:               r.Platform,
+		BundleID:               r.BundleID,
+		PackageType:            r.PackageType,
+		Filename:               r.Filename,
+		Size:                   r.Size,
+		Checksum:               r.Checksum,
+		CreatedAt:              r.CreatedAt,
+		Revision:               r.Revision,
+		InstallCommand:         r.InstallCommand,
+		UninstallCommand:       r.UninstallCommand,
+		DetectionQuery:         r.DetectionQuery,
+		LatestVersion:          r.LatestVersion,
+		LatestVersionCheckedAt: r.LatestVersionCheckedAt,
+	}
+	if err := decodeJSON(r.Source, &app.Source); err != nil {
+		return nil, fmt.Errorf("decode application source: %w", err)
+	}
+	app.UpdateAvailable = service.UpdateAvailable(app)
+	return app, nil
+}
+
+// applicationListTable answers list queries over applications. Whether an
+// update is available is computed from the versions, so update_available is
+// filtered on in memory.
+var applicationListTable = listTable{
+	from: "applications",
+	id:   "id",
+	columns: map[string]string{
+		"id":             "id",
+		"name":           "name",
+		"version":        "version",
+		"platform":       "platform",
+		"bundle_id":      "bundle_id",
+		"package_type":   "package_type",
+		"filename":       "filename",
+		"size":           "size",
+		"created_at":     "created_at",
+		"latest_version": "NULLIF(latest_version, '')",
+	},
+}
+
+// ApplicationService is a database-backed implementation of api.ApplicationService
+type ApplicationService struct {
+	db       *DB
+	packages blobstore.Store
+}
+
+// NewApplicationService creates a new database-backed application service
+// storing packages in packages
+func NewApplicationService(db *DB, packages blobstore.Store) *ApplicationService {
+	return &ApplicationService{db: db, packages: packages}
+}
+
+// ListApplications returns all applications
+func (s *ApplicationService) ListApplications() ([]*api.Application, error) {
+	var rows []applicationRow
+	if err := s.db.conn.Select(&rows, "SELECT "+applicationColumns+" FROM applications ORDER BY created_at, id"); err != nil {
+		return nil, fmt.Errorf("list applications: %w", err)
+	}
+
+	applications := make([]*api.Application, 0, len(rows))
+	for i := range rows {
+		app, err := rows[i].toAPI()
+		if err != nil {
+			return nil, err
+		}
+		applications = append(applications, app)
+	}
+	return applications, nil
+}
+
+// QueryApplications answers a list query over the applications
+func (s *ApplicationService) QueryApplications(q *api.ListQuery) ([]*api.Application, int, error) {
+	var rows []applicationRow
+	total, err := s.db.queryList(&rows, applicationColumns, applicationListTable, q, nil, nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("list applications: %w", err)
+	}
+
+	applications := make([]*api.Application, 0, len(rows))
+	for i := range rows {
+		app, err := rows[i].toAPI()
+		if err != nil {
+			return nil, 0, err
+		}
+		applications = append(applications, app)
+	}
+	return applications, total, nil
+}
+
+// GetApplication returns an application by ID
+func (s *ApplicationService) GetApplication(id string) (*api.Application, error) {
+	var row applicationRow
+	err := s.db.conn.Get(&row, "SELECT "+applicationColumns+" FROM applications WHERE id = ?", id)
+	if isNotFound(err) {
+		return nil, fmt.Errorf("application not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get application: %w", err)
+	}
+	return row.toAPI()
+}
+
+// AddApplication stores the package and adds the application
+func (s *ApplicationService) AddApplication(appCreate api.ApplicationCreate) (*api.Application, error) {
+	prepared, err := service.PreparePackage(appCreate)
+	if err != nil {
+		return nil, err
+	}
+	defer prepared.Close() //nolint:errcheck
+
+	app := prepared.Application
+	app.ID = generateID()
+	app.CreatedAt = time.Now().UTC()
+	app.Revision = 1
+
+	ctx := context.Background()
+	if err := s.packages.Put(ctx, app.ID, prepared.File); err != nil {
+		return nil, fmt.Errorf("store package: %w", err)
+	}
+
+	_, err = s.db.conn.Exec(`INSERT INTO applications (id, name, version, platform, bundle_id, package_type, filename,
+	size, checksum, created_at, revision)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		app.ID, app.Name, app.Version, app.Platform, app.BundleID, app.PackageType, app.Filename,
+		app.Size, app.Checksum, app.CreatedAt, app.Revision)
+	if err != nil {
+		s.packages.Delete(ctx, app.ID) //nolint:errcheck
+		return nil, fmt.Errorf("insert application: %w", err)
+	}
+	return app, nil
+}
+
+// ImportApplication adds an application from a package of the package
+// search catalog
+func (s *ApplicationService) ImportApplication(imp api.ApplicationImport) (*api.Application, error) {
+	app, err := service.PrepareImport(imp)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	app.ID = generateID()
+	app.CreatedAt = now
+	app.LatestVersionCheckedAt = &now
+	app.Revision = 1
+
+	source, err := encodeJSON(app.Source)
+	if err != nil {
+		return nil, err
+	}
+	_, err = s.db.conn.Exec(`INSERT INTO applications (id, name, version, platform, bundle_id, package_type, filename,
+	size, checksum, created_at, revision, source, install_command, uninstall_command, detection_query,
+	latest_version, latest_version_checked_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		app.ID, app.Name, app.Version, app.Platform, app.BundleID, app.PackageType, app.Filename,
+		app.Size, app.Checksum, app.CreatedAt, app.Revision, source, app.InstallCommand, app.UninstallCommand,
+		app.DetectionQuery, app.LatestVersion, app.LatestVersionCheckedAt)
+	if err != nil {
+		return nil, fmt.Errorf("insert application: %w", err)
+	}
+	return app, nil
+}
+
+// SetLatestVersion records the latest upstream version of an application.
+// It is not a change of the application, so its revision is kept.
+func (s *ApplicationService) SetLatestVersion(id, version string, checkedAt time.Time) (*api.Application, error) {
+	res, err := s.db.conn.Exec("UPDATE applications SET latest_version = ?, latest_version_checked_at = ? WHERE id = ?",
+		version, checkedAt, id)
+	if err != nil {
+		return nil, fmt.Errorf("update application: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, fmt.Errorf("application not found")
+	}
+	return s.GetApplication(id)
+}
+
+// UpdateApplication updates an existing application
+func (s *ApplicationService) UpdateApplication(id string, updates api.ApplicationUpdate) (*api.Application, error) {
+	app, err := s.GetApplication(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if updates.Name != nil {
+		app.Name = *updates.Name
+	}
+	if updates.Version != nil {
+		app.Version = *updates.Version
+	}
+
+	res, err := s.db.conn.Exec("UPDATE applications SET name = ?, version = ?, revision = revision + 1 WHERE id = ?"+revisionCondition,
+		app.Name, app.Version, id, updates.IfRevision, updates.IfRevision)
+	if err != nil {
+		return nil, fmt.Errorf("update application: %w", err)
+	}
+	if err := checkRevision(res); err != nil {
+		return nil, err
+	}
+	app.UpdateAvailable = service.UpdateAvailable(app)
+	app.Revision++
+	return app, nil
+}
+
+// DeleteApplication deletes an application, its publications and its
+// package
+func (s *ApplicationService) DeleteApplication(id string) error {
+	tx, err := s.db.conn.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	res, err := tx.Exec("DELETE FROM applications WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("delete application: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("application not found")
+	}
+	if _, err := tx.Exec("DELETE FROM application_publications WHERE application_id = ?", id); err != nil {
+		return fmt.Errorf("delete application publications: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	if err := s.packages.Delete(context.Background(), id); err != nil {
+		return fmt.Errorf("delete package: %w", err)
+	}
+	return nil
+}
+
+// OpenPackage returns the package of an application and its size
+func (s *ApplicationService) OpenPackage(id string) (io.ReadCloser, int64, error) {
+	if _, err := s.GetApplication(id); err != nil {
+		return nil, 0, err
+	}
+	return s.packages.Get(context.Background(), id)
+}
+
+// applicationPublicationRow is the storage representation of
+// api.ApplicationPublication
+type applicationPublicationRow struct {
+	ApplicationID string    `db:"application_id"`
+	GroupID       string    `db:"group_id"`
+	Restricted    bool      `db:"restricted"`
+	PublishedAt   time.Time `db:"published_at"`
+}
+
+const applicationPublicationColumns = `application_id, group_id, restricted, published_at`
+
+func (r *applicationPublicationRow) toAPI() *api.ApplicationPublication {
+	return &api.ApplicationPublication{
+		ApplicationID: r.ApplicationID,
+		GroupID:       r.GroupID,
+		Restricted:    r.Restricted,
+		PublishedAt:   r.PublishedAt,
+	}
+}
+
+// ListPublications returns the publications of every application
+func (s *ApplicationService) ListPublications() ([]*api.ApplicationPublication, error) {
+	return s.listPublications("SELECT " + applicationPublicationColumns +
+		" FROM application_publications ORDER BY application_id, group_id")
+}
+
+// ListApplicationPublications returns the groups an application is
+// published to
+func (s *ApplicationService) ListApplicationPublications(appID string) ([]*api.ApplicationPublication, error) {
+	return s.listPublications("SELECT "+applicationPublicationColumns+
+		" FROM application_publications WHERE application_id = ? ORDER BY group_id", appID)
+}
+
+func (s *ApplicationService) listPublications(query string, args ...interface{}) ([]*api.ApplicationPublication, error) {
+	var rows []applicationPublicationRow
+	if err := s.db.conn.Select(&rows, query, args...); err != nil {
+		return nil, fmt.Errorf("list application publications: %w", err)
+	}
+
+	publications := make([]*api.ApplicationPublication, 0, len(rows))
+	for i := range rows {
+		publications = append(publications, rows[i].toAPI())
+	}
+	return publications, nil
+}
+
+// PublishApplication publishes an application to a device group, or
+// updates whether it is restricted there
+func (s *ApplicationService) PublishApplication(appID, groupID string, restricted bool) (*api.ApplicationPublication, error) {
+	if _, err := s.GetApplication(appID); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.conn.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	var row applicationPublicationRow
+	err = tx.Get(&row, "SELECT "+applicationPublicationColumns+
+		" FROM application_publications WHERE application_id = ? AND group_id = ?", appID, groupID)
+	switch {
+	case isNotFound(err):
+		row = applicationPublicationRow{ApplicationID: appID, GroupID: groupID, Restricted: restricted, PublishedAt: time.Now().UTC()}
+		_, err = tx.Exec("INSERT INTO application_publications (application_id, group_id, restricted, published_at) VALUES (?, ?, ?, ?)",
+			row.ApplicationID, row.GroupID, row.Restricted, row.PublishedAt)
+	case err == nil:
+		row.Restricted = restricted
+		_, err = tx.Exec("UPDATE application_publications SET restricted = ? WHERE application_id = ? AND group_id = ?",
+			restricted, appID, groupID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("publish application: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return row.toAPI(), nil
+}
+
+// UnpublishApplication removes an application from a device group
+func (s *ApplicationService) UnpublishApplication(appID, groupID string) error {
+	res, err := s.db.conn.Exec("DELETE FROM application_publications WHERE application_id = ? AND group_id = ?", appID, groupID)
+	if err != nil {
+		return fmt.Errorf("unpublish application: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("publication not found")
+	}
+	return nil
+}
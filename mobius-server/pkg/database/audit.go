@@ -0,0 +1,190 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/notawar/mobius/mobius-server/api"
+	"github.com/notawar/mobius/mobius-server/pkg/service"
+)
+
+// auditEntryRow is the storage representation of api.AuditEntry
+type auditEntryRow struct {
+	ID            string `db:"id"`
+	CreatedUS     int64  `db:"created_us"`
+	ActorType     string `db:"actor_type"`
+	ActorID       string `db:"actor_id"`
+	ActorEmail    string `db:"actor_email"`
+	ActorRole     string `db:"actor_role"`
+	Action        string `db:"action"`
+	TargetType    string `db:"target_type"`
+	TargetID      string `db:"target_id"`
+	Outcome       string `db:"outcome"`
+	Reason        string `db:"reason"`
+	RequestMethod string `db:"request_method"`
+	RequestPath   string `db:"request_path"`
+	ClientIP      string `db:"client_ip"`
+	UserAgent     string `db:"user_agent"`
+	Changes       string `db:"changes"`
+	Details       string `db:"details"`
+}
+
+const auditEntryColumns = `id, created_us, actor_type, actor_id, actor_email, actor_role, action,
+target_type, target_id, outcome, COALESCE(reason, '') AS reason, request_method,
+COALESCE(request_path, '') AS request_path, client_ip, COALESCE(user_agent, '') AS user_agent,
+COALESCE(changes, '') AS changes, COALESCE(details, '') AS details`
+
+func (r *auditEntryRow) toAPI() (*api.AuditEntry, error) {
+	entry := &api.AuditEntry{
+		ID:        r.ID,
+		Timestamp: time.UnixMicro(r.CreatedUS).UTC(),
+		Actor: api.AuditActor{
+			Type:  r.ActorType,
+			ID:    r.ActorID,
+			Email: r.ActorEmail,
+			Role:  r.ActorRole,
+		},
+		Action:     r.Action,
+		TargetType: r.TargetType,
+		TargetID:   r.TargetID,
+		Outcome:    r.Outcome,
+		Reason:     r.Reason,
+		Request: api.AuditRequest{
+			Method:    r.RequestMethod,
+			Path:      r.RequestPath,
+			ClientIP:  r.ClientIP,
+			UserAgent: r.UserAgent,
+		},
+	}
+	if err := decodeJSON(r.Changes, &entry.Changes); err != nil {
+		return nil, fmt.Errorf("decode changes of audit entry %s: %w", r.ID, err)
+	}
+	if err := decodeJSON(r.Details, &entry.Details); err != nil {
+		return nil, fmt.Errorf("decode details of audit entry %s: %w", r.ID, err)
+	}
+	return entry, nil
+}
+
+// AuditService is a database-backed implementation of api.AuditService
+type AuditService struct {
+	db *DB
+}
+
+// NewAuditService creates a new database-backed audit service
+func NewAuditService(db *DB) *AuditService {
+	return &AuditService{db: db}
+}
+
+// RecordAudit stores an entry, assigning its ID and timestamp when unset
+func (s *AuditService) RecordAudit(entry *api.AuditEntry) error {
+	service.PrepareAuditEntry(entry, time.Now())
+
+	var changes, details string
+	if len(entry.Changes) > 0 {
+		encoded, err := encodeJSON(entry.Changes)
+		if err != nil {
+			return fmt.Errorf("encode audit changes: %w", err)
+		}
+		changes = encoded
+	}
+	if len(entry.Details) > 0 {
+		encoded, err := encodeJSON(entry.Details)
+		if err != nil {
+			return fmt.Errorf("encode audit details: %w", err)
+		}
+		details = encoded
+	}
+
+	_, err := s.db.conn.Exec(`INSERT INTO audit_entries
+(id, created_us, actor_type, actor_id, actor_email, actor_role, action, target_type, target_id,
+outcome, reason, request_method, request_path, client_ip, user_agent, changes, details)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		entry.ID, entry.Timestamp.UnixMicro(), entry.Actor.Type, entry.Actor.ID, entry.Actor.Email,
+		entry.Actor.Role, entry.Action, entry.TargetType, entry.TargetID, entry.Outcome, entry.Reason,
+		entry.Request.Method, entry.Request.Path, entry.Request.ClientIP, entry.Request.UserAgent,
+		changes, details)
+	if err != nil {
+		return fmt.Errorf("insert audit entry: %w", err)
+	}
+	return nil
+}
+
+// ListAuditEntries returns a page of the entries matching filters, newest first
+func (s *AuditService) ListAuditEntries(filters api.AuditFilters) (*api.AuditPage, error) {
+	var (
+		where []string
+		args  []interface{}
+	)
+	if filters.Cursor != "" {
+		cursor, err := service.DecodeAuditCursor(filters.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		us := cursor.Timestamp.UnixMicro()
+		where = append(where, "(created_us < ? OR (created_us = ? AND id < ?))")
+		args = append(args, us, us, cursor.ID)
+	}
+	for _, f := range []struct{ column, value string }{
+		{"actor_id", filters.ActorID},
+		{"actor_type", filters.ActorType},
+		{"target_type", filters.TargetType},
+		{"target_id", filters.TargetID},
+		{"outcome", filters.Outcome},
+	} {
+		if f.value != "" {
+			where = append(where, f.column+" = ?")
+			args = append(args, f.value)
+		}
+	}
+	if filters.Action != "" {
+		if strings.HasSuffix(filters.Action, ".") {
+			where = append(where, "action LIKE ? ESCAPE '!'")
+			args = append(args, escapeLike(filters.Action)+"%")
+		} else {
+			where = append(where, "action = ?")
+			args = append(args, filters.Action)
+		}
+	}
+	if filters.Since != nil {
+		where = append(where, "created_us >= ?")
+		args = append(args, filters.Since.UnixMicro())
+	}
+	if filters.Until != nil {
+		where = append(where, "created_us < ?")
+		args = append(args, filters.Until.UnixMicro())
+	}
+
+	limit := service.AuditLimit(filters.Limit)
+	query := "SELECT " + auditEntryColumns + " FROM audit_entries"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	// One extra row tells whether there is a next page
+	query += " ORDER BY created_us DESC, id DESC LIMIT ?"
+	args = append(args, limit+1)
+
+	var rows []auditEntryRow
+	if err := s.db.conn.Select(&rows, query, args...); err != nil {
+		return nil, fmt.Errorf("list audit entries: %w", err)
+	}
+
+	page := &api.AuditPage{Entries: make([]*api.AuditEntry, 0, len(rows))}
+	for i := range rows {
+		if i == limit {
+			page.NextCursor = service.NewAuditCursor(page.Entries[limit-1]).Encode()
+			break
+		}
+		entry, err := rows[i].toAPI()
+		if err != nil {
+			return nil, err
+		}
+		page.Entries = append(page.Entries, entry)
+	}
+	return page, nil
+}
+
+// escapeLike escapes the LIKE wildcards of s with '!'
+func escapeLike(s string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(s)
+}
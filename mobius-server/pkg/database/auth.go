@@ -0,0 +1,522 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/notawar/mobius/mobius-server/api"
+	"github.com/notawar/mobius/mobius-server/pkg/service"
+)
+
+// userRow is the storage representation of api.User
+type userRow struct {
+	ID                 string    `db:"id"`
+	Email              string    `db:"email"`
+	Name               string    `db:"name"`
+	Role               string    `db:"role"`
+	DeviceGroupIDs     string    `db:"device_group_ids"`
+	PasswordHash       string    `db:"password_hash"`
+	MustChangePassword bool      `db:"must_change_password"`
+	CreatedAt          time.Time `db:"created_at"`
+	UpdatedAt          time.Time `db:"updated_at"`
+	Revision           int       `db:"revision"`
+}
+
+const userColumns = `u.id, u.email, u.name, u.role, COALESCE(u.device_group_ids, '') AS device_group_ids,
+	u.password_hash, u.must_change_password, u.created_at, u.updated_at, u.revision`
+
+func (r *userRow) toAPI() (*api.User, error) {
+	user := &api.User{
+		ID:        r.ID,
+		Email:     r.Email,
+		Name:      r.Name,
+		Role:      r.Role,
+		CreatedAt: r.CreatedAt,
+		UpdatedAt: r.UpdatedAt,
+		Revision:  r.Revision,
+
+		MustChangePassword: r.MustChangePassword,
+	}
+	if err := decodeJSON(r.DeviceGroupIDs, &user.DeviceGroupIDs); err != nil {
+		return nil, fmt.Errorf("decode user device groups: %w", err)
+	}
+	return user, nil
+}
+
+// setDeviceGroupIDs stores the device groups a user is limited to
+func (r *userRow) setDeviceGroupIDs(ids []string) error {
+	if len(ids) == 0 {
+		r.DeviceGroupIDs = ""
+		return nil
+	}
+	encoded, err := encodeJSON(ids)
+	if err != nil {
+		return fmt.Errorf("encode user device groups: %w", err)
+	}
+	r.DeviceGroupIDs = encoded
+	return nil
+}
+
+// userListTable answers list queries over users
+var userListTable = listTable{
+	from: "users u",
+	id:   "u.id",
+	columns: map[string]string{
+		"id":         "u.id",
+		"email":      "u.email",
+		"name":       "u.name",
+		"role":       "u.role",
+		"created_at": "u.created_at",
+		"updated_at": "u.updated_at",
+	},
+}
+
+// sessionRow is a stored login session
+type sessionRow struct {
+	ID               string    `db:"id"`
+	UserID           string    `db:"user_id"`
+	RefreshTokenHash string    `db:"refresh_token_hash"`
+	ExpiresAt        time.Time `db:"expires_at"`
+}
+
+// AuthService is a database-backed implementation of api.AuthService and
+// api.UserService
+type AuthService struct {
+	db     *DB
+	tokens *service.TokenIssuer
+}
+
+// NewAuthService creates a new database-backed auth service that signs
+// access tokens with tokens
+func NewAuthService(db *DB, tokens *service.TokenIssuer) *AuthService {
+	return &AuthService{db: db, tokens: tokens}
+}
+
+// Login authenticates a user and returns a token pair
+func (s *AuthService) Login(email, password string) (*api.AuthResponse, error) {
+	var row userRow
+	err := s.db.conn.Get(&row, "SELECT "+userColumns+" FROM users u WHERE LOWER(u.email) = LOWER(?)", email)
+	if isNotFound(err) {
+		return nil, fmt.Errorf("invalid credentials")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get user: %w", err)
+	}
+
+	if err := service.CheckPassword([]byte(row.PasswordHash), password); err != nil {
+		return nil, fmt.Errorf("invalid credentials")
+	}
+
+	refreshToken, refreshHash, err := service.NewRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	sessionID := generateID()
+	now := time.Now().UTC()
+	refreshExpiresAt := now.Add(s.tokens.RefreshTTL)
+
+	_, err = s.db.conn.Exec("INSERT INTO user_sessions (id, user_id, refresh_token_hash, expires_at, created_at) VALUES (?, ?, ?, ?, ?)",
+		sessionID, row.ID, refreshHash, refreshExpiresAt, now)
+	if err != nil {
+		return nil, fmt.Errorf("store session: %w", err)
+	}
+
+	user, err := row.toAPI()
+	if err != nil {
+		return nil, err
+	}
+	return s.authResponse(user, sessionID, refreshToken, refreshExpiresAt)
+}
+
+// Refresh rotates a refresh token and returns a new token pair
+func (s *AuthService) Refresh(refreshToken string) (*api.AuthResponse, error) {
+	tx, err := s.db.conn.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	var sess sessionRow
+	err = tx.Get(&sess, "SELECT id, user_id, refresh_token_hash, expires_at FROM user_sessions WHERE refresh_token_hash = ?",
+		service.HashToken(refreshToken))
+	if isNotFound(err) {
+		return nil, fmt.Errorf("invalid refresh token")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get session: %w", err)
+	}
+
+	if time.Now().After(sess.ExpiresAt) {
+		if _, err := tx.Exec("DELETE FROM user_sessions WHERE id = ?", sess.ID); err != nil {
+			return nil, fmt.Errorf("delete session: %w", err)
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("refresh token expired")
+	}
+
+	var row userRow
+	err = tx.Get(&row, "SELECT "+userColumns+" FROM users u WHERE u.id = ?", sess.UserID)
+	if isNotFound(err) {
+		return nil, fmt.Errorf("invalid refresh token")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get user: %w", err)
+	}
+
+	newToken, newHash, err := service.NewRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	refreshExpiresAt := time.Now().UTC().Add(s.tokens.RefreshTTL)
+
+	// Match on the old hash so that a concurrent refresh with the same token
+	// cannot rotate the session twice
+	res, err := tx.Exec("UPDATE user_sessions SET refresh_token_hash = ?, expires_at = ? WHERE id = ? AND refresh_token_hash = ?",
+		newHash, refreshExpiresAt, sess.ID, sess.RefreshTokenHash)
+	if err != nil {
+		return nil, fmt.Errorf("rotate session: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return nil, fmt.Errorf("invalid refresh token")
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	user, err := row.toAPI()
+	if err != nil {
+		return nil, err
+	}
+	return s.authResponse(user, sess.ID, newToken, refreshExpiresAt)
+}
+
+// Logout revokes the session of an access token
+func (s *AuthService) Logout(token string) error {
+	claims, err := s.tokens.ParseAccessToken(token)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.db.conn.Exec("DELETE FROM user_sessions WHERE id = ?", claims.SessionID); err != nil {
+		return fmt.Errorf("delete session: %w", err)
+	}
+	return nil
+}
+
+// ValidateToken validates a user access token
+func (s *AuthService) ValidateToken(token string) (*api.User, error) {
+	claims, err := s.tokens.ParseAccessToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	var row userRow
+	err = s.db.conn.Get(&row, "SELECT "+userColumns+
+		" FROM users u JOIN user_sessions s ON s.user_id = u.id WHERE s.id = ? AND u.id = ?",
+		claims.SessionID, claims.Subject)
+	if isNotFound(err) {
+		return nil, fmt.Errorf("invalid token: session revoked")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("validate token: %w", err)
+	}
+	return row.toAPI()
+}
+
+// ValidateDeviceToken validates a device token
+func (s *AuthService) ValidateDeviceToken(token string) (*api.Device, error) {
+	var row deviceRow
+	err := s.db.conn.Get(&row, "SELECT "+deviceColumns+
+		" FROM devices WHERE id = (SELECT device_id FROM device_tokens WHERE token_hash = ?)", service.HashToken(token))
+	if isNotFound(err) {
+		return nil, fmt.Errorf("invalid device token")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("validate device token: %w", err)
+	}
+	return row.toAPI()
+}
+
+// IssueDeviceToken issues a new token for a device, replacing any token it
+// held before
+func (s *AuthService) IssueDeviceToken(device *api.Device) (string, error) {
+	token, hash, err := service.NewDeviceToken()
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := s.db.conn.Beginx()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	if _, err := tx.Exec("DELETE FROM device_tokens WHERE device_id = ?", device.ID); err != nil {
+		return "", fmt.Errorf("replace device token: %w", err)
+	}
+	if _, err := tx.Exec("INSERT INTO device_tokens (device_id, token_hash, created_at) VALUES (?, ?, ?)",
+		device.ID, hash, time.Now().UTC()); err != nil {
+		return "", fmt.Errorf("insert device token: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// RevokeDeviceToken revokes the token of a device
+func (s *AuthService) RevokeDeviceToken(deviceID string) error {
+	if _, err := s.db.conn.Exec("DELETE FROM device_tokens WHERE device_id = ?", deviceID); err != nil {
+		return fmt.Errorf("revoke device token: %w", err)
+	}
+	return nil
+}
+
+// ListUsers returns all users ordered by email
+func (s *AuthService) ListUsers() ([]*api.User, error) {
+	var rows []userRow
+	if err := s.db.conn.Select(&rows, "SELECT "+userColumns+" FROM users u ORDER BY u.email"); err != nil {
+		return nil, fmt.Errorf("list users: %w", err)
+	}
+
+	users := make([]*api.User, 0, len(rows))
+	for i := range rows {
+		user, err := rows[i].toAPI()
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+// QueryUsers answers a list query over the users
+func (s *AuthService) QueryUsers(q *api.ListQuery) ([]*api.User, int, error) {
+	var rows []userRow
+	total, err := s.db.queryList(&rows, userColumns, userListTable, q, nil, nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("list users: %w", err)
+	}
+
+	users := make([]*api.User, 0, len(rows))
+	for i := range rows {
+		user, err := rows[i].toAPI()
+		if err != nil {
+			return nil, 0, err
+		}
+		users = append(users, user)
+	}
+	return users, total, nil
+}
+
+// GetUser returns a user by ID
+func (s *AuthService) GetUser(id string) (*api.User, error) {
+	var row userRow
+	err := s.db.conn.Get(&row, "SELECT "+userColumns+" FROM users u WHERE u.id = ?", id)
+	if isNotFound(err) {
+		return nil, fmt.Errorf("user not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get user: %w", err)
+	}
+	return row.toAPI()
+}
+
+// CreateUser creates a user account with a hashed password
+func (s *AuthService) CreateUser(create api.UserCreate) (*api.User, error) {
+	if err := service.ValidateUserCreate(create); err != nil {
+		return nil, err
+	}
+	hash, err := service.HashPassword(create.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.conn.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	var count int
+	if err := tx.Get(&count, "SELECT COUNT(*) FROM users WHERE LOWER(email) = LOWER(?)", create.Email); err != nil {
+		return nil, fmt.Errorf("check email: %w", err)
+	}
+	if count > 0 {
+		return nil, fmt.Errorf("user with email %s already exists", create.Email)
+	}
+
+	now := time.Now().UTC()
+	row := userRow{
+		ID:           generateID(),
+		Email:        create.Email,
+		Name:         create.Name,
+		Role:         create.Role,
+		PasswordHash: string(hash),
+		CreatedAt:    now,
+		UpdatedAt:    now,
+		Revision:     1,
+	}
+	if err := row.setDeviceGroupIDs(create.DeviceGroupIDs); err != nil {
+		return nil, err
+	}
+	_, err = tx.NamedExec(`INSERT INTO users (id, email, name, role, device_group_ids, password_hash, created_at, updated_at,
+	revision)
+VALUES (:id, :email, :name, :role, :device_group_ids, :password_hash, :created_at, :updated_at, :revision)`, &row)
+	if err != nil {
+		return nil, fmt.Errorf("insert user: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return row.toAPI()
+}
+
+// UpdateUser updates a user; changing the password revokes existing sessions
+func (s *AuthService) UpdateUser(id string, updates api.UserUpdate) (*api.User, error) {
+	var hash []byte
+	if updates.Password != nil {
+		if err := service.ValidatePasswordRequirements(*updates.Password); err != nil {
+			return nil, err
+		}
+		var err error
+		if hash, err = service.HashPassword(*updates.Password); err != nil {
+			return nil, err
+		}
+	}
+
+	tx, err := s.db.conn.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	var row userRow
+	err = tx.Get(&row, "SELECT "+userColumns+" FROM users u WHERE u.id = ?", id)
+	if isNotFound(err) {
+		return nil, fmt.Errorf("user not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get user: %w", err)
+	}
+	if updates.IfRevision != 0 && updates.IfRevision != row.Revision {
+		return nil, api.ErrRevisionConflict
+	}
+
+	user, err := row.toAPI()
+	if err != nil {
+		return nil, err
+	}
+	if updates.Role != nil {
+		user.Role = *updates.Role
+	}
+	if updates.DeviceGroupIDs != nil {
+		user.DeviceGroupIDs = *updates.DeviceGroupIDs
+	}
+	if err := service.ValidateUserRole(user.Role, user.DeviceGroupIDs); err != nil {
+		return nil, err
+	}
+
+	if updates.Name != nil {
+		row.Name = *updates.Name
+	}
+	row.Role = user.Role
+	if err := row.setDeviceGroupIDs(user.DeviceGroupIDs); err != nil {
+		return nil, err
+	}
+	if hash != nil {
+		row.PasswordHash = string(hash)
+		row.MustChangePassword = false
+		if _, err := tx.Exec("DELETE FROM user_sessions WHERE user_id = ?", id); err != nil {
+			return nil, fmt.Errorf("revoke sessions: %w", err)
+		}
+	}
+	row.UpdatedAt = time.Now().UTC()
+
+	query := `UPDATE users SET name = :name, role = :role, device_group_ids = :device_group_ids,
+password_hash = :password_hash, must_change_password = :must_change_password, updated_at = :updated_at,
+revision = revision + 1 WHERE id = :id`
+	if updates.IfRevision != 0 {
+		// Another transaction may have changed the row since it was read
+		query += ` AND revision = :revision`
+	}
+	res, err := tx.NamedExec(query, &row)
+	if err != nil {
+		return nil, fmt.Errorf("update user: %w", err)
+	}
+	if err := checkRevision(res); err != nil {
+		return nil, err
+	}
+	row.Revision++
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return row.toAPI()
+}
+
+// VerifyPassword returns api.ErrInvalidPassword unless password is the user's
+func (s *AuthService) VerifyPassword(id, password string) error {
+	var hash string
+	err := s.db.conn.Get(&hash, "SELECT password_hash FROM users WHERE id = ?", id)
+	if isNotFound(err) {
+		return fmt.Errorf("user not found")
+	}
+	if err != nil {
+		return fmt.Errorf("get user: %w", err)
+	}
+	if err := service.CheckPassword([]byte(hash), password); err != nil {
+		return api.ErrInvalidPassword
+	}
+	return nil
+}
+
+// DeleteUser deletes a user and revokes their sessions
+func (s *AuthService) DeleteUser(id string) error {
+	tx, err := s.db.conn.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	res, err := tx.Exec("DELETE FROM users WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("delete user: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return fmt.Errorf("user not found")
+	}
+	if _, err := tx.Exec("DELETE FROM user_sessions WHERE user_id = ?", id); err != nil {
+		return fmt.Errorf("revoke sessions: %w", err)
+	}
+	return tx.Commit()
+}
+
+// RevokeUserSessions revokes every session of a user
+func (s *AuthService) RevokeUserSessions(id string) error {
+	if _, err := s.GetUser(id); err != nil {
+		return err
+	}
+	if _, err := s.db.conn.Exec("DELETE FROM user_sessions WHERE user_id = ?", id); err != nil {
+		return fmt.Errorf("revoke sessions: %w", err)
+	}
+	return nil
+}
+
+// authResponse issues an access token for the session and builds the response
+func (s *AuthService) authResponse(user *api.User, sessionID, refreshToken string, refreshExpiresAt time.Time) (*api.AuthResponse, error) {
+	accessToken, expiresAt, err := s.tokens.IssueAccessToken(user, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return &api.AuthResponse{
+		Token:            accessToken,
+		ExpiresAt:        expiresAt,
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: refreshExpiresAt,
+		User:             user,
+	}, nil
+}
@@ -0,0 +1,268 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/notawar/mobius/mobius-server/api"
+	"github.com/notawar/mobius/mobius-server/pkg/service"
+)
+
+// bulkOperationRow is the storage representation of api.BulkOperation
+type bulkOperationRow struct {
+	ID         string     `db:"id"`
+	Status     string     `db:"status"`
+	Action     string     `db:"action"`
+	Selector   string     `db:"selector"`
+	CreatedBy  string     `db:"created_by"`
+	CreatedAt  time.Time  `db:"created_at"`
+	UpdatedAt  time.Time  `db:"updated_at"`
+	FinishedAt *time.Time `db:"finished_at"`
+	Total      int        `db:"total"`
+	Processed  int        `db:"processed"`
+	Succeeded  int        `db:"succeeded"`
+	Failed     int        `db:"failed"`
+}
+
+const bulkOperationColumns = `id, status, action, selector, created_by, created_at, updated_at, finished_at,
+total, processed, succeeded, failed`
+
+func (r *bulkOperationRow) toAPI() (*api.BulkOperation, error) {
+	op := &api.BulkOperation{
+		ID:         r.ID,
+		Status:     r.Status,
+		CreatedBy:  r.CreatedBy,
+		CreatedAt:  r.CreatedAt,
+		UpdatedAt:  r.UpdatedAt,
+		FinishedAt: r.FinishedAt,
+		Total:      r.Total,
+		Processed:  r.Processed,
+		Succeeded:  r.Succeeded,
+		Failed:     r.Failed,
+	}
+	if err := decodeJSON(r.Action, &op.Action); err != nil {
+		return nil, fmt.Errorf("decode bulk action: %w", err)
+	}
+	if err := decodeJSON(r.Selector, &op.Selector); err != nil {
+		return nil, fmt.Errorf("decode bulk selector: %w", err)
+	}
+	return op, nil
+}
+
+// bulkOperationListTable answers list queries over bulk operations, whose
+// action is stored as JSON
+func (db *DB) bulkOperationListTable() listTable {
+	return listTable{
+		from: "bulk_operations",
+		id:   "id",
+		columns: map[string]string{
+			"id":          "id",
+			"status":      "status",
+			"action":      db.jsonText("action", "$.type"),
+			"created_by":  "created_by",
+			"created_at":  "created_at",
+			"updated_at":  "updated_at",
+			"finished_at": "finished_at",
+			"total":       "total",
+			"failed":      "failed",
+		},
+	}
+}
+
+// BulkOperationService is a database-backed implementation of
+// api.BulkOperationService
+type BulkOperationService struct {
+	db *DB
+}
+
+// NewBulkOperationService creates a new database-backed bulk operation service
+func NewBulkOperationService(db *DB) *BulkOperationService {
+	return &BulkOperationService{db: db}
+}
+
+// CreateBulkOperation records a new running operation
+func (s *BulkOperationService) CreateBulkOperation(req api.BulkOperationCreate) (*api.BulkOperation, error) {
+	op := service.NewBulkOperation(generateID(), req, time.Now().UTC())
+
+	action, err := encodeJSON(op.Action)
+	if err != nil {
+		return nil, err
+	}
+	selector, err := encodeJSON(op.Selector)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.db.conn.Exec("INSERT INTO bulk_operations ("+bulkOperationColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		op.ID, op.Status, action, selector, op.CreatedBy, op.CreatedAt, op.UpdatedAt, op.FinishedAt,
+		op.Total, op.Processed, op.Succeeded, op.Failed)
+	if err != nil {
+		return nil, fmt.Errorf("insert bulk operation: %w", err)
+	}
+	return op, nil
+}
+
+// GetBulkOperation returns an operation and its failures
+func (s *BulkOperationService) GetBulkOperation(id string) (*api.BulkOperation, error) {
+	op, err := loadBulkOperation(s.db.conn, id)
+	if isNotFound(err) {
+		return nil, fmt.Errorf("bulk operation not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get bulk operation: %w", err)
+	}
+
+	var rows []struct {
+		DeviceID string `db:"device_id"`
+		Error    string `db:"error"`
+	}
+	err = s.db.conn.Select(&rows, `SELECT device_id, COALESCE(error, '') AS error
+FROM bulk_operation_failures WHERE operation_id = ? ORDER BY position`, id)
+	if err != nil {
+		return nil, fmt.Errorf("list bulk operation failures: %w", err)
+	}
+	for _, row := range rows {
+		op.Failures = append(op.Failures, api.BulkFailure{DeviceID: row.DeviceID, Error: row.Error})
+	}
+	return op, nil
+}
+
+// ListBulkOperations returns every operation without its failures, newest
+// first
+func (s *BulkOperationService) ListBulkOperations() ([]*api.BulkOperation, error) {
+	var rows []bulkOperationRow
+	if err := s.db.conn.Select(&rows, "SELECT "+bulkOperationColumns+
+		" FROM bulk_operations ORDER BY created_at DESC, id DESC"); err != nil {
+		return nil, fmt.Errorf("list bulk operations: %w", err)
+	}
+
+	operations := make([]*api.BulkOperation, 0, len(rows))
+	for i := range rows {
+		op, err := rows[i].toAPI()
+		if err != nil {
+			return nil, err
+		}
+		operations = append(operations, op)
+	}
+	return operations, nil
+}
+
+// QueryBulkOperations answers a list query over the operations, without
+// their failures
+func (s *BulkOperationService) QueryBulkOperations(q *api.ListQuery) ([]*api.BulkOperation, int, error) {
+	var rows []bulkOperationRow
+	total, err := s.db.queryList(&rows, bulkOperationColumns, s.db.bulkOperationListTable(), q, nil, nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("list bulk operations: %w", err)
+	}
+
+	operations := make([]*api.BulkOperation, 0, len(rows))
+	for i := range rows {
+		op, err := rows[i].toAPI()
+		if err != nil {
+			return nil, 0, err
+		}
+		operations = append(operations, op)
+	}
+	return operations, total, nil
+}
+
+// RecordBulkResult counts the outcome for a device
+func (s *BulkOperationService) RecordBulkResult(id, deviceID, errMsg string) error {
+	failed := 0
+	if errMsg != "" {
+		failed = 1
+	}
+
+	tx, err := s.db.conn.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	res, err := tx.Exec(`UPDATE bulk_operations SET processed = processed + 1, succeeded = succeeded + ?,
+failed = failed + ?, updated_at = ? WHERE id = ?`, 1-failed, failed, time.Now().UTC(), id)
+	if err != nil {
+		return fmt.Errorf("update bulk operation: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("bulk operation not found")
+	}
+
+	if failed > 0 {
+		var position int
+		if err := tx.Get(&position, "SELECT processed FROM bulk_operations WHERE id = ?", id); err != nil {
+			return fmt.Errorf("get bulk operation: %w", err)
+		}
+		if _, err := tx.Exec("INSERT INTO bulk_operation_failures (operation_id, position, device_id, error) VALUES (?, ?, ?, ?)",
+			id, position, deviceID, errMsg); err != nil {
+			return fmt.Errorf("insert bulk operation failure: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// FinishBulkOperation settles the status of a running operation
+func (s *BulkOperationService) FinishBulkOperation(id string) (*api.BulkOperation, error) {
+	op, err := loadBulkOperation(s.db.conn, id)
+	if isNotFound(err) {
+		return nil, fmt.Errorf("bulk operation not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get bulk operation: %w", err)
+	}
+
+	if op.Status == api.BulkStatusRunning {
+		// A cancellation since loading the operation takes precedence
+		now := time.Now().UTC()
+		if _, err := s.db.conn.Exec("UPDATE bulk_operations SET status = ?, updated_at = ?, finished_at = ? WHERE id = ? AND status = ?",
+			service.SettledBulkStatus(op), now, now, id, api.BulkStatusRunning); err != nil {
+			return nil, fmt.Errorf("finish bulk operation: %w", err)
+		}
+	}
+	return s.GetBulkOperation(id)
+}
+
+// CancelBulkOperation cancels a running operation
+func (s *BulkOperationService) CancelBulkOperation(id string) (*api.BulkOperation, error) {
+	now := time.Now().UTC()
+	res, err := s.db.conn.Exec("UPDATE bulk_operations SET status = ?, updated_at = ?, finished_at = ? WHERE id = ? AND status = ?",
+		api.BulkStatusCancelled, now, now, id, api.BulkStatusRunning)
+	if err != nil {
+		return nil, fmt.Errorf("cancel bulk operation: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		if _, err := s.GetBulkOperation(id); err != nil {
+			return nil, err
+		}
+		return nil, api.ErrBulkOperationFinished
+	}
+	return s.GetBulkOperation(id)
+}
+
+// InterruptBulkOperations marks the running operations without progress
+// since before as interrupted
+func (s *BulkOperationService) InterruptBulkOperations(before time.Time) (int, error) {
+	now := time.Now().UTC()
+	res, err := s.db.conn.Exec("UPDATE bulk_operations SET status = ?, updated_at = ?, finished_at = ? WHERE status = ? AND updated_at < ?",
+		api.BulkStatusInterrupted, now, now, api.BulkStatusRunning, before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("interrupt bulk operations: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("interrupt bulk operations: %w", err)
+	}
+	return int(n), nil
+}
+
+func loadBulkOperation(q sqlx.Queryer, id string) (*api.BulkOperation, error) {
+	var row bulkOperationRow
+	if err := sqlx.Get(q, &row, "SELECT "+bulkOperationColumns+" FROM bulk_operations WHERE id = ?", id); err != nil {
+		return nil, err
+	}
+	return row.toAPI()
+}
@@ -0,0 +1,387 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/notawar/mobius/mobius-server/api"
+	"github.com/notawar/mobius/mobius-server/pkg/service"
+)
+
+// commandRow is the storage representation of api.DeviceCommand
+type commandRow struct {
+	ID             string     `db:"id"`
+	DeviceID       string     `db:"device_id"`
+	Command        string     `db:"command"`
+	Parameters     string     `db:"parameters"`
+	Status         string     `db:"status"`
+	Result         string     `db:"result"`
+	Error          string     `db:"error"`
+	CreatedBy      string     `db:"created_by"`
+	CreatedAt      time.Time  `db:"created_at"`
+	UpdatedAt      time.Time  `db:"updated_at"`
+	ExpiresAt      time.Time  `db:"expires_at"`
+	DeliveredAt    *time.Time `db:"delivered_at"`
+	AcknowledgedAt *time.Time `db:"acknowledged_at"`
+	CompletedAt    *time.Time `db:"completed_at"`
+}
+
+const commandColumns = `id, device_id, command, COALESCE(parameters, '') AS parameters, status,
+COALESCE(result, '') AS result, COALESCE(error, '') AS error, created_by, created_at, updated_at,
+expires_at, delivered_at, acknowledged_at, completed_at`
+
+// nonTerminalStatuses is the SQL list of statuses a command can still leave
+const nonTerminalStatuses = "('" + api.CommandStatusPending + "', '" + api.CommandStatusDelivered + "', '" + api.CommandStatusAcknowledged + "')"
+
+func (r *commandRow) toAPI() (*api.DeviceCommand, error) {
+	cmd := &api.DeviceCommand{
+		ID:             r.ID,
+		DeviceID:       r.DeviceID,
+		Command:        r.Command,
+		Status:         r.Status,
+		Error:          r.Error,
+		CreatedBy:      r.CreatedBy,
+		CreatedAt:      r.CreatedAt,
+		UpdatedAt:      r.UpdatedAt,
+		ExpiresAt:      r.ExpiresAt,
+		DeliveredAt:    r.DeliveredAt,
+		AcknowledgedAt: r.AcknowledgedAt,
+		CompletedAt:    r.CompletedAt,
+	}
+	if err := decodeJSON(r.Parameters, &cmd.Parameters); err != nil {
+		return nil, fmt.Errorf("decode command parameters: %w", err)
+	}
+	if err := decodeJSON(r.Result, &cmd.Result); err != nil {
+		return nil, fmt.Errorf("decode command result: %w", err)
+	}
+	return cmd, nil
+}
+
+// commandListTable answers list queries over device commands
+var commandListTable = listTable{
+	from: "device_commands",
+	id:   "id",
+	columns: map[string]string{
+		"id":           "id",
+		"device_id":    "device_id",
+		"command":      "command",
+		"status":       "status",
+		"created_by":   "created_by",
+		"created_at":   "created_at",
+		"updated_at":   "updated_at",
+		"expires_at":   "expires_at",
+		"completed_at": "completed_at",
+	},
+	deviceColumn: "device_id",
+}
+
+// CommandService is a database-backed implementation of api.CommandService
+type CommandService struct {
+	db         *DB
+	wsNotifier service.WebSocketNotifier
+}
+
+// NewCommandService creates a new database-backed command service
+func NewCommandService(db *DB) *CommandService {
+	return &CommandService{
+		db:         db,
+		wsNotifier: &service.NoOpWebSocketNotifier{},
+	}
+}
+
+// SetWebSocketNotifier sets the WebSocket notifier
+func (s *CommandService) SetWebSocketNotifier(notifier service.WebSocketNotifier) {
+	s.wsNotifier = notifier
+}
+
+// EnqueueCommand queues a command for a device whether or not it is online
+func (s *CommandService) EnqueueCommand(deviceID string, req api.CommandCreate) (*api.DeviceCommand, error) {
+	var count int
+	if err := s.db.conn.Get(&count, "SELECT COUNT(*) FROM devices WHERE id = ?", deviceID); err != nil {
+		return nil, fmt.Errorf("check device: %w", err)
+	}
+	if count == 0 {
+		return nil, fmt.Errorf("device not found")
+	}
+
+	cmd := service.NewDeviceCommand(generateID(), deviceID, req, time.Now().UTC())
+	parameters, err := encodeJSON(cmd.Parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.db.conn.Exec(`INSERT INTO device_commands (id, device_id, command, parameters, status, created_by, created_at, updated_at, expires_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		cmd.ID, cmd.DeviceID, cmd.Command, parameters, cmd.Status, cmd.CreatedBy, cmd.CreatedAt, cmd.UpdatedAt, cmd.ExpiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("insert command: %w", err)
+	}
+
+	s.notify(cmd)
+	return cmd, nil
+}
+
+// GetCommand returns a command by ID
+func (s *CommandService) GetCommand(id string) (*api.DeviceCommand, error) {
+	var row commandRow
+	err := s.db.conn.Get(&row, "SELECT "+commandColumns+" FROM device_commands WHERE id = ?", id)
+	if isNotFound(err) {
+		return nil, fmt.Errorf("command not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get command: %w", err)
+	}
+	return row.toAPI()
+}
+
+// ListCommands returns commands matching filters, newest first
+func (s *CommandService) ListCommands(filters api.CommandFilters) ([]*api.DeviceCommand, error) {
+	var (
+		where []string
+		args  []interface{}
+	)
+	if filters.DeviceID != "" {
+		where = append(where, "device_id = ?")
+		args = append(args, filters.DeviceID)
+	}
+	if filters.Status != "" {
+		where = append(where, "status = ?")
+		args = append(args, filters.Status)
+	}
+
+	query := "SELECT " + commandColumns + " FROM device_commands"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY created_at DESC, id DESC"
+	if filters.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filters.Limit)
+	}
+
+	var rows []commandRow
+	if err := s.db.conn.Select(&rows, query, args...); err != nil {
+		return nil, fmt.Errorf("list commands: %w", err)
+	}
+	return commandsFromRows(rows)
+}
+
+// QueryCommands answers a list query over the commands
+func (s *CommandService) QueryCommands(q *api.ListQuery) ([]*api.DeviceCommand, int, error) {
+	var rows []commandRow
+	total, err := s.db.queryList(&rows, commandColumns, commandListTable, q, nil, nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("list commands: %w", err)
+	}
+	commands, err := commandsFromRows(rows)
+	return commands, total, err
+}
+
+// FetchCommands returns the outstanding commands of a device, oldest first,
+// and marks pending ones as delivered
+func (s *CommandService) FetchCommands(deviceID string) ([]*api.DeviceCommand, error) {
+	tx, err := s.db.conn.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	var rows []commandRow
+	err = tx.Select(&rows, "SELECT "+commandColumns+" FROM device_commands WHERE device_id = ? AND status IN "+
+		nonTerminalStatuses+" ORDER BY created_at, id", deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("list device commands: %w", err)
+	}
+	pending, err := commandsFromRows(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	commands := make([]*api.DeviceCommand, 0, len(pending))
+	var changed []*api.DeviceCommand
+	for _, cmd := range pending {
+		previous := cmd.Status
+		switch {
+		case !now.Before(cmd.ExpiresAt):
+			err = service.TransitionCommand(cmd, api.CommandStatusExpired, now)
+		case cmd.Status == api.CommandStatusPending:
+			err = service.TransitionCommand(cmd, api.CommandStatusDelivered, now)
+		default:
+			err = nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if cmd.Status != previous {
+			if err := saveCommand(tx, cmd, previous); err != nil {
+				return nil, err
+			}
+			changed = append(changed, cmd)
+		}
+		if cmd.Status == api.CommandStatusDelivered {
+			commands = append(commands, cmd)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	for _, cmd := range changed {
+		s.notify(cmd)
+	}
+	return commands, nil
+}
+
+// AcknowledgeCommand records that a device received a command and started it
+func (s *CommandService) AcknowledgeCommand(deviceID, commandID string) (*api.DeviceCommand, error) {
+	return s.transition(deviceID, commandID, func(cmd *api.DeviceCommand, now time.Time) error {
+		return service.TransitionCommand(cmd, api.CommandStatusAcknowledged, now)
+	})
+}
+
+// ReportCommandResult records the outcome of a command reported by a device
+func (s *CommandService) ReportCommandResult(deviceID, commandID string, report api.CommandResultReport) (*api.DeviceCommand, error) {
+	return s.transition(deviceID, commandID, func(cmd *api.DeviceCommand, now time.Time) error {
+		return service.ApplyCommandResult(cmd, report, now)
+	})
+}
+
+// ExpireCommands marks unfinished commands past their deadline as expired
+func (s *CommandService) ExpireCommands() (int, error) {
+	now := time.Now().UTC()
+
+	tx, err := s.db.conn.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	var rows []commandRow
+	err = tx.Select(&rows, "SELECT "+commandColumns+" FROM device_commands WHERE status IN "+
+		nonTerminalStatuses+" AND expires_at <= ?", now)
+	if err != nil {
+		return 0, fmt.Errorf("list expired commands: %w", err)
+	}
+	expired, err := commandsFromRows(rows)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, cmd := range expired {
+		previous := cmd.Status
+		if err := service.TransitionCommand(cmd, api.CommandStatusExpired, now); err != nil {
+			return 0, err
+		}
+		if err := saveCommand(tx, cmd, previous); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	for _, cmd := range expired {
+		s.notify(cmd)
+	}
+	return len(expired), nil
+}
+
+// CountCommands counts the commands in each status
+func (s *CommandService) CountCommands() (map[string]int, error) {
+	var rows []struct {
+		Status string `db:"status"`
+		Count  int    `db:"count"`
+	}
+	if err := s.db.conn.Select(&rows, "SELECT status, COUNT(*) AS count FROM device_commands GROUP BY status"); err != nil {
+		return nil, fmt.Errorf("count commands: %w", err)
+	}
+
+	counts := make(map[string]int, len(rows))
+	for _, row := range rows {
+		counts[row.Status] = row.Count
+	}
+	return counts, nil
+}
+
+// transition applies fn to a command owned by deviceID and publishes the change
+func (s *CommandService) transition(deviceID, commandID string, fn func(*api.DeviceCommand, time.Time) error) (*api.DeviceCommand, error) {
+	tx, err := s.db.conn.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	var row commandRow
+	err = tx.Get(&row, "SELECT "+commandColumns+" FROM device_commands WHERE id = ? AND device_id = ?", commandID, deviceID)
+	if isNotFound(err) {
+		return nil, fmt.Errorf("command not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get command: %w", err)
+	}
+	cmd, err := row.toAPI()
+	if err != nil {
+		return nil, err
+	}
+
+	previous := cmd.Status
+	if err := fn(cmd, time.Now().UTC()); err != nil {
+		return nil, err
+	}
+	if err := saveCommand(tx, cmd, previous); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	s.notify(cmd)
+	return cmd, nil
+}
+
+// notify publishes the current status of a command
+func (s *CommandService) notify(cmd *api.DeviceCommand) {
+	s.wsNotifier.BroadcastCommandExecution(cmd.ID, cmd.DeviceID, cmd.Command, cmd.Status, service.CommandEventResult(cmd))
+}
+
+// saveCommand persists a status change. The update only applies while the
+// stored status still equals previous, so concurrent transitions of the same
+// command cannot both succeed.
+func saveCommand(tx *sqlx.Tx, cmd *api.DeviceCommand, previous string) error {
+	result, err := encodeJSON(cmd.Result)
+	if err != nil {
+		return err
+	}
+
+	res, err := tx.Exec(`UPDATE device_commands SET status = ?, result = ?, error = ?, updated_at = ?,
+delivered_at = ?, acknowledged_at = ?, completed_at = ? WHERE id = ? AND status = ?`,
+		cmd.Status, result, cmd.Error, cmd.UpdatedAt,
+		cmd.DeliveredAt, cmd.AcknowledgedAt, cmd.CompletedAt, cmd.ID, previous)
+	if err != nil {
+		return fmt.Errorf("update command: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("command was modified concurrently")
+	}
+	return nil
+}
+
+func commandsFromRows(rows []commandRow) ([]*api.DeviceCommand, error) {
+	commands := make([]*api.DeviceCommand, 0, len(rows))
+	for i := range rows {
+		cmd, err := rows[i].toAPI()
+		if err != nil {
+			return nil, err
+		}
+		commands = append(commands, cmd)
+	}
+	return commands, nil
+}
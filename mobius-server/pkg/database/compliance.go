@@ -0,0 +1,199 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/notawar/mobius/mobius-server/api"
+	"github.com/notawar/mobius/mobius-server/pkg/service"
+)
+
+// policyResultRow is the storage representation of api.PolicyResult
+type policyResultRow struct {
+	ID              string    `db:"id"`
+	DeviceID        string    `db:"device_id"`
+	PolicyID        string    `db:"policy_id"`
+	Seq             int       `db:"seq"`
+	Status          string    `db:"status"`
+	Message         string    `db:"message"`
+	FirstReportedAt time.Time `db:"first_reported_at"`
+	LastReportedAt  time.Time `db:"last_reported_at"`
+	Reports         int       `db:"reports"`
+}
+
+const policyResultColumns = `id, device_id, policy_id, seq, status, COALESCE(message, '') AS message,
+first_reported_at, last_reported_at, reports`
+
+func (r *policyResultRow) toAPI() *api.PolicyResult {
+	return &api.PolicyResult{
+		DeviceID:        r.DeviceID,
+		PolicyID:        r.PolicyID,
+		Status:          r.Status,
+		Message:         r.Message,
+		FirstReportedAt: r.FirstReportedAt,
+		LastReportedAt:  r.LastReportedAt,
+		Reports:         r.Reports,
+	}
+}
+
+func policyResultsFromRows(rows []policyResultRow) []*api.PolicyResult {
+	results := make([]*api.PolicyResult, 0, len(rows))
+	for i := range rows {
+		results = append(results, rows[i].toAPI())
+	}
+	return results
+}
+
+// ComplianceService is a database-backed implementation of api.ComplianceService
+type ComplianceService struct {
+	db         *DB
+	wsNotifier service.WebSocketNotifier
+}
+
+// NewComplianceService creates a new database-backed compliance service
+func NewComplianceService(db *DB) *ComplianceService {
+	return &ComplianceService{
+		db:         db,
+		wsNotifier: &service.NoOpWebSocketNotifier{},
+	}
+}
+
+// SetWebSocketNotifier sets the WebSocket notifier
+func (s *ComplianceService) SetWebSocketNotifier(notifier service.WebSocketNotifier) {
+	s.wsNotifier = notifier
+}
+
+// RecordPolicyResults stores the results a device reported and returns the
+// latest result of each reported policy
+func (s *ComplianceService) RecordPolicyResults(deviceID string, reports []api.PolicyResultReport) ([]*api.PolicyResult, error) {
+	if err := service.ValidatePolicyResultReports(reports); err != nil {
+		return nil, err
+	}
+
+	type flip struct{ policyID, oldStatus, newStatus string }
+	var flips []flip
+
+	tx, err := s.db.conn.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	now := time.Now().UTC()
+	latest := make([]*api.PolicyResult, 0, len(reports))
+	for _, report := range reports {
+		var last policyResultRow
+		err := tx.Get(&last, "SELECT "+policyResultColumns+
+			" FROM policy_results WHERE device_id = ? AND policy_id = ? AND latest = ?", deviceID, report.PolicyID, true)
+		exists := err == nil
+		if err != nil && !isNotFound(err) {
+			return nil, fmt.Errorf("get latest policy result: %w", err)
+		}
+
+		if exists && last.Status == report.Status && last.Message == report.Message {
+			last.LastReportedAt = now
+			last.Reports++
+			_, err := tx.Exec("UPDATE policy_results SET last_reported_at = ?, reports = ? WHERE id = ?",
+				last.LastReportedAt, last.Reports, last.ID)
+			if err != nil {
+				return nil, fmt.Errorf("update policy result: %w", err)
+			}
+			latest = append(latest, last.toAPI())
+			continue
+		}
+
+		row := policyResultRow{
+			ID:              generateID(),
+			DeviceID:        deviceID,
+			PolicyID:        report.PolicyID,
+			Seq:             1,
+			Status:          report.Status,
+			Message:         report.Message,
+			FirstReportedAt: now,
+			LastReportedAt:  now,
+			Reports:         1,
+		}
+		oldStatus := ""
+		if exists {
+			row.Seq = last.Seq + 1
+			oldStatus = last.Status
+			if _, err := tx.Exec("UPDATE policy_results SET latest = ? WHERE id = ?", false, last.ID); err != nil {
+				return nil, fmt.Errorf("update policy result: %w", err)
+			}
+		}
+		_, err = tx.Exec(`INSERT INTO policy_results (id, device_id, policy_id, seq, latest, status, message,
+	first_reported_at, last_reported_at, reports)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			row.ID, row.DeviceID, row.PolicyID, row.Seq, true, row.Status, row.Message,
+			row.FirstReportedAt, row.LastReportedAt, row.Reports)
+		if err != nil {
+			return nil, fmt.Errorf("insert policy result: %w", err)
+		}
+		if oldStatus != row.Status {
+			flips = append(flips, flip{policyID: row.PolicyID, oldStatus: oldStatus, newStatus: row.Status})
+		}
+		latest = append(latest, row.toAPI())
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	for _, f := range flips {
+		s.wsNotifier.BroadcastPolicyCompliance(f.policyID, deviceID, f.oldStatus, f.newStatus)
+	}
+	return latest, nil
+}
+
+// GetDeviceCompliance returns the latest result of each policy a device reported on
+func (s *ComplianceService) GetDeviceCompliance(deviceID string) ([]*api.PolicyResult, error) {
+	var rows []policyResultRow
+	err := s.db.conn.Select(&rows, "SELECT "+policyResultColumns+
+		" FROM policy_results WHERE device_id = ? AND latest = ? ORDER BY policy_id", deviceID, true)
+	if err != nil {
+		return nil, fmt.Errorf("list device compliance: %w", err)
+	}
+	return policyResultsFromRows(rows), nil
+}
+
+// GetPolicyResultHistory returns the results of a device for a policy, newest first
+func (s *ComplianceService) GetPolicyResultHistory(deviceID, policyID string) ([]*api.PolicyResult, error) {
+	var rows []policyResultRow
+	err := s.db.conn.Select(&rows, "SELECT "+policyResultColumns+
+		" FROM policy_results WHERE device_id = ? AND policy_id = ? ORDER BY seq DESC", deviceID, policyID)
+	if err != nil {
+		return nil, fmt.Errorf("list policy result history: %w", err)
+	}
+	return policyResultsFromRows(rows), nil
+}
+
+// GetComplianceSummary summarizes the latest results of the devices in scope
+func (s *ComplianceService) GetComplianceSummary(scope api.ComplianceScope) (*api.ComplianceSummary, error) {
+	query := "SELECT " + policyResultColumns + " FROM policy_results WHERE latest = ?"
+	args := []interface{}{true}
+	if scope.PolicyID != "" {
+		query += " AND policy_id = ?"
+		args = append(args, scope.PolicyID)
+	}
+
+	var rows []policyResultRow
+	if err := s.db.conn.Select(&rows, query+" ORDER BY device_id, policy_id", args...); err != nil {
+		return nil, fmt.Errorf("list latest policy results: %w", err)
+	}
+
+	results := policyResultsFromRows(rows)
+	if scope.DeviceIDs != nil {
+		devices := make(map[string]bool, len(scope.DeviceIDs))
+		for _, id := range scope.DeviceIDs {
+			devices[id] = true
+		}
+		inScope := results[:0]
+		for _, result := range results {
+			if devices[result.DeviceID] {
+				inScope = append(inScope, result)
+			}
+		}
+		results = inScope
+	}
+	return service.SummarizeCompliance(results), nil
+}
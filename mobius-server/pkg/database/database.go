@@ -3,14 +3,42 @@ package database
 // Database provides persistent storage interfaces for the Mobius MDM platform
 // This package implements database connections and migrations
 
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/notawar/mobius/mobius-server/api"
+	"github.com/notawar/mobius/mobius-server/pkg/database/migrations"
+)
+
+// Supported database drivers
+const (
+	DriverMySQL  = "mysql"
+	DriverSQLite = "sqlite3"
+)
+
 // Config represents database configuration
 type Config struct {
-	// Database connection configuration
+	// Driver selects the backend, either "mysql" or "sqlite3"
+	Driver string
+
+	// Database connection configuration (MySQL)
 	Host     string
 	Port     int
 	Name     string
 	User     string
 	Password string
+
+	// Path is the database file used by the embedded SQLite mode
+	Path string
 }
 
 // Connection represents a database connection
@@ -21,19 +49,168 @@ type Connection interface {
 	Close() error
 }
 
+// DB is a database connection shared by the database-backed services
+type DB struct {
+	config Config
+	conn   *sqlx.DB
+}
+
 // NewConnection creates a new database connection
-func NewConnection(config Config) Connection {
-	// TODO: Implement actual database connection
-	return &mockConnection{}
+func NewConnection(config Config) *DB {
+	return &DB{config: config}
 }
 
-// mockConnection is a placeholder implementation
-type mockConnection struct{}
+// Open connects to the configured database and applies any pending migrations
+func Open(config Config) (*DB, error) {
+	db := NewConnection(config)
+	if err := db.Connect(); err != nil {
+		return nil, err
+	}
+	if err := db.Migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// Connect establishes a connection to the database
+func (db *DB) Connect() error {
+	var (
+		conn *sqlx.DB
+		err  error
+	)
+
+	switch db.config.Driver {
+	case DriverMySQL:
+		conn, err = sqlx.Open(DriverMySQL, mysqlDSN(db.config))
+	case DriverSQLite:
+		if db.config.Path == "" {
+			return errors.New("sqlite database path is required")
+		}
+		conn, err = sqlx.Open(DriverSQLite, sqliteDSN(db.config.Path))
+		if err == nil {
+			// SQLite only supports a single writer
+			conn.SetMaxOpenConns(1)
+		}
+	default:
+		return fmt.Errorf("unsupported database driver %q", db.config.Driver)
+	}
+	if err != nil {
+		return fmt.Errorf("open database: %w", err)
+	}
+
+	if err := conn.Ping(); err != nil {
+		conn.Close()
+		return fmt.Errorf("connect to database: %w", err)
+	}
+
+	db.conn = conn
+	return nil
+}
+
+// Close closes the database connection
+func (db *DB) Close() error {
+	if db.conn == nil {
+		return nil
+	}
+	return db.conn.Close()
+}
 
-func (mc *mockConnection) Connect() error {
+// Migrate applies all pending schema migrations
+func (db *DB) Migrate() error {
+	if db.conn == nil {
+		return errors.New("database is not connected")
+	}
+	if err := migrations.MigrationClient.SetDialect(db.config.Driver); err != nil {
+		return err
+	}
+	if err := migrations.MigrationClient.Up(db.conn.DB, ""); err != nil {
+		return fmt.Errorf("migrate database: %w", err)
+	}
 	return nil
 }
 
-func (mc *mockConnection) Close() error {
+// HealthCheck pings the database
+func (db *DB) HealthCheck() error {
+	return db.HealthCheckContext(context.Background())
+}
+
+// HealthCheckContext pings the database until ctx is done
+func (db *DB) HealthCheckContext(ctx context.Context) error {
+	if db.conn == nil {
+		return errors.New("database is not connected")
+	}
+	return db.conn.PingContext(ctx)
+}
+
+// Driver returns the name of the database driver in use
+func (db *DB) Driver() string {
+	return db.config.Driver
+}
+
+// mysqlDSN builds a MySQL connection string from the configuration
+func mysqlDSN(config Config) string {
+	cfg := mysql.NewConfig()
+	cfg.User = config.User
+	cfg.Passwd = config.Password
+	cfg.Net = "tcp"
+	cfg.Addr = fmt.Sprintf("%s:%d", config.Host, config.Port)
+	cfg.DBName = config.Name
+	cfg.ParseTime = true
+	// Report the rows an UPDATE matched rather than those it changed, as
+	// SQLite does, so that RowsAffected is 0 only for missing rows
+	cfg.ClientFoundRows = true
+	cfg.Params = map[string]string{
+		"time_zone": "'-00:00'",
+	}
+	return cfg.FormatDSN()
+}
+
+// sqliteDSN builds a SQLite connection string for the given file path
+func sqliteDSN(path string) string {
+	params := url.Values{
+		"_busy_timeout": []string{"5000"},
+		"_journal_mode": []string{"WAL"},
+		"_loc":          []string{"UTC"},
+	}
+	return fmt.Sprintf("file:%s?%s", path, params.Encode())
+}
+
+// isNotFound reports whether err signals a missing row
+func isNotFound(err error) bool {
+	return errors.Is(err, sql.ErrNoRows)
+}
+
+// encodeJSON serializes a value for storage in a TEXT column
+func encodeJSON(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// revisionCondition restricts an UPDATE to the revision a change expects, or
+// to any revision when it expects 0; pass the expected revision twice
+const revisionCondition = ` AND (? = 0 OR revision = ?)`
+
+// checkRevision returns api.ErrRevisionConflict when an UPDATE restricted by
+// revisionCondition changed no row
+func checkRevision(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return api.ErrRevisionConflict
+	}
 	return nil
 }
+
+// decodeJSON deserializes a TEXT column into v, ignoring empty values
+func decodeJSON(s string, v interface{}) error {
+	if s == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(s), v)
+}
@@ -0,0 +1,1544 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+
+	"github.com/notawar/mobius/mobius-server/api"
+	"github.com/notawar/mobius/mobius-server/pkg/blobstore"
+	"github.com/notawar/mobius/mobius-server/pkg/service"
+	"github.com/notawar/mobius/mobius-server/server/health"
+)
+
+func newTestDB(t *testing.T) *DB {
+	t.Helper()
+
+	db, err := Open(Config{
+		Driver: DriverSQLite,
+		Path:   filepath.Join(t.TempDir(), "mobius.db"),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error opening database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestOpenAppliesMigrationsOnce(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mobius.db")
+
+	for i := 0; i < 2; i++ {
+		db, err := Open(Config{Driver: DriverSQLite, Path: path})
+		if err != nil {
+			t.Fatalf("open %d: unexpected error: %v", i, err)
+		}
+		db.Close()
+	}
+}
+
+func TestOpenUnsupportedDriver(t *testing.T) {
+	if _, err := Open(Config{Driver: "postgres"}); err == nil {
+		t.Fatalf("expected error for unsupported driver")
+	}
+}
+
+func TestMySQLDSN(t *testing.T) {
+	dsn := mysqlDSN(Config{Host: "db.internal", Port: 3306, Name: "mobius", User: "mobius", Password: "secret"})
+
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Addr != "db.internal:3306" || cfg.DBName != "mobius" || cfg.User != "mobius" || cfg.Passwd != "secret" {
+		t.Errorf("unexpected connection settings in %q", dsn)
+	}
+	// Updates leaving a row unchanged must still count it as found
+	if !cfg.ClientFoundRows || !cfg.ParseTime {
+		t.Errorf("expected clientFoundRows and parseTime in %q", dsn)
+	}
+}
+
+func TestHealthCheck(t *testing.T) {
+	db := newTestDB(t)
+	probes := health.NewRegistry()
+	probes.Register(health.Probe{Name: "datastore", Checker: db})
+	probes.Register(health.Probe{Name: "cache", Optional: true, Checker: health.CheckerFunc(func(context.Context) error {
+		return errors.New("connection refused")
+	})})
+
+	report := probes.CheckReady(context.Background())
+	if report.Status != health.StatusDegraded || !report.Ready() {
+		t.Fatalf("expected degraded but ready, got %+v", report)
+	}
+	if got := report.Components["datastore"]; got.Status != health.StatusUp {
+		t.Errorf("expected datastore up, got %+v", got)
+	}
+	if got := report.Components["cache"]; got.Status != health.StatusDown || got.Error != "connection refused" {
+		t.Errorf("expected cache down with its error, got %+v", got)
+	}
+	if live := probes.CheckLive(context.Background()); len(live.Components) != 0 || live.Status != health.StatusHealthy {
+		t.Errorf("expected no live probes, got %+v", live)
+	}
+
+	db.Close()
+	report = probes.CheckReady(context.Background())
+	if report.Status != health.StatusUnhealthy || report.Ready() {
+		t.Fatalf("expected unhealthy once the database is closed, got %+v", report)
+	}
+	if report.Components["datastore"].Error == "" {
+		t.Errorf("expected the datastore error to be reported")
+	}
+}
+
+func TestDeviceService(t *testing.T) {
+	db := newTestDB(t)
+	service := NewDeviceService(db)
+
+	enrollment := api.DeviceEnrollment{
+		UUID:      "test-device-uuid",
+		Hostname:  "test-workstation",
+		Platform:  "windows",
+		OSVersion: "Windows 11 Pro",
+	}
+
+	t.Run("EnrollDevice", func(t *testing.T) {
+		device, err := service.EnrollDevice(enrollment)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if device.ID != enrollment.UUID {
+			t.Errorf("expected ID '%s', got '%s'", enrollment.UUID, device.ID)
+		}
+		if device.Status != "online" {
+			t.Errorf("expected status 'online', got '%s'", device.Status)
+		}
+	})
+
+	t.Run("GetDevice survives reopen", func(t *testing.T) {
+		device, err := NewDeviceService(db).GetDevice(enrollment.UUID)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if device.Hostname != enrollment.Hostname {
+			t.Errorf("expected hostname '%s', got '%s'", enrollment.Hostname, device.Hostname)
+		}
+	})
+
+	t.Run("ListDevices with filters", func(t *testing.T) {
+		if _, err := service.EnrollDevice(api.DeviceEnrollment{
+			UUID: "mac-uuid", Hostname: "macbook", Platform: "macos",
+		}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		devices, total, err := service.ListDevices(api.DeviceFilters{Limit: 50, Platform: "macos"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if total != 1 || len(devices) != 1 || devices[0].ID != "mac-uuid" {
+			t.Errorf("expected only the macos device, got total %d, devices %v", total, devices)
+		}
+
+		devices, total, err = service.ListDevices(api.DeviceFilters{Limit: 1, Offset: 1, Search: "WORK"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if total != 1 || len(devices) != 0 {
+			t.Errorf("expected total 1 and an empty page, got total %d, %d devices", total, len(devices))
+		}
+
+		devices, total, err = service.ListDevices(api.DeviceFilters{Limit: 50, DeviceIDs: []string{"mac-uuid", "missing"}})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if total != 1 || len(devices) != 1 || devices[0].ID != "mac-uuid" {
+			t.Errorf("expected only the listed device, got total %d, devices %v", total, devices)
+		}
+		if _, total, _ := service.ListDevices(api.DeviceFilters{Limit: 50, DeviceIDs: []string{}}); total != 0 {
+			t.Errorf("expected no devices for an empty list, got %d", total)
+		}
+	})
+
+	t.Run("CountDevices", func(t *testing.T) {
+		if _, err := db.conn.Exec("UPDATE devices SET status = 'offline' WHERE id = 'mac-uuid'"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		counts, err := service.CountDevices()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		want := []api.DeviceCount{
+			{Platform: "macos", Status: "offline", Count: 1},
+			{Platform: "windows", Status: "online", Count: 1},
+		}
+		if !reflect.DeepEqual(counts, want) {
+			t.Errorf("expected %v, got %v", want, counts)
+		}
+	})
+
+	t.Run("UpdateDevice", func(t *testing.T) {
+		hostname := "renamed"
+		labels := map[string]string{"env": "prod"}
+		if _, err := service.UpdateDevice(enrollment.UUID, api.DeviceUpdates{
+			Hostname: &hostname,
+			Labels:   &labels,
+		}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		device, err := service.GetDevice(enrollment.UUID)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if device.Hostname != hostname {
+			t.Errorf("expected hostname '%s', got '%s'", hostname, device.Hostname)
+		}
+		if device.Labels["env"] != "prod" {
+			t.Errorf("expected label env=prod, got %v", device.Labels)
+		}
+	})
+
+	t.Run("UpdateDevice with a revision", func(t *testing.T) {
+		device, err := service.GetDevice(enrollment.UUID)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if device.Revision != 2 {
+			t.Fatalf("expected revision 2 after one update, got %d", device.Revision)
+		}
+
+		hostname := "stale"
+		if _, err := service.UpdateDevice(enrollment.UUID, api.DeviceUpdates{Hostname: &hostname, IfRevision: 1}); !errors.Is(err, api.ErrRevisionConflict) {
+			t.Fatalf("expected ErrRevisionConflict for a stale revision, got %v", err)
+		}
+		hostname = "current"
+		updated, err := service.UpdateDevice(enrollment.UUID, api.DeviceUpdates{Hostname: &hostname, IfRevision: 2})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if updated.Revision != 3 {
+			t.Errorf("expected revision 3, got %d", updated.Revision)
+		}
+		if device, _ := service.GetDevice(enrollment.UUID); device.Hostname != hostname || device.Revision != 3 {
+			t.Errorf("expected hostname '%s' at revision 3, got %+v", hostname, device)
+		}
+
+		// Re-enrolling continues from the previous revision
+		reenrolled, err := service.EnrollDevice(enrollment)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if reenrolled.Revision != 4 {
+			t.Errorf("expected revision 4 after re-enrolling, got %d", reenrolled.Revision)
+		}
+	})
+
+	t.Run("UnenrollDevice", func(t *testing.T) {
+		if err := service.UnenrollDevice(enrollment.UUID); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := service.GetDevice(enrollment.UUID); err == nil {
+			t.Errorf("expected error when getting unenrolled device")
+		}
+		if err := service.UnenrollDevice(enrollment.UUID); err == nil {
+			t.Errorf("expected error when unenrolling twice")
+		}
+	})
+}
+
+func TestDeviceLicenseLimit(t *testing.T) {
+	db := newTestDB(t)
+	devices := NewDeviceService(db)
+	if _, err := devices.EnrollDevice(api.DeviceEnrollment{UUID: "dev-0", Platform: "linux"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	license := service.NewLicenseService()
+	if err := devices.SetLicenseService(license); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, _ := license.GetLicense(); got.DevicesEnrolled != 1 {
+		t.Fatalf("expected the existing device to be counted, got %d", got.DevicesEnrolled)
+	}
+
+	for i := 1; i < 10; i++ {
+		if _, err := devices.EnrollDevice(api.DeviceEnrollment{UUID: fmt.Sprintf("dev-%d", i), Platform: "linux"}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if _, err := devices.EnrollDevice(api.DeviceEnrollment{UUID: "dev-10", Platform: "linux"}); !errors.Is(err, api.ErrLicenseDeviceLimit) {
+		t.Fatalf("expected device limit error, got %v", err)
+	}
+	if _, err := devices.EnrollDevice(api.DeviceEnrollment{UUID: "dev-1", Platform: "linux"}); err != nil {
+		t.Errorf("expected re-enrollment to be allowed, got %v", err)
+	}
+	if err := devices.UnenrollDevice("dev-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, _ := license.GetLicense(); got.DevicesEnrolled != 9 {
+		t.Errorf("expected 9 enrolled devices, got %d", got.DevicesEnrolled)
+	}
+}
+
+func TestLicenseStore(t *testing.T) {
+	store := NewLicenseStore(newTestDB(t))
+
+	key, err := store.GetLicenseKey()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if key != "" {
+		t.Errorf("expected no stored key, got %q", key)
+	}
+
+	for _, want := range []string{"first-key", "second-key", "second-key"} {
+		if err := store.SetLicenseKey(want); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		key, err := store.GetLicenseKey()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if key != want {
+			t.Errorf("expected %q, got %q", want, key)
+		}
+	}
+}
+
+func TestDeviceGroupService(t *testing.T) {
+	db := newTestDB(t)
+	devices := NewDeviceService(db)
+	service := NewDeviceGroupService(db)
+
+	device, err := devices.EnrollDevice(api.DeviceEnrollment{UUID: "dev-1", Hostname: "host-1", Platform: "linux"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	group, err := service.CreateDeviceGroup(api.DeviceGroupCreate{
+		Name:   "Engineering",
+		Labels: map[string]string{"team": "platform"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := service.AddDeviceToGroup(group.ID, device.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := service.AddDeviceToGroup(group.ID, device.ID); err == nil {
+		t.Errorf("expected error when adding device twice")
+	}
+
+	got, err := service.GetDeviceGroup(group.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.DeviceCount != 1 {
+		t.Errorf("expected device count 1, got %d", got.DeviceCount)
+	}
+	if got.Labels["team"] != "platform" {
+		t.Errorf("expected labels to round-trip, got %v", got.Labels)
+	}
+
+	members, err := service.GetGroupDevices(group.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(members) != 1 || members[0].Hostname != "host-1" {
+		t.Errorf("expected the enrolled device as member, got %v", members)
+	}
+
+	if err := service.RemoveDeviceFromGroup(group.ID, device.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := service.DeleteDeviceGroup(group.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := service.GetDeviceGroup(group.ID); err == nil {
+		t.Errorf("expected error for deleted group")
+	}
+
+	t.Run("Dynamic membership", func(t *testing.T) {
+		dynamic, err := service.CreateDeviceGroup(api.DeviceGroupCreate{
+			Name: "Linux on x86",
+			Filters: map[string]string{
+				"platform": "linux",
+				"arch":     `system.arch in (x86_64, amd64)`,
+			},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got, _ := service.GetDeviceGroup(dynamic.ID); got.Filters["platform"] != "linux" {
+			t.Errorf("expected filters to round-trip, got %v", got.Filters)
+		}
+
+		all, _, err := devices.ListDevices(api.DeviceFilters{Limit: 10})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := service.EvaluateGroupMembership(dynamic.ID, all); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got, _ := service.GetDeviceGroup(dynamic.ID); got.DeviceCount != 0 {
+			t.Errorf("expected no members before system info is reported, got %d", got.DeviceCount)
+		}
+
+		systemInfo := map[string]string{"arch": "x86_64"}
+		updated, err := devices.UpdateDevice(device.ID, api.DeviceUpdates{SystemInfo: &systemInfo})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		reloaded, _ := devices.GetDevice(device.ID)
+		if reloaded.SystemInfo["arch"] != "x86_64" {
+			t.Errorf("expected system info to round-trip, got %v", reloaded.SystemInfo)
+		}
+
+		if err := service.EvaluateDeviceMembership(updated); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if groups, _ := service.GetDeviceGroups(device.ID); len(groups) != 1 || groups[0].ID != dynamic.ID {
+			t.Errorf("expected device to join the dynamic group, got %v", groups)
+		}
+		if err := service.RemoveDeviceFromGroup(dynamic.ID, device.ID); err == nil {
+			t.Errorf("expected error removing a device from a dynamic group by hand")
+		}
+
+		explanation, err := service.ExplainDeviceMembership(dynamic.ID, updated)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !explanation.Member || !explanation.Matched || len(explanation.Rules) != 2 {
+			t.Errorf("expected a matching member, got %+v", explanation)
+		}
+
+		systemInfo = map[string]string{"arch": "arm64"}
+		updated, _ = devices.UpdateDevice(device.ID, api.DeviceUpdates{SystemInfo: &systemInfo})
+		if err := service.EvaluateDeviceMembership(updated); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got, _ := service.GetDeviceGroup(dynamic.ID); got.DeviceCount != 0 {
+			t.Errorf("expected device to leave the dynamic group, got %d members", got.DeviceCount)
+		}
+
+		if _, err := service.CreateDeviceGroup(api.DeviceGroupCreate{
+			Name:    "Broken",
+			Filters: map[string]string{"rule": "platform =="},
+		}); err == nil {
+			t.Errorf("expected error for invalid filter")
+		}
+	})
+}
+
+func TestPolicyService(t *testing.T) {
+	db := newTestDB(t)
+	service := NewPolicyService(db)
+
+	policy, err := service.CreatePolicy(api.PolicyCreate{
+		Name:          "Disk encryption",
+		Platform:      "macos",
+		Configuration: map[string]interface{}{"filevault": true},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got, err := service.GetPolicy(policy.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !got.Enabled || got.Configuration["filevault"] != true {
+		t.Errorf("expected enabled policy with configuration, got %+v", got)
+	}
+
+	if err := service.AssignPolicyToDevice(policy.ID, "dev-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := service.AssignPolicyToDevice(policy.ID, "dev-1"); err == nil {
+		t.Errorf("expected error when assigning twice")
+	}
+
+	policies, err := service.GetDevicePolicies("dev-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(policies) != 1 {
+		t.Errorf("expected 1 device policy, got %d", len(policies))
+	}
+
+	if err := service.AssignDevicePolicies("dev-1", []string{"missing"}); err == nil {
+		t.Errorf("expected error when assigning missing policy")
+	}
+
+	if err := service.DeletePolicy(policy.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	policies, err = service.GetDevicePolicies("dev-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(policies) != 0 {
+		t.Errorf("expected assignments to be removed with the policy, got %d", len(policies))
+	}
+}
+
+func TestComplianceService(t *testing.T) {
+	db := newTestDB(t)
+	service := NewComplianceService(db)
+
+	for _, status := range []string{api.PolicyResultPass, api.PolicyResultPass, api.PolicyResultFail} {
+		if _, err := service.RecordPolicyResults("dev-1", []api.PolicyResultReport{{PolicyID: "pol-1", Status: status}}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if _, err := service.RecordPolicyResults("dev-2", []api.PolicyResultReport{{PolicyID: "pol-1", Status: api.PolicyResultPass}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	history, err := service.GetPolicyResultHistory("dev-1", "pol-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(history) != 2 || history[0].Status != api.PolicyResultFail || history[1].Reports != 2 {
+		t.Errorf("expected folded history newest first, got %d entries", len(history))
+	}
+
+	results, err := service.GetDeviceCompliance("dev-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(results) != 1 || results[0].Status != api.PolicyResultFail {
+		t.Errorf("expected the latest failure, got %+v", results)
+	}
+
+	summary, err := service.GetComplianceSummary(api.ComplianceScope{PolicyID: "pol-1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if summary.Devices != 2 || summary.Compliant != 1 || summary.NonCompliant != 1 {
+		t.Errorf("unexpected summary: %+v", summary)
+	}
+	summary, _ = service.GetComplianceSummary(api.ComplianceScope{DeviceIDs: []string{"dev-2"}})
+	if summary.Devices != 1 || summary.ComplianceRate != 1 {
+		t.Errorf("unexpected group summary: %+v", summary)
+	}
+}
+
+func TestAuditService(t *testing.T) {
+	db := newTestDB(t)
+	service := NewAuditService(db)
+
+	start := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	for _, entry := range []*api.AuditEntry{
+		{ID: "a", Timestamp: start, Action: "auth.login", Actor: api.AuditActor{Type: api.AuditActorUser, ID: "u1", Email: "u1@example.com"}},
+		// b and c share a timestamp and are ordered by ID
+		{ID: "b", Timestamp: start.Add(time.Second), Action: "policy.update", TargetType: "policy", TargetID: "p1",
+			Actor: api.AuditActor{ID: "u1"}, Changes: []api.AuditChange{{Field: "enabled", Before: true, After: false}}},
+		{ID: "c", Timestamp: start.Add(time.Second), Action: "policy_x.update", Actor: api.AuditActor{ID: "u2"}},
+		{ID: "d", Timestamp: start.Add(2 * time.Second), Action: "device.wipe", TargetType: "device", TargetID: "dev-1",
+			Actor: api.AuditActor{ID: "u2"}, Details: map[string]interface{}{"command_id": "cmd-1"},
+			Request: api.AuditRequest{Method: "POST", Path: "/api/v1/devices/dev-1/commands", ClientIP: "10.0.0.1"}},
+	} {
+		entry.Outcome = api.AuditOutcomeSuccess
+		if err := service.RecordAudit(entry); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	var got []string
+	cursor := ""
+	for {
+		page, err := service.ListAuditEntries(api.AuditFilters{Limit: 3, Cursor: cursor})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		for _, entry := range page.Entries {
+			got = append(got, entry.ID)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+	if strings.Join(got, ",") != "d,c,b,a" {
+		t.Errorf("expected entries newest first across pages, got %v", got)
+	}
+
+	page, err := service.ListAuditEntries(api.AuditFilters{ActorID: "u2", TargetType: "device"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(page.Entries) != 1 {
+		t.Fatalf("expected one entry, got %d", len(page.Entries))
+	}
+	wipe := page.Entries[0]
+	if wipe.Details["command_id"] != "cmd-1" || wipe.Request.ClientIP != "10.0.0.1" || !wipe.Timestamp.Equal(start.Add(2*time.Second)) {
+		t.Errorf("unexpected entry: %+v", wipe)
+	}
+
+	// A prefix only matches whole segments
+	page, _ = service.ListAuditEntries(api.AuditFilters{Action: "policy."})
+	if len(page.Entries) != 1 || page.Entries[0].ID != "b" || len(page.Entries[0].Changes) != 1 {
+		t.Errorf("expected the policy update with its changes, got %+v", page.Entries)
+	}
+
+	since := start.Add(time.Second)
+	page, _ = service.ListAuditEntries(api.AuditFilters{Since: &since, Until: &since})
+	if len(page.Entries) != 0 {
+		t.Errorf("expected an empty range, got %d entries", len(page.Entries))
+	}
+
+	if _, err := service.ListAuditEntries(api.AuditFilters{Cursor: "garbage!"}); !errors.Is(err, api.ErrInvalidAuditCursor) {
+		t.Errorf("expected ErrInvalidAuditCursor, got %v", err)
+	}
+}
+
+func TestCommandService(t *testing.T) {
+	db := newTestDB(t)
+	device, err := NewDeviceService(db).EnrollDevice(api.DeviceEnrollment{
+		UUID:     "test-device-uuid",
+		Hostname: "test-workstation",
+		Platform: "windows",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	commands := NewCommandService(db)
+
+	cmd, err := commands.EnqueueCommand(device.ID, api.CommandCreate{
+		Command:    "collect_logs",
+		Parameters: map[string]interface{}{"since": "1h"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := commands.EnqueueCommand("missing", api.CommandCreate{Command: "restart"}); err == nil {
+		t.Errorf("expected error for unknown device")
+	}
+
+	fetched, err := commands.FetchCommands(device.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(fetched) != 1 || fetched[0].Status != api.CommandStatusDelivered || fetched[0].Parameters["since"] != "1h" {
+		t.Fatalf("expected one delivered command with parameters, got %+v", fetched)
+	}
+
+	if _, err := commands.AcknowledgeCommand(device.ID, cmd.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	failed, err := commands.ReportCommandResult(device.ID, cmd.ID, api.CommandResultReport{
+		Status: api.CommandStatusFailed,
+		Error:  "disk full",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if failed.Status != api.CommandStatusFailed || failed.CompletedAt == nil {
+		t.Errorf("expected failed command with completion time, got %+v", failed)
+	}
+
+	stored, err := commands.GetCommand(cmd.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stored.Error != "disk full" || stored.DeliveredAt == nil || stored.AcknowledgedAt == nil {
+		t.Errorf("expected stored lifecycle timestamps and error, got %+v", stored)
+	}
+
+	// Commands past their deadline expire
+	late, err := commands.EnqueueCommand(device.ID, api.CommandCreate{Command: "lock"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := db.conn.Exec("UPDATE device_commands SET expires_at = ? WHERE id = ?", time.Now().UTC().Add(-time.Minute), late.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	n, err := commands.ExpireCommands()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("expected 1 expired command, got %d", n)
+	}
+
+	list, err := commands.ListCommands(api.CommandFilters{DeviceID: device.ID, Status: api.CommandStatusExpired})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(list) != 1 || list[0].ID != late.ID {
+		t.Errorf("expected the late command to be expired, got %+v", list)
+	}
+
+	counts, err := commands.CountCommands()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := map[string]int{api.CommandStatusFailed: 1, api.CommandStatusExpired: 1}; !reflect.DeepEqual(counts, want) {
+		t.Errorf("expected %v, got %v", want, counts)
+	}
+}
+
+func TestLiveQueryService(t *testing.T) {
+	db := newTestDB(t)
+	liveQueries := NewLiveQueryService(db)
+
+	campaign, err := liveQueries.StartCampaign(api.LiveQueryCreate{
+		Query:     "SELECT * FROM os_version",
+		DeviceIDs: []string{"device-1", "device-2"},
+		CreatedBy: "admin-1",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	pending, err := liveQueries.PendingQueries("device-2")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(pending) != 1 || pending[0].Query != campaign.Query {
+		t.Fatalf("expected one pending query, got %+v", pending)
+	}
+
+	if _, err := liveQueries.SubmitResult(campaign.ID, "device-2", api.LiveQueryReport{
+		Rows:       []map[string]string{{"name": "Ubuntu", "version": "24.04"}},
+		DurationMS: 12,
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := liveQueries.SubmitResult(campaign.ID, "device-2", api.LiveQueryReport{}); err == nil {
+		t.Errorf("expected error for a second result from the same device")
+	}
+	if _, err := liveQueries.SubmitResult("missing", "device-2", api.LiveQueryReport{}); err == nil {
+		t.Errorf("expected error for unknown campaign")
+	}
+
+	stored, err := liveQueries.GetCampaign(campaign.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stored.Status != api.LiveQueryStatusRunning || stored.DevicesResponded != 1 {
+		t.Errorf("expected running campaign with one response, got %+v", stored)
+	}
+	if stored.Results[0].DeviceID != "device-1" || stored.Results[1].Rows[0]["version"] != "24.04" {
+		t.Errorf("expected results in target order with rows, got %+v", stored.Results)
+	}
+
+	// Campaigns past their deadline time out
+	if _, err := db.conn.Exec("UPDATE live_query_campaigns SET expires_at = ? WHERE id = ?", time.Now().UTC().Add(-time.Minute), campaign.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	n, err := liveQueries.ExpireCampaigns()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("expected 1 timed out campaign, got %d", n)
+	}
+
+	expired, _ := liveQueries.GetCampaign(campaign.ID)
+	if expired.Status != api.LiveQueryStatusTimedOut || expired.CompletedAt == nil || expired.Results[0].Status != api.LiveQueryStatusTimedOut {
+		t.Errorf("expected timed out campaign, got %+v", expired)
+	}
+	if pending, _ := liveQueries.PendingQueries("device-1"); len(pending) != 0 {
+		t.Errorf("expected no pending queries, got %d", len(pending))
+	}
+}
+
+func TestBulkOperationService(t *testing.T) {
+	db := newTestDB(t)
+	bulk := NewBulkOperationService(db)
+
+	op, err := bulk.CreateBulkOperation(api.BulkOperationCreate{
+		Action:    api.BulkAction{Type: api.BulkActionUpdateLabels, Labels: map[string]string{"env": "prod"}},
+		Selector:  api.DeviceSelector{GroupIDs: []string{"group-1"}, Filters: map[string]string{"platform": "linux"}},
+		Total:     3,
+		CreatedBy: "admin-1",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, result := range []struct{ deviceID, errMsg string }{
+		{"device-1", ""},
+		{"device-2", "device not found"},
+		{"device-3", "update failed"},
+	} {
+		if err := bulk.RecordBulkResult(op.ID, result.deviceID, result.errMsg); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	done, err := bulk.FinishBulkOperation(op.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if done.Status != api.BulkStatusPartiallyFailed || done.Processed != 3 || done.Succeeded != 1 || done.Failed != 2 || done.FinishedAt == nil {
+		t.Errorf("expected partially failed operation, got %+v", done)
+	}
+	want := []api.BulkFailure{{DeviceID: "device-2", Error: "device not found"}, {DeviceID: "device-3", Error: "update failed"}}
+	if !reflect.DeepEqual(done.Failures, want) {
+		t.Errorf("expected failures in processing order, got %+v", done.Failures)
+	}
+	if done.Action.Labels["env"] != "prod" || done.Selector.Filters["platform"] != "linux" {
+		t.Errorf("expected action and selector to round trip, got %+v and %+v", done.Action, done.Selector)
+	}
+	if _, err := bulk.CancelBulkOperation(op.ID); !errors.Is(err, api.ErrBulkOperationFinished) {
+		t.Errorf("expected ErrBulkOperationFinished, got %v", err)
+	}
+
+	running, _ := bulk.CreateBulkOperation(api.BulkOperationCreate{Action: api.BulkAction{Type: api.BulkActionUnenroll}, Total: 2})
+	cancelled, err := bulk.CancelBulkOperation(running.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cancelled.Status != api.BulkStatusCancelled || cancelled.FinishedAt == nil {
+		t.Errorf("expected cancelled operation, got %+v", cancelled)
+	}
+	if finished, _ := bulk.FinishBulkOperation(running.ID); finished.Status != api.BulkStatusCancelled {
+		t.Errorf("expected finishing to keep the cancellation, got '%s'", finished.Status)
+	}
+	if _, err := bulk.CancelBulkOperation("missing"); err == nil || errors.Is(err, api.ErrBulkOperationFinished) {
+		t.Errorf("expected not found error for unknown operation, got %v", err)
+	}
+
+	operations, err := bulk.ListBulkOperations()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(operations) != 2 || operations[0].ID != running.ID || operations[1].Failures != nil {
+		t.Errorf("expected newest operation first without failures, got %+v", operations)
+	}
+
+	orphaned, _ := bulk.CreateBulkOperation(api.BulkOperationCreate{Action: api.BulkAction{Type: api.BulkActionUnenroll}, Total: 2})
+	n, err := bulk.InterruptBulkOperations(time.Now().Add(time.Second))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("expected only the running operation to be interrupted, got %d", n)
+	}
+	if interrupted, _ := bulk.GetBulkOperation(orphaned.ID); interrupted.Status != api.BulkStatusInterrupted || interrupted.FinishedAt == nil {
+		t.Errorf("expected interrupted operation, got %+v", interrupted)
+	}
+	if n, _ := bulk.InterruptBulkOperations(time.Now().Add(-time.Minute)); n != 0 {
+		t.Errorf("expected recent operations to be left alone, got %d", n)
+	}
+}
+
+func TestEnrollmentService(t *testing.T) {
+	db := newTestDB(t)
+	enrollment := NewEnrollmentService(db)
+
+	created, err := enrollment.CreateEnrollmentSecret(api.EnrollmentSecretCreate{
+		Name:      "Engineering laptops",
+		GroupID:   "group-1",
+		CreatedBy: "admin-1",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	validated, err := enrollment.ValidateEnrollmentSecret(created.Secret)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if validated.ID != created.ID || validated.GroupID != "group-1" || validated.Secret != "" {
+		t.Errorf("expected the stored secret without its value, got %+v", validated)
+	}
+
+	rotated, err := enrollment.RotateEnrollmentSecret(created.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := enrollment.ValidateEnrollmentSecret(created.Secret); err == nil {
+		t.Errorf("expected error for the value before rotation")
+	}
+	if _, err := enrollment.ValidateEnrollmentSecret(rotated.Secret); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := enrollment.RotateEnrollmentSecret("missing"); err == nil {
+		t.Errorf("expected error rotating a missing secret")
+	}
+
+	// Secrets past their expiry are rejected
+	expiresAt := time.Now().UTC().Add(time.Hour)
+	shortLived, err := enrollment.CreateEnrollmentSecret(api.EnrollmentSecretCreate{Name: "Short lived", ExpiresAt: &expiresAt})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := db.conn.Exec("UPDATE enrollment_secrets SET expires_at = ? WHERE id = ?", time.Now().UTC().Add(-time.Minute), shortLived.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := enrollment.ValidateEnrollmentSecret(shortLived.Secret); err == nil {
+		t.Errorf("expected error for an expired secret")
+	}
+
+	secrets, err := enrollment.ListEnrollmentSecrets()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(secrets) != 2 || secrets[0].ID != created.ID {
+		t.Errorf("expected 2 secrets oldest first, got %+v", secrets)
+	}
+
+	if err := enrollment.DeleteEnrollmentSecret(created.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := enrollment.ValidateEnrollmentSecret(rotated.Secret); err == nil {
+		t.Errorf("expected error for a deleted secret")
+	}
+}
+
+func TestAuthService(t *testing.T) {
+	db := newTestDB(t)
+	tokens, err := service.NewTokenIssuer([]byte("test-key"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	auth := NewAuthService(db, tokens)
+
+	authResp, err := auth.Login("admin@mobius.local", "admin123")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	user, err := auth.ValidateToken(authResp.Token)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if user.Email != "admin@mobius.local" {
+		t.Errorf("expected admin user, got '%s'", user.Email)
+	}
+	if !user.MustChangePassword {
+		t.Errorf("expected the bootstrap admin to have to change its password")
+	}
+
+	if _, err := auth.Login("admin@mobius.local", "wrong-password"); err == nil {
+		t.Errorf("expected error for wrong password")
+	}
+	if _, err := auth.ValidateDeviceToken("missing"); err == nil {
+		t.Errorf("expected error for unknown device token")
+	}
+
+	// Device tokens are re-keyed on reissue and removed on revocation
+	device, err := NewDeviceService(db).EnrollDevice(api.DeviceEnrollment{
+		UUID:     "test-device-uuid",
+		Hostname: "test-workstation",
+		Platform: "linux",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	deviceToken, err := auth.IssueDeviceToken(device)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if validated, err := auth.ValidateDeviceToken(deviceToken); err != nil || validated.ID != device.ID {
+		t.Fatalf("expected device token to validate, got %v, %v", validated, err)
+	}
+	rotated, err := auth.IssueDeviceToken(device)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := auth.ValidateDeviceToken(deviceToken); err == nil {
+		t.Errorf("expected error for a replaced device token")
+	}
+	if err := auth.RevokeDeviceToken(device.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := auth.ValidateDeviceToken(rotated); err == nil {
+		t.Errorf("expected error for a revoked device token")
+	}
+
+	// Refresh tokens rotate and cannot be reused
+	refreshed, err := auth.Refresh(authResp.RefreshToken)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if refreshed.RefreshToken == authResp.RefreshToken {
+		t.Errorf("expected refresh token to be rotated")
+	}
+	if _, err := auth.Refresh(authResp.RefreshToken); err == nil {
+		t.Errorf("expected error when reusing a rotated refresh token")
+	}
+
+	if err := auth.Logout(refreshed.Token); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := auth.ValidateToken(refreshed.Token); err == nil {
+		t.Errorf("expected error for token of a logged out session")
+	}
+
+	password := "new-admin-password-1"
+	updated, err := auth.UpdateUser(user.ID, api.UserUpdate{Password: &password})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if updated.MustChangePassword {
+		t.Errorf("expected changing the password to clear must_change_password")
+	}
+	if err := auth.VerifyPassword(user.ID, "admin123"); !errors.Is(err, api.ErrInvalidPassword) {
+		t.Errorf("expected ErrInvalidPassword for the old password, got %v", err)
+	}
+	if err := auth.VerifyPassword(user.ID, password); err != nil {
+		t.Errorf("unexpected error verifying the new password: %v", err)
+	}
+}
+
+func TestUserService(t *testing.T) {
+	db := newTestDB(t)
+	tokens, err := service.NewTokenIssuer(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	auth := NewAuthService(db, tokens)
+
+	if _, err := auth.CreateUser(api.UserCreate{Email: "ops@example.com", Role: "maintainer", Password: "short"}); err == nil {
+		t.Errorf("expected error for weak password")
+	}
+
+	user, err := auth.CreateUser(api.UserCreate{
+		Email:    "ops@example.com",
+		Name:     "Ops",
+		Role:     "maintainer",
+		Password: "correct-horse-9",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := auth.CreateUser(api.UserCreate{Email: "OPS@example.com", Role: "observer", Password: "correct-horse-9"}); err == nil {
+		t.Errorf("expected error for duplicate email")
+	}
+
+	authResp, err := auth.Login("ops@example.com", "correct-horse-9")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	password := "battery-staple-7"
+	if _, err := auth.UpdateUser(user.ID, api.UserUpdate{Password: &password}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := auth.ValidateToken(authResp.Token); err == nil {
+		t.Errorf("expected password change to revoke sessions")
+	}
+	if _, err := auth.Login("ops@example.com", password); err != nil {
+		t.Errorf("expected login with new password, got %v", err)
+	}
+
+	role := api.RoleDeviceTechnician
+	groups := []string{"group-1", "group-2"}
+	if _, err := auth.UpdateUser(user.ID, api.UserUpdate{Role: &role, DeviceGroupIDs: &groups}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	scoped, err := auth.GetUser(user.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if scoped.Role != role || len(scoped.DeviceGroupIDs) != 2 {
+		t.Errorf("expected a device technician limited to 2 groups, got %+v", scoped)
+	}
+	admin := api.RoleAdmin
+	if _, err := auth.UpdateUser(user.ID, api.UserUpdate{Role: &admin}); err == nil {
+		t.Errorf("expected error making a scoped user an admin")
+	}
+
+	name := "Operations"
+	if _, err := auth.UpdateUser(user.ID, api.UserUpdate{Name: &name, IfRevision: scoped.Revision - 1}); !errors.Is(err, api.ErrRevisionConflict) {
+		t.Errorf("expected ErrRevisionConflict for a stale revision, got %v", err)
+	}
+	renamed, err := auth.UpdateUser(user.ID, api.UserUpdate{Name: &name, IfRevision: scoped.Revision})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if renamed.Name != name || renamed.Revision != scoped.Revision+1 {
+		t.Errorf("expected '%s' at revision %d, got %+v", name, scoped.Revision+1, renamed)
+	}
+
+	users, err := auth.ListUsers()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(users) != 2 {
+		t.Errorf("expected 2 users, got %d", len(users))
+	}
+
+	if err := auth.DeleteUser(user.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := auth.GetUser(user.ID); err == nil {
+		t.Errorf("expected error for deleted user")
+	}
+}
+
+func TestGroupService(t *testing.T) {
+	db := newTestDB(t)
+	service := NewGroupService(db)
+
+	if err := service.CreateGroup(api.Group{ID: "group-1", Name: "QA"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := service.AddDeviceToGroup("group-1", "device-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	group, err := service.GetGroup("group-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(group.DeviceIDs) != 1 || group.DeviceIDs[0] != "device-1" {
+		t.Errorf("expected device-1 in group, got %v", group.DeviceIDs)
+	}
+
+	if err := service.DeleteGroup("group-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := service.GetGroup("group-1"); err == nil {
+		t.Errorf("expected error for deleted group")
+	}
+}
+
+func TestApplicationService(t *testing.T) {
+	db := newTestDB(t)
+	packages, err := blobstore.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	apps := NewApplicationService(db, packages)
+
+	app, err := apps.AddApplication(api.ApplicationCreate{
+		Name:     "Test Application",
+		Version:  "1.0.0",
+		Platform: "linux",
+		Filename: "test-app.bin",
+		Package:  strings.NewReader("mock-binary-data"),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got, err := apps.GetApplication(app.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Filename != "test-app.bin" || got.Size != int64(len("mock-binary-data")) || got.Checksum != app.Checksum {
+		t.Errorf("expected stored package metadata, got %+v", got)
+	}
+
+	rc, _, err := apps.OpenPackage(app.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	content, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil || string(content) != "mock-binary-data" {
+		t.Errorf("expected the uploaded package, got %q (%v)", content, err)
+	}
+
+	if err := apps.DeleteApplication(app.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, _, err := apps.OpenPackage(app.ID); err == nil {
+		t.Errorf("expected error for deleted application")
+	}
+	if _, _, err := packages.Get(context.Background(), app.ID); !blobstore.IsNotFound(err) {
+		t.Errorf("expected package to be deleted, got %v", err)
+	}
+}
+
+func TestApplicationPublications(t *testing.T) {
+	db := newTestDB(t)
+	packages, err := blobstore.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	apps := NewApplicationService(db, packages)
+
+	app, err := apps.AddApplication(api.ApplicationCreate{
+		Name:     "Test Application",
+		Version:  "1.0.0",
+		Platform: "linux",
+		Package:  strings.NewReader("mock-binary-data"),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := apps.PublishApplication(app.ID, "group-1", false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := apps.PublishApplication(app.ID, "group-2", false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	p, err := apps.PublishApplication(app.ID, "group-1", true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !p.Restricted {
+		t.Errorf("expected publication to be restricted")
+	}
+
+	publications, err := apps.ListApplicationPublications(app.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(publications) != 2 || !publications[0].Restricted || publications[1].Restricted {
+		t.Errorf("expected group-1 restricted and group-2 not, got %+v", publications)
+	}
+
+	if err := apps.UnpublishApplication(app.ID, "group-2"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := apps.UnpublishApplication(app.ID, "group-2"); err == nil {
+		t.Errorf("expected error unpublishing twice")
+	}
+
+	if err := apps.DeleteApplication(app.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	publications, err = apps.ListPublications()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(publications) != 0 {
+		t.Errorf("expected no publications after delete, got %+v", publications)
+	}
+}
+
+func TestApplicationImport(t *testing.T) {
+	db := newTestDB(t)
+	packages, err := blobstore.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	apps := NewApplicationService(db, packages)
+
+	imported, err := apps.ImportApplication(api.ApplicationImport{
+		Package: &api.UpstreamPackage{
+			ID: "flatpak:org.videolan.VLC", Name: "VLC", Version: "3.0.20", Platforms: []string{"linux"},
+			Install: api.UpstreamInstall{Manager: "flatpak", Identifier: "org.videolan.VLC", Remote: "flathub"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	app, err := apps.GetApplication(imported.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if app.Source == nil || *app.Source != *imported.Source {
+		t.Errorf("expected source %+v, got %+v", imported.Source, app.Source)
+	}
+	if app.InstallCommand != imported.InstallCommand || app.UninstallCommand != imported.UninstallCommand ||
+		app.DetectionQuery != imported.DetectionQuery || app.LatestVersion != "3.0.20" ||
+		app.LatestVersionCheckedAt == nil || app.UpdateAvailable || app.PackageType != "flatpak" {
+		t.Errorf("unexpected application %+v", app)
+	}
+
+	// A newer upstream version is flagged, without changing the revision
+	app, err = apps.SetLatestVersion(app.ID, "3.0.21", time.Now().UTC())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !app.UpdateAvailable || app.LatestVersion != "3.0.21" || app.Revision != 1 {
+		t.Errorf("expected the update to be flagged, got %+v", app)
+	}
+	if _, err := apps.SetLatestVersion("missing", "1.0", time.Now().UTC()); err == nil {
+		t.Errorf("expected error for an unknown application")
+	}
+
+	version := "3.0.21"
+	app, err = apps.UpdateApplication(app.ID, api.ApplicationUpdate{Version: &version})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if app.UpdateAvailable {
+		t.Errorf("expected no update after moving to the latest version")
+	}
+
+	// Applications with a package have no source
+	uploaded, err := apps.AddApplication(api.ApplicationCreate{
+		Name:     "Test Application",
+		Version:  "1.0.0",
+		Platform: "linux",
+		Package:  strings.NewReader("mock-binary-data"),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	list, err := apps.ListApplications()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, a := range list {
+		if (a.ID == uploaded.ID) != (a.Source == nil) {
+			t.Errorf("unexpected source of %s: %+v", a.ID, a.Source)
+		}
+	}
+
+	if err := apps.DeleteApplication(imported.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestApplicationRequestService(t *testing.T) {
+	requests := NewApplicationRequestService(newTestDB(t))
+
+	req, err := requests.CreateApplicationRequest(api.ApplicationRequestCreate{
+		ApplicationID: "app-1",
+		DeviceID:      "device-1",
+		Reason:        "Needed for the project",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, err = requests.CreateApplicationRequest(api.ApplicationRequestCreate{ApplicationID: "app-1", DeviceID: "device-1"})
+	if !errors.Is(err, api.ErrApplicationRequestPending) {
+		t.Errorf("expected ErrApplicationRequestPending, got %v", err)
+	}
+
+	got, err := requests.GetApplicationRequest(req.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Reason != "Needed for the project" || got.Status != api.AppRequestStatusPending || got.DecidedAt != nil {
+		t.Errorf("expected the stored pending request, got %+v", got)
+	}
+
+	decided, err := requests.DecideApplicationRequest(req.ID, api.ApplicationRequestDecision{
+		Status:    api.AppRequestStatusDenied,
+		DecidedBy: "user-1",
+		Note:      "Not licensed",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if decided.Status != api.AppRequestStatusDenied || decided.DecisionNote != "Not licensed" {
+		t.Errorf("expected denied request, got %+v", decided)
+	}
+	_, err = requests.DecideApplicationRequest(req.ID, api.ApplicationRequestDecision{Status: api.AppRequestStatusApproved})
+	if !errors.Is(err, api.ErrApplicationRequestDecided) {
+		t.Errorf("expected ErrApplicationRequestDecided, got %v", err)
+	}
+
+	if _, err := requests.CreateApplicationRequest(api.ApplicationRequestCreate{ApplicationID: "app-1", DeviceID: "device-1"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	list, err := requests.ListApplicationRequests("device-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(list) != 2 || list[1].ID != req.ID || list[1].DecidedAt == nil {
+		t.Errorf("expected the new request before the denied one, got %+v", list)
+	}
+}
+
+func TestListQueries(t *testing.T) {
+	db := newTestDB(t)
+	devices := NewDeviceService(db)
+	groups := NewDeviceGroupService(db)
+
+	for i, platform := range []string{"linux", "macos", "linux", "windows", "linux"} {
+		id := fmt.Sprintf("dev-%d", i+1)
+		if _, err := devices.EnrollDevice(api.DeviceEnrollment{
+			UUID: id, Hostname: fmt.Sprintf("host-%d", i+1), Platform: platform,
+		}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if platform == "linux" {
+			labels := map[string]string{"env": "prod"}
+			if i == 4 {
+				labels["env"] = "staging"
+			}
+			if _, err := devices.UpdateDevice(id, api.DeviceUpdates{Labels: &labels}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+	}
+
+	ids := func(devices []*api.Device) []string {
+		ids := make([]string, len(devices))
+		for i, device := range devices {
+			ids[i] = device.ID
+		}
+		return ids
+	}
+	// pageDevices follows the pages of a query, continuing after the last
+	// device of each page as the cursors of the API do
+	pageDevices := func(t *testing.T, query func(*api.ListQuery) ([]*api.Device, int, error), q *api.ListQuery) ([]string, int) {
+		t.Helper()
+		var all []string
+		for pages := 0; ; pages++ {
+			page, total, err := query(q)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			more := len(page) > q.Limit
+			if more {
+				page = page[:q.Limit]
+			}
+			all = append(all, ids(page)...)
+			if !more || pages > 10 {
+				return all, total
+			}
+			last := page[len(page)-1]
+			q.After = &api.ListPosition{Values: []interface{}{last.Hostname}, ID: last.ID}
+		}
+	}
+	search := func(q *api.ListQuery) ([]*api.Device, int, error) { return devices.QueryDevices("", q) }
+
+	t.Run("pages in both directions", func(t *testing.T) {
+		got, total := pageDevices(t, search, &api.ListQuery{Sort: []api.ListSortKey{{Field: "hostname"}}, Limit: 2})
+		if want := []string{"dev-1", "dev-2", "dev-3", "dev-4", "dev-5"}; total != 5 || !reflect.DeepEqual(got, want) {
+			t.Errorf("expected %v of 5, got %v of %d", want, got, total)
+		}
+
+		got, _ = pageDevices(t, search, &api.ListQuery{Sort: []api.ListSortKey{{Field: "hostname", Desc: true}}, Limit: 3})
+		if want := []string{"dev-5", "dev-4", "dev-3", "dev-2", "dev-1"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("expected %v, got %v", want, got)
+		}
+	})
+
+	t.Run("offset", func(t *testing.T) {
+		page, total, err := search(&api.ListQuery{Sort: []api.ListSortKey{{Field: "hostname"}}, Limit: 2, Offset: 2})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		// One device more than the limit tells that more follow
+		if want := []string{"dev-3", "dev-4", "dev-5"}; total != 5 || !reflect.DeepEqual(ids(page), want) {
+			t.Errorf("expected %v of 5, got %v of %d", want, ids(page), total)
+		}
+	})
+
+	t.Run("filters", func(t *testing.T) {
+		for _, tc := range []struct {
+			name    string
+			filters []api.ListFilter
+			want    []string
+		}{
+			{"in", []api.ListFilter{{Field: "platform", Op: "in", Operands: []interface{}{"macos", "windows"}}}, []string{"dev-2", "dev-4"}},
+			{"label", []api.ListFilter{{Field: "labels.env", Op: "eq", Operands: []interface{}{"prod"}}}, []string{"dev-1", "dev-3"}},
+			{"label ne matches devices without it", []api.ListFilter{{Field: "labels.env", Op: "ne", Operands: []interface{}{"prod"}}},
+				[]string{"dev-2", "dev-4", "dev-5"}},
+			{"contains", []api.ListFilter{{Field: "hostname", Op: "contains", Operands: []interface{}{"ST-3"}}}, []string{"dev-3"}},
+			{"combined", []api.ListFilter{
+				{Field: "platform", Op: "eq", Operands: []interface{}{"linux"}},
+				{Field: "hostname", Op: "gt", Operands: []interface{}{"host-1"}},
+			}, []string{"dev-3", "dev-5"}},
+		} {
+			q := &api.ListQuery{Sort: []api.ListSortKey{{Field: "hostname"}}, Filters: tc.filters, Limit: 10}
+			got, total := pageDevices(t, search, q)
+			if total != len(tc.want) || !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("%s: expected %v, got %v of %d", tc.name, tc.want, got, total)
+			}
+		}
+
+		got, _ := pageDevices(t, func(q *api.ListQuery) ([]*api.Device, int, error) {
+			return devices.QueryDevices("HOST-4", q)
+		}, &api.ListQuery{Sort: []api.ListSortKey{{Field: "hostname"}}, Limit: 10})
+		if want := []string{"dev-4"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("search: expected %v, got %v", want, got)
+		}
+	})
+
+	t.Run("device group scope", func(t *testing.T) {
+		group, err := groups.CreateDeviceGroup(api.DeviceGroupCreate{Name: "Scoped"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		for _, id := range []string{"dev-2", "dev-5"} {
+			if err := groups.AddDeviceToGroup(group.ID, id); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+
+		q := &api.ListQuery{Sort: []api.ListSortKey{{Field: "hostname"}}, Limit: 10, DeviceGroupIDs: []string{group.ID}}
+		if got, total := pageDevices(t, search, q); total != 2 || !reflect.DeepEqual(got, []string{"dev-2", "dev-5"}) {
+			t.Errorf("expected the members of the group, got %v of %d", got, total)
+		}
+		q = &api.ListQuery{Sort: []api.ListSortKey{{Field: "hostname"}}, Limit: 10, DeviceGroupIDs: []string{}}
+		if got, total := pageDevices(t, search, q); total != 0 || len(got) != 0 {
+			t.Errorf("expected no devices for an empty scope, got %v of %d", got, total)
+		}
+
+		got, total, err := groups.QueryDeviceGroups(&api.ListQuery{Sort: []api.ListSortKey{{Field: "device_count", Desc: true}}, Limit: 10})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if total != 1 || got[0].DeviceCount != 2 {
+			t.Errorf("expected the group with 2 devices, got %+v", got)
+		}
+	})
+
+	t.Run("NULLs sort first", func(t *testing.T) {
+		enrollment := NewEnrollmentService(db)
+		var created []string
+		for _, name := range []string{"a", "b", "c"} {
+			secret, err := enrollment.CreateEnrollmentSecret(api.EnrollmentSecretCreate{Name: name})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			created = append(created, secret.ID)
+		}
+		if _, err := enrollment.RotateEnrollmentSecret(created[1]); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		for _, desc := range []bool{false, true} {
+			q := &api.ListQuery{Sort: []api.ListSortKey{{Field: "rotated_at", Desc: desc}}, Limit: 1}
+			var got []string
+			for len(got) < 5 {
+				page, _, err := enrollment.QueryEnrollmentSecrets(q)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				got = append(got, page[0].ID)
+				if len(page) == 1 {
+					break
+				}
+				var rotatedAt interface{}
+				if page[0].RotatedAt != nil {
+					rotatedAt = *page[0].RotatedAt
+				}
+				q.After = &api.ListPosition{Values: []interface{}{rotatedAt}, ID: page[0].ID}
+			}
+
+			unrotated := []string{created[0], created[2]}
+			sort.Strings(unrotated)
+			want := append(unrotated, created[1])
+			if desc {
+				want = []string{created[1], unrotated[1], unrotated[0]}
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("desc %v: expected %v, got %v", desc, want, got)
+			}
+		}
+	})
+
+	t.Run("computed fields are unsupported", func(t *testing.T) {
+		applications := NewApplicationService(db, nil)
+		_, _, err := applications.QueryApplications(&api.ListQuery{
+			Sort:    []api.ListSortKey{{Field: "created_at"}},
+			Filters: []api.ListFilter{{Field: "update_available", Op: "eq", Operands: []interface{}{true}}},
+			Limit:   10,
+		})
+		if !errors.Is(err, api.ErrUnsupportedListQuery) {
+			t.Errorf("expected ErrUnsupportedListQuery, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,491 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/notawar/mobius/mobius-server/api"
+	"github.com/notawar/mobius/mobius-server/pkg/service"
+)
+
+// deviceGroupRow is the storage representation of api.DeviceGroup
+type deviceGroupRow struct {
+	ID          string    `db:"id"`
+	Name        string    `db:"name"`
+	Description string    `db:"description"`
+	Filters     string    `db:"filters"`
+	Labels      string    `db:"labels"`
+	DeviceCount int       `db:"device_count"`
+	CreatedAt   time.Time `db:"created_at"`
+	UpdatedAt   time.Time `db:"updated_at"`
+	Revision    int       `db:"revision"`
+}
+
+const deviceGroupColumns = `g.id, g.name, COALESCE(g.description, '') AS description,
+	COALESCE(g.filters, '') AS filters, COALESCE(g.labels, '') AS labels,
+	(SELECT COUNT(*) FROM device_group_members m WHERE m.group_id = g.id) AS device_count,
+	g.created_at, g.updated_at, g.revision`
+
+const deviceGroupSelect = "SELECT " + deviceGroupColumns + " FROM device_groups g"
+
+// deviceGroupListTable answers list queries over device groups
+var deviceGroupListTable = listTable{
+	from: "device_groups g",
+	id:   "g.id",
+	columns: map[string]string{
+		"id":           "g.id",
+		"name":         "g.name",
+		"description":  "COALESCE(g.description, '')",
+		"device_count": "(SELECT COUNT(*) FROM device_group_members m WHERE m.group_id = g.id)",
+		"created_at":   "g.created_at",
+		"updated_at":   "g.updated_at",
+	},
+	labels:      "g.labels",
+	groupColumn: "g.id",
+}
+
+func (r *deviceGroupRow) toAPI() (*api.DeviceGroup, error) {
+	group := &api.DeviceGroup{
+		ID:          r.ID,
+		Name:        r.Name,
+		Description: r.Description,
+		DeviceCount: r.DeviceCount,
+		Filters:     make(map[string]string),
+		Labels:      make(map[string]string),
+		CreatedAt:   r.CreatedAt,
+		UpdatedAt:   r.UpdatedAt,
+		Revision:    r.Revision,
+	}
+	if err := decodeJSON(r.Filters, &group.Filters); err != nil {
+		return nil, fmt.Errorf("decode device group filters: %w", err)
+	}
+	if err := decodeJSON(r.Labels, &group.Labels); err != nil {
+		return nil, fmt.Errorf("decode device group labels: %w", err)
+	}
+	return group, nil
+}
+
+// DeviceGroupService is a database-backed implementation of api.DeviceGroupService
+type DeviceGroupService struct {
+	db         *DB
+	wsNotifier service.WebSocketNotifier
+}
+
+// NewDeviceGroupService creates a new database-backed device group service
+func NewDeviceGroupService(db *DB) *DeviceGroupService {
+	return &DeviceGroupService{
+		db:         db,
+		wsNotifier: &service.NoOpWebSocketNotifier{},
+	}
+}
+
+// SetWebSocketNotifier sets the WebSocket notifier
+func (s *DeviceGroupService) SetWebSocketNotifier(notifier service.WebSocketNotifier) {
+	s.wsNotifier = notifier
+}
+
+// ListDeviceGroups returns all device groups
+func (s *DeviceGroupService) ListDeviceGroups() ([]*api.DeviceGroup, error) {
+	var rows []deviceGroupRow
+	if err := s.db.conn.Select(&rows, deviceGroupSelect+" ORDER BY g.created_at, g.id"); err != nil {
+		return nil, fmt.Errorf("list device groups: %w", err)
+	}
+
+	groups := make([]*api.DeviceGroup, 0, len(rows))
+	for i := range rows {
+		group, err := rows[i].toAPI()
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+	return groups, nil
+}
+
+// QueryDeviceGroups answers a list query over the device groups
+func (s *DeviceGroupService) QueryDeviceGroups(q *api.ListQuery) ([]*api.DeviceGroup, int, error) {
+	return s.db.queryDeviceGroups(q, nil, nil)
+}
+
+// queryDeviceGroups answers a list query over the device groups matching
+// where
+func (db *DB) queryDeviceGroups(q *api.ListQuery, where []string, args []interface{}) ([]*api.DeviceGroup, int, error) {
+	var rows []deviceGroupRow
+	total, err := db.queryList(&rows, deviceGroupColumns, deviceGroupListTable, q, where, args)
+	if err != nil {
+		return nil, 0, fmt.Errorf("list device groups: %w", err)
+	}
+
+	groups := make([]*api.DeviceGroup, 0, len(rows))
+	for i := range rows {
+		group, err := rows[i].toAPI()
+		if err != nil {
+			return nil, 0, err
+		}
+		groups = append(groups, group)
+	}
+	return groups, total, nil
+}
+
+// GetDeviceGroup returns a specific device group
+func (s *DeviceGroupService) GetDeviceGroup(id string) (*api.DeviceGroup, error) {
+	var row deviceGroupRow
+	err := s.db.conn.Get(&row, deviceGroupSelect+" WHERE g.id = ?", id)
+	if isNotFound(err) {
+		return nil, fmt.Errorf("device group not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get device group: %w", err)
+	}
+	return row.toAPI()
+}
+
+// CreateDeviceGroup creates a new device group
+func (s *DeviceGroupService) CreateDeviceGroup(create api.DeviceGroupCreate) (*api.DeviceGroup, error) {
+	if err := service.ValidateGroupFilters(create.Filters); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	group := &api.DeviceGroup{
+		ID:          generateID(),
+		Name:        create.Name,
+		Description: create.Description,
+		Filters:     create.Filters,
+		Labels:      create.Labels,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		Revision:    1,
+	}
+	if group.Filters == nil {
+		group.Filters = make(map[string]string)
+	}
+	if group.Labels == nil {
+		group.Labels = make(map[string]string)
+	}
+
+	filters, err := encodeJSON(group.Filters)
+	if err != nil {
+		return nil, err
+	}
+	labels, err := encodeJSON(group.Labels)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.db.conn.Exec(`INSERT INTO device_groups (id, name, description, filters, labels, created_at, updated_at, revision)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		group.ID, group.Name, group.Description, filters, labels, group.CreatedAt, group.UpdatedAt, group.Revision)
+	if err != nil {
+		return nil, fmt.Errorf("insert device group: %w", err)
+	}
+	return group, nil
+}
+
+// UpdateDeviceGroup updates a device group
+func (s *DeviceGroupService) UpdateDeviceGroup(id string, updates api.DeviceGroupUpdate) (*api.DeviceGroup, error) {
+	if updates.Filters != nil {
+		if err := service.ValidateGroupFilters(*updates.Filters); err != nil {
+			return nil, err
+		}
+	}
+	group, err := s.GetDeviceGroup(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if updates.Name != nil {
+		group.Name = *updates.Name
+	}
+	if updates.Description != nil {
+		group.Description = *updates.Description
+	}
+	if updates.Filters != nil {
+		group.Filters = *updates.Filters
+	}
+	if updates.Labels != nil {
+		group.Labels = *updates.Labels
+	}
+	group.UpdatedAt = time.Now().UTC()
+
+	filters, err := encodeJSON(group.Filters)
+	if err != nil {
+		return nil, err
+	}
+	labels, err := encodeJSON(group.Labels)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := s.db.conn.Exec(`UPDATE device_groups SET name = ?, description = ?, filters = ?, labels = ?, updated_at = ?,
+	revision = revision + 1
+WHERE id = ?`+revisionCondition,
+		group.Name, group.Description, filters, labels, group.UpdatedAt, id,
+		updates.IfRevision, updates.IfRevision)
+	if err != nil {
+		return nil, fmt.Errorf("update device group: %w", err)
+	}
+	if err := checkRevision(res); err != nil {
+		return nil, err
+	}
+	group.Revision++
+	return group, nil
+}
+
+// DeleteDeviceGroup deletes a device group
+func (s *DeviceGroupService) DeleteDeviceGroup(id string) error {
+	tx, err := s.db.conn.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	res, err := tx.Exec("DELETE FROM device_groups WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("delete device group: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("device group not found")
+	}
+
+	for _, stmt := range []string{
+		"DELETE FROM device_group_members WHERE group_id = ?",
+		"DELETE FROM group_policies WHERE group_id = ?",
+		"DELETE FROM application_publications WHERE group_id = ?",
+	} {
+		if _, err := tx.Exec(stmt, id); err != nil {
+			return fmt.Errorf("delete device group associations: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetGroupDevices returns all devices in a group
+func (s *DeviceGroupService) GetGroupDevices(groupID string) ([]*api.Device, error) {
+	if err := s.ensureExists(groupID); err != nil {
+		return nil, err
+	}
+
+	var deviceIDs []string
+	err := s.db.conn.Select(&deviceIDs,
+		"SELECT device_id FROM device_group_members WHERE group_id = ? ORDER BY created_at, device_id", groupID)
+	if err != nil {
+		return nil, fmt.Errorf("list group devices: %w", err)
+	}
+	return s.db.devicesByIDs(deviceIDs)
+}
+
+// QueryGroupDevices answers a list query over the devices in a group
+func (s *DeviceGroupService) QueryGroupDevices(groupID string, q *api.ListQuery) ([]*api.Device, int, error) {
+	if err := s.ensureExists(groupID); err != nil {
+		return nil, 0, err
+	}
+	return s.db.queryDevices(q,
+		[]string{"id IN (SELECT device_id FROM device_group_members WHERE group_id = ?)"}, []interface{}{groupID})
+}
+
+// AddDeviceToGroup adds a device to a group
+func (s *DeviceGroupService) AddDeviceToGroup(groupID, deviceID string) error {
+	if err := s.ensureManual(groupID); err != nil {
+		return err
+	}
+
+	var count int
+	err := s.db.conn.Get(&count,
+		"SELECT COUNT(*) FROM device_group_members WHERE group_id = ? AND device_id = ?", groupID, deviceID)
+	if err != nil {
+		return fmt.Errorf("check group membership: %w", err)
+	}
+	if count > 0 {
+		return fmt.Errorf("device already in group")
+	}
+
+	_, err = s.db.conn.Exec("INSERT INTO device_group_members (group_id, device_id, created_at) VALUES (?, ?, ?)",
+		groupID, deviceID, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("add device to group: %w", err)
+	}
+
+	s.wsNotifier.BroadcastGroupMembership(groupID, deviceID, "added")
+
+	return nil
+}
+
+// RemoveDeviceFromGroup removes a device from a group
+func (s *DeviceGroupService) RemoveDeviceFromGroup(groupID, deviceID string) error {
+	if err := s.ensureManual(groupID); err != nil {
+		return err
+	}
+
+	res, err := s.db.conn.Exec("DELETE FROM device_group_members WHERE group_id = ? AND device_id = ?", groupID, deviceID)
+	if err != nil {
+		return fmt.Errorf("remove device from group: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("device not found in group")
+	}
+
+	s.wsNotifier.BroadcastGroupMembership(groupID, deviceID, "removed")
+
+	return nil
+}
+
+// GetDeviceGroups returns all groups that contain a specific device
+func (s *DeviceGroupService) GetDeviceGroups(deviceID string) ([]*api.DeviceGroup, error) {
+	var rows []deviceGroupRow
+	err := s.db.conn.Select(&rows, deviceGroupSelect+
+		" WHERE g.id IN (SELECT group_id FROM device_group_members WHERE device_id = ?) ORDER BY g.created_at, g.id", deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("list device groups for device: %w", err)
+	}
+
+	groups := make([]*api.DeviceGroup, 0, len(rows))
+	for i := range rows {
+		group, err := rows[i].toAPI()
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+	return groups, nil
+}
+
+// EvaluateDeviceMembership adds a device to the dynamic groups whose filters
+// it matches and removes it from those it no longer matches
+func (s *DeviceGroupService) EvaluateDeviceMembership(device *api.Device) error {
+	groups, err := s.ListDeviceGroups()
+	if err != nil {
+		return err
+	}
+
+	var memberOf []string
+	err = s.db.conn.Select(&memberOf, "SELECT group_id FROM device_group_members WHERE device_id = ?", device.ID)
+	if err != nil {
+		return fmt.Errorf("list device group memberships: %w", err)
+	}
+	member := make(map[string]bool, len(memberOf))
+	for _, groupID := range memberOf {
+		member[groupID] = true
+	}
+
+	for _, group := range groups {
+		if len(group.Filters) == 0 {
+			continue
+		}
+		matched := service.MatchGroupFilters(group.Filters, device)
+		if matched == member[group.ID] {
+			continue
+		}
+		if err := s.setMember(group.ID, device.ID, matched); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EvaluateGroupMembership sets the members of a dynamic group to the given
+// devices that match its filters. Groups without filters are left untouched.
+func (s *DeviceGroupService) EvaluateGroupMembership(groupID string, devices []*api.Device) error {
+	group, err := s.GetDeviceGroup(groupID)
+	if err != nil {
+		return err
+	}
+	if len(group.Filters) == 0 {
+		return nil
+	}
+
+	var memberIDs []string
+	err = s.db.conn.Select(&memberIDs, "SELECT device_id FROM device_group_members WHERE group_id = ?", groupID)
+	if err != nil {
+		return fmt.Errorf("list group devices: %w", err)
+	}
+	member := make(map[string]bool, len(memberIDs))
+	for _, deviceID := range memberIDs {
+		member[deviceID] = true
+	}
+
+	matched := make(map[string]bool, len(devices))
+	for _, device := range devices {
+		if service.MatchGroupFilters(group.Filters, device) {
+			matched[device.ID] = true
+		}
+	}
+
+	for _, deviceID := range memberIDs {
+		if !matched[deviceID] {
+			if err := s.setMember(groupID, deviceID, false); err != nil {
+				return err
+			}
+		}
+	}
+	for _, device := range devices {
+		if matched[device.ID] && !member[device.ID] {
+			if err := s.setMember(groupID, device.ID, true); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ExplainDeviceMembership describes how a device fares against the filters of a group
+func (s *DeviceGroupService) ExplainDeviceMembership(groupID string, device *api.Device) (*api.GroupMembershipExplanation, error) {
+	group, err := s.GetDeviceGroup(groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	var count int
+	err = s.db.conn.Get(&count,
+		"SELECT COUNT(*) FROM device_group_members WHERE group_id = ? AND device_id = ?", groupID, device.ID)
+	if err != nil {
+		return nil, fmt.Errorf("check group membership: %w", err)
+	}
+	return service.ExplainGroupMembership(group, device, count > 0), nil
+}
+
+// setMember adds or removes a device from a group and notifies WebSocket clients
+func (s *DeviceGroupService) setMember(groupID, deviceID string, member bool) error {
+	if member {
+		_, err := s.db.conn.Exec("INSERT INTO device_group_members (group_id, device_id, created_at) VALUES (?, ?, ?)",
+			groupID, deviceID, time.Now().UTC())
+		if err != nil {
+			return fmt.Errorf("add device to group: %w", err)
+		}
+		s.wsNotifier.BroadcastGroupMembership(groupID, deviceID, "added")
+		return nil
+	}
+
+	_, err := s.db.conn.Exec("DELETE FROM device_group_members WHERE group_id = ? AND device_id = ?", groupID, deviceID)
+	if err != nil {
+		return fmt.Errorf("remove device from group: %w", err)
+	}
+	s.wsNotifier.BroadcastGroupMembership(groupID, deviceID, "removed")
+	return nil
+}
+
+// ensureManual returns an error if the device group does not exist or its
+// membership is managed by filters
+func (s *DeviceGroupService) ensureManual(groupID string) error {
+	group, err := s.GetDeviceGroup(groupID)
+	if err != nil {
+		return err
+	}
+	if len(group.Filters) > 0 {
+		return fmt.Errorf("device group membership is managed by its filters")
+	}
+	return nil
+}
+
+// ensureExists returns an error if the device group does not exist
+func (s *DeviceGroupService) ensureExists(groupID string) error {
+	var count int
+	if err := s.db.conn.Get(&count, "SELECT COUNT(*) FROM device_groups WHERE id = ?", groupID); err != nil {
+		return fmt.Errorf("get device group: %w", err)
+	}
+	if count == 0 {
+		return fmt.Errorf("device group not found")
+	}
+	return nil
+}
@@ -1,11 +0,0 @@
-package database
-
-// DeviceService provides database operations for device management
-type DeviceService struct {
-	// Database connection will be added here
-}
-
-// NewDeviceService creates a new database-backed device service
-func NewDeviceService() *DeviceService {
-	return &DeviceService{}
-}
@@ -0,0 +1,412 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/notawar/mobius/mobius-server/api"
+	"github.com/notawar/mobius/mobius-server/pkg/service"
+)
+
+// deviceRow is the storage representation of api.Device
+type deviceRow struct {
+	ID         string    `db:"id"`
+	UUID       string    `db:"uuid"`
+	Hostname   string    `db:"hostname"`
+	Platform   string    `db:"platform"`
+	OSVersion  string    `db:"os_version"`
+	Status     string    `db:"status"`
+	Labels     string    `db:"labels"`
+	SystemInfo string    `db:"system_info"`
+	LastSeen   time.Time `db:"last_seen"`
+	EnrolledAt time.Time `db:"enrolled_at"`
+	Revision   int       `db:"revision"`
+}
+
+const deviceColumns = `id, uuid, hostname, platform, os_version, status, COALESCE(labels, '') AS labels,
+	COALESCE(system_info, '') AS system_info, last_seen, enrolled_at, revision`
+
+func (r *deviceRow) toAPI() (*api.Device, error) {
+	device := &api.Device{
+		ID:         r.ID,
+		UUID:       r.UUID,
+		Hostname:   r.Hostname,
+		Platform:   r.Platform,
+		OSVersion:  r.OSVersion,
+		Status:     r.Status,
+		LastSeen:   r.LastSeen,
+		EnrolledAt: r.EnrolledAt,
+		Revision:   r.Revision,
+		Labels:     make(map[string]string),
+	}
+	if err := decodeJSON(r.Labels, &device.Labels); err != nil {
+		return nil, fmt.Errorf("decode device labels: %w", err)
+	}
+	if err := decodeJSON(r.SystemInfo, &device.SystemInfo); err != nil {
+		return nil, fmt.Errorf("decode device system info: %w", err)
+	}
+	return device, nil
+}
+
+// DeviceService is a database-backed implementation of api.DeviceService
+type DeviceService struct {
+	db         *DB
+	wsNotifier service.WebSocketNotifier
+	license    api.LicenseService // Enforces the device limit when set
+}
+
+// NewDeviceService creates a new database-backed device service
+func NewDeviceService(db *DB) *DeviceService {
+	return &DeviceService{
+		db:         db,
+		wsNotifier: &service.NoOpWebSocketNotifier{},
+	}
+}
+
+// SetWebSocketNotifier sets the WebSocket notifier
+func (s *DeviceService) SetWebSocketNotifier(notifier service.WebSocketNotifier) {
+	s.wsNotifier = notifier
+}
+
+// SetLicenseService enforces the device limit of license on enrollment and
+// reports the number of enrolled devices to it
+func (s *DeviceService) SetLicenseService(license api.LicenseService) error {
+	var enrolled int
+	if err := s.db.conn.Get(&enrolled, "SELECT COUNT(*) FROM devices"); err != nil {
+		return fmt.Errorf("count devices: %w", err)
+	}
+	s.license = license
+	s.license.SetDevicesEnrolled(enrolled)
+	return nil
+}
+
+// ListDevices returns a filtered list of devices with pagination
+func (s *DeviceService) ListDevices(filters api.DeviceFilters) ([]*api.Device, int, error) {
+	var (
+		where []string
+		args  []interface{}
+	)
+	if filters.Platform != "" {
+		where = append(where, "platform = ?")
+		args = append(args, filters.Platform)
+	}
+	if filters.Status != "" {
+		where = append(where, "status = ?")
+		args = append(args, filters.Status)
+	}
+	if filters.Search != "" {
+		cond, condArgs := deviceSearchCondition(filters.Search)
+		where = append(where, cond...)
+		args = append(args, condArgs...)
+	}
+	if filters.DeviceIDs != nil {
+		if len(filters.DeviceIDs) == 0 {
+			return []*api.Device{}, 0, nil
+		}
+		where = append(where, "id IN (?"+strings.Repeat(", ?", len(filters.DeviceIDs)-1)+")")
+		for _, id := range filters.DeviceIDs {
+			args = append(args, id)
+		}
+	}
+
+	whereClause := ""
+	if len(where) > 0 {
+		whereClause = " WHERE " + strings.Join(where, " AND ")
+	}
+
+	var total int
+	if err := s.db.conn.Get(&total, "SELECT COUNT(*) FROM devices"+whereClause, args...); err != nil {
+		return nil, 0, fmt.Errorf("count devices: %w", err)
+	}
+
+	if filters.Limit <= 0 {
+		return []*api.Device{}, total, nil
+	}
+
+	query := "SELECT " + deviceColumns + " FROM devices" + whereClause +
+		" ORDER BY enrolled_at, id LIMIT ? OFFSET ?"
+	var rows []deviceRow
+	if err := s.db.conn.Select(&rows, query, append(args, filters.Limit, filters.Offset)...); err != nil {
+		return nil, 0, fmt.Errorf("list devices: %w", err)
+	}
+
+	devices := make([]*api.Device, 0, len(rows))
+	for i := range rows {
+		device, err := rows[i].toAPI()
+		if err != nil {
+			return nil, 0, err
+		}
+		devices = append(devices, device)
+	}
+	return devices, total, nil
+}
+
+// deviceListTable answers list queries over devices
+var deviceListTable = listTable{
+	from: "devices",
+	id:   "id",
+	columns: map[string]string{
+		"id":          "id",
+		"uuid":        "uuid",
+		"hostname":    "hostname",
+		"platform":    "platform",
+		"os_version":  "os_version",
+		"status":      "status",
+		"last_seen":   "last_seen",
+		"enrolled_at": "enrolled_at",
+	},
+	labels:       "labels",
+	deviceColumn: "id",
+}
+
+// QueryDevices answers a list query over the devices; search matches
+// hostnames and UUIDs
+func (s *DeviceService) QueryDevices(search string, q *api.ListQuery) ([]*api.Device, int, error) {
+	var (
+		where []string
+		args  []interface{}
+	)
+	if search != "" {
+		where, args = deviceSearchCondition(search)
+	}
+	return s.db.queryDevices(q, where, args)
+}
+
+// queryDevices answers a list query over the devices matching where
+func (db *DB) queryDevices(q *api.ListQuery, where []string, args []interface{}) ([]*api.Device, int, error) {
+	var rows []deviceRow
+	total, err := db.queryList(&rows, deviceColumns, deviceListTable, q, where, args)
+	if err != nil {
+		return nil, 0, fmt.Errorf("list devices: %w", err)
+	}
+
+	devices := make([]*api.Device, 0, len(rows))
+	for i := range rows {
+		device, err := rows[i].toAPI()
+		if err != nil {
+			return nil, 0, err
+		}
+		devices = append(devices, device)
+	}
+	return devices, total, nil
+}
+
+// deviceSearchCondition matches the devices whose hostname or UUID contains
+// search
+func deviceSearchCondition(search string) ([]string, []interface{}) {
+	pattern := "%" + escapeLike(strings.ToLower(search)) + "%"
+	return []string{"(LOWER(hostname) LIKE ? ESCAPE '!' OR LOWER(uuid) LIKE ? ESCAPE '!')"},
+		[]interface{}{pattern, pattern}
+}
+
+// GetDevice returns a device by ID
+func (s *DeviceService) GetDevice(id string) (*api.Device, error) {
+	var row deviceRow
+	err := s.db.conn.Get(&row, "SELECT "+deviceColumns+" FROM devices WHERE id = ?", id)
+	if isNotFound(err) {
+		return nil, fmt.Errorf("device not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get device: %w", err)
+	}
+	return row.toAPI()
+}
+
+// EnrollDevice enrolls a new device, replacing any previous record with the same UUID
+func (s *DeviceService) EnrollDevice(enrollment api.DeviceEnrollment) (*api.Device, error) {
+	now := time.Now().UTC()
+	device := &api.Device{
+		ID:         enrollment.UUID,
+		UUID:       enrollment.UUID,
+		Hostname:   enrollment.Hostname,
+		Platform:   enrollment.Platform,
+		OSVersion:  enrollment.OSVersion,
+		Status:     "online",
+		LastSeen:   now,
+		EnrolledAt: now,
+		Revision:   1,
+		Labels:     make(map[string]string),
+	}
+
+	tx, err := s.db.conn.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	var enrolled, existing int
+	if err := tx.Get(&enrolled, "SELECT COUNT(*) FROM devices"); err != nil {
+		return nil, fmt.Errorf("count devices: %w", err)
+	}
+	// A re-enrolled device continues from its previous revision, so that
+	// changes expecting that revision do not apply to the new record
+	err = tx.Get(&existing, "SELECT revision FROM devices WHERE id = ?", device.ID)
+	if err != nil && !isNotFound(err) {
+		return nil, fmt.Errorf("get device revision: %w", err)
+	}
+	device.Revision = existing + 1
+	// Re-enrolling a managed device does not count against the license
+	if existing == 0 {
+		if s.license != nil {
+			if err := s.license.CheckEnrollment(enrolled); err != nil {
+				return nil, err
+			}
+		}
+		enrolled++
+	}
+
+	if _, err := tx.Exec("DELETE FROM devices WHERE id = ?", device.ID); err != nil {
+		return nil, fmt.Errorf("replace device: %w", err)
+	}
+	_, err = tx.Exec(`INSERT INTO devices (id, uuid, hostname, platform, os_version, status, labels, last_seen, enrolled_at,
+	revision)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		device.ID, device.UUID, device.Hostname, device.Platform, device.OSVersion,
+		device.Status, "{}", device.LastSeen, device.EnrolledAt, device.Revision)
+	if err != nil {
+		return nil, fmt.Errorf("insert device: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	if s.license != nil {
+		s.license.SetDevicesEnrolled(enrolled)
+	}
+
+	s.wsNotifier.BroadcastDeviceStatusChange(device.ID, "", "online")
+
+	return device, nil
+}
+
+// CountDevices counts the managed devices by platform and status
+func (s *DeviceService) CountDevices() ([]api.DeviceCount, error) {
+	var rows []struct {
+		Platform string `db:"platform"`
+		Status   string `db:"status"`
+		Count    int    `db:"count"`
+	}
+	err := s.db.conn.Select(&rows, "SELECT platform, status, COUNT(*) AS count FROM devices GROUP BY platform, status ORDER BY platform, status")
+	if err != nil {
+		return nil, fmt.Errorf("count devices: %w", err)
+	}
+
+	counts := make([]api.DeviceCount, 0, len(rows))
+	for _, row := range rows {
+		counts = append(counts, api.DeviceCount{Platform: row.Platform, Status: row.Status, Count: row.Count})
+	}
+	return counts, nil
+}
+
+// UnenrollDevice removes a device from management
+func (s *DeviceService) UnenrollDevice(id string) error {
+	tx, err := s.db.conn.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	res, err := tx.Exec("DELETE FROM devices WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("delete device: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("device not found")
+	}
+
+	for _, stmt := range []string{
+		"DELETE FROM device_group_members WHERE device_id = ?",
+		"DELETE FROM device_policies WHERE device_id = ?",
+		"DELETE FROM device_tokens WHERE device_id = ?",
+		"DELETE FROM policy_results WHERE device_id = ?",
+	} {
+		if _, err := tx.Exec(stmt, id); err != nil {
+			return fmt.Errorf("delete device associations: %w", err)
+		}
+	}
+
+	var enrolled int
+	if err := tx.Get(&enrolled, "SELECT COUNT(*) FROM devices"); err != nil {
+		return fmt.Errorf("count devices: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	if s.license != nil {
+		s.license.SetDevicesEnrolled(enrolled)
+	}
+	return nil
+}
+
+// UpdateDevice updates device information
+func (s *DeviceService) UpdateDevice(id string, updates api.DeviceUpdates) (*api.Device, error) {
+	device, err := s.GetDevice(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if updates.Hostname != nil {
+		device.Hostname = *updates.Hostname
+	}
+	if updates.OSVersion != nil {
+		device.OSVersion = *updates.OSVersion
+	}
+	if updates.Labels != nil {
+		device.Labels = *updates.Labels
+	}
+	if updates.SystemInfo != nil {
+		device.SystemInfo = *updates.SystemInfo
+	}
+	device.LastSeen = time.Now().UTC()
+
+	labels, err := encodeJSON(device.Labels)
+	if err != nil {
+		return nil, err
+	}
+	systemInfo, err := encodeJSON(device.SystemInfo)
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.db.conn.Exec(`UPDATE devices SET hostname = ?, os_version = ?, labels = ?, system_info = ?, last_seen = ?,
+	revision = revision + 1
+WHERE id = ?`+revisionCondition,
+		device.Hostname, device.OSVersion, labels, systemInfo, device.LastSeen, id,
+		updates.IfRevision, updates.IfRevision)
+	if err != nil {
+		return nil, fmt.Errorf("update device: %w", err)
+	}
+	if err := checkRevision(res); err != nil {
+		return nil, err
+	}
+	device.Revision++
+	return device, nil
+}
+
+// devicesByIDs loads the devices with the given IDs, preserving order and
+// skipping IDs that no longer exist
+func (db *DB) devicesByIDs(ids []string) ([]*api.Device, error) {
+	devices := make([]*api.Device, 0, len(ids))
+	for _, id := range ids {
+		var row deviceRow
+		err := db.conn.Get(&row, "SELECT "+deviceColumns+" FROM devices WHERE id = ?", id)
+		if isNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("get device: %w", err)
+		}
+		device, err := row.toAPI()
+		if err != nil {
+			return nil, err
+		}
+		devices = append(devices, device)
+	}
+	return devices, nil
+}
+
+// generateID returns a new unique identifier
+func generateID() string {
+	return uuid.NewString()
+}
@@ -0,0 +1,189 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/notawar/mobius/mobius-server/api"
+	"github.com/notawar/mobius/mobius-server/pkg/service"
+)
+
+// enrollmentSecretRow is the storage representation of api.EnrollmentSecret
+type enrollmentSecretRow struct {
+	ID        string     `db:"id"`
+	Name      string     `db:"name"`
+	GroupID   string     `db:"group_id"`
+	CreatedBy string     `db:"created_by"`
+	CreatedAt time.Time  `db:"created_at"`
+	RotatedAt *time.Time `db:"rotated_at"`
+	ExpiresAt *time.Time `db:"expires_at"`
+	Revision  int        `db:"revision"`
+}
+
+const enrollmentSecretColumns = `id, name, group_id, created_by, created_at, rotated_at, expires_at, revision`
+
+func (r *enrollmentSecretRow) toAPI() *api.EnrollmentSecret {
+	return &api.EnrollmentSecret{
+		ID:        r.ID,
+		Name:      r.Name,
+		GroupID:   r.GroupID,
+		CreatedBy: r.CreatedBy,
+		CreatedAt: r.CreatedAt,
+		RotatedAt: r.RotatedAt,
+		ExpiresAt: r.ExpiresAt,
+		Revision:  r.Revision,
+	}
+}
+
+// enrollmentSecretListTable answers list queries over enrollment secrets
+var enrollmentSecretListTable = listTable{
+	from: "enrollment_secrets",
+	id:   "id",
+	columns: map[string]string{
+		"id":         "id",
+		"name":       "name",
+		"group_id":   "group_id",
+		"created_by": "created_by",
+		"created_at": "created_at",
+		"rotated_at": "rotated_at",
+		"expires_at": "expires_at",
+	},
+}
+
+// EnrollmentService is a database-backed implementation of api.EnrollmentService
+type EnrollmentService struct {
+	db *DB
+}
+
+// NewEnrollmentService creates a new database-backed enrollment service
+func NewEnrollmentService(db *DB) *EnrollmentService {
+	return &EnrollmentService{db: db}
+}
+
+// ListEnrollmentSecrets returns all enrollment secrets, oldest first
+func (s *EnrollmentService) ListEnrollmentSecrets() ([]*api.EnrollmentSecret, error) {
+	var rows []enrollmentSecretRow
+	if err := s.db.conn.Select(&rows, "SELECT "+enrollmentSecretColumns+
+		" FROM enrollment_secrets ORDER BY created_at, id"); err != nil {
+		return nil, fmt.Errorf("list enrollment secrets: %w", err)
+	}
+
+	secrets := make([]*api.EnrollmentSecret, 0, len(rows))
+	for i := range rows {
+		secrets = append(secrets, rows[i].toAPI())
+	}
+	return secrets, nil
+}
+
+// QueryEnrollmentSecrets answers a list query over the enrollment secrets
+func (s *EnrollmentService) QueryEnrollmentSecrets(q *api.ListQuery) ([]*api.EnrollmentSecret, int, error) {
+	var rows []enrollmentSecretRow
+	total, err := s.db.queryList(&rows, enrollmentSecretColumns, enrollmentSecretListTable, q, nil, nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("list enrollment secrets: %w", err)
+	}
+
+	secrets := make([]*api.EnrollmentSecret, 0, len(rows))
+	for i := range rows {
+		secrets = append(secrets, rows[i].toAPI())
+	}
+	return secrets, total, nil
+}
+
+// GetEnrollmentSecret returns an enrollment secret by ID
+func (s *EnrollmentService) GetEnrollmentSecret(id string) (*api.EnrollmentSecret, error) {
+	var row enrollmentSecretRow
+	err := s.db.conn.Get(&row, "SELECT "+enrollmentSecretColumns+" FROM enrollment_secrets WHERE id = ?", id)
+	if isNotFound(err) {
+		return nil, fmt.Errorf("enrollment secret not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get enrollment secret: %w", err)
+	}
+	return row.toAPI(), nil
+}
+
+// CreateEnrollmentSecret creates a secret and returns it with its value
+func (s *EnrollmentService) CreateEnrollmentSecret(req api.EnrollmentSecretCreate) (*api.EnrollmentSecret, error) {
+	value, hash, err := service.NewEnrollmentSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	secret := &api.EnrollmentSecret{
+		ID:        generateID(),
+		Name:      req.Name,
+		GroupID:   req.GroupID,
+		CreatedBy: req.CreatedBy,
+		CreatedAt: time.Now().UTC(),
+		ExpiresAt: req.ExpiresAt,
+		Revision:  1,
+	}
+	_, err = s.db.conn.Exec(`INSERT INTO enrollment_secrets (id, name, group_id, secret_hash, created_by, created_at, expires_at,
+	revision)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		secret.ID, secret.Name, secret.GroupID, hash, secret.CreatedBy, secret.CreatedAt, secret.ExpiresAt, secret.Revision)
+	if err != nil {
+		return nil, fmt.Errorf("insert enrollment secret: %w", err)
+	}
+
+	secret.Secret = value
+	return secret, nil
+}
+
+// RotateEnrollmentSecret replaces the value of a secret and returns the new one
+func (s *EnrollmentService) RotateEnrollmentSecret(id string) (*api.EnrollmentSecret, error) {
+	value, hash, err := service.NewEnrollmentSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := s.db.conn.Exec("UPDATE enrollment_secrets SET secret_hash = ?, rotated_at = ?, revision = revision + 1 WHERE id = ?",
+		hash, time.Now().UTC(), id)
+	if err != nil {
+		return nil, fmt.Errorf("rotate enrollment secret: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return nil, err
+	} else if n == 0 {
+		return nil, fmt.Errorf("enrollment secret not found")
+	}
+
+	secret, err := s.GetEnrollmentSecret(id)
+	if err != nil {
+		return nil, err
+	}
+	secret.Secret = value
+	return secret, nil
+}
+
+// DeleteEnrollmentSecret deletes a secret; devices can no longer enroll with it
+func (s *EnrollmentService) DeleteEnrollmentSecret(id string) error {
+	res, err := s.db.conn.Exec("DELETE FROM enrollment_secrets WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("delete enrollment secret: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return fmt.Errorf("enrollment secret not found")
+	}
+	return nil
+}
+
+// ValidateEnrollmentSecret returns the unexpired secret matching value
+func (s *EnrollmentService) ValidateEnrollmentSecret(value string) (*api.EnrollmentSecret, error) {
+	var row enrollmentSecretRow
+	err := s.db.conn.Get(&row, "SELECT "+enrollmentSecretColumns+" FROM enrollment_secrets WHERE secret_hash = ?",
+		service.HashToken(value))
+	if isNotFound(err) {
+		return nil, fmt.Errorf("invalid enrollment secret")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("validate enrollment secret: %w", err)
+	}
+	if row.ExpiresAt != nil && !time.Now().Before(*row.ExpiresAt) {
+		return nil, fmt.Errorf("enrollment secret expired")
+	}
+	return row.toAPI(), nil
+}
@@ -0,0 +1,195 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/notawar/mobius/mobius-server/api"
+)
+
+// groupRow is the storage representation of api.Group
+type groupRow struct {
+	ID          string    `db:"id"`
+	Name        string    `db:"name"`
+	Description string    `db:"description"`
+	CreatedAt   time.Time `db:"created_at"`
+	UpdatedAt   time.Time `db:"updated_at"`
+}
+
+const groupColumns = "id, name, COALESCE(description, '') AS description, created_at, updated_at"
+
+// GroupService is a database-backed implementation of api.GroupService
+type GroupService struct {
+	db *DB
+}
+
+// NewGroupService creates a new database-backed group service
+func NewGroupService(db *DB) *GroupService {
+	return &GroupService{db: db}
+}
+
+// CreateGroup creates a new device group
+func (s *GroupService) CreateGroup(group api.Group) error {
+	if group.ID == "" {
+		group.ID = fmt.Sprintf("group-%s", generateID())
+	}
+	now := time.Now().UTC()
+
+	tx, err := s.db.conn.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	if _, err := tx.Exec("INSERT INTO `groups` (id, name, description, created_at, updated_at) VALUES (?, ?, ?, ?, ?)",
+		group.ID, group.Name, group.Description, now, now); err != nil {
+		return fmt.Errorf("insert group: %w", err)
+	}
+	for i, deviceID := range group.DeviceIDs {
+		if _, err := tx.Exec("INSERT INTO group_devices (group_id, device_id, position) VALUES (?, ?, ?)",
+			group.ID, deviceID, i); err != nil {
+			return fmt.Errorf("insert group device: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetGroups returns all device groups
+func (s *GroupService) GetGroups() ([]api.Group, error) {
+	var rows []groupRow
+	if err := s.db.conn.Select(&rows, "SELECT "+groupColumns+" FROM `groups` ORDER BY created_at, id"); err != nil {
+		return nil, fmt.Errorf("list groups: %w", err)
+	}
+
+	groups := make([]api.Group, 0, len(rows))
+	for i := range rows {
+		group, err := s.toAPI(&rows[i])
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, *group)
+	}
+	return groups, nil
+}
+
+// GetGroup returns a specific device group by ID
+func (s *GroupService) GetGroup(id string) (*api.Group, error) {
+	var row groupRow
+	err := s.db.conn.Get(&row, "SELECT "+groupColumns+" FROM `groups` WHERE id = ?", id)
+	if isNotFound(err) {
+		return nil, fmt.Errorf("group not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get group: %w", err)
+	}
+	return s.toAPI(&row)
+}
+
+// UpdateGroup updates an existing device group
+func (s *GroupService) UpdateGroup(id string, group api.Group) error {
+	res, err := s.db.conn.Exec("UPDATE `groups` SET name = ?, description = ?, updated_at = ? WHERE id = ?",
+		group.Name, group.Description, time.Now().UTC(), id)
+	if err != nil {
+		return fmt.Errorf("update group: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("group not found")
+	}
+	return nil
+}
+
+// DeleteGroup removes a device group
+func (s *GroupService) DeleteGroup(id string) error {
+	tx, err := s.db.conn.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	res, err := tx.Exec("DELETE FROM `groups` WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("delete group: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("group not found")
+	}
+	if _, err := tx.Exec("DELETE FROM group_devices WHERE group_id = ?", id); err != nil {
+		return fmt.Errorf("delete group devices: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// AddDeviceToGroup adds a device to a group
+func (s *GroupService) AddDeviceToGroup(groupID, deviceID string) error {
+	if _, err := s.GetGroup(groupID); err != nil {
+		return err
+	}
+
+	tx, err := s.db.conn.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	var count int
+	if err := tx.Get(&count, "SELECT COUNT(*) FROM group_devices WHERE group_id = ? AND device_id = ?",
+		groupID, deviceID); err != nil {
+		return fmt.Errorf("check group membership: %w", err)
+	}
+	if count > 0 {
+		return nil // Already in group
+	}
+
+	var position int
+	if err := tx.Get(&position, "SELECT COALESCE(MAX(position) + 1, 0) FROM group_devices WHERE group_id = ?",
+		groupID); err != nil {
+		return fmt.Errorf("get group device position: %w", err)
+	}
+	if _, err := tx.Exec("INSERT INTO group_devices (group_id, device_id, position) VALUES (?, ?, ?)",
+		groupID, deviceID, position); err != nil {
+		return fmt.Errorf("add device to group: %w", err)
+	}
+	if _, err := tx.Exec("UPDATE `groups` SET updated_at = ? WHERE id = ?", time.Now().UTC(), groupID); err != nil {
+		return fmt.Errorf("update group: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// RemoveDeviceFromGroup removes a device from a group
+func (s *GroupService) RemoveDeviceFromGroup(groupID, deviceID string) error {
+	if _, err := s.GetGroup(groupID); err != nil {
+		return err
+	}
+
+	res, err := s.db.conn.Exec("DELETE FROM group_devices WHERE group_id = ? AND device_id = ?", groupID, deviceID)
+	if err != nil {
+		return fmt.Errorf("remove device from group: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("device not in group")
+	}
+
+	if _, err := s.db.conn.Exec("UPDATE `groups` SET updated_at = ? WHERE id = ?", time.Now().UTC(), groupID); err != nil {
+		return fmt.Errorf("update group: %w", err)
+	}
+	return nil
+}
+
+func (s *GroupService) toAPI(row *groupRow) (*api.Group, error) {
+	group := &api.Group{
+		ID:          row.ID,
+		Name:        row.Name,
+		Description: row.Description,
+		DeviceIDs:   []string{},
+		CreatedAt:   row.CreatedAt,
+		UpdatedAt:   row.UpdatedAt,
+	}
+	if err := s.db.conn.Select(&group.DeviceIDs,
+		"SELECT device_id FROM group_devices WHERE group_id = ? ORDER BY position", row.ID); err != nil {
+		return nil, fmt.Errorf("list group devices: %w", err)
+	}
+	return group, nil
+}
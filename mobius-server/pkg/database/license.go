@@ -0,0 +1,52 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// licenseKeySetting names the license key in the settings table
+const licenseKeySetting = "license_key"
+
+// LicenseStore is a database-backed implementation of service.LicenseStore
+type LicenseStore struct {
+	db *DB
+}
+
+// NewLicenseStore creates a new database-backed license key store
+func NewLicenseStore(db *DB) *LicenseStore {
+	return &LicenseStore{db: db}
+}
+
+// GetLicenseKey returns the stored license key, or "" when none was stored
+func (s *LicenseStore) GetLicenseKey() (string, error) {
+	var key string
+	err := s.db.conn.Get(&key, `SELECT value FROM settings WHERE name = ?`, licenseKeySetting)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("get license key: %w", err)
+	}
+	return key, nil
+}
+
+// SetLicenseKey stores the license key, replacing the previous one
+func (s *LicenseStore) SetLicenseKey(key string) error {
+	tx, err := s.db.conn.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	if _, err := tx.Exec(`DELETE FROM settings WHERE name = ?`, licenseKeySetting); err != nil {
+		return fmt.Errorf("set license key: %w", err)
+	}
+	if _, err := tx.Exec(`INSERT INTO settings (name, value, updated_at) VALUES (?, ?, ?)`,
+		licenseKeySetting, key, time.Now().UTC()); err != nil {
+		return fmt.Errorf("set license key: %w", err)
+	}
+	return tx.Commit()
+}
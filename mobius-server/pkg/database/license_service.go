@@ -1,11 +0,0 @@
-package database
-
-// LicenseService provides database operations for license management
-type LicenseService struct {
-	// Database connection will be added here
-}
-
-// NewLicenseService creates a new database-backed license service
-func NewLicenseService() *LicenseService {
-	return &LicenseService{}
-}
@@ -0,0 +1,229 @@
+package database
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/notawar/mobius/mobius-server/api"
+)
+
+// listTable describes how a collection is stored, to answer list queries in
+// SQL
+type listTable struct {
+	// from is the table of the collection, with its alias if columns use one
+	from string
+	// id is the ID column
+	id string
+	// columns maps the fields of the collection to SQL expressions. Fields
+	// without one, which are computed rather than stored, are filtered and
+	// sorted on in memory.
+	columns map[string]string
+	// labels is the column holding the labels of items as JSON, if they
+	// have any
+	labels string
+	// deviceColumn is the column naming the device of an item, for queries
+	// limited to the members of device groups
+	deviceColumn string
+	// groupColumn is the column naming the device group of an item, for
+	// queries limited to device groups
+	groupColumn string
+}
+
+// labelKeyPattern matches the label keys that are inlined in JSON paths
+var labelKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_./:-]+$`)
+
+// listExpr returns the SQL expression of a field
+func (db *DB) listExpr(table listTable, field string) (string, error) {
+	if expr, ok := table.columns[field]; ok {
+		return expr, nil
+	}
+	if key, ok := strings.CutPrefix(field, "labels."); ok && table.labels != "" && labelKeyPattern.MatchString(key) {
+		return db.jsonText(table.labels, `$."`+key+`"`), nil
+	}
+	return "", api.ErrUnsupportedListQuery
+}
+
+// jsonText returns the SQL expression of the text at path in a JSON column,
+// NULL when the column is empty or has no value there
+func (db *DB) jsonText(column, path string) string {
+	if db.config.Driver == DriverMySQL {
+		return "JSON_UNQUOTE(JSON_EXTRACT(NULLIF(" + column + ", ''), '" + path + "'))"
+	}
+	return "json_extract(NULLIF(" + column + ", ''), '" + path + "')"
+}
+
+// queryList selects into dest, a pointer to a slice of rows, the page of a
+// list query over table, restricted to the rows matching the conditions of
+// where. It returns the number of rows matching the filters of the query. As
+// api.ListQuery queriers do, it selects one row more than the limit when more
+// rows follow.
+func (db *DB) queryList(dest interface{}, columns string, table listTable, q *api.ListQuery, where []string, args []interface{}) (int, error) {
+	for _, filter := range q.Filters {
+		expr, err := db.listExpr(table, filter.Field)
+		if err != nil {
+			return 0, err
+		}
+		cond, condArgs := listFilterCondition(expr, filter)
+		where = append(where, cond)
+		args = append(args, condArgs...)
+	}
+	if q.DeviceGroupIDs != nil {
+		cond, condArgs, err := table.scopeCondition(q.DeviceGroupIDs)
+		if err != nil {
+			return 0, err
+		}
+		where = append(where, cond)
+		args = append(args, condArgs...)
+	}
+
+	sortExprs := make([]string, len(q.Sort))
+	order := make([]string, 0, len(q.Sort)+1)
+	desc := false
+	for i, key := range q.Sort {
+		expr, err := db.listExpr(table, key.Field)
+		if err != nil {
+			return 0, err
+		}
+		sortExprs[i], desc = expr, key.Desc
+		order = append(order, expr+sortDirection(desc))
+	}
+	// The ID breaks ties in the direction of the last sort key
+	order = append(order, table.id+sortDirection(desc))
+
+	var total int
+	if err := db.conn.Get(&total, "SELECT COUNT(*) FROM "+table.from+whereClause(where), args...); err != nil {
+		return 0, err
+	}
+
+	if q.After != nil {
+		cond, condArgs := listAfterCondition(sortExprs, table.id, q)
+		where = append(where, cond)
+		args = append(args, condArgs...)
+	}
+	query := "SELECT " + columns + " FROM " + table.from + whereClause(where) +
+		" ORDER BY " + strings.Join(order, ", ") + " LIMIT ? OFFSET ?"
+	if err := db.conn.Select(dest, query, append(args, q.Limit+1, q.Offset)...); err != nil {
+		return 0, err
+	}
+	return total, nil
+}
+
+// scopeCondition limits a query to the device groups of a scoped user
+func (t listTable) scopeCondition(groupIDs []string) (string, []interface{}, error) {
+	if len(groupIDs) == 0 {
+		return "1 = 0", nil, nil
+	}
+	placeholders, args := inList(groupIDs)
+	switch {
+	case t.deviceColumn != "":
+		return t.deviceColumn + " IN (SELECT device_id FROM device_group_members WHERE group_id IN " + placeholders + ")", args, nil
+	case t.groupColumn != "":
+		return t.groupColumn + " IN " + placeholders, args, nil
+	}
+	return "", nil, api.ErrUnsupportedListQuery
+}
+
+// listFilterCondition returns the SQL condition of a filter on expr. Like
+// the filters of lists paged in memory, only ne and nin match NULL.
+func listFilterCondition(expr string, filter api.ListFilter) (string, []interface{}) {
+	switch filter.Op {
+	case "ne":
+		return "(" + expr + " IS NULL OR " + expr + " <> ?)", filter.Operands
+	case "in":
+		if len(filter.Operands) == 0 {
+			return "1 = 0", nil
+		}
+		placeholders, args := inList(filter.Operands)
+		return expr + " IN " + placeholders, args
+	case "nin":
+		if len(filter.Operands) == 0 {
+			return "1 = 1", nil
+		}
+		placeholders, args := inList(filter.Operands)
+		return "(" + expr + " IS NULL OR " + expr + " NOT IN " + placeholders + ")", args
+	case "contains", "prefix":
+		pattern := escapeLike(strings.ToLower(filter.Operands[0].(string))) + "%"
+		if filter.Op == "contains" {
+			pattern = "%" + pattern
+		}
+		return "LOWER(" + expr + ") LIKE ? ESCAPE '!'", []interface{}{pattern}
+	}
+
+	operator := map[string]string{"lt": "<", "lte": "<=", "gt": ">", "gte": ">="}[filter.Op]
+	if operator == "" {
+		operator = "="
+	}
+	return expr + " " + operator + " ?", filter.Operands
+}
+
+// listAfterCondition matches the rows sorted after the position a query
+// continues from. NULLs sort first, as in lists paged in memory and in the
+// ascending order of SQLite and MySQL.
+func listAfterCondition(sortExprs []string, idColumn string, q *api.ListQuery) (string, []interface{}) {
+	exprs := append(sortExprs[:len(sortExprs):len(sortExprs)], idColumn)
+	values := append(q.After.Values[:len(q.After.Values):len(q.After.Values)], q.After.ID)
+	descs := make([]bool, len(exprs))
+	for i, key := range q.Sort {
+		descs[i] = key.Desc
+	}
+	descs[len(descs)-1] = q.Sort[len(q.Sort)-1].Desc
+
+	var (
+		alternatives []string
+		args         []interface{}
+		equal        []string
+		equalArgs    []interface{}
+	)
+	for i, expr := range exprs {
+		var after string
+		var afterArgs []interface{}
+		switch {
+		case values[i] == nil && !descs[i]:
+			after = expr + " IS NOT NULL"
+		case values[i] == nil:
+			// Nothing sorts after NULL in descending order
+		case !descs[i]:
+			after, afterArgs = expr+" > ?", []interface{}{values[i]}
+		default:
+			after, afterArgs = "("+expr+" < ? OR "+expr+" IS NULL)", []interface{}{values[i]}
+		}
+		if after != "" {
+			alternatives = append(alternatives, "("+strings.Join(append(equal[:len(equal):len(equal)], after), " AND ")+")")
+			args = append(append(args, equalArgs...), afterArgs...)
+		}
+
+		if values[i] == nil {
+			equal = append(equal, expr+" IS NULL")
+		} else {
+			equal = append(equal, expr+" = ?")
+			equalArgs = append(equalArgs, values[i])
+		}
+	}
+	if len(alternatives) == 0 {
+		return "1 = 0", nil
+	}
+	return "(" + strings.Join(alternatives, " OR ") + ")", args
+}
+
+// inList returns a parenthesized list of placeholders for values
+func inList[T any](values []T) (string, []interface{}) {
+	args := make([]interface{}, len(values))
+	for i, value := range values {
+		args[i] = value
+	}
+	return "(?" + strings.Repeat(", ?", len(values)-1) + ")", args
+}
+
+func whereClause(where []string) string {
+	if len(where) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(where, " AND ")
+}
+
+func sortDirection(desc bool) string {
+	if desc {
+		return " DESC"
+	}
+	return " ASC"
+}
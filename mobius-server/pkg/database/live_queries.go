@@ -0,0 +1,284 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/notawar/mobius/mobius-server/api"
+	"github.com/notawar/mobius/mobius-server/pkg/service"
+)
+
+// campaignRow is the storage representation of api.LiveQueryCampaign
+type campaignRow struct {
+	ID               string     `db:"id"`
+	Query            string     `db:"query"`
+	Status           string     `db:"status"`
+	CreatedBy        string     `db:"created_by"`
+	CreatedAt        time.Time  `db:"created_at"`
+	ExpiresAt        time.Time  `db:"expires_at"`
+	CompletedAt      *time.Time `db:"completed_at"`
+	DevicesTotal     int        `db:"devices_total"`
+	DevicesResponded int        `db:"devices_responded"`
+}
+
+// liveQueryResultRow is the storage representation of api.LiveQueryResult
+type liveQueryResultRow struct {
+	DeviceID    string     `db:"device_id"`
+	Status      string     `db:"status"`
+	Rows        string     `db:"result_rows"`
+	Error       string     `db:"error"`
+	DurationMS  int64      `db:"duration_ms"`
+	RespondedAt *time.Time `db:"responded_at"`
+}
+
+const campaignColumns = `id, query, status, created_by, created_at, expires_at, completed_at, devices_total, devices_responded`
+
+const liveQueryResultColumns = `device_id, status, COALESCE(result_rows, '') AS result_rows, COALESCE(error, '') AS error,
+duration_ms, responded_at`
+
+func (r *liveQueryResultRow) toAPI() (*api.LiveQueryResult, error) {
+	result := &api.LiveQueryResult{
+		DeviceID:    r.DeviceID,
+		Status:      r.Status,
+		Error:       r.Error,
+		DurationMS:  r.DurationMS,
+		RespondedAt: r.RespondedAt,
+	}
+	if err := decodeJSON(r.Rows, &result.Rows); err != nil {
+		return nil, fmt.Errorf("decode live query rows: %w", err)
+	}
+	return result, nil
+}
+
+// LiveQueryService is a database-backed implementation of api.LiveQueryService
+type LiveQueryService struct {
+	db         *DB
+	wsNotifier service.WebSocketNotifier
+}
+
+// NewLiveQueryService creates a new database-backed live query service
+func NewLiveQueryService(db *DB) *LiveQueryService {
+	return &LiveQueryService{
+		db:         db,
+		wsNotifier: &service.NoOpWebSocketNotifier{},
+	}
+}
+
+// SetWebSocketNotifier sets the WebSocket notifier
+func (s *LiveQueryService) SetWebSocketNotifier(notifier service.WebSocketNotifier) {
+	s.wsNotifier = notifier
+}
+
+// StartCampaign distributes a query to the requested devices
+func (s *LiveQueryService) StartCampaign(req api.LiveQueryCreate) (*api.LiveQueryCampaign, error) {
+	campaign, err := service.NewLiveQueryCampaign(generateID(), req, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.conn.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	_, err = tx.Exec("INSERT INTO live_query_campaigns ("+campaignColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		campaign.ID, campaign.Query, campaign.Status, campaign.CreatedBy, campaign.CreatedAt, campaign.ExpiresAt,
+		campaign.CompletedAt, campaign.DevicesTotal, campaign.DevicesResponded)
+	if err != nil {
+		return nil, fmt.Errorf("insert live query campaign: %w", err)
+	}
+	for i, result := range campaign.Results {
+		if _, err := tx.Exec("INSERT INTO live_query_results (campaign_id, device_id, position, status) VALUES (?, ?, ?, ?)",
+			campaign.ID, result.DeviceID, i, result.Status); err != nil {
+			return nil, fmt.Errorf("insert live query result: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return campaign, nil
+}
+
+// GetCampaign returns a campaign and the results received so far
+func (s *LiveQueryService) GetCampaign(id string) (*api.LiveQueryCampaign, error) {
+	campaign, err := loadCampaign(s.db.conn, id)
+	if isNotFound(err) {
+		return nil, fmt.Errorf("campaign not found")
+	}
+	return campaign, err
+}
+
+// PendingQueries returns the queries a device has yet to answer
+func (s *LiveQueryService) PendingQueries(deviceID string) ([]*api.DeviceLiveQuery, error) {
+	var rows []struct {
+		CampaignID string `db:"campaign_id"`
+		Query      string `db:"query"`
+	}
+	err := s.db.conn.Select(&rows, `SELECT c.id AS campaign_id, c.query
+FROM live_query_results r JOIN live_query_campaigns c ON c.id = r.campaign_id
+WHERE r.device_id = ? AND r.status = ? AND c.status = ? AND c.expires_at > ?
+ORDER BY c.created_at, c.id`,
+		deviceID, api.LiveQueryStatusPending, api.LiveQueryStatusRunning, time.Now().UTC())
+	if err != nil {
+		return nil, fmt.Errorf("list pending live queries: %w", err)
+	}
+
+	queries := make([]*api.DeviceLiveQuery, 0, len(rows))
+	for _, row := range rows {
+		queries = append(queries, &api.DeviceLiveQuery{CampaignID: row.CampaignID, Query: row.Query})
+	}
+	return queries, nil
+}
+
+// SubmitResult records the result of a device and completes the campaign
+// once every device has answered
+func (s *LiveQueryService) SubmitResult(campaignID, deviceID string, report api.LiveQueryReport) (*api.LiveQueryResult, error) {
+	tx, err := s.db.conn.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	campaign, err := loadCampaign(tx, campaignID)
+	if isNotFound(err) {
+		return nil, fmt.Errorf("campaign not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := service.ApplyLiveQueryReport(campaign, deviceID, report, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := encodeJSON(result.Rows)
+	if err != nil {
+		return nil, err
+	}
+	// Only a pending result may be answered, so concurrent reports from the
+	// same device cannot both be recorded
+	res, err := tx.Exec(`UPDATE live_query_results SET status = ?, result_rows = ?, error = ?, duration_ms = ?, responded_at = ?
+WHERE campaign_id = ? AND device_id = ? AND status = ?`,
+		result.Status, rows, result.Error, result.DurationMS, result.RespondedAt,
+		campaignID, deviceID, api.LiveQueryStatusPending)
+	if err != nil {
+		return nil, fmt.Errorf("update live query result: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return nil, err
+	} else if n == 0 {
+		return nil, fmt.Errorf("device already reported a result")
+	}
+
+	if _, err := tx.Exec(`UPDATE live_query_campaigns SET status = ?, completed_at = ?, devices_responded = devices_responded + 1
+WHERE id = ?`, campaign.Status, campaign.CompletedAt, campaignID); err != nil {
+		return nil, fmt.Errorf("update live query campaign: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	s.notifyResult(campaign, result)
+	if campaign.Status != api.LiveQueryStatusRunning {
+		s.notifyCompleted(campaign)
+	}
+	return result, nil
+}
+
+// ExpireCampaigns times out running campaigns past their deadline
+func (s *LiveQueryService) ExpireCampaigns() (int, error) {
+	now := time.Now().UTC()
+
+	tx, err := s.db.conn.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	var ids []string
+	if err := tx.Select(&ids, "SELECT id FROM live_query_campaigns WHERE status = ? AND expires_at <= ?",
+		api.LiveQueryStatusRunning, now); err != nil {
+		return 0, fmt.Errorf("list expired live queries: %w", err)
+	}
+
+	expired := make([]*api.LiveQueryCampaign, 0, len(ids))
+	for _, id := range ids {
+		campaign, err := loadCampaign(tx, id)
+		if err != nil {
+			return 0, err
+		}
+		service.TimeOutLiveQueryCampaign(campaign, now)
+
+		if _, err := tx.Exec("UPDATE live_query_results SET status = ? WHERE campaign_id = ? AND status = ?",
+			api.LiveQueryStatusTimedOut, id, api.LiveQueryStatusPending); err != nil {
+			return 0, fmt.Errorf("time out live query results: %w", err)
+		}
+		if _, err := tx.Exec("UPDATE live_query_campaigns SET status = ?, completed_at = ? WHERE id = ?",
+			campaign.Status, campaign.CompletedAt, id); err != nil {
+			return 0, fmt.Errorf("time out live query campaign: %w", err)
+		}
+		expired = append(expired, campaign)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	for _, campaign := range expired {
+		for _, result := range campaign.Results {
+			if result.Status == api.LiveQueryStatusTimedOut {
+				s.notifyResult(campaign, result)
+			}
+		}
+		s.notifyCompleted(campaign)
+	}
+	return len(expired), nil
+}
+
+func (s *LiveQueryService) notifyResult(campaign *api.LiveQueryCampaign, result *api.LiveQueryResult) {
+	s.wsNotifier.BroadcastLiveQueryResult(campaign.CreatedBy, campaign.ID, result.DeviceID, result.Status, result.Rows, result.Error)
+}
+
+func (s *LiveQueryService) notifyCompleted(campaign *api.LiveQueryCampaign) {
+	s.wsNotifier.BroadcastLiveQueryCompleted(campaign.CreatedBy, campaign.ID, campaign.Status, campaign.DevicesResponded, campaign.DevicesTotal)
+}
+
+// loadCampaign reads a campaign and its results in target order
+func loadCampaign(q sqlx.Queryer, id string) (*api.LiveQueryCampaign, error) {
+	var row campaignRow
+	if err := sqlx.Get(q, &row, "SELECT "+campaignColumns+" FROM live_query_campaigns WHERE id = ?", id); err != nil {
+		return nil, err
+	}
+
+	var rows []liveQueryResultRow
+	if err := sqlx.Select(q, &rows, "SELECT "+liveQueryResultColumns+
+		" FROM live_query_results WHERE campaign_id = ? ORDER BY position", id); err != nil {
+		return nil, fmt.Errorf("list live query results: %w", err)
+	}
+
+	campaign := &api.LiveQueryCampaign{
+		ID:               row.ID,
+		Query:            row.Query,
+		Status:           row.Status,
+		CreatedBy:        row.CreatedBy,
+		CreatedAt:        row.CreatedAt,
+		ExpiresAt:        row.ExpiresAt,
+		CompletedAt:      row.CompletedAt,
+		DevicesTotal:     row.DevicesTotal,
+		DevicesResponded: row.DevicesResponded,
+		Results:          make([]*api.LiveQueryResult, 0, len(rows)),
+	}
+	for i := range rows {
+		result, err := rows[i].toAPI()
+		if err != nil {
+			return nil, err
+		}
+		campaign.Results = append(campaign.Results, result)
+	}
+	return campaign, nil
+}
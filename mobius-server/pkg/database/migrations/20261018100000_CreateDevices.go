@@ -0,0 +1,30 @@
+package migrations
+
+import (
+	"database/sql"
+)
+
+func init() {
+	MigrationClient.AddMigration(Up_20261018100000, Down_20261018100000)
+}
+
+func Up_20261018100000(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+CREATE TABLE devices (
+	id VARCHAR(255) NOT NULL PRIMARY KEY,
+	uuid VARCHAR(255) NOT NULL,
+	hostname VARCHAR(255) NOT NULL DEFAULT '',
+	platform VARCHAR(32) NOT NULL DEFAULT '',
+	os_version VARCHAR(255) NOT NULL DEFAULT '',
+	status VARCHAR(32) NOT NULL DEFAULT '',
+	labels TEXT,
+	last_seen DATETIME NOT NULL,
+	enrolled_at DATETIME NOT NULL
+)`)
+	return err
+}
+
+func Down_20261018100000(tx *sql.Tx) error {
+	_, err := tx.Exec(`DROP TABLE IF EXISTS devices`)
+	return err
+}
@@ -0,0 +1,45 @@
+package migrations
+
+import (
+	"database/sql"
+)
+
+func init() {
+	MigrationClient.AddMigration(Up_20261018100100, Down_20261018100100)
+}
+
+func Up_20261018100100(tx *sql.Tx) error {
+	stmts := []string{
+		`CREATE TABLE device_groups (
+	id VARCHAR(255) NOT NULL PRIMARY KEY,
+	name VARCHAR(255) NOT NULL,
+	description TEXT,
+	filters TEXT,
+	labels TEXT,
+	created_at DATETIME NOT NULL,
+	updated_at DATETIME NOT NULL
+)`,
+		`CREATE TABLE device_group_members (
+	group_id VARCHAR(255) NOT NULL,
+	device_id VARCHAR(255) NOT NULL,
+	created_at DATETIME NOT NULL,
+	PRIMARY KEY (group_id, device_id)
+)`,
+		`CREATE INDEX idx_device_group_members_device_id ON device_group_members (device_id)`,
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func Down_20261018100100(tx *sql.Tx) error {
+	for _, table := range []string{"device_group_members", "device_groups"} {
+		if _, err := tx.Exec(`DROP TABLE IF EXISTS ` + table); err != nil {
+			return err
+		}
+	}
+	return nil
+}
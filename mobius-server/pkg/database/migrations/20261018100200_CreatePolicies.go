@@ -0,0 +1,53 @@
+package migrations
+
+import (
+	"database/sql"
+)
+
+func init() {
+	MigrationClient.AddMigration(Up_20261018100200, Down_20261018100200)
+}
+
+func Up_20261018100200(tx *sql.Tx) error {
+	stmts := []string{
+		`CREATE TABLE policies (
+	id VARCHAR(255) NOT NULL PRIMARY KEY,
+	name VARCHAR(255) NOT NULL,
+	description TEXT,
+	platform VARCHAR(32) NOT NULL DEFAULT '',
+	enabled BOOLEAN NOT NULL DEFAULT TRUE,
+	configuration TEXT,
+	created_at DATETIME NOT NULL,
+	updated_at DATETIME NOT NULL
+)`,
+		`CREATE TABLE device_policies (
+	device_id VARCHAR(255) NOT NULL,
+	policy_id VARCHAR(255) NOT NULL,
+	position INT NOT NULL DEFAULT 0,
+	PRIMARY KEY (device_id, policy_id)
+)`,
+		`CREATE INDEX idx_device_policies_policy_id ON device_policies (policy_id)`,
+		`CREATE TABLE group_policies (
+	group_id VARCHAR(255) NOT NULL,
+	policy_id VARCHAR(255) NOT NULL,
+	position INT NOT NULL DEFAULT 0,
+	PRIMARY KEY (group_id, policy_id)
+)`,
+		`CREATE INDEX idx_group_policies_policy_id ON group_policies (policy_id)`,
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func Down_20261018100200(tx *sql.Tx) error {
+	for _, table := range []string{"group_policies", "device_policies", "policies"} {
+		if _, err := tx.Exec(`DROP TABLE IF EXISTS ` + table); err != nil {
+			return err
+		}
+	}
+	return nil
+}
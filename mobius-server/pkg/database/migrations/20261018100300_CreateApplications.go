@@ -0,0 +1,28 @@
+package migrations
+
+import (
+	"database/sql"
+)
+
+func init() {
+	MigrationClient.AddMigration(Up_20261018100300, Down_20261018100300)
+}
+
+func Up_20261018100300(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+CREATE TABLE applications (
+	id VARCHAR(255) NOT NULL PRIMARY KEY,
+	name VARCHAR(255) NOT NULL,
+	version VARCHAR(255) NOT NULL DEFAULT '',
+	platform VARCHAR(32) NOT NULL DEFAULT '',
+	size BIGINT NOT NULL DEFAULT 0,
+	checksum VARCHAR(64) NOT NULL DEFAULT '',
+	created_at DATETIME NOT NULL
+)`)
+	return err
+}
+
+func Down_20261018100300(tx *sql.Tx) error {
+	_, err := tx.Exec(`DROP TABLE IF EXISTS applications`)
+	return err
+}
@@ -0,0 +1,53 @@
+package migrations
+
+import (
+	"database/sql"
+)
+
+func init() {
+	MigrationClient.AddMigration(Up_20261018100400, Down_20261018100400)
+}
+
+func Up_20261018100400(tx *sql.Tx) error {
+	stmts := []string{
+		`CREATE TABLE users (
+	id VARCHAR(255) NOT NULL PRIMARY KEY,
+	email VARCHAR(255) NOT NULL,
+	name VARCHAR(255) NOT NULL DEFAULT '',
+	role VARCHAR(32) NOT NULL DEFAULT '',
+	created_at DATETIME NOT NULL,
+	updated_at DATETIME NOT NULL
+)`,
+		`CREATE UNIQUE INDEX idx_users_email ON users (email)`,
+		`CREATE TABLE user_tokens (
+	token VARCHAR(255) NOT NULL PRIMARY KEY,
+	user_id VARCHAR(255) NOT NULL,
+	expires_at DATETIME NOT NULL,
+	created_at DATETIME NOT NULL
+)`,
+		`CREATE INDEX idx_user_tokens_user_id ON user_tokens (user_id)`,
+		`CREATE TABLE device_tokens (
+	token VARCHAR(255) NOT NULL PRIMARY KEY,
+	device_id VARCHAR(255) NOT NULL,
+	created_at DATETIME NOT NULL
+)`,
+		`CREATE INDEX idx_device_tokens_device_id ON device_tokens (device_id)`,
+		`INSERT INTO users (id, email, name, role, created_at, updated_at)
+VALUES ('admin-1', 'admin@mobius.local', 'Administrator', 'admin', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`,
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func Down_20261018100400(tx *sql.Tx) error {
+	for _, table := range []string{"device_tokens", "user_tokens", "users"} {
+		if _, err := tx.Exec(`DROP TABLE IF EXISTS ` + table); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package migrations
+
+import (
+	"database/sql"
+)
+
+func init() {
+	MigrationClient.AddMigration(Up_20261018100500, Down_20261018100500)
+}
+
+func Up_20261018100500(tx *sql.Tx) error {
+	stmts := []string{
+		`CREATE TABLE ` + "`groups`" + ` (
+	id VARCHAR(255) NOT NULL PRIMARY KEY,
+	name VARCHAR(255) NOT NULL,
+	description TEXT,
+	created_at DATETIME NOT NULL,
+	updated_at DATETIME NOT NULL
+)`,
+		`CREATE TABLE group_devices (
+	group_id VARCHAR(255) NOT NULL,
+	device_id VARCHAR(255) NOT NULL,
+	position INT NOT NULL DEFAULT 0,
+	PRIMARY KEY (group_id, device_id)
+)`,
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func Down_20261018100500(tx *sql.Tx) error {
+	for _, table := range []string{"group_devices", "`groups`"} {
+		if _, err := tx.Exec(`DROP TABLE IF EXISTS ` + table); err != nil {
+			return err
+		}
+	}
+	return nil
+}
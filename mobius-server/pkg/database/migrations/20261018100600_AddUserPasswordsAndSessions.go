@@ -0,0 +1,62 @@
+package migrations
+
+import (
+	"database/sql"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func init() {
+	MigrationClient.AddMigration(Up_20261018100600, Down_20261018100600)
+}
+
+func Up_20261018100600(tx *sql.Tx) error {
+	// The bootstrap admin keeps the development password it had before
+	// passwords were stored; operators are expected to change it.
+	adminHash, err := bcrypt.GenerateFromPassword([]byte("admin123"), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	stmts := []string{
+		`ALTER TABLE users ADD COLUMN password_hash VARCHAR(255) NOT NULL DEFAULT ''`,
+		`DROP TABLE IF EXISTS user_tokens`,
+		`CREATE TABLE user_sessions (
+	id VARCHAR(255) NOT NULL PRIMARY KEY,
+	user_id VARCHAR(255) NOT NULL,
+	refresh_token_hash VARCHAR(64) NOT NULL,
+	expires_at DATETIME NOT NULL,
+	created_at DATETIME NOT NULL
+)`,
+		`CREATE UNIQUE INDEX idx_user_sessions_refresh_token_hash ON user_sessions (refresh_token_hash)`,
+		`CREATE INDEX idx_user_sessions_user_id ON user_sessions (user_id)`,
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`UPDATE users SET password_hash = ? WHERE id = 'admin-1'`, string(adminHash))
+	return err
+}
+
+func Down_20261018100600(tx *sql.Tx) error {
+	stmts := []string{
+		`DROP TABLE IF EXISTS user_sessions`,
+		`CREATE TABLE user_tokens (
+	token VARCHAR(255) NOT NULL PRIMARY KEY,
+	user_id VARCHAR(255) NOT NULL,
+	expires_at DATETIME NOT NULL,
+	created_at DATETIME NOT NULL
+)`,
+		`CREATE INDEX idx_user_tokens_user_id ON user_tokens (user_id)`,
+		`ALTER TABLE users DROP COLUMN password_hash`,
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
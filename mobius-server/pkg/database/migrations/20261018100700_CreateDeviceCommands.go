@@ -0,0 +1,43 @@
+package migrations
+
+import (
+	"database/sql"
+)
+
+func init() {
+	MigrationClient.AddMigration(Up_20261018100700, Down_20261018100700)
+}
+
+func Up_20261018100700(tx *sql.Tx) error {
+	stmts := []string{
+		`CREATE TABLE device_commands (
+	id VARCHAR(255) NOT NULL PRIMARY KEY,
+	device_id VARCHAR(255) NOT NULL,
+	command VARCHAR(64) NOT NULL,
+	parameters TEXT,
+	status VARCHAR(32) NOT NULL,
+	result TEXT,
+	error TEXT,
+	created_by VARCHAR(255) NOT NULL DEFAULT '',
+	created_at DATETIME NOT NULL,
+	updated_at DATETIME NOT NULL,
+	expires_at DATETIME NOT NULL,
+	delivered_at DATETIME NULL,
+	acknowledged_at DATETIME NULL,
+	completed_at DATETIME NULL
+)`,
+		`CREATE INDEX idx_device_commands_device_status ON device_commands (device_id, status)`,
+		`CREATE INDEX idx_device_commands_status_expires ON device_commands (status, expires_at)`,
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func Down_20261018100700(tx *sql.Tx) error {
+	_, err := tx.Exec(`DROP TABLE IF EXISTS device_commands`)
+	return err
+}
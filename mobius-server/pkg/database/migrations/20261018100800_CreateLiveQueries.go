@@ -0,0 +1,53 @@
+package migrations
+
+import (
+	"database/sql"
+)
+
+func init() {
+	MigrationClient.AddMigration(Up_20261018100800, Down_20261018100800)
+}
+
+func Up_20261018100800(tx *sql.Tx) error {
+	stmts := []string{
+		`CREATE TABLE live_query_campaigns (
+	id VARCHAR(255) NOT NULL PRIMARY KEY,
+	query TEXT NOT NULL,
+	status VARCHAR(32) NOT NULL,
+	created_by VARCHAR(255) NOT NULL DEFAULT '',
+	created_at DATETIME NOT NULL,
+	expires_at DATETIME NOT NULL,
+	completed_at DATETIME NULL,
+	devices_total INT NOT NULL DEFAULT 0,
+	devices_responded INT NOT NULL DEFAULT 0
+)`,
+		`CREATE INDEX idx_live_query_campaigns_status_expires ON live_query_campaigns (status, expires_at)`,
+		`CREATE TABLE live_query_results (
+	campaign_id VARCHAR(255) NOT NULL,
+	device_id VARCHAR(255) NOT NULL,
+	position INT NOT NULL,
+	status VARCHAR(32) NOT NULL,
+	result_rows TEXT,
+	error TEXT,
+	duration_ms BIGINT NOT NULL DEFAULT 0,
+	responded_at DATETIME NULL,
+	PRIMARY KEY (campaign_id, device_id)
+)`,
+		`CREATE INDEX idx_live_query_results_device_status ON live_query_results (device_id, status)`,
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func Down_20261018100800(tx *sql.Tx) error {
+	for _, table := range []string{"live_query_results", "live_query_campaigns"} {
+		if _, err := tx.Exec(`DROP TABLE IF EXISTS ` + table); err != nil {
+			return err
+		}
+	}
+	return nil
+}
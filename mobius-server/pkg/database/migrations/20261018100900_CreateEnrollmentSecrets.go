@@ -0,0 +1,59 @@
+package migrations
+
+import (
+	"database/sql"
+)
+
+func init() {
+	MigrationClient.AddMigration(Up_20261018100900, Down_20261018100900)
+}
+
+func Up_20261018100900(tx *sql.Tx) error {
+	// device_tokens stored plaintext tokens and was never populated; devices
+	// now hold a single token stored as a hash.
+	stmts := []string{
+		`CREATE TABLE enrollment_secrets (
+	id VARCHAR(255) NOT NULL PRIMARY KEY,
+	name VARCHAR(255) NOT NULL,
+	group_id VARCHAR(255) NOT NULL DEFAULT '',
+	secret_hash VARCHAR(64) NOT NULL,
+	created_by VARCHAR(255) NOT NULL DEFAULT '',
+	created_at DATETIME NOT NULL,
+	rotated_at DATETIME NULL,
+	expires_at DATETIME NULL
+)`,
+		`CREATE UNIQUE INDEX idx_enrollment_secrets_secret_hash ON enrollment_secrets (secret_hash)`,
+		`DROP TABLE IF EXISTS device_tokens`,
+		`CREATE TABLE device_tokens (
+	device_id VARCHAR(255) NOT NULL PRIMARY KEY,
+	token_hash VARCHAR(64) NOT NULL,
+	created_at DATETIME NOT NULL
+)`,
+		`CREATE UNIQUE INDEX idx_device_tokens_token_hash ON device_tokens (token_hash)`,
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func Down_20261018100900(tx *sql.Tx) error {
+	stmts := []string{
+		`DROP TABLE IF EXISTS device_tokens`,
+		`CREATE TABLE device_tokens (
+	token VARCHAR(255) NOT NULL PRIMARY KEY,
+	device_id VARCHAR(255) NOT NULL,
+	created_at DATETIME NOT NULL
+)`,
+		`CREATE INDEX idx_device_tokens_device_id ON device_tokens (device_id)`,
+		`DROP TABLE IF EXISTS enrollment_secrets`,
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+package migrations
+
+import (
+	"database/sql"
+)
+
+func init() {
+	MigrationClient.AddMigration(Up_20261018101000, Down_20261018101000)
+}
+
+func Up_20261018101000(tx *sql.Tx) error {
+	// system_info holds the JSON-encoded system info reported at check-in,
+	// which device group filters evaluate.
+	_, err := tx.Exec(`ALTER TABLE devices ADD COLUMN system_info TEXT NULL`)
+	return err
+}
+
+func Down_20261018101000(tx *sql.Tx) error {
+	_, err := tx.Exec(`ALTER TABLE devices DROP COLUMN system_info`)
+	return err
+}
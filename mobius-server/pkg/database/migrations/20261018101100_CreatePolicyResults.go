@@ -0,0 +1,41 @@
+package migrations
+
+import (
+	"database/sql"
+)
+
+func init() {
+	MigrationClient.AddMigration(Up_20261018101100, Down_20261018101100)
+}
+
+func Up_20261018101100(tx *sql.Tx) error {
+	// Each row is a run of identical results of a device for a policy; seq
+	// orders the runs and latest marks the current one.
+	stmts := []string{
+		`CREATE TABLE policy_results (
+	id VARCHAR(255) NOT NULL PRIMARY KEY,
+	device_id VARCHAR(255) NOT NULL,
+	policy_id VARCHAR(255) NOT NULL,
+	seq INTEGER NOT NULL,
+	latest BOOLEAN NOT NULL DEFAULT FALSE,
+	status VARCHAR(16) NOT NULL,
+	message TEXT,
+	first_reported_at DATETIME NOT NULL,
+	last_reported_at DATETIME NOT NULL,
+	reports INTEGER NOT NULL DEFAULT 1
+)`,
+		`CREATE UNIQUE INDEX idx_policy_results_device_policy_seq ON policy_results (device_id, policy_id, seq)`,
+		`CREATE INDEX idx_policy_results_latest_policy ON policy_results (latest, policy_id)`,
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func Down_20261018101100(tx *sql.Tx) error {
+	_, err := tx.Exec(`DROP TABLE IF EXISTS policy_results`)
+	return err
+}
@@ -0,0 +1,33 @@
+package migrations
+
+import (
+	"database/sql"
+)
+
+func init() {
+	MigrationClient.AddMigration(Up_20261018101200, Down_20261018101200)
+}
+
+func Up_20261018101200(tx *sql.Tx) error {
+	// Metadata read from uploaded packages; the packages themselves are kept
+	// in the package store under the application ID.
+	for _, stmt := range []string{
+		`ALTER TABLE applications ADD COLUMN bundle_id VARCHAR(255) NOT NULL DEFAULT ''`,
+		`ALTER TABLE applications ADD COLUMN package_type VARCHAR(16) NOT NULL DEFAULT ''`,
+		`ALTER TABLE applications ADD COLUMN filename VARCHAR(255) NOT NULL DEFAULT ''`,
+	} {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func Down_20261018101200(tx *sql.Tx) error {
+	for _, column := range []string{"bundle_id", "package_type", "filename"} {
+		if _, err := tx.Exec(`ALTER TABLE applications DROP COLUMN ` + column); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package migrations
+
+import (
+	"database/sql"
+)
+
+func init() {
+	MigrationClient.AddMigration(Up_20261018101300, Down_20261018101300)
+}
+
+func Up_20261018101300(tx *sql.Tx) error {
+	// device_group_ids holds the JSON-encoded device groups a user is limited
+	// to. The operator and viewer roles became maintainer and observer.
+	stmts := []string{
+		`ALTER TABLE users ADD COLUMN device_group_ids TEXT NULL`,
+		`UPDATE users SET role = 'maintainer' WHERE role = 'operator'`,
+		`UPDATE users SET role = 'observer' WHERE role = 'viewer'`,
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func Down_20261018101300(tx *sql.Tx) error {
+	// Device technicians lose their role with the column that scopes them
+	stmts := []string{
+		`UPDATE users SET role = 'operator' WHERE role = 'maintainer'`,
+		`UPDATE users SET role = 'viewer' WHERE role IN ('observer', 'device-technician')`,
+		`ALTER TABLE users DROP COLUMN device_group_ids`,
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package migrations
+
+import (
+	"database/sql"
+)
+
+func init() {
+	MigrationClient.AddMigration(Up_20261018101400, Down_20261018101400)
+}
+
+func Up_20261018101400(tx *sql.Tx) error {
+	// Entries are paged newest first by (created_us, id); created_us is the
+	// timestamp in microseconds since the epoch, which orders the same on
+	// every driver. changes and details hold JSON.
+	stmts := []string{
+		`CREATE TABLE audit_entries (
+	id VARCHAR(255) NOT NULL PRIMARY KEY,
+	created_us BIGINT NOT NULL,
+	actor_type VARCHAR(32) NOT NULL,
+	actor_id VARCHAR(255) NOT NULL DEFAULT '',
+	actor_email VARCHAR(255) NOT NULL DEFAULT '',
+	actor_role VARCHAR(64) NOT NULL DEFAULT '',
+	action VARCHAR(128) NOT NULL,
+	target_type VARCHAR(64) NOT NULL DEFAULT '',
+	target_id VARCHAR(255) NOT NULL DEFAULT '',
+	outcome VARCHAR(16) NOT NULL,
+	reason TEXT,
+	request_method VARCHAR(16) NOT NULL DEFAULT '',
+	request_path TEXT,
+	client_ip VARCHAR(64) NOT NULL DEFAULT '',
+	user_agent TEXT,
+	changes TEXT,
+	details TEXT
+)`,
+		`CREATE INDEX idx_audit_entries_created ON audit_entries (created_us, id)`,
+		`CREATE INDEX idx_audit_entries_actor ON audit_entries (actor_id, created_us)`,
+		`CREATE INDEX idx_audit_entries_target ON audit_entries (target_type, target_id, created_us)`,
+		`CREATE INDEX idx_audit_entries_action ON audit_entries (action, created_us)`,
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func Down_20261018101400(tx *sql.Tx) error {
+	_, err := tx.Exec(`DROP TABLE IF EXISTS audit_entries`)
+	return err
+}
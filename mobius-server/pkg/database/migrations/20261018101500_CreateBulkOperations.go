@@ -0,0 +1,53 @@
+package migrations
+
+import (
+	"database/sql"
+)
+
+func init() {
+	MigrationClient.AddMigration(Up_20261018101500, Down_20261018101500)
+}
+
+func Up_20261018101500(tx *sql.Tx) error {
+	// action and selector hold JSON. Failures are ordered by position, the
+	// number of devices processed when they were recorded.
+	stmts := []string{
+		`CREATE TABLE bulk_operations (
+	id VARCHAR(255) NOT NULL PRIMARY KEY,
+	status VARCHAR(32) NOT NULL,
+	action TEXT NOT NULL,
+	selector TEXT NOT NULL,
+	created_by VARCHAR(255) NOT NULL DEFAULT '',
+	created_at DATETIME NOT NULL,
+	updated_at DATETIME NOT NULL,
+	finished_at DATETIME NULL,
+	total INT NOT NULL DEFAULT 0,
+	processed INT NOT NULL DEFAULT 0,
+	succeeded INT NOT NULL DEFAULT 0,
+	failed INT NOT NULL DEFAULT 0
+)`,
+		`CREATE INDEX idx_bulk_operations_created ON bulk_operations (created_at, id)`,
+		`CREATE TABLE bulk_operation_failures (
+	operation_id VARCHAR(255) NOT NULL,
+	position INT NOT NULL,
+	device_id VARCHAR(255) NOT NULL,
+	error TEXT,
+	PRIMARY KEY (operation_id, position)
+)`,
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func Down_20261018101500(tx *sql.Tx) error {
+	for _, table := range []string{"bulk_operation_failures", "bulk_operations"} {
+		if _, err := tx.Exec(`DROP TABLE IF EXISTS ` + table); err != nil {
+			return err
+		}
+	}
+	return nil
+}
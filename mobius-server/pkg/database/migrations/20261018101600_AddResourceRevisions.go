@@ -0,0 +1,32 @@
+package migrations
+
+import (
+	"database/sql"
+)
+
+func init() {
+	MigrationClient.AddMigration(Up_20261018101600, Down_20261018101600)
+}
+
+// revisionedTables carry the revision sent as the ETag of their resources
+var revisionedTables = []string{
+	"devices", "device_groups", "policies", "applications", "users", "enrollment_secrets",
+}
+
+func Up_20261018101600(tx *sql.Tx) error {
+	for _, table := range revisionedTables {
+		if _, err := tx.Exec(`ALTER TABLE ` + table + ` ADD COLUMN revision INT NOT NULL DEFAULT 1`); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func Down_20261018101600(tx *sql.Tx) error {
+	for _, table := range revisionedTables {
+		if _, err := tx.Exec(`ALTER TABLE ` + table + ` DROP COLUMN revision`); err != nil {
+			return err
+		}
+	}
+	return nil
+}
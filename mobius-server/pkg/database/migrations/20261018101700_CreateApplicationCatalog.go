@@ -0,0 +1,52 @@
+package migrations
+
+import (
+	"database/sql"
+)
+
+func init() {
+	MigrationClient.AddMigration(Up_20261018101700, Down_20261018101700)
+}
+
+func Up_20261018101700(tx *sql.Tx) error {
+	// Requests are looked up by device, newest first, and checked for a
+	// pending one before another is created.
+	stmts := []string{
+		`CREATE TABLE application_publications (
+	application_id VARCHAR(255) NOT NULL,
+	group_id VARCHAR(255) NOT NULL,
+	restricted BOOLEAN NOT NULL DEFAULT FALSE,
+	published_at DATETIME NOT NULL,
+	PRIMARY KEY (application_id, group_id)
+)`,
+		`CREATE TABLE application_requests (
+	id VARCHAR(255) NOT NULL PRIMARY KEY,
+	application_id VARCHAR(255) NOT NULL,
+	device_id VARCHAR(255) NOT NULL,
+	status VARCHAR(32) NOT NULL,
+	reason TEXT,
+	decided_by VARCHAR(255) NOT NULL DEFAULT '',
+	decision_note TEXT,
+	command_id VARCHAR(255) NOT NULL DEFAULT '',
+	created_at DATETIME NOT NULL,
+	decided_at DATETIME NULL
+)`,
+		`CREATE INDEX idx_application_requests_device ON application_requests (device_id, created_at)`,
+		`CREATE INDEX idx_application_requests_created ON application_requests (created_at, id)`,
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func Down_20261018101700(tx *sql.Tx) error {
+	for _, table := range []string{"application_requests", "application_publications"} {
+		if _, err := tx.Exec(`DROP TABLE IF EXISTS ` + table); err != nil {
+			return err
+		}
+	}
+	return nil
+}
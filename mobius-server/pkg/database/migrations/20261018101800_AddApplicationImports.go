@@ -0,0 +1,38 @@
+package migrations
+
+import (
+	"database/sql"
+)
+
+func init() {
+	MigrationClient.AddMigration(Up_20261018101800, Down_20261018101800)
+}
+
+func Up_20261018101800(tx *sql.Tx) error {
+	// Applications imported from the package search catalog have no package:
+	// source holds the JSON-encoded package they were imported from, which
+	// devices install with the commands.
+	for _, stmt := range []string{
+		`ALTER TABLE applications ADD COLUMN source TEXT NULL`,
+		`ALTER TABLE applications ADD COLUMN install_command TEXT NULL`,
+		`ALTER TABLE applications ADD COLUMN uninstall_command TEXT NULL`,
+		`ALTER TABLE applications ADD COLUMN detection_query TEXT NULL`,
+		`ALTER TABLE applications ADD COLUMN latest_version VARCHAR(255) NOT NULL DEFAULT ''`,
+		`ALTER TABLE applications ADD COLUMN latest_version_checked_at DATETIME NULL`,
+	} {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func Down_20261018101800(tx *sql.Tx) error {
+	for _, column := range []string{"source", "install_command", "uninstall_command", "detection_query",
+		"latest_version", "latest_version_checked_at"} {
+		if _, err := tx.Exec(`ALTER TABLE applications DROP COLUMN ` + column); err != nil {
+			return err
+		}
+	}
+	return nil
+}
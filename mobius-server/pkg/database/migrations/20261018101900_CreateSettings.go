@@ -0,0 +1,25 @@
+package migrations
+
+import (
+	"database/sql"
+)
+
+func init() {
+	MigrationClient.AddMigration(Up_20261018101900, Down_20261018101900)
+}
+
+func Up_20261018101900(tx *sql.Tx) error {
+	// settings holds server-wide values changed through the API, such as the
+	// license key, so that they survive a restart
+	_, err := tx.Exec(`CREATE TABLE settings (
+	name VARCHAR(255) NOT NULL PRIMARY KEY,
+	value TEXT NOT NULL,
+	updated_at DATETIME NOT NULL
+)`)
+	return err
+}
+
+func Down_20261018101900(tx *sql.Tx) error {
+	_, err := tx.Exec(`DROP TABLE IF EXISTS settings`)
+	return err
+}
@@ -0,0 +1,39 @@
+package migrations
+
+import (
+	"database/sql"
+	"errors"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func init() {
+	MigrationClient.AddMigration(Up_20261018102000, Down_20261018102000)
+}
+
+func Up_20261018102000(tx *sql.Tx) error {
+	// Users that must change their password may do nothing else. The
+	// bootstrap admin must while it keeps the password it was seeded with.
+	if _, err := tx.Exec(`ALTER TABLE users ADD COLUMN must_change_password BOOLEAN NOT NULL DEFAULT FALSE`); err != nil {
+		return err
+	}
+
+	var hash string
+	err := tx.QueryRow(`SELECT password_hash FROM users WHERE id = 'admin-1'`).Scan(&hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte("admin123")) != nil {
+		return nil
+	}
+	_, err = tx.Exec(`UPDATE users SET must_change_password = TRUE WHERE id = 'admin-1'`)
+	return err
+}
+
+func Down_20261018102000(tx *sql.Tx) error {
+	_, err := tx.Exec(`ALTER TABLE users DROP COLUMN must_change_password`)
+	return err
+}
@@ -0,0 +1,10 @@
+// Package migrations provides the schema migrations for the database-backed
+// API services. Migrations are written to run unchanged on MySQL and SQLite.
+package migrations
+
+import (
+	"github.com/notawar/mobius/mobius-server/server/goose"
+)
+
+// MigrationClient for API schema migrations
+var MigrationClient = goose.New("api_migrations", &goose.MySqlDialect{})
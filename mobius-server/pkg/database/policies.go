@@ -0,0 +1,421 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/notawar/mobius/mobius-server/api"
+	"github.com/notawar/mobius/mobius-server/pkg/service"
+)
+
+// policyRow is the storage representation of api.Policy
+type policyRow struct {
+	ID            string    `db:"id"`
+	Name          string    `db:"name"`
+	Description   string    `db:"description"`
+	Platform      string    `db:"platform"`
+	Enabled       bool      `db:"enabled"`
+	Configuration string    `db:"configuration"`
+	CreatedAt     time.Time `db:"created_at"`
+	UpdatedAt     time.Time `db:"updated_at"`
+	Revision      int       `db:"revision"`
+}
+
+const policyColumns = `p.id, p.name, COALESCE(p.description, '') AS description, p.platform, p.enabled,
+	COALESCE(p.configuration, '') AS configuration, p.created_at, p.updated_at, p.revision`
+
+func (r *policyRow) toAPI() (*api.Policy, error) {
+	policy := &api.Policy{
+		ID:          r.ID,
+		Name:        r.Name,
+		Description: r.Description,
+		Platform:    r.Platform,
+		Enabled:     r.Enabled,
+		CreatedAt:   r.CreatedAt,
+		UpdatedAt:   r.UpdatedAt,
+		Revision:    r.Revision,
+	}
+	if err := decodeJSON(r.Configuration, &policy.Configuration); err != nil {
+		return nil, fmt.Errorf("decode policy configuration: %w", err)
+	}
+	return policy, nil
+}
+
+func policiesFromRows(rows []policyRow) ([]*api.Policy, error) {
+	policies := make([]*api.Policy, 0, len(rows))
+	for i := range rows {
+		policy, err := rows[i].toAPI()
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, policy)
+	}
+	return policies, nil
+}
+
+// policyListTable answers list queries over policies
+var policyListTable = listTable{
+	from: "policies p",
+	id:   "p.id",
+	columns: map[string]string{
+		"id":          "p.id",
+		"name":        "p.name",
+		"description": "COALESCE(p.description, '')",
+		"platform":    "p.platform",
+		"enabled":     "p.enabled",
+		"created_at":  "p.created_at",
+		"updated_at":  "p.updated_at",
+	},
+}
+
+// PolicyService is a database-backed implementation of api.PolicyService
+type PolicyService struct {
+	db         *DB
+	wsNotifier service.WebSocketNotifier
+}
+
+// NewPolicyService creates a new database-backed policy service
+func NewPolicyService(db *DB) *PolicyService {
+	return &PolicyService{
+		db:         db,
+		wsNotifier: &service.NoOpWebSocketNotifier{},
+	}
+}
+
+// SetWebSocketNotifier sets the WebSocket notifier
+func (s *PolicyService) SetWebSocketNotifier(notifier service.WebSocketNotifier) {
+	s.wsNotifier = notifier
+}
+
+// ListPolicies returns all policies
+func (s *PolicyService) ListPolicies() ([]*api.Policy, error) {
+	var rows []policyRow
+	if err := s.db.conn.Select(&rows, "SELECT "+policyColumns+" FROM policies p ORDER BY p.created_at, p.id"); err != nil {
+		return nil, fmt.Errorf("list policies: %w", err)
+	}
+	return policiesFromRows(rows)
+}
+
+// QueryPolicies answers a list query over the policies
+func (s *PolicyService) QueryPolicies(q *api.ListQuery) ([]*api.Policy, int, error) {
+	var rows []policyRow
+	total, err := s.db.queryList(&rows, policyColumns, policyListTable, q, nil, nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("list policies: %w", err)
+	}
+	policies, err := policiesFromRows(rows)
+	return policies, total, err
+}
+
+// GetPolicy returns a policy by ID
+func (s *PolicyService) GetPolicy(id string) (*api.Policy, error) {
+	var row policyRow
+	err := s.db.conn.Get(&row, "SELECT "+policyColumns+" FROM policies p WHERE p.id = ?", id)
+	if isNotFound(err) {
+		return nil, fmt.Errorf("policy not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get policy: %w", err)
+	}
+	return row.toAPI()
+}
+
+// CreatePolicy creates a new policy
+func (s *PolicyService) CreatePolicy(policyCreate api.PolicyCreate) (*api.Policy, error) {
+	now := time.Now().UTC()
+	policy := &api.Policy{
+		ID:            generateID(),
+		Name:          policyCreate.Name,
+		Description:   policyCreate.Description,
+		Platform:      policyCreate.Platform,
+		Enabled:       true,
+		Configuration: policyCreate.Configuration,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+		Revision:      1,
+	}
+
+	configuration, err := encodeJSON(policy.Configuration)
+	if err != nil {
+		return nil, err
+	}
+	_, err = s.db.conn.Exec(`INSERT INTO policies (id, name, description, platform, enabled, configuration, created_at, updated_at,
+	revision)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		policy.ID, policy.Name, policy.Description, policy.Platform, policy.Enabled,
+		configuration, policy.CreatedAt, policy.UpdatedAt, policy.Revision)
+	if err != nil {
+		return nil, fmt.Errorf("insert policy: %w", err)
+	}
+	return policy, nil
+}
+
+// UpdatePolicy updates an existing policy
+func (s *PolicyService) UpdatePolicy(id string, updates api.PolicyUpdate) (*api.Policy, error) {
+	policy, err := s.GetPolicy(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if updates.Name != nil {
+		policy.Name = *updates.Name
+	}
+	if updates.Description != nil {
+		policy.Description = *updates.Description
+	}
+	if updates.Enabled != nil {
+		policy.Enabled = *updates.Enabled
+	}
+	if updates.Configuration != nil {
+		policy.Configuration = *updates.Configuration
+	}
+	policy.UpdatedAt = time.Now().UTC()
+
+	configuration, err := encodeJSON(policy.Configuration)
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.db.conn.Exec(`UPDATE policies SET name = ?, description = ?, enabled = ?, configuration = ?, updated_at = ?,
+	revision = revision + 1
+WHERE id = ?`+revisionCondition,
+		policy.Name, policy.Description, policy.Enabled, configuration, policy.UpdatedAt, id,
+		updates.IfRevision, updates.IfRevision)
+	if err != nil {
+		return nil, fmt.Errorf("update policy: %w", err)
+	}
+	if err := checkRevision(res); err != nil {
+		return nil, err
+	}
+	policy.Revision++
+	return policy, nil
+}
+
+// DeletePolicy deletes a policy
+func (s *PolicyService) DeletePolicy(id string) error {
+	tx, err := s.db.conn.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	res, err := tx.Exec("DELETE FROM policies WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("delete policy: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("policy not found")
+	}
+
+	for _, stmt := range []string{
+		"DELETE FROM device_policies WHERE policy_id = ?",
+		"DELETE FROM group_policies WHERE policy_id = ?",
+		"DELETE FROM policy_results WHERE policy_id = ?",
+	} {
+		if _, err := tx.Exec(stmt, id); err != nil {
+			return fmt.Errorf("delete policy assignments: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetDevicePolicies returns policies assigned to a device
+func (s *PolicyService) GetDevicePolicies(deviceID string) ([]*api.Policy, error) {
+	var rows []policyRow
+	err := s.db.conn.Select(&rows, "SELECT "+policyColumns+
+		" FROM policies p JOIN device_policies dp ON dp.policy_id = p.id WHERE dp.device_id = ? ORDER BY dp.position", deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("list device policies: %w", err)
+	}
+	return policiesFromRows(rows)
+}
+
+// AssignDevicePolicies replaces the set of policies assigned to a device
+func (s *PolicyService) AssignDevicePolicies(deviceID string, policyIDs []string) error {
+	for _, policyID := range policyIDs {
+		if err := s.ensureExists(policyID); err != nil {
+			return fmt.Errorf("policy %s not found", policyID)
+		}
+	}
+
+	tx, err := s.db.conn.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	if _, err := tx.Exec("DELETE FROM device_policies WHERE device_id = ?", deviceID); err != nil {
+		return fmt.Errorf("clear device policies: %w", err)
+	}
+	for i, policyID := range policyIDs {
+		if _, err := tx.Exec("INSERT INTO device_policies (device_id, policy_id, position) VALUES (?, ?, ?)",
+			deviceID, policyID, i); err != nil {
+			return fmt.Errorf("assign device policy: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetPolicyDevices returns all devices assigned to a policy
+func (s *PolicyService) GetPolicyDevices(policyID string) ([]*api.Device, error) {
+	if err := s.ensureExists(policyID); err != nil {
+		return nil, err
+	}
+
+	var deviceIDs []string
+	if err := s.db.conn.Select(&deviceIDs,
+		"SELECT device_id FROM device_policies WHERE policy_id = ? ORDER BY device_id", policyID); err != nil {
+		return nil, fmt.Errorf("list policy devices: %w", err)
+	}
+	return s.db.devicesByIDs(deviceIDs)
+}
+
+// QueryPolicyDevices answers a list query over the devices assigned to a
+// policy
+func (s *PolicyService) QueryPolicyDevices(policyID string, q *api.ListQuery) ([]*api.Device, int, error) {
+	if err := s.ensureExists(policyID); err != nil {
+		return nil, 0, err
+	}
+	return s.db.queryDevices(q,
+		[]string{"id IN (SELECT device_id FROM device_policies WHERE policy_id = ?)"}, []interface{}{policyID})
+}
+
+// AssignPolicyToDevice assigns a single policy to a device
+func (s *PolicyService) AssignPolicyToDevice(policyID, deviceID string) error {
+	if err := s.ensureExists(policyID); err != nil {
+		return err
+	}
+
+	if err := s.appendAssignment("device_policies", "device_id", deviceID, policyID); err != nil {
+		if err == errAlreadyAssigned {
+			return fmt.Errorf("policy already assigned to device")
+		}
+		return err
+	}
+
+	s.wsNotifier.BroadcastPolicyAssignment(policyID, deviceID, "", "assigned")
+
+	return nil
+}
+
+// UnassignPolicyFromDevice removes a policy from a device
+func (s *PolicyService) UnassignPolicyFromDevice(policyID, deviceID string) error {
+	res, err := s.db.conn.Exec("DELETE FROM device_policies WHERE device_id = ? AND policy_id = ?", deviceID, policyID)
+	if err != nil {
+		return fmt.Errorf("unassign device policy: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("policy not assigned to device")
+	}
+	return nil
+}
+
+// GetPolicyGroups returns all device groups assigned to a policy
+func (s *PolicyService) GetPolicyGroups(policyID string) ([]*api.DeviceGroup, error) {
+	if err := s.ensureExists(policyID); err != nil {
+		return nil, err
+	}
+
+	var rows []deviceGroupRow
+	err := s.db.conn.Select(&rows, deviceGroupSelect+
+		" JOIN group_policies gp ON gp.group_id = g.id WHERE gp.policy_id = ? ORDER BY g.created_at, g.id", policyID)
+	if err != nil {
+		return nil, fmt.Errorf("list policy groups: %w", err)
+	}
+
+	groups := make([]*api.DeviceGroup, 0, len(rows))
+	for i := range rows {
+		group, err := rows[i].toAPI()
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+	return groups, nil
+}
+
+// QueryPolicyGroups answers a list query over the device groups assigned to
+// a policy
+func (s *PolicyService) QueryPolicyGroups(policyID string, q *api.ListQuery) ([]*api.DeviceGroup, int, error) {
+	if err := s.ensureExists(policyID); err != nil {
+		return nil, 0, err
+	}
+	return s.db.queryDeviceGroups(q,
+		[]string{"g.id IN (SELECT group_id FROM group_policies WHERE policy_id = ?)"}, []interface{}{policyID})
+}
+
+// AssignPolicyToGroup assigns a policy to a device group
+func (s *PolicyService) AssignPolicyToGroup(policyID, groupID string) error {
+	if err := s.ensureExists(policyID); err != nil {
+		return err
+	}
+
+	if err := s.appendAssignment("group_policies", "group_id", groupID, policyID); err != nil {
+		if err == errAlreadyAssigned {
+			return fmt.Errorf("policy already assigned to group")
+		}
+		return err
+	}
+
+	s.wsNotifier.BroadcastPolicyAssignment(policyID, "", groupID, "assigned")
+
+	return nil
+}
+
+// UnassignPolicyFromGroup removes a policy from a device group
+func (s *PolicyService) UnassignPolicyFromGroup(policyID, groupID string) error {
+	res, err := s.db.conn.Exec("DELETE FROM group_policies WHERE group_id = ? AND policy_id = ?", groupID, policyID)
+	if err != nil {
+		return fmt.Errorf("unassign group policy: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("policy not assigned to group")
+	}
+	return nil
+}
+
+var errAlreadyAssigned = fmt.Errorf("already assigned")
+
+// appendAssignment appends a policy to the end of a device or group assignment list
+func (s *PolicyService) appendAssignment(table, ownerColumn, ownerID, policyID string) error {
+	tx, err := s.db.conn.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	var count int
+	if err := tx.Get(&count, "SELECT COUNT(*) FROM "+table+" WHERE "+ownerColumn+" = ? AND policy_id = ?",
+		ownerID, policyID); err != nil {
+		return fmt.Errorf("check policy assignment: %w", err)
+	}
+	if count > 0 {
+		return errAlreadyAssigned
+	}
+
+	var position int
+	if err := tx.Get(&position, "SELECT COALESCE(MAX(position) + 1, 0) FROM "+table+" WHERE "+ownerColumn+" = ?",
+		ownerID); err != nil {
+		return fmt.Errorf("get policy assignment position: %w", err)
+	}
+
+	if _, err := tx.Exec("INSERT INTO "+table+" ("+ownerColumn+", policy_id, position) VALUES (?, ?, ?)",
+		ownerID, policyID, position); err != nil {
+		return fmt.Errorf("assign policy: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// ensureExists returns an error if the policy does not exist
+func (s *PolicyService) ensureExists(policyID string) error {
+	var count int
+	if err := s.db.conn.Get(&count, "SELECT COUNT(*) FROM policies WHERE id = ?", policyID); err != nil {
+		return fmt.Errorf("get policy: %w", err)
+	}
+	if count == 0 {
+		return fmt.Errorf("policy not found")
+	}
+	return nil
+}
@@ -1,4 +0,0 @@
-package database
-
-// Services provides database-backed implementations of core MDM services
-// This package will eventually replace the in-memory mock services
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/notawar/mobius/mobius-server/api"
+)
+
+// ApplicationRequestServiceImpl implements the ApplicationRequestService
+// interface
+type ApplicationRequestServiceImpl struct {
+	requests map[string]*api.ApplicationRequest
+	mu       sync.RWMutex
+}
+
+// NewApplicationRequestService creates a new application request service
+// instance
+func NewApplicationRequestService() *ApplicationRequestServiceImpl {
+	return &ApplicationRequestServiceImpl{
+		requests: make(map[string]*api.ApplicationRequest),
+	}
+}
+
+// CreateApplicationRequest records a pending request unless the device
+// already has one for the application
+func (s *ApplicationRequestServiceImpl) CreateApplicationRequest(req api.ApplicationRequestCreate) (*api.ApplicationRequest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.requests {
+		if existing.DeviceID == req.DeviceID && existing.ApplicationID == req.ApplicationID &&
+			existing.Status == api.AppRequestStatusPending {
+			return nil, api.ErrApplicationRequestPending
+		}
+	}
+
+	request := &api.ApplicationRequest{
+		ID:            generateID(),
+		ApplicationID: req.ApplicationID,
+		DeviceID:      req.DeviceID,
+		Status:        api.AppRequestStatusPending,
+		Reason:        req.Reason,
+		CreatedAt:     time.Now(),
+	}
+	s.requests[request.ID] = request
+	return copyApplicationRequest(request), nil
+}
+
+// GetApplicationRequest returns a request by ID
+func (s *ApplicationRequestServiceImpl) GetApplicationRequest(id string) (*api.ApplicationRequest, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	request, exists := s.requests[id]
+	if !exists {
+		return nil, fmt.Errorf("application request not found")
+	}
+	return copyApplicationRequest(request), nil
+}
+
+// ListApplicationRequests returns the requests of a device, or of every
+// device if deviceID is empty, newest first
+func (s *ApplicationRequestServiceImpl) ListApplicationRequests(deviceID string) ([]*api.ApplicationRequest, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	requests := make([]*api.ApplicationRequest, 0)
+	for _, request := range s.requests {
+		if deviceID != "" && request.DeviceID != deviceID {
+			continue
+		}
+		requests = append(requests, copyApplicationRequest(request))
+	}
+
+	sort.Slice(requests, func(i, j int) bool {
+		if !requests[i].CreatedAt.Equal(requests[j].CreatedAt) {
+			return requests[i].CreatedAt.After(requests[j].CreatedAt)
+		}
+		return requests[i].ID > requests[j].ID
+	})
+	return requests, nil
+}
+
+// DecideApplicationRequest approves or denies a pending request
+func (s *ApplicationRequestServiceImpl) DecideApplicationRequest(id string, decision api.ApplicationRequestDecision) (*api.ApplicationRequest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	request, exists := s.requests[id]
+	if !exists {
+		return nil, fmt.Errorf("application request not found")
+	}
+	if err := ApplyApplicationDecision(request, decision, time.Now()); err != nil {
+		return nil, err
+	}
+	return copyApplicationRequest(request), nil
+}
+
+// ApplyApplicationDecision validates a decision and applies it to a pending
+// request
+func ApplyApplicationDecision(request *api.ApplicationRequest, decision api.ApplicationRequestDecision, now time.Time) error {
+	if decision.Status != api.AppRequestStatusApproved && decision.Status != api.AppRequestStatusDenied {
+		return fmt.Errorf("invalid decision %q", decision.Status)
+	}
+	if request.Status != api.AppRequestStatusPending {
+		return api.ErrApplicationRequestDecided
+	}
+
+	request.Status = decision.Status
+	request.DecidedBy = decision.DecidedBy
+	request.DecisionNote = decision.Note
+	request.CommandID = decision.CommandID
+	request.DecidedAt = &now
+	return nil
+}
+
+// copyApplicationRequest returns a shallow copy of request so callers cannot
+// mutate the store
+func copyApplicationRequest(request *api.ApplicationRequest) *api.ApplicationRequest {
+	r := *request
+	return &r
+}
@@ -0,0 +1,288 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/notawar/mobius/mobius-server/api"
+	"github.com/notawar/mobius/mobius-server/server/mobius"
+)
+
+// MaxMemoryAuditEntries bounds the in-memory audit trail; the oldest entries
+// are dropped beyond it
+const MaxMemoryAuditEntries = 10000
+
+// AuditServiceImpl implements the AuditService interface in memory
+type AuditServiceImpl struct {
+	entries []*api.AuditEntry // oldest first
+	mu      sync.RWMutex
+}
+
+// NewAuditService creates a new audit service instance
+func NewAuditService() *AuditServiceImpl {
+	return &AuditServiceImpl{}
+}
+
+// RecordAudit stores an entry, assigning its ID and timestamp when unset
+func (s *AuditServiceImpl) RecordAudit(entry *api.AuditEntry) error {
+	PrepareAuditEntry(entry, time.Now())
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Entries normally arrive in order; insert late ones where they belong
+	i := sort.Search(len(s.entries), func(i int) bool {
+		return auditBefore(entry, s.entries[i])
+	})
+	s.entries = append(s.entries, nil)
+	copy(s.entries[i+1:], s.entries[i:])
+	s.entries[i] = entry
+
+	if over := len(s.entries) - MaxMemoryAuditEntries; over > 0 {
+		s.entries = append(s.entries[:0:0], s.entries[over:]...)
+	}
+	return nil
+}
+
+// ListAuditEntries returns a page of the entries matching filters, newest first
+func (s *AuditServiceImpl) ListAuditEntries(filters api.AuditFilters) (*api.AuditPage, error) {
+	var after *AuditCursor
+	if filters.Cursor != "" {
+		cursor, err := DecodeAuditCursor(filters.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		after = &cursor
+	}
+	limit := AuditLimit(filters.Limit)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	page := &api.AuditPage{Entries: make([]*api.AuditEntry, 0)}
+	for i := len(s.entries) - 1; i >= 0; i-- {
+		entry := s.entries[i]
+		if after != nil && !after.Older(entry) {
+			continue
+		}
+		if !MatchesAuditFilters(entry, filters) {
+			continue
+		}
+		if len(page.Entries) == limit {
+			page.NextCursor = NewAuditCursor(page.Entries[limit-1]).Encode()
+			break
+		}
+		page.Entries = append(page.Entries, entry)
+	}
+	return page, nil
+}
+
+// auditBefore orders entries by timestamp, then ID
+func auditBefore(a, b *api.AuditEntry) bool {
+	if !a.Timestamp.Equal(b.Timestamp) {
+		return a.Timestamp.Before(b.Timestamp)
+	}
+	return a.ID < b.ID
+}
+
+// PrepareAuditEntry assigns the ID and timestamp of an entry when unset.
+// Timestamps are kept in UTC at microsecond precision, which every store
+// preserves, so that cursors compare the same everywhere.
+func PrepareAuditEntry(entry *api.AuditEntry, now time.Time) {
+	if entry.ID == "" {
+		entry.ID = generateID()
+	}
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = now
+	}
+	entry.Timestamp = entry.Timestamp.UTC().Truncate(time.Microsecond)
+}
+
+// AuditLimit returns the page size for a requested limit
+func AuditLimit(limit int) int {
+	if limit <= 0 {
+		return api.DefaultAuditLimit
+	}
+	if limit > api.MaxAuditLimit {
+		return api.MaxAuditLimit
+	}
+	return limit
+}
+
+// MatchesAuditFilters reports whether an entry matches every set filter
+func MatchesAuditFilters(entry *api.AuditEntry, filters api.AuditFilters) bool {
+	if filters.ActorID != "" && entry.Actor.ID != filters.ActorID {
+		return false
+	}
+	if filters.ActorType != "" && entry.Actor.Type != filters.ActorType {
+		return false
+	}
+	if filters.Action != "" {
+		if strings.HasSuffix(filters.Action, ".") {
+			if !strings.HasPrefix(entry.Action, filters.Action) {
+				return false
+			}
+		} else if entry.Action != filters.Action {
+			return false
+		}
+	}
+	if filters.TargetType != "" && entry.TargetType != filters.TargetType {
+		return false
+	}
+	if filters.TargetID != "" && entry.TargetID != filters.TargetID {
+		return false
+	}
+	if filters.Outcome != "" && entry.Outcome != filters.Outcome {
+		return false
+	}
+	if filters.Since != nil && entry.Timestamp.Before(*filters.Since) {
+		return false
+	}
+	if filters.Until != nil && !entry.Timestamp.Before(*filters.Until) {
+		return false
+	}
+	return true
+}
+
+// AuditCursor is the position of the last entry of an audit page. Pages are
+// ordered newest first by timestamp, then ID, so the next page holds the
+// entries before the cursor.
+type AuditCursor struct {
+	Timestamp time.Time
+	ID        string
+}
+
+// NewAuditCursor returns the cursor positioned at an entry
+func NewAuditCursor(entry *api.AuditEntry) AuditCursor {
+	return AuditCursor{Timestamp: entry.Timestamp, ID: entry.ID}
+}
+
+// Encode returns the opaque form of the cursor handed to clients
+func (c AuditCursor) Encode() string {
+	raw := strconv.FormatInt(c.Timestamp.UnixMicro(), 10) + ":" + c.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// Older reports whether an entry is older than the cursor, and so belongs on
+// a later page
+func (c AuditCursor) Older(entry *api.AuditEntry) bool {
+	return auditBefore(entry, &api.AuditEntry{Timestamp: c.Timestamp, ID: c.ID})
+}
+
+// DecodeAuditCursor parses a cursor returned by Encode
+func DecodeAuditCursor(s string) (AuditCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return AuditCursor{}, api.ErrInvalidAuditCursor
+	}
+	micros, id, ok := strings.Cut(string(raw), ":")
+	if !ok || id == "" {
+		return AuditCursor{}, api.ErrInvalidAuditCursor
+	}
+	usec, err := strconv.ParseInt(micros, 10, 64)
+	if err != nil {
+		return AuditCursor{}, api.ErrInvalidAuditCursor
+	}
+	return AuditCursor{Timestamp: time.UnixMicro(usec).UTC(), ID: id}, nil
+}
+
+// Audit forwarding defaults
+const (
+	auditForwardQueueSize = 1024
+	auditForwardBatchSize = 100
+	auditForwardInterval  = time.Second
+	auditForwardTimeout   = 30 * time.Second
+)
+
+// AuditForwarder records audit entries in a store and forwards them, as JSON,
+// to a log destination such as the writers of server/logging. Forwarding is
+// asynchronous and best effort: entries that the destination cannot keep up
+// with are dropped from the forwarded stream but remain in the store.
+type AuditForwarder struct {
+	api.AuditService
+
+	logger mobius.JSONLogger
+	queue  chan json.RawMessage
+}
+
+// NewAuditForwarder creates a forwarder recording into store and writing to
+// logger once Run is started
+func NewAuditForwarder(store api.AuditService, logger mobius.JSONLogger) *AuditForwarder {
+	return &AuditForwarder{
+		AuditService: store,
+		logger:       logger,
+		queue:        make(chan json.RawMessage, auditForwardQueueSize),
+	}
+}
+
+// RecordAudit stores the entry and queues it for forwarding
+func (f *AuditForwarder) RecordAudit(entry *api.AuditEntry) error {
+	if err := f.AuditService.RecordAudit(entry); err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("encode audit entry: %w", err)
+	}
+	select {
+	case f.queue <- b:
+	default:
+		log.Warn().Str("audit_id", entry.ID).Msg("Audit forwarding queue full, entry not forwarded")
+	}
+	return nil
+}
+
+// Run writes queued entries in batches until ctx is done, then flushes what
+// is left
+func (f *AuditForwarder) Run(ctx context.Context) {
+	ticker := time.NewTicker(auditForwardInterval)
+	defer ticker.Stop()
+
+	batch := make([]json.RawMessage, 0, auditForwardBatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		writeCtx, cancel := context.WithTimeout(context.Background(), auditForwardTimeout)
+		defer cancel()
+		if err := f.logger.Write(writeCtx, batch); err != nil {
+			log.Error().Err(err).Int("entries", len(batch)).Msg("Failed to forward audit entries")
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			for {
+				select {
+				case b := <-f.queue:
+					batch = append(batch, b)
+					if len(batch) >= auditForwardBatchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		case b := <-f.queue:
+			batch = append(batch, b)
+			if len(batch) >= auditForwardBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
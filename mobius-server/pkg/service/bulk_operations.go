@@ -0,0 +1,182 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/notawar/mobius/mobius-server/api"
+)
+
+// BulkOperationServiceImpl implements the BulkOperationService interface in
+// memory
+type BulkOperationServiceImpl struct {
+	operations map[string]*api.BulkOperation
+	mu         sync.RWMutex
+}
+
+// NewBulkOperationService creates a new bulk operation service instance
+func NewBulkOperationService() *BulkOperationServiceImpl {
+	return &BulkOperationServiceImpl{
+		operations: make(map[string]*api.BulkOperation),
+	}
+}
+
+// NewBulkOperation returns a running operation for req created at now
+func NewBulkOperation(id string, req api.BulkOperationCreate, now time.Time) *api.BulkOperation {
+	return &api.BulkOperation{
+		ID:        id,
+		Status:    api.BulkStatusRunning,
+		Action:    req.Action,
+		Selector:  req.Selector,
+		CreatedBy: req.CreatedBy,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Total:     req.Total,
+	}
+}
+
+// SettledBulkStatus is the status of an operation whose devices have all
+// been processed: failed when every device failed, partially failed when
+// some did and completed otherwise
+func SettledBulkStatus(op *api.BulkOperation) string {
+	switch {
+	case op.Failed > 0 && op.Failed == op.Processed:
+		return api.BulkStatusFailed
+	case op.Failed > 0:
+		return api.BulkStatusPartiallyFailed
+	default:
+		return api.BulkStatusCompleted
+	}
+}
+
+// CreateBulkOperation records a new running operation
+func (s *BulkOperationServiceImpl) CreateBulkOperation(req api.BulkOperationCreate) (*api.BulkOperation, error) {
+	op := NewBulkOperation(generateID(), req, time.Now())
+
+	s.mu.Lock()
+	s.operations[op.ID] = op
+	s.mu.Unlock()
+
+	return copyBulkOperation(op), nil
+}
+
+// GetBulkOperation returns an operation by ID
+func (s *BulkOperationServiceImpl) GetBulkOperation(id string) (*api.BulkOperation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	op, exists := s.operations[id]
+	if !exists {
+		return nil, fmt.Errorf("bulk operation not found")
+	}
+	return copyBulkOperation(op), nil
+}
+
+// ListBulkOperations returns every operation without its failures, newest
+// first
+func (s *BulkOperationServiceImpl) ListBulkOperations() ([]*api.BulkOperation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	operations := make([]*api.BulkOperation, 0, len(s.operations))
+	for _, op := range s.operations {
+		cp := *op
+		cp.Failures = nil
+		operations = append(operations, &cp)
+	}
+
+	sort.Slice(operations, func(i, j int) bool {
+		if !operations[i].CreatedAt.Equal(operations[j].CreatedAt) {
+			return operations[i].CreatedAt.After(operations[j].CreatedAt)
+		}
+		return operations[i].ID > operations[j].ID
+	})
+	return operations, nil
+}
+
+// RecordBulkResult counts the outcome for a device
+func (s *BulkOperationServiceImpl) RecordBulkResult(id, deviceID, errMsg string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	op, exists := s.operations[id]
+	if !exists {
+		return fmt.Errorf("bulk operation not found")
+	}
+
+	op.Processed++
+	if errMsg != "" {
+		op.Failed++
+		op.Failures = append(op.Failures, api.BulkFailure{DeviceID: deviceID, Error: errMsg})
+	} else {
+		op.Succeeded++
+	}
+	op.UpdatedAt = time.Now()
+	return nil
+}
+
+// FinishBulkOperation settles the status of a running operation
+func (s *BulkOperationServiceImpl) FinishBulkOperation(id string) (*api.BulkOperation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	op, exists := s.operations[id]
+	if !exists {
+		return nil, fmt.Errorf("bulk operation not found")
+	}
+
+	if op.Status == api.BulkStatusRunning {
+		now := time.Now()
+		op.Status = SettledBulkStatus(op)
+		op.UpdatedAt = now
+		op.FinishedAt = &now
+	}
+	return copyBulkOperation(op), nil
+}
+
+// CancelBulkOperation cancels a running operation
+func (s *BulkOperationServiceImpl) CancelBulkOperation(id string) (*api.BulkOperation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	op, exists := s.operations[id]
+	if !exists {
+		return nil, fmt.Errorf("bulk operation not found")
+	}
+	if op.Status != api.BulkStatusRunning {
+		return nil, api.ErrBulkOperationFinished
+	}
+
+	now := time.Now()
+	op.Status = api.BulkStatusCancelled
+	op.UpdatedAt = now
+	op.FinishedAt = &now
+	return copyBulkOperation(op), nil
+}
+
+// InterruptBulkOperations marks the running operations without progress
+// since before as interrupted
+func (s *BulkOperationServiceImpl) InterruptBulkOperations(before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	interrupted := 0
+	for _, op := range s.operations {
+		if op.Status == api.BulkStatusRunning && op.UpdatedAt.Before(before) {
+			op.Status = api.BulkStatusInterrupted
+			op.UpdatedAt = now
+			op.FinishedAt = &now
+			interrupted++
+		}
+	}
+	return interrupted, nil
+}
+
+func copyBulkOperation(op *api.BulkOperation) *api.BulkOperation {
+	cp := *op
+	cp.Failures = append([]api.BulkFailure(nil), op.Failures...)
+	return &cp
+}
@@ -0,0 +1,292 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/notawar/mobius/mobius-server/api"
+)
+
+// CommandServiceImpl implements the CommandService interface
+type CommandServiceImpl struct {
+	commands   map[string]*api.DeviceCommand
+	devices    api.DeviceService
+	wsNotifier WebSocketNotifier
+	mu         sync.RWMutex
+}
+
+// NewCommandService creates a new command service instance that queues
+// commands for the devices known to devices
+func NewCommandService(devices api.DeviceService) *CommandServiceImpl {
+	return &CommandServiceImpl{
+		commands:   make(map[string]*api.DeviceCommand),
+		devices:    devices,
+		wsNotifier: &NoOpWebSocketNotifier{}, // Default to no-op
+	}
+}
+
+// SetWebSocketNotifier sets the WebSocket notifier
+func (s *CommandServiceImpl) SetWebSocketNotifier(notifier WebSocketNotifier) {
+	s.wsNotifier = notifier
+}
+
+// EnqueueCommand queues a command for a device whether or not it is online
+func (s *CommandServiceImpl) EnqueueCommand(deviceID string, req api.CommandCreate) (*api.DeviceCommand, error) {
+	if _, err := s.devices.GetDevice(deviceID); err != nil {
+		return nil, err
+	}
+
+	cmd := NewDeviceCommand(generateID(), deviceID, req, time.Now())
+
+	s.mu.Lock()
+	s.commands[cmd.ID] = cmd
+	s.mu.Unlock()
+
+	s.notify(cmd)
+	return copyCommand(cmd), nil
+}
+
+// GetCommand returns a command by ID
+func (s *CommandServiceImpl) GetCommand(id string) (*api.DeviceCommand, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	cmd, exists := s.commands[id]
+	if !exists {
+		return nil, fmt.Errorf("command not found")
+	}
+	return copyCommand(cmd), nil
+}
+
+// ListCommands returns commands matching filters, newest first
+func (s *CommandServiceImpl) ListCommands(filters api.CommandFilters) ([]*api.DeviceCommand, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	commands := make([]*api.DeviceCommand, 0)
+	for _, cmd := range s.commands {
+		if filters.DeviceID != "" && cmd.DeviceID != filters.DeviceID {
+			continue
+		}
+		if filters.Status != "" && cmd.Status != filters.Status {
+			continue
+		}
+		commands = append(commands, copyCommand(cmd))
+	}
+
+	sort.Slice(commands, func(i, j int) bool {
+		if !commands[i].CreatedAt.Equal(commands[j].CreatedAt) {
+			return commands[i].CreatedAt.After(commands[j].CreatedAt)
+		}
+		return commands[i].ID > commands[j].ID
+	})
+
+	if filters.Limit > 0 && len(commands) > filters.Limit {
+		commands = commands[:filters.Limit]
+	}
+	return commands, nil
+}
+
+// FetchCommands returns the outstanding commands of a device, oldest first,
+// and marks pending ones as delivered
+func (s *CommandServiceImpl) FetchCommands(deviceID string) ([]*api.DeviceCommand, error) {
+	now := time.Now()
+	var changed []*api.DeviceCommand
+
+	s.mu.Lock()
+	commands := make([]*api.DeviceCommand, 0)
+	for _, cmd := range s.commands {
+		if cmd.DeviceID != deviceID || cmd.IsTerminal() {
+			continue
+		}
+		if !now.Before(cmd.ExpiresAt) {
+			if err := TransitionCommand(cmd, api.CommandStatusExpired, now); err == nil {
+				changed = append(changed, copyCommand(cmd))
+			}
+			continue
+		}
+		if cmd.Status == api.CommandStatusPending {
+			if err := TransitionCommand(cmd, api.CommandStatusDelivered, now); err == nil {
+				changed = append(changed, copyCommand(cmd))
+			}
+		}
+		if cmd.Status == api.CommandStatusDelivered {
+			commands = append(commands, copyCommand(cmd))
+		}
+	}
+	s.mu.Unlock()
+
+	for _, cmd := range changed {
+		s.notify(cmd)
+	}
+
+	sort.Slice(commands, func(i, j int) bool {
+		if !commands[i].CreatedAt.Equal(commands[j].CreatedAt) {
+			return commands[i].CreatedAt.Before(commands[j].CreatedAt)
+		}
+		return commands[i].ID < commands[j].ID
+	})
+	return commands, nil
+}
+
+// AcknowledgeCommand records that a device received a command and started it
+func (s *CommandServiceImpl) AcknowledgeCommand(deviceID, commandID string) (*api.DeviceCommand, error) {
+	return s.transition(deviceID, commandID, func(cmd *api.DeviceCommand, now time.Time) error {
+		return TransitionCommand(cmd, api.CommandStatusAcknowledged, now)
+	})
+}
+
+// ReportCommandResult records the outcome of a command reported by a device
+func (s *CommandServiceImpl) ReportCommandResult(deviceID, commandID string, report api.CommandResultReport) (*api.DeviceCommand, error) {
+	return s.transition(deviceID, commandID, func(cmd *api.DeviceCommand, now time.Time) error {
+		return ApplyCommandResult(cmd, report, now)
+	})
+}
+
+// ExpireCommands marks unfinished commands past their deadline as expired
+func (s *CommandServiceImpl) ExpireCommands() (int, error) {
+	now := time.Now()
+	var expired []*api.DeviceCommand
+
+	s.mu.Lock()
+	for _, cmd := range s.commands {
+		if cmd.IsTerminal() || now.Before(cmd.ExpiresAt) {
+			continue
+		}
+		if err := TransitionCommand(cmd, api.CommandStatusExpired, now); err == nil {
+			expired = append(expired, copyCommand(cmd))
+		}
+	}
+	s.mu.Unlock()
+
+	for _, cmd := range expired {
+		s.notify(cmd)
+	}
+	return len(expired), nil
+}
+
+// CountCommands counts the commands in each status
+func (s *CommandServiceImpl) CountCommands() (map[string]int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	counts := make(map[string]int)
+	for _, cmd := range s.commands {
+		counts[cmd.Status]++
+	}
+	return counts, nil
+}
+
+// transition applies fn to a command owned by deviceID and publishes the change
+func (s *CommandServiceImpl) transition(deviceID, commandID string, fn func(*api.DeviceCommand, time.Time) error) (*api.DeviceCommand, error) {
+	s.mu.Lock()
+	cmd, exists := s.commands[commandID]
+	if !exists || cmd.DeviceID != deviceID {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("command not found")
+	}
+	if err := fn(cmd, time.Now()); err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	updated := copyCommand(cmd)
+	s.mu.Unlock()
+
+	s.notify(updated)
+	return updated, nil
+}
+
+// notify publishes the current status of a command
+func (s *CommandServiceImpl) notify(cmd *api.DeviceCommand) {
+	s.wsNotifier.BroadcastCommandExecution(cmd.ID, cmd.DeviceID, cmd.Command, cmd.Status, CommandEventResult(cmd))
+}
+
+// NewDeviceCommand builds a pending command for a device
+func NewDeviceCommand(id, deviceID string, req api.CommandCreate, now time.Time) *api.DeviceCommand {
+	ttl := req.TTL
+	if ttl <= 0 {
+		ttl = api.DefaultCommandTTL
+	}
+	return &api.DeviceCommand{
+		ID:         id,
+		DeviceID:   deviceID,
+		Command:    req.Command,
+		Parameters: req.Parameters,
+		Status:     api.CommandStatusPending,
+		CreatedBy:  req.CreatedBy,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+		ExpiresAt:  now.Add(ttl),
+	}
+}
+
+// TransitionCommand moves a command to status if the transition is allowed
+func TransitionCommand(cmd *api.DeviceCommand, status string, now time.Time) error {
+	allowed := false
+	switch status {
+	case api.CommandStatusDelivered:
+		allowed = cmd.Status == api.CommandStatusPending
+	case api.CommandStatusAcknowledged:
+		allowed = cmd.Status == api.CommandStatusDelivered
+	case api.CommandStatusCompleted, api.CommandStatusFailed:
+		allowed = cmd.Status == api.CommandStatusDelivered || cmd.Status == api.CommandStatusAcknowledged
+	case api.CommandStatusExpired:
+		allowed = !cmd.IsTerminal()
+	}
+	if !allowed {
+		return fmt.Errorf("cannot move command from %s to %s", cmd.Status, status)
+	}
+
+	if status != api.CommandStatusExpired && !now.Before(cmd.ExpiresAt) {
+		return fmt.Errorf("command has expired")
+	}
+
+	cmd.Status = status
+	cmd.UpdatedAt = now
+	switch status {
+	case api.CommandStatusDelivered:
+		cmd.DeliveredAt = &now
+	case api.CommandStatusAcknowledged:
+		cmd.AcknowledgedAt = &now
+	default:
+		cmd.CompletedAt = &now
+	}
+	return nil
+}
+
+// ApplyCommandResult validates a device result report and applies it to cmd
+func ApplyCommandResult(cmd *api.DeviceCommand, report api.CommandResultReport, now time.Time) error {
+	if report.Status != api.CommandStatusCompleted && report.Status != api.CommandStatusFailed {
+		return fmt.Errorf("invalid result status %q", report.Status)
+	}
+	if err := TransitionCommand(cmd, report.Status, now); err != nil {
+		return err
+	}
+	cmd.Result = report.Result
+	cmd.Error = report.Error
+	return nil
+}
+
+// CommandEventResult summarizes the outcome of a command for WebSocket events
+func CommandEventResult(cmd *api.DeviceCommand) string {
+	if cmd.Error != "" {
+		return cmd.Error
+	}
+	if len(cmd.Result) == 0 {
+		return ""
+	}
+	b, err := json.Marshal(cmd.Result)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+// copyCommand returns a shallow copy of cmd so callers cannot mutate the store
+func copyCommand(cmd *api.DeviceCommand) *api.DeviceCommand {
+	c := *cmd
+	return &c
+}
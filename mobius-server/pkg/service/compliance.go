@@ -0,0 +1,215 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/notawar/mobius/mobius-server/api"
+)
+
+// complianceKey identifies the results of one device for one policy
+type complianceKey struct {
+	deviceID string
+	policyID string
+}
+
+// ComplianceServiceImpl implements the ComplianceService interface
+type ComplianceServiceImpl struct {
+	history    map[complianceKey][]*api.PolicyResult // oldest first
+	wsNotifier WebSocketNotifier
+	mu         sync.RWMutex
+}
+
+// NewComplianceService creates a new compliance service instance
+func NewComplianceService() *ComplianceServiceImpl {
+	return &ComplianceServiceImpl{
+		history:    make(map[complianceKey][]*api.PolicyResult),
+		wsNotifier: &NoOpWebSocketNotifier{}, // Default to no-op
+	}
+}
+
+// SetWebSocketNotifier sets the WebSocket notifier
+func (s *ComplianceServiceImpl) SetWebSocketNotifier(notifier WebSocketNotifier) {
+	s.wsNotifier = notifier
+}
+
+// RecordPolicyResults stores the results a device reported and returns the
+// latest result of each reported policy
+func (s *ComplianceServiceImpl) RecordPolicyResults(deviceID string, reports []api.PolicyResultReport) ([]*api.PolicyResult, error) {
+	if err := ValidatePolicyResultReports(reports); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	latest := make([]*api.PolicyResult, 0, len(reports))
+	for _, report := range reports {
+		key := complianceKey{deviceID: deviceID, policyID: report.PolicyID}
+		history := s.history[key]
+
+		var last *api.PolicyResult
+		if len(history) > 0 {
+			last = history[len(history)-1]
+		}
+		if last != nil && last.Status == report.Status && last.Message == report.Message {
+			last.LastReportedAt = now
+			last.Reports++
+		} else {
+			last = &api.PolicyResult{
+				DeviceID:        deviceID,
+				PolicyID:        report.PolicyID,
+				Status:          report.Status,
+				Message:         report.Message,
+				FirstReportedAt: now,
+				LastReportedAt:  now,
+				Reports:         1,
+			}
+			oldStatus := ""
+			if len(history) > 0 {
+				oldStatus = history[len(history)-1].Status
+			}
+			s.history[key] = append(history, last)
+			if oldStatus != report.Status {
+				s.wsNotifier.BroadcastPolicyCompliance(report.PolicyID, deviceID, oldStatus, report.Status)
+			}
+		}
+
+		c := *last
+		latest = append(latest, &c)
+	}
+	return latest, nil
+}
+
+// GetDeviceCompliance returns the latest result of each policy a device reported on
+func (s *ComplianceServiceImpl) GetDeviceCompliance(deviceID string) ([]*api.PolicyResult, error) {
+	return s.latestResults(api.ComplianceScope{DeviceIDs: []string{deviceID}}), nil
+}
+
+// GetPolicyResultHistory returns the results of a device for a policy, newest first
+func (s *ComplianceServiceImpl) GetPolicyResultHistory(deviceID, policyID string) ([]*api.PolicyResult, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	history := s.history[complianceKey{deviceID: deviceID, policyID: policyID}]
+	results := make([]*api.PolicyResult, 0, len(history))
+	for i := len(history) - 1; i >= 0; i-- {
+		c := *history[i]
+		results = append(results, &c)
+	}
+	return results, nil
+}
+
+// GetComplianceSummary summarizes the latest results of the devices in scope
+func (s *ComplianceServiceImpl) GetComplianceSummary(scope api.ComplianceScope) (*api.ComplianceSummary, error) {
+	return SummarizeCompliance(s.latestResults(scope)), nil
+}
+
+// latestResults returns the latest result of every device and policy in
+// scope, ordered by device and policy
+func (s *ComplianceServiceImpl) latestResults(scope api.ComplianceScope) []*api.PolicyResult {
+	var devices map[string]bool
+	if scope.DeviceIDs != nil {
+		devices = make(map[string]bool, len(scope.DeviceIDs))
+		for _, id := range scope.DeviceIDs {
+			devices[id] = true
+		}
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	results := make([]*api.PolicyResult, 0)
+	for key, history := range s.history {
+		if scope.PolicyID != "" && key.policyID != scope.PolicyID {
+			continue
+		}
+		if devices != nil && !devices[key.deviceID] {
+			continue
+		}
+		c := *history[len(history)-1]
+		results = append(results, &c)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].DeviceID == results[j].DeviceID {
+			return results[i].PolicyID < results[j].PolicyID
+		}
+		return results[i].DeviceID < results[j].DeviceID
+	})
+	return results
+}
+
+// ValidatePolicyResultReports checks that every report names a policy and
+// carries a known status
+func ValidatePolicyResultReports(reports []api.PolicyResultReport) error {
+	for _, report := range reports {
+		if report.PolicyID == "" {
+			return fmt.Errorf("policy_id is required")
+		}
+		switch report.Status {
+		case api.PolicyResultPass, api.PolicyResultFail, api.PolicyResultError:
+		default:
+			return fmt.Errorf("invalid status %q for policy %s: must be pass, fail or error", report.Status, report.PolicyID)
+		}
+	}
+	return nil
+}
+
+// SummarizeCompliance counts the latest results of devices. A device is
+// non-compliant if it fails any policy, errored if it has errors but no
+// failures, and compliant otherwise.
+func SummarizeCompliance(latest []*api.PolicyResult) *api.ComplianceSummary {
+	summary := &api.ComplianceSummary{Policies: []api.PolicyComplianceCounts{}}
+
+	deviceStatus := make(map[string]string)
+	policies := make(map[string]*api.PolicyComplianceCounts)
+	for _, result := range latest {
+		counts, exists := policies[result.PolicyID]
+		if !exists {
+			counts = &api.PolicyComplianceCounts{PolicyID: result.PolicyID}
+			policies[result.PolicyID] = counts
+		}
+
+		switch result.Status {
+		case api.PolicyResultPass:
+			counts.Pass++
+			if _, seen := deviceStatus[result.DeviceID]; !seen {
+				deviceStatus[result.DeviceID] = api.PolicyResultPass
+			}
+		case api.PolicyResultFail:
+			counts.Fail++
+			deviceStatus[result.DeviceID] = api.PolicyResultFail
+		case api.PolicyResultError:
+			counts.Error++
+			if deviceStatus[result.DeviceID] != api.PolicyResultFail {
+				deviceStatus[result.DeviceID] = api.PolicyResultError
+			}
+		}
+	}
+
+	for _, status := range deviceStatus {
+		summary.Devices++
+		switch status {
+		case api.PolicyResultPass:
+			summary.Compliant++
+		case api.PolicyResultFail:
+			summary.NonCompliant++
+		default:
+			summary.Errored++
+		}
+	}
+	if summary.Devices > 0 {
+		summary.ComplianceRate = float64(summary.Compliant) / float64(summary.Devices)
+	}
+
+	for _, counts := range policies {
+		summary.Policies = append(summary.Policies, *counts)
+	}
+	sort.Slice(summary.Policies, func(i, j int) bool {
+		return summary.Policies[i].PolicyID < summary.Policies[j].PolicyID
+	})
+	return summary
+}
@@ -0,0 +1,143 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/notawar/mobius/mobius-server/api"
+)
+
+// EnrollmentServiceImpl implements the EnrollmentService interface
+type EnrollmentServiceImpl struct {
+	secrets map[string]*api.EnrollmentSecret // secret ID -> secret without its value
+	hashes  map[string]string                // secret ID -> hash of the secret value
+	mu      sync.RWMutex
+}
+
+// NewEnrollmentService creates a new enrollment service instance
+func NewEnrollmentService() *EnrollmentServiceImpl {
+	return &EnrollmentServiceImpl{
+		secrets: make(map[string]*api.EnrollmentSecret),
+		hashes:  make(map[string]string),
+	}
+}
+
+// ListEnrollmentSecrets returns all enrollment secrets, oldest first
+func (s *EnrollmentServiceImpl) ListEnrollmentSecrets() ([]*api.EnrollmentSecret, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	secrets := make([]*api.EnrollmentSecret, 0, len(s.secrets))
+	for _, secret := range s.secrets {
+		c := *secret
+		secrets = append(secrets, &c)
+	}
+	sort.Slice(secrets, func(i, j int) bool {
+		if secrets[i].CreatedAt.Equal(secrets[j].CreatedAt) {
+			return secrets[i].ID < secrets[j].ID
+		}
+		return secrets[i].CreatedAt.Before(secrets[j].CreatedAt)
+	})
+	return secrets, nil
+}
+
+// GetEnrollmentSecret returns an enrollment secret by ID
+func (s *EnrollmentServiceImpl) GetEnrollmentSecret(id string) (*api.EnrollmentSecret, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	secret, exists := s.secrets[id]
+	if !exists {
+		return nil, fmt.Errorf("enrollment secret not found")
+	}
+	c := *secret
+	return &c, nil
+}
+
+// CreateEnrollmentSecret creates a secret and returns it with its value
+func (s *EnrollmentServiceImpl) CreateEnrollmentSecret(req api.EnrollmentSecretCreate) (*api.EnrollmentSecret, error) {
+	value, hash, err := NewEnrollmentSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	secret := &api.EnrollmentSecret{
+		ID:        generateID(),
+		Name:      req.Name,
+		GroupID:   req.GroupID,
+		CreatedBy: req.CreatedBy,
+		CreatedAt: time.Now(),
+		ExpiresAt: req.ExpiresAt,
+		Revision:  1,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.secrets[secret.ID] = secret
+	s.hashes[secret.ID] = hash
+
+	c := *secret
+	c.Secret = value
+	return &c, nil
+}
+
+// RotateEnrollmentSecret replaces the value of a secret and returns the new one
+func (s *EnrollmentServiceImpl) RotateEnrollmentSecret(id string) (*api.EnrollmentSecret, error) {
+	value, hash, err := NewEnrollmentSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	secret, exists := s.secrets[id]
+	if !exists {
+		return nil, fmt.Errorf("enrollment secret not found")
+	}
+	now := time.Now()
+	secret.RotatedAt = &now
+	secret.Revision++
+	s.hashes[id] = hash
+
+	c := *secret
+	c.Secret = value
+	return &c, nil
+}
+
+// DeleteEnrollmentSecret deletes a secret; devices can no longer enroll with it
+func (s *EnrollmentServiceImpl) DeleteEnrollmentSecret(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.secrets[id]; !exists {
+		return fmt.Errorf("enrollment secret not found")
+	}
+	delete(s.secrets, id)
+	delete(s.hashes, id)
+	return nil
+}
+
+// ValidateEnrollmentSecret returns the unexpired secret matching value
+func (s *EnrollmentServiceImpl) ValidateEnrollmentSecret(value string) (*api.EnrollmentSecret, error) {
+	hash := HashToken(value)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for id, h := range s.hashes {
+		if h != hash {
+			continue
+		}
+		secret := s.secrets[id]
+		if secret.ExpiresAt != nil && !time.Now().Before(*secret.ExpiresAt) {
+			return nil, fmt.Errorf("enrollment secret expired")
+		}
+		c := *secret
+		return &c, nil
+	}
+	return nil, fmt.Errorf("invalid enrollment secret")
+}
@@ -0,0 +1,591 @@
+package service
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/notawar/mobius/mobius-server/api"
+)
+
+// Device group filters
+//
+// A device group with filters is dynamic: each entry of DeviceGroup.Filters is
+// a named rule, and a device belongs to the group while it matches every rule.
+// Rules are boolean expressions over device fields:
+//
+//	platform == "macos" && os_version >= "14"
+//	hostname ~ "build-*" || label.role in (ci, build)
+//	system.cpu_brand exists && not status == offline
+//
+// Fields are id, uuid, hostname, platform, os_version and status, device
+// labels as label.<key> and the system info reported at check-in as
+// system.<key>. Operators are:
+//
+//	==, !=         case-insensitive equality
+//	~, !~          case-insensitive glob match (*, ? and [...])
+//	<, <=, >, >=   version-aware ordering, so "10.2" > "9.14"
+//	in, not in     equality with any value of a parenthesised list
+//	exists         the field is set
+//
+// Conditions combine with && (and), || (or), ! (not) and parentheses. Values
+// are quoted strings or bare words. A field that is not set compares as an
+// empty string, except that ordering comparisons never match it.
+//
+// A rule named after a field is shorthand for a glob match on that field, so
+// {"platform": "linux"} is the same as {"linux": "platform ~ linux"}.
+
+// DeviceFilter is a compiled device group filter rule
+type DeviceFilter struct {
+	expr string
+	root filterNode
+}
+
+// CompileDeviceFilter parses a filter rule expression
+func CompileDeviceFilter(expr string) (*DeviceFilter, error) {
+	tokens, err := lexFilter(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &filterParser{tokens: tokens}
+	if p.peek().kind == tokEOF {
+		return nil, fmt.Errorf("empty expression")
+	}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %q at position %d", tok.text, tok.pos)
+	}
+	return &DeviceFilter{expr: expr, root: root}, nil
+}
+
+// Match reports whether device matches the rule
+func (f *DeviceFilter) Match(device *api.Device) bool {
+	return f.root.eval(device, nil)
+}
+
+// Explain evaluates the rule against device and returns the outcome of every
+// condition in the expression
+func (f *DeviceFilter) Explain(device *api.Device) (bool, []api.FilterConditionResult) {
+	conditions := []api.FilterConditionResult{}
+	matched := f.root.eval(device, &conditions)
+	return matched, conditions
+}
+
+// ValidateGroupFilters returns an error naming the first rule that does not compile
+func ValidateGroupFilters(filters map[string]string) error {
+	for _, name := range sortedFilterNames(filters) {
+		if name == "" {
+			return fmt.Errorf("invalid filter: rule name is required")
+		}
+		if _, err := compileGroupRule(name, filters[name]); err != nil {
+			return fmt.Errorf("invalid filter %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// MatchGroupFilters reports whether device matches every rule of filters.
+// Groups without filters are managed by hand and match no device.
+func MatchGroupFilters(filters map[string]string, device *api.Device) bool {
+	if len(filters) == 0 {
+		return false
+	}
+	for name, expr := range filters {
+		filter, err := compileGroupRule(name, expr)
+		if err != nil || !filter.Match(device) {
+			return false
+		}
+	}
+	return true
+}
+
+// ExplainGroupMembership describes how device fares against the filters of
+// group; member tells whether the device is currently in the group
+func ExplainGroupMembership(group *api.DeviceGroup, device *api.Device, member bool) *api.GroupMembershipExplanation {
+	explanation := &api.GroupMembershipExplanation{
+		GroupID:  group.ID,
+		DeviceID: device.ID,
+		Dynamic:  len(group.Filters) > 0,
+		Member:   member,
+		Matched:  len(group.Filters) > 0,
+		Rules:    []api.FilterRuleResult{},
+	}
+
+	for _, name := range sortedFilterNames(group.Filters) {
+		rule := api.FilterRuleResult{Name: name, Expression: group.Filters[name]}
+		filter, err := compileGroupRule(name, rule.Expression)
+		if err != nil {
+			rule.Error = err.Error()
+		} else {
+			rule.Matched, rule.Conditions = filter.Explain(device)
+		}
+		if !rule.Matched {
+			explanation.Matched = false
+		}
+		explanation.Rules = append(explanation.Rules, rule)
+	}
+
+	return explanation
+}
+
+// compileGroupRule compiles a named group rule, expanding the field shorthand
+func compileGroupRule(name, expr string) (*DeviceFilter, error) {
+	field, err := parseFilterField(name)
+	if err != nil {
+		return CompileDeviceFilter(expr)
+	}
+	if _, err := path.Match(expr, ""); err != nil {
+		return nil, fmt.Errorf("invalid pattern %q", expr)
+	}
+	return &DeviceFilter{
+		expr: expr,
+		root: &filterCondition{field: field, operator: "~", values: []string{expr}},
+	}, nil
+}
+
+func sortedFilterNames(filters map[string]string) []string {
+	names := make([]string, 0, len(filters))
+	for name := range filters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Evaluation
+
+type filterNode interface {
+	// eval reports whether device matches the node, appending the outcome of
+	// each condition to trace when it is not nil
+	eval(device *api.Device, trace *[]api.FilterConditionResult) bool
+}
+
+type filterAnd struct{ left, right filterNode }
+
+// Both sides are always evaluated so that explanations cover every condition
+func (n *filterAnd) eval(device *api.Device, trace *[]api.FilterConditionResult) bool {
+	left := n.left.eval(device, trace)
+	right := n.right.eval(device, trace)
+	return left && right
+}
+
+type filterOr struct{ left, right filterNode }
+
+func (n *filterOr) eval(device *api.Device, trace *[]api.FilterConditionResult) bool {
+	left := n.left.eval(device, trace)
+	right := n.right.eval(device, trace)
+	return left || right
+}
+
+type filterNot struct{ operand filterNode }
+
+func (n *filterNot) eval(device *api.Device, trace *[]api.FilterConditionResult) bool {
+	return !n.operand.eval(device, trace)
+}
+
+type filterCondition struct {
+	field    string
+	operator string
+	values   []string
+}
+
+func (n *filterCondition) eval(device *api.Device, trace *[]api.FilterConditionResult) bool {
+	actual, present := filterFieldValue(device, n.field)
+	matched := n.match(actual, present)
+	if trace != nil {
+		*trace = append(*trace, api.FilterConditionResult{
+			Field:    n.field,
+			Operator: n.operator,
+			Values:   n.values,
+			Actual:   actual,
+			Present:  present,
+			Matched:  matched,
+		})
+	}
+	return matched
+}
+
+func (n *filterCondition) match(actual string, present bool) bool {
+	switch n.operator {
+	case "exists":
+		return present
+	case "==":
+		return strings.EqualFold(actual, n.values[0])
+	case "!=":
+		return !strings.EqualFold(actual, n.values[0])
+	case "~":
+		return globMatch(n.values[0], actual)
+	case "!~":
+		return !globMatch(n.values[0], actual)
+	case "in", "not in":
+		found := false
+		for _, value := range n.values {
+			if strings.EqualFold(actual, value) {
+				found = true
+				break
+			}
+		}
+		return found == (n.operator == "in")
+	case "<", "<=", ">", ">=":
+		if !present {
+			return false
+		}
+		cmp := compareVersions(actual, n.values[0])
+		switch n.operator {
+		case "<":
+			return cmp < 0
+		case "<=":
+			return cmp <= 0
+		case ">":
+			return cmp > 0
+		default:
+			return cmp >= 0
+		}
+	}
+	return false
+}
+
+// filterFieldValue returns the value of a filter field for device and whether it is set
+func filterFieldValue(device *api.Device, field string) (string, bool) {
+	if key, ok := strings.CutPrefix(field, "label."); ok {
+		value, exists := device.Labels[key]
+		return value, exists
+	}
+	if key, ok := strings.CutPrefix(field, "system."); ok {
+		value, exists := device.SystemInfo[key]
+		return value, exists
+	}
+
+	var value string
+	switch field {
+	case "id":
+		value = device.ID
+	case "uuid":
+		value = device.UUID
+	case "hostname":
+		value = device.Hostname
+	case "platform":
+		value = device.Platform
+	case "os_version":
+		value = device.OSVersion
+	case "status":
+		value = device.Status
+	}
+	return value, value != ""
+}
+
+func globMatch(pattern, value string) bool {
+	matched, err := path.Match(strings.ToLower(pattern), strings.ToLower(value))
+	return err == nil && matched
+}
+
+// compareVersions compares two dotted versions segment by segment, numerically
+// where both segments are numbers. Missing segments count as zero.
+func compareVersions(a, b string) int {
+	split := func(r rune) bool { return r == '.' || r == '-' || r == '_' || r == ' ' }
+	as := strings.FieldsFunc(strings.ToLower(a), split)
+	bs := strings.FieldsFunc(strings.ToLower(b), split)
+
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		x, y := "0", "0"
+		if i < len(as) {
+			x = as[i]
+		}
+		if i < len(bs) {
+			y = bs[i]
+		}
+
+		xn, xerr := strconv.ParseUint(x, 10, 64)
+		yn, yerr := strconv.ParseUint(y, 10, 64)
+		switch {
+		case xerr == nil && yerr == nil:
+			if xn != yn {
+				if xn < yn {
+					return -1
+				}
+				return 1
+			}
+		case x != y:
+			return strings.Compare(x, y)
+		}
+	}
+	return 0
+}
+
+// Parsing
+
+type filterTokenKind int
+
+const (
+	tokEOF    filterTokenKind = iota
+	tokWord                   // field names, bare values and the in/exists keywords
+	tokString                 // quoted value
+	tokOp                     // comparison operator
+	tokAnd
+	tokOr
+	tokNot
+	tokLParen
+	tokRParen
+	tokComma
+)
+
+type filterToken struct {
+	kind filterTokenKind
+	text string
+	pos  int
+}
+
+var filterOperators = []string{"==", "!=", "!~", "<=", ">=", "~", "<", ">"}
+
+func lexFilter(expr string) ([]filterToken, error) {
+	var tokens []filterToken
+
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		rest := expr[i:]
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+			continue
+		case c == '(':
+			tokens = append(tokens, filterToken{kind: tokLParen, text: "(", pos: i})
+			i++
+			continue
+		case c == ')':
+			tokens = append(tokens, filterToken{kind: tokRParen, text: ")", pos: i})
+			i++
+			continue
+		case c == ',':
+			tokens = append(tokens, filterToken{kind: tokComma, text: ",", pos: i})
+			i++
+			continue
+		case c == '"' || c == '\'':
+			end := strings.IndexByte(expr[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string at position %d", i)
+			}
+			tokens = append(tokens, filterToken{kind: tokString, text: expr[i+1 : i+1+end], pos: i})
+			i += end + 2
+			continue
+		case strings.HasPrefix(rest, "&&"):
+			tokens = append(tokens, filterToken{kind: tokAnd, text: "&&", pos: i})
+			i += 2
+			continue
+		case strings.HasPrefix(rest, "||"):
+			tokens = append(tokens, filterToken{kind: tokOr, text: "||", pos: i})
+			i += 2
+			continue
+		case isFilterWordByte(c):
+			start := i
+			for i < len(expr) && isFilterWordByte(expr[i]) {
+				i++
+			}
+			word := expr[start:i]
+			kind := tokWord
+			switch strings.ToLower(word) {
+			case "and":
+				kind = tokAnd
+			case "or":
+				kind = tokOr
+			case "not":
+				kind = tokNot
+			}
+			tokens = append(tokens, filterToken{kind: kind, text: word, pos: start})
+			continue
+		}
+
+		op := ""
+		for _, candidate := range filterOperators {
+			if strings.HasPrefix(rest, candidate) {
+				op = candidate
+				break
+			}
+		}
+		switch {
+		case op != "":
+			tokens = append(tokens, filterToken{kind: tokOp, text: op, pos: i})
+			i += len(op)
+		case c == '!':
+			tokens = append(tokens, filterToken{kind: tokNot, text: "!", pos: i})
+			i++
+		default:
+			return nil, fmt.Errorf("unexpected character %q at position %d", c, i)
+		}
+	}
+
+	return append(tokens, filterToken{kind: tokEOF, pos: len(expr)}), nil
+}
+
+func isFilterWordByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		strings.IndexByte("_.-*?/:", c) >= 0
+}
+
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+}
+
+func (p *filterParser) peek() filterToken {
+	return p.tokens[p.pos]
+}
+
+func (p *filterParser) next() filterToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// parseOr parses: and { "||" and }
+func (p *filterParser) parseOr() (filterNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokOr {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &filterOr{left: left, right: right}
+	}
+	return left, nil
+}
+
+// parseAnd parses: unary { "&&" unary }
+func (p *filterParser) parseAnd() (filterNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokAnd {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &filterAnd{left: left, right: right}
+	}
+	return left, nil
+}
+
+// parseUnary parses: "!" unary | "(" or ")" | condition
+func (p *filterParser) parseUnary() (filterNode, error) {
+	switch p.peek().kind {
+	case tokNot:
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &filterNot{operand: operand}, nil
+	case tokLParen:
+		p.next()
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if tok := p.next(); tok.kind != tokRParen {
+			return nil, fmt.Errorf("expected ) at position %d", tok.pos)
+		}
+		return node, nil
+	}
+	return p.parseCondition()
+}
+
+// parseCondition parses: field (op value | ["not"] "in" list | "exists")
+func (p *filterParser) parseCondition() (filterNode, error) {
+	tok := p.next()
+	if tok.kind != tokWord {
+		return nil, fmt.Errorf("expected field at position %d", tok.pos)
+	}
+	field, err := parseFilterField(tok.text)
+	if err != nil {
+		return nil, err
+	}
+
+	op := p.next()
+	switch {
+	case op.kind == tokOp:
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		if op.text == "~" || op.text == "!~" {
+			if _, err := path.Match(value, ""); err != nil {
+				return nil, fmt.Errorf("invalid pattern %q", value)
+			}
+		}
+		return &filterCondition{field: field, operator: op.text, values: []string{value}}, nil
+	case op.kind == tokWord && strings.EqualFold(op.text, "exists"):
+		return &filterCondition{field: field, operator: "exists"}, nil
+	case op.kind == tokWord && strings.EqualFold(op.text, "in"):
+		values, err := p.parseList()
+		if err != nil {
+			return nil, err
+		}
+		return &filterCondition{field: field, operator: "in", values: values}, nil
+	case op.kind == tokNot && p.peek().kind == tokWord && strings.EqualFold(p.peek().text, "in"):
+		p.next()
+		values, err := p.parseList()
+		if err != nil {
+			return nil, err
+		}
+		return &filterCondition{field: field, operator: "not in", values: values}, nil
+	}
+	return nil, fmt.Errorf("expected operator after %s at position %d", tok.text, op.pos)
+}
+
+// parseList parses: "(" value { "," value } ")"
+func (p *filterParser) parseList() ([]string, error) {
+	if tok := p.next(); tok.kind != tokLParen {
+		return nil, fmt.Errorf("expected ( at position %d", tok.pos)
+	}
+	var values []string
+	for {
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+
+		tok := p.next()
+		if tok.kind == tokRParen {
+			return values, nil
+		}
+		if tok.kind != tokComma {
+			return nil, fmt.Errorf("expected , or ) at position %d", tok.pos)
+		}
+	}
+}
+
+func (p *filterParser) parseValue() (string, error) {
+	tok := p.next()
+	if tok.kind != tokWord && tok.kind != tokString {
+		return "", fmt.Errorf("expected value at position %d", tok.pos)
+	}
+	return tok.text, nil
+}
+
+// parseFilterField validates a field name, normalising built-in fields to lower case
+func parseFilterField(name string) (string, error) {
+	for _, prefix := range []string{"label.", "system."} {
+		if len(name) > len(prefix) && strings.EqualFold(name[:len(prefix)], prefix) {
+			return prefix + name[len(prefix):], nil
+		}
+	}
+	switch field := strings.ToLower(name); field {
+	case "id", "uuid", "hostname", "platform", "os_version", "status":
+		return field, nil
+	}
+	return "", fmt.Errorf("unknown field %q", name)
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"sync"
+	"time"
+)
+
+// idempotencySweepInterval is how often expired idempotency keys are removed
+const idempotencySweepInterval = time.Minute
+
+// IdempotencyStore keeps the responses of idempotent requests in memory, for
+// a single server. It implements api.IdempotencyStore. Keys expire with
+// their TTL and are swept as new ones are written.
+type IdempotencyStore struct {
+	entries   map[string]idempotencyEntry
+	lastSweep time.Time
+	now       func() time.Time
+	mu        sync.Mutex
+}
+
+type idempotencyEntry struct {
+	value     []byte
+	expiresAt time.Time
+}
+
+// NewIdempotencyStore creates an empty store
+func NewIdempotencyStore() *IdempotencyStore {
+	return &IdempotencyStore{
+		entries:   make(map[string]idempotencyEntry),
+		lastSweep: time.Now(),
+		now:       time.Now,
+	}
+}
+
+// Claim sets key to value unless it exists, and returns the value it holds
+// otherwise
+func (s *IdempotencyStore) Claim(key string, value []byte, ttl time.Duration) (bool, []byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if entry, ok := s.entries[key]; ok && now.Before(entry.expiresAt) {
+		return false, entry.value, nil
+	}
+	s.set(key, value, ttl, now)
+	return true, nil, nil
+}
+
+// Save sets key to value
+func (s *IdempotencyStore) Save(key string, value []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.set(key, value, ttl, s.now())
+	return nil
+}
+
+// Release deletes key
+func (s *IdempotencyStore) Release(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, key)
+	return nil
+}
+
+// Len returns the number of keys held, including expired keys not yet swept
+func (s *IdempotencyStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.entries)
+}
+
+func (s *IdempotencyStore) set(key string, value []byte, ttl time.Duration, now time.Time) {
+	s.entries[key] = idempotencyEntry{value: value, expiresAt: now.Add(ttl)}
+
+	if now.Sub(s.lastSweep) < idempotencySweepInterval {
+		return
+	}
+	for k, entry := range s.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(s.entries, k)
+		}
+	}
+	s.lastSweep = now
+}
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/notawar/mobius/mobius-server/api"
+)
+
+// packageManagerPlatforms lists the platforms each package manager of the
+// package search catalog installs on
+var packageManagerPlatforms = map[string][]string{
+	"apt":     {"linux"},
+	"flatpak": {"linux"},
+	"brew":    {"linux", "macos"},
+	"winget":  {"windows"},
+}
+
+// packageIdentifierPattern matches the identifiers of every package manager:
+// apt packages, flatpak application IDs and remotes, Homebrew formulae,
+// casks and taps, and winget package identifiers. Anything else could
+// smuggle options or shell syntax into the generated commands.
+var packageIdentifierPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._+@/-]*$`)
+
+// PrepareImport builds the application of a package of the package search
+// catalog, with the commands installing and uninstalling it and an osquery
+// query detecting it. The application has no ID or creation time yet.
+func PrepareImport(imp api.ApplicationImport) (*api.Application, error) {
+	pkg := imp.Package
+	if pkg == nil {
+		return nil, fmt.Errorf("%w: package is required", api.ErrInvalidApplication)
+	}
+	install := pkg.Install
+	managerPlatforms, ok := packageManagerPlatforms[install.Manager]
+	if !ok {
+		return nil, fmt.Errorf("%w: unsupported package manager %q", api.ErrInvalidApplication, install.Manager)
+	}
+	if !packageIdentifierPattern.MatchString(install.Identifier) {
+		return nil, fmt.Errorf("%w: invalid package identifier %q", api.ErrInvalidApplication, install.Identifier)
+	}
+	if install.Remote != "" && !packageIdentifierPattern.MatchString(install.Remote) {
+		return nil, fmt.Errorf("%w: invalid flatpak remote %q", api.ErrInvalidApplication, install.Remote)
+	}
+
+	platform := imp.Platform
+	if platform == "" {
+		if len(pkg.Platforms) != 1 {
+			return nil, fmt.Errorf("%w: platform is required for packages of several platforms", api.ErrInvalidApplication)
+		}
+		platform = pkg.Platforms[0]
+	}
+	if !slices.Contains(pkg.Platforms, platform) || !slices.Contains(managerPlatforms, platform) {
+		return nil, fmt.Errorf("%w: %s does not install on %q", api.ErrInvalidApplication, pkg.ID, platform)
+	}
+
+	name := imp.Name
+	if name == "" {
+		name = pkg.Name
+	}
+	switch {
+	case name == "":
+		return nil, fmt.Errorf("%w: name is required", api.ErrInvalidApplication)
+	case pkg.Version == "":
+		return nil, fmt.Errorf("%w: %s has no version", api.ErrInvalidApplication, pkg.ID)
+	}
+
+	installCommand, uninstallCommand := packageCommands(install)
+	return &api.Application{
+		Name:        name,
+		Version:     pkg.Version,
+		Platform:    platform,
+		BundleID:    install.Identifier,
+		PackageType: install.Manager,
+		Source: &api.ApplicationSource{
+			PackageID:  pkg.ID,
+			Manager:    install.Manager,
+			Identifier: install.Identifier,
+			Remote:     install.Remote,
+			Cask:       install.Cask,
+		},
+		InstallCommand:   installCommand,
+		UninstallCommand: uninstallCommand,
+		DetectionQuery:   detectionQuery(install, name),
+		LatestVersion:    pkg.Version,
+	}, nil
+}
+
+// packageCommands returns the non-interactive commands installing and
+// uninstalling a package. Installing again upgrades the package where the
+// package manager allows it.
+func packageCommands(install api.UpstreamInstall) (string, string) {
+	id := install.Identifier
+	switch install.Manager {
+	case "apt":
+		return "apt-get install -y " + id, "apt-get remove -y " + id
+	case "flatpak":
+		remote := install.Remote
+		if remote == "" {
+			remote = "flathub"
+		}
+		return "flatpak install -y --noninteractive --or-update " + remote + " " + id,
+			"flatpak uninstall -y --noninteractive " + id
+	case "brew":
+		if install.Cask {
+			return "brew install --cask " + id, "brew uninstall --cask " + id
+		}
+		return "brew install " + id, "brew uninstall " + id
+	case "winget":
+		return "winget install --id " + id + " --exact --silent --accept-package-agreements --accept-source-agreements",
+			"winget uninstall --id " + id + " --exact --silent"
+	}
+	return "", ""
+}
+
+// detectionQuery returns an osquery query returning a row when a package is
+// installed, like the automatic policy queries of maintained apps
+func detectionQuery(install api.UpstreamInstall, name string) string {
+	id := sqlString(install.Identifier)
+	switch install.Manager {
+	case "apt":
+		return "SELECT 1 FROM deb_packages WHERE name = " + id + ";"
+	case "flatpak":
+		// osquery has no flatpak table; system-wide applications are
+		// deployed under /var/lib/flatpak/app
+		return "SELECT 1 FROM file WHERE path = " + sqlString("/var/lib/flatpak/app/"+install.Identifier) + ";"
+	case "brew":
+		if install.Cask {
+			return "SELECT 1 FROM homebrew_packages WHERE type = 'cask' AND name = " + id + ";"
+		}
+		return "SELECT 1 FROM homebrew_packages WHERE name = " + id + ";"
+	case "winget":
+		// Installers register the application under its display name,
+		// often followed by its version or architecture
+		escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(name)
+		return "SELECT 1 FROM programs WHERE name LIKE " + sqlString(escaped+"%") + ` ESCAPE '\';`
+	}
+	return ""
+}
+
+// sqlString quotes s as an SQL string literal
+func sqlString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// UpdateAvailable reports whether the latest upstream version of an
+// application is newer than its version
+func UpdateAvailable(app *api.Application) bool {
+	return app.LatestVersion != "" && compareVersions(app.LatestVersion, app.Version) > 0
+}
@@ -0,0 +1,338 @@
+package service
+
+import (
+	"crypto/ecdsa"
+	_ "embed"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/notawar/mobius/mobius-server/api"
+)
+
+// License tiers
+const (
+	TierCommunity    = "community"
+	TierProfessional = "professional"
+	TierEnterprise   = "enterprise"
+)
+
+// License timing defaults
+const (
+	// DefaultLicenseGracePeriod is how long an expired license keeps working
+	DefaultLicenseGracePeriod = 30 * 24 * time.Hour
+	// LicenseExpiryWarning is how long before expiry the status starts warning
+	LicenseExpiryWarning = 30 * 24 * time.Hour
+)
+
+// LicenseIssuer is the issuer every license key must carry
+const LicenseIssuer = "Mobius"
+
+// licensePublicKeyPEM verifies license keys. It is the public key of the
+// license issuer, created with cmd/license keygen; the matching private key
+// is kept by the issuer only, and signs licenses with cmd/license sign.
+//
+//go:embed license_public_key.pem
+var licensePublicKeyPEM []byte
+
+// TierFeatures lists the features of each tier, used when a license key does
+// not list its features
+var TierFeatures = map[string][]string{
+	TierCommunity: {
+		"device_management",
+		"basic_policies",
+	},
+	TierProfessional: {
+		"device_management",
+		"advanced_policies",
+		"application_management",
+		"reporting",
+	},
+	TierEnterprise: {
+		"device_management",
+		"advanced_policies",
+		"application_management",
+		"reporting",
+		"integrations",
+		"custom_scripts",
+		"priority_support",
+	},
+}
+
+// communityDeviceLimit applies without a license key and once a license is
+// past its grace period
+const communityDeviceLimit = 10
+
+// LicenseClaims are the claims carried by a signed license key
+type LicenseClaims struct {
+	Tier         string   `json:"tier"`
+	Organization string   `json:"organization,omitempty"`
+	DeviceLimit  int      `json:"device_limit"` // -1 is unlimited
+	Features     []string `json:"features,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// SignLicense returns a license key for claims signed with key. It is used by
+// the license issuer and by tests; servers only verify keys.
+func SignLicense(key *ecdsa.PrivateKey, claims LicenseClaims) (string, error) {
+	if claims.Issuer == "" {
+		claims.Issuer = LicenseIssuer
+	}
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodES256, claims).SignedString(key)
+	if err != nil {
+		return "", fmt.Errorf("sign license: %w", err)
+	}
+	return signed, nil
+}
+
+// LicenseStore keeps the license key applied through the API across restarts
+type LicenseStore interface {
+	// GetLicenseKey returns the stored license key, or "" when none was stored
+	GetLicenseKey() (string, error)
+	SetLicenseKey(key string) error
+}
+
+// LicenseServiceImpl implements the LicenseService interface. License keys
+// are verified offline against a public key.
+type LicenseServiceImpl struct {
+	publicKey *ecdsa.PublicKey
+	// GracePeriod is how long an expired license keeps working
+	GracePeriod time.Duration
+
+	store    LicenseStore // Keeps updated license keys when set
+	license  api.License  // as issued, without status
+	enrolled int
+	mu       sync.RWMutex
+}
+
+// NewLicenseService creates a license service verifying keys against the
+// embedded public key, starting with the community license
+func NewLicenseService() *LicenseServiceImpl {
+	key, err := jwt.ParseECPublicKeyFromPEM(licensePublicKeyPEM)
+	if err != nil {
+		panic(fmt.Sprintf("parse embedded license public key: %v", err))
+	}
+	return NewLicenseServiceWithKey(key)
+}
+
+// NewLicenseServiceWithKey creates a license service verifying keys against key
+func NewLicenseServiceWithKey(key *ecdsa.PublicKey) *LicenseServiceImpl {
+	return &LicenseServiceImpl{
+		publicKey:   key,
+		GracePeriod: DefaultLicenseGracePeriod,
+		license:     communityLicense(),
+	}
+}
+
+func communityLicense() api.License {
+	return api.License{
+		Valid:       true,
+		Tier:        TierCommunity,
+		DeviceLimit: communityDeviceLimit,
+		ExpiresAt:   nil, // Community license never expires
+		Features:    append([]string(nil), TierFeatures[TierCommunity]...),
+	}
+}
+
+// GetLicense returns the current license and its status
+func (s *LicenseServiceImpl) GetLicense() (*api.License, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.effective(time.Now()), nil
+}
+
+// SetLicenseStore keeps the license keys applied with UpdateLicense in store
+func (s *LicenseServiceImpl) SetLicenseStore(store LicenseStore) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.store = store
+}
+
+// LoadLicense makes the stored license key the current license at startup,
+// or fallback, typically configured with MOBIUS_LICENSE_KEY, when no key was
+// stored. The community license applies without either.
+func (s *LicenseServiceImpl) LoadLicense(fallback string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := fallback
+	if s.store != nil {
+		stored, err := s.store.GetLicenseKey()
+		if err != nil {
+			return err
+		}
+		if stored != "" {
+			key = stored
+		}
+	}
+	if key == "" {
+		return nil
+	}
+
+	license, err := s.verify(key)
+	if err != nil {
+		return err
+	}
+	s.license = *license
+	return nil
+}
+
+// UpdateLicense verifies a license key and makes it the current license,
+// storing it when a license store is set
+func (s *LicenseServiceImpl) UpdateLicense(key string) error {
+	license, err := s.verify(key)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.store != nil {
+		if err := s.store.SetLicenseKey(key); err != nil {
+			return fmt.Errorf("store license key: %w", err)
+		}
+	}
+	s.license = *license
+	return nil
+}
+
+// verify parses a license key, rejecting licenses past their grace period
+func (s *LicenseServiceImpl) verify(key string) (*api.License, error) {
+	if key == "" {
+		return nil, fmt.Errorf("license key cannot be empty")
+	}
+
+	license, err := s.parse(key)
+	if err != nil {
+		return nil, err
+	}
+	if license.ExpiresAt != nil && time.Now().After(license.ExpiresAt.Add(s.GracePeriod)) {
+		return nil, fmt.Errorf("license expired on %s", license.ExpiresAt.Format("2006-01-02"))
+	}
+	return license, nil
+}
+
+// parse verifies the signature and claims of a license key
+func (s *LicenseServiceImpl) parse(key string) (*api.License, error) {
+	var claims LicenseClaims
+	// Expiry is checked by the caller so that the grace period applies
+	parser := jwt.NewParser(jwt.WithValidMethods([]string{jwt.SigningMethodES256.Alg()}), jwt.WithoutClaimsValidation())
+	if _, err := parser.ParseWithClaims(key, &claims, func(*jwt.Token) (interface{}, error) {
+		return s.publicKey, nil
+	}); err != nil {
+		return nil, fmt.Errorf("invalid license key: %w", err)
+	}
+
+	if claims.Issuer != LicenseIssuer {
+		return nil, fmt.Errorf("invalid license key: unexpected issuer %q", claims.Issuer)
+	}
+	features, ok := TierFeatures[claims.Tier]
+	if !ok {
+		return nil, fmt.Errorf("invalid license key: unknown tier %q", claims.Tier)
+	}
+	if claims.DeviceLimit == 0 || claims.DeviceLimit < -1 {
+		return nil, fmt.Errorf("invalid license key: invalid device limit %d", claims.DeviceLimit)
+	}
+	if len(claims.Features) > 0 {
+		features = claims.Features
+	}
+
+	license := &api.License{
+		Valid:        true,
+		Tier:         claims.Tier,
+		Organization: claims.Organization,
+		DeviceLimit:  claims.DeviceLimit,
+		Features:     append([]string(nil), features...),
+	}
+	if claims.ExpiresAt != nil {
+		expiresAt := claims.ExpiresAt.Time
+		license.ExpiresAt = &expiresAt
+	}
+	return license, nil
+}
+
+// effective returns the current license with its status at now. Past the
+// grace period the community limits and features apply.
+func (s *LicenseServiceImpl) effective(now time.Time) *api.License {
+	license := s.license
+	license.Features = append([]string(nil), s.license.Features...)
+	license.DevicesEnrolled = s.enrolled
+
+	if license.ExpiresAt != nil {
+		expiresAt := *license.ExpiresAt
+		graceEndsAt := expiresAt.Add(s.GracePeriod)
+
+		switch {
+		case now.After(graceEndsAt):
+			community := communityLicense()
+			license.Valid = false
+			license.DeviceLimit = community.DeviceLimit
+			license.Features = community.Features
+			license.GracePeriodEndsAt = &graceEndsAt
+			license.Warnings = append(license.Warnings, fmt.Sprintf(
+				"License expired on %s; community limits apply", expiresAt.Format("2006-01-02")))
+		case now.After(expiresAt):
+			license.InGracePeriod = true
+			license.GracePeriodEndsAt = &graceEndsAt
+			license.Warnings = append(license.Warnings, fmt.Sprintf(
+				"License expired on %s; the grace period ends on %s", expiresAt.Format("2006-01-02"), graceEndsAt.Format("2006-01-02")))
+		case expiresAt.Sub(now) <= LicenseExpiryWarning:
+			license.Warnings = append(license.Warnings, fmt.Sprintf(
+				"License expires in %d days", int(expiresAt.Sub(now).Hours()/24)))
+		}
+	}
+
+	if license.DeviceLimit > 0 && license.DevicesEnrolled > license.DeviceLimit {
+		license.Warnings = append(license.Warnings, fmt.Sprintf(
+			"%d devices are enrolled but the license allows %d", license.DevicesEnrolled, license.DeviceLimit))
+	}
+	return &license
+}
+
+// ValidateLicense checks if the current license is valid
+func (s *LicenseServiceImpl) ValidateLicense() error {
+	license, _ := s.GetLicense()
+	if !license.Valid {
+		return fmt.Errorf("license has expired")
+	}
+
+	if license.DeviceLimit > 0 && license.DevicesEnrolled >= license.DeviceLimit {
+		return fmt.Errorf("device limit exceeded")
+	}
+
+	return nil
+}
+
+// CheckEnrollment returns api.ErrLicenseDeviceLimit if another device would
+// exceed the device limit
+func (s *LicenseServiceImpl) CheckEnrollment(enrolled int) error {
+	license, _ := s.GetLicense()
+	if license.DeviceLimit > 0 && enrolled >= license.DeviceLimit {
+		return api.ErrLicenseDeviceLimit
+	}
+	return nil
+}
+
+// SetDevicesEnrolled records the number of managed devices
+func (s *LicenseServiceImpl) SetDevicesEnrolled(enrolled int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.enrolled = enrolled
+}
+
+// HasFeature reports whether the current license includes feature
+func (s *LicenseServiceImpl) HasFeature(feature string) bool {
+	license, _ := s.GetLicense()
+	for _, f := range license.Features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
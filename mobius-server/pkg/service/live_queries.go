@@ -0,0 +1,240 @@
+package service
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/notawar/mobius/mobius-server/api"
+)
+
+// LiveQueryServiceImpl implements the LiveQueryService interface
+type LiveQueryServiceImpl struct {
+	campaigns  map[string]*api.LiveQueryCampaign
+	wsNotifier WebSocketNotifier
+	mu         sync.RWMutex
+}
+
+// NewLiveQueryService creates a new live query service instance
+func NewLiveQueryService() *LiveQueryServiceImpl {
+	return &LiveQueryServiceImpl{
+		campaigns:  make(map[string]*api.LiveQueryCampaign),
+		wsNotifier: &NoOpWebSocketNotifier{}, // Default to no-op
+	}
+}
+
+// SetWebSocketNotifier sets the WebSocket notifier
+func (s *LiveQueryServiceImpl) SetWebSocketNotifier(notifier WebSocketNotifier) {
+	s.wsNotifier = notifier
+}
+
+// StartCampaign distributes a query to the requested devices
+func (s *LiveQueryServiceImpl) StartCampaign(req api.LiveQueryCreate) (*api.LiveQueryCampaign, error) {
+	campaign, err := NewLiveQueryCampaign(generateID(), req, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.campaigns[campaign.ID] = campaign
+	return copyCampaign(campaign), nil
+}
+
+// GetCampaign returns a campaign and the results received so far
+func (s *LiveQueryServiceImpl) GetCampaign(id string) (*api.LiveQueryCampaign, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	campaign, exists := s.campaigns[id]
+	if !exists {
+		return nil, fmt.Errorf("campaign not found")
+	}
+	return copyCampaign(campaign), nil
+}
+
+// PendingQueries returns the queries a device has yet to answer
+func (s *LiveQueryServiceImpl) PendingQueries(deviceID string) ([]*api.DeviceLiveQuery, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+	queries := make([]*api.DeviceLiveQuery, 0)
+	for _, campaign := range s.campaigns {
+		if campaign.Status != api.LiveQueryStatusRunning || !now.Before(campaign.ExpiresAt) {
+			continue
+		}
+		for _, result := range campaign.Results {
+			if result.DeviceID == deviceID && result.Status == api.LiveQueryStatusPending {
+				queries = append(queries, &api.DeviceLiveQuery{CampaignID: campaign.ID, Query: campaign.Query})
+			}
+		}
+	}
+	return queries, nil
+}
+
+// SubmitResult records the result of a device and completes the campaign
+// once every device has answered
+func (s *LiveQueryServiceImpl) SubmitResult(campaignID, deviceID string, report api.LiveQueryReport) (*api.LiveQueryResult, error) {
+	s.mu.Lock()
+	campaign, exists := s.campaigns[campaignID]
+	if !exists {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("campaign not found")
+	}
+
+	result, err := ApplyLiveQueryReport(campaign, deviceID, report, time.Now())
+	if err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	updated := copyCampaign(campaign)
+	s.mu.Unlock()
+
+	resultCopy := *result
+	s.notifyResult(updated, &resultCopy)
+	if updated.Status != api.LiveQueryStatusRunning {
+		s.notifyCompleted(updated)
+	}
+	return &resultCopy, nil
+}
+
+// ExpireCampaigns times out running campaigns past their deadline
+func (s *LiveQueryServiceImpl) ExpireCampaigns() (int, error) {
+	now := time.Now()
+	var expired []*api.LiveQueryCampaign
+
+	s.mu.Lock()
+	for _, campaign := range s.campaigns {
+		if campaign.Status != api.LiveQueryStatusRunning || now.Before(campaign.ExpiresAt) {
+			continue
+		}
+		TimeOutLiveQueryCampaign(campaign, now)
+		expired = append(expired, copyCampaign(campaign))
+	}
+	s.mu.Unlock()
+
+	for _, campaign := range expired {
+		for _, result := range campaign.Results {
+			if result.Status == api.LiveQueryStatusTimedOut {
+				s.notifyResult(campaign, result)
+			}
+		}
+		s.notifyCompleted(campaign)
+	}
+	return len(expired), nil
+}
+
+func (s *LiveQueryServiceImpl) notifyResult(campaign *api.LiveQueryCampaign, result *api.LiveQueryResult) {
+	s.wsNotifier.BroadcastLiveQueryResult(campaign.CreatedBy, campaign.ID, result.DeviceID, result.Status, result.Rows, result.Error)
+}
+
+func (s *LiveQueryServiceImpl) notifyCompleted(campaign *api.LiveQueryCampaign) {
+	s.wsNotifier.BroadcastLiveQueryCompleted(campaign.CreatedBy, campaign.ID, campaign.Status, campaign.DevicesResponded, campaign.DevicesTotal)
+}
+
+// NewLiveQueryCampaign builds a running campaign with a pending result for
+// each distinct device
+func NewLiveQueryCampaign(id string, req api.LiveQueryCreate, now time.Time) (*api.LiveQueryCampaign, error) {
+	if req.Query == "" {
+		return nil, fmt.Errorf("query is required")
+	}
+	if len(req.DeviceIDs) == 0 {
+		return nil, fmt.Errorf("no devices targeted")
+	}
+
+	timeout := req.Timeout
+	if timeout <= 0 {
+		timeout = api.DefaultLiveQueryTimeout
+	}
+	if timeout > api.MaxLiveQueryTimeout {
+		timeout = api.MaxLiveQueryTimeout
+	}
+
+	campaign := &api.LiveQueryCampaign{
+		ID:        id,
+		Query:     req.Query,
+		Status:    api.LiveQueryStatusRunning,
+		CreatedBy: req.CreatedBy,
+		CreatedAt: now,
+		ExpiresAt: now.Add(timeout),
+		Results:   make([]*api.LiveQueryResult, 0, len(req.DeviceIDs)),
+	}
+	seen := make(map[string]bool)
+	for _, deviceID := range req.DeviceIDs {
+		if seen[deviceID] {
+			continue
+		}
+		seen[deviceID] = true
+		campaign.Results = append(campaign.Results, &api.LiveQueryResult{
+			DeviceID: deviceID,
+			Status:   api.LiveQueryStatusPending,
+		})
+	}
+	campaign.DevicesTotal = len(campaign.Results)
+	return campaign, nil
+}
+
+// ApplyLiveQueryReport records the report of a device on a running campaign
+// and completes the campaign once no device is pending
+func ApplyLiveQueryReport(campaign *api.LiveQueryCampaign, deviceID string, report api.LiveQueryReport, now time.Time) (*api.LiveQueryResult, error) {
+	if campaign.Status != api.LiveQueryStatusRunning || !now.Before(campaign.ExpiresAt) {
+		return nil, fmt.Errorf("campaign is no longer running")
+	}
+
+	var result *api.LiveQueryResult
+	for _, r := range campaign.Results {
+		if r.DeviceID == deviceID {
+			result = r
+			break
+		}
+	}
+	if result == nil {
+		return nil, fmt.Errorf("device is not targeted by this campaign")
+	}
+	if result.Status != api.LiveQueryStatusPending {
+		return nil, fmt.Errorf("device already reported a result")
+	}
+
+	result.Status = api.LiveQueryStatusCompleted
+	if report.Error != "" {
+		result.Status = api.LiveQueryStatusFailed
+	}
+	result.Rows = report.Rows
+	result.Error = report.Error
+	result.DurationMS = report.DurationMS
+	result.RespondedAt = &now
+	campaign.DevicesResponded++
+
+	if campaign.DevicesResponded == campaign.DevicesTotal {
+		campaign.Status = api.LiveQueryStatusCompleted
+		campaign.CompletedAt = &now
+	}
+	return result, nil
+}
+
+// TimeOutLiveQueryCampaign ends a running campaign, marking devices that
+// have not answered as timed out
+func TimeOutLiveQueryCampaign(campaign *api.LiveQueryCampaign, now time.Time) {
+	campaign.Status = api.LiveQueryStatusCompleted
+	for _, result := range campaign.Results {
+		if result.Status == api.LiveQueryStatusPending {
+			result.Status = api.LiveQueryStatusTimedOut
+			campaign.Status = api.LiveQueryStatusTimedOut
+		}
+	}
+	campaign.CompletedAt = &now
+}
+
+// copyCampaign returns a copy of campaign and its results so callers cannot
+// mutate the store
+func copyCampaign(campaign *api.LiveQueryCampaign) *api.LiveQueryCampaign {
+	c := *campaign
+	c.Results = make([]*api.LiveQueryResult, len(campaign.Results))
+	for i, result := range campaign.Results {
+		r := *result
+		c.Results[i] = &r
+	}
+	return &c
+}
@@ -0,0 +1,64 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/notawar/mobius/mobius-server/api"
+)
+
+// PackageSearchClient implements the PackageSearchService interface with
+// the HTTP API of mobius-package-search
+type PackageSearchClient struct {
+	baseURL string
+	client  *http.Client
+}
+
+// NewPackageSearchClient creates a client of the package search service
+// at baseURL
+func NewPackageSearchClient(baseURL string, client *http.Client) *PackageSearchClient {
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	return &PackageSearchClient{baseURL: strings.TrimRight(baseURL, "/"), client: client}
+}
+
+// GetPackage returns a package by ID
+func (c *PackageSearchClient) GetPackage(ctx context.Context, id string) (*api.UpstreamPackage, error) {
+	// IDs hold slashes, such as homebrew:cask/firefox, which the route
+	// matches as they are
+	segments := strings.Split(id, "/")
+	for i, segment := range segments {
+		if segment == "" || segment == "." || segment == ".." {
+			return nil, api.ErrPackageNotFound
+		}
+		segments[i] = url.PathEscape(segment)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/packages/"+strings.Join(segments, "/"), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("get package: %w", err)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, api.ErrPackageNotFound
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("get package: %s", resp.Status)
+	}
+
+	var pkg api.UpstreamPackage
+	if err := json.NewDecoder(resp.Body).Decode(&pkg); err != nil {
+		return nil, fmt.Errorf("get package: %w", err)
+	}
+	return &pkg, nil
+}
@@ -0,0 +1,152 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"time"
+
+	"github.com/notawar/mobius/mobius-server/api"
+	"github.com/notawar/mobius/mobius-server/pkg/file"
+	"github.com/notawar/mobius/mobius-server/server/mobius"
+)
+
+// packagePlatforms maps package types to the platform they install on
+var packagePlatforms = map[string]string{
+	"deb":    "linux",
+	"rpm":    "linux",
+	"tar.gz": "linux",
+	"msi":    "windows",
+	"exe":    "windows",
+	"pkg":    "macos",
+}
+
+// ValidApplicationPlatforms lists the platforms an application can target
+var ValidApplicationPlatforms = map[string]bool{
+	"windows": true, "macos": true, "linux": true, "ios": true, "android": true,
+}
+
+// PreparedPackage is an uploaded package spooled to disk, with the
+// application it describes
+type PreparedPackage struct {
+	// Application has no ID or creation time yet
+	Application *api.Application
+	File        *mobius.TempFileReader
+}
+
+// Close removes the spooled package
+func (p *PreparedPackage) Close() error {
+	return p.File.Close()
+}
+
+// PreparePackage spools the package of app to disk, computes its size and
+// checksum and completes the application from the package metadata. Package
+// formats without a metadata parser are accepted as they are. The caller
+// closes the returned package.
+func PreparePackage(app api.ApplicationCreate) (*PreparedPackage, error) {
+	if app.Package == nil {
+		return nil, fmt.Errorf("%w: package is required", api.ErrInvalidApplication)
+	}
+
+	hash := sha256.New()
+	tfr, err := mobius.NewTempFileReader(io.TeeReader(app.Package, hash), nil)
+	if err != nil {
+		return nil, fmt.Errorf("read package: %w", err)
+	}
+	prepared := &PreparedPackage{File: tfr}
+
+	info, err := tfr.Stat()
+	if err != nil {
+		prepared.Close() //nolint:errcheck
+		return nil, fmt.Errorf("read package: %w", err)
+	}
+	application := &api.Application{
+		Name:     app.Name,
+		Version:  app.Version,
+		Platform: app.Platform,
+		Size:     info.Size(),
+		Checksum: hex.EncodeToString(hash.Sum(nil)),
+	}
+	if app.Filename != "" {
+		application.Filename = filepath.Base(app.Filename)
+	}
+
+	switch meta, err := file.ExtractInstallerMetadata(tfr); {
+	case errors.Is(err, file.ErrUnsupportedType):
+	case err != nil:
+		prepared.Close() //nolint:errcheck
+		return nil, fmt.Errorf("%w: %v", api.ErrInvalidApplication, err)
+	default:
+		application.PackageType = meta.Extension
+		application.BundleID = meta.BundleIdentifier
+		if application.Name == "" {
+			application.Name = meta.Name
+		}
+		if application.Version == "" {
+			application.Version = meta.Version
+		}
+		if application.Platform == "" {
+			application.Platform = packagePlatforms[meta.Extension]
+		}
+	}
+	if err := tfr.Rewind(); err != nil {
+		prepared.Close() //nolint:errcheck
+		return nil, fmt.Errorf("read package: %w", err)
+	}
+
+	switch {
+	case application.Name == "":
+		err = fmt.Errorf("%w: name is required and could not be read from the package", api.ErrInvalidApplication)
+	case application.Version == "":
+		err = fmt.Errorf("%w: version is required and could not be read from the package", api.ErrInvalidApplication)
+	case !ValidApplicationPlatforms[application.Platform]:
+		err = fmt.Errorf("%w: invalid platform %q", api.ErrInvalidApplication, application.Platform)
+	}
+	if err != nil {
+		prepared.Close() //nolint:errcheck
+		return nil, err
+	}
+
+	prepared.Application = application
+	return prepared, nil
+}
+
+// URLSigner signs download URLs with HMAC-SHA256
+type URLSigner struct {
+	key []byte
+}
+
+// NewURLSigner creates a signer using key. A random key is generated when key
+// is empty, which invalidates signed URLs on restart.
+func NewURLSigner(key []byte) (*URLSigner, error) {
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, fmt.Errorf("generate signing key: %w", err)
+		}
+	}
+	return &URLSigner{key: key}, nil
+}
+
+// Sign returns the signature of path until expiresAt
+func (s *URLSigner) Sign(path string, expiresAt time.Time) string {
+	mac := hmac.New(sha256.New, s.key)
+	fmt.Fprintf(mac, "%s\n%d", path, expiresAt.Unix())
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature of path and that it has not expired
+func (s *URLSigner) Verify(path string, expiresAt time.Time, signature string) error {
+	if !hmac.Equal([]byte(s.Sign(path, expiresAt)), []byte(signature)) {
+		return errors.New("invalid signature")
+	}
+	if time.Now().After(expiresAt) {
+		return errors.New("signature has expired")
+	}
+	return nil
+}
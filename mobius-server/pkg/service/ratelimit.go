@@ -0,0 +1,107 @@
+package service
+
+import (
+	"sync"
+	"time"
+)
+
+// rateLimitSweepInterval is how often expired rate limit keys are removed
+const rateLimitSweepInterval = time.Minute
+
+// RateLimitStore keeps the state of GCRA rate limits in memory, for a single
+// server. It implements throttled.GCRAStore. Keys expire with their TTL and
+// are swept as new ones are written, so clients that went away do not
+// accumulate.
+type RateLimitStore struct {
+	entries   map[string]rateLimitEntry
+	lastSweep time.Time
+	now       func() time.Time
+	mu        sync.Mutex
+}
+
+type rateLimitEntry struct {
+	value     int64
+	expiresAt time.Time
+}
+
+// NewRateLimitStore creates an empty store
+func NewRateLimitStore() *RateLimitStore {
+	return &RateLimitStore{
+		entries:   make(map[string]rateLimitEntry),
+		lastSweep: time.Now(),
+		now:       time.Now,
+	}
+}
+
+// GetWithTime returns the value of key, or -1 if it does not exist, and the
+// current time
+func (s *RateLimitStore) GetWithTime(key string) (int64, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	entry, ok := s.get(key, now)
+	if !ok {
+		return -1, now, nil
+	}
+	return entry.value, now, nil
+}
+
+// SetIfNotExistsWithTTL sets key to value unless it exists and reports
+// whether it did
+func (s *RateLimitStore) SetIfNotExistsWithTTL(key string, value int64, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if _, ok := s.get(key, now); ok {
+		return false, nil
+	}
+	s.set(key, value, ttl, now)
+	return true, nil
+}
+
+// CompareAndSwapWithTTL sets key to new if it holds old and reports whether
+// it did. A missing key is not swapped.
+func (s *RateLimitStore) CompareAndSwapWithTTL(key string, old, new int64, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	entry, ok := s.get(key, now)
+	if !ok || entry.value != old {
+		return false, nil
+	}
+	s.set(key, new, ttl, now)
+	return true, nil
+}
+
+// Len returns the number of keys held, including expired keys not yet swept
+func (s *RateLimitStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.entries)
+}
+
+func (s *RateLimitStore) get(key string, now time.Time) (rateLimitEntry, bool) {
+	entry, ok := s.entries[key]
+	if !ok || !now.Before(entry.expiresAt) {
+		return rateLimitEntry{}, false
+	}
+	return entry, true
+}
+
+func (s *RateLimitStore) set(key string, value int64, ttl time.Duration, now time.Time) {
+	s.entries[key] = rateLimitEntry{value: value, expiresAt: now.Add(ttl)}
+
+	if now.Sub(s.lastSweep) < rateLimitSweepInterval {
+		return
+	}
+	for k, entry := range s.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(s.entries, k)
+		}
+	}
+	s.lastSweep = now
+}
@@ -1,13 +1,16 @@
 package service
 
 import (
-	"crypto/sha256"
+	"context"
 	"fmt"
+	"io"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/notawar/mobius/mobius-server/api"
+	"github.com/notawar/mobius/mobius-server/pkg/blobstore"
 )
 
 // WebSocketNotifier interface for WebSocket notifications
@@ -16,6 +19,9 @@ type WebSocketNotifier interface {
 	BroadcastPolicyAssignment(policyID, deviceID, groupID, action string)
 	BroadcastCommandExecution(commandID, deviceID, command, status, result string)
 	BroadcastGroupMembership(groupID, deviceID, action string)
+	BroadcastLiveQueryResult(userID, campaignID, deviceID, status string, rows []map[string]string, errMsg string)
+	BroadcastLiveQueryCompleted(userID, campaignID, status string, responded, total int)
+	BroadcastPolicyCompliance(policyID, deviceID, oldStatus, newStatus string)
 }
 
 // NoOpWebSocketNotifier is a no-op implementation for when WebSocket is disabled
@@ -25,121 +31,16 @@ func (n *NoOpWebSocketNotifier) BroadcastDeviceStatusChange(deviceID, oldStatus,
 func (n *NoOpWebSocketNotifier) BroadcastPolicyAssignment(policyID, deviceID, groupID, action string) {}
 func (n *NoOpWebSocketNotifier) BroadcastCommandExecution(commandID, deviceID, command, status, result string) {}
 func (n *NoOpWebSocketNotifier) BroadcastGroupMembership(groupID, deviceID, action string) {}
-
-// LicenseServiceImpl implements the LicenseService interface
-type LicenseServiceImpl struct {
-	// In a real implementation, this would use a database
-	currentLicense *api.License
-}
-
-// NewLicenseService creates a new license service instance
-func NewLicenseService() *LicenseServiceImpl {
-	return &LicenseServiceImpl{
-		currentLicense: &api.License{
-			Valid:           true,
-			Tier:            "community",
-			DeviceLimit:     10,
-			DevicesEnrolled: 0,
-			ExpiresAt:       nil, // Community license never expires
-			Features: []string{
-				"device_management",
-				"basic_policies",
-			},
-		},
-	}
-}
-
-// GetLicense returns the current license information
-func (s *LicenseServiceImpl) GetLicense() (*api.License, error) {
-	return s.currentLicense, nil
-}
-
-// UpdateLicense updates the license key
-func (s *LicenseServiceImpl) UpdateLicense(key string) error {
-	// In a real implementation, this would validate the license key
-	// against a licensing server or cryptographic signature
-
-	if key == "" {
-		return fmt.Errorf("license key cannot be empty")
-	}
-
-	// Mock license validation
-	switch key {
-	case "community-license":
-		s.currentLicense = &api.License{
-			Valid:           true,
-			Tier:            "community",
-			DeviceLimit:     10,
-			DevicesEnrolled: s.currentLicense.DevicesEnrolled,
-			ExpiresAt:       nil,
-			Features: []string{
-				"device_management",
-				"basic_policies",
-			},
-		}
-	case "professional-license":
-		expiry := time.Now().AddDate(1, 0, 0) // 1 year from now
-		s.currentLicense = &api.License{
-			Valid:           true,
-			Tier:            "professional",
-			DeviceLimit:     100,
-			DevicesEnrolled: s.currentLicense.DevicesEnrolled,
-			ExpiresAt:       &expiry,
-			Features: []string{
-				"device_management",
-				"advanced_policies",
-				"application_management",
-				"reporting",
-			},
-		}
-	case "enterprise-license":
-		expiry := time.Now().AddDate(1, 0, 0) // 1 year from now
-		s.currentLicense = &api.License{
-			Valid:           true,
-			Tier:            "enterprise",
-			DeviceLimit:     -1, // Unlimited
-			DevicesEnrolled: s.currentLicense.DevicesEnrolled,
-			ExpiresAt:       &expiry,
-			Features: []string{
-				"device_management",
-				"advanced_policies",
-				"application_management",
-				"reporting",
-				"integrations",
-				"custom_scripts",
-				"priority_support",
-			},
-		}
-	default:
-		return fmt.Errorf("invalid license key")
-	}
-
-	return nil
-}
-
-// ValidateLicense checks if the current license is valid
-func (s *LicenseServiceImpl) ValidateLicense() error {
-	if !s.currentLicense.Valid {
-		return fmt.Errorf("license is invalid")
-	}
-
-	if s.currentLicense.ExpiresAt != nil && time.Now().After(*s.currentLicense.ExpiresAt) {
-		s.currentLicense.Valid = false
-		return fmt.Errorf("license has expired")
-	}
-
-	if s.currentLicense.DeviceLimit > 0 && s.currentLicense.DevicesEnrolled >= s.currentLicense.DeviceLimit {
-		return fmt.Errorf("device limit exceeded")
-	}
-
-	return nil
-}
+func (n *NoOpWebSocketNotifier) BroadcastLiveQueryResult(userID, campaignID, deviceID, status string, rows []map[string]string, errMsg string) {}
+func (n *NoOpWebSocketNotifier) BroadcastLiveQueryCompleted(userID, campaignID, status string, responded, total int) {}
+func (n *NoOpWebSocketNotifier) BroadcastPolicyCompliance(policyID, deviceID, oldStatus, newStatus string) {}
 
 // DeviceServiceImpl implements the DeviceService interface
 type DeviceServiceImpl struct {
 	// In a real implementation, this would use a database
 	devices     map[string]*api.Device
 	wsNotifier  WebSocketNotifier
+	license     api.LicenseService // Enforces the device limit when set
 }
 
 // NewDeviceService creates a new device service instance
@@ -155,12 +56,29 @@ func (s *DeviceServiceImpl) SetWebSocketNotifier(notifier WebSocketNotifier) {
 	s.wsNotifier = notifier
 }
 
+// SetLicenseService enforces the device limit of license on enrollment
+func (s *DeviceServiceImpl) SetLicenseService(license api.LicenseService) {
+	s.license = license
+	s.license.SetDevicesEnrolled(len(s.devices))
+}
+
 // ListDevices returns a filtered list of devices with pagination
 func (s *DeviceServiceImpl) ListDevices(filters api.DeviceFilters) ([]*api.Device, int, error) {
 	var result []*api.Device
 
+	var deviceIDs map[string]bool
+	if filters.DeviceIDs != nil {
+		deviceIDs = make(map[string]bool, len(filters.DeviceIDs))
+		for _, id := range filters.DeviceIDs {
+			deviceIDs[id] = true
+		}
+	}
+
 	// Filter devices
 	for _, device := range s.devices {
+		if deviceIDs != nil && !deviceIDs[device.ID] {
+			continue
+		}
 		if filters.Platform != "" && device.Platform != filters.Platform {
 			continue
 		}
@@ -180,6 +98,14 @@ func (s *DeviceServiceImpl) ListDevices(filters api.DeviceFilters) ([]*api.Devic
 		result = append(result, device)
 	}
 
+	// Page in enrollment order, which the map does not keep
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].EnrolledAt.Equal(result[j].EnrolledAt) {
+			return result[i].EnrolledAt.Before(result[j].EnrolledAt)
+		}
+		return result[i].ID < result[j].ID
+	})
+
 	total := len(result)
 
 	// Apply pagination
@@ -214,6 +140,18 @@ func (s *DeviceServiceImpl) EnrollDevice(enrollment api.DeviceEnrollment) (*api.
 	// Generate a new device ID using the UUID
 	deviceID := enrollment.UUID
 
+	// Re-enrolling a managed device does not count against the license
+	existing, exists := s.devices[deviceID]
+	if !exists && s.license != nil {
+		if err := s.license.CheckEnrollment(len(s.devices)); err != nil {
+			return nil, err
+		}
+	}
+	revision := 1
+	if exists {
+		revision = existing.Revision + 1
+	}
+
 	device := &api.Device{
 		ID:         deviceID,
 		UUID:       enrollment.UUID,
@@ -224,9 +162,13 @@ func (s *DeviceServiceImpl) EnrollDevice(enrollment api.DeviceEnrollment) (*api.
 		LastSeen:   time.Now(),
 		EnrolledAt: time.Now(),
 		Labels:     make(map[string]string),
+		Revision:   revision,
 	}
 
 	s.devices[deviceID] = device
+	if s.license != nil {
+		s.license.SetDevicesEnrolled(len(s.devices))
+	}
 	
 	// Notify WebSocket clients of device enrollment
 	s.wsNotifier.BroadcastDeviceStatusChange(deviceID, "", "online")
@@ -234,6 +176,27 @@ func (s *DeviceServiceImpl) EnrollDevice(enrollment api.DeviceEnrollment) (*api.
 	return device, nil
 }
 
+// CountDevices counts the managed devices by platform and status
+func (s *DeviceServiceImpl) CountDevices() ([]api.DeviceCount, error) {
+	counts := make(map[api.DeviceCount]int)
+	for _, device := range s.devices {
+		counts[api.DeviceCount{Platform: device.Platform, Status: device.Status}]++
+	}
+
+	result := make([]api.DeviceCount, 0, len(counts))
+	for key, n := range counts {
+		key.Count = n
+		result = append(result, key)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Platform != result[j].Platform {
+			return result[i].Platform < result[j].Platform
+		}
+		return result[i].Status < result[j].Status
+	})
+	return result, nil
+}
+
 // UnenrollDevice removes a device from management
 func (s *DeviceServiceImpl) UnenrollDevice(id string) error {
 	_, exists := s.devices[id]
@@ -242,6 +205,9 @@ func (s *DeviceServiceImpl) UnenrollDevice(id string) error {
 	}
 
 	delete(s.devices, id)
+	if s.license != nil {
+		s.license.SetDevicesEnrolled(len(s.devices))
+	}
 	return nil
 }
 
@@ -251,6 +217,9 @@ func (s *DeviceServiceImpl) UpdateDevice(id string, updates api.DeviceUpdates) (
 	if !exists {
 		return nil, fmt.Errorf("device not found")
 	}
+	if updates.IfRevision != 0 && updates.IfRevision != device.Revision {
+		return nil, api.ErrRevisionConflict
+	}
 
 	// Apply updates
 	if updates.Hostname != nil {
@@ -262,101 +231,22 @@ func (s *DeviceServiceImpl) UpdateDevice(id string, updates api.DeviceUpdates) (
 	if updates.Labels != nil {
 		device.Labels = *updates.Labels
 	}
+	if updates.SystemInfo != nil {
+		device.SystemInfo = *updates.SystemInfo
+	}
 
 	device.LastSeen = time.Now()
+	device.Revision++
 	s.devices[id] = device
 	return device, nil
 }
 
-// ExecuteCommand executes a command on a device
-func (s *DeviceServiceImpl) ExecuteCommand(deviceID, command string, parameters map[string]interface{}) (*api.DeviceCommandResult, error) {
-	device, exists := s.devices[deviceID]
-	if !exists {
-		return nil, fmt.Errorf("device not found")
-	}
-
-	if device.Status != "online" {
-		return nil, fmt.Errorf("device is not online")
-	}
-
-	// Generate command ID
-	commandID := generateID()
-	now := time.Now()
-
-	// In a real implementation, this would queue the command for the device
-	// and return a command result that gets updated asynchronously
-	result := &api.DeviceCommandResult{
-		ID:      commandID,
-		Command: command,
-		Status:  "completed", // Mock immediate completion
-		Result: map[string]interface{}{
-			"success": true,
-			"message": fmt.Sprintf("Command '%s' executed successfully on device %s", command, device.Hostname),
-		},
-		ExecutedAt: &now,
-	}
-
-	// Notify WebSocket clients of command execution
-	s.wsNotifier.BroadcastCommandExecution(commandID, deviceID, command, "completed", 
-		fmt.Sprintf("Command '%s' executed successfully", command))
-
-	// Update device last seen
-	device.LastSeen = time.Now()
-	s.devices[deviceID] = device
-
-	return result, nil
-}
-
-// ExecuteOSQuery executes an OSQuery on a device
-func (s *DeviceServiceImpl) ExecuteOSQuery(deviceID, query string) (*api.OSQueryResult, error) {
-	device, exists := s.devices[deviceID]
-	if !exists {
-		return nil, fmt.Errorf("device not found")
-	}
-
-	if device.Status != "online" {
-		return nil, fmt.Errorf("device is not online")
-	}
-
-	// Mock OSQuery result - in real implementation this would execute actual OSQuery
-	result := &api.OSQueryResult{
-		Query:    query,
-		Columns:  []string{"name", "version", "platform"},
-		Duration: 150, // milliseconds
-	}
-
-	// Generate mock data based on query
-	if query == "SELECT name, version, platform FROM osquery_info;" {
-		result.Rows = []map[string]interface{}{
-			{
-				"name":     "osqueryd",
-				"version":  "5.10.2",
-				"platform": device.Platform,
-			},
-		}
-	} else {
-		// Default mock result
-		result.Rows = []map[string]interface{}{
-			{
-				"name":     "mock_data",
-				"version":  "1.0.0",
-				"platform": device.Platform,
-			},
-		}
-	}
-
-	// Update device last seen
-	device.LastSeen = time.Now()
-	s.devices[deviceID] = device
-
-	return result, nil
-}
-
 // DeviceGroupServiceImpl implements the DeviceGroupService interface
 type DeviceGroupServiceImpl struct {
 	groups       map[string]*api.DeviceGroup
 	groupDevices map[string][]string // group ID -> device IDs
 	wsNotifier   WebSocketNotifier
+	mu           sync.Mutex
 }
 
 // NewDeviceGroupService creates a new device group service instance
@@ -373,19 +263,36 @@ func (s *DeviceGroupServiceImpl) SetWebSocketNotifier(notifier WebSocketNotifier
 	s.wsNotifier = notifier
 }
 
-// ListDeviceGroups returns all device groups
+// ListDeviceGroups returns all device groups in creation order
 func (s *DeviceGroupServiceImpl) ListDeviceGroups() ([]*api.DeviceGroup, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	groups := make([]*api.DeviceGroup, 0, len(s.groups))
 	for _, group := range s.groups {
 		// Update device count
 		group.DeviceCount = len(s.groupDevices[group.ID])
 		groups = append(groups, group)
 	}
+	sortDeviceGroups(groups)
 	return groups, nil
 }
 
+// sortDeviceGroups orders groups by creation, like the database does
+func sortDeviceGroups(groups []*api.DeviceGroup) {
+	sort.Slice(groups, func(i, j int) bool {
+		if !groups[i].CreatedAt.Equal(groups[j].CreatedAt) {
+			return groups[i].CreatedAt.Before(groups[j].CreatedAt)
+		}
+		return groups[i].ID < groups[j].ID
+	})
+}
+
 // GetDeviceGroup returns a specific device group
 func (s *DeviceGroupServiceImpl) GetDeviceGroup(id string) (*api.DeviceGroup, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	group, exists := s.groups[id]
 	if !exists {
 		return nil, fmt.Errorf("device group not found")
@@ -397,6 +304,13 @@ func (s *DeviceGroupServiceImpl) GetDeviceGroup(id string) (*api.DeviceGroup, er
 
 // CreateDeviceGroup creates a new device group
 func (s *DeviceGroupServiceImpl) CreateDeviceGroup(create api.DeviceGroupCreate) (*api.DeviceGroup, error) {
+	if err := ValidateGroupFilters(create.Filters); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	groupID := generateID()
 	now := time.Now()
 
@@ -409,6 +323,7 @@ func (s *DeviceGroupServiceImpl) CreateDeviceGroup(create api.DeviceGroupCreate)
 		Labels:      create.Labels,
 		CreatedAt:   now,
 		UpdatedAt:   now,
+		Revision:    1,
 	}
 
 	if group.Filters == nil {
@@ -426,10 +341,23 @@ func (s *DeviceGroupServiceImpl) CreateDeviceGroup(create api.DeviceGroupCreate)
 
 // UpdateDeviceGroup updates a device group
 func (s *DeviceGroupServiceImpl) UpdateDeviceGroup(id string, updates api.DeviceGroupUpdate) (*api.DeviceGroup, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	group, exists := s.groups[id]
 	if !exists {
 		return nil, fmt.Errorf("device group not found")
 	}
+	if updates.IfRevision != 0 && updates.IfRevision != group.Revision {
+		return nil, api.ErrRevisionConflict
+	}
+	// Validate before applying anything, so a rejected update leaves the
+	// group as it was
+	if updates.Filters != nil {
+		if err := ValidateGroupFilters(*updates.Filters); err != nil {
+			return nil, err
+		}
+	}
 
 	// Apply updates
 	if updates.Name != nil {
@@ -446,6 +374,7 @@ func (s *DeviceGroupServiceImpl) UpdateDeviceGroup(id string, updates api.Device
 	}
 
 	group.UpdatedAt = time.Now()
+	group.Revision++
 	s.groups[id] = group
 
 	return group, nil
@@ -453,6 +382,9 @@ func (s *DeviceGroupServiceImpl) UpdateDeviceGroup(id string, updates api.Device
 
 // DeleteDeviceGroup deletes a device group
 func (s *DeviceGroupServiceImpl) DeleteDeviceGroup(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	_, exists := s.groups[id]
 	if !exists {
 		return fmt.Errorf("device group not found")
@@ -465,6 +397,9 @@ func (s *DeviceGroupServiceImpl) DeleteDeviceGroup(id string) error {
 
 // GetGroupDevices returns all devices in a group
 func (s *DeviceGroupServiceImpl) GetGroupDevices(groupID string) ([]*api.Device, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	_, exists := s.groups[groupID]
 	if !exists {
 		return nil, fmt.Errorf("device group not found")
@@ -482,7 +417,7 @@ func (s *DeviceGroupServiceImpl) GetGroupDevices(groupID string) ([]*api.Device,
 		device := &api.Device{
 			ID:       deviceID,
 			UUID:     deviceID,
-			Hostname: fmt.Sprintf("device-%s", deviceID[:8]),
+			Hostname: fmt.Sprintf("device-%s", deviceID),
 			Platform: "macos",
 			Status:   "online",
 			LastSeen: time.Now(),
@@ -495,10 +430,16 @@ func (s *DeviceGroupServiceImpl) GetGroupDevices(groupID string) ([]*api.Device,
 
 // AddDeviceToGroup adds a device to a group
 func (s *DeviceGroupServiceImpl) AddDeviceToGroup(groupID, deviceID string) error {
-	_, exists := s.groups[groupID]
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	group, exists := s.groups[groupID]
 	if !exists {
 		return fmt.Errorf("device group not found")
 	}
+	if len(group.Filters) > 0 {
+		return fmt.Errorf("device group membership is managed by its filters")
+	}
 
 	// Check if device is already in the group
 	deviceIDs := s.groupDevices[groupID]
@@ -519,10 +460,16 @@ func (s *DeviceGroupServiceImpl) AddDeviceToGroup(groupID, deviceID string) erro
 
 // RemoveDeviceFromGroup removes a device from a group
 func (s *DeviceGroupServiceImpl) RemoveDeviceFromGroup(groupID, deviceID string) error {
-	_, exists := s.groups[groupID]
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	group, exists := s.groups[groupID]
 	if !exists {
 		return fmt.Errorf("device group not found")
 	}
+	if len(group.Filters) > 0 {
+		return fmt.Errorf("device group membership is managed by its filters")
+	}
 
 	// Find and remove device from group
 	deviceIDs := s.groupDevices[groupID]
@@ -543,6 +490,9 @@ func (s *DeviceGroupServiceImpl) RemoveDeviceFromGroup(groupID, deviceID string)
 
 // GetDeviceGroups returns all groups that contain a specific device
 func (s *DeviceGroupServiceImpl) GetDeviceGroups(deviceID string) ([]*api.DeviceGroup, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	groups := make([]*api.DeviceGroup, 0)
 	
 	for groupID, deviceIDs := range s.groupDevices {
@@ -556,10 +506,103 @@ func (s *DeviceGroupServiceImpl) GetDeviceGroups(deviceID string) ([]*api.Device
 			}
 		}
 	}
+	sortDeviceGroups(groups)
 	
 	return groups, nil
 }
 
+// EvaluateDeviceMembership adds a device to the dynamic groups whose filters
+// it matches and removes it from those it no longer matches
+func (s *DeviceGroupServiceImpl) EvaluateDeviceMembership(device *api.Device) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for groupID, group := range s.groups {
+		if len(group.Filters) == 0 {
+			continue
+		}
+		s.setMember(groupID, device.ID, MatchGroupFilters(group.Filters, device))
+	}
+	return nil
+}
+
+// EvaluateGroupMembership sets the members of a dynamic group to the given
+// devices that match its filters. Groups without filters are left untouched.
+func (s *DeviceGroupServiceImpl) EvaluateGroupMembership(groupID string, devices []*api.Device) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	group, exists := s.groups[groupID]
+	if !exists {
+		return fmt.Errorf("device group not found")
+	}
+	if len(group.Filters) == 0 {
+		return nil
+	}
+
+	matched := make(map[string]bool, len(devices))
+	for _, device := range devices {
+		if MatchGroupFilters(group.Filters, device) {
+			matched[device.ID] = true
+		}
+	}
+	for _, deviceID := range append([]string(nil), s.groupDevices[groupID]...) {
+		if !matched[deviceID] {
+			s.setMember(groupID, deviceID, false)
+		}
+	}
+	for _, device := range devices {
+		if matched[device.ID] {
+			s.setMember(groupID, device.ID, true)
+		}
+	}
+	return nil
+}
+
+// ExplainDeviceMembership describes how a device fares against the filters of a group
+func (s *DeviceGroupServiceImpl) ExplainDeviceMembership(groupID string, device *api.Device) (*api.GroupMembershipExplanation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	group, exists := s.groups[groupID]
+	if !exists {
+		return nil, fmt.Errorf("device group not found")
+	}
+	return ExplainGroupMembership(group, device, s.isMember(groupID, device.ID)), nil
+}
+
+// setMember adds or removes a device from a group, notifying WebSocket
+// clients when membership changes. Callers must hold s.mu.
+func (s *DeviceGroupServiceImpl) setMember(groupID, deviceID string, member bool) {
+	if s.isMember(groupID, deviceID) == member {
+		return
+	}
+
+	if member {
+		s.groupDevices[groupID] = append(s.groupDevices[groupID], deviceID)
+		s.wsNotifier.BroadcastGroupMembership(groupID, deviceID, "added")
+		return
+	}
+
+	deviceIDs := s.groupDevices[groupID]
+	for i, id := range deviceIDs {
+		if id == deviceID {
+			s.groupDevices[groupID] = append(deviceIDs[:i], deviceIDs[i+1:]...)
+			break
+		}
+	}
+	s.wsNotifier.BroadcastGroupMembership(groupID, deviceID, "removed")
+}
+
+func (s *DeviceGroupServiceImpl) isMember(groupID, deviceID string) bool {
+	for _, id := range s.groupDevices[groupID] {
+		if id == deviceID {
+			return true
+		}
+	}
+	return false
+}
+
 // PolicyServiceImpl implements the PolicyService interface
 type PolicyServiceImpl struct {
 	policies       map[string]*api.Policy
@@ -583,12 +626,18 @@ func (s *PolicyServiceImpl) SetWebSocketNotifier(notifier WebSocketNotifier) {
 	s.wsNotifier = notifier
 }
 
-// ListPolicies returns all policies
+// ListPolicies returns all policies in creation order
 func (s *PolicyServiceImpl) ListPolicies() ([]*api.Policy, error) {
-	var result []*api.Policy
+	result := make([]*api.Policy, 0, len(s.policies))
 	for _, policy := range s.policies {
 		result = append(result, policy)
 	}
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].CreatedAt.Equal(result[j].CreatedAt) {
+			return result[i].CreatedAt.Before(result[j].CreatedAt)
+		}
+		return result[i].ID < result[j].ID
+	})
 	return result, nil
 }
 
@@ -612,6 +661,7 @@ func (s *PolicyServiceImpl) CreatePolicy(policyCreate api.PolicyCreate) (*api.Po
 		Configuration: policyCreate.Configuration,
 		CreatedAt:     time.Now(),
 		UpdatedAt:     time.Now(),
+		Revision:      1,
 	}
 
 	s.policies[policy.ID] = policy
@@ -624,6 +674,9 @@ func (s *PolicyServiceImpl) UpdatePolicy(id string, updates api.PolicyUpdate) (*
 	if !exists {
 		return nil, fmt.Errorf("policy not found")
 	}
+	if updates.IfRevision != 0 && updates.IfRevision != policy.Revision {
+		return nil, api.ErrRevisionConflict
+	}
 
 	// Apply updates
 	if updates.Name != nil {
@@ -640,6 +693,7 @@ func (s *PolicyServiceImpl) UpdatePolicy(id string, updates api.PolicyUpdate) (*
 	}
 
 	policy.UpdatedAt = time.Now()
+	policy.Revision++
 	return policy, nil
 }
 
@@ -723,6 +777,7 @@ func (s *PolicyServiceImpl) GetPolicyDevices(policyID string) ([]*api.Device, er
 			}
 		}
 	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].ID < devices[j].ID })
 	
 	return devices, nil
 }
@@ -796,6 +851,7 @@ func (s *PolicyServiceImpl) GetPolicyGroups(policyID string) ([]*api.DeviceGroup
 			}
 		}
 	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].ID < groups[j].ID })
 	
 	return groups, nil
 }
@@ -850,26 +906,44 @@ func generateID() string {
 // ApplicationServiceImpl implements the ApplicationService interface
 type ApplicationServiceImpl struct {
 	applications map[string]*api.Application
+	publications map[string]map[string]*api.ApplicationPublication // app ID -> group ID -> publication
+	packages     blobstore.Store
+	mu           sync.RWMutex
 }
 
-// NewApplicationService creates a new application service instance
-func NewApplicationService() *ApplicationServiceImpl {
+// NewApplicationService creates a new application service instance storing
+// packages in packages
+func NewApplicationService(packages blobstore.Store) *ApplicationServiceImpl {
 	return &ApplicationServiceImpl{
 		applications: make(map[string]*api.Application),
+		publications: make(map[string]map[string]*api.ApplicationPublication),
+		packages:     packages,
 	}
 }
 
-// ListApplications returns all applications
+// ListApplications returns all applications in creation order
 func (s *ApplicationServiceImpl) ListApplications() ([]*api.Application, error) {
-	var result []*api.Application
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]*api.Application, 0, len(s.applications))
 	for _, app := range s.applications {
 		result = append(result, app)
 	}
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].CreatedAt.Equal(result[j].CreatedAt) {
+			return result[i].CreatedAt.Before(result[j].CreatedAt)
+		}
+		return result[i].ID < result[j].ID
+	})
 	return result, nil
 }
 
 // GetApplication returns an application by ID
 func (s *ApplicationServiceImpl) GetApplication(id string) (*api.Application, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	app, exists := s.applications[id]
 	if !exists {
 		return nil, fmt.Errorf("application not found")
@@ -877,28 +951,76 @@ func (s *ApplicationServiceImpl) GetApplication(id string) (*api.Application, er
 	return app, nil
 }
 
-// AddApplication adds a new application
+// AddApplication stores the package and adds the application
 func (s *ApplicationServiceImpl) AddApplication(appCreate api.ApplicationCreate) (*api.Application, error) {
-	app := &api.Application{
-		ID:        generateID(),
-		Name:      appCreate.Name,
-		Version:   appCreate.Version,
-		Platform:  appCreate.Platform,
-		Size:      int64(len(appCreate.Package)),
-		Checksum:  fmt.Sprintf("%x", sha256.Sum256(appCreate.Package)),
-		CreatedAt: time.Now(),
+	prepared, err := PreparePackage(appCreate)
+	if err != nil {
+		return nil, err
+	}
+	defer prepared.Close() //nolint:errcheck
+
+	app := prepared.Application
+	app.ID = generateID()
+	app.CreatedAt = time.Now()
+	app.Revision = 1
+	if err := s.packages.Put(context.Background(), app.ID, prepared.File); err != nil {
+		return nil, fmt.Errorf("store package: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.applications[app.ID] = app
+	return app, nil
+}
+
+// ImportApplication adds an application from a package of the package
+// search catalog
+func (s *ApplicationServiceImpl) ImportApplication(imp api.ApplicationImport) (*api.Application, error) {
+	app, err := PrepareImport(imp)
+	if err != nil {
+		return nil, err
 	}
+	now := time.Now()
+	app.ID = generateID()
+	app.CreatedAt = now
+	app.LatestVersionCheckedAt = &now
+	app.Revision = 1
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
 	s.applications[app.ID] = app
 	return app, nil
 }
 
+// SetLatestVersion records the latest upstream version of an application
+func (s *ApplicationServiceImpl) SetLatestVersion(id, version string, checkedAt time.Time) (*api.Application, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	app, exists := s.applications[id]
+	if !exists {
+		return nil, fmt.Errorf("application not found")
+	}
+	app.LatestVersion = version
+	app.LatestVersionCheckedAt = &checkedAt
+	app.UpdateAvailable = UpdateAvailable(app)
+	return app, nil
+}
+
 // UpdateApplication updates an existing application
 func (s *ApplicationServiceImpl) UpdateApplication(id string, updates api.ApplicationUpdate) (*api.Application, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	app, exists := s.applications[id]
 	if !exists {
 		return nil, fmt.Errorf("application not found")
 	}
+	if updates.IfRevision != 0 && updates.IfRevision != app.Revision {
+		return nil, api.ErrRevisionConflict
+	}
 
 	if updates.Name != nil {
 		app.Name = *updates.Name
@@ -906,34 +1028,154 @@ func (s *ApplicationServiceImpl) UpdateApplication(id string, updates api.Applic
 	if updates.Version != nil {
 		app.Version = *updates.Version
 	}
+	app.UpdateAvailable = UpdateAvailable(app)
+	app.Revision++
 
 	return app, nil
 }
 
-// DeleteApplication deletes an application
+// DeleteApplication deletes an application and its package
 func (s *ApplicationServiceImpl) DeleteApplication(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	_, exists := s.applications[id]
 	if !exists {
 		return fmt.Errorf("application not found")
 	}
 
+	if err := s.packages.Delete(context.Background(), id); err != nil {
+		return fmt.Errorf("delete package: %w", err)
+	}
 	delete(s.applications, id)
+	delete(s.publications, id)
 	return nil
 }
 
-// AuthServiceImpl implements the AuthService interface
+// OpenPackage returns the package of an application and its size
+func (s *ApplicationServiceImpl) OpenPackage(id string) (io.ReadCloser, int64, error) {
+	if _, err := s.GetApplication(id); err != nil {
+		return nil, 0, err
+	}
+	return s.packages.Get(context.Background(), id)
+}
+
+// ListPublications returns the publications of every application
+func (s *ApplicationServiceImpl) ListPublications() ([]*api.ApplicationPublication, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]*api.ApplicationPublication, 0)
+	for appID := range s.publications {
+		result = append(result, s.applicationPublications(appID)...)
+	}
+	sortPublications(result)
+	return result, nil
+}
+
+// ListApplicationPublications returns the groups an application is
+// published to
+func (s *ApplicationServiceImpl) ListApplicationPublications(appID string) ([]*api.ApplicationPublication, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := s.applicationPublications(appID)
+	sortPublications(result)
+	return result, nil
+}
+
+func (s *ApplicationServiceImpl) applicationPublications(appID string) []*api.ApplicationPublication {
+	result := make([]*api.ApplicationPublication, 0, len(s.publications[appID]))
+	for _, p := range s.publications[appID] {
+		publication := *p
+		result = append(result, &publication)
+	}
+	return result
+}
+
+// sortPublications sorts publications by application, then group
+func sortPublications(publications []*api.ApplicationPublication) {
+	sort.Slice(publications, func(i, j int) bool {
+		if publications[i].ApplicationID != publications[j].ApplicationID {
+			return publications[i].ApplicationID < publications[j].ApplicationID
+		}
+		return publications[i].GroupID < publications[j].GroupID
+	})
+}
+
+// PublishApplication publishes an application to a device group, or
+// updates whether it is restricted there
+func (s *ApplicationServiceImpl) PublishApplication(appID, groupID string, restricted bool) (*api.ApplicationPublication, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.applications[appID]; !exists {
+		return nil, fmt.Errorf("application not found")
+	}
+	groups, exists := s.publications[appID]
+	if !exists {
+		groups = make(map[string]*api.ApplicationPublication)
+		s.publications[appID] = groups
+	}
+	p, exists := groups[groupID]
+	if !exists {
+		p = &api.ApplicationPublication{ApplicationID: appID, GroupID: groupID, PublishedAt: time.Now()}
+		groups[groupID] = p
+	}
+	p.Restricted = restricted
+
+	publication := *p
+	return &publication, nil
+}
+
+// UnpublishApplication removes an application from a device group
+func (s *ApplicationServiceImpl) UnpublishApplication(appID, groupID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.publications[appID][groupID]; !exists {
+		return fmt.Errorf("publication not found")
+	}
+	delete(s.publications[appID], groupID)
+	if len(s.publications[appID]) == 0 {
+		delete(s.publications, appID)
+	}
+	return nil
+}
+
+// AuthServiceImpl implements the AuthService and UserService interfaces
 type AuthServiceImpl struct {
-	users        map[string]*api.User
-	tokens       map[string]*api.User
-	deviceTokens map[string]*api.Device
+	users        map[string]*api.User // user ID -> user
+	passwords    map[string][]byte    // user ID -> bcrypt hash
+	sessions     map[string]*session  // session ID -> session
+	deviceTokens map[string]*api.Device // device token hash -> device
+	deviceKeys   map[string]string      // device ID -> device token hash
+	tokens       *TokenIssuer
+	mu           sync.RWMutex
+}
+
+// session tracks a login; access tokens are only valid while their session exists
+type session struct {
+	id               string
+	userID           string
+	refreshHash      string
+	refreshExpiresAt time.Time
 }
 
 // NewAuthService creates a new auth service instance
 func NewAuthService() *AuthServiceImpl {
+	tokens, err := NewTokenIssuer(nil)
+	if err != nil {
+		panic(err)
+	}
+
 	service := &AuthServiceImpl{
 		users:        make(map[string]*api.User),
-		tokens:       make(map[string]*api.User),
+		passwords:    make(map[string][]byte),
+		sessions:     make(map[string]*session),
 		deviceTokens: make(map[string]*api.Device),
+		deviceKeys:   make(map[string]string),
+		tokens:       tokens,
 	}
 
 	// Create default admin user
@@ -944,38 +1186,95 @@ func NewAuthService() *AuthServiceImpl {
 		Role:      "admin",
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
+		Revision:  1,
+
+		MustChangePassword: true,
 	}
-	service.users["admin@mobius.local"] = adminUser
+	hash, err := HashPassword(DefaultAdminPassword)
+	if err != nil {
+		panic(err)
+	}
+	service.users[adminUser.ID] = adminUser
+	service.passwords[adminUser.ID] = hash
 
 	return service
 }
 
-// Login authenticates a user and returns a token
+// DefaultAdminPassword is the password of the bootstrap admin account, which
+// must be changed at the first login
+const DefaultAdminPassword = "admin123"
+
+// Login authenticates a user and returns a token pair
 func (s *AuthServiceImpl) Login(email, password string) (*api.AuthResponse, error) {
-	user, exists := s.users[email]
-	if !exists {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user := s.userByEmail(email)
+	if user == nil {
 		return nil, fmt.Errorf("invalid credentials")
 	}
 
-	// In a real implementation, check password hash
-	if password != "admin123" { // Mock password validation
+	if err := CheckPassword(s.passwords[user.ID], password); err != nil {
 		return nil, fmt.Errorf("invalid credentials")
 	}
 
-	// Generate token (in a real implementation, use JWT)
-	token := fmt.Sprintf("token_%s_%d", user.ID, time.Now().Unix())
-	s.tokens[token] = user
+	return s.startSession(user, generateID())
+}
 
-	return &api.AuthResponse{
-		Token:     token,
-		ExpiresAt: time.Now().Add(24 * time.Hour),
-		User:      user,
-	}, nil
+// Refresh rotates a refresh token and returns a new token pair
+func (s *AuthServiceImpl) Refresh(refreshToken string) (*api.AuthResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hash := HashToken(refreshToken)
+	for id, sess := range s.sessions {
+		if sess.refreshHash != hash {
+			continue
+		}
+		if time.Now().After(sess.refreshExpiresAt) {
+			delete(s.sessions, id)
+			return nil, fmt.Errorf("refresh token expired")
+		}
+		user, exists := s.users[sess.userID]
+		if !exists {
+			delete(s.sessions, id)
+			return nil, fmt.Errorf("invalid refresh token")
+		}
+		return s.startSession(user, id)
+	}
+
+	return nil, fmt.Errorf("invalid refresh token")
 }
 
-// ValidateToken validates a user token
+// Logout revokes the session of an access token
+func (s *AuthServiceImpl) Logout(token string) error {
+	claims, err := s.tokens.ParseAccessToken(token)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.sessions, claims.SessionID)
+	return nil
+}
+
+// ValidateToken validates a user access token
 func (s *AuthServiceImpl) ValidateToken(token string) (*api.User, error) {
-	user, exists := s.tokens[token]
+	claims, err := s.tokens.ParseAccessToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sess, exists := s.sessions[claims.SessionID]
+	if !exists || sess.userID != claims.Subject {
+		return nil, fmt.Errorf("invalid token: session revoked")
+	}
+	user, exists := s.users[claims.Subject]
 	if !exists {
 		return nil, fmt.Errorf("invalid token")
 	}
@@ -984,13 +1283,240 @@ func (s *AuthServiceImpl) ValidateToken(token string) (*api.User, error) {
 
 // ValidateDeviceToken validates a device token
 func (s *AuthServiceImpl) ValidateDeviceToken(token string) (*api.Device, error) {
-	device, exists := s.deviceTokens[token]
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	device, exists := s.deviceTokens[HashToken(token)]
 	if !exists {
 		return nil, fmt.Errorf("invalid device token")
 	}
 	return device, nil
 }
 
+// IssueDeviceToken issues a new token for a device, replacing any token it
+// held before
+func (s *AuthServiceImpl) IssueDeviceToken(device *api.Device) (string, error) {
+	token, hash, err := NewDeviceToken()
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.deviceTokens, s.deviceKeys[device.ID])
+	s.deviceTokens[hash] = device
+	s.deviceKeys[device.ID] = hash
+	return token, nil
+}
+
+// RevokeDeviceToken revokes the token of a device
+func (s *AuthServiceImpl) RevokeDeviceToken(deviceID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.deviceTokens, s.deviceKeys[deviceID])
+	delete(s.deviceKeys, deviceID)
+	return nil
+}
+
+// ListUsers returns all users ordered by email
+func (s *AuthServiceImpl) ListUsers() ([]*api.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	users := make([]*api.User, 0, len(s.users))
+	for _, user := range s.users {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Email < users[j].Email })
+	return users, nil
+}
+
+// GetUser returns a user by ID
+func (s *AuthServiceImpl) GetUser(id string) (*api.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, exists := s.users[id]
+	if !exists {
+		return nil, fmt.Errorf("user not found")
+	}
+	return user, nil
+}
+
+// CreateUser creates a user account with a hashed password
+func (s *AuthServiceImpl) CreateUser(create api.UserCreate) (*api.User, error) {
+	if err := ValidateUserCreate(create); err != nil {
+		return nil, err
+	}
+	hash, err := HashPassword(create.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.userByEmail(create.Email) != nil {
+		return nil, fmt.Errorf("user with email %s already exists", create.Email)
+	}
+
+	now := time.Now()
+	user := &api.User{
+		ID:             generateID(),
+		Email:          create.Email,
+		Name:           create.Name,
+		Role:           create.Role,
+		DeviceGroupIDs: create.DeviceGroupIDs,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+		Revision:       1,
+	}
+	s.users[user.ID] = user
+	s.passwords[user.ID] = hash
+	return user, nil
+}
+
+// UpdateUser updates a user; changing the password revokes existing sessions
+func (s *AuthServiceImpl) UpdateUser(id string, updates api.UserUpdate) (*api.User, error) {
+	var hash []byte
+	if updates.Password != nil {
+		if err := ValidatePasswordRequirements(*updates.Password); err != nil {
+			return nil, err
+		}
+		var err error
+		if hash, err = HashPassword(*updates.Password); err != nil {
+			return nil, err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, exists := s.users[id]
+	if !exists {
+		return nil, fmt.Errorf("user not found")
+	}
+	if updates.IfRevision != 0 && updates.IfRevision != user.Revision {
+		return nil, api.ErrRevisionConflict
+	}
+
+	role, deviceGroupIDs := user.Role, user.DeviceGroupIDs
+	if updates.Role != nil {
+		role = *updates.Role
+	}
+	if updates.DeviceGroupIDs != nil {
+		deviceGroupIDs = *updates.DeviceGroupIDs
+	}
+	if err := ValidateUserRole(role, deviceGroupIDs); err != nil {
+		return nil, err
+	}
+
+	if updates.Name != nil {
+		user.Name = *updates.Name
+	}
+	user.Role = role
+	user.DeviceGroupIDs = deviceGroupIDs
+	if hash != nil {
+		s.passwords[id] = hash
+		user.MustChangePassword = false
+		s.revokeSessions(id)
+	}
+	user.UpdatedAt = time.Now()
+	user.Revision++
+	return user, nil
+}
+
+// VerifyPassword returns api.ErrInvalidPassword unless password is the user's
+func (s *AuthServiceImpl) VerifyPassword(id, password string) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	hash, exists := s.passwords[id]
+	if !exists {
+		return fmt.Errorf("user not found")
+	}
+	if err := CheckPassword(hash, password); err != nil {
+		return api.ErrInvalidPassword
+	}
+	return nil
+}
+
+// DeleteUser deletes a user and revokes their sessions
+func (s *AuthServiceImpl) DeleteUser(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.users[id]; !exists {
+		return fmt.Errorf("user not found")
+	}
+	delete(s.users, id)
+	delete(s.passwords, id)
+	s.revokeSessions(id)
+	return nil
+}
+
+// RevokeUserSessions revokes every session of a user
+func (s *AuthServiceImpl) RevokeUserSessions(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.users[id]; !exists {
+		return fmt.Errorf("user not found")
+	}
+	s.revokeSessions(id)
+	return nil
+}
+
+// startSession creates or rotates a session and issues its tokens. The caller must hold the lock.
+func (s *AuthServiceImpl) startSession(user *api.User, sessionID string) (*api.AuthResponse, error) {
+	refreshToken, refreshHash, err := NewRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	accessToken, expiresAt, err := s.tokens.IssueAccessToken(user, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshExpiresAt := time.Now().Add(s.tokens.RefreshTTL)
+	s.sessions[sessionID] = &session{
+		id:               sessionID,
+		userID:           user.ID,
+		refreshHash:      refreshHash,
+		refreshExpiresAt: refreshExpiresAt,
+	}
+
+	return &api.AuthResponse{
+		Token:            accessToken,
+		ExpiresAt:        expiresAt,
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: refreshExpiresAt,
+		User:             user,
+	}, nil
+}
+
+// revokeSessions deletes all sessions of a user. The caller must hold the lock.
+func (s *AuthServiceImpl) revokeSessions(userID string) {
+	for id, sess := range s.sessions {
+		if sess.userID == userID {
+			delete(s.sessions, id)
+		}
+	}
+}
+
+// userByEmail finds a user by email. The caller must hold the lock.
+func (s *AuthServiceImpl) userByEmail(email string) *api.User {
+	for _, user := range s.users {
+		if strings.EqualFold(user.Email, email) {
+			return user
+		}
+	}
+	return nil
+}
+
+
 // GroupServiceImpl implements the GroupService interface
 type GroupServiceImpl struct {
 	groups map[string]*api.Group
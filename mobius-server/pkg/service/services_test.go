@@ -1,13 +1,48 @@
 package service
 
 import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/throttled/throttled/v2"
 
 	"github.com/notawar/mobius/mobius-server/api"
+	"github.com/notawar/mobius/mobius-server/pkg/blobstore"
 )
 
 func TestLicenseService(t *testing.T) {
-	service := NewLicenseService()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sign := func(claims LicenseClaims) string {
+		license, err := SignLicense(key, claims)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return license
+	}
+	expiring := func(tier string, limit int, expiresAt time.Time) string {
+		return sign(LicenseClaims{
+			Tier:             tier,
+			DeviceLimit:      limit,
+			RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(expiresAt)},
+		})
+	}
+	service := NewLicenseServiceWithKey(&key.PublicKey)
 
 	t.Run("GetLicense returns default community license", func(t *testing.T) {
 		license, err := service.GetLicense()
@@ -30,7 +65,7 @@ func TestLicenseService(t *testing.T) {
 	})
 
 	t.Run("UpdateLicense to professional", func(t *testing.T) {
-		err := service.UpdateLicense("professional-license")
+		err := service.UpdateLicense(expiring("professional", 100, time.Now().AddDate(1, 0, 0)))
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -49,10 +84,17 @@ func TestLicenseService(t *testing.T) {
 		if license.ExpiresAt == nil {
 			t.Errorf("expected professional license to have expiry date")
 		}
+		if !service.HasFeature("application_management") || service.HasFeature("custom_scripts") {
+			t.Errorf("expected professional features, got %v", license.Features)
+		}
 	})
 
 	t.Run("UpdateLicense to enterprise", func(t *testing.T) {
-		err := service.UpdateLicense("enterprise-license")
+		err := service.UpdateLicense(sign(LicenseClaims{
+			Tier:        "enterprise",
+			DeviceLimit: -1,
+			Features:    []string{"device_management", "custom_scripts"},
+		}))
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -68,24 +110,128 @@ func TestLicenseService(t *testing.T) {
 		if license.DeviceLimit != -1 {
 			t.Errorf("expected unlimited devices (-1), got %d", license.DeviceLimit)
 		}
+		if len(license.Features) != 2 || service.HasFeature("application_management") {
+			t.Errorf("expected the features of the key, got %v", license.Features)
+		}
 	})
 
 	t.Run("UpdateLicense with invalid key", func(t *testing.T) {
-		err := service.UpdateLicense("invalid-key")
+		err := service.UpdateLicense("enterprise-license")
 		if err == nil {
 			t.Fatalf("expected error for invalid license key")
 		}
+
+		other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		forged, _ := SignLicense(other, LicenseClaims{Tier: "enterprise", DeviceLimit: -1})
+		if err := service.UpdateLicense(forged); err == nil {
+			t.Errorf("expected error for license signed with another key")
+		}
+
+		if err := service.UpdateLicense(sign(LicenseClaims{Tier: "platinum", DeviceLimit: 5})); err == nil {
+			t.Errorf("expected error for unknown tier")
+		}
+
+		if err := service.UpdateLicense(expiring("professional", 100, time.Now().AddDate(0, -3, 0))); err == nil {
+			t.Errorf("expected error for license past its grace period")
+		}
+	})
+
+	t.Run("Expiry warnings and grace period", func(t *testing.T) {
+		service := NewLicenseServiceWithKey(&key.PublicKey)
+
+		if err := service.UpdateLicense(expiring("professional", 100, time.Now().AddDate(0, 0, 10))); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		license, _ := service.GetLicense()
+		if !license.Valid || len(license.Warnings) != 1 {
+			t.Errorf("expected a valid license with an expiry warning, got %+v", license)
+		}
+
+		if err := service.UpdateLicense(expiring("professional", 100, time.Now().AddDate(0, 0, -1))); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		license, _ = service.GetLicense()
+		if !license.Valid || !license.InGracePeriod || license.GracePeriodEndsAt == nil {
+			t.Errorf("expected license in its grace period, got %+v", license)
+		}
+		if !service.HasFeature("application_management") {
+			t.Errorf("expected features to keep working during the grace period")
+		}
+
+		// Past the grace period the community limits apply
+		service.GracePeriod = time.Hour
+		license, _ = service.GetLicense()
+		if license.Valid || license.InGracePeriod || license.DeviceLimit != 10 {
+			t.Errorf("expected expired license with community limits, got %+v", license)
+		}
+		if service.HasFeature("application_management") {
+			t.Errorf("expected paid features to be disabled")
+		}
+		if err := service.ValidateLicense(); err == nil {
+			t.Errorf("expected error validating expired license")
+		}
 	})
 
 	t.Run("ValidateLicense", func(t *testing.T) {
 		// Set to community license
-		service.UpdateLicense("community-license")
+		service.UpdateLicense(sign(LicenseClaims{Tier: "community", DeviceLimit: 10}))
 
 		err := service.ValidateLicense()
 		if err != nil {
 			t.Errorf("unexpected error validating community license: %v", err)
 		}
 	})
+
+	t.Run("Embedded public key", func(t *testing.T) {
+		if err := NewLicenseService().UpdateLicense(sign(LicenseClaims{Tier: "enterprise", DeviceLimit: -1})); err == nil {
+			t.Errorf("expected the embedded key to reject licenses it did not sign")
+		}
+	})
+
+	t.Run("Stored license keys survive a restart", func(t *testing.T) {
+		store := &memoryLicenseStore{}
+		fallback := sign(LicenseClaims{Tier: "professional", DeviceLimit: 50})
+
+		first := NewLicenseServiceWithKey(&key.PublicKey)
+		first.SetLicenseStore(store)
+		if err := first.LoadLicense(fallback); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if license, _ := first.GetLicense(); license.Tier != "professional" {
+			t.Errorf("expected the fallback key without a stored one, got tier '%s'", license.Tier)
+		}
+		if store.key != "" {
+			t.Errorf("expected the fallback key not to be stored")
+		}
+
+		if err := first.UpdateLicense(sign(LicenseClaims{Tier: "enterprise", DeviceLimit: -1})); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := first.UpdateLicense("invalid"); err == nil {
+			t.Errorf("expected error updating to an invalid key")
+		}
+
+		restarted := NewLicenseServiceWithKey(&key.PublicKey)
+		restarted.SetLicenseStore(store)
+		if err := restarted.LoadLicense(fallback); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if license, _ := restarted.GetLicense(); license.Tier != "enterprise" {
+			t.Errorf("expected the stored key to take precedence, got tier '%s'", license.Tier)
+		}
+	})
+}
+
+// memoryLicenseStore keeps a license key in memory
+type memoryLicenseStore struct {
+	key string
+}
+
+func (s *memoryLicenseStore) GetLicenseKey() (string, error) { return s.key, nil }
+
+func (s *memoryLicenseStore) SetLicenseKey(key string) error {
+	s.key = key
+	return nil
 }
 
 func TestDeviceService(t *testing.T) {
@@ -220,6 +366,77 @@ func TestDeviceService(t *testing.T) {
 		}
 	})
 
+	t.Run("ListDevices restricted to device IDs", func(t *testing.T) {
+		service := NewDeviceService()
+		device, _ := service.EnrollDevice(api.DeviceEnrollment{UUID: "in-scope", Hostname: "in-scope", Platform: "linux"})
+		service.EnrollDevice(api.DeviceEnrollment{UUID: "out-of-scope", Hostname: "out-of-scope", Platform: "linux"})
+
+		devices, total, err := service.ListDevices(api.DeviceFilters{Limit: 50, DeviceIDs: []string{device.ID}})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if total != 1 || len(devices) != 1 || devices[0].ID != device.ID {
+			t.Errorf("expected only the listed device, got total %d, devices %v", total, devices)
+		}
+
+		if _, total, _ := service.ListDevices(api.DeviceFilters{Limit: 50, DeviceIDs: []string{}}); total != 0 {
+			t.Errorf("expected no devices for an empty list, got %d", total)
+		}
+	})
+
+	t.Run("ListDevices pages in enrollment order", func(t *testing.T) {
+		service := NewDeviceService()
+		for _, uuid := range []string{"device-c", "device-a", "device-e", "device-b", "device-d"} {
+			service.EnrollDevice(api.DeviceEnrollment{UUID: uuid, Hostname: uuid, Platform: "linux"})
+		}
+		// Equal enrollment times are ordered by ID
+		service.devices["device-d"].EnrolledAt = service.devices["device-b"].EnrolledAt
+
+		var listed []*api.Device
+		for offset := 0; offset < 5; offset += 2 {
+			devices, total, err := service.ListDevices(api.DeviceFilters{Limit: 2, Offset: offset})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if total != 5 {
+				t.Fatalf("expected total 5, got %d", total)
+			}
+			listed = append(listed, devices...)
+		}
+
+		if len(listed) != 5 {
+			t.Fatalf("expected 5 devices across pages, got %d", len(listed))
+		}
+		for i := 1; i < len(listed); i++ {
+			prev, cur := listed[i-1], listed[i]
+			if cur.EnrolledAt.Before(prev.EnrolledAt) ||
+				(cur.EnrolledAt.Equal(prev.EnrolledAt) && cur.ID <= prev.ID) {
+				t.Errorf("device %s listed after %s out of enrollment order", cur.ID, prev.ID)
+			}
+		}
+	})
+
+	t.Run("CountDevices", func(t *testing.T) {
+		service := NewDeviceService()
+		service.EnrollDevice(api.DeviceEnrollment{UUID: "linux-1", Platform: "linux"})
+		service.EnrollDevice(api.DeviceEnrollment{UUID: "linux-2", Platform: "linux"})
+		service.EnrollDevice(api.DeviceEnrollment{UUID: "mac-1", Platform: "macos"})
+		service.devices["linux-2"].Status = "offline"
+
+		counts, err := service.CountDevices()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		want := []api.DeviceCount{
+			{Platform: "linux", Status: "offline", Count: 1},
+			{Platform: "linux", Status: "online", Count: 1},
+			{Platform: "macos", Status: "online", Count: 1},
+		}
+		if !reflect.DeepEqual(counts, want) {
+			t.Errorf("expected %v, got %v", want, counts)
+		}
+	})
+
 	t.Run("ListDevices with non-matching platform filter", func(t *testing.T) {
 		service := NewDeviceService()
 		enrollment := api.DeviceEnrollment{
@@ -312,93 +529,31 @@ func TestDeviceService(t *testing.T) {
 		}
 	})
 
-	t.Run("ExecuteCommand", func(t *testing.T) {
+	t.Run("EnrollDevice enforces the license device limit", func(t *testing.T) {
 		service := NewDeviceService()
-		enrollment := api.DeviceEnrollment{
-			UUID:             "test-device-uuid",
-			Hostname:         "test-workstation",
-			Platform:         "windows",
-			OSVersion:        "Windows 11",
-			EnrollmentSecret: "secret123",
-		}
-
-		// Enroll device
-		device, err := service.EnrollDevice(enrollment)
-		if err != nil {
-			t.Fatalf("unexpected error: %v", err)
-		}
-
-		// Set device to online status (simulate device check-in)
-		device.Status = "online"
-		service.devices[device.ID] = device
-
-		// Execute command
-		result, err := service.ExecuteCommand(device.ID, "restart", nil)
-		if err != nil {
-			t.Fatalf("unexpected error: %v", err)
-		}
+		license := NewLicenseService()
+		service.SetLicenseService(license)
 
-		if result.Command != "restart" {
-			t.Errorf("expected command 'restart', got '%s'", result.Command)
-		}
-		if result.Status != "completed" {
-			t.Errorf("expected status 'completed', got '%s'", result.Status)
+		for i := 0; i < 10; i++ {
+			if _, err := service.EnrollDevice(api.DeviceEnrollment{UUID: fmt.Sprintf("device-%d", i), Platform: "linux"}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
 		}
-
-		// Test with offline device
-		device.Status = "offline"
-		service.devices[device.ID] = device
-
-		_, err = service.ExecuteCommand(device.ID, "restart", nil)
-		if err == nil {
-			t.Errorf("expected error when executing command on offline device")
+		if _, err := service.EnrollDevice(api.DeviceEnrollment{UUID: "device-10", Platform: "linux"}); !errors.Is(err, api.ErrLicenseDeviceLimit) {
+			t.Fatalf("expected device limit error, got %v", err)
 		}
-	})
-
-	t.Run("ExecuteOSQuery", func(t *testing.T) {
-		service := NewDeviceService()
-		enrollment := api.DeviceEnrollment{
-			UUID:             "test-device-uuid",
-			Hostname:         "test-workstation",
-			Platform:         "linux",
-			OSVersion:        "Ubuntu 22.04",
-			EnrollmentSecret: "secret123",
+		if _, err := service.EnrollDevice(api.DeviceEnrollment{UUID: "device-0", Platform: "linux"}); err != nil {
+			t.Errorf("expected re-enrollment to be allowed, got %v", err)
 		}
 
-		// Enroll device
-		device, err := service.EnrollDevice(enrollment)
-		if err != nil {
-			t.Fatalf("unexpected error: %v", err)
+		if got, _ := license.GetLicense(); got.DevicesEnrolled != 10 {
+			t.Errorf("expected 10 enrolled devices, got %d", got.DevicesEnrolled)
 		}
-
-		// Set device to online status
-		device.Status = "online"
-		service.devices[device.ID] = device
-
-		// Execute OSQuery
-		query := "SELECT name, version, platform FROM osquery_info;"
-		result, err := service.ExecuteOSQuery(device.ID, query)
-		if err != nil {
+		if err := service.UnenrollDevice("device-0"); err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
-
-		if result.Query != query {
-			t.Errorf("expected query '%s', got '%s'", query, result.Query)
-		}
-		if len(result.Columns) == 0 {
-			t.Errorf("expected columns in result")
-		}
-		if len(result.Rows) == 0 {
-			t.Errorf("expected rows in result")
-		}
-
-		// Test with offline device
-		device.Status = "offline"
-		service.devices[device.ID] = device
-
-		_, err = service.ExecuteOSQuery(device.ID, query)
-		if err == nil {
-			t.Errorf("expected error when executing OSQuery on offline device")
+		if _, err := service.EnrollDevice(api.DeviceEnrollment{UUID: "device-10", Platform: "linux"}); err != nil {
+			t.Errorf("expected enrollment after unenrolling a device, got %v", err)
 		}
 	})
 
@@ -454,6 +609,308 @@ func TestDeviceService(t *testing.T) {
 	})
 }
 
+func TestDeviceFilters(t *testing.T) {
+	device := &api.Device{
+		ID:         "device-1",
+		Hostname:   "build-07.example.com",
+		Platform:   "macos",
+		OSVersion:  "14.2.1",
+		Status:     "online",
+		Labels:     map[string]string{"role": "ci"},
+		SystemInfo: map[string]string{"cpu_brand": "Apple M2", "memory_gb": "16"},
+	}
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{`platform == macos`, true},
+		{`platform == "MacOS"`, true},
+		{`platform != macos`, false},
+		{`hostname ~ "build-*"`, true},
+		{`hostname !~ "build-*"`, false},
+		{`os_version >= 14`, true},
+		{`os_version > "14.10"`, false},
+		{`system.memory_gb > 8`, true},
+		{`label.role in (ci, build)`, true},
+		{`label.role not in (ci, build)`, false},
+		{`label.env exists`, false},
+		{`label.env != prod`, true},
+		{`label.env < 1`, false},
+		{`system.cpu_brand ~ "apple*" && !(status == offline)`, true},
+		{`platform == windows || label.role == ci`, true},
+		{`platform == windows or not label.role == ci`, false},
+		{`platform == macos && (os_version < 13 || hostname ~ "build-*")`, true},
+	}
+	for _, tt := range tests {
+		filter, err := CompileDeviceFilter(tt.expr)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.expr, err)
+			continue
+		}
+		if got := filter.Match(device); got != tt.want {
+			t.Errorf("%s: expected %v, got %v", tt.expr, tt.want, got)
+		}
+	}
+
+	for _, expr := range []string{
+		``,
+		`platform`,
+		`platform ==`,
+		`serial == 123`,
+		`platform == macos &&`,
+		`(platform == macos`,
+		`label.role in ci`,
+		`hostname ~ "[build"`,
+		`hostname == "unterminated`,
+	} {
+		if _, err := CompileDeviceFilter(expr); err == nil {
+			t.Errorf("%q: expected compile error", expr)
+		}
+	}
+
+	t.Run("ExplainGroupMembership", func(t *testing.T) {
+		group := &api.DeviceGroup{ID: "group-1", Filters: map[string]string{
+			"platform": "macos",
+			"modern":   `os_version >= 15 || label.role == ci`,
+		}}
+
+		explanation := ExplainGroupMembership(group, device, false)
+		if !explanation.Dynamic || !explanation.Matched || explanation.Member {
+			t.Errorf("expected a matching non-member, got %+v", explanation)
+		}
+		if len(explanation.Rules) != 2 || explanation.Rules[0].Name != "modern" {
+			t.Fatalf("expected rules sorted by name, got %+v", explanation.Rules)
+		}
+		conditions := explanation.Rules[0].Conditions
+		if len(conditions) != 2 || conditions[0].Matched || !conditions[1].Matched {
+			t.Errorf("expected every condition to be explained, got %+v", conditions)
+		}
+		if conditions[0].Actual != "14.2.1" || !conditions[0].Present {
+			t.Errorf("expected the actual os_version, got %+v", conditions[0])
+		}
+	})
+}
+
+func TestDeviceGroupMembership(t *testing.T) {
+	linux := &api.Device{ID: "device-1", Platform: "linux", Labels: map[string]string{"env": "prod"}}
+	mac := &api.Device{ID: "device-2", Platform: "macos", Labels: map[string]string{"env": "prod"}}
+
+	t.Run("Dynamic groups follow their filters", func(t *testing.T) {
+		service := NewDeviceGroupService()
+		notifier := &membershipNotifier{}
+		service.SetWebSocketNotifier(notifier)
+
+		group, err := service.CreateDeviceGroup(api.DeviceGroupCreate{
+			Name:    "Production Linux",
+			Filters: map[string]string{"prod": `platform == linux && label.env == prod`},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if err := service.EvaluateGroupMembership(group.ID, []*api.Device{linux, mac}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got, _ := service.GetDeviceGroup(group.ID); got.DeviceCount != 1 {
+			t.Errorf("expected 1 member, got %d", got.DeviceCount)
+		}
+
+		// The device leaves the group once it stops matching
+		moved := *linux
+		moved.Labels = map[string]string{"env": "staging"}
+		if err := service.EvaluateDeviceMembership(&moved); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if groups, _ := service.GetDeviceGroups(linux.ID); len(groups) != 0 {
+			t.Errorf("expected device to leave the group, got %d groups", len(groups))
+		}
+
+		if err := service.EvaluateDeviceMembership(linux); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		want := []string{"added device-1", "removed device-1", "added device-1"}
+		if len(notifier.events) != len(want) {
+			t.Fatalf("expected events %v, got %v", want, notifier.events)
+		}
+		for i := range want {
+			if notifier.events[i] != want[i] {
+				t.Errorf("expected events %v, got %v", want, notifier.events)
+				break
+			}
+		}
+
+		if err := service.AddDeviceToGroup(group.ID, mac.ID); err == nil {
+			t.Errorf("expected error adding a device to a dynamic group by hand")
+		}
+		if err := service.RemoveDeviceFromGroup(group.ID, linux.ID); err == nil {
+			t.Errorf("expected error removing a device from a dynamic group by hand")
+		}
+
+		explanation, err := service.ExplainDeviceMembership(group.ID, mac)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if explanation.Matched || explanation.Member {
+			t.Errorf("expected mac not to match, got %+v", explanation)
+		}
+	})
+
+	t.Run("Manual groups are not evaluated", func(t *testing.T) {
+		service := NewDeviceGroupService()
+
+		group, err := service.CreateDeviceGroup(api.DeviceGroupCreate{Name: "Hand picked"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := service.AddDeviceToGroup(group.ID, mac.ID); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := service.EvaluateDeviceMembership(mac); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := service.EvaluateGroupMembership(group.ID, []*api.Device{linux}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got, _ := service.GetDeviceGroup(group.ID); got.DeviceCount != 1 {
+			t.Errorf("expected manual membership to be kept, got %d members", got.DeviceCount)
+		}
+	})
+
+	t.Run("Invalid filters are rejected", func(t *testing.T) {
+		service := NewDeviceGroupService()
+
+		if _, err := service.CreateDeviceGroup(api.DeviceGroupCreate{
+			Name:    "Broken",
+			Filters: map[string]string{"rule": "platform = linux"},
+		}); err == nil {
+			t.Errorf("expected error for invalid filter")
+		}
+
+		group, _ := service.CreateDeviceGroup(api.DeviceGroupCreate{Name: "Valid", Description: "Before"})
+		name, description := "Renamed", "After"
+		broken := map[string]string{"rule": "serial == 1"}
+		if _, err := service.UpdateDeviceGroup(group.ID, api.DeviceGroupUpdate{Name: &name, Description: &description, Filters: &broken}); err == nil {
+			t.Errorf("expected error for unknown field")
+		}
+
+		// A rejected update changes nothing
+		got, err := service.GetDeviceGroup(group.ID)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got.Name != "Valid" || got.Description != "Before" || len(got.Filters) != 0 || got.Revision != group.Revision {
+			t.Errorf("expected the group unchanged, got %+v", got)
+		}
+	})
+}
+
+// membershipNotifier records group membership events
+type membershipNotifier struct {
+	NoOpWebSocketNotifier
+	events []string
+}
+
+func (n *membershipNotifier) BroadcastGroupMembership(groupID, deviceID, action string) {
+	n.events = append(n.events, action+" "+deviceID)
+}
+
+func TestComplianceService(t *testing.T) {
+	t.Run("Results are folded and flips broadcast", func(t *testing.T) {
+		service := NewComplianceService()
+		notifier := &complianceNotifier{}
+		service.SetWebSocketNotifier(notifier)
+
+		reports := [][]api.PolicyResultReport{
+			{{PolicyID: "policy-1", Status: api.PolicyResultPass}},
+			{{PolicyID: "policy-1", Status: api.PolicyResultPass}},
+			{{PolicyID: "policy-1", Status: api.PolicyResultFail, Message: "disk not encrypted"}},
+		}
+		for _, r := range reports {
+			if _, err := service.RecordPolicyResults("device-1", r); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+
+		history, err := service.GetPolicyResultHistory("device-1", "policy-1")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(history) != 2 {
+			t.Fatalf("expected 2 history entries, got %d", len(history))
+		}
+		if history[0].Status != api.PolicyResultFail || history[1].Reports != 2 {
+			t.Errorf("expected newest failure first and folded passes, got %+v %+v", history[0], history[1])
+		}
+
+		want := []string{" -> pass", "pass -> fail"}
+		if len(notifier.events) != len(want) || notifier.events[0] != want[0] || notifier.events[1] != want[1] {
+			t.Errorf("expected events %v, got %v", want, notifier.events)
+		}
+	})
+
+	t.Run("Summaries", func(t *testing.T) {
+		service := NewComplianceService()
+		service.RecordPolicyResults("device-1", []api.PolicyResultReport{ //nolint:errcheck
+			{PolicyID: "policy-1", Status: api.PolicyResultPass},
+			{PolicyID: "policy-2", Status: api.PolicyResultPass},
+		})
+		service.RecordPolicyResults("device-2", []api.PolicyResultReport{ //nolint:errcheck
+			{PolicyID: "policy-1", Status: api.PolicyResultFail},
+			{PolicyID: "policy-2", Status: api.PolicyResultError},
+		})
+		service.RecordPolicyResults("device-3", []api.PolicyResultReport{ //nolint:errcheck
+			{PolicyID: "policy-2", Status: api.PolicyResultError},
+		})
+
+		fleet, err := service.GetComplianceSummary(api.ComplianceScope{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if fleet.Devices != 3 || fleet.Compliant != 1 || fleet.NonCompliant != 1 || fleet.Errored != 1 {
+			t.Errorf("unexpected fleet summary: %+v", fleet)
+		}
+		if len(fleet.Policies) != 2 || fleet.Policies[1].Error != 2 {
+			t.Errorf("unexpected policy counts: %+v", fleet.Policies)
+		}
+
+		policy, _ := service.GetComplianceSummary(api.ComplianceScope{PolicyID: "policy-1"})
+		if policy.Devices != 2 || policy.ComplianceRate != 0.5 {
+			t.Errorf("unexpected policy summary: %+v", policy)
+		}
+
+		group, _ := service.GetComplianceSummary(api.ComplianceScope{DeviceIDs: []string{"device-1"}})
+		if group.Devices != 1 || group.ComplianceRate != 1 {
+			t.Errorf("unexpected group summary: %+v", group)
+		}
+
+		empty, _ := service.GetComplianceSummary(api.ComplianceScope{DeviceIDs: []string{}})
+		if empty.Devices != 0 {
+			t.Errorf("expected empty summary for an empty group, got %+v", empty)
+		}
+	})
+
+	t.Run("Invalid results are rejected", func(t *testing.T) {
+		service := NewComplianceService()
+		if _, err := service.RecordPolicyResults("device-1", []api.PolicyResultReport{{PolicyID: "policy-1", Status: "ok"}}); err == nil {
+			t.Errorf("expected error for invalid status")
+		}
+		if _, err := service.RecordPolicyResults("device-1", []api.PolicyResultReport{{Status: api.PolicyResultPass}}); err == nil {
+			t.Errorf("expected error for missing policy_id")
+		}
+	})
+}
+
+// complianceNotifier records policy compliance flips
+type complianceNotifier struct {
+	NoOpWebSocketNotifier
+	events []string
+}
+
+func (n *complianceNotifier) BroadcastPolicyCompliance(policyID, deviceID, oldStatus, newStatus string) {
+	n.events = append(n.events, oldStatus+" -> "+newStatus)
+}
+
 func TestPolicyService(t *testing.T) {
 	service := NewPolicyService()
 
@@ -538,6 +995,34 @@ func TestPolicyService(t *testing.T) {
 		}
 	})
 
+	t.Run("UpdatePolicy with a revision", func(t *testing.T) {
+		policy, err := service.GetPolicy(policyID)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		revision := policy.Revision
+
+		description := "Only the current revision applies"
+		_, err = service.UpdatePolicy(policyID, api.PolicyUpdate{Description: &description, IfRevision: revision - 1})
+		if !errors.Is(err, api.ErrRevisionConflict) {
+			t.Fatalf("expected ErrRevisionConflict for a stale revision, got %v", err)
+		}
+		if policy, _ := service.GetPolicy(policyID); policy.Description == description || policy.Revision != revision {
+			t.Errorf("expected a conflicting update not to apply")
+		}
+
+		policy, err = service.UpdatePolicy(policyID, api.PolicyUpdate{Description: &description, IfRevision: revision})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if policy.Description != description {
+			t.Errorf("expected description '%s', got '%s'", description, policy.Description)
+		}
+		if policy.Revision != revision+1 {
+			t.Errorf("expected revision %d, got %d", revision+1, policy.Revision)
+		}
+	})
+
 	t.Run("AssignDevicePolicies", func(t *testing.T) {
 		deviceID := "test-device-1"
 		policyIDs := []string{policyID}
@@ -593,12 +1078,40 @@ func TestPolicyService(t *testing.T) {
 			t.Errorf("expected 0 policies after deletion, got %d", len(policies))
 		}
 	})
-}
 
-func TestApplicationService(t *testing.T) {
-	service := NewApplicationService()
+	t.Run("ListPolicies in creation order", func(t *testing.T) {
+		service := NewPolicyService()
+		var created []string
+		for _, name := range []string{"Third", "First", "Second"} {
+			policy, err := service.CreatePolicy(api.PolicyCreate{Name: name, Platform: "linux"})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			created = append(created, policy.ID)
+		}
 
-	t.Run("ListApplications empty initially", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			policies, err := service.ListPolicies()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for j, policy := range policies {
+				if policy.ID != created[j] {
+					t.Fatalf("expected policy %d to be %s, got %s", j, created[j], policy.ID)
+				}
+			}
+		}
+	})
+}
+
+func TestApplicationService(t *testing.T) {
+	packages, err := blobstore.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	service := NewApplicationService(packages)
+
+	t.Run("ListApplications empty initially", func(t *testing.T) {
 		apps, err := service.ListApplications()
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
@@ -615,7 +1128,8 @@ func TestApplicationService(t *testing.T) {
 			Name:     "Test Application",
 			Version:  "1.0.0",
 			Platform: "windows",
-			Package:  []byte("mock-binary-data"),
+			Filename: "uploads/test-app.bin",
+			Package:  strings.NewReader("mock-binary-data"),
 		}
 
 		app, err := service.AddApplication(appCreate)
@@ -627,11 +1141,60 @@ func TestApplicationService(t *testing.T) {
 		if app.Name != appCreate.Name {
 			t.Errorf("expected name '%s', got '%s'", appCreate.Name, app.Name)
 		}
-		if app.Size != int64(len(appCreate.Package)) {
-			t.Errorf("expected size %d, got %d", len(appCreate.Package), app.Size)
+		if app.Size != int64(len("mock-binary-data")) {
+			t.Errorf("expected size %d, got %d", len("mock-binary-data"), app.Size)
+		}
+		if app.Checksum != fmt.Sprintf("%x", sha256.Sum256([]byte("mock-binary-data"))) {
+			t.Errorf("expected checksum of the package, got %q", app.Checksum)
+		}
+		if app.Filename != "test-app.bin" {
+			t.Errorf("expected filename 'test-app.bin', got '%s'", app.Filename)
+		}
+	})
+
+	t.Run("OpenPackage", func(t *testing.T) {
+		rc, size, err := service.OpenPackage(appID)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer rc.Close()
+
+		content, err := io.ReadAll(rc)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if string(content) != "mock-binary-data" || size != int64(len(content)) {
+			t.Errorf("expected the uploaded package, got %q (size %d)", content, size)
+		}
+	})
+
+	t.Run("AddApplication rejects invalid applications", func(t *testing.T) {
+		_, err := service.AddApplication(api.ApplicationCreate{
+			Version:  "1.0.0",
+			Platform: "windows",
+			Package:  strings.NewReader("mock-binary-data"),
+		})
+		if !errors.Is(err, api.ErrInvalidApplication) {
+			t.Errorf("expected ErrInvalidApplication without a name, got %v", err)
+		}
+
+		_, err = service.AddApplication(api.ApplicationCreate{
+			Name:     "Test Application",
+			Version:  "1.0.0",
+			Platform: "beos",
+			Package:  strings.NewReader("mock-binary-data"),
+		})
+		if !errors.Is(err, api.ErrInvalidApplication) {
+			t.Errorf("expected ErrInvalidApplication for an unknown platform, got %v", err)
 		}
-		if app.Checksum == "" {
-			t.Errorf("expected checksum to be calculated")
+
+		_, err = service.AddApplication(api.ApplicationCreate{
+			Name:     "Test Application",
+			Version:  "1.0.0",
+			Platform: "windows",
+		})
+		if !errors.Is(err, api.ErrInvalidApplication) {
+			t.Errorf("expected ErrInvalidApplication without a package, got %v", err)
 		}
 	})
 
@@ -679,6 +1242,698 @@ func TestApplicationService(t *testing.T) {
 		if err == nil {
 			t.Fatalf("expected error for deleted application")
 		}
+
+		// The package is deleted with the application
+		if _, _, err := packages.Get(context.Background(), appID); !blobstore.IsNotFound(err) {
+			t.Errorf("expected package to be deleted, got %v", err)
+		}
+	})
+}
+
+func TestApplicationPublications(t *testing.T) {
+	packages, err := blobstore.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	service := NewApplicationService(packages)
+
+	app, err := service.AddApplication(api.ApplicationCreate{
+		Name:     "Test Application",
+		Version:  "1.0.0",
+		Platform: "linux",
+		Package:  strings.NewReader("mock-binary-data"),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := service.PublishApplication("missing", "group-1", false); err == nil {
+		t.Errorf("expected error publishing an unknown application")
+	}
+
+	if _, err := service.PublishApplication(app.ID, "group-1", false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := service.PublishApplication(app.ID, "group-2", false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Publishing again only changes whether the application is restricted
+	p, err := service.PublishApplication(app.ID, "group-1", true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !p.Restricted {
+		t.Errorf("expected publication to be restricted")
+	}
+
+	publications, err := service.ListApplicationPublications(app.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(publications) != 2 || publications[0].GroupID != "group-1" || !publications[0].Restricted || publications[1].Restricted {
+		t.Errorf("expected group-1 restricted and group-2 not, got %+v", publications)
+	}
+
+	if err := service.UnpublishApplication(app.ID, "group-2"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := service.UnpublishApplication(app.ID, "group-2"); err == nil {
+		t.Errorf("expected error unpublishing twice")
+	}
+
+	// Deleting the application removes its publications
+	if err := service.DeleteApplication(app.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	publications, err = service.ListPublications()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(publications) != 0 {
+		t.Errorf("expected no publications after delete, got %+v", publications)
+	}
+}
+
+func TestPrepareImport(t *testing.T) {
+	tests := []struct {
+		name      string
+		pkg       api.UpstreamPackage
+		platform  string
+		install   string
+		uninstall string
+		query     string
+	}{
+		{
+			name: "winget",
+			pkg: api.UpstreamPackage{ID: "winget:Mozilla.Firefox", Name: "Mozilla Firefox", Version: "131.0.2",
+				Platforms: []string{"windows"}, Install: api.UpstreamInstall{Manager: "winget", Identifier: "Mozilla.Firefox"}},
+			platform:  "windows",
+			install:   "winget install --id Mozilla.Firefox --exact --silent --accept-package-agreements --accept-source-agreements",
+			uninstall: "winget uninstall --id Mozilla.Firefox --exact --silent",
+			query:     `SELECT 1 FROM programs WHERE name LIKE 'Mozilla Firefox%' ESCAPE '\';`,
+		},
+		{
+			name: "brew cask",
+			pkg: api.UpstreamPackage{ID: "homebrew:cask/firefox", Name: "Mozilla Firefox", Version: "131.0.2",
+				Platforms: []string{"macos"}, Install: api.UpstreamInstall{Manager: "brew", Identifier: "firefox", Cask: true}},
+			platform:  "macos",
+			install:   "brew install --cask firefox",
+			uninstall: "brew uninstall --cask firefox",
+			query:     "SELECT 1 FROM homebrew_packages WHERE type = 'cask' AND name = 'firefox';",
+		},
+		{
+			name: "apt",
+			pkg: api.UpstreamPackage{ID: "apt:vlc", Name: "vlc", Version: "3.0.20-3build6",
+				Platforms: []string{"linux"}, Install: api.UpstreamInstall{Manager: "apt", Identifier: "vlc"}},
+			platform:  "linux",
+			install:   "apt-get install -y vlc",
+			uninstall: "apt-get remove -y vlc",
+			query:     "SELECT 1 FROM deb_packages WHERE name = 'vlc';",
+		},
+		{
+			name: "flatpak",
+			pkg: api.UpstreamPackage{ID: "flatpak:org.videolan.VLC", Name: "VLC", Version: "3.0.21",
+				Platforms: []string{"linux"}, Install: api.UpstreamInstall{Manager: "flatpak", Identifier: "org.videolan.VLC", Remote: "flathub"}},
+			platform:  "linux",
+			install:   "flatpak install -y --noninteractive --or-update flathub org.videolan.VLC",
+			uninstall: "flatpak uninstall -y --noninteractive org.videolan.VLC",
+			query:     "SELECT 1 FROM file WHERE path = '/var/lib/flatpak/app/org.videolan.VLC';",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, err := PrepareImport(api.ApplicationImport{Package: &tt.pkg})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if app.Platform != tt.platform || app.Version != tt.pkg.Version || app.PackageType != tt.pkg.Install.Manager ||
+				app.BundleID != tt.pkg.Install.Identifier || app.LatestVersion != tt.pkg.Version {
+				t.Errorf("unexpected application %+v", app)
+			}
+			if app.Source == nil || app.Source.PackageID != tt.pkg.ID || app.Source.Cask != tt.pkg.Install.Cask {
+				t.Errorf("unexpected source %+v", app.Source)
+			}
+			if app.InstallCommand != tt.install {
+				t.Errorf("install command = %q, want %q", app.InstallCommand, tt.install)
+			}
+			if app.UninstallCommand != tt.uninstall {
+				t.Errorf("uninstall command = %q, want %q", app.UninstallCommand, tt.uninstall)
+			}
+			if app.DetectionQuery != tt.query {
+				t.Errorf("detection query = %q, want %q", app.DetectionQuery, tt.query)
+			}
+		})
+	}
+
+	// Formulae of several platforms need one chosen
+	wget := api.UpstreamPackage{ID: "homebrew:wget", Name: "wget", Version: "1.24.5",
+		Platforms: []string{"linux", "macos"}, Install: api.UpstreamInstall{Manager: "brew", Identifier: "wget"}}
+	if _, err := PrepareImport(api.ApplicationImport{Package: &wget}); !errors.Is(err, api.ErrInvalidApplication) {
+		t.Errorf("expected ErrInvalidApplication without a platform, got %v", err)
+	}
+	if _, err := PrepareImport(api.ApplicationImport{Package: &wget, Platform: "windows"}); !errors.Is(err, api.ErrInvalidApplication) {
+		t.Errorf("expected ErrInvalidApplication for another platform, got %v", err)
+	}
+	app, err := PrepareImport(api.ApplicationImport{Package: &wget, Platform: "macos", Name: "GNU Wget"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if app.Platform != "macos" || app.Name != "GNU Wget" {
+		t.Errorf("expected the chosen platform and name, got %+v", app)
+	}
+
+	// Identifiers cannot carry options or shell syntax into the commands
+	for _, identifier := range []string{"--force", "vlc; rm -rf /", "vlc $(id)", ""} {
+		pkg := api.UpstreamPackage{ID: "apt:x", Name: "x", Version: "1", Platforms: []string{"linux"},
+			Install: api.UpstreamInstall{Manager: "apt", Identifier: identifier}}
+		if _, err := PrepareImport(api.ApplicationImport{Package: &pkg}); !errors.Is(err, api.ErrInvalidApplication) {
+			t.Errorf("expected identifier %q to be rejected, got %v", identifier, err)
+		}
+	}
+	unknown := api.UpstreamPackage{ID: "pacman:vlc", Name: "vlc", Version: "1", Platforms: []string{"linux"},
+		Install: api.UpstreamInstall{Manager: "pacman", Identifier: "vlc"}}
+	if _, err := PrepareImport(api.ApplicationImport{Package: &unknown}); !errors.Is(err, api.ErrInvalidApplication) {
+		t.Errorf("expected ErrInvalidApplication for an unknown package manager, got %v", err)
+	}
+}
+
+func TestApplicationImport(t *testing.T) {
+	packages, err := blobstore.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	service := NewApplicationService(packages)
+
+	app, err := service.ImportApplication(api.ApplicationImport{Package: &api.UpstreamPackage{
+		ID: "winget:VideoLAN.VLC", Name: "VLC media player", Version: "3.0.20", Platforms: []string{"windows"},
+		Install: api.UpstreamInstall{Manager: "winget", Identifier: "VideoLAN.VLC"},
+	}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if app.ID == "" || app.Revision != 1 || app.LatestVersionCheckedAt == nil || app.UpdateAvailable {
+		t.Errorf("unexpected imported application %+v", app)
+	}
+
+	// A newer upstream version is flagged, without changing the application
+	checkedAt := time.Now()
+	app, err = service.SetLatestVersion(app.ID, "3.0.21", checkedAt)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !app.UpdateAvailable || app.LatestVersion != "3.0.21" || !app.LatestVersionCheckedAt.Equal(checkedAt) || app.Revision != 1 {
+		t.Errorf("expected the update to be flagged, got %+v", app)
+	}
+	if _, err := service.SetLatestVersion("missing", "1.0", checkedAt); err == nil {
+		t.Errorf("expected error for an unknown application")
+	}
+
+	// Moving the application to the latest version clears the flag
+	version := "3.0.21"
+	app, err = service.UpdateApplication(app.ID, api.ApplicationUpdate{Version: &version})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if app.UpdateAvailable {
+		t.Errorf("expected no update after moving to the latest version")
+	}
+
+	// Imported applications have no package
+	if _, _, err := service.OpenPackage(app.ID); err == nil {
+		t.Errorf("expected no package for an imported application")
+	}
+	if err := service.DeleteApplication(app.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestApplicationRequestService(t *testing.T) {
+	service := NewApplicationRequestService()
+
+	req, err := service.CreateApplicationRequest(api.ApplicationRequestCreate{
+		ApplicationID: "app-1",
+		DeviceID:      "device-1",
+		Reason:        "Needed for the project",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if req.Status != api.AppRequestStatusPending {
+		t.Errorf("expected pending request, got %s", req.Status)
+	}
+
+	_, err = service.CreateApplicationRequest(api.ApplicationRequestCreate{ApplicationID: "app-1", DeviceID: "device-1"})
+	if !errors.Is(err, api.ErrApplicationRequestPending) {
+		t.Errorf("expected ErrApplicationRequestPending, got %v", err)
+	}
+	if _, err := service.CreateApplicationRequest(api.ApplicationRequestCreate{ApplicationID: "app-1", DeviceID: "device-2"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	requests, err := service.ListApplicationRequests("device-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(requests) != 1 || requests[0].ID != req.ID {
+		t.Errorf("expected the request of device-1, got %+v", requests)
+	}
+	requests, err = service.ListApplicationRequests("")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(requests) != 2 {
+		t.Errorf("expected 2 requests, got %d", len(requests))
+	}
+
+	if _, err := service.DecideApplicationRequest(req.ID, api.ApplicationRequestDecision{Status: "maybe"}); err == nil {
+		t.Errorf("expected error for an invalid decision")
+	}
+
+	decided, err := service.DecideApplicationRequest(req.ID, api.ApplicationRequestDecision{
+		Status:    api.AppRequestStatusApproved,
+		DecidedBy: "user-1",
+		Note:      "Approved",
+		CommandID: "cmd-1",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if decided.Status != api.AppRequestStatusApproved || decided.CommandID != "cmd-1" || decided.DecidedAt == nil {
+		t.Errorf("expected approved request with its command, got %+v", decided)
+	}
+
+	_, err = service.DecideApplicationRequest(req.ID, api.ApplicationRequestDecision{Status: api.AppRequestStatusDenied})
+	if !errors.Is(err, api.ErrApplicationRequestDecided) {
+		t.Errorf("expected ErrApplicationRequestDecided, got %v", err)
+	}
+
+	// Once decided, the device may request the application again
+	if _, err := service.CreateApplicationRequest(api.ApplicationRequestCreate{ApplicationID: "app-1", DeviceID: "device-1"}); err != nil {
+		t.Errorf("unexpected error requesting again: %v", err)
+	}
+}
+
+func TestURLSigner(t *testing.T) {
+	signer, err := NewURLSigner([]byte("test-key"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	path := "/api/v1/downloads/applications/app-1"
+	expiresAt := time.Now().Add(time.Hour)
+	signature := signer.Sign(path, expiresAt)
+
+	if err := signer.Verify(path, expiresAt, signature); err != nil {
+		t.Errorf("expected valid signature, got %v", err)
+	}
+	if err := signer.Verify("/api/v1/downloads/applications/app-2", expiresAt, signature); err == nil {
+		t.Errorf("expected error for a different path")
+	}
+	if err := signer.Verify(path, expiresAt.Add(time.Hour), signature); err == nil {
+		t.Errorf("expected error for a different expiry")
+	}
+
+	expired := time.Now().Add(-time.Minute)
+	if err := signer.Verify(path, expired, signer.Sign(path, expired)); err == nil {
+		t.Errorf("expected error for an expired signature")
+	}
+
+	other, err := NewURLSigner(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := other.Verify(path, expiresAt, signature); err == nil {
+		t.Errorf("expected error for a signature made with another key")
+	}
+}
+
+func TestCommandService(t *testing.T) {
+	devices := NewDeviceService()
+	device, err := devices.EnrollDevice(api.DeviceEnrollment{
+		UUID:     "test-device-uuid",
+		Hostname: "test-workstation",
+		Platform: "windows",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Commands are queued for offline devices
+	device.Status = "offline"
+	devices.devices[device.ID] = device
+
+	t.Run("Command lifecycle", func(t *testing.T) {
+		service := NewCommandService(devices)
+		notifier := &recordingNotifier{}
+		service.SetWebSocketNotifier(notifier)
+
+		cmd, err := service.EnqueueCommand(device.ID, api.CommandCreate{Command: "restart"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if cmd.Status != api.CommandStatusPending {
+			t.Errorf("expected status 'pending', got '%s'", cmd.Status)
+		}
+
+		fetched, err := service.FetchCommands(device.ID)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(fetched) != 1 || fetched[0].Status != api.CommandStatusDelivered {
+			t.Fatalf("expected one delivered command, got %+v", fetched)
+		}
+
+		// Unacknowledged commands are delivered again
+		fetched, _ = service.FetchCommands(device.ID)
+		if len(fetched) != 1 {
+			t.Errorf("expected unacknowledged command to be redelivered, got %d", len(fetched))
+		}
+
+		if _, err := service.AcknowledgeCommand("other-device", cmd.ID); err == nil {
+			t.Errorf("expected error acknowledging another device's command")
+		}
+		if _, err := service.AcknowledgeCommand(device.ID, cmd.ID); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if _, err := service.ReportCommandResult(device.ID, cmd.ID, api.CommandResultReport{Status: "running"}); err == nil {
+			t.Errorf("expected error for invalid result status")
+		}
+		done, err := service.ReportCommandResult(device.ID, cmd.ID, api.CommandResultReport{
+			Status: api.CommandStatusCompleted,
+			Result: map[string]interface{}{"uptime": 0},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if done.CompletedAt == nil || done.Result["uptime"] != 0 {
+			t.Errorf("expected completion to be recorded, got %+v", done)
+		}
+
+		if _, err := service.ReportCommandResult(device.ID, cmd.ID, api.CommandResultReport{Status: api.CommandStatusFailed}); err == nil {
+			t.Errorf("expected error reporting a finished command")
+		}
+
+		fetched, _ = service.FetchCommands(device.ID)
+		if len(fetched) != 0 {
+			t.Errorf("expected no outstanding commands, got %d", len(fetched))
+		}
+
+		expected := []string{"pending", "delivered", "acknowledged", "completed"}
+		if len(notifier.statuses) != len(expected) {
+			t.Fatalf("expected events %v, got %v", expected, notifier.statuses)
+		}
+		for i, status := range expected {
+			if notifier.statuses[i] != status {
+				t.Errorf("expected event %d to be '%s', got '%s'", i, status, notifier.statuses[i])
+			}
+		}
+	})
+
+	t.Run("Commands expire", func(t *testing.T) {
+		service := NewCommandService(devices)
+
+		cmd, err := service.EnqueueCommand(device.ID, api.CommandCreate{Command: "lock", TTL: time.Hour})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		service.commands[cmd.ID].ExpiresAt = time.Now().Add(-time.Second)
+
+		n, err := service.ExpireCommands()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if n != 1 {
+			t.Errorf("expected 1 expired command, got %d", n)
+		}
+
+		expired, _ := service.GetCommand(cmd.ID)
+		if expired.Status != api.CommandStatusExpired {
+			t.Errorf("expected status 'expired', got '%s'", expired.Status)
+		}
+		if _, err := service.AcknowledgeCommand(device.ID, cmd.ID); err == nil {
+			t.Errorf("expected error acknowledging an expired command")
+		}
+	})
+
+	t.Run("ListCommands", func(t *testing.T) {
+		service := NewCommandService(devices)
+
+		if _, err := service.EnqueueCommand("missing", api.CommandCreate{Command: "restart"}); err == nil {
+			t.Errorf("expected error for unknown device")
+		}
+		for _, name := range []string{"restart", "lock"} {
+			if _, err := service.EnqueueCommand(device.ID, api.CommandCreate{Command: name}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+
+		commands, err := service.ListCommands(api.CommandFilters{DeviceID: device.ID, Status: api.CommandStatusPending})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(commands) != 2 {
+			t.Errorf("expected 2 pending commands, got %d", len(commands))
+		}
+
+		counts, err := service.CountCommands()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if counts[api.CommandStatusPending] != 2 || len(counts) != 1 {
+			t.Errorf("expected 2 pending commands, got %v", counts)
+		}
+	})
+}
+
+// recordingNotifier records the statuses of command events
+type recordingNotifier struct {
+	NoOpWebSocketNotifier
+	statuses []string
+}
+
+func (n *recordingNotifier) BroadcastCommandExecution(commandID, deviceID, command, status, result string) {
+	n.statuses = append(n.statuses, status)
+}
+
+func TestLiveQueryService(t *testing.T) {
+	t.Run("Campaign lifecycle", func(t *testing.T) {
+		service := NewLiveQueryService()
+		notifier := &liveQueryNotifier{}
+		service.SetWebSocketNotifier(notifier)
+
+		campaign, err := service.StartCampaign(api.LiveQueryCreate{
+			Query:     "SELECT * FROM os_version",
+			DeviceIDs: []string{"device-1", "device-2", "device-1"},
+			CreatedBy: "admin-1",
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if campaign.DevicesTotal != 2 {
+			t.Errorf("expected duplicate devices to be targeted once, got %d", campaign.DevicesTotal)
+		}
+		if campaign.ExpiresAt.Sub(campaign.CreatedAt) != api.DefaultLiveQueryTimeout {
+			t.Errorf("expected default timeout, got %v", campaign.ExpiresAt.Sub(campaign.CreatedAt))
+		}
+
+		pending, _ := service.PendingQueries("device-1")
+		if len(pending) != 1 || pending[0].CampaignID != campaign.ID {
+			t.Fatalf("expected one pending query, got %+v", pending)
+		}
+
+		if _, err := service.SubmitResult(campaign.ID, "device-3", api.LiveQueryReport{}); err == nil {
+			t.Errorf("expected error for a device that was not targeted")
+		}
+		result, err := service.SubmitResult(campaign.ID, "device-1", api.LiveQueryReport{
+			Rows: []map[string]string{{"name": "Ubuntu"}},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result.Status != api.LiveQueryStatusCompleted || result.RespondedAt == nil {
+			t.Errorf("expected completed result, got %+v", result)
+		}
+		if _, err := service.SubmitResult(campaign.ID, "device-1", api.LiveQueryReport{}); err == nil {
+			t.Errorf("expected error for a second result from the same device")
+		}
+		if pending, _ := service.PendingQueries("device-1"); len(pending) != 0 {
+			t.Errorf("expected no pending queries after answering, got %d", len(pending))
+		}
+
+		if _, err := service.SubmitResult(campaign.ID, "device-2", api.LiveQueryReport{Error: "no such table"}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		done, _ := service.GetCampaign(campaign.ID)
+		if done.Status != api.LiveQueryStatusCompleted || done.DevicesResponded != 2 || done.CompletedAt == nil {
+			t.Errorf("expected completed campaign, got %+v", done)
+		}
+		if done.Results[1].Status != api.LiveQueryStatusFailed {
+			t.Errorf("expected failed result for device-2, got '%s'", done.Results[1].Status)
+		}
+
+		if len(notifier.results) != 2 || notifier.completed != 1 {
+			t.Errorf("expected 2 result events and 1 completed event, got %v and %d", notifier.results, notifier.completed)
+		}
+		if notifier.userID != "admin-1" {
+			t.Errorf("expected events for 'admin-1', got '%s'", notifier.userID)
+		}
+	})
+
+	t.Run("Campaigns time out", func(t *testing.T) {
+		service := NewLiveQueryService()
+		notifier := &liveQueryNotifier{}
+		service.SetWebSocketNotifier(notifier)
+
+		campaign, err := service.StartCampaign(api.LiveQueryCreate{
+			Query:     "SELECT * FROM uptime",
+			DeviceIDs: []string{"device-1", "device-2"},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := service.SubmitResult(campaign.ID, "device-1", api.LiveQueryReport{}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		service.campaigns[campaign.ID].ExpiresAt = time.Now().Add(-time.Second)
+
+		if pending, _ := service.PendingQueries("device-2"); len(pending) != 0 {
+			t.Errorf("expected expired campaign not to be pending, got %d", len(pending))
+		}
+
+		n, err := service.ExpireCampaigns()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if n != 1 {
+			t.Errorf("expected 1 timed out campaign, got %d", n)
+		}
+
+		expired, _ := service.GetCampaign(campaign.ID)
+		if expired.Status != api.LiveQueryStatusTimedOut || expired.Results[1].Status != api.LiveQueryStatusTimedOut {
+			t.Errorf("expected timed out campaign, got %+v", expired)
+		}
+		if _, err := service.SubmitResult(campaign.ID, "device-2", api.LiveQueryReport{}); err == nil {
+			t.Errorf("expected error reporting to a timed out campaign")
+		}
+		if notifier.completed != 1 {
+			t.Errorf("expected 1 completed event, got %d", notifier.completed)
+		}
+	})
+
+	t.Run("StartCampaign validation", func(t *testing.T) {
+		service := NewLiveQueryService()
+
+		if _, err := service.StartCampaign(api.LiveQueryCreate{DeviceIDs: []string{"device-1"}}); err == nil {
+			t.Errorf("expected error for empty query")
+		}
+		if _, err := service.StartCampaign(api.LiveQueryCreate{Query: "SELECT 1"}); err == nil {
+			t.Errorf("expected error for no devices")
+		}
+		if _, err := service.GetCampaign("missing"); err == nil {
+			t.Errorf("expected error for unknown campaign")
+		}
+	})
+}
+
+// liveQueryNotifier records live query events
+type liveQueryNotifier struct {
+	NoOpWebSocketNotifier
+	userID    string
+	results   []string
+	completed int
+}
+
+func (n *liveQueryNotifier) BroadcastLiveQueryResult(userID, campaignID, deviceID, status string, rows []map[string]string, errMsg string) {
+	n.userID = userID
+	n.results = append(n.results, status)
+}
+
+func (n *liveQueryNotifier) BroadcastLiveQueryCompleted(userID, campaignID, status string, responded, total int) {
+	n.completed++
+}
+
+func TestEnrollmentService(t *testing.T) {
+	service := NewEnrollmentService()
+
+	created, err := service.CreateEnrollmentSecret(api.EnrollmentSecretCreate{
+		Name:      "Engineering laptops",
+		GroupID:   "group-1",
+		CreatedBy: "admin-1",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if created.Secret == "" {
+		t.Fatalf("expected the secret value on creation")
+	}
+
+	stored, err := service.GetEnrollmentSecret(created.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stored.Secret != "" {
+		t.Errorf("expected the secret value to be hidden after creation")
+	}
+
+	validated, err := service.ValidateEnrollmentSecret(created.Secret)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if validated.GroupID != "group-1" {
+		t.Errorf("expected secret scoped to 'group-1', got '%s'", validated.GroupID)
+	}
+	if _, err := service.ValidateEnrollmentSecret("wrong-secret"); err == nil {
+		t.Errorf("expected error for an unknown secret")
+	}
+
+	t.Run("Rotation replaces the value", func(t *testing.T) {
+		rotated, err := service.RotateEnrollmentSecret(created.ID)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if rotated.Secret == created.Secret || rotated.RotatedAt == nil {
+			t.Errorf("expected a new secret value, got %+v", rotated)
+		}
+		if _, err := service.ValidateEnrollmentSecret(created.Secret); err == nil {
+			t.Errorf("expected error for the value before rotation")
+		}
+		if _, err := service.ValidateEnrollmentSecret(rotated.Secret); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("Expired secrets are rejected", func(t *testing.T) {
+		expiresAt := time.Now().Add(time.Hour)
+		secret, err := service.CreateEnrollmentSecret(api.EnrollmentSecretCreate{Name: "Short lived", ExpiresAt: &expiresAt})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		past := time.Now().Add(-time.Second)
+		service.secrets[secret.ID].ExpiresAt = &past
+
+		if _, err := service.ValidateEnrollmentSecret(secret.Secret); err == nil {
+			t.Errorf("expected error for an expired secret")
+		}
+	})
+
+	t.Run("DeleteEnrollmentSecret", func(t *testing.T) {
+		if err := service.DeleteEnrollmentSecret(created.ID); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := service.GetEnrollmentSecret(created.ID); err == nil {
+			t.Errorf("expected error for a deleted secret")
+		}
+		if err := service.DeleteEnrollmentSecret(created.ID); err == nil {
+			t.Errorf("expected error deleting a missing secret")
+		}
+
+		secrets, _ := service.ListEnrollmentSecrets()
+		if len(secrets) != 1 {
+			t.Errorf("expected 1 remaining secret, got %d", len(secrets))
+		}
 	})
 }
 
@@ -700,6 +1955,9 @@ func TestAuthService(t *testing.T) {
 		if authResp.User.Email != "admin@mobius.local" {
 			t.Errorf("expected email 'admin@mobius.local', got '%s'", authResp.User.Email)
 		}
+		if !authResp.User.MustChangePassword {
+			t.Errorf("expected the bootstrap admin to have to change its password")
+		}
 		if authResp.User.Role != "admin" {
 			t.Errorf("expected role 'admin', got '%s'", authResp.User.Role)
 		}
@@ -746,4 +2004,550 @@ func TestAuthService(t *testing.T) {
 			t.Fatalf("expected error for non-existent device token")
 		}
 	})
+
+	t.Run("Device tokens are re-keyed and revoked", func(t *testing.T) {
+		device := &api.Device{ID: "device-1", Hostname: "workstation-01"}
+
+		token, err := service.IssueDeviceToken(device)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		validated, err := service.ValidateDeviceToken(token)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if validated.ID != device.ID {
+			t.Errorf("expected device '%s', got '%s'", device.ID, validated.ID)
+		}
+
+		rotated, err := service.IssueDeviceToken(device)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := service.ValidateDeviceToken(token); err == nil {
+			t.Errorf("expected error for a replaced device token")
+		}
+
+		if err := service.RevokeDeviceToken(device.ID); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := service.ValidateDeviceToken(rotated); err == nil {
+			t.Errorf("expected error for a revoked device token")
+		}
+	})
+
+	t.Run("Refresh rotates the refresh token", func(t *testing.T) {
+		authResp, _ := service.Login("admin@mobius.local", "admin123")
+
+		refreshed, err := service.Refresh(authResp.RefreshToken)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if refreshed.RefreshToken == authResp.RefreshToken {
+			t.Errorf("expected refresh token to be rotated")
+		}
+		if _, err := service.Refresh(authResp.RefreshToken); err == nil {
+			t.Errorf("expected error when reusing a rotated refresh token")
+		}
+	})
+
+	t.Run("Logout revokes the session", func(t *testing.T) {
+		authResp, _ := service.Login("admin@mobius.local", "admin123")
+
+		if err := service.Logout(authResp.Token); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := service.ValidateToken(authResp.Token); err == nil {
+			t.Errorf("expected error for token of a logged out session")
+		}
+		if _, err := service.Refresh(authResp.RefreshToken); err == nil {
+			t.Errorf("expected error for refresh token of a logged out session")
+		}
+	})
+}
+
+func TestUserService(t *testing.T) {
+	service := NewAuthService()
+
+	t.Run("CreateUser validates input", func(t *testing.T) {
+		cases := []api.UserCreate{
+			{Email: "not-an-email", Role: "observer", Password: "correct-horse-9"},
+			{Email: "observer@example.com", Role: "superuser", Password: "correct-horse-9"},
+			{Email: "observer@example.com", Role: "observer", Password: "short"},
+			{Email: "admin@mobius.local", Role: "observer", Password: "correct-horse-9"},
+			{Email: "scoped@example.com", Role: "admin", DeviceGroupIDs: []string{"group-1"}, Password: "correct-horse-9"},
+		}
+		for _, c := range cases {
+			if _, err := service.CreateUser(c); err == nil {
+				t.Errorf("expected error creating %+v", c)
+			}
+		}
+	})
+
+	t.Run("CreateUser and Login", func(t *testing.T) {
+		user, err := service.CreateUser(api.UserCreate{
+			Email:    "observer@example.com",
+			Name:     "Observer",
+			Role:     "observer",
+			Password: "correct-horse-9",
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if string(service.passwords[user.ID]) == "correct-horse-9" {
+			t.Errorf("expected password to be hashed")
+		}
+
+		authResp, err := service.Login("observer@example.com", "correct-horse-9")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if authResp.User.Role != "observer" {
+			t.Errorf("expected role 'observer', got '%s'", authResp.User.Role)
+		}
+	})
+
+	t.Run("UpdateUser password change revokes sessions", func(t *testing.T) {
+		authResp, _ := service.Login("observer@example.com", "correct-horse-9")
+
+		password := "battery-staple-7"
+		if _, err := service.UpdateUser(authResp.User.ID, api.UserUpdate{Password: &password}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := service.ValidateToken(authResp.Token); err == nil {
+			t.Errorf("expected password change to revoke sessions")
+		}
+		if _, err := service.Login("observer@example.com", password); err != nil {
+			t.Errorf("expected login with new password, got %v", err)
+		}
+	})
+
+	t.Run("UpdateUser limits users to device groups", func(t *testing.T) {
+		authResp, _ := service.Login("observer@example.com", "battery-staple-7")
+
+		role := api.RoleDeviceTechnician
+		groups := []string{"group-1"}
+		user, err := service.UpdateUser(authResp.User.ID, api.UserUpdate{Role: &role, DeviceGroupIDs: &groups})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if user.Role != role || !user.IsScoped() {
+			t.Errorf("expected a device technician limited to group-1, got %+v", user)
+		}
+
+		admin := api.RoleAdmin
+		if _, err := service.UpdateUser(user.ID, api.UserUpdate{Role: &admin}); err == nil {
+			t.Errorf("expected error making a scoped user an admin")
+		}
+
+		none := []string{}
+		if user, err = service.UpdateUser(user.ID, api.UserUpdate{DeviceGroupIDs: &none}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if user.IsScoped() {
+			t.Errorf("expected user to no longer be limited to device groups")
+		}
+	})
+
+	t.Run("DeleteUser", func(t *testing.T) {
+		authResp, _ := service.Login("observer@example.com", "battery-staple-7")
+
+		if err := service.DeleteUser(authResp.User.ID); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := service.ValidateToken(authResp.Token); err == nil {
+			t.Errorf("expected error for token of a deleted user")
+		}
+		if err := service.DeleteUser(authResp.User.ID); err == nil {
+			t.Errorf("expected error deleting a missing user")
+		}
+	})
+}
+
+func TestRateLimitStore(t *testing.T) {
+	now := time.Now()
+	store := NewRateLimitStore()
+	store.now = func() time.Time { return now }
+
+	limiter, err := throttled.NewGCRARateLimiter(store, throttled.RateQuota{MaxRate: throttled.PerMin(3), MaxBurst: 2})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	limit := func(key string) bool {
+		t.Helper()
+		limited, _, err := limiter.RateLimit(key, 1)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return limited
+	}
+
+	t.Run("Burst", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			if limit("alice") {
+				t.Fatalf("expected request %d to be allowed", i+1)
+			}
+		}
+		if !limit("alice") {
+			t.Errorf("expected request beyond the burst to be limited")
+		}
+		if limit("bob") {
+			t.Errorf("expected another key to be allowed")
+		}
+	})
+
+	t.Run("Refill", func(t *testing.T) {
+		// One request is allowed again every 20 seconds
+		now = now.Add(20 * time.Second)
+		if limit("alice") {
+			t.Errorf("expected request to be allowed after the emission interval")
+		}
+		if !limit("alice") {
+			t.Errorf("expected second request to be limited")
+		}
+	})
+
+	t.Run("Expiry", func(t *testing.T) {
+		if v, _, _ := store.GetWithTime("missing"); v != -1 {
+			t.Errorf("expected -1 for a missing key, got %d", v)
+		}
+		if swapped, err := store.CompareAndSwapWithTTL("missing", 0, 1, time.Minute); err != nil || swapped {
+			t.Errorf("expected missing key not to be swapped, got %v, %v", swapped, err)
+		}
+
+		now = now.Add(2 * time.Minute)
+		if v, _, _ := store.GetWithTime("alice"); v != -1 {
+			t.Errorf("expected expired key to be gone, got %d", v)
+		}
+		if _, err := store.SetIfNotExistsWithTTL("carol", 1, time.Minute); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if n := store.Len(); n != 1 {
+			t.Errorf("expected expired keys to be swept, got %d keys", n)
+		}
+	})
+}
+
+func TestIdempotencyStore(t *testing.T) {
+	now := time.Now()
+	store := NewIdempotencyStore()
+	store.now = func() time.Time { return now }
+
+	claim := func(key, value string) (bool, string) {
+		t.Helper()
+		claimed, existing, err := store.Claim(key, []byte(value), time.Minute)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return claimed, string(existing)
+	}
+
+	t.Run("Claim", func(t *testing.T) {
+		if claimed, _ := claim("key-1", "pending"); !claimed {
+			t.Fatalf("expected a new key to be claimed")
+		}
+		if claimed, existing := claim("key-1", "other"); claimed || existing != "pending" {
+			t.Errorf("expected a held key to return its value, got %v, %q", claimed, existing)
+		}
+	})
+
+	t.Run("Save", func(t *testing.T) {
+		if err := store.Save("key-1", []byte("response"), time.Hour); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if claimed, existing := claim("key-1", "pending"); claimed || existing != "response" {
+			t.Errorf("expected the saved response, got %v, %q", claimed, existing)
+		}
+	})
+
+	t.Run("Release", func(t *testing.T) {
+		if err := store.Release("key-1"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if claimed, _ := claim("key-1", "retry"); !claimed {
+			t.Errorf("expected a released key to be claimed again")
+		}
+	})
+
+	t.Run("Expiry", func(t *testing.T) {
+		now = now.Add(2 * time.Minute)
+		if claimed, _ := claim("key-1", "later"); !claimed {
+			t.Errorf("expected an expired key to be claimed again")
+		}
+		claim("key-2", "pending")
+		now = now.Add(2 * time.Minute)
+		claim("key-3", "pending")
+		if n := store.Len(); n != 1 {
+			t.Errorf("expected expired keys to be swept, got %d keys", n)
+		}
+	})
+}
+
+func TestAuditService(t *testing.T) {
+	service := NewAuditService()
+	start := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	record := func(offset time.Duration, entry api.AuditEntry) {
+		t.Helper()
+		entry.Timestamp = start.Add(offset)
+		if err := service.RecordAudit(&entry); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	record(0, api.AuditEntry{ID: "a", Action: "auth.login", Outcome: api.AuditOutcomeSuccess, Actor: api.AuditActor{Type: api.AuditActorUser, ID: "u1"}})
+	record(2*time.Second, api.AuditEntry{ID: "c", Action: "policy.update", Outcome: api.AuditOutcomeSuccess, TargetType: "policy", TargetID: "p1", Actor: api.AuditActor{ID: "u1"}})
+	record(2*time.Second, api.AuditEntry{ID: "d", Action: "policy.delete", Outcome: api.AuditOutcomeSuccess, TargetType: "policy", TargetID: "p2", Actor: api.AuditActor{ID: "u2"}})
+	// Recorded late, listed in timestamp order
+	record(time.Second, api.AuditEntry{ID: "b", Action: "device.wipe", Outcome: api.AuditOutcomeSuccess, TargetType: "device", TargetID: "dev-1", Actor: api.AuditActor{ID: "u2"}})
+	record(3*time.Second, api.AuditEntry{ID: "e", Action: "access.denied", Outcome: api.AuditOutcomeDenied, Actor: api.AuditActor{ID: "u3"}})
+
+	ids := func(page *api.AuditPage) string {
+		var ids []string
+		for _, entry := range page.Entries {
+			ids = append(ids, entry.ID)
+		}
+		return strings.Join(ids, ",")
+	}
+
+	t.Run("Pages", func(t *testing.T) {
+		var got []string
+		cursor := ""
+		for pages := 0; ; pages++ {
+			if pages > 3 {
+				t.Fatalf("too many pages")
+			}
+			page, err := service.ListAuditEntries(api.AuditFilters{Limit: 2, Cursor: cursor})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got = append(got, ids(page))
+			if page.NextCursor == "" {
+				break
+			}
+			cursor = page.NextCursor
+		}
+		if strings.Join(got, "|") != "e,d|c,b|a" {
+			t.Errorf("expected newest first in pages of 2, got %v", got)
+		}
+	})
+
+	t.Run("Filters", func(t *testing.T) {
+		since := start.Add(time.Second)
+		until := start.Add(3 * time.Second)
+		for _, tc := range []struct {
+			filters api.AuditFilters
+			want    string
+		}{
+			{api.AuditFilters{ActorID: "u2"}, "d,b"},
+			{api.AuditFilters{Action: "policy."}, "d,c"},
+			{api.AuditFilters{Action: "policy"}, ""},
+			{api.AuditFilters{TargetType: "policy", TargetID: "p1"}, "c"},
+			{api.AuditFilters{Outcome: api.AuditOutcomeDenied}, "e"},
+			{api.AuditFilters{Since: &since, Until: &until}, "d,c,b"},
+		} {
+			page, err := service.ListAuditEntries(tc.filters)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := ids(page); got != tc.want {
+				t.Errorf("filters %+v: expected %q, got %q", tc.filters, tc.want, got)
+			}
+		}
+	})
+
+	t.Run("InvalidCursor", func(t *testing.T) {
+		for _, cursor := range []string{"not a cursor", "bm9jb2xvbg"} {
+			if _, err := service.ListAuditEntries(api.AuditFilters{Cursor: cursor}); !errors.Is(err, api.ErrInvalidAuditCursor) {
+				t.Errorf("cursor %q: expected ErrInvalidAuditCursor, got %v", cursor, err)
+			}
+		}
+	})
+
+	t.Run("Defaults", func(t *testing.T) {
+		entry := &api.AuditEntry{Action: "auth.logout"}
+		if err := service.RecordAudit(entry); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if entry.ID == "" || entry.Timestamp.IsZero() || entry.Timestamp.Location() != time.UTC {
+			t.Errorf("expected an ID and a UTC timestamp, got %+v", entry)
+		}
+	})
+}
+
+// recordingJSONLogger collects the entries written to it
+type recordingJSONLogger struct {
+	mu      sync.Mutex
+	batches [][]json.RawMessage
+}
+
+func (l *recordingJSONLogger) Write(ctx context.Context, logs []json.RawMessage) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.batches = append(l.batches, append([]json.RawMessage(nil), logs...))
+	return nil
+}
+
+func TestAuditForwarder(t *testing.T) {
+	store := NewAuditService()
+	logger := &recordingJSONLogger{}
+	forwarder := NewAuditForwarder(store, logger)
+
+	for _, action := range []string{"auth.login", "device.wipe"} {
+		if err := forwarder.RecordAudit(&api.AuditEntry{Action: action, Outcome: api.AuditOutcomeSuccess}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	// Stopping flushes the queued entries
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	forwarder.Run(ctx)
+
+	page, err := forwarder.ListAuditEntries(api.AuditFilters{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(page.Entries) != 2 {
+		t.Errorf("expected both entries to be stored, got %d", len(page.Entries))
+	}
+
+	if len(logger.batches) != 1 || len(logger.batches[0]) != 2 {
+		t.Fatalf("expected one batch of 2 entries, got %v", logger.batches)
+	}
+	var forwarded api.AuditEntry
+	if err := json.Unmarshal(logger.batches[0][1], &forwarded); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if forwarded.Action != "device.wipe" || forwarded.ID == "" {
+		t.Errorf("unexpected forwarded entry: %+v", forwarded)
+	}
+}
+
+func TestBulkOperationService(t *testing.T) {
+	t.Run("Results settle the status", func(t *testing.T) {
+		cases := []struct {
+			name     string
+			failures []string
+			want     string
+		}{
+			{"every device succeeded", []string{"", ""}, api.BulkStatusCompleted},
+			{"some devices failed", []string{"", "device not found"}, api.BulkStatusPartiallyFailed},
+			{"every device failed", []string{"device not found", "device not found"}, api.BulkStatusFailed},
+		}
+		for _, tc := range cases {
+			t.Run(tc.name, func(t *testing.T) {
+				service := NewBulkOperationService()
+				op, err := service.CreateBulkOperation(api.BulkOperationCreate{
+					Action:    api.BulkAction{Type: api.BulkActionCommand, Command: "restart"},
+					Total:     len(tc.failures),
+					CreatedBy: "admin-1",
+				})
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if op.Status != api.BulkStatusRunning {
+					t.Fatalf("expected running operation, got '%s'", op.Status)
+				}
+
+				for i, errMsg := range tc.failures {
+					if err := service.RecordBulkResult(op.ID, fmt.Sprintf("device-%d", i), errMsg); err != nil {
+						t.Fatalf("unexpected error: %v", err)
+					}
+				}
+				done, err := service.FinishBulkOperation(op.ID)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if done.Status != tc.want || done.Processed != len(tc.failures) || done.FinishedAt == nil {
+					t.Errorf("expected %s operation, got %+v", tc.want, done)
+				}
+				if done.Succeeded+done.Failed != done.Processed || len(done.Failures) != done.Failed {
+					t.Errorf("expected counts to add up, got %+v", done)
+				}
+			})
+		}
+	})
+
+	t.Run("Cancelled operations stay cancelled", func(t *testing.T) {
+		service := NewBulkOperationService()
+		op, _ := service.CreateBulkOperation(api.BulkOperationCreate{
+			Action: api.BulkAction{Type: api.BulkActionUnenroll},
+			Total:  3,
+		})
+		_ = service.RecordBulkResult(op.ID, "device-1", "")
+
+		cancelled, err := service.CancelBulkOperation(op.ID)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if cancelled.Status != api.BulkStatusCancelled || cancelled.FinishedAt == nil {
+			t.Errorf("expected cancelled operation, got %+v", cancelled)
+		}
+		if _, err := service.CancelBulkOperation(op.ID); !errors.Is(err, api.ErrBulkOperationFinished) {
+			t.Errorf("expected ErrBulkOperationFinished, got %v", err)
+		}
+
+		done, _ := service.FinishBulkOperation(op.ID)
+		if done.Status != api.BulkStatusCancelled || done.Processed != 1 {
+			t.Errorf("expected finishing to keep the cancellation, got %+v", done)
+		}
+	})
+
+	t.Run("Orphaned operations are interrupted", func(t *testing.T) {
+		service := NewBulkOperationService()
+		orphaned, _ := service.CreateBulkOperation(api.BulkOperationCreate{Action: api.BulkAction{Type: api.BulkActionUnenroll}, Total: 2})
+		finished, _ := service.CreateBulkOperation(api.BulkOperationCreate{Action: api.BulkAction{Type: api.BulkActionUnenroll}, Total: 1})
+		_ = service.RecordBulkResult(finished.ID, "device-1", "")
+		_, _ = service.FinishBulkOperation(finished.ID)
+		time.Sleep(time.Millisecond)
+		before := time.Now()
+		time.Sleep(time.Millisecond)
+		active, _ := service.CreateBulkOperation(api.BulkOperationCreate{Action: api.BulkAction{Type: api.BulkActionUnenroll}, Total: 2})
+
+		n, err := service.InterruptBulkOperations(before)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if n != 1 {
+			t.Errorf("expected 1 interrupted operation, got %d", n)
+		}
+		for id, want := range map[string]string{
+			orphaned.ID: api.BulkStatusInterrupted,
+			finished.ID: api.BulkStatusCompleted,
+			active.ID:   api.BulkStatusRunning,
+		} {
+			if op, _ := service.GetBulkOperation(id); op.Status != want {
+				t.Errorf("expected operation %s to be %s, got %s", id, want, op.Status)
+			}
+		}
+		if _, err := service.CancelBulkOperation(orphaned.ID); !errors.Is(err, api.ErrBulkOperationFinished) {
+			t.Errorf("expected ErrBulkOperationFinished, got %v", err)
+		}
+	})
+
+	t.Run("Lists newest first without failures", func(t *testing.T) {
+		service := NewBulkOperationService()
+		first, _ := service.CreateBulkOperation(api.BulkOperationCreate{Action: api.BulkAction{Type: api.BulkActionUnenroll}, Total: 1})
+		_ = service.RecordBulkResult(first.ID, "device-1", "device not found")
+		time.Sleep(time.Millisecond)
+		second, _ := service.CreateBulkOperation(api.BulkOperationCreate{Action: api.BulkAction{Type: api.BulkActionUnenroll}, Total: 1})
+
+		operations, err := service.ListBulkOperations()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(operations) != 2 || operations[0].ID != second.ID || operations[1].ID != first.ID {
+			t.Fatalf("expected newest operation first, got %+v", operations)
+		}
+		if operations[1].Failed != 1 || operations[1].Failures != nil {
+			t.Errorf("expected failure count without failures, got %+v", operations[1])
+		}
+
+		if _, err := service.GetBulkOperation("missing"); err == nil {
+			t.Errorf("expected error for unknown operation")
+		}
+		if err := service.RecordBulkResult("missing", "device-1", ""); err == nil {
+			t.Errorf("expected error for unknown operation")
+		}
+	})
 }
@@ -0,0 +1,197 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/mail"
+	"time"
+	"unicode"
+
+	"github.com/golang-jwt/jwt/v4"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/notawar/mobius/mobius-server/api"
+)
+
+// Default token lifetimes
+const (
+	DefaultAccessTokenTTL  = 15 * time.Minute
+	DefaultRefreshTokenTTL = 7 * 24 * time.Hour
+)
+
+// ValidRoles lists the user roles accepted by the user store
+var ValidRoles = map[string]bool{
+	api.RoleAdmin:            true,
+	api.RoleMaintainer:       true,
+	api.RoleObserver:         true,
+	api.RoleDeviceTechnician: true,
+}
+
+// AccessClaims are the claims carried by a signed user access token
+type AccessClaims struct {
+	SessionID string `json:"sid"`
+	Role      string `json:"role"`
+	jwt.RegisteredClaims
+}
+
+// TokenIssuer signs and verifies user access tokens
+type TokenIssuer struct {
+	key        []byte
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+}
+
+// NewTokenIssuer creates a token issuer using key for HMAC signing. A random
+// key is generated when key is empty, which invalidates tokens on restart.
+func NewTokenIssuer(key []byte) (*TokenIssuer, error) {
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, fmt.Errorf("generate signing key: %w", err)
+		}
+	}
+	return &TokenIssuer{
+		key:        key,
+		AccessTTL:  DefaultAccessTokenTTL,
+		RefreshTTL: DefaultRefreshTokenTTL,
+	}, nil
+}
+
+// IssueAccessToken returns a signed access token for the user's session
+func (t *TokenIssuer) IssueAccessToken(user *api.User, sessionID string) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(t.AccessTTL)
+	claims := AccessClaims{
+		SessionID: sessionID,
+		Role:      user.Role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   user.ID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(t.key)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("sign access token: %w", err)
+	}
+	return signed, expiresAt, nil
+}
+
+// ParseAccessToken verifies the signature and expiry of an access token
+func (t *TokenIssuer) ParseAccessToken(token string) (*AccessClaims, error) {
+	claims := &AccessClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(tok *jwt.Token) (interface{}, error) {
+		if _, ok := tok.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method %v", tok.Header["alg"])
+		}
+		return t.key, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid token: %w", err)
+	}
+	if claims.Subject == "" || claims.SessionID == "" {
+		return nil, errors.New("invalid token: missing subject or session")
+	}
+	return claims, nil
+}
+
+// NewRefreshToken returns a random opaque refresh token and the hash to store
+func NewRefreshToken() (token, hash string, err error) {
+	return newOpaqueToken("refresh token")
+}
+
+// NewDeviceToken returns a random opaque device token and the hash to store
+func NewDeviceToken() (token, hash string, err error) {
+	return newOpaqueToken("device token")
+}
+
+// NewEnrollmentSecret returns a random enrollment secret value and the hash to store
+func NewEnrollmentSecret() (secret, hash string, err error) {
+	return newOpaqueToken("enrollment secret")
+}
+
+func newOpaqueToken(kind string) (token, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", fmt.Errorf("generate %s: %w", kind, err)
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, HashToken(token), nil
+}
+
+// HashToken returns the storage hash of an opaque token
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// HashPassword returns the bcrypt hash of a password
+func HashPassword(password string) ([]byte, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrPasswordTooLong) {
+			return nil, errors.New("password is over the 72 byte limit")
+		}
+		return nil, err
+	}
+	return hash, nil
+}
+
+// CheckPassword compares a bcrypt hash with a plaintext password
+func CheckPassword(hash []byte, password string) error {
+	return bcrypt.CompareHashAndPassword(hash, []byte(password))
+}
+
+// ValidatePasswordRequirements checks the provided password against the following requirements:
+// at least 12 character length
+// at least 1 symbol
+// at least 1 number
+func ValidatePasswordRequirements(password string) error {
+	var (
+		number bool
+		symbol bool
+	)
+
+	for _, s := range password {
+		switch {
+		case unicode.IsNumber(s):
+			number = true
+		case unicode.IsPunct(s) || unicode.IsSymbol(s):
+			symbol = true
+		}
+	}
+
+	if len(password) >= 12 && number && symbol {
+		return nil
+	}
+
+	return errors.New("password must include 12 characters, at least 1 number and at least 1 symbol")
+}
+
+// ValidateUserCreate checks the fields of a new user account
+func ValidateUserCreate(create api.UserCreate) error {
+	if _, err := mail.ParseAddress(create.Email); err != nil {
+		return fmt.Errorf("invalid email address")
+	}
+	if err := ValidateUserRole(create.Role, create.DeviceGroupIDs); err != nil {
+		return err
+	}
+	return ValidatePasswordRequirements(create.Password)
+}
+
+// ValidateUserRole checks a role and the device groups the user is limited
+// to. Admins manage users and cannot be limited to device groups.
+func ValidateUserRole(role string, deviceGroupIDs []string) error {
+	if !ValidRoles[role] {
+		return fmt.Errorf("invalid role %q", role)
+	}
+	if role == api.RoleAdmin && len(deviceGroupIDs) > 0 {
+		return fmt.Errorf("admin users cannot be limited to device groups")
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// Bus carries events between the hubs of every API server replica. Each hub
+// publishes the events of its process and delivers the events it consumes to
+// its own clients. Delivery is at most once: events published while a hub is
+// not subscribed, or that it cannot keep up with, are lost.
+type Bus interface {
+	// Publish sends an event to every subscribed hub, including this one
+	Publish(ctx context.Context, event Event) error
+	// Subscribe calls handle with every published event until ctx is done or
+	// the subscription fails. handle must not block.
+	Subscribe(ctx context.Context, handle func(Event)) error
+}
+
+// MemoryBus is a Bus within a single process, for single-node deployments
+type MemoryBus struct {
+	mu       sync.RWMutex
+	handlers map[int]func(Event)
+	next     int
+}
+
+// NewMemoryBus creates an in-memory bus
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{handlers: make(map[int]func(Event))}
+}
+
+// Publish hands the event to every subscriber
+func (b *MemoryBus) Publish(ctx context.Context, event Event) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, handle := range b.handlers {
+		handle(event)
+	}
+	return nil
+}
+
+// Subscribe delivers events to handle until ctx is done
+func (b *MemoryBus) Subscribe(ctx context.Context, handle func(Event)) error {
+	b.mu.Lock()
+	id := b.next
+	b.next++
+	b.handlers[id] = handle
+	b.mu.Unlock()
+
+	<-ctx.Done()
+
+	b.mu.Lock()
+	delete(b.handlers, id)
+	b.mu.Unlock()
+	return ctx.Err()
+}
+
+// busMessage is an event as it travels between processes, keeping the
+// fields that route it
+type busMessage struct {
+	Type      EventType       `json:"type"`
+	Timestamp time.Time       `json:"timestamp"`
+	Data      json.RawMessage `json:"data"`
+	UserID    string          `json:"user_id,omitempty"`
+	DeviceID  string          `json:"device_id,omitempty"`
+	GroupID   string          `json:"group_id,omitempty"`
+}
+
+func encodeEvent(event Event) ([]byte, error) {
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(busMessage{
+		Type:      event.Type,
+		Timestamp: event.Timestamp,
+		Data:      data,
+		UserID:    event.userID,
+		DeviceID:  event.deviceID,
+		GroupID:   event.groupID,
+	})
+}
+
+func decodeEvent(b []byte) (Event, error) {
+	var msg busMessage
+	if err := json.Unmarshal(b, &msg); err != nil {
+		return Event{}, err
+	}
+	return Event{
+		Type:      msg.Type,
+		Timestamp: msg.Timestamp,
+		Data:      msg.Data,
+		userID:    msg.UserID,
+		deviceID:  msg.DeviceID,
+		groupID:   msg.GroupID,
+	}, nil
+}
+
+// Reasons events are dropped, in HubStats
+const (
+	// DropOutbox means the queue of events to publish was full
+	DropOutbox = "outbox"
+	// DropPublish means the bus failed to publish the event
+	DropPublish = "publish"
+	// DropInbox means the queue of events consumed from the bus was full
+	DropInbox = "inbox"
+	// DropClient means a client was too slow and was disconnected
+	DropClient = "client"
+)
+
+// LagBuckets are the upper bounds, in seconds, of the bus lag histogram
+var LagBuckets = []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5}
+
+// HubStats counts the events of a hub since it started
+type HubStats struct {
+	Published uint64
+	Received  uint64
+	Dropped   map[string]uint64
+	// Lag is the time from the creation of the events to their receipt from
+	// the bus: cumulative counts per LagBuckets bound, and their sum and count
+	LagBuckets map[float64]uint64
+	LagSum     float64
+	LagCount   uint64
+}
+
+// hubStats accumulates HubStats
+type hubStats struct {
+	mu         sync.Mutex
+	published  uint64
+	received   uint64
+	dropped    map[string]uint64
+	lagBuckets []uint64
+	lagSum     float64
+	lagCount   uint64
+}
+
+func newHubStats() *hubStats {
+	return &hubStats{
+		dropped:    make(map[string]uint64),
+		lagBuckets: make([]uint64, len(LagBuckets)),
+	}
+}
+
+func (s *hubStats) publish() {
+	s.mu.Lock()
+	s.published++
+	s.mu.Unlock()
+}
+
+func (s *hubStats) receive(lag time.Duration) {
+	seconds := lag.Seconds()
+	if seconds < 0 {
+		// Clocks of other replicas may run ahead
+		seconds = 0
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.received++
+	s.lagSum += seconds
+	s.lagCount++
+	for i, bound := range LagBuckets {
+		if seconds <= bound {
+			s.lagBuckets[i]++
+		}
+	}
+}
+
+func (s *hubStats) drop(reason string) {
+	s.mu.Lock()
+	s.dropped[reason]++
+	s.mu.Unlock()
+}
+
+func (s *hubStats) snapshot() HubStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := HubStats{
+		Published:  s.published,
+		Received:   s.received,
+		Dropped:    make(map[string]uint64, len(s.dropped)),
+		LagBuckets: make(map[float64]uint64, len(LagBuckets)),
+		LagSum:     s.lagSum,
+		LagCount:   s.lagCount,
+	}
+	for reason, n := range s.dropped {
+		stats.Dropped[reason] = n
+	}
+	for i, bound := range LagBuckets {
+		stats.LagBuckets[bound] = s.lagBuckets[i]
+	}
+	return stats
+}
@@ -2,8 +2,14 @@ package websocket
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -18,13 +24,42 @@ const (
 	EventPolicyAssignment   EventType = "policy_assignment"
 	EventCommandExecution   EventType = "command_execution"
 	EventGroupMembership    EventType = "group_membership"
+	EventLiveQueryResult    EventType = "live_query_result"
+	EventLiveQueryCompleted EventType = "live_query_completed"
+	EventPolicyCompliance   EventType = "policy_compliance"
 )
 
+// historySize bounds the events buffered for clients that resume
+const historySize = 1024
+
 // Event represents a real-time event to be broadcast
 type Event struct {
 	Type      EventType   `json:"type"`
 	Timestamp time.Time   `json:"timestamp"`
 	Data      interface{} `json:"data"`
+
+	// Seq numbers the events of the hub's stream in order
+	Seq uint64 `json:"seq,omitempty"`
+	// ResumeToken resumes the stream after this event on reconnection
+	ResumeToken string `json:"resume_token,omitempty"`
+
+	// userID restricts delivery to the clients of one user when set
+	userID string
+
+	// deviceID and groupID are what the event is about, for filtering
+	deviceID string
+	groupID  string
+}
+
+func newEvent(eventType EventType, data interface{}) Event {
+	deviceID, groupID := subject(data)
+	return Event{
+		Type:      eventType,
+		Timestamp: time.Now(),
+		Data:      data,
+		deviceID:  deviceID,
+		groupID:   groupID,
+	}
 }
 
 // DeviceStatusChangeData represents device status change event data
@@ -47,7 +82,7 @@ type CommandExecutionData struct {
 	CommandID string `json:"command_id"`
 	DeviceID  string `json:"device_id"`
 	Command   string `json:"command"`
-	Status    string `json:"status"` // "executing", "completed", "failed"
+	Status    string `json:"status"` // "pending", "delivered", "acknowledged", "completed", "failed", "expired"
 	Result    string `json:"result,omitempty"`
 }
 
@@ -58,6 +93,31 @@ type GroupMembershipData struct {
 	Action   string `json:"action"` // "added" or "removed"
 }
 
+// LiveQueryResultData represents the result of a live query on one device
+type LiveQueryResultData struct {
+	CampaignID string              `json:"campaign_id"`
+	DeviceID   string              `json:"device_id"`
+	Status     string              `json:"status"` // "completed", "failed" or "timed_out"
+	Rows       []map[string]string `json:"rows,omitempty"`
+	Error      string              `json:"error,omitempty"`
+}
+
+// LiveQueryCompletedData represents the end of a live query campaign
+type LiveQueryCompletedData struct {
+	CampaignID       string `json:"campaign_id"`
+	Status           string `json:"status"` // "completed" or "timed_out"
+	DevicesResponded int    `json:"devices_responded"`
+	DevicesTotal     int    `json:"devices_total"`
+}
+
+// PolicyComplianceData represents a change in the result a device reports for a policy
+type PolicyComplianceData struct {
+	PolicyID  string `json:"policy_id"`
+	DeviceID  string `json:"device_id"`
+	OldStatus string `json:"old_status"` // empty for the first result
+	NewStatus string `json:"new_status"` // "pass", "fail" or "error"
+}
+
 // Client represents a WebSocket client connection
 type Client struct {
 	ID       string
@@ -66,49 +126,120 @@ type Client struct {
 	Hub      *Hub
 	Send     chan Event
 	UserRole string // "admin", "user", etc.
+
+	// access limits the events the client may receive; nil allows all
+	access Access
+
+	// control carries replies to the client's messages
+	control chan Event
+
+	// resumeToken is the position the client asked to resume from
+	resumeToken string
+
+	mu            sync.Mutex
+	subscriptions map[string]Filter
 }
 
-// Hub maintains the set of active clients and broadcasts messages to the clients
+// registration is a client joining the hub, answered with the events it
+// missed since its resume token
+type registration struct {
+	client *Client
+	reply  chan registered
+}
+
+type registered struct {
+	connected ConnectedData
+	replay    []Event
+}
+
+// Hub maintains the set of active clients and broadcasts messages to the
+// clients. Events are published on a Bus and delivered by the hub of every
+// replica to its own clients.
 type Hub struct {
 	// Registered clients
 	clients map[*Client]bool
 
-	// Inbound messages from the clients
+	// bus carries events between replicas; outbox queues the events of this
+	// process for it
+	bus    Bus
+	outbox chan Event
+
+	// Events consumed from the bus, to deliver to the clients
 	broadcast chan Event
 
 	// Register requests from the clients
-	register chan *Client
+	register chan registration
 
 	// Unregister requests from clients
 	unregister chan *Client
 
+	// Health checks, answered by the Run loop
+	ping chan struct{}
+
+	// streamID identifies this hub's sequence of events in resume tokens, so
+	// that tokens of another process are not mistaken for its own
+	streamID string
+
+	// seq is the sequence number of the last event, and history the latest
+	// events; both are owned by the Run loop
+	seq     uint64
+	history []Event
+
+	stats *hubStats
+
 	// Mutex for thread-safe operations
 	mutex sync.RWMutex
 }
 
-// NewHub creates a new WebSocket hub
+// NewHub creates a new WebSocket hub for a single node
 func NewHub() *Hub {
+	return NewHubWithBus(NewMemoryBus())
+}
+
+// NewHubWithBus creates a WebSocket hub exchanging events with the hubs of
+// other replicas over bus
+func NewHubWithBus(bus Bus) *Hub {
 	return &Hub{
 		clients:    make(map[*Client]bool),
+		bus:        bus,
+		outbox:     make(chan Event, 256),
 		broadcast:  make(chan Event, 256),
-		register:   make(chan *Client),
+		register:   make(chan registration),
 		unregister: make(chan *Client),
+		ping:       make(chan struct{}),
+		streamID:   newStreamID(),
+		stats:      newHubStats(),
 	}
 }
 
+func newStreamID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b)
+}
+
 // Run starts the hub and listens for client events
 func (h *Hub) Run(ctx context.Context) {
 	log.Println("WebSocket hub started")
 	defer log.Println("WebSocket hub stopped")
 
+	go h.publish(ctx)
+	go h.consume(ctx)
+
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case client := <-h.register:
+		case <-h.ping:
+		case reg := <-h.register:
+			client := reg.client
+			connected, replay := h.replaySince(client)
 			h.mutex.Lock()
 			h.clients[client] = true
 			h.mutex.Unlock()
+			reg.reply <- registered{connected: connected, replay: replay}
 			log.Printf("Client %s connected", client.ID)
 
 		case client := <-h.unregister:
@@ -121,35 +252,184 @@ func (h *Hub) Run(ctx context.Context) {
 			h.mutex.Unlock()
 
 		case event := <-h.broadcast:
+			h.seq++
+			event.Seq = h.seq
+			event.ResumeToken = h.resumeToken(h.seq)
+			h.history = append(h.history, event)
+			if len(h.history) > historySize {
+				h.history = h.history[len(h.history)-historySize:]
+			}
+
+			var slow []*Client
 			h.mutex.RLock()
 			for client := range h.clients {
+				if event.userID != "" && client.UserID != event.userID {
+					continue
+				}
 				select {
 				case client.Send <- event:
 				default:
-					close(client.Send)
-					delete(h.clients, client)
+					slow = append(slow, client)
 				}
 			}
 			h.mutex.RUnlock()
+
+			// Clients too slow to keep up are removed under the write lock,
+			// as GetClientCount may read the clients meanwhile
+			if len(slow) > 0 {
+				h.mutex.Lock()
+				for _, client := range slow {
+					delete(h.clients, client)
+					close(client.Send)
+					h.stats.drop(DropClient)
+				}
+				h.mutex.Unlock()
+			}
 		}
 	}
 }
 
-// BroadcastEvent sends an event to all connected clients
+// BroadcastEvent sends an event to the connected clients that may see it
+// and, if they subscribed, whose subscriptions select it
 func (h *Hub) BroadcastEvent(eventType string, data interface{}) {
-	event := Event{
-		Type:      EventType(eventType),
-		Timestamp: time.Now(),
-		Data:      data,
+	h.enqueue(newEvent(EventType(eventType), data))
+}
+
+// SendEventToUser sends an event to the connected clients of one user
+func (h *Hub) SendEventToUser(userID, eventType string, data interface{}) {
+	event := newEvent(EventType(eventType), data)
+	event.userID = userID
+	h.enqueue(event)
+}
+
+// enqueue queues an event for the bus without blocking the caller
+func (h *Hub) enqueue(event Event) {
+	select {
+	case h.outbox <- event:
+	default:
+		h.stats.drop(DropOutbox)
+		log.Println("Warning: WebSocket outbox full, dropping event")
+	}
+}
+
+// publish sends the queued events to the bus
+func (h *Hub) publish(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-h.outbox:
+			if err := h.bus.Publish(ctx, event); err != nil {
+				h.stats.drop(DropPublish)
+				log.Printf("Failed to publish WebSocket event: %v", err)
+				continue
+			}
+			h.stats.publish()
+		}
+	}
+}
+
+// consume subscribes to the bus until ctx is done, subscribing again with a
+// growing delay when the subscription fails. Events published meanwhile are
+// lost.
+func (h *Hub) consume(ctx context.Context) {
+	delay := time.Second
+	for {
+		start := time.Now()
+		err := h.bus.Subscribe(ctx, h.receive)
+		if ctx.Err() != nil {
+			return
+		}
+		if time.Since(start) > time.Minute {
+			delay = time.Second
+		}
+		log.Printf("WebSocket bus subscription failed, retrying in %s: %v", delay, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		if delay < 30*time.Second {
+			delay *= 2
+		}
 	}
+}
 
+// receive hands an event from the bus to the Run loop without blocking the bus
+func (h *Hub) receive(event Event) {
+	h.stats.receive(time.Since(event.Timestamp))
 	select {
 	case h.broadcast <- event:
 	default:
+		h.stats.drop(DropInbox)
 		log.Println("Warning: Broadcast channel full, dropping event")
 	}
 }
 
+// Stats returns the event counts of the hub
+func (h *Hub) Stats() HubStats {
+	return h.stats.snapshot()
+}
+
+// resumeToken returns the token resuming the stream after event seq
+func (h *Hub) resumeToken(seq uint64) string {
+	return h.streamID + ":" + strconv.FormatUint(seq, 10)
+}
+
+// replaySince returns the buffered events a client missed since its resume
+// token. Called from the Run loop, so that no event falls between the
+// replay and live delivery.
+func (h *Hub) replaySince(client *Client) (ConnectedData, []Event) {
+	connected := ConnectedData{ClientID: client.ID, ResumeToken: h.resumeToken(h.seq)}
+	if client.resumeToken == "" {
+		return connected, nil
+	}
+
+	after, err := h.parseResumeToken(client.resumeToken)
+	if err != nil || after > h.seq {
+		// A token of another process, or of a hub that restarted
+		connected.Missed = true
+		return connected, nil
+	}
+	connected.ResumeToken = client.resumeToken
+
+	var replay []Event
+	if len(h.history) > 0 && h.history[0].Seq > after+1 {
+		connected.Missed = true
+		connected.ResumeToken = h.resumeToken(h.history[0].Seq - 1)
+	}
+	for _, event := range h.history {
+		if event.Seq <= after {
+			continue
+		}
+		if event.userID != "" && event.userID != client.UserID {
+			continue
+		}
+		replay = append(replay, event)
+	}
+	connected.Replayed = len(replay)
+	return connected, replay
+}
+
+func (h *Hub) parseResumeToken(token string) (uint64, error) {
+	streamID, seq, ok := strings.Cut(token, ":")
+	if !ok || streamID != h.streamID {
+		return 0, fmt.Errorf("unknown resume token")
+	}
+	return strconv.ParseUint(seq, 10, 64)
+}
+
+// HealthCheckContext checks that the Run loop is serving the hub
+func (h *Hub) HealthCheckContext(ctx context.Context) error {
+	select {
+	case h.ping <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return errors.New("hub is not running")
+	}
+}
+
 // GetClientCount returns the number of connected clients
 func (h *Hub) GetClientCount() int {
 	h.mutex.RLock()
@@ -167,8 +447,10 @@ var upgrader = websocket.Upgrader{
 	WriteBufferSize: 1024,
 }
 
-// HandleWebSocket handles WebSocket connection requests
-func (h *Hub) HandleWebSocket(w http.ResponseWriter, r *http.Request, userID, userRole string) {
+// HandleWebSocket handles WebSocket connection requests. access limits the
+// events the client may receive and subscribe to; nil allows all. A
+// resume_token query parameter replays the buffered events after it.
+func (h *Hub) HandleWebSocket(w http.ResponseWriter, r *http.Request, userID, userRole string, access Access) {
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Printf("WebSocket upgrade error: %v", err)
@@ -177,18 +459,24 @@ func (h *Hub) HandleWebSocket(w http.ResponseWriter, r *http.Request, userID, us
 
 	clientID := generateClientID()
 	client := &Client{
-		ID:       clientID,
-		UserID:   userID,
-		Conn:     conn,
-		Hub:      h,
-		Send:     make(chan Event, 256),
-		UserRole: userRole,
+		ID:            clientID,
+		UserID:        userID,
+		Conn:          conn,
+		Hub:           h,
+		Send:          make(chan Event, 256),
+		UserRole:      userRole,
+		access:        access,
+		control:       make(chan Event, 16),
+		resumeToken:   r.URL.Query().Get("resume_token"),
+		subscriptions: make(map[string]Filter),
 	}
 
-	client.Hub.register <- client
+	reply := make(chan registered, 1)
+	client.Hub.register <- registration{client: client, reply: reply}
+	reg := <-reply
 
 	// Start goroutines for reading and writing
-	go client.writePump()
+	go client.writePump(reg.connected, reg.replay)
 	go client.readPump()
 }
 
@@ -199,7 +487,7 @@ func (c *Client) readPump() {
 		c.Conn.Close()
 	}()
 
-	c.Conn.SetReadLimit(512)
+	c.Conn.SetReadLimit(4096)
 	c.Conn.SetReadDeadline(time.Now().Add(60 * time.Second))
 	c.Conn.SetPongHandler(func(string) error {
 		c.Conn.SetReadDeadline(time.Now().Add(60 * time.Second))
@@ -207,38 +495,60 @@ func (c *Client) readPump() {
 	})
 
 	for {
-		_, _, err := c.Conn.ReadMessage()
+		_, message, err := c.Conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Printf("WebSocket error: %v", err)
 			}
 			break
 		}
-		// For now, we don't process incoming messages from clients
-		// This could be extended for client-to-server commands
+		c.handleMessage(message)
 	}
 }
 
-// writePump pumps messages from the hub to the websocket connection
-func (c *Client) writePump() {
+// writePump pumps messages from the hub to the websocket connection,
+// starting with the connected message and the replayed events
+func (c *Client) writePump(connected ConnectedData, replay []Event) {
 	ticker := time.NewTicker(54 * time.Second)
 	defer func() {
 		ticker.Stop()
 		c.Conn.Close()
 	}()
 
+	write := func(event Event) bool {
+		c.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		if err := c.Conn.WriteJSON(event); err != nil {
+			log.Printf("WebSocket write error: %v", err)
+			return false
+		}
+		return true
+	}
+
+	if !write(newEvent(EventConnected, connected)) {
+		return
+	}
+	for _, event := range replay {
+		if c.wants(event) && !write(event) {
+			return
+		}
+	}
+
 	for {
 		select {
 		case event, ok := <-c.Send:
-			c.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
 			if !ok {
+				c.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
 				c.Conn.WriteMessage(websocket.CloseMessage, []byte{})
 				return
 			}
 
 			// Send the event as JSON
-			if err := c.Conn.WriteJSON(event); err != nil {
-				log.Printf("WebSocket write error: %v", err)
+			if c.wants(event) && !write(event) {
+				return
+			}
+
+		case event := <-c.control:
+			if !write(event) {
 				return
 			}
 
@@ -265,6 +575,9 @@ type EventPublisher interface {
 	PublishPolicyAssignment(policyID, deviceID, groupID, action string)
 	PublishCommandExecution(commandID, deviceID, command, status, result string)
 	PublishGroupMembership(groupID, deviceID, action string)
+	PublishLiveQueryResult(userID string, data LiveQueryResultData)
+	PublishLiveQueryCompleted(userID string, data LiveQueryCompletedData)
+	PublishPolicyCompliance(data PolicyComplianceData)
 }
 
 // HubEventPublisher implements EventPublisher using the WebSocket hub
@@ -319,3 +632,80 @@ func (p *HubEventPublisher) PublishGroupMembership(groupID, deviceID, action str
 	}
 	p.hub.BroadcastEvent(string(EventGroupMembership), data)
 }
+
+// PublishLiveQueryResult sends a live query result to the user who started the campaign
+func (p *HubEventPublisher) PublishLiveQueryResult(userID string, data LiveQueryResultData) {
+	p.hub.SendEventToUser(userID, string(EventLiveQueryResult), data)
+}
+
+// PublishLiveQueryCompleted tells the user who started a campaign that it has finished
+func (p *HubEventPublisher) PublishLiveQueryCompleted(userID string, data LiveQueryCompletedData) {
+	p.hub.SendEventToUser(userID, string(EventLiveQueryCompleted), data)
+}
+
+// PublishPolicyCompliance publishes a policy compliance change event
+func (p *HubEventPublisher) PublishPolicyCompliance(data PolicyComplianceData) {
+	p.hub.BroadcastEvent(string(EventPolicyCompliance), data)
+}
+
+// ServiceNotifier adapts an EventPublisher to the notifier interface used by
+// the API services, so that service changes are broadcast on the hub
+type ServiceNotifier struct {
+	publisher EventPublisher
+}
+
+// NewServiceNotifier creates a notifier that publishes events on hub
+func NewServiceNotifier(hub *Hub) *ServiceNotifier {
+	return &ServiceNotifier{publisher: NewEventPublisher(hub)}
+}
+
+// BroadcastDeviceStatusChange publishes a device status change event
+func (n *ServiceNotifier) BroadcastDeviceStatusChange(deviceID, oldStatus, newStatus string) {
+	n.publisher.PublishDeviceStatusChange(deviceID, oldStatus, newStatus)
+}
+
+// BroadcastPolicyAssignment publishes a policy assignment event
+func (n *ServiceNotifier) BroadcastPolicyAssignment(policyID, deviceID, groupID, action string) {
+	n.publisher.PublishPolicyAssignment(policyID, deviceID, groupID, action)
+}
+
+// BroadcastCommandExecution publishes a command execution event
+func (n *ServiceNotifier) BroadcastCommandExecution(commandID, deviceID, command, status, result string) {
+	n.publisher.PublishCommandExecution(commandID, deviceID, command, status, result)
+}
+
+// BroadcastGroupMembership publishes a group membership change event
+func (n *ServiceNotifier) BroadcastGroupMembership(groupID, deviceID, action string) {
+	n.publisher.PublishGroupMembership(groupID, deviceID, action)
+}
+
+// BroadcastLiveQueryResult sends a live query result to the user who started the campaign
+func (n *ServiceNotifier) BroadcastLiveQueryResult(userID, campaignID, deviceID, status string, rows []map[string]string, errMsg string) {
+	n.publisher.PublishLiveQueryResult(userID, LiveQueryResultData{
+		CampaignID: campaignID,
+		DeviceID:   deviceID,
+		Status:     status,
+		Rows:       rows,
+		Error:      errMsg,
+	})
+}
+
+// BroadcastLiveQueryCompleted tells the user who started a campaign that it has finished
+func (n *ServiceNotifier) BroadcastLiveQueryCompleted(userID, campaignID, status string, responded, total int) {
+	n.publisher.PublishLiveQueryCompleted(userID, LiveQueryCompletedData{
+		CampaignID:       campaignID,
+		Status:           status,
+		DevicesResponded: responded,
+		DevicesTotal:     total,
+	})
+}
+
+// BroadcastPolicyCompliance publishes a policy compliance change event
+func (n *ServiceNotifier) BroadcastPolicyCompliance(policyID, deviceID, oldStatus, newStatus string) {
+	n.publisher.PublishPolicyCompliance(PolicyComplianceData{
+		PolicyID:  policyID,
+		DeviceID:  deviceID,
+		OldStatus: oldStatus,
+		NewStatus: newStatus,
+	})
+}
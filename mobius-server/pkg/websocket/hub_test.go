@@ -0,0 +1,245 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// testEvent is an event as clients receive it
+type testEvent struct {
+	Type        EventType       `json:"type"`
+	Data        json.RawMessage `json:"data"`
+	Seq         uint64          `json:"seq"`
+	ResumeToken string          `json:"resume_token"`
+}
+
+// startHub runs a hub until the test ends and serves its websocket
+func startHub(t *testing.T, hub *Hub) *httptest.Server {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go hub.Run(ctx)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hub.HandleWebSocket(w, r, "user-1", "admin", nil)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// connect opens a websocket to server, resuming from token when given, and
+// returns it with its connected message
+func connect(t *testing.T, server *httptest.Server, token string) (*websocket.Conn, ConnectedData) {
+	t.Helper()
+
+	u := "ws" + strings.TrimPrefix(server.URL, "http")
+	if token != "" {
+		u += "?resume_token=" + url.QueryEscape(token)
+	}
+	conn, _, err := websocket.DefaultDialer.Dial(u, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	var connected ConnectedData
+	readEvent(t, conn, EventConnected, &connected)
+	return conn, connected
+}
+
+// readEvent reads the next event of a connection, expecting eventType, and
+// decodes its data into v
+func readEvent(t *testing.T, conn *websocket.Conn, eventType EventType, v interface{}) testEvent {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var event testEvent
+	if err := conn.ReadJSON(&event); err != nil {
+		t.Fatalf("unexpected error reading %s event: %v", eventType, err)
+	}
+	if event.Type != eventType {
+		t.Fatalf("expected %s event, got %s: %s", eventType, event.Type, event.Data)
+	}
+	if v != nil {
+		if err := json.Unmarshal(event.Data, v); err != nil {
+			t.Fatalf("unexpected error decoding %s: %v", event.Data, err)
+		}
+	}
+	return event
+}
+
+// subscribeTo subscribes a connection to f and waits for the acknowledgement
+func subscribeTo(t *testing.T, conn *websocket.Conn, id string, f Filter) {
+	t.Helper()
+
+	if err := conn.WriteJSON(clientMessage{Type: MessageSubscribe, ID: id, Filter: f}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var ack SubscriptionData
+	readEvent(t, conn, EventSubscribed, &ack)
+	if ack.ID != id {
+		t.Fatalf("expected subscription %s, got %s", id, ack.ID)
+	}
+}
+
+func TestFilterMatches(t *testing.T) {
+	groups := func() []string { return []string{"group-1"} }
+	event := newEvent(EventDeviceStatusChange, DeviceStatusChangeData{DeviceID: "device-1", NewStatus: "online"})
+
+	for _, tc := range []struct {
+		name   string
+		filter Filter
+		want   bool
+	}{
+		{"empty", Filter{}, true},
+		{"event type", Filter{EventTypes: []EventType{EventDeviceStatusChange}}, true},
+		{"other event type", Filter{EventTypes: []EventType{EventCommandExecution}}, false},
+		{"device", Filter{DeviceIDs: []string{"device-2", "device-1"}}, true},
+		{"other device", Filter{DeviceIDs: []string{"device-2"}}, false},
+		{"group of the device", Filter{GroupIDs: []string{"group-1"}}, true},
+		{"other group", Filter{GroupIDs: []string{"group-2"}}, false},
+		{"event type and other device", Filter{EventTypes: []EventType{EventDeviceStatusChange}, DeviceIDs: []string{"device-2"}}, false},
+	} {
+		if got := tc.filter.matches(event, groups); got != tc.want {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestSubscriptionFilter(t *testing.T) {
+	hub := NewHub()
+	server := startHub(t, hub)
+	conn, _ := connect(t, server, "")
+	subscribeTo(t, conn, "device-1", Filter{
+		EventTypes: []EventType{EventDeviceStatusChange},
+		DeviceIDs:  []string{"device-1"},
+	})
+
+	// Events reach the client in order, so the matching event arriving
+	// first means the others were filtered out
+	hub.BroadcastEvent(string(EventDeviceStatusChange), DeviceStatusChangeData{DeviceID: "device-2", NewStatus: "offline"})
+	hub.BroadcastEvent(string(EventCommandExecution), CommandExecutionData{CommandID: "command-1", DeviceID: "device-1"})
+	hub.BroadcastEvent(string(EventDeviceStatusChange), DeviceStatusChangeData{DeviceID: "device-1", NewStatus: "online"})
+
+	var data DeviceStatusChangeData
+	readEvent(t, conn, EventDeviceStatusChange, &data)
+	if data.DeviceID != "device-1" || data.NewStatus != "online" {
+		t.Errorf("expected device-1 online, got %+v", data)
+	}
+
+	if err := conn.WriteJSON(clientMessage{Type: MessageUnsubscribe, ID: "device-1"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	readEvent(t, conn, EventUnsubscribed, nil)
+
+	// Without subscriptions the client receives every event again
+	hub.BroadcastEvent(string(EventDeviceStatusChange), DeviceStatusChangeData{DeviceID: "device-2", NewStatus: "offline"})
+	readEvent(t, conn, EventDeviceStatusChange, &data)
+	if data.DeviceID != "device-2" {
+		t.Errorf("expected device-2, got %+v", data)
+	}
+}
+
+func TestSubscriptionRejected(t *testing.T) {
+	server := startHub(t, NewHub())
+	conn, _ := connect(t, server, "")
+
+	if err := conn.WriteJSON(clientMessage{Type: MessageSubscribe, ID: "bad", Filter: Filter{EventTypes: []EventType{"unknown"}}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var data ErrorData
+	readEvent(t, conn, EventError, &data)
+	if data.ID != "bad" || !strings.Contains(data.Message, "unknown event type") {
+		t.Errorf("expected an unknown event type error, got %+v", data)
+	}
+}
+
+func TestResume(t *testing.T) {
+	hub := NewHub()
+	server := startHub(t, hub)
+	conn, connected := connect(t, server, "")
+	if connected.ResumeToken == "" || connected.Missed {
+		t.Fatalf("expected a resume token, got %+v", connected)
+	}
+
+	for _, deviceID := range []string{"device-1", "device-2", "device-3"} {
+		hub.BroadcastEvent(string(EventDeviceStatusChange), DeviceStatusChangeData{DeviceID: deviceID, NewStatus: "online"})
+	}
+	var tokens []string
+	for i := 0; i < 3; i++ {
+		event := readEvent(t, conn, EventDeviceStatusChange, nil)
+		if event.Seq != uint64(i+1) {
+			t.Errorf("expected seq %d, got %d", i+1, event.Seq)
+		}
+		tokens = append(tokens, event.ResumeToken)
+	}
+	conn.Close()
+
+	// Resuming after the first event replays the two after it
+	conn, connected = connect(t, server, tokens[0])
+	if connected.ResumeToken != tokens[0] || connected.Replayed != 2 || connected.Missed {
+		t.Errorf("expected 2 events replayed from %s, got %+v", tokens[0], connected)
+	}
+	for _, deviceID := range []string{"device-2", "device-3"} {
+		var data DeviceStatusChangeData
+		readEvent(t, conn, EventDeviceStatusChange, &data)
+		if data.DeviceID != deviceID {
+			t.Errorf("expected %s, got %s", deviceID, data.DeviceID)
+		}
+	}
+
+	// Live events follow the replay
+	hub.BroadcastEvent(string(EventDeviceStatusChange), DeviceStatusChangeData{DeviceID: "device-4", NewStatus: "online"})
+	if event := readEvent(t, conn, EventDeviceStatusChange, nil); event.Seq != 4 {
+		t.Errorf("expected seq 4, got %d", event.Seq)
+	}
+
+	// Resuming from the third event replays only the live one
+	_, connected = connect(t, server, tokens[2])
+	if connected.Replayed != 1 || connected.Missed {
+		t.Errorf("expected 1 event replayed, got %+v", connected)
+	}
+
+	// A token of another hub cannot be resumed
+	_, connected = connect(t, server, NewHub().resumeToken(1))
+	if !connected.Missed || connected.Replayed != 0 {
+		t.Errorf("expected missed events, got %+v", connected)
+	}
+}
+
+func TestSlowClientDropped(t *testing.T) {
+	hub := NewHub()
+	startHub(t, hub)
+
+	// A client that never reads its events
+	slow := &Client{ID: "slow", UserID: "user-1", Hub: hub, Send: make(chan Event), subscriptions: make(map[string]Filter)}
+	reply := make(chan registered, 1)
+	hub.register <- registration{client: slow, reply: reply}
+	<-reply
+
+	// Events are broadcast until one reaches the hub, which may not have
+	// subscribed to its bus yet
+	deadline := time.Now().Add(5 * time.Second)
+	for hub.GetClientCount() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the slow client to be dropped")
+		}
+		hub.BroadcastEvent(string(EventDeviceStatusChange), DeviceStatusChangeData{DeviceID: "device-1", NewStatus: "online"})
+		time.Sleep(time.Millisecond)
+	}
+	if _, ok := <-slow.Send; ok {
+		t.Error("expected the events of the slow client to be closed")
+	}
+	if dropped := hub.Stats().Dropped[DropClient]; dropped != 1 {
+		t.Errorf("expected 1 client dropped, got %d", dropped)
+	}
+}
@@ -0,0 +1,106 @@
+package websocket
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	redigo "github.com/gomodule/redigo/redis"
+
+	"github.com/notawar/mobius/mobius-server/server/datastore/redis"
+	"github.com/notawar/mobius/mobius-server/server/mobius"
+)
+
+// DefaultRedisChannel is the pub/sub channel of the events
+const DefaultRedisChannel = "mobius:websocket:events"
+
+// redisPingInterval is how often an idle subscription checks its connection
+const redisPingInterval = 30 * time.Second
+
+// RedisBus is a Bus over Redis pub/sub, shared by the replicas using the
+// same Redis and channel
+type RedisBus struct {
+	pool    mobius.RedisPool
+	channel string
+}
+
+// NewRedisBus creates a bus publishing on channel, DefaultRedisChannel when empty
+func NewRedisBus(pool mobius.RedisPool, channel string) *RedisBus {
+	if channel == "" {
+		channel = DefaultRedisChannel
+	}
+	return &RedisBus{pool: pool, channel: channel}
+}
+
+// Publish sends the event to the hubs subscribed to the channel
+func (b *RedisBus) Publish(ctx context.Context, event Event) error {
+	payload, err := encodeEvent(event)
+	if err != nil {
+		return fmt.Errorf("encode event: %w", err)
+	}
+
+	// pub-sub can publish and listen on any node in the cluster
+	conn := redis.ReadOnlyConn(b.pool, b.pool.Get())
+	defer conn.Close()
+
+	if _, err := conn.Do("PUBLISH", b.channel, payload); err != nil {
+		return fmt.Errorf("publish to %s: %w", b.channel, err)
+	}
+	return nil
+}
+
+// Subscribe delivers the events of the channel to handle until ctx is done
+// or the connection fails. Events that cannot be decoded are skipped.
+func (b *RedisBus) Subscribe(ctx context.Context, handle func(Event)) error {
+	conn := redis.ReadOnlyConn(b.pool, b.pool.Get())
+	psc := &redigo.PubSubConn{Conn: conn}
+	if err := psc.Subscribe(b.channel); err != nil {
+		conn.Close()
+		return fmt.Errorf("subscribe to %s: %w", b.channel, err)
+	}
+
+	// Unsubscribing ends the receive loop once ctx is done; pings keep an
+	// idle subscription from mistaking silence for a dead connection. The
+	// connection is only closed once the loop stopped reading, as closing a
+	// pooled connection reads its remaining replies.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(redisPingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				psc.Unsubscribe() //nolint:errcheck
+				<-done
+				conn.Close()
+				return
+			case <-done:
+				conn.Close()
+				return
+			case <-ticker.C:
+				psc.Ping("") //nolint:errcheck
+			}
+		}
+	}()
+
+	for {
+		switch msg := psc.ReceiveWithTimeout(2 * redisPingInterval).(type) {
+		case redigo.Message:
+			event, err := decodeEvent(msg.Data)
+			if err != nil {
+				continue
+			}
+			handle(event)
+		case redigo.Subscription:
+			if msg.Count == 0 {
+				return ctx.Err()
+			}
+		case error:
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("receive from %s: %w", b.channel, msg)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package websocket
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	redigo "github.com/gomodule/redigo/redis"
+
+	"github.com/notawar/mobius/mobius-server/server/mobius"
+)
+
+// pubSubServer speaks enough of the Redis protocol for a RedisBus and the
+// pool closing its connections: SUBSCRIBE, UNSUBSCRIBE, PUNSUBSCRIBE,
+// PUBLISH, PING and ECHO
+type pubSubServer struct {
+	listener net.Listener
+
+	mu          sync.Mutex
+	subscribers map[string]map[*pubSubConn]bool
+}
+
+type pubSubConn struct {
+	mu sync.Mutex
+	w  *bufio.Writer
+}
+
+func newPubSubServer(t *testing.T) *pubSubServer {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s := &pubSubServer{listener: listener, subscribers: make(map[string]map[*pubSubConn]bool)}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+// subscriberCount returns the connections subscribed to channel
+func (s *pubSubServer) subscriberCount(channel string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.subscribers[channel])
+}
+
+func (s *pubSubServer) serve(netConn net.Conn) {
+	defer netConn.Close()
+	r := bufio.NewReader(netConn)
+	conn := &pubSubConn{w: bufio.NewWriter(netConn)}
+	defer func() {
+		s.mu.Lock()
+		for _, conns := range s.subscribers {
+			delete(conns, conn)
+		}
+		s.mu.Unlock()
+	}()
+
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		switch strings.ToUpper(args[0]) {
+		case "SUBSCRIBE":
+			s.mu.Lock()
+			if s.subscribers[args[1]] == nil {
+				s.subscribers[args[1]] = make(map[*pubSubConn]bool)
+			}
+			s.subscribers[args[1]][conn] = true
+			s.mu.Unlock()
+			conn.write("subscribe", args[1], 1)
+		case "UNSUBSCRIBE":
+			s.mu.Lock()
+			for _, conns := range s.subscribers {
+				delete(conns, conn)
+			}
+			s.mu.Unlock()
+			conn.write("unsubscribe", "", 0)
+		case "PUBLISH":
+			s.mu.Lock()
+			var receivers []*pubSubConn
+			for receiver := range s.subscribers[args[1]] {
+				receivers = append(receivers, receiver)
+			}
+			s.mu.Unlock()
+			for _, receiver := range receivers {
+				receiver.write("message", args[1], args[2])
+			}
+			conn.write(len(receivers))
+		case "PUNSUBSCRIBE":
+			conn.write("punsubscribe", "", 0)
+		case "PING":
+			conn.write("pong", "")
+		case "ECHO":
+			conn.write(args[1])
+		default:
+			return
+		}
+	}
+}
+
+// readCommand reads a command sent as an array of bulk strings
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("invalid command %q", line)
+	}
+
+	args := make([]string, n)
+	for i := range args {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "$")))
+		if err != nil {
+			return nil, fmt.Errorf("invalid argument %q", line)
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+// write sends a single reply, or an array of bulk strings and integers
+func (c *pubSubConn) write(values ...interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(values) > 1 {
+		fmt.Fprintf(c.w, "*%d\r\n", len(values))
+	}
+	for _, v := range values {
+		switch v := v.(type) {
+		case int:
+			fmt.Fprintf(c.w, ":%d\r\n", v)
+		case string:
+			fmt.Fprintf(c.w, "$%d\r\n%s\r\n", len(v), v)
+		}
+	}
+	c.w.Flush()
+}
+
+// testRedisPool is a standalone pool of connections to addr
+type testRedisPool struct {
+	*redigo.Pool
+}
+
+func newTestRedisPool(addr string) *testRedisPool {
+	return &testRedisPool{Pool: &redigo.Pool{
+		Dial: func() (redigo.Conn, error) { return redigo.Dial("tcp", addr) },
+	}}
+}
+
+func (p *testRedisPool) Stats() map[string]redigo.PoolStats {
+	return map[string]redigo.PoolStats{}
+}
+
+func (p *testRedisPool) Mode() mobius.RedisMode {
+	return mobius.RedisStandalone
+}
+
+func TestRedisBus(t *testing.T) {
+	redisServer := newPubSubServer(t)
+	pool := newTestRedisPool(redisServer.listener.Addr().String())
+	t.Cleanup(func() { pool.Close() })
+
+	// Two replicas sharing the channel
+	publisher := NewHubWithBus(NewRedisBus(pool, ""))
+	startHub(t, publisher)
+	receiver := NewHubWithBus(NewRedisBus(pool, ""))
+	conn, _ := connect(t, startHub(t, receiver), "")
+	subscribeTo(t, conn, "groups", Filter{GroupIDs: []string{"group-1"}})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for redisServer.subscriberCount(DefaultRedisChannel) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected both hubs to subscribe")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	publisher.BroadcastEvent(string(EventGroupMembership), GroupMembershipData{GroupID: "group-2", DeviceID: "device-1", Action: "added"})
+	publisher.BroadcastEvent(string(EventGroupMembership), GroupMembershipData{GroupID: "group-1", DeviceID: "device-1", Action: "added"})
+
+	// The group of the event survives the bus, so the filter applies
+	var data GroupMembershipData
+	event := readEvent(t, conn, EventGroupMembership, &data)
+	if data.GroupID != "group-1" || data.DeviceID != "device-1" || data.Action != "added" {
+		t.Errorf("expected device-1 added to group-1, got %+v", data)
+	}
+	if event.Seq != 2 {
+		t.Errorf("expected seq 2 on the receiving hub, got %d", event.Seq)
+	}
+
+	if stats := receiver.Stats(); stats.Published != 0 || stats.Received != 2 {
+		t.Errorf("expected 2 events received, got %+v", stats)
+	}
+}
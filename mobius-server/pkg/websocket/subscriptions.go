@@ -0,0 +1,268 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Messages clients send to manage their subscriptions
+const (
+	MessageSubscribe   = "subscribe"
+	MessageUnsubscribe = "unsubscribe"
+)
+
+// Control messages the hub sends to clients. They carry no sequence number.
+const (
+	EventConnected    EventType = "connected"
+	EventSubscribed   EventType = "subscribed"
+	EventUnsubscribed EventType = "unsubscribed"
+	EventError        EventType = "error"
+)
+
+// maxSubscriptions bounds the subscriptions of one client
+const maxSubscriptions = 32
+
+// Access decides which events a client may receive and subscribe to. The API
+// implements it from the caller's role and device group scope; a client
+// without one may receive everything.
+type Access interface {
+	// CanReceive reports whether the client may receive events of a type
+	CanReceive(eventType EventType) bool
+	// CanSeeDevice reports whether the client may see events about a device
+	CanSeeDevice(deviceID string) bool
+	// CanSeeGroup reports whether the client may see events about a device group
+	CanSeeGroup(groupID string) bool
+	// DeviceGroups returns the groups of a device, to match group filters
+	DeviceGroups(deviceID string) []string
+}
+
+// Filter selects events for a subscription. Event types narrow the events by
+// type; devices and groups narrow them to events about any of those devices,
+// groups, or members of those groups. Empty fields match everything.
+type Filter struct {
+	EventTypes []EventType `json:"event_types,omitempty"`
+	DeviceIDs  []string    `json:"device_ids,omitempty"`
+	GroupIDs   []string    `json:"group_ids,omitempty"`
+}
+
+// clientMessage is a message received from a client
+type clientMessage struct {
+	Type   string `json:"type"`
+	ID     string `json:"id"`
+	Filter Filter `json:"filter"`
+}
+
+// ConnectedData is sent to a client once it is connected
+type ConnectedData struct {
+	ClientID string `json:"client_id"`
+	// ResumeToken is the position of the stream the connection starts from
+	ResumeToken string `json:"resume_token"`
+	// Replayed is the number of buffered events replayed after a resume,
+	// before the client's filters apply
+	Replayed int `json:"replayed"`
+	// Missed is set when events since the resume token are no longer
+	// buffered; the client should reload its state
+	Missed bool `json:"missed,omitempty"`
+}
+
+// SubscriptionData acknowledges a subscribe or unsubscribe message
+type SubscriptionData struct {
+	ID     string  `json:"id"`
+	Filter *Filter `json:"filter,omitempty"`
+}
+
+// ErrorData reports a message the hub rejected
+type ErrorData struct {
+	ID      string `json:"id,omitempty"`
+	Message string `json:"message"`
+}
+
+// matches reports whether the filter selects an event. groups returns the
+// groups of the event's device, and is only called when needed.
+func (f Filter) matches(e Event, groups func() []string) bool {
+	if len(f.EventTypes) > 0 && !containsEventType(f.EventTypes, e.Type) {
+		return false
+	}
+	if len(f.DeviceIDs) == 0 && len(f.GroupIDs) == 0 {
+		return true
+	}
+
+	if e.deviceID != "" && contains(f.DeviceIDs, e.deviceID) {
+		return true
+	}
+	if e.groupID != "" && contains(f.GroupIDs, e.groupID) {
+		return true
+	}
+	if e.deviceID != "" && len(f.GroupIDs) > 0 {
+		for _, groupID := range groups() {
+			if contains(f.GroupIDs, groupID) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// handleMessage applies a message received from the client
+func (c *Client) handleMessage(raw []byte) {
+	var msg clientMessage
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		c.sendControl(EventError, ErrorData{Message: "invalid message"})
+		return
+	}
+	if msg.ID == "" {
+		c.sendControl(EventError, ErrorData{Message: "subscription id required"})
+		return
+	}
+
+	switch msg.Type {
+	case MessageSubscribe:
+		if err := c.subscribe(msg.ID, msg.Filter); err != nil {
+			c.sendControl(EventError, ErrorData{ID: msg.ID, Message: err.Error()})
+			return
+		}
+		c.sendControl(EventSubscribed, SubscriptionData{ID: msg.ID, Filter: &msg.Filter})
+	case MessageUnsubscribe:
+		c.mu.Lock()
+		_, ok := c.subscriptions[msg.ID]
+		delete(c.subscriptions, msg.ID)
+		c.mu.Unlock()
+		if !ok {
+			c.sendControl(EventError, ErrorData{ID: msg.ID, Message: "unknown subscription"})
+			return
+		}
+		c.sendControl(EventUnsubscribed, SubscriptionData{ID: msg.ID})
+	default:
+		c.sendControl(EventError, ErrorData{ID: msg.ID, Message: fmt.Sprintf("unknown message type %q", msg.Type)})
+	}
+}
+
+// subscribe adds or replaces a subscription, rejecting filters for events
+// the client may not receive
+func (c *Client) subscribe(id string, f Filter) error {
+	for _, t := range f.EventTypes {
+		if !knownEventTypes[t] {
+			return fmt.Errorf("unknown event type %q", t)
+		}
+		if c.access != nil && !c.access.CanReceive(t) {
+			return fmt.Errorf("not allowed to receive %s events", t)
+		}
+	}
+	if c.access != nil {
+		for _, groupID := range f.GroupIDs {
+			if !c.access.CanSeeGroup(groupID) {
+				return fmt.Errorf("device group %s is outside your device groups", groupID)
+			}
+		}
+		for _, deviceID := range f.DeviceIDs {
+			if !c.access.CanSeeDevice(deviceID) {
+				return fmt.Errorf("device %s is outside your device groups", deviceID)
+			}
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.subscriptions[id]; !ok && len(c.subscriptions) >= maxSubscriptions {
+		return fmt.Errorf("at most %d subscriptions per connection", maxSubscriptions)
+	}
+	c.subscriptions[id] = f
+	return nil
+}
+
+// wants reports whether the client may receive an event and, once it has
+// subscribed, whether one of its subscriptions selects it. Without
+// subscriptions a client receives every event it may see.
+func (c *Client) wants(e Event) bool {
+	if c.access != nil {
+		if !c.access.CanReceive(e.Type) {
+			return false
+		}
+		if e.groupID != "" {
+			if !c.access.CanSeeGroup(e.groupID) {
+				return false
+			}
+		} else if e.deviceID != "" && !c.access.CanSeeDevice(e.deviceID) {
+			return false
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.subscriptions) == 0 {
+		return true
+	}
+
+	var groups []string
+	resolved := false
+	deviceGroups := func() []string {
+		if !resolved && c.access != nil {
+			groups = c.access.DeviceGroups(e.deviceID)
+		}
+		resolved = true
+		return groups
+	}
+	for _, f := range c.subscriptions {
+		if f.matches(e, deviceGroups) {
+			return true
+		}
+	}
+	return false
+}
+
+// sendControl queues a control message for the client, dropping it if the
+// client is not reading
+func (c *Client) sendControl(eventType EventType, data interface{}) {
+	select {
+	case c.control <- newEvent(eventType, data):
+	default:
+	}
+}
+
+// subject returns the device and device group an event is about
+func subject(data interface{}) (deviceID, groupID string) {
+	switch d := data.(type) {
+	case DeviceStatusChangeData:
+		return d.DeviceID, ""
+	case PolicyAssignmentData:
+		return d.DeviceID, d.GroupID
+	case CommandExecutionData:
+		return d.DeviceID, ""
+	case GroupMembershipData:
+		return d.DeviceID, d.GroupID
+	case LiveQueryResultData:
+		return d.DeviceID, ""
+	case PolicyComplianceData:
+		return d.DeviceID, ""
+	}
+	return "", ""
+}
+
+// knownEventTypes are the event types clients may subscribe to
+var knownEventTypes = map[EventType]bool{
+	EventDeviceStatusChange: true,
+	EventPolicyAssignment:   true,
+	EventCommandExecution:   true,
+	EventGroupMembership:    true,
+	EventLiveQueryResult:    true,
+	EventLiveQueryCompleted: true,
+	EventPolicyCompliance:   true,
+}
+
+func containsEventType(types []EventType, t EventType) bool {
+	for _, candidate := range types {
+		if candidate == t {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, v string) bool {
+	for _, candidate := range values {
+		if candidate == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package redis
+
+import (
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/notawar/mobius/mobius-server/server/mobius"
+)
+
+// IdempotencyStore keeps the responses of idempotent requests in Redis, so
+// that every replica replays them. It implements api.IdempotencyStore.
+type IdempotencyStore struct {
+	Pool      mobius.RedisPool
+	KeyPrefix string
+}
+
+const claimScript = `
+local v = redis.call('GET', KEYS[1])
+if v then
+  return v
+end
+redis.call('SET', KEYS[1], ARGV[1], 'EX', ARGV[2])
+return false
+`
+
+func (s *IdempotencyStore) Claim(key string, value []byte, ttl time.Duration) (bool, []byte, error) {
+	key = s.KeyPrefix + key
+
+	conn := s.Pool.Get()
+	defer conn.Close()
+	if err := BindConn(s.Pool, conn, key); err != nil {
+		return false, nil, err
+	}
+	// must come after BindConn due to redisc restrictions
+	conn = ConfigureDoer(s.Pool, conn)
+
+	script := redis.NewScript(1, claimScript)
+	existing, err := redis.Bytes(script.Do(conn, key, value, ttlSeconds(ttl)))
+	if err == redis.ErrNil {
+		return true, nil, nil
+	}
+	if err != nil {
+		return false, nil, err
+	}
+	return false, existing, nil
+}
+
+func (s *IdempotencyStore) Save(key string, value []byte, ttl time.Duration) error {
+	conn := ConfigureDoer(s.Pool, s.Pool.Get())
+	defer conn.Close()
+
+	_, err := conn.Do("SET", s.KeyPrefix+key, value, "EX", ttlSeconds(ttl))
+	return err
+}
+
+func (s *IdempotencyStore) Release(key string) error {
+	conn := ConfigureDoer(s.Pool, s.Pool.Get())
+	defer conn.Close()
+
+	_, err := conn.Do("DEL", s.KeyPrefix+key)
+	return err
+}
+
+// ttlSeconds rounds a TTL down to seconds. An `EX 0` will fail, make sure
+// that we set expiry for a minimum of one second.
+func ttlSeconds(ttl time.Duration) int {
+	if secs := int(ttl.Seconds()); secs > 0 {
+		return secs
+	}
+	return 1
+}
@@ -0,0 +1,37 @@
+package s3
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/notawar/mobius/mobius-server/server/config"
+)
+
+const applicationPackagesPrefix = "application-packages"
+
+// ApplicationPackageStore stores application packages uploaded to the API
+// server in the software installers bucket.
+type ApplicationPackageStore struct {
+	*commonFileStore
+}
+
+// NewApplicationPackageStore creates a new instance with the given S3 config.
+func NewApplicationPackageStore(config config.S3Config) (*ApplicationPackageStore, error) {
+	s3store, err := newS3store(config.SoftwareInstallersToInternalCfg())
+	if err != nil {
+		return nil, err
+	}
+	return &ApplicationPackageStore{
+		&commonFileStore{
+			s3store:    s3store,
+			pathPrefix: applicationPackagesPrefix,
+			fileLabel:  "application package",
+		},
+	}, nil
+}
+
+// HealthCheckContext checks that the bucket is reachable
+func (s *ApplicationPackageStore) HealthCheckContext(ctx context.Context) error {
+	_, err := s.s3client.HeadBucketWithContext(ctx, &s3.HeadBucketInput{Bucket: &s.bucket})
+	return err
+}
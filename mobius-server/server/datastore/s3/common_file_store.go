@@ -69,6 +69,17 @@ func (s *commonFileStore) Put(ctx context.Context, fileID string, content io.Rea
 	return err
 }
 
+// Delete removes a file from S3. Deleting a missing file is not an error.
+func (s *commonFileStore) Delete(ctx context.Context, fileID string) error {
+	key := s.keyForFile(fileID)
+
+	_, err := s.s3client.DeleteObject(&s3.DeleteObjectInput{Bucket: &s.bucket, Key: &key})
+	if err != nil {
+		return ctxerr.Wrapf(ctx, err, "deleting %s from S3 store", s.fileLabel)
+	}
+	return nil
+}
+
 // Exists checks if a file exists in the S3 bucket for the ID.
 func (s *commonFileStore) Exists(ctx context.Context, fileID string) (bool, error) {
 	key := s.keyForFile(fileID)
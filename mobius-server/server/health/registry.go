@@ -0,0 +1,227 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultTimeout bounds probes registered without a timeout
+const DefaultTimeout = 2 * time.Second
+
+// Component statuses
+const (
+	StatusUp   = "up"
+	StatusDown = "down"
+)
+
+// Overall statuses of a Report
+const (
+	// StatusHealthy means every probe passed
+	StatusHealthy = "healthy"
+	// StatusDegraded means only optional probes failed
+	StatusDegraded = "degraded"
+	// StatusUnhealthy means a required probe failed
+	StatusUnhealthy = "unhealthy"
+)
+
+// ContextChecker is a Checker that gives up once its context is done. The
+// Registry prefers it to HealthCheck so that probes stop at their timeout.
+type ContextChecker interface {
+	HealthCheckContext(ctx context.Context) error
+}
+
+// CheckerFunc adapts a function to a Checker and ContextChecker
+type CheckerFunc func(ctx context.Context) error
+
+// HealthCheck runs the function without a deadline
+func (f CheckerFunc) HealthCheck() error {
+	return f(context.Background())
+}
+
+// HealthCheckContext runs the function
+func (f CheckerFunc) HealthCheckContext(ctx context.Context) error {
+	return f(ctx)
+}
+
+// Probe is a named Checker registered with a Registry
+type Probe struct {
+	Name    string
+	Checker Checker
+	// Timeout bounds a single check, DefaultTimeout when zero
+	Timeout time.Duration
+	// Optional probes degrade the service when they fail but leave it ready
+	Optional bool
+	// Live probes watch the process itself, such as its background workers,
+	// and are also part of the liveness check. A failing live probe means the
+	// process should be restarted.
+	Live bool
+}
+
+// Result is the outcome of one probe
+type Result struct {
+	Status    string        `json:"status"`
+	Latency   time.Duration `json:"-"`
+	LatencyMS float64       `json:"latency_ms"`
+	Error     string        `json:"error,omitempty"`
+	Optional  bool          `json:"optional,omitempty"`
+}
+
+// Report is the outcome of a set of probes
+type Report struct {
+	Status     string            `json:"status"`
+	Components map[string]Result `json:"components"`
+}
+
+// Ready reports whether every required probe passed
+func (r Report) Ready() bool {
+	return r.Status != StatusUnhealthy
+}
+
+// Registry holds the probes of a server's backends
+type Registry struct {
+	mu     sync.RWMutex
+	probes map[string]Probe
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{probes: make(map[string]Probe)}
+}
+
+// Register adds a probe, replacing any probe of the same name
+func (r *Registry) Register(p Probe) {
+	if p.Timeout <= 0 {
+		p.Timeout = DefaultTimeout
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.probes[p.Name] = p
+}
+
+// Checkers returns the registered checkers by name, for CheckHealth and Handler
+func (r *Registry) Checkers() map[string]Checker {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	checkers := make(map[string]Checker, len(r.probes))
+	for name, p := range r.probes {
+		checkers[name] = p.Checker
+	}
+	return checkers
+}
+
+// CheckReady runs every probe concurrently, for readiness
+func (r *Registry) CheckReady(ctx context.Context) Report {
+	return r.check(ctx, func(Probe) bool { return true })
+}
+
+// CheckLive runs the live probes concurrently, for liveness
+func (r *Registry) CheckLive(ctx context.Context) Report {
+	return r.check(ctx, func(p Probe) bool { return p.Live })
+}
+
+func (r *Registry) check(ctx context.Context, include func(Probe) bool) Report {
+	r.mu.RLock()
+	probes := make([]Probe, 0, len(r.probes))
+	for _, p := range r.probes {
+		if include(p) {
+			probes = append(probes, p)
+		}
+	}
+	r.mu.RUnlock()
+
+	results := make([]Result, len(probes))
+	var wg sync.WaitGroup
+	for i, p := range probes {
+		wg.Add(1)
+		go func(i int, p Probe) {
+			defer wg.Done()
+			results[i] = run(ctx, p)
+		}(i, p)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusHealthy, Components: make(map[string]Result, len(probes))}
+	for i, p := range probes {
+		result := results[i]
+		report.Components[p.Name] = result
+		if result.Status == StatusUp {
+			continue
+		}
+		if !p.Optional {
+			report.Status = StatusUnhealthy
+		} else if report.Status == StatusHealthy {
+			report.Status = StatusDegraded
+		}
+	}
+	return report
+}
+
+// run checks one probe, giving up at its timeout even if the checker does not
+func run(ctx context.Context, p Probe) Result {
+	ctx, cancel := context.WithTimeout(ctx, p.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		if cc, ok := p.Checker.(ContextChecker); ok {
+			done <- cc.HealthCheckContext(ctx)
+			return
+		}
+		done <- p.Checker.HealthCheck()
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = fmt.Errorf("timed out after %s", p.Timeout)
+	}
+	latency := time.Since(start)
+
+	result := Result{
+		Status:    StatusUp,
+		Latency:   latency,
+		LatencyMS: float64(latency.Microseconds()) / 1000,
+		Optional:  p.Optional,
+	}
+	if err != nil {
+		result.Status = StatusDown
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// Heartbeat is a Checker for a background worker, which beats after every
+// run. It fails once the worker has not beaten for longer than its maximum age.
+type Heartbeat struct {
+	maxAge time.Duration
+	last   atomic.Int64 // unix nanoseconds
+}
+
+// NewHeartbeat creates a heartbeat for a worker that beats at least every
+// maxAge. The worker counts as having just beaten.
+func NewHeartbeat(maxAge time.Duration) *Heartbeat {
+	h := &Heartbeat{maxAge: maxAge}
+	h.Beat()
+	return h
+}
+
+// Beat records a run of the worker
+func (h *Heartbeat) Beat() {
+	h.last.Store(time.Now().UnixNano())
+}
+
+// HealthCheck fails if the worker has not beaten in time
+func (h *Heartbeat) HealthCheck() error {
+	age := time.Since(time.Unix(0, h.last.Load()))
+	if age > h.maxAge {
+		return fmt.Errorf("last run %s ago", age.Round(time.Second))
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// passing and failing are checkers with fixed outcomes
+var (
+	passing = CheckerFunc(func(context.Context) error { return nil })
+	failing = CheckerFunc(func(context.Context) error { return errors.New("connection refused") })
+)
+
+// blockingChecker is a Checker ignoring deadlines, which returns once the
+// test ends
+type blockingChecker chan struct{}
+
+func (c blockingChecker) HealthCheck() error {
+	<-c
+	return nil
+}
+
+func TestRegistry(t *testing.T) {
+	t.Run("probes time out", func(t *testing.T) {
+		block := make(blockingChecker)
+		t.Cleanup(func() { close(block) })
+
+		cancelled := make(chan struct{})
+		registry := NewRegistry()
+		registry.Register(Probe{Name: "mysql", Checker: block, Timeout: 20 * time.Millisecond})
+		registry.Register(Probe{Name: "redis", Timeout: 20 * time.Millisecond, Checker: CheckerFunc(func(ctx context.Context) error {
+			<-ctx.Done()
+			close(cancelled)
+			return ctx.Err()
+		})})
+
+		start := time.Now()
+		report := registry.CheckReady(context.Background())
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("expected the check to end at the timeout, took %s", elapsed)
+		}
+		if report.Status != StatusUnhealthy || report.Ready() {
+			t.Errorf("expected unhealthy, got %s", report.Status)
+		}
+		for _, name := range []string{"mysql", "redis"} {
+			if result := report.Components[name]; result.Status != StatusDown || !strings.Contains(result.Error, "timed out after 20ms") {
+				t.Errorf("%s: expected a timeout, got %+v", name, result)
+			}
+		}
+		select {
+		case <-cancelled:
+		case <-time.After(time.Second):
+			t.Error("expected the context of the probe to be cancelled")
+		}
+	})
+
+	t.Run("optional probes degrade", func(t *testing.T) {
+		registry := NewRegistry()
+		registry.Register(Probe{Name: "mysql", Checker: passing})
+		registry.Register(Probe{Name: "bus", Checker: failing, Optional: true})
+
+		report := registry.CheckReady(context.Background())
+		if report.Status != StatusDegraded || !report.Ready() {
+			t.Errorf("expected degraded and ready, got %s", report.Status)
+		}
+		if result := report.Components["bus"]; result.Status != StatusDown || !result.Optional || result.Error != "connection refused" {
+			t.Errorf("expected the optional probe down, got %+v", result)
+		}
+		if result := report.Components["mysql"]; result.Status != StatusUp {
+			t.Errorf("expected mysql up, got %+v", result)
+		}
+	})
+
+	t.Run("liveness ignores backends", func(t *testing.T) {
+		registry := NewRegistry()
+		registry.Register(Probe{Name: "mysql", Checker: failing})
+		registry.Register(Probe{Name: "worker", Checker: NewHeartbeat(time.Minute), Live: true})
+
+		live := registry.CheckLive(context.Background())
+		if live.Status != StatusHealthy || !live.Ready() {
+			t.Errorf("expected live, got %s", live.Status)
+		}
+		if _, ok := live.Components["mysql"]; ok || len(live.Components) != 1 {
+			t.Errorf("expected only the live probes, got %v", live.Components)
+		}
+
+		ready := registry.CheckReady(context.Background())
+		if ready.Status != StatusUnhealthy || ready.Ready() {
+			t.Errorf("expected not ready, got %s", ready.Status)
+		}
+	})
+
+	t.Run("failing live probes", func(t *testing.T) {
+		heartbeat := NewHeartbeat(time.Minute)
+		heartbeat.last.Store(time.Now().Add(-2 * time.Minute).UnixNano())
+
+		registry := NewRegistry()
+		registry.Register(Probe{Name: "worker", Checker: heartbeat, Live: true})
+		if report := registry.CheckLive(context.Background()); report.Status != StatusUnhealthy {
+			t.Errorf("expected unhealthy, got %s", report.Status)
+		}
+
+		heartbeat.Beat()
+		if report := registry.CheckLive(context.Background()); report.Status != StatusHealthy {
+			t.Errorf("expected healthy after a beat, got %s", report.Status)
+		}
+	})
+}
@@ -54,6 +54,7 @@ export interface LoginResponse {
     email: string;
     name: string;
     role: string;
+    must_change_password?: boolean;
   };
 }
 
@@ -65,12 +66,18 @@ export interface LicenseStatus {
   features: string[];
 }
 
+export interface ComponentHealth {
+  status: 'up' | 'down';
+  latency_ms: number;
+  error?: string;
+  optional?: boolean;
+}
+
 export interface HealthStatus {
   status: 'healthy' | 'degraded' | 'unhealthy';
+  timestamp: string;
   version: string;
-  uptime: number;
-  database: boolean;
-  services: Record<string, boolean>;
+  components: Record<string, ComponentHealth>;
 }
 
 class APIClient {
@@ -129,6 +136,16 @@ class APIClient {
     return response.data;
   }
 
+  // changePassword changes the password of the signed-in user, which ends
+  // their sessions; sign in again with the new password afterwards
+  async changePassword(userId: string, currentPassword: string, newPassword: string): Promise<void> {
+    await this.client.put(`/users/${userId}`, {
+      current_password: currentPassword,
+      password: newPassword,
+    });
+    this.clearAuthToken();
+  }
+
   async logout(): Promise<void> {
     this.clearAuthToken();
   }
@@ -139,7 +156,10 @@ class APIClient {
 
   // Health and system methods
   async getHealth(): Promise<HealthStatus> {
-    const response: AxiosResponse<HealthStatus> = await this.client.get('/health');
+    // An unhealthy server answers 503 with the same report
+    const response: AxiosResponse<HealthStatus> = await this.client.get('/health', {
+      validateStatus: (status) => status === 200 || status === 503,
+    });
     return response.data;
   }
 
@@ -151,11 +171,11 @@ class APIClient {
   // Device management methods
   async getDevices(params?: { 
     limit?: number; 
-    offset?: number; 
+    cursor?: string; 
     platform?: string; 
     status?: string;
     search?: string;
-  }): Promise<{ devices: Device[]; total: number }> {
+  }): Promise<{ devices: Device[]; total: number; next_cursor?: string }> {
     const response = await this.client.get('/devices', { params });
     return response.data;
   }
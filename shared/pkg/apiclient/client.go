@@ -0,0 +1,286 @@
+// Package apiclient is a typed client of the Mobius /api/v1 API, shared by
+// mobius-cli, mobius-client and the Terraform provider.
+//
+// The types and methods in client_gen.go are generated from the OpenAPI
+// document of the server (mobius-server/api/openapi.yaml); run go generate
+// after changing it. Operations that switch protocols, such as the
+// WebSocket at /api/v1/ws, are not covered. The Idempotency-Key and
+// If-Match headers are set through the context of a call; see
+// WithIdempotencyKey and WithIfMatch.
+package apiclient
+
+//go:generate go run github.com/notawar/mobius/mobius-server/cmd/openapi client -o client_gen.go
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BasePath is the path of the API relative to the server URL
+const BasePath = "/api/v1"
+
+// maxErrorBody is the most of an error response kept in an Error
+const maxErrorBody = 64 << 10
+
+// Client calls the API of a Mobius server
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	userAgent  string
+
+	mu    sync.RWMutex
+	token string
+}
+
+// ClientOpt is the type for the client-specific options.
+type ClientOpt func(c *Client)
+
+// WithHTTPClient sets the HTTP client requests are sent with.
+func WithHTTPClient(httpClient *http.Client) ClientOpt {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithToken sets the bearer token requests are authenticated with: a user
+// access token, or the device token for the device API.
+func WithToken(token string) ClientOpt {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithUserAgent sets the User-Agent header of requests.
+func WithUserAgent(userAgent string) ClientOpt {
+	return func(c *Client) {
+		c.userAgent = userAgent
+	}
+}
+
+// New creates a client of the server at serverURL, such as
+// https://mobius.example.com
+func New(serverURL string, opts ...ClientOpt) (*Client, error) {
+	u, err := url.Parse(serverURL)
+	if err != nil {
+		return nil, fmt.Errorf("parse server URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("server URL must be http or https: %q", serverURL)
+	}
+
+	c := &Client{
+		baseURL:    strings.TrimSuffix(u.String(), "/") + BasePath,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		userAgent:  "mobius-apiclient/" + APIVersion,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// SetToken replaces the bearer token, such as after logging in or
+// refreshing the access token
+func (c *Client) SetToken(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.token = token
+}
+
+// Token returns the bearer token requests are authenticated with
+func (c *Client) Token() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.token
+}
+
+// Error is returned for responses with an error status
+type Error struct {
+	StatusCode int `json:"code"`
+	// Status is the text of the status code
+	Status  string `json:"error"`
+	Message string `json:"message"`
+	// Details carries further details, such as every mismatch of a request
+	// the server's API document rejects
+	Details json.RawMessage `json:"details,omitempty"`
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("mobius API: %d %s", e.StatusCode, e.Status)
+	}
+	return fmt.Sprintf("mobius API: %d %s: %s", e.StatusCode, e.Status, e.Message)
+}
+
+// StatusCode returns the status of an API error, or 0 for other errors
+func StatusCode(err error) int {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode
+	}
+	return 0
+}
+
+type contextKey int
+
+const (
+	idempotencyKeyContextKey contextKey = iota
+	ifMatchContextKey
+)
+
+// WithIdempotencyKey returns a context whose requests carry an
+// Idempotency-Key header. Retrying a POST, PUT, PATCH or DELETE with the
+// same key, such as after a timeout, gets the first response back instead
+// of running the request again.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyContextKey, key)
+}
+
+// WithIfMatch returns a context whose requests carry an If-Match header for
+// revision, so that updates and deletes only apply if nobody changed the
+// resource since it was at that revision. Others fail with status 412.
+func WithIfMatch(ctx context.Context, revision int) context.Context {
+	return context.WithValue(ctx, ifMatchContextKey, revision)
+}
+
+// Ptr returns a pointer to v, for the optional fields of requests
+func Ptr[T any](v T) *T {
+	return &v
+}
+
+// do sends a request with an optional JSON body and returns the response
+// of a successful one
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body interface{}) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("encode request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := c.newRequest(ctx, method, path, query, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return c.send(req)
+}
+
+// formPart is a field of a multipart form: a value, or the content of a file
+type formPart struct {
+	name     string
+	value    string
+	filename string
+	content  io.Reader
+}
+
+// doForm sends a multipart form, streaming the content of its files
+func (c *Client) doForm(ctx context.Context, method, path string, parts []formPart) (*http.Response, error) {
+	pr, pw := io.Pipe()
+	form := multipart.NewWriter(pw)
+	go func() {
+		pw.CloseWithError(writeForm(form, parts))
+	}()
+
+	req, err := c.newRequest(ctx, method, path, nil, pr)
+	if err != nil {
+		pr.Close()
+		return nil, err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	return c.send(req)
+}
+
+func writeForm(form *multipart.Writer, parts []formPart) error {
+	for _, part := range parts {
+		if part.content == nil {
+			if err := form.WriteField(part.name, part.value); err != nil {
+				return err
+			}
+			continue
+		}
+		w, err := form.CreateFormFile(part.name, part.filename)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(w, part.content); err != nil {
+			return err
+		}
+	}
+	return form.Close()
+}
+
+func (c *Client) newRequest(ctx context.Context, method, path string, query url.Values, body io.Reader) (*http.Request, error) {
+	target := c.baseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", c.userAgent)
+	if token := c.Token(); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if key, ok := ctx.Value(idempotencyKeyContextKey).(string); ok {
+		req.Header.Set("Idempotency-Key", key)
+	}
+	if revision, ok := ctx.Value(ifMatchContextKey).(int); ok {
+		req.Header.Set("If-Match", `"`+strconv.Itoa(revision)+`"`)
+	}
+	return req, nil
+}
+
+// send sends a request, turning error statuses into an *Error
+func (c *Client) send(req *http.Request) (*http.Response, error) {
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < http.StatusBadRequest {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	apiErr := &Error{}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	if json.Unmarshal(data, apiErr) != nil {
+		apiErr.Message = strings.TrimSpace(string(data))
+	}
+	apiErr.StatusCode = resp.StatusCode
+	if apiErr.Status == "" {
+		apiErr.Status = http.StatusText(resp.StatusCode)
+	}
+	return nil, apiErr
+}
+
+// decodeResponse decodes a JSON response into out, or discards it when out
+// is nil, and closes it
+func decodeResponse(resp *http.Response, out interface{}) error {
+	defer resp.Body.Close()
+	if out == nil {
+		_, err := io.Copy(io.Discard, resp.Body)
+		return err
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode %s response: %w", resp.Request.URL.Path, err)
+	}
+	return nil
+}
@@ -0,0 +1,2625 @@
+// Code generated by mobius-server/cmd/openapi from api/openapi.yaml. DO NOT EDIT.
+
+package apiclient
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// APIVersion is the version of the API document the client was generated from
+const APIVersion = "1.0.0"
+
+// ApplicationSource is the ApplicationSource schema of the API
+//
+// Package of mobius-package-search an application was imported from.
+type ApplicationSource struct {
+	// Set for Homebrew casks
+	Cask bool `json:"cask,omitempty"`
+	// What the package manager installs
+	Identifier string `json:"identifier"`
+	// one of apt, flatpak, brew, winget
+	Manager string `json:"manager"`
+	// ID of the package, such as winget:Mozilla.Firefox
+	PackageID string `json:"package_id"`
+	// Flatpak remote of the application
+	Remote string `json:"remote,omitempty"`
+}
+
+// Application is the Application schema of the API
+type Application struct {
+	// Bundle or product identifier read from the package
+	BundleID string `json:"bundle_id,omitempty"`
+	// SHA-256 of the package
+	Checksum  string    `json:"checksum"`
+	CreatedAt time.Time `json:"created_at"`
+	// osquery query returning a row when the application is installed
+	DetectionQuery string `json:"detection_query,omitempty"`
+	Filename       string `json:"filename,omitempty"`
+	ID             string `json:"id"`
+	// Command installing an imported application, or upgrading it
+	InstallCommand string `json:"install_command,omitempty"`
+	// Upstream version of an imported application when it was last checked
+	LatestVersion          string     `json:"latest_version,omitempty"`
+	LatestVersionCheckedAt *time.Time `json:"latest_version_checked_at,omitempty"`
+	Name                   string     `json:"name"`
+	// Detected package format, empty for other files, or the package manager of
+	// imported applications; one of deb, rpm, msi, exe, pkg, tar.gz, apt, flatpak,
+	// brew, winget
+	PackageType string `json:"package_type,omitempty"`
+	// one of windows, macos, linux, ios, android
+	Platform string `json:"platform"`
+	// Increases with every change; sent as the ETag and matched by If-Match
+	Revision int `json:"revision"`
+	Size     int `json:"size"`
+	// Package of mobius-package-search an application was imported from
+	Source           *ApplicationSource `json:"source,omitempty"`
+	UninstallCommand string             `json:"uninstall_command,omitempty"`
+	// Set when latest_version is newer than version
+	UpdateAvailable bool   `json:"update_available,omitempty"`
+	Version         string `json:"version"`
+}
+
+// ApplicationDecision is the ApplicationDecision schema of the API
+type ApplicationDecision struct {
+	// Shown to the device user
+	Note *string `json:"note,omitempty"`
+}
+
+// ApplicationImportRequest is the ApplicationImportRequest schema of the API
+type ApplicationImportRequest struct {
+	// Name of the application, instead of the name of the package
+	Name *string `json:"name,omitempty"`
+	// ID of the package in mobius-package-search
+	PackageID string `json:"package_id"`
+	// Platform of the application, required for packages of several platforms; one
+	// of windows, macos, linux
+	Platform *string `json:"platform,omitempty"`
+}
+
+// ApplicationPublication is the ApplicationPublication schema of the API
+type ApplicationPublication struct {
+	ApplicationID string    `json:"application_id"`
+	GroupID       string    `json:"group_id"`
+	PublishedAt   time.Time `json:"published_at"`
+	// Devices need an approved request to install the application
+	Restricted bool `json:"restricted"`
+}
+
+// ApplicationRequest is the ApplicationRequest schema of the API
+type ApplicationRequest struct {
+	ApplicationID string `json:"application_id"`
+	// Install command queued when the request was approved
+	CommandID    string     `json:"command_id,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	DecidedAt    *time.Time `json:"decided_at,omitempty"`
+	DecidedBy    string     `json:"decided_by,omitempty"`
+	DecisionNote string     `json:"decision_note,omitempty"`
+	DeviceID     string     `json:"device_id"`
+	ID           string     `json:"id"`
+	Reason       string     `json:"reason,omitempty"`
+	// one of pending, approved, denied
+	Status string `json:"status"`
+}
+
+// AuditEntryActor is the AuditEntryActor schema of the API
+type AuditEntryActor struct {
+	Email string `json:"email,omitempty"`
+	ID    string `json:"id,omitempty"`
+	Role  string `json:"role,omitempty"`
+	// one of user, device, anonymous
+	Type string `json:"type"`
+}
+
+// AuditEntryChange is the AuditEntryChange schema of the API
+type AuditEntryChange struct {
+	After  interface{} `json:"after,omitempty"`
+	Before interface{} `json:"before,omitempty"`
+	Field  string      `json:"field,omitempty"`
+}
+
+// AuditEntryRequest is the AuditEntryRequest schema of the API
+type AuditEntryRequest struct {
+	ClientIP  string `json:"client_ip"`
+	Method    string `json:"method"`
+	Path      string `json:"path"`
+	UserAgent string `json:"user_agent,omitempty"`
+}
+
+// AuditEntry is the AuditEntry schema of the API
+type AuditEntry struct {
+	Action  string                 `json:"action"`
+	Actor   AuditEntryActor        `json:"actor"`
+	Changes []AuditEntryChange     `json:"changes,omitempty"`
+	Details map[string]interface{} `json:"details,omitempty"`
+	ID      string                 `json:"id"`
+	// one of success, failure, denied
+	Outcome    string            `json:"outcome"`
+	Reason     string            `json:"reason,omitempty"`
+	Request    AuditEntryRequest `json:"request"`
+	TargetID   string            `json:"target_id,omitempty"`
+	TargetType string            `json:"target_type,omitempty"`
+	Timestamp  time.Time         `json:"timestamp"`
+}
+
+// AuditPage is the AuditPage schema of the API
+type AuditPage struct {
+	Entries []AuditEntry `json:"entries,omitempty"`
+	// Cursor of the next page, absent on the last page
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// User is the User schema of the API
+type User struct {
+	CreatedAt time.Time `json:"created_at"`
+	// Device groups the user is limited to; absent for every device
+	DeviceGroupIDs []string `json:"device_group_ids,omitempty"`
+	Email          string   `json:"email"`
+	ID             string   `json:"id"`
+	// The user may only change their password, read their account and log out
+	// until they change it
+	MustChangePassword bool   `json:"must_change_password,omitempty"`
+	Name               string `json:"name"`
+	// Increases with every change; sent as the ETag and matched by If-Match
+	Revision int `json:"revision"`
+	// one of admin, maintainer, observer, device-technician
+	Role      string    `json:"role"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// AuthResponse is the AuthResponse schema of the API
+type AuthResponse struct {
+	ExpiresAt        time.Time  `json:"expires_at"`
+	RefreshExpiresAt *time.Time `json:"refresh_expires_at,omitempty"`
+	// Opaque refresh token, valid for 7 days
+	RefreshToken string `json:"refresh_token,omitempty"`
+	// Signed access token, valid for 15 minutes
+	Token string `json:"token"`
+	User  User   `json:"user"`
+}
+
+// BulkAction is the BulkAction schema of the API
+type BulkAction struct {
+	// one of restart, shutdown, lock, wipe, collect_logs, run_osquery,
+	// install_app, uninstall_app
+	Command   *string `json:"command,omitempty"`
+	ExpiresIn *int    `json:"expires_in,omitempty"`
+	// Groups to remove devices from; every other manual group when empty
+	FromGroupIDs []string               `json:"from_group_ids,omitempty"`
+	GroupID      *string                `json:"group_id,omitempty"`
+	Labels       map[string]string      `json:"labels,omitempty"`
+	Parameters   map[string]interface{} `json:"parameters,omitempty"`
+	PolicyID     *string                `json:"policy_id,omitempty"`
+	RemoveLabels []string               `json:"remove_labels,omitempty"`
+	// one of command, assign_policy, unassign_policy, update_labels,
+	// move_to_group, unenroll
+	Type string `json:"type"`
+}
+
+// BulkOperationFailure is the BulkOperationFailure schema of the API
+type BulkOperationFailure struct {
+	DeviceID string `json:"device_id"`
+	Error    string `json:"error"`
+}
+
+// DeviceSelector is the DeviceSelector schema of the API
+//
+// Matches the listed devices, the members of the groups and the devices
+// carrying every label, or every device without those.
+type DeviceSelector struct {
+	DeviceIDs []string `json:"device_ids,omitempty"`
+	// Device list filters, such as "platform[in]" or "labels.env"
+	Filters  map[string]string `json:"filters,omitempty"`
+	GroupIDs []string          `json:"group_ids,omitempty"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	// Matches hostnames and UUIDs
+	Search *string `json:"search,omitempty"`
+}
+
+// BulkOperation is the BulkOperation schema of the API
+type BulkOperation struct {
+	Action     BulkAction             `json:"action"`
+	CreatedAt  time.Time              `json:"created_at"`
+	CreatedBy  string                 `json:"created_by,omitempty"`
+	Failed     int                    `json:"failed"`
+	Failures   []BulkOperationFailure `json:"failures,omitempty"`
+	FinishedAt *time.Time             `json:"finished_at,omitempty"`
+	ID         string                 `json:"id"`
+	Processed  int                    `json:"processed"`
+	// Matches the listed devices, the members of the groups and the devices
+	// carrying every label, or every device without those
+	Selector DeviceSelector `json:"selector"`
+	// one of running, completed, partially_failed, failed, cancelled, interrupted
+	Status    string    `json:"status"`
+	Succeeded int       `json:"succeeded"`
+	Total     int       `json:"total"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Device is the Device schema of the API
+type Device struct {
+	EnrolledAt time.Time         `json:"enrolled_at"`
+	Hostname   string            `json:"hostname"`
+	ID         string            `json:"id"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	LastSeen   time.Time         `json:"last_seen"`
+	OSVersion  string            `json:"os_version"`
+	// one of windows, macos, linux, ios, android
+	Platform string `json:"platform"`
+	// Increases with every change; sent as the ETag and matched by If-Match
+	Revision int `json:"revision"`
+	// one of online, offline, enrolled, pending
+	Status string `json:"status"`
+	// System info reported at the last check-in
+	SystemInfo map[string]string `json:"system_info,omitempty"`
+	UUID       string            `json:"uuid"`
+}
+
+// BulkOperationPreview is the BulkOperationPreview schema of the API
+type BulkOperationPreview struct {
+	Action BulkAction `json:"action"`
+	// The first 500 matched devices
+	Devices []Device `json:"devices,omitempty"`
+	DryRun  bool     `json:"dry_run"`
+	Total   int      `json:"total"`
+}
+
+// DeviceCommand is the DeviceCommand schema of the API
+type DeviceCommand struct {
+	AcknowledgedAt *time.Time             `json:"acknowledged_at,omitempty"`
+	Command        string                 `json:"command"`
+	CompletedAt    *time.Time             `json:"completed_at,omitempty"`
+	CreatedAt      time.Time              `json:"created_at"`
+	CreatedBy      string                 `json:"created_by,omitempty"`
+	DeliveredAt    *time.Time             `json:"delivered_at,omitempty"`
+	DeviceID       string                 `json:"device_id"`
+	Error          string                 `json:"error,omitempty"`
+	ExpiresAt      time.Time              `json:"expires_at"`
+	ID             string                 `json:"id"`
+	Parameters     map[string]interface{} `json:"parameters,omitempty"`
+	Result         map[string]interface{} `json:"result,omitempty"`
+	// one of pending, delivered, acknowledged, completed, failed, expired
+	Status    string    `json:"status"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// CatalogApplication is the CatalogApplication schema of the API
+type CatalogApplication struct {
+	Application
+	Command    *DeviceCommand      `json:"command,omitempty"`
+	Request    *ApplicationRequest `json:"request,omitempty"`
+	Restricted bool                `json:"restricted"`
+	// one of available, approval_required, pending_approval, denied, installing,
+	// installed, install_failed, uninstalling, uninstall_failed
+	Status string `json:"status"`
+}
+
+// ComplianceSummaryPolicy is the ComplianceSummaryPolicy schema of the API
+type ComplianceSummaryPolicy struct {
+	Error    int    `json:"error,omitempty"`
+	Fail     int    `json:"fail,omitempty"`
+	Pass     int    `json:"pass,omitempty"`
+	PolicyID string `json:"policy_id,omitempty"`
+}
+
+// ComplianceSummary is the ComplianceSummary schema of the API
+type ComplianceSummary struct {
+	ComplianceRate float64                   `json:"compliance_rate"`
+	Compliant      int                       `json:"compliant"`
+	Devices        int                       `json:"devices"`
+	Errored        int                       `json:"errored"`
+	GroupID        string                    `json:"group_id,omitempty"`
+	NonCompliant   int                       `json:"non_compliant"`
+	Policies       []ComplianceSummaryPolicy `json:"policies,omitempty"`
+	PolicyID       string                    `json:"policy_id,omitempty"`
+}
+
+// DeviceApplication is the DeviceApplication schema of the API
+type DeviceApplication struct {
+	Application
+	DownloadExpiresAt *time.Time `json:"download_expires_at,omitempty"`
+	// Signed URL to download the package without credentials; not set for imported
+	// applications
+	DownloadURL string `json:"download_url,omitempty"`
+	// Application of the self-service catalog, installed when the device user asks
+	// rather than on sync
+	SelfService bool `json:"self_service,omitempty"`
+}
+
+// DeviceEnrollment is the DeviceEnrollment schema of the API
+type DeviceEnrollment struct {
+	EnrollmentSecret *string `json:"enrollment_secret,omitempty"`
+	Hostname         string  `json:"hostname"`
+	OSVersion        *string `json:"os_version,omitempty"`
+	// one of windows, macos, linux, ios, android
+	Platform string `json:"platform"`
+	UUID     string `json:"uuid"`
+}
+
+// DeviceGroup is the DeviceGroup schema of the API
+type DeviceGroup struct {
+	CreatedAt   time.Time `json:"created_at"`
+	Description string    `json:"description"`
+	DeviceCount int       `json:"device_count"`
+	// Named rules a device must all match to belong to the group
+	Filters map[string]string `json:"filters,omitempty"`
+	ID      string            `json:"id"`
+	Labels  map[string]string `json:"labels,omitempty"`
+	Name    string            `json:"name"`
+	// Increases with every change; sent as the ETag and matched by If-Match
+	Revision  int       `json:"revision"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// DeviceGroupCreate is the DeviceGroupCreate schema of the API
+type DeviceGroupCreate struct {
+	Description *string `json:"description,omitempty"`
+	// Named rules a device must all match to belong to the group
+	Filters map[string]string `json:"filters,omitempty"`
+	Labels  map[string]string `json:"labels,omitempty"`
+	Name    *string           `json:"name,omitempty"`
+}
+
+// DeviceLiveQuery is the DeviceLiveQuery schema of the API
+//
+// A live query the device has yet to answer.
+type DeviceLiveQuery struct {
+	CampaignID string `json:"campaign_id"`
+	Query      string `json:"query"`
+}
+
+// DeviceUpdate is the DeviceUpdate schema of the API
+type DeviceUpdate struct {
+	Hostname   *string           `json:"hostname,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	OSVersion  *string           `json:"os_version,omitempty"`
+	SystemInfo map[string]string `json:"system_info,omitempty"`
+}
+
+// EnrollmentSecret is the EnrollmentSecret schema of the API
+type EnrollmentSecret struct {
+	CreatedAt time.Time  `json:"created_at"`
+	CreatedBy string     `json:"created_by,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	GroupID   string     `json:"group_id,omitempty"`
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	// Increases with every change; sent as the ETag and matched by If-Match
+	Revision  int        `json:"revision"`
+	RotatedAt *time.Time `json:"rotated_at,omitempty"`
+	// Only returned when the secret is created or rotated
+	Secret string `json:"secret,omitempty"`
+}
+
+// GroupMembershipExplanationRuleCondition is the GroupMembershipExplanationRuleCondition schema of the API
+type GroupMembershipExplanationRuleCondition struct {
+	Actual   string   `json:"actual,omitempty"`
+	Field    string   `json:"field,omitempty"`
+	Matched  bool     `json:"matched,omitempty"`
+	Operator string   `json:"operator,omitempty"`
+	Present  bool     `json:"present,omitempty"`
+	Values   []string `json:"values,omitempty"`
+}
+
+// GroupMembershipExplanationRule is the GroupMembershipExplanationRule schema of the API
+type GroupMembershipExplanationRule struct {
+	Conditions []GroupMembershipExplanationRuleCondition `json:"conditions,omitempty"`
+	Error      string                                    `json:"error,omitempty"`
+	Expression string                                    `json:"expression,omitempty"`
+	Matched    bool                                      `json:"matched,omitempty"`
+	Name       string                                    `json:"name,omitempty"`
+}
+
+// GroupMembershipExplanation is the GroupMembershipExplanation schema of the API
+type GroupMembershipExplanation struct {
+	DeviceID string `json:"device_id"`
+	// Membership is managed by filters
+	Dynamic bool   `json:"dynamic"`
+	GroupID string `json:"group_id"`
+	// Device matches every filter rule
+	Matched bool `json:"matched"`
+	// Device is currently in the group
+	Member bool                             `json:"member"`
+	Rules  []GroupMembershipExplanationRule `json:"rules,omitempty"`
+}
+
+// HealthStatusComponent is the HealthStatusComponent schema of the API
+type HealthStatusComponent struct {
+	Error     string  `json:"error,omitempty"`
+	LatencyMS float64 `json:"latency_ms,omitempty"`
+	// A failing optional component degrades the service without making it unready
+	Optional bool `json:"optional,omitempty"`
+	// one of up, down
+	Status string `json:"status,omitempty"`
+}
+
+// HealthStatus is the HealthStatus schema of the API
+type HealthStatus struct {
+	Components map[string]HealthStatusComponent `json:"components,omitempty"`
+	// one of healthy, degraded, unhealthy
+	Status    string    `json:"status"`
+	Timestamp time.Time `json:"timestamp"`
+	Version   string    `json:"version"`
+}
+
+// LicenseInfo is the LicenseInfo schema of the API
+type LicenseInfo struct {
+	// -1 is unlimited
+	DeviceLimit       int        `json:"device_limit"`
+	DevicesEnrolled   int        `json:"devices_enrolled"`
+	ExpiresAt         *time.Time `json:"expires_at,omitempty"`
+	Features          []string   `json:"features,omitempty"`
+	GracePeriodEndsAt *time.Time `json:"grace_period_ends_at,omitempty"`
+	InGracePeriod     bool       `json:"in_grace_period"`
+	Organization      string     `json:"organization,omitempty"`
+	// one of community, professional, enterprise
+	Tier string `json:"tier"`
+	// False once the license is past its grace period
+	Valid    bool     `json:"valid"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// ListPage is the ListPage schema of the API
+type ListPage struct {
+	// Items in this page
+	Count int `json:"count"`
+	// Cursor of the next page, absent on the last page
+	NextCursor string `json:"next_cursor,omitempty"`
+	// Items matching the filters across every page
+	Total int `json:"total"`
+}
+
+// LiveQueryResult is the LiveQueryResult schema of the API
+type LiveQueryResult struct {
+	DeviceID    string              `json:"device_id"`
+	DurationMS  int                 `json:"duration_ms,omitempty"`
+	Error       string              `json:"error,omitempty"`
+	RespondedAt *time.Time          `json:"responded_at,omitempty"`
+	Rows        []map[string]string `json:"rows,omitempty"`
+	// one of pending, completed, failed, timed_out
+	Status string `json:"status"`
+}
+
+// LiveQueryCampaign is the LiveQueryCampaign schema of the API
+type LiveQueryCampaign struct {
+	CompletedAt      *time.Time        `json:"completed_at,omitempty"`
+	CreatedAt        time.Time         `json:"created_at"`
+	CreatedBy        string            `json:"created_by,omitempty"`
+	DevicesResponded int               `json:"devices_responded"`
+	DevicesTotal     int               `json:"devices_total"`
+	ExpiresAt        time.Time         `json:"expires_at"`
+	ID               string            `json:"id"`
+	Query            string            `json:"query"`
+	Results          []LiveQueryResult `json:"results,omitempty"`
+	// one of running, completed, timed_out
+	Status string `json:"status"`
+}
+
+// Message is the Message schema of the API
+type Message struct {
+	Message string `json:"message"`
+}
+
+// Policy is the Policy schema of the API
+type Policy struct {
+	Configuration map[string]interface{} `json:"configuration,omitempty"`
+	CreatedAt     time.Time              `json:"created_at"`
+	Description   string                 `json:"description"`
+	Enabled       bool                   `json:"enabled"`
+	ID            string                 `json:"id"`
+	Name          string                 `json:"name"`
+	// one of windows, macos, linux, ios, android, all
+	Platform string `json:"platform"`
+	// Increases with every change; sent as the ETag and matched by If-Match
+	Revision  int       `json:"revision"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// PolicyCreate is the PolicyCreate schema of the API
+type PolicyCreate struct {
+	Configuration map[string]interface{} `json:"configuration,omitempty"`
+	Description   *string                `json:"description,omitempty"`
+	Name          string                 `json:"name"`
+	// one of windows, macos, linux, ios, android, all
+	Platform string `json:"platform"`
+}
+
+// PolicyResult is the PolicyResult schema of the API
+//
+// A run of identical results of a device for a policy.
+type PolicyResult struct {
+	DeviceID        string    `json:"device_id"`
+	FirstReportedAt time.Time `json:"first_reported_at"`
+	LastReportedAt  time.Time `json:"last_reported_at"`
+	Message         string    `json:"message,omitempty"`
+	PolicyID        string    `json:"policy_id"`
+	// Number of check-ins that reported this result
+	Reports int `json:"reports"`
+	// one of pass, fail, error
+	Status string `json:"status"`
+}
+
+// PolicyUpdate is the PolicyUpdate schema of the API
+type PolicyUpdate struct {
+	Configuration map[string]interface{} `json:"configuration,omitempty"`
+	Description   *string                `json:"description,omitempty"`
+	Enabled       *bool                  `json:"enabled,omitempty"`
+	Name          *string                `json:"name,omitempty"`
+}
+
+// UserCreate is the UserCreate schema of the API
+type UserCreate struct {
+	// Limits the user to these device groups; not allowed for admins
+	DeviceGroupIDs []string `json:"device_group_ids,omitempty"`
+	Email          string   `json:"email"`
+	Name           *string  `json:"name,omitempty"`
+	Password       string   `json:"password"`
+	// one of admin, maintainer, observer, device-technician
+	Role string `json:"role"`
+}
+
+// UserUpdate is the UserUpdate schema of the API
+type UserUpdate struct {
+	// Required when users change their own password
+	CurrentPassword *string `json:"current_password,omitempty"`
+	// Replaces the device groups the user is limited to; an empty list lifts the
+	// limit
+	DeviceGroupIDs []string `json:"device_group_ids,omitempty"`
+	Name           *string  `json:"name,omitempty"`
+	Password       *string  `json:"password,omitempty"`
+	// one of admin, maintainer, observer, device-technician
+	Role *string `json:"role,omitempty"`
+}
+
+// ListApplicationRequestsResponse is the ListApplicationRequestsResponse schema of the API
+type ListApplicationRequestsResponse struct {
+	ListPage
+	Requests []ApplicationRequest `json:"requests,omitempty"`
+}
+
+// ListApplicationRequestsParams are the query parameters of listApplicationRequests
+type ListApplicationRequestsParams struct {
+	// Comma-separated fields to sort by, each descending with a leading "-"
+	Sort string
+	// The next_cursor of the previous page, requested with the same sort
+	Cursor string
+	Limit  int
+	// Filters as "field=value" for equality or "field[op]=value", where op is eq,
+	// ne, in or nin (comma-separated values), lt, lte, gt, gte, or, on strings,
+	// contains and prefix (case-insensitive)
+	Filters map[string]string
+}
+
+func (p *ListApplicationRequestsParams) values() url.Values {
+	query := url.Values{}
+	if p == nil {
+		return query
+	}
+	if p.Sort != "" {
+		query.Set("sort", p.Sort)
+	}
+	if p.Cursor != "" {
+		query.Set("cursor", p.Cursor)
+	}
+	if p.Limit != 0 {
+		query.Set("limit", strconv.Itoa(p.Limit))
+	}
+	for key, value := range p.Filters {
+		query.Set(key, value)
+	}
+	return query
+}
+
+// ListApplicationsResponse is the ListApplicationsResponse schema of the API
+type ListApplicationsResponse struct {
+	ListPage
+	Applications []Application `json:"applications,omitempty"`
+}
+
+// ListApplicationsParams are the query parameters of listApplications
+type ListApplicationsParams struct {
+	// Comma-separated fields to sort by, each descending with a leading "-"
+	Sort string
+	// The next_cursor of the previous page, requested with the same sort
+	Cursor string
+	Limit  int
+	// Filters as "field=value" for equality or "field[op]=value", where op is eq,
+	// ne, in or nin (comma-separated values), lt, lte, gt, gte, or, on strings,
+	// contains and prefix (case-insensitive)
+	Filters map[string]string
+}
+
+func (p *ListApplicationsParams) values() url.Values {
+	query := url.Values{}
+	if p == nil {
+		return query
+	}
+	if p.Sort != "" {
+		query.Set("sort", p.Sort)
+	}
+	if p.Cursor != "" {
+		query.Set("cursor", p.Cursor)
+	}
+	if p.Limit != 0 {
+		query.Set("limit", strconv.Itoa(p.Limit))
+	}
+	for key, value := range p.Filters {
+		query.Set(key, value)
+	}
+	return query
+}
+
+// AddApplicationRequest is the multipart form of addApplication
+type AddApplicationRequest struct {
+	Name    string
+	Package io.Reader
+	// PackageFilename is the file name sent with Package
+	PackageFilename string
+	// one of windows, macos, linux, ios, android
+	Platform string
+	Version  string
+}
+
+func (f AddApplicationRequest) parts() []formPart {
+	var parts []formPart
+	if f.Name != "" {
+		parts = append(parts, formPart{name: "name", value: f.Name})
+	}
+	if f.Platform != "" {
+		parts = append(parts, formPart{name: "platform", value: f.Platform})
+	}
+	if f.Version != "" {
+		parts = append(parts, formPart{name: "version", value: f.Version})
+	}
+	parts = append(parts, formPart{name: "package", filename: f.PackageFilename, content: f.Package})
+	return parts
+}
+
+// CheckApplicationUpdatesResponse is the CheckApplicationUpdatesResponse schema of the API
+type CheckApplicationUpdatesResponse struct {
+	Checked          int    `json:"checked"`
+	Error            string `json:"error,omitempty"`
+	UpdatesAvailable int    `json:"updates_available"`
+}
+
+// UpdateApplicationRequest is the UpdateApplicationRequest schema of the API
+type UpdateApplicationRequest struct {
+	Name    *string `json:"name,omitempty"`
+	Version *string `json:"version,omitempty"`
+}
+
+// ListApplicationPublicationsResponse is the ListApplicationPublicationsResponse schema of the API
+type ListApplicationPublicationsResponse struct {
+	ApplicationID string                   `json:"application_id,omitempty"`
+	Publications  []ApplicationPublication `json:"publications,omitempty"`
+}
+
+// PublishApplicationRequest is the PublishApplicationRequest schema of the API
+type PublishApplicationRequest struct {
+	// Require an approved request before devices install the application
+	Restricted *bool `json:"restricted,omitempty"`
+}
+
+// ListAuditEntriesParams are the query parameters of listAuditEntries
+type ListAuditEntriesParams struct {
+	ActorID   string
+	ActorType string
+	// Exact action, or a prefix ending with a dot such as "device."
+	Action     string
+	TargetType string
+	TargetID   string
+	Outcome    string
+	// Earliest time included, RFC 3339
+	Since *time.Time
+	// Time before which entries are included, RFC 3339
+	Until  *time.Time
+	Limit  int
+	Cursor string
+}
+
+func (p *ListAuditEntriesParams) values() url.Values {
+	query := url.Values{}
+	if p == nil {
+		return query
+	}
+	if p.ActorID != "" {
+		query.Set("actor_id", p.ActorID)
+	}
+	if p.ActorType != "" {
+		query.Set("actor_type", p.ActorType)
+	}
+	if p.Action != "" {
+		query.Set("action", p.Action)
+	}
+	if p.TargetType != "" {
+		query.Set("target_type", p.TargetType)
+	}
+	if p.TargetID != "" {
+		query.Set("target_id", p.TargetID)
+	}
+	if p.Outcome != "" {
+		query.Set("outcome", p.Outcome)
+	}
+	if p.Since != nil {
+		query.Set("since", p.Since.Format(time.RFC3339Nano))
+	}
+	if p.Until != nil {
+		query.Set("until", p.Until.Format(time.RFC3339Nano))
+	}
+	if p.Limit != 0 {
+		query.Set("limit", strconv.Itoa(p.Limit))
+	}
+	if p.Cursor != "" {
+		query.Set("cursor", p.Cursor)
+	}
+	return query
+}
+
+// LoginRequest is the LoginRequest schema of the API
+type LoginRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// RefreshTokenRequest is the RefreshTokenRequest schema of the API
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// ListBulkOperationsResponse is the ListBulkOperationsResponse schema of the API
+type ListBulkOperationsResponse struct {
+	ListPage
+	Operations []BulkOperation `json:"operations,omitempty"`
+}
+
+// ListBulkOperationsParams are the query parameters of listBulkOperations
+type ListBulkOperationsParams struct {
+	// Comma-separated fields to sort by, each descending with a leading "-"
+	Sort string
+	// The next_cursor of the previous page, requested with the same sort
+	Cursor string
+	Limit  int
+	// Filters as "field=value" for equality or "field[op]=value", where op is eq,
+	// ne, in or nin (comma-separated values), lt, lte, gt, gte, or, on strings,
+	// contains and prefix (case-insensitive)
+	Filters map[string]string
+}
+
+func (p *ListBulkOperationsParams) values() url.Values {
+	query := url.Values{}
+	if p == nil {
+		return query
+	}
+	if p.Sort != "" {
+		query.Set("sort", p.Sort)
+	}
+	if p.Cursor != "" {
+		query.Set("cursor", p.Cursor)
+	}
+	if p.Limit != 0 {
+		query.Set("limit", strconv.Itoa(p.Limit))
+	}
+	for key, value := range p.Filters {
+		query.Set(key, value)
+	}
+	return query
+}
+
+// CreateBulkOperationRequest is the CreateBulkOperationRequest schema of the API
+type CreateBulkOperationRequest struct {
+	Action BulkAction `json:"action"`
+	DryRun *bool      `json:"dry_run,omitempty"`
+	// Matches the listed devices, the members of the groups and the devices
+	// carrying every label, or every device without those
+	Selector DeviceSelector `json:"selector"`
+}
+
+// CreateBulkOperationResponse holds the body of the status createBulkOperation answered with
+type CreateBulkOperationResponse struct {
+	StatusCode int
+	JSON200    *BulkOperationPreview
+	JSON202    *BulkOperation
+}
+
+// ListCommandsResponse is the ListCommandsResponse schema of the API
+type ListCommandsResponse struct {
+	ListPage
+	Commands []DeviceCommand `json:"commands,omitempty"`
+}
+
+// ListCommandsParams are the query parameters of listCommands
+type ListCommandsParams struct {
+	// Comma-separated fields to sort by, each descending with a leading "-"
+	Sort string
+	// The next_cursor of the previous page, requested with the same sort
+	Cursor string
+	Limit  int
+	// Filters as "field=value" for equality or "field[op]=value", where op is eq,
+	// ne, in or nin (comma-separated values), lt, lte, gt, gte, or, on strings,
+	// contains and prefix (case-insensitive)
+	Filters map[string]string
+}
+
+func (p *ListCommandsParams) values() url.Values {
+	query := url.Values{}
+	if p == nil {
+		return query
+	}
+	if p.Sort != "" {
+		query.Set("sort", p.Sort)
+	}
+	if p.Cursor != "" {
+		query.Set("cursor", p.Cursor)
+	}
+	if p.Limit != 0 {
+		query.Set("limit", strconv.Itoa(p.Limit))
+	}
+	for key, value := range p.Filters {
+		query.Set(key, value)
+	}
+	return query
+}
+
+// ListDeviceGroupsResponse is the ListDeviceGroupsResponse schema of the API
+type ListDeviceGroupsResponse struct {
+	ListPage
+	DeviceGroups []DeviceGroup `json:"device_groups,omitempty"`
+}
+
+// ListDeviceGroupsParams are the query parameters of listDeviceGroups
+type ListDeviceGroupsParams struct {
+	// Comma-separated fields to sort by, each descending with a leading "-"
+	Sort string
+	// The next_cursor of the previous page, requested with the same sort
+	Cursor string
+	Limit  int
+	// Filters as "field=value" for equality or "field[op]=value", where op is eq,
+	// ne, in or nin (comma-separated values), lt, lte, gt, gte, or, on strings,
+	// contains and prefix (case-insensitive)
+	Filters map[string]string
+}
+
+func (p *ListDeviceGroupsParams) values() url.Values {
+	query := url.Values{}
+	if p == nil {
+		return query
+	}
+	if p.Sort != "" {
+		query.Set("sort", p.Sort)
+	}
+	if p.Cursor != "" {
+		query.Set("cursor", p.Cursor)
+	}
+	if p.Limit != 0 {
+		query.Set("limit", strconv.Itoa(p.Limit))
+	}
+	for key, value := range p.Filters {
+		query.Set(key, value)
+	}
+	return query
+}
+
+// ListDeviceGroupDevicesResponse is the ListDeviceGroupDevicesResponse schema of the API
+type ListDeviceGroupDevicesResponse struct {
+	ListPage
+	Devices []Device `json:"devices,omitempty"`
+}
+
+// ListDeviceGroupDevicesParams are the query parameters of listDeviceGroupDevices
+type ListDeviceGroupDevicesParams struct {
+	// Comma-separated fields to sort by, each descending with a leading "-"
+	Sort string
+	// The next_cursor of the previous page, requested with the same sort
+	Cursor string
+	Limit  int
+	// Filters as "field=value" for equality or "field[op]=value", where op is eq,
+	// ne, in or nin (comma-separated values), lt, lte, gt, gte, or, on strings,
+	// contains and prefix (case-insensitive)
+	Filters map[string]string
+}
+
+func (p *ListDeviceGroupDevicesParams) values() url.Values {
+	query := url.Values{}
+	if p == nil {
+		return query
+	}
+	if p.Sort != "" {
+		query.Set("sort", p.Sort)
+	}
+	if p.Cursor != "" {
+		query.Set("cursor", p.Cursor)
+	}
+	if p.Limit != 0 {
+		query.Set("limit", strconv.Itoa(p.Limit))
+	}
+	for key, value := range p.Filters {
+		query.Set(key, value)
+	}
+	return query
+}
+
+// DeviceListApplicationsResponse is the DeviceListApplicationsResponse schema of the API
+type DeviceListApplicationsResponse struct {
+	Applications []DeviceApplication `json:"applications,omitempty"`
+	DeviceID     string              `json:"device_id,omitempty"`
+}
+
+// DeviceGetCatalogResponse is the DeviceGetCatalogResponse schema of the API
+type DeviceGetCatalogResponse struct {
+	Applications []CatalogApplication `json:"applications,omitempty"`
+	DeviceID     string               `json:"device_id,omitempty"`
+}
+
+// DeviceListApplicationRequestsResponse is the DeviceListApplicationRequestsResponse schema of the API
+type DeviceListApplicationRequestsResponse struct {
+	DeviceID string               `json:"device_id,omitempty"`
+	Requests []ApplicationRequest `json:"requests,omitempty"`
+}
+
+// DeviceRequestApplicationRequest is the DeviceRequestApplicationRequest schema of the API
+type DeviceRequestApplicationRequest struct {
+	Reason *string `json:"reason,omitempty"`
+}
+
+// DeviceCheckinResponse is the DeviceCheckinResponse schema of the API
+type DeviceCheckinResponse struct {
+	Device  *Device           `json:"device,omitempty"`
+	Message string            `json:"message,omitempty"`
+	Queries []DeviceLiveQuery `json:"queries,omitempty"`
+}
+
+// DeviceCheckinRequestQueryResultsPolicy is the DeviceCheckinRequestQueryResultsPolicy schema of the API
+type DeviceCheckinRequestQueryResultsPolicy struct {
+	Message  *string `json:"message,omitempty"`
+	PolicyID string  `json:"policy_id"`
+	// one of pass, fail, error
+	Status string `json:"status"`
+}
+
+// DeviceCheckinRequestQueryResults is the DeviceCheckinRequestQueryResults schema of the API
+//
+// Results of the device's queries.
+type DeviceCheckinRequestQueryResults struct {
+	Policies []DeviceCheckinRequestQueryResultsPolicy `json:"policies,omitempty"`
+}
+
+// DeviceCheckinRequest is the DeviceCheckinRequest schema of the API
+type DeviceCheckinRequest struct {
+	OSVersion *string `json:"os_version,omitempty"`
+	// Results of the device's queries
+	QueryResults *DeviceCheckinRequestQueryResults `json:"query_results,omitempty"`
+	SystemInfo   map[string]string                 `json:"system_info,omitempty"`
+}
+
+// DeviceFetchCommandsResponse is the DeviceFetchCommandsResponse schema of the API
+type DeviceFetchCommandsResponse struct {
+	Commands []DeviceCommand `json:"commands,omitempty"`
+	DeviceID string          `json:"device_id,omitempty"`
+}
+
+// DeviceReportCommandResultRequest is the DeviceReportCommandResultRequest schema of the API
+type DeviceReportCommandResultRequest struct {
+	Error  *string                `json:"error,omitempty"`
+	Result map[string]interface{} `json:"result,omitempty"`
+	// one of completed, failed
+	Status string `json:"status"`
+}
+
+// DeviceEnrollResponse is the DeviceEnrollResponse schema of the API
+type DeviceEnrollResponse struct {
+	Device
+	// Bearer token for the device API
+	DeviceToken string `json:"device_token,omitempty"`
+}
+
+// DeviceListPoliciesResponse is the DeviceListPoliciesResponse schema of the API
+type DeviceListPoliciesResponse struct {
+	DeviceID string   `json:"device_id,omitempty"`
+	Policies []Policy `json:"policies,omitempty"`
+}
+
+// DeviceListLiveQueriesResponse is the DeviceListLiveQueriesResponse schema of the API
+type DeviceListLiveQueriesResponse struct {
+	DeviceID string            `json:"device_id,omitempty"`
+	Queries  []DeviceLiveQuery `json:"queries,omitempty"`
+}
+
+// DeviceReportLiveQueryResultRequest is the DeviceReportLiveQueryResultRequest schema of the API
+type DeviceReportLiveQueryResultRequest struct {
+	DurationMS *int                `json:"duration_ms,omitempty"`
+	Error      *string             `json:"error,omitempty"`
+	Rows       []map[string]string `json:"rows,omitempty"`
+}
+
+// DeviceRotateTokenResponse is the DeviceRotateTokenResponse schema of the API
+type DeviceRotateTokenResponse struct {
+	DeviceID    string `json:"device_id,omitempty"`
+	DeviceToken string `json:"device_token,omitempty"`
+}
+
+// ListDevicesResponse is the ListDevicesResponse schema of the API
+type ListDevicesResponse struct {
+	ListPage
+	Devices []Device `json:"devices,omitempty"`
+}
+
+// ListDevicesParams are the query parameters of listDevices
+type ListDevicesParams struct {
+	// Matches hostnames and UUIDs
+	Search string
+	// Comma-separated fields to sort by, each descending with a leading "-"
+	Sort string
+	// The next_cursor of the previous page, requested with the same sort
+	Cursor string
+	Limit  int
+	// Filters as "field=value" for equality or "field[op]=value", where op is eq,
+	// ne, in or nin (comma-separated values), lt, lte, gt, gte, or, on strings,
+	// contains and prefix (case-insensitive)
+	Filters map[string]string
+}
+
+func (p *ListDevicesParams) values() url.Values {
+	query := url.Values{}
+	if p == nil {
+		return query
+	}
+	if p.Search != "" {
+		query.Set("search", p.Search)
+	}
+	if p.Sort != "" {
+		query.Set("sort", p.Sort)
+	}
+	if p.Cursor != "" {
+		query.Set("cursor", p.Cursor)
+	}
+	if p.Limit != 0 {
+		query.Set("limit", strconv.Itoa(p.Limit))
+	}
+	for key, value := range p.Filters {
+		query.Set(key, value)
+	}
+	return query
+}
+
+// EnrollDeviceResponse is the EnrollDeviceResponse schema of the API
+type EnrollDeviceResponse struct {
+	Device
+	// Bearer token for the device API
+	DeviceToken string `json:"device_token,omitempty"`
+}
+
+// ListDeviceCommandsResponse is the ListDeviceCommandsResponse schema of the API
+type ListDeviceCommandsResponse struct {
+	ListPage
+	Commands []DeviceCommand `json:"commands,omitempty"`
+}
+
+// ListDeviceCommandsParams are the query parameters of listDeviceCommands
+type ListDeviceCommandsParams struct {
+	// Comma-separated fields to sort by, each descending with a leading "-"
+	Sort string
+	// The next_cursor of the previous page, requested with the same sort
+	Cursor string
+	Limit  int
+	// Filters as "field=value" for equality or "field[op]=value", where op is eq,
+	// ne, in or nin (comma-separated values), lt, lte, gt, gte, or, on strings,
+	// contains and prefix (case-insensitive)
+	Filters map[string]string
+}
+
+func (p *ListDeviceCommandsParams) values() url.Values {
+	query := url.Values{}
+	if p == nil {
+		return query
+	}
+	if p.Sort != "" {
+		query.Set("sort", p.Sort)
+	}
+	if p.Cursor != "" {
+		query.Set("cursor", p.Cursor)
+	}
+	if p.Limit != 0 {
+		query.Set("limit", strconv.Itoa(p.Limit))
+	}
+	for key, value := range p.Filters {
+		query.Set(key, value)
+	}
+	return query
+}
+
+// QueueDeviceCommandRequest is the QueueDeviceCommandRequest schema of the API
+type QueueDeviceCommandRequest struct {
+	// one of restart, shutdown, lock, wipe, collect_logs, run_osquery,
+	// install_app, uninstall_app
+	Command string `json:"command"`
+	// Seconds until the command expires (default 86400)
+	ExpiresIn  *int                   `json:"expires_in,omitempty"`
+	Parameters map[string]interface{} `json:"parameters,omitempty"`
+}
+
+// GetDeviceComplianceResponse is the GetDeviceComplianceResponse schema of the API
+type GetDeviceComplianceResponse struct {
+	DeviceID string         `json:"device_id,omitempty"`
+	Results  []PolicyResult `json:"results,omitempty"`
+}
+
+// GetPolicyResultHistoryResponse is the GetPolicyResultHistoryResponse schema of the API
+type GetPolicyResultHistoryResponse struct {
+	DeviceID string         `json:"device_id,omitempty"`
+	History  []PolicyResult `json:"history,omitempty"`
+	PolicyID string         `json:"policy_id,omitempty"`
+}
+
+// QueryDeviceRequest is the QueryDeviceRequest schema of the API
+type QueryDeviceRequest struct {
+	Query string `json:"query"`
+	// Seconds to wait for devices (default 300, maximum 3600)
+	Timeout *int `json:"timeout,omitempty"`
+}
+
+// DownloadSignedApplicationPackageParams are the query parameters of downloadSignedApplicationPackage
+type DownloadSignedApplicationPackageParams struct {
+	// Expiry of the URL as a Unix timestamp
+	Expires   int
+	Signature string
+}
+
+func (p *DownloadSignedApplicationPackageParams) values() url.Values {
+	query := url.Values{}
+	if p == nil {
+		return query
+	}
+	if p.Expires != 0 {
+		query.Set("expires", strconv.Itoa(p.Expires))
+	}
+	if p.Signature != "" {
+		query.Set("signature", p.Signature)
+	}
+	return query
+}
+
+// ListEnrollmentSecretsResponse is the ListEnrollmentSecretsResponse schema of the API
+type ListEnrollmentSecretsResponse struct {
+	ListPage
+	Secrets []EnrollmentSecret `json:"secrets,omitempty"`
+}
+
+// ListEnrollmentSecretsParams are the query parameters of listEnrollmentSecrets
+type ListEnrollmentSecretsParams struct {
+	// Comma-separated fields to sort by, each descending with a leading "-"
+	Sort string
+	// The next_cursor of the previous page, requested with the same sort
+	Cursor string
+	Limit  int
+	// Filters as "field=value" for equality or "field[op]=value", where op is eq,
+	// ne, in or nin (comma-separated values), lt, lte, gt, gte, or, on strings,
+	// contains and prefix (case-insensitive)
+	Filters map[string]string
+}
+
+func (p *ListEnrollmentSecretsParams) values() url.Values {
+	query := url.Values{}
+	if p == nil {
+		return query
+	}
+	if p.Sort != "" {
+		query.Set("sort", p.Sort)
+	}
+	if p.Cursor != "" {
+		query.Set("cursor", p.Cursor)
+	}
+	if p.Limit != 0 {
+		query.Set("limit", strconv.Itoa(p.Limit))
+	}
+	for key, value := range p.Filters {
+		query.Set(key, value)
+	}
+	return query
+}
+
+// CreateEnrollmentSecretRequest is the CreateEnrollmentSecretRequest schema of the API
+type CreateEnrollmentSecretRequest struct {
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// Device group that devices enrolling with this secret join
+	GroupID *string `json:"group_id,omitempty"`
+	Name    string  `json:"name"`
+}
+
+// UpdateLicenseRequest is the UpdateLicenseRequest schema of the API
+type UpdateLicenseRequest struct {
+	// Signed license key
+	Key string `json:"key"`
+}
+
+// CreateLiveQueryRequestTargets is the CreateLiveQueryRequestTargets schema of the API
+type CreateLiveQueryRequestTargets struct {
+	DeviceIDs []string          `json:"device_ids,omitempty"`
+	GroupIDs  []string          `json:"group_ids,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
+// CreateLiveQueryRequest is the CreateLiveQueryRequest schema of the API
+type CreateLiveQueryRequest struct {
+	Query   string                        `json:"query"`
+	Targets CreateLiveQueryRequestTargets `json:"targets"`
+	// Seconds to wait for devices (default 300, maximum 3600)
+	Timeout *int `json:"timeout,omitempty"`
+}
+
+// ListPoliciesResponse is the ListPoliciesResponse schema of the API
+type ListPoliciesResponse struct {
+	ListPage
+	Policies []Policy `json:"policies,omitempty"`
+}
+
+// ListPoliciesParams are the query parameters of listPolicies
+type ListPoliciesParams struct {
+	// Comma-separated fields to sort by, each descending with a leading "-"
+	Sort string
+	// The next_cursor of the previous page, requested with the same sort
+	Cursor string
+	Limit  int
+	// Filters as "field=value" for equality or "field[op]=value", where op is eq,
+	// ne, in or nin (comma-separated values), lt, lte, gt, gte, or, on strings,
+	// contains and prefix (case-insensitive)
+	Filters map[string]string
+}
+
+func (p *ListPoliciesParams) values() url.Values {
+	query := url.Values{}
+	if p == nil {
+		return query
+	}
+	if p.Sort != "" {
+		query.Set("sort", p.Sort)
+	}
+	if p.Cursor != "" {
+		query.Set("cursor", p.Cursor)
+	}
+	if p.Limit != 0 {
+		query.Set("limit", strconv.Itoa(p.Limit))
+	}
+	for key, value := range p.Filters {
+		query.Set(key, value)
+	}
+	return query
+}
+
+// ListPolicyDevicesResponse is the ListPolicyDevicesResponse schema of the API
+type ListPolicyDevicesResponse struct {
+	ListPage
+	Devices []Device `json:"devices,omitempty"`
+}
+
+// ListPolicyDevicesParams are the query parameters of listPolicyDevices
+type ListPolicyDevicesParams struct {
+	// Comma-separated fields to sort by, each descending with a leading "-"
+	Sort string
+	// The next_cursor of the previous page, requested with the same sort
+	Cursor string
+	Limit  int
+	// Filters as "field=value" for equality or "field[op]=value", where op is eq,
+	// ne, in or nin (comma-separated values), lt, lte, gt, gte, or, on strings,
+	// contains and prefix (case-insensitive)
+	Filters map[string]string
+}
+
+func (p *ListPolicyDevicesParams) values() url.Values {
+	query := url.Values{}
+	if p == nil {
+		return query
+	}
+	if p.Sort != "" {
+		query.Set("sort", p.Sort)
+	}
+	if p.Cursor != "" {
+		query.Set("cursor", p.Cursor)
+	}
+	if p.Limit != 0 {
+		query.Set("limit", strconv.Itoa(p.Limit))
+	}
+	for key, value := range p.Filters {
+		query.Set(key, value)
+	}
+	return query
+}
+
+// ListPolicyGroupsResponse is the ListPolicyGroupsResponse schema of the API
+type ListPolicyGroupsResponse struct {
+	ListPage
+	Groups []DeviceGroup `json:"groups,omitempty"`
+}
+
+// ListPolicyGroupsParams are the query parameters of listPolicyGroups
+type ListPolicyGroupsParams struct {
+	// Comma-separated fields to sort by, each descending with a leading "-"
+	Sort string
+	// The next_cursor of the previous page, requested with the same sort
+	Cursor string
+	Limit  int
+	// Filters as "field=value" for equality or "field[op]=value", where op is eq,
+	// ne, in or nin (comma-separated values), lt, lte, gt, gte, or, on strings,
+	// contains and prefix (case-insensitive)
+	Filters map[string]string
+}
+
+func (p *ListPolicyGroupsParams) values() url.Values {
+	query := url.Values{}
+	if p == nil {
+		return query
+	}
+	if p.Sort != "" {
+		query.Set("sort", p.Sort)
+	}
+	if p.Cursor != "" {
+		query.Set("cursor", p.Cursor)
+	}
+	if p.Limit != 0 {
+		query.Set("limit", strconv.Itoa(p.Limit))
+	}
+	for key, value := range p.Filters {
+		query.Set(key, value)
+	}
+	return query
+}
+
+// ListUsersResponse is the ListUsersResponse schema of the API
+type ListUsersResponse struct {
+	ListPage
+	Users []User `json:"users,omitempty"`
+}
+
+// ListUsersParams are the query parameters of listUsers
+type ListUsersParams struct {
+	// Comma-separated fields to sort by, each descending with a leading "-"
+	Sort string
+	// The next_cursor of the previous page, requested with the same sort
+	Cursor string
+	Limit  int
+	// Filters as "field=value" for equality or "field[op]=value", where op is eq,
+	// ne, in or nin (comma-separated values), lt, lte, gt, gte, or, on strings,
+	// contains and prefix (case-insensitive)
+	Filters map[string]string
+}
+
+func (p *ListUsersParams) values() url.Values {
+	query := url.Values{}
+	if p == nil {
+		return query
+	}
+	if p.Sort != "" {
+		query.Set("sort", p.Sort)
+	}
+	if p.Cursor != "" {
+		query.Set("cursor", p.Cursor)
+	}
+	if p.Limit != 0 {
+		query.Set("limit", strconv.Itoa(p.Limit))
+	}
+	for key, value := range p.Filters {
+		query.Set(key, value)
+	}
+	return query
+}
+
+// ListApplicationRequests calls GET /api/v1/application-requests: List application requests
+func (c *Client) ListApplicationRequests(ctx context.Context, params *ListApplicationRequestsParams) (*ListApplicationRequestsResponse, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/application-requests", params.values(), nil)
+	if err != nil {
+		return nil, err
+	}
+	var out ListApplicationRequestsResponse
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetApplicationRequest calls GET /api/v1/application-requests/{requestId}: Get application request
+func (c *Client) GetApplicationRequest(ctx context.Context, requestID string) (*ApplicationRequest, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/application-requests/"+url.PathEscape(requestID), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out ApplicationRequest
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ApproveApplicationRequest calls POST /api/v1/application-requests/{requestId}/approve: Approve application request
+func (c *Client) ApproveApplicationRequest(ctx context.Context, requestID string, body ApplicationDecision) (*ApplicationRequest, error) {
+	resp, err := c.do(ctx, http.MethodPost, "/application-requests/"+url.PathEscape(requestID)+"/approve", nil, body)
+	if err != nil {
+		return nil, err
+	}
+	var out ApplicationRequest
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DenyApplicationRequest calls POST /api/v1/application-requests/{requestId}/deny: Deny application request
+func (c *Client) DenyApplicationRequest(ctx context.Context, requestID string, body ApplicationDecision) (*ApplicationRequest, error) {
+	resp, err := c.do(ctx, http.MethodPost, "/application-requests/"+url.PathEscape(requestID)+"/deny", nil, body)
+	if err != nil {
+		return nil, err
+	}
+	var out ApplicationRequest
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListApplications calls GET /api/v1/applications: List applications
+func (c *Client) ListApplications(ctx context.Context, params *ListApplicationsParams) (*ListApplicationsResponse, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/applications", params.values(), nil)
+	if err != nil {
+		return nil, err
+	}
+	var out ListApplicationsResponse
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// AddApplication calls POST /api/v1/applications: Add application
+func (c *Client) AddApplication(ctx context.Context, body AddApplicationRequest) (*Application, error) {
+	resp, err := c.doForm(ctx, http.MethodPost, "/applications", body.parts())
+	if err != nil {
+		return nil, err
+	}
+	var out Application
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CheckApplicationUpdates calls POST /api/v1/applications/check-updates: Check imported applications for updates
+func (c *Client) CheckApplicationUpdates(ctx context.Context) (*CheckApplicationUpdatesResponse, error) {
+	resp, err := c.do(ctx, http.MethodPost, "/applications/check-updates", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out CheckApplicationUpdatesResponse
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ImportApplication calls POST /api/v1/applications/import: Import application
+func (c *Client) ImportApplication(ctx context.Context, body ApplicationImportRequest) (*Application, error) {
+	resp, err := c.do(ctx, http.MethodPost, "/applications/import", nil, body)
+	if err != nil {
+		return nil, err
+	}
+	var out Application
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetApplication calls GET /api/v1/applications/{appId}: Get application
+func (c *Client) GetApplication(ctx context.Context, appID string) (*Application, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/applications/"+url.PathEscape(appID), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out Application
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdateApplication calls PUT /api/v1/applications/{appId}: Update application
+func (c *Client) UpdateApplication(ctx context.Context, appID string, body UpdateApplicationRequest) (*Application, error) {
+	resp, err := c.do(ctx, http.MethodPut, "/applications/"+url.PathEscape(appID), nil, body)
+	if err != nil {
+		return nil, err
+	}
+	var out Application
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteApplication calls DELETE /api/v1/applications/{appId}: Delete application
+func (c *Client) DeleteApplication(ctx context.Context, appID string) (*Message, error) {
+	resp, err := c.do(ctx, http.MethodDelete, "/applications/"+url.PathEscape(appID), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out Message
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListApplicationPublications calls GET /api/v1/applications/{appId}/groups: List application publications
+func (c *Client) ListApplicationPublications(ctx context.Context, appID string) (*ListApplicationPublicationsResponse, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/applications/"+url.PathEscape(appID)+"/groups", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out ListApplicationPublicationsResponse
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// PublishApplication calls POST /api/v1/applications/{appId}/groups/{groupId}: Publish application to device group
+func (c *Client) PublishApplication(ctx context.Context, appID string, groupID string, body PublishApplicationRequest) (*ApplicationPublication, error) {
+	resp, err := c.do(ctx, http.MethodPost, "/applications/"+url.PathEscape(appID)+"/groups/"+url.PathEscape(groupID), nil, body)
+	if err != nil {
+		return nil, err
+	}
+	var out ApplicationPublication
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UnpublishApplication calls DELETE /api/v1/applications/{appId}/groups/{groupId}: Unpublish application from device group
+func (c *Client) UnpublishApplication(ctx context.Context, appID string, groupID string) (*Message, error) {
+	resp, err := c.do(ctx, http.MethodDelete, "/applications/"+url.PathEscape(appID)+"/groups/"+url.PathEscape(groupID), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out Message
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DownloadApplicationPackage calls GET /api/v1/applications/{appId}/package: Download application package
+//
+// The caller must close the returned body.
+func (c *Client) DownloadApplicationPackage(ctx context.Context, appID string) (io.ReadCloser, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/applications/"+url.PathEscape(appID)+"/package", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// ListAuditEntries calls GET /api/v1/audit: List audit entries
+func (c *Client) ListAuditEntries(ctx context.Context, params *ListAuditEntriesParams) (*AuditPage, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/audit", params.values(), nil)
+	if err != nil {
+		return nil, err
+	}
+	var out AuditPage
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Login calls POST /api/v1/auth/login: User login
+func (c *Client) Login(ctx context.Context, body LoginRequest) (*AuthResponse, error) {
+	resp, err := c.do(ctx, http.MethodPost, "/auth/login", nil, body)
+	if err != nil {
+		return nil, err
+	}
+	var out AuthResponse
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Logout calls POST /api/v1/auth/logout: Logout
+func (c *Client) Logout(ctx context.Context) (*Message, error) {
+	resp, err := c.do(ctx, http.MethodPost, "/auth/logout", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out Message
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RefreshToken calls POST /api/v1/auth/refresh: Refresh access token
+func (c *Client) RefreshToken(ctx context.Context, body RefreshTokenRequest) (*AuthResponse, error) {
+	resp, err := c.do(ctx, http.MethodPost, "/auth/refresh", nil, body)
+	if err != nil {
+		return nil, err
+	}
+	var out AuthResponse
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListBulkOperations calls GET /api/v1/bulk-operations: List bulk operations
+func (c *Client) ListBulkOperations(ctx context.Context, params *ListBulkOperationsParams) (*ListBulkOperationsResponse, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/bulk-operations", params.values(), nil)
+	if err != nil {
+		return nil, err
+	}
+	var out ListBulkOperationsResponse
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateBulkOperation calls POST /api/v1/bulk-operations: Start bulk operation
+func (c *Client) CreateBulkOperation(ctx context.Context, body CreateBulkOperationRequest) (*CreateBulkOperationResponse, error) {
+	resp, err := c.do(ctx, http.MethodPost, "/bulk-operations", nil, body)
+	if err != nil {
+		return nil, err
+	}
+	out := &CreateBulkOperationResponse{StatusCode: resp.StatusCode}
+	switch resp.StatusCode {
+	case 200:
+		out.JSON200 = new(BulkOperationPreview)
+		err = decodeResponse(resp, out.JSON200)
+	case 202:
+		out.JSON202 = new(BulkOperation)
+		err = decodeResponse(resp, out.JSON202)
+	default:
+		err = decodeResponse(resp, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetBulkOperation calls GET /api/v1/bulk-operations/{operationId}: Get bulk operation
+func (c *Client) GetBulkOperation(ctx context.Context, operationID string) (*BulkOperation, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/bulk-operations/"+url.PathEscape(operationID), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out BulkOperation
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CancelBulkOperation calls POST /api/v1/bulk-operations/{operationId}/cancel: Cancel bulk operation
+func (c *Client) CancelBulkOperation(ctx context.Context, operationID string) (*BulkOperation, error) {
+	resp, err := c.do(ctx, http.MethodPost, "/bulk-operations/"+url.PathEscape(operationID)+"/cancel", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out BulkOperation
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListCommands calls GET /api/v1/commands: List commands
+func (c *Client) ListCommands(ctx context.Context, params *ListCommandsParams) (*ListCommandsResponse, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/commands", params.values(), nil)
+	if err != nil {
+		return nil, err
+	}
+	var out ListCommandsResponse
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetCommand calls GET /api/v1/commands/{commandId}: Get command
+func (c *Client) GetCommand(ctx context.Context, commandID string) (*DeviceCommand, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/commands/"+url.PathEscape(commandID), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out DeviceCommand
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetFleetCompliance calls GET /api/v1/compliance: Fleet compliance
+func (c *Client) GetFleetCompliance(ctx context.Context) (*ComplianceSummary, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/compliance", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out ComplianceSummary
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListDeviceGroups calls GET /api/v1/device-groups: List device groups
+func (c *Client) ListDeviceGroups(ctx context.Context, params *ListDeviceGroupsParams) (*ListDeviceGroupsResponse, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/device-groups", params.values(), nil)
+	if err != nil {
+		return nil, err
+	}
+	var out ListDeviceGroupsResponse
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateDeviceGroup calls POST /api/v1/device-groups: Create device group
+func (c *Client) CreateDeviceGroup(ctx context.Context, body DeviceGroupCreate) (*DeviceGroup, error) {
+	resp, err := c.do(ctx, http.MethodPost, "/device-groups", nil, body)
+	if err != nil {
+		return nil, err
+	}
+	var out DeviceGroup
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetDeviceGroup calls GET /api/v1/device-groups/{groupId}: Get device group
+func (c *Client) GetDeviceGroup(ctx context.Context, groupID string) (*DeviceGroup, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/device-groups/"+url.PathEscape(groupID), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out DeviceGroup
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdateDeviceGroup calls PUT /api/v1/device-groups/{groupId}: Update device group
+func (c *Client) UpdateDeviceGroup(ctx context.Context, groupID string, body DeviceGroupCreate) (*DeviceGroup, error) {
+	resp, err := c.do(ctx, http.MethodPut, "/device-groups/"+url.PathEscape(groupID), nil, body)
+	if err != nil {
+		return nil, err
+	}
+	var out DeviceGroup
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteDeviceGroup calls DELETE /api/v1/device-groups/{groupId}: Delete device group
+func (c *Client) DeleteDeviceGroup(ctx context.Context, groupID string) (*Message, error) {
+	resp, err := c.do(ctx, http.MethodDelete, "/device-groups/"+url.PathEscape(groupID), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out Message
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetDeviceGroupCompliance calls GET /api/v1/device-groups/{groupId}/compliance: Device group compliance
+func (c *Client) GetDeviceGroupCompliance(ctx context.Context, groupID string) (*ComplianceSummary, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/device-groups/"+url.PathEscape(groupID)+"/compliance", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out ComplianceSummary
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListDeviceGroupDevices calls GET /api/v1/device-groups/{groupId}/devices: List group members
+func (c *Client) ListDeviceGroupDevices(ctx context.Context, groupID string, params *ListDeviceGroupDevicesParams) (*ListDeviceGroupDevicesResponse, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/device-groups/"+url.PathEscape(groupID)+"/devices", params.values(), nil)
+	if err != nil {
+		return nil, err
+	}
+	var out ListDeviceGroupDevicesResponse
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// AddDeviceToGroup calls POST /api/v1/device-groups/{groupId}/devices/{deviceId}: Add device to group
+func (c *Client) AddDeviceToGroup(ctx context.Context, groupID string, deviceID string) (*Message, error) {
+	resp, err := c.do(ctx, http.MethodPost, "/device-groups/"+url.PathEscape(groupID)+"/devices/"+url.PathEscape(deviceID), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out Message
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RemoveDeviceFromGroup calls DELETE /api/v1/device-groups/{groupId}/devices/{deviceId}: Remove device from group
+func (c *Client) RemoveDeviceFromGroup(ctx context.Context, groupID string, deviceID string) (*Message, error) {
+	resp, err := c.do(ctx, http.MethodDelete, "/device-groups/"+url.PathEscape(groupID)+"/devices/"+url.PathEscape(deviceID), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out Message
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ExplainGroupMembership calls GET /api/v1/device-groups/{groupId}/devices/{deviceId}/explain: Explain group membership
+func (c *Client) ExplainGroupMembership(ctx context.Context, groupID string, deviceID string) (*GroupMembershipExplanation, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/device-groups/"+url.PathEscape(groupID)+"/devices/"+url.PathEscape(deviceID)+"/explain", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out GroupMembershipExplanation
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeviceListApplications calls GET /api/v1/device/applications: List applications with download URLs (device)
+func (c *Client) DeviceListApplications(ctx context.Context) (*DeviceListApplicationsResponse, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/device/applications", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out DeviceListApplicationsResponse
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeviceGetCatalog calls GET /api/v1/device/catalog: Get self-service catalog (device)
+func (c *Client) DeviceGetCatalog(ctx context.Context) (*DeviceGetCatalogResponse, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/device/catalog", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out DeviceGetCatalogResponse
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeviceListApplicationRequests calls GET /api/v1/device/catalog/requests: List application requests (device)
+func (c *Client) DeviceListApplicationRequests(ctx context.Context) (*DeviceListApplicationRequestsResponse, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/device/catalog/requests", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out DeviceListApplicationRequestsResponse
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeviceInstallCatalogApplication calls POST /api/v1/device/catalog/{appId}/install: Install catalog application (device)
+func (c *Client) DeviceInstallCatalogApplication(ctx context.Context, appID string) (*DeviceCommand, error) {
+	resp, err := c.do(ctx, http.MethodPost, "/device/catalog/"+url.PathEscape(appID)+"/install", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out DeviceCommand
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeviceRequestApplication calls POST /api/v1/device/catalog/{appId}/requests: Request restricted application (device)
+func (c *Client) DeviceRequestApplication(ctx context.Context, appID string, body DeviceRequestApplicationRequest) (*ApplicationRequest, error) {
+	resp, err := c.do(ctx, http.MethodPost, "/device/catalog/"+url.PathEscape(appID)+"/requests", nil, body)
+	if err != nil {
+		return nil, err
+	}
+	var out ApplicationRequest
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeviceUninstallCatalogApplication calls POST /api/v1/device/catalog/{appId}/uninstall: Uninstall catalog application (device)
+func (c *Client) DeviceUninstallCatalogApplication(ctx context.Context, appID string) (*DeviceCommand, error) {
+	resp, err := c.do(ctx, http.MethodPost, "/device/catalog/"+url.PathEscape(appID)+"/uninstall", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out DeviceCommand
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeviceCheckin calls POST /api/v1/device/checkin: Check in (device)
+func (c *Client) DeviceCheckin(ctx context.Context, body DeviceCheckinRequest) (*DeviceCheckinResponse, error) {
+	resp, err := c.do(ctx, http.MethodPost, "/device/checkin", nil, body)
+	if err != nil {
+		return nil, err
+	}
+	var out DeviceCheckinResponse
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeviceFetchCommands calls GET /api/v1/device/commands: Fetch outstanding commands (device)
+func (c *Client) DeviceFetchCommands(ctx context.Context) (*DeviceFetchCommandsResponse, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/device/commands", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out DeviceFetchCommandsResponse
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeviceAcknowledgeCommand calls POST /api/v1/device/commands/{commandId}/ack: Acknowledge command (device)
+func (c *Client) DeviceAcknowledgeCommand(ctx context.Context, commandID string) (*DeviceCommand, error) {
+	resp, err := c.do(ctx, http.MethodPost, "/device/commands/"+url.PathEscape(commandID)+"/ack", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out DeviceCommand
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeviceReportCommandResult calls POST /api/v1/device/commands/{commandId}/result: Report command result (device)
+func (c *Client) DeviceReportCommandResult(ctx context.Context, commandID string, body DeviceReportCommandResultRequest) (*DeviceCommand, error) {
+	resp, err := c.do(ctx, http.MethodPost, "/device/commands/"+url.PathEscape(commandID)+"/result", nil, body)
+	if err != nil {
+		return nil, err
+	}
+	var out DeviceCommand
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeviceEnroll calls POST /api/v1/device/enroll: Enroll with an enrollment secret (device)
+func (c *Client) DeviceEnroll(ctx context.Context, body DeviceEnrollment) (*DeviceEnrollResponse, error) {
+	resp, err := c.do(ctx, http.MethodPost, "/device/enroll", nil, body)
+	if err != nil {
+		return nil, err
+	}
+	var out DeviceEnrollResponse
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeviceListPolicies calls GET /api/v1/device/policies: List assigned policies (device)
+func (c *Client) DeviceListPolicies(ctx context.Context) (*DeviceListPoliciesResponse, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/device/policies", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out DeviceListPoliciesResponse
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeviceListLiveQueries calls GET /api/v1/device/queries: Get pending live queries (device)
+func (c *Client) DeviceListLiveQueries(ctx context.Context) (*DeviceListLiveQueriesResponse, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/device/queries", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out DeviceListLiveQueriesResponse
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeviceReportLiveQueryResult calls POST /api/v1/device/queries/{campaignId}/results: Report live query result (device)
+func (c *Client) DeviceReportLiveQueryResult(ctx context.Context, campaignID string, body DeviceReportLiveQueryResultRequest) (*LiveQueryResult, error) {
+	resp, err := c.do(ctx, http.MethodPost, "/device/queries/"+url.PathEscape(campaignID)+"/results", nil, body)
+	if err != nil {
+		return nil, err
+	}
+	var out LiveQueryResult
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeviceRotateToken calls POST /api/v1/device/token/rotate: Rotate device token (device)
+func (c *Client) DeviceRotateToken(ctx context.Context) (*DeviceRotateTokenResponse, error) {
+	resp, err := c.do(ctx, http.MethodPost, "/device/token/rotate", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out DeviceRotateTokenResponse
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListDevices calls GET /api/v1/devices: List devices
+func (c *Client) ListDevices(ctx context.Context, params *ListDevicesParams) (*ListDevicesResponse, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/devices", params.values(), nil)
+	if err != nil {
+		return nil, err
+	}
+	var out ListDevicesResponse
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// EnrollDevice calls POST /api/v1/devices: Enroll device
+func (c *Client) EnrollDevice(ctx context.Context, body DeviceEnrollment) (*EnrollDeviceResponse, error) {
+	resp, err := c.do(ctx, http.MethodPost, "/devices", nil, body)
+	if err != nil {
+		return nil, err
+	}
+	var out EnrollDeviceResponse
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetDevice calls GET /api/v1/devices/{deviceId}: Get device details
+func (c *Client) GetDevice(ctx context.Context, deviceID string) (*Device, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/devices/"+url.PathEscape(deviceID), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out Device
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdateDevice calls PUT /api/v1/devices/{deviceId}: Update device
+func (c *Client) UpdateDevice(ctx context.Context, deviceID string, body DeviceUpdate) (*Device, error) {
+	resp, err := c.do(ctx, http.MethodPut, "/devices/"+url.PathEscape(deviceID), nil, body)
+	if err != nil {
+		return nil, err
+	}
+	var out Device
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UnenrollDevice calls DELETE /api/v1/devices/{deviceId}: Unenroll device
+func (c *Client) UnenrollDevice(ctx context.Context, deviceID string) (*Message, error) {
+	resp, err := c.do(ctx, http.MethodDelete, "/devices/"+url.PathEscape(deviceID), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out Message
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListDeviceCommands calls GET /api/v1/devices/{deviceId}/commands: List device commands
+func (c *Client) ListDeviceCommands(ctx context.Context, deviceID string, params *ListDeviceCommandsParams) (*ListDeviceCommandsResponse, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/devices/"+url.PathEscape(deviceID)+"/commands", params.values(), nil)
+	if err != nil {
+		return nil, err
+	}
+	var out ListDeviceCommandsResponse
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// QueueDeviceCommand calls POST /api/v1/devices/{deviceId}/commands: Queue device command
+func (c *Client) QueueDeviceCommand(ctx context.Context, deviceID string, body QueueDeviceCommandRequest) (*DeviceCommand, error) {
+	resp, err := c.do(ctx, http.MethodPost, "/devices/"+url.PathEscape(deviceID)+"/commands", nil, body)
+	if err != nil {
+		return nil, err
+	}
+	var out DeviceCommand
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetDeviceCompliance calls GET /api/v1/devices/{deviceId}/compliance: Device compliance
+func (c *Client) GetDeviceCompliance(ctx context.Context, deviceID string) (*GetDeviceComplianceResponse, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/devices/"+url.PathEscape(deviceID)+"/compliance", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out GetDeviceComplianceResponse
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetPolicyResultHistory calls GET /api/v1/devices/{deviceId}/compliance/{policyId}: Policy result history
+func (c *Client) GetPolicyResultHistory(ctx context.Context, deviceID string, policyID string) (*GetPolicyResultHistoryResponse, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/devices/"+url.PathEscape(deviceID)+"/compliance/"+url.PathEscape(policyID), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out GetPolicyResultHistoryResponse
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// QueryDevice calls POST /api/v1/devices/{deviceId}/osquery: Run live query on a device
+func (c *Client) QueryDevice(ctx context.Context, deviceID string, body QueryDeviceRequest) (*LiveQueryCampaign, error) {
+	resp, err := c.do(ctx, http.MethodPost, "/devices/"+url.PathEscape(deviceID)+"/osquery", nil, body)
+	if err != nil {
+		return nil, err
+	}
+	var out LiveQueryCampaign
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RevokeDeviceToken calls DELETE /api/v1/devices/{deviceId}/token: Revoke device token
+func (c *Client) RevokeDeviceToken(ctx context.Context, deviceID string) error {
+	resp, err := c.do(ctx, http.MethodDelete, "/devices/"+url.PathEscape(deviceID)+"/token", nil, nil)
+	if err != nil {
+		return err
+	}
+	return decodeResponse(resp, nil)
+}
+
+// DownloadSignedApplicationPackage calls GET /api/v1/downloads/applications/{appId}: Download application package with a signed URL
+//
+// The caller must close the returned body.
+func (c *Client) DownloadSignedApplicationPackage(ctx context.Context, appID string, params *DownloadSignedApplicationPackageParams) (io.ReadCloser, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/downloads/applications/"+url.PathEscape(appID), params.values(), nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// ListEnrollmentSecrets calls GET /api/v1/enrollment-secrets: List enrollment secrets
+func (c *Client) ListEnrollmentSecrets(ctx context.Context, params *ListEnrollmentSecretsParams) (*ListEnrollmentSecretsResponse, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/enrollment-secrets", params.values(), nil)
+	if err != nil {
+		return nil, err
+	}
+	var out ListEnrollmentSecretsResponse
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateEnrollmentSecret calls POST /api/v1/enrollment-secrets: Create enrollment secret
+func (c *Client) CreateEnrollmentSecret(ctx context.Context, body CreateEnrollmentSecretRequest) (*EnrollmentSecret, error) {
+	resp, err := c.do(ctx, http.MethodPost, "/enrollment-secrets", nil, body)
+	if err != nil {
+		return nil, err
+	}
+	var out EnrollmentSecret
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetEnrollmentSecret calls GET /api/v1/enrollment-secrets/{secretId}: Get enrollment secret
+func (c *Client) GetEnrollmentSecret(ctx context.Context, secretID string) (*EnrollmentSecret, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/enrollment-secrets/"+url.PathEscape(secretID), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out EnrollmentSecret
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteEnrollmentSecret calls DELETE /api/v1/enrollment-secrets/{secretId}: Delete enrollment secret
+func (c *Client) DeleteEnrollmentSecret(ctx context.Context, secretID string) error {
+	resp, err := c.do(ctx, http.MethodDelete, "/enrollment-secrets/"+url.PathEscape(secretID), nil, nil)
+	if err != nil {
+		return err
+	}
+	return decodeResponse(resp, nil)
+}
+
+// RotateEnrollmentSecret calls POST /api/v1/enrollment-secrets/{secretId}/rotate: Rotate enrollment secret
+func (c *Client) RotateEnrollmentSecret(ctx context.Context, secretID string) (*EnrollmentSecret, error) {
+	resp, err := c.do(ctx, http.MethodPost, "/enrollment-secrets/"+url.PathEscape(secretID)+"/rotate", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out EnrollmentSecret
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetHealth calls GET /api/v1/health: Health check
+func (c *Client) GetHealth(ctx context.Context) (*HealthStatus, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/health", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out HealthStatus
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetLiveness calls GET /api/v1/health/live: Liveness probe
+func (c *Client) GetLiveness(ctx context.Context) (*HealthStatus, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/health/live", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out HealthStatus
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetReadiness calls GET /api/v1/health/ready: Readiness probe
+func (c *Client) GetReadiness(ctx context.Context) (*HealthStatus, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/health/ready", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out HealthStatus
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdateLicense calls PUT /api/v1/license: Apply license
+func (c *Client) UpdateLicense(ctx context.Context, body UpdateLicenseRequest) (*Message, error) {
+	resp, err := c.do(ctx, http.MethodPut, "/license", nil, body)
+	if err != nil {
+		return nil, err
+	}
+	var out Message
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetLicense calls GET /api/v1/license/status: Get license status
+func (c *Client) GetLicense(ctx context.Context) (*LicenseInfo, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/license/status", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out LicenseInfo
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateLiveQuery calls POST /api/v1/live-queries: Start live query
+func (c *Client) CreateLiveQuery(ctx context.Context, body CreateLiveQueryRequest) (*LiveQueryCampaign, error) {
+	resp, err := c.do(ctx, http.MethodPost, "/live-queries", nil, body)
+	if err != nil {
+		return nil, err
+	}
+	var out LiveQueryCampaign
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetLiveQuery calls GET /api/v1/live-queries/{campaignId}: Get live query
+func (c *Client) GetLiveQuery(ctx context.Context, campaignID string) (*LiveQueryCampaign, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/live-queries/"+url.PathEscape(campaignID), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out LiveQueryCampaign
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetMetrics calls GET /api/v1/metrics: System metrics
+//
+// The caller must close the returned body.
+func (c *Client) GetMetrics(ctx context.Context) (io.ReadCloser, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/metrics", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// ListPolicies calls GET /api/v1/policies: List policies
+func (c *Client) ListPolicies(ctx context.Context, params *ListPoliciesParams) (*ListPoliciesResponse, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/policies", params.values(), nil)
+	if err != nil {
+		return nil, err
+	}
+	var out ListPoliciesResponse
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreatePolicy calls POST /api/v1/policies: Create policy
+func (c *Client) CreatePolicy(ctx context.Context, body PolicyCreate) (*Policy, error) {
+	resp, err := c.do(ctx, http.MethodPost, "/policies", nil, body)
+	if err != nil {
+		return nil, err
+	}
+	var out Policy
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetPolicy calls GET /api/v1/policies/{policyId}: Get policy details
+func (c *Client) GetPolicy(ctx context.Context, policyID string) (*Policy, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/policies/"+url.PathEscape(policyID), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out Policy
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdatePolicy calls PUT /api/v1/policies/{policyId}: Update policy
+func (c *Client) UpdatePolicy(ctx context.Context, policyID string, body PolicyUpdate) (*Policy, error) {
+	resp, err := c.do(ctx, http.MethodPut, "/policies/"+url.PathEscape(policyID), nil, body)
+	if err != nil {
+		return nil, err
+	}
+	var out Policy
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeletePolicy calls DELETE /api/v1/policies/{policyId}: Delete policy
+func (c *Client) DeletePolicy(ctx context.Context, policyID string) (*Message, error) {
+	resp, err := c.do(ctx, http.MethodDelete, "/policies/"+url.PathEscape(policyID), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out Message
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetPolicyCompliance calls GET /api/v1/policies/{policyId}/compliance: Policy compliance
+func (c *Client) GetPolicyCompliance(ctx context.Context, policyID string) (*ComplianceSummary, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/policies/"+url.PathEscape(policyID)+"/compliance", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out ComplianceSummary
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListPolicyDevices calls GET /api/v1/policies/{policyId}/devices: List policy devices
+func (c *Client) ListPolicyDevices(ctx context.Context, policyID string, params *ListPolicyDevicesParams) (*ListPolicyDevicesResponse, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/policies/"+url.PathEscape(policyID)+"/devices", params.values(), nil)
+	if err != nil {
+		return nil, err
+	}
+	var out ListPolicyDevicesResponse
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// AssignPolicyToDevice calls POST /api/v1/policies/{policyId}/devices/{deviceId}: Assign policy to device
+func (c *Client) AssignPolicyToDevice(ctx context.Context, policyID string, deviceID string) (*Message, error) {
+	resp, err := c.do(ctx, http.MethodPost, "/policies/"+url.PathEscape(policyID)+"/devices/"+url.PathEscape(deviceID), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out Message
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UnassignPolicyFromDevice calls DELETE /api/v1/policies/{policyId}/devices/{deviceId}: Unassign policy from device
+func (c *Client) UnassignPolicyFromDevice(ctx context.Context, policyID string, deviceID string) (*Message, error) {
+	resp, err := c.do(ctx, http.MethodDelete, "/policies/"+url.PathEscape(policyID)+"/devices/"+url.PathEscape(deviceID), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out Message
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListPolicyGroups calls GET /api/v1/policies/{policyId}/groups: List policy groups
+func (c *Client) ListPolicyGroups(ctx context.Context, policyID string, params *ListPolicyGroupsParams) (*ListPolicyGroupsResponse, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/policies/"+url.PathEscape(policyID)+"/groups", params.values(), nil)
+	if err != nil {
+		return nil, err
+	}
+	var out ListPolicyGroupsResponse
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// AssignPolicyToGroup calls POST /api/v1/policies/{policyId}/groups/{groupId}: Assign policy to device group
+func (c *Client) AssignPolicyToGroup(ctx context.Context, policyID string, groupID string) (*Message, error) {
+	resp, err := c.do(ctx, http.MethodPost, "/policies/"+url.PathEscape(policyID)+"/groups/"+url.PathEscape(groupID), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out Message
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UnassignPolicyFromGroup calls DELETE /api/v1/policies/{policyId}/groups/{groupId}: Unassign policy from device group
+func (c *Client) UnassignPolicyFromGroup(ctx context.Context, policyID string, groupID string) (*Message, error) {
+	resp, err := c.do(ctx, http.MethodDelete, "/policies/"+url.PathEscape(policyID)+"/groups/"+url.PathEscape(groupID), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out Message
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListUsers calls GET /api/v1/users: List users
+func (c *Client) ListUsers(ctx context.Context, params *ListUsersParams) (*ListUsersResponse, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/users", params.values(), nil)
+	if err != nil {
+		return nil, err
+	}
+	var out ListUsersResponse
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateUser calls POST /api/v1/users: Create user
+func (c *Client) CreateUser(ctx context.Context, body UserCreate) (*User, error) {
+	resp, err := c.do(ctx, http.MethodPost, "/users", nil, body)
+	if err != nil {
+		return nil, err
+	}
+	var out User
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetUser calls GET /api/v1/users/{userId}: Get user
+func (c *Client) GetUser(ctx context.Context, userID string) (*User, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/users/"+url.PathEscape(userID), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out User
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdateUser calls PUT /api/v1/users/{userId}: Update user
+func (c *Client) UpdateUser(ctx context.Context, userID string, body UserUpdate) (*User, error) {
+	resp, err := c.do(ctx, http.MethodPut, "/users/"+url.PathEscape(userID), nil, body)
+	if err != nil {
+		return nil, err
+	}
+	var out User
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteUser calls DELETE /api/v1/users/{userId}: Delete user
+func (c *Client) DeleteUser(ctx context.Context, userID string) (*Message, error) {
+	resp, err := c.do(ctx, http.MethodDelete, "/users/"+url.PathEscape(userID), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out Message
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RevokeUserSessions calls DELETE /api/v1/users/{userId}/sessions: Revoke user sessions
+func (c *Client) RevokeUserSessions(ctx context.Context, userID string) (*Message, error) {
+	resp, err := c.do(ctx, http.MethodDelete, "/users/"+url.PathEscape(userID)+"/sessions", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out Message
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
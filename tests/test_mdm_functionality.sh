@@ -176,7 +176,7 @@ test_license_management() {
         log_test "License Status" "FAIL" "Returns HTTP $http_code instead of 200"
     fi
     
-    # Test license update
+    # Test license update; license keys must be signed
     update_response=$(curl -s -X PUT http://localhost:8081/api/v1/license \
         -H "Authorization: Bearer $TOKEN" \
         -H "Content-Type: application/json" \
@@ -185,10 +185,10 @@ test_license_management() {
         -o /dev/null)
     
     update_code="${update_response: -3}"
-    if [ "$update_code" = "200" ] || [ "$update_code" = "201" ]; then
-        log_test "License Update" "PASS" "License updated successfully"
+    if [ "$update_code" = "400" ]; then
+        log_test "License Update" "PASS" "Unsigned license key rejected"
     else
-        log_test "License Update" "FAIL" "Returns HTTP $update_code"
+        log_test "License Update" "FAIL" "Returns HTTP $update_code instead of 400"
     fi
 }
 